@@ -18,26 +18,62 @@ package commands
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/diff"
+	"github.com/splunk/qbec/internal/health"
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/objsort"
 	"github.com/splunk/qbec/internal/remote"
 	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type applyStats struct {
-	Created []string `json:"created,omitempty"`
-	Updated []string `json:"updated,omitempty"`
-	Skipped []string `json:"skipped,omitempty"`
-	Deleted []string `json:"deleted,omitempty"`
-	Same    int      `json:"same,omitempty"`
+	Created  []string          `json:"created,omitempty"`
+	Updated  []string          `json:"updated,omitempty"`
+	Skipped  []string          `json:"skipped,omitempty"`
+	Deleted  []string          `json:"deleted,omitempty"`
+	Same     int               `json:"same,omitempty"`
+	Resumed  int               `json:"resumed,omitempty"`  // objects not applied since they were applied before the checkpoint
+	Requeued []string          `json:"requeued,omitempty"` // objects applied after a webhook they needed became available
+	Stalled  map[string]string `json:"stalled,omitempty"`
+	Stuck    []string          `json:"stuck,omitempty"` // objects that were deleted but still exist, with the reasons
+	// objects that would be deleted along with their dependents, by namespace and kind
+	Impact map[string]map[string][]string `json:"impact,omitempty"`
+	// components that are no longer part of the environment and whose objects were (or would be) deleted
+	RemovedComponents map[string]string `json:"removedComponents,omitempty"`
+	// fields managed by other field managers that were (or for failed updates, would have been) changed, by object
+	Conflicts map[string][]remote.FieldConflict `json:"conflicts,omitempty"`
+	// per-group counts and durations when output is grouped
+	Groups    map[string]*groupStats `json:"groups,omitempty"`
+	sameNames []string               // names of objects that were identical
+}
+
+func (a *applyStats) addConflicts(name string, conflicts []remote.FieldConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	if a.Conflicts == nil {
+		a.Conflicts = map[string][]remote.FieldConflict{}
+	}
+	a.Conflicts[name] = conflicts
 }
 
 func (a *applyStats) update(name string, s *remote.SyncResult) {
 	switch s.Type {
 	case remote.SyncObjectsIdentical:
 		a.Same++
+		a.sameNames = append(a.sameNames, name)
 	case remote.SyncSkip:
 		a.Skipped = append(a.Skipped, name)
 	case remote.SyncCreated:
@@ -52,134 +88,1089 @@ func (a *applyStats) update(name string, s *remote.SyncResult) {
 // applyClient is the remote interface needed for apply operations.
 type applyClient interface {
 	listClient
-	DisplayName(o model.K8sMeta) string
+	protectionClient
 	Sync(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error)
-	Delete(obj model.K8sMeta, dryRun bool) (*remote.SyncResult, error)
+	Delete(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error)
+	RenderHashes(scope remote.ListQueryConfig) (remote.ObjectHashes, error)
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+	RecordTombstones(namespace, name string, tombstones []remote.Tombstone, max int) error
+	Inventory(namespace, name string) ([]string, error)
+	RecordInventory(namespace, name string, components []string) error
+	Impersonate(user string, groups []string) (Client, error)
+}
+
+// componentClients provides clients for components, impersonating the identities configured for them.
+type componentClients struct {
+	app     *model.App
+	base    applyClient
+	clients map[string]applyClient
+}
+
+func newComponentClients(app *model.App, base applyClient) *componentClients {
+	return &componentClients{app: app, base: base, clients: map[string]applyClient{}}
 }
 
+// get returns the client to use for objects of the supplied component.
+func (c *componentClients) get(component string) (applyClient, error) {
+	if client, ok := c.clients[component]; ok {
+		return client, nil
+	}
+	client := c.base
+	if imp := c.app.ComponentImpersonation(component); imp != nil {
+		ic, err := c.base.Impersonate(imp.User, imp.Groups)
+		if err != nil {
+			return nil, errors.Wrapf(err, "component %s: impersonate %s", component, imp.User)
+		}
+		sio.Noticef("component %s: impersonating %s\n", component, imp.User)
+		client = ic
+	}
+	c.clients[component] = client
+	return client, nil
+}
+
+// gcOptions restricts the objects that are garbage collected.
+type gcOptions struct {
+	kindIncludes []string // only collect objects of these kinds
+	kindExcludes []string // do not collect objects of these kinds
+	namespaces   []string // only collect objects in these namespaces
+	dryRun       bool     // only list deletion candidates without any other changes
+	override     bool     // delete objects even if they are protected
+	format       string   // output format for deletion candidates of a dry-run, blank for log messages
+	columns      []string // columns of table output for deletion candidates
+}
+
+// dry-run modes for apply
+const (
+	dryRunClient = "client" // compute changes locally without making any server calls that change objects
+	dryRunServer = "server" // have the server process changes without persisting them
+)
+
+// update-only modes for apply
+const (
+	updateOnlySkip  = "skip"  // skip objects that do not exist
+	updateOnlyError = "error" // fail the apply for objects that do not exist
+)
+
 type applyCommandConfig struct {
 	StdOptions
-	syncOptions    remote.SyncOptions
-	gc             bool
-	filterFunc     func() (filterParams, error)
-	clientProvider func(env string) (applyClient, error)
+	syncOptions     remote.SyncOptions
+	dryRunMode      string
+	showDiff        bool
+	updateOnly      string
+	gc              bool
+	gcOptions       gcOptions
+	changedOnly     bool
+	checkQuotas     bool
+	wait            bool
+	waitTimeout     time.Duration
+	timeoutPolicy   string
+	envGroup        string
+	parallelEnvs    int
+	continueOnError bool
+	canaryEnv       string
+	canarySelector  string
+	groupBy         string
+	resume          string
+	spread          time.Duration
+	allowLarge      bool
+	confirmRemoval  bool
+	cascade         string
+	stamp           applyStamp
+	objects         []model.K8sLocalObject // objects already rendered for a single environment, rendered when nil
+	filterFunc      func() (filterParams, error)
+	clientProvider  func(env string) (applyClient, error)
 }
 
 func doApply(args []string, config applyCommandConfig) error {
-	if len(args) != 1 {
+	switch config.dryRunMode {
+	case "", "false":
+	case dryRunClient, "true":
+		config.syncOptions.DryRun = true
+	case dryRunServer:
+		config.syncOptions.DryRun = true
+		config.syncOptions.ServerDryRun = true
+	default:
+		return newUsageError(fmt.Sprintf("invalid dry-run mode %q, must be one of %s or %s", config.dryRunMode, dryRunClient, dryRunServer))
+	}
+	if config.showDiff && !config.syncOptions.ServerDryRun {
+		return newUsageError("--show-diff requires --dry-run=server")
+	}
+	if err := checkCascade(config.cascade); err != nil {
+		return err
+	}
+	if err := validateGroupBy(config.groupBy); err != nil {
+		return err
+	}
+	switch config.updateOnly {
+	case "":
+	case updateOnlySkip, updateOnlyError:
+		config.syncOptions.DisableCreate = true
+	default:
+		return newUsageError(fmt.Sprintf("invalid update-only mode %q, must be one of %s or %s", config.updateOnly, updateOnlySkip, updateOnlyError))
+	}
+	var envs []string
+	single := false
+	switch {
+	case config.envGroup != "" && len(args) > 0:
+		return newUsageError("cannot specify environments as well as an environment group")
+	case config.envGroup != "":
+		list, err := config.App().EnvironmentsForGroup(config.envGroup)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		envs = expandClusters(config.App(), list)
+	case len(args) == 1:
+		list, multi, err := expandEnvironments(config.App(), args[0])
+		if err != nil {
+			return err
+		}
+		envs, single = list, !multi
+	default:
 		return newUsageError("exactly one environment required")
 	}
-	env := args[0]
-	if env == model.Baseline { // cannot apply for the baseline environment
-		return newUsageError("cannot apply baseline environment, use a real environment")
+	for _, env := range envs {
+		if env == model.Baseline { // cannot apply for the baseline environment
+			return newUsageError("cannot apply baseline environment, use a real environment")
+		}
+	}
+	if config.canaryEnv != "" && len(envs) == 1 {
+		return newUsageError("--canary-env requires multiple environments")
 	}
-	fp, err := config.filterFunc()
-	if err != nil {
+	if config.spread < 0 {
+		return newUsageError(fmt.Sprintf("invalid spread duration %v, must not be negative", config.spread))
+	}
+	if config.resume != "" && (len(envs) != 1 || config.envGroup != "") {
+		return newUsageError("--resume requires a single environment")
+	}
+	if single {
+		stats, err := applyEnvironment(envs[0], config)
+		if stats != nil {
+			printStats(config.Stdout(), stats)
+		}
 		return err
 	}
-	objects, err := filteredObjects(config, env, fp)
+	return applyEnvironments(envs, config)
+}
+
+// multiEnvStats is the consolidated summary for applying to multiple environments.
+type multiEnvStats struct {
+	Environments map[string]*applyStats `json:"environments,omitempty"`
+	Failed       map[string]string      `json:"failed,omitempty"`
+}
+
+// confirmedOptions are options for which confirmation has already been obtained.
+type confirmedOptions struct {
+	StdOptions
+}
+
+func (c confirmedOptions) Confirm(context string) error {
+	return nil
+}
+
+// applyEnvironments applies to the supplied environments with the configured parallelism, printing a
+// consolidated summary at the end. Unless errors are to be ignored, no new environments are processed after the
+// first failure.
+func applyEnvironments(envs []string, config applyCommandConfig) error {
+	seen := map[string]bool{}
+	for _, env := range envs {
+		if seen[env] {
+			return newUsageError(fmt.Sprintf("duplicate environment %q", env))
+		}
+		seen[env] = true
+		if _, ok := config.App().Spec.Environments[env]; !ok {
+			return newUsageError(fmt.Sprintf("invalid environment %q", env))
+		}
+	}
+	if config.canaryEnv != "" && !seen[config.canaryEnv] {
+		return newUsageError(fmt.Sprintf("canary environment %q is not one of the environments being applied", config.canaryEnv))
+	}
+	if !config.syncOptions.DryRun {
+		msg := fmt.Sprintf("will apply to %d environment(s): %s", len(envs), strings.Join(envs, ", "))
+		if err := config.Confirm(msg); err != nil {
+			return err
+		}
+	}
+	config.StdOptions = confirmedOptions{config.StdOptions}
+	total := len(envs)
+	summary := multiEnvStats{Environments: map[string]*applyStats{}, Failed: map[string]string{}}
+
+	// apply to the canary environment first, waiting for its objects to be healthy
+	if config.canaryEnv != "" {
+		sio.Noticeln("applying to canary environment", config.canaryEnv)
+		canaryConfig := config
+		canaryConfig.wait = true
+		stats, err := applyEnvironment(config.canaryEnv, canaryConfig)
+		if stats != nil {
+			summary.Environments[config.canaryEnv] = stats
+		}
+		if err != nil {
+			if isUsageError(err) {
+				return err
+			}
+			summary.Failed[config.canaryEnv] = err.Error()
+			printStats(config.Stdout(), &summary)
+			return fmt.Errorf("canary environment %s failed, halting rollout: %v", config.canaryEnv, err)
+		}
+		var rest []string
+		for _, env := range envs {
+			if env != config.canaryEnv {
+				rest = append(rest, env)
+			}
+		}
+		envs = rest
+	}
+
+	parallel := config.parallelEnvs
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var l sync.Mutex
+	var usageErr error
+	failed := false
+
+	ch := make(chan string, len(envs))
+	for _, env := range envs {
+		ch <- env
+	}
+	close(ch)
+	var wg sync.WaitGroup
+	wg.Add(parallel)
+	for i := 0; i < parallel; i++ {
+		go func() {
+			defer wg.Done()
+			for env := range ch {
+				l.Lock()
+				stop := failed && !config.continueOnError
+				l.Unlock()
+				if stop {
+					continue
+				}
+				sio.Noticeln("applying to environment", env)
+				stats, err := applyEnvironment(env, config)
+				l.Lock()
+				if stats != nil {
+					summary.Environments[env] = stats
+				}
+				if err != nil {
+					sio.Errorf("environment %s: %v\n", env, err)
+					summary.Failed[env] = err.Error()
+					failed = true
+					if isUsageError(err) && usageErr == nil {
+						usageErr = err
+					}
+				}
+				l.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if usageErr != nil {
+		return usageErr
+	}
+	printStats(config.Stdout(), &summary)
+	if len(summary.Failed) > 0 {
+		return fmt.Errorf("apply failed for %d of %d environment(s)", len(summary.Failed), total)
+	}
+	return nil
+}
+
+// applyEnvironment applies objects to a single environment and returns the stats for the operation. Stats may be
+// returned even when an error is returned. When objects were applied before a failure, a checkpoint listing them is
+// written such that a subsequent apply can resume from it.
+func applyEnvironment(env string, config applyCommandConfig) (_ *applyStats, finalError error) {
+	policy := config.timeoutPolicy
+	if policy == "" {
+		policy = config.App().TimeoutPolicy()
+	}
+	if policy != model.TimeoutPolicyFail && policy != model.TimeoutPolicyContinue {
+		return nil, newUsageError(fmt.Sprintf("invalid timeout policy %q, must be one of %s or %s", policy, model.TimeoutPolicyFail, model.TimeoutPolicyContinue))
+	}
+	gco := config.gcOptions
+	if gco.dryRun && !config.gc {
+		return nil, newUsageError("cannot specify --gc-dry-run when garbage collection is disabled")
+	}
+	switch {
+	case gco.format != "" && gco.format != "table":
+		return nil, newUsageError(fmt.Sprintf("invalid output format: %q", gco.format))
+	case gco.format != "" && !gco.dryRun:
+		return nil, newUsageError("--format can only be used with --gc-dry-run")
+	case len(gco.columns) > 0 && gco.format != "table":
+		return nil, newUsageError("--columns can only be used with the table format")
+	}
+	gcColumns, err := tableColumns(gco.columns, changeColumns)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	gcKindFilter, err := model.NewKindFilter(gco.kindIncludes, gco.kindExcludes)
+	if err != nil {
+		return nil, newUsageError(strings.Replace(err.Error(), "kinds", "gc kinds", 1))
+	}
+	var resumeFrom *applyCheckpoint
+	if config.resume != "" {
+		resumeFrom, err = loadApplyCheckpoint(config.resume)
+		if err != nil {
+			return nil, errors.Wrap(err, "load checkpoint")
+		}
+		if resumeFrom.App != config.App().Name() || resumeFrom.Env != env {
+			return nil, newUsageError(fmt.Sprintf("checkpoint %s is for environment %s of app %s, not environment %s of app %s",
+				config.resume, resumeFrom.Env, resumeFrom.App, env, config.App().Name()))
+		}
+	}
+	var canarySelector labels.Selector
+	if config.canarySelector != "" {
+		canarySelector, err = labels.Parse(config.canarySelector)
+		if err != nil {
+			return nil, newUsageError(fmt.Sprintf("invalid canary selector %q: %v", config.canarySelector, err))
+		}
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return nil, err
+	}
+	objects := config.objects
+	if objects == nil {
+		objects, err = filteredObjects(config, env, fp)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	client, err := config.clientProvider(env)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// prepare for GC with object list of deletions
 	var lister lister = &stubLister{}
+	var all []model.K8sLocalObject
+	var gcQuery remote.ListQueryConfig
 	if config.gc {
-		all, err := allObjects(config, env)
+		all, err = allObjects(config, env)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		var scope remote.ListQueryScope
 		lister, scope, err = newRemoteLister(client, all, config.DefaultNamespace(env))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		cf, err := model.NewComponentFilter(fp.includes, fp.excludes)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		lister.start(all, remote.ListQueryConfig{
+		if len(gco.namespaces) > 0 {
+			scope = remote.ListQueryScope{Namespaces: gco.namespaces}
+		}
+		gcQuery = remote.ListQueryConfig{
 			Application:     config.App().Name(),
 			Environment:     env,
-			KindFilter:      fp.kindFilter,
+			KindFilter:      model.NewAndFilter(fp.kindFilter, gcKindFilter),
+			LabelSelector:   fp.selectorString(),
 			ComponentFilter: cf,
 			ListQueryScope:  scope,
-		})
+		}
+		lister.start(all, gcQuery)
+	}
+
+	opts := config.syncOptions
+	// only process deletions for a GC dry-run
+	if gco.dryRun {
+		opts.DryRun = true
+		objects = nil
+	}
+	replaceKinds, err := model.NewKindFilter(config.App().Spec.ReplaceKinds, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var registry *health.Registry
+	if config.wait || canarySelector != nil {
+		registry, err = health.NewRegistry(config.App().Spec.HealthChecks, config.VM().Config())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// continue with apply
 	objects = objsort.Sort(objects, config.SortConfig(client.IsNamespaced))
 
-	opts := config.syncOptions
 	dryRun := ""
 	if opts.DryRun {
 		dryRun = "[dry-run] "
 	}
 
+	// load render hashes of server objects such that unchanged objects can be skipped or changes counted
+	limits := config.App().Spec.ChangeLimits
+	checkLimits := limits != nil && !config.allowLarge && !gco.dryRun
+	var hashes, serverHashes remote.ObjectHashes
+	if config.changedOnly || (checkLimits && limits.MaxChangePercent > 0) {
+		scope, _ := listScope(client, objects, config.DefaultNamespace(env))
+		serverHashes, err = client.RenderHashes(remote.ListQueryConfig{
+			Application:    config.App().Name(),
+			Environment:    env,
+			KindFilter:     fp.kindFilter,
+			LabelSelector:  fp.selectorString(),
+			ListQueryScope: scope,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.changedOnly {
+		hashes = serverHashes
+	}
+
+	// deletions are listed in the background and only returned once
+	var deletions []model.K8sQbecMeta
+	listed := false
+	listDeletions := func() ([]model.K8sQbecMeta, error) {
+		if listed {
+			return deletions, nil
+		}
+		list, err := lister.results()
+		if err != nil {
+			return nil, err
+		}
+		if len(gco.namespaces) > 0 {
+			list = inNamespaces(list, gco.namespaces)
+		}
+		deletions, listed = list, true
+		return deletions, nil
+	}
+
+	// fail early when the apply would make more changes than allowed by the app
+	if checkLimits {
+		list, err := listDeletions()
+		if err != nil {
+			return nil, err
+		}
+		// objects applied by versions of qbec that did not record render hashes are not known to be changed, and
+		// are not counted as changes such that the first apply after an upgrade does not trip the limit
+		changed, unknown := 0, 0
+		for _, ob := range objects {
+			hash, err := remote.RenderHash(ob)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case serverHashes == nil || !serverHashes.Exists(ob):
+				changed++
+			case serverHashes.Hash(ob) == "":
+				unknown++
+			case serverHashes.Hash(ob) != hash:
+				changed++
+			}
+		}
+		if unknown > 0 && limits.MaxChangePercent > 0 {
+			sio.Warnf("%d object(s) have no render hash and are not counted against the change limits\n", unknown)
+		}
+		if err := checkChangeLimits(limits, len(objects), changed, len(list)); err != nil {
+			switch {
+			case opts.DryRun:
+				sio.Warnln(err)
+			case limits.Confirm:
+				if err := config.Confirm(err.Error()); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	// detect deletions of objects of removed components before making any changes, such that renames can be
+	// detected from live objects and unconfirmed removals fail the apply without changing anything
+	var removed []*removedComponent
+	if config.gc {
+		list, err := listDeletions()
+		if err != nil {
+			return nil, err
+		}
+		_, removed, err = splitRemovedComponents(client, config, env, all, list, gcQuery)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range removed {
+			sio.Warnf("component %s %s, %d live object(s) will be deleted\n", r.name, r.status(), len(r.objects))
+		}
+		if len(removed) > 0 && !opts.DryRun && !config.confirmRemoval {
+			return nil, removalError(removed)
+		}
+	}
+	removedComponents := map[string]bool{}
+	for _, r := range removed {
+		removedComponents[r.name] = true
+	}
+
+	// fail early when objects would be rejected for exceeding resource quotas
+	if config.checkQuotas {
+		if err := checkQuotas(client, objects, config.DefaultNamespace(env)); err != nil {
+			return nil, err
+		}
+	}
+
 	if !opts.DryRun && len(objects) > 0 {
 		msg := fmt.Sprintf("will synchronize %d object(s)", len(objects))
 		if err := config.Confirm(msg); err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	// stall records a component that exceeded its timeouts, returning an error if processing must stop
+	stalled := map[string]string{}
+	stall := func(component, reason string) error {
+		if policy == model.TimeoutPolicyFail {
+			return fmt.Errorf("component %s: %s", component, reason)
 		}
+		sio.Warnf("component %s: %s, continuing with other components\n", component, reason)
+		stalled[component] = reason
+		return nil
 	}
 
+	// record applied objects and write a checkpoint if the apply fails, removing the one resumed from on success
+	checkpoint := newApplyCheckpoint(config.App().Name(), env)
+	defer func() {
+		if opts.DryRun {
+			return
+		}
+		if finalError == nil {
+			if config.resume != "" {
+				if err := os.Remove(config.resume); err != nil && !os.IsNotExist(err) {
+					sio.Warnf("unable to remove checkpoint %s: %v\n", config.resume, err)
+				}
+			}
+			return
+		}
+		if isUsageError(finalError) || len(checkpoint.Completed) == 0 {
+			return
+		}
+		file := checkpointFile(env)
+		if err := saveApplyCheckpoint(file, checkpoint); err != nil {
+			sio.Warnf("unable to write checkpoint %s: %v\n", file, err)
+			return
+		}
+		sio.Warnf("wrote checkpoint for %d applied object(s) to %s, use --resume %s to continue from it\n", len(checkpoint.Completed), file, file)
+	}()
+
+	clients := newComponentClients(config.App(), client)
 	var stats applyStats
-	for _, ob := range objects {
-		name := client.DisplayName(ob)
-		res, err := client.Sync(ob, opts)
+	groups := newGrouper(config.groupBy, config.DefaultNamespace(env), client.IsNamespaced)
+	defer func() {
+		groups.flush(sio.Output)
+		if groups != nil {
+			stats.Groups = groups.summarize(
+				groupCount{stats.Created, func(s *groupStats) { s.Created++ }},
+				groupCount{stats.Updated, func(s *groupStats) { s.Updated++ }},
+				groupCount{stats.Skipped, func(s *groupStats) { s.Skipped++ }},
+				groupCount{stats.Deleted, func(s *groupStats) { s.Deleted++ }},
+				groupCount{stats.sameNames, func(s *groupStats) { s.Same++ }},
+			)
+		}
+	}()
+	syncTimes := map[string]time.Duration{}
+	var pace *pacer
+	if !opts.DryRun {
+		pace = newPacer(config.spread, len(objects))
+	}
+	var missing []string // objects that were not created in update-only mode
+	stampAnnotations := config.stamp.annotations()
+
+	// syncList syncs the supplied objects and returns the ones that were created or updated along with the ones that
+	// were rejected because a webhook that is part of the apply could not be called
+	applied := objects
+	retries := map[string]int{}
+	syncList := func(list []model.K8sLocalObject) ([]model.K8sLocalObject, []*deferredObject, error) {
+		var changed []model.K8sLocalObject
+		var deferred []*deferredObject
+		for _, ob := range list {
+			name := client.DisplayName(ob)
+			group := groups.add(name, ob)
+			component := ob.Component()
+			if _, ok := stalled[component]; ok {
+				stats.update(name, &remote.SyncResult{Type: remote.SyncSkip, Details: "component stalled"})
+				pace.done()
+				continue
+			}
+			hash, err := remote.RenderHash(ob)
+			if err != nil {
+				return nil, nil, err
+			}
+			if resumeFrom != nil && resumeFrom.has(ob, hash) {
+				stats.Resumed++
+				checkpoint.add(ob, hash)
+				if config.Verbosity() > 0 {
+					sio.Noticeln(dryRun+"skip", name)
+					sio.Println("applied before checkpoint")
+				}
+				pace.done()
+				continue
+			}
+			var res *remote.SyncResult
+			if hashes != nil && hashes.Hash(ob) == hash {
+				res = &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "render hash unchanged"}
+			} else {
+				cc, err := clients.get(component)
+				if err != nil {
+					return nil, nil, err
+				}
+				applyTimeout, _ := config.App().ComponentTimeouts(component)
+				pace.wait()
+				start := time.Now()
+				objOpts := opts
+				objOpts.Replace = replaceKinds.HasFilters() && replaceKinds.ShouldInclude(ob.GetKind())
+				objOpts.Annotations = stampAnnotations
+				res, err = syncWithTimeout(cc, ob, objOpts, applyTimeout, syncTimes[component])
+				elapsed := time.Since(start)
+				syncTimes[component] += elapsed
+				groups.took(name, elapsed)
+				if err == remote.ErrSyncTimeout {
+					if err := stall(component, fmt.Sprintf("apply timed out after %v", applyTimeout)); err != nil {
+						return nil, nil, err
+					}
+					stats.update(name, &remote.SyncResult{Type: remote.SyncSkip, Details: "component stalled"})
+					pace.done()
+					continue
+				}
+				if webhook := failedWebhook(err); webhook != "" && !opts.DryRun {
+					if deps := webhookDependencies(applied, webhook, config.DefaultNamespace(env)); deps != nil {
+						if retries[name] == 0 {
+							sio.Warnf("%s: webhook %s is not available, will retry once its dependencies are ready\n", name, webhook)
+						}
+						deferred = append(deferred, &deferredObject{object: ob, name: name, webhook: webhook, deps: deps, err: err})
+						continue
+					}
+				}
+				if err != nil {
+					if ce, ok := errors.Cause(err).(*remote.ConflictError); ok {
+						stats.addConflicts(name, ce.Conflicts)
+					}
+					return nil, nil, err
+				}
+			}
+			stats.update(name, res)
+			pace.done()
+			if res.Type != remote.SyncSkip {
+				checkpoint.add(ob, hash)
+			}
+			stats.addConflicts(name, res.Conflicts)
+			if len(res.Conflicts) > 0 {
+				sio.Warnf("%s: %d field(s) managed by others changed\n", name, len(res.Conflicts))
+			}
+			if res.Type == remote.SyncCreated || res.Type == remote.SyncUpdated {
+				changed = append(changed, ob)
+			}
+			if res.Type == remote.SyncSkip && res.Details == remote.CreateDisabled && config.updateOnly == updateOnlyError {
+				missing = append(missing, name)
+			}
+			show := res.Type != remote.SyncObjectsIdentical || config.Verbosity() > 0
+			if show {
+				groups.print(group, func(w io.Writer) {
+					sio.Fnoticeln(w, dryRun+"sync", name)
+					fmt.Fprintln(w, res.Details)
+				})
+			}
+			if config.showDiff && res.DryRunResult != nil {
+				if err := showServerDryRunDiff(config, name, res); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		return changed, deferred, nil
+	}
+
+	// syncObjects syncs the supplied objects and returns the ones that were created or updated. Objects rejected by
+	// webhooks that could not be called are retried after the service and workloads of their webhooks are ready.
+	syncObjects := func(list []model.K8sLocalObject) ([]model.K8sLocalObject, error) {
+		changed, pending, err := syncList(list)
+		if err != nil {
+			return nil, err
+		}
+		waited := map[string]bool{}
+		for len(pending) > 0 {
+			ready, rest, err := readyDeferred(pending, client.DisplayName)
+			if err != nil {
+				return nil, err
+			}
+			var deps []model.K8sMeta
+			var retry []model.K8sLocalObject
+			delay := false
+			for _, d := range ready {
+				if retries[d.name] >= webhookRetries {
+					return nil, errors.Wrapf(d.err, "%s: webhook %s still not available after %d retries", d.name, d.webhook, webhookRetries)
+				}
+				delay = delay || retries[d.name] > 0
+				retries[d.name]++
+				for _, dep := range d.deps {
+					if depName := client.DisplayName(dep); !waited[depName] {
+						waited[depName] = true
+						deps = append(deps, dep)
+					}
+				}
+				retry = append(retry, d.object)
+			}
+			if len(deps) > 0 {
+				if registry == nil {
+					registry, err = health.NewRegistry(config.App().Spec.HealthChecks, config.VM().Config())
+					if err != nil {
+						return nil, err
+					}
+				}
+				sio.Noticef("waiting for %d webhook dependencies to be ready\n", len(deps))
+				if err := registry.Wait(deps, client.Get, health.WaitOptions{Timeout: config.waitTimeout, DisplayName: client.DisplayName}); err != nil {
+					return nil, errors.Wrap(err, "wait for webhook dependencies")
+				}
+			}
+			// objects that were already retried wait once per round, since their dependencies were ready before
+			if delay {
+				time.Sleep(webhookRetryDelay)
+			}
+			ch, again, err := syncList(retry)
+			if err != nil {
+				return nil, err
+			}
+			for _, ob := range ch {
+				stats.Requeued = append(stats.Requeued, client.DisplayName(ob))
+			}
+			changed = append(changed, ch...)
+			pending = append(rest, again...)
+		}
+		return changed, nil
+	}
+
+	// syncFailed returns the stats along with the supplied error when they have conflicts to be reported
+	syncFailed := func(err error) (*applyStats, error) {
+		if len(stats.Conflicts) > 0 {
+			return &stats, err
+		}
+		return nil, err
+	}
+
+	// waitFor waits for the supplied objects to be healthy using per-component timeouts and returns the wait
+	// errors keyed by component
+	waitFor := func(list []model.K8sLocalObject) (map[string]error, error) {
+		sio.Noticef("waiting for %d object(s) to be ready\n", len(list))
+		byComponent := map[string][]model.K8sMeta{}
+		for _, ob := range list {
+			byComponent[ob.Component()] = append(byComponent[ob.Component()], ob)
+		}
+		var l sync.Mutex
+		var wg sync.WaitGroup
+		waitErrors := map[string]error{}
+		for component, list := range byComponent {
+			timeout := config.waitTimeout
+			if _, t := config.App().ComponentTimeouts(component); t > 0 {
+				timeout = t
+			}
+			cc, err := clients.get(component)
+			if err != nil {
+				return nil, err
+			}
+			wg.Add(1)
+			go func(component string, list []model.K8sMeta, timeout time.Duration, cc applyClient) {
+				defer wg.Done()
+				err := registry.Wait(list, cc.Get, health.WaitOptions{
+					Timeout:     timeout,
+					DisplayName: client.DisplayName,
+				})
+				if err != nil {
+					l.Lock()
+					waitErrors[component] = err
+					l.Unlock()
+				}
+			}(component, list, timeout, cc)
+		}
+		wg.Wait()
+		return waitErrors, nil
+	}
+
+	// apply canary objects first and halt the rollout unless they are healthy
+	if canarySelector != nil {
+		var canaries, rest []model.K8sLocalObject
+		for _, ob := range objects {
+			if canarySelector.Matches(labels.Set(ob.ToUnstructured().GetLabels())) {
+				canaries = append(canaries, ob)
+			} else {
+				rest = append(rest, ob)
+			}
+		}
+		if len(canaries) > 0 {
+			sio.Noticef("%sapplying %d canary object(s)\n", dryRun, len(canaries))
+			changed, err := syncObjects(canaries)
+			if err != nil {
+				return syncFailed(err)
+			}
+			if len(stalled) > 0 {
+				return &stats, fmt.Errorf("canary objects stalled, halting rollout")
+			}
+			if !opts.DryRun && len(changed) > 0 {
+				waitErrors, err := waitFor(changed)
+				if err != nil {
+					return nil, err
+				}
+				if len(waitErrors) > 0 {
+					var msgs []string
+					for component, err := range waitErrors {
+						msgs = append(msgs, fmt.Sprintf("component %s: %v", component, err))
+					}
+					sort.Strings(msgs)
+					return &stats, fmt.Errorf("canary objects not healthy, halting rollout\n%s", strings.Join(msgs, "\n"))
+				}
+			}
+		}
+		objects = rest
+	}
+
+	// waitAndStall waits for the supplied objects to be healthy and stalls the components of objects that are not
+	waitAndStall := func(list []model.K8sLocalObject) error {
+		waitErrors, err := waitFor(list)
 		if err != nil {
 			return err
 		}
-		stats.update(name, res)
-		show := res.Type != remote.SyncObjectsIdentical || config.Verbosity() > 0
-		if show {
-			sio.Noticeln(dryRun+"sync", name)
-			sio.Println(res.Details)
+		var components []string
+		for component := range waitErrors {
+			components = append(components, component)
+		}
+		sort.Strings(components)
+		for _, component := range components {
+			if err := stall(component, waitErrors[component].Error()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// apply objects one component level at a time, such that components that others depend on are applied, and
+	// are ready when waiting, before their dependents
+	deps := objsort.ComponentDependencies(objects, config.App().ComponentDependencies())
+	waves := componentWaves(objects, objsort.ComponentLevels(deps))
+	var changed []model.K8sLocalObject
+	for i, wave := range waves {
+		stallDependents(wave, deps, stalled)
+		changed, err = syncObjects(wave)
+		if err != nil {
+			return syncFailed(err)
+		}
+		if i < len(waves)-1 && config.wait && !opts.DryRun && len(changed) > 0 {
+			if err := waitAndStall(changed); err != nil {
+				return nil, err
+			}
+			changed = nil
 		}
 	}
 
+	// wait for created and updated objects to be healthy
+	if config.wait && !opts.DryRun && len(changed) > 0 {
+		if err := waitAndStall(changed); err != nil {
+			return nil, err
+		}
+	}
+
+	groups.flush(sio.Output)
+
 	// process deletions
-	deletions, err := lister.results()
+	deletions, err = listDeletions()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for _, ob := range deletions {
+		groups.add(client.DisplayName(ob), ob)
+	}
+	if !gco.override {
+		deletions, err = removeProtected(client, config.App(), deletions, true, &stats)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if !opts.DryRun && len(deletions) > 0 {
 		msg := fmt.Sprintf("will delete %d object(s))", len(deletions))
 		if err := config.Confirm(msg); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	// delete objects of components of the environment first, followed by the objects of each removed component
 	deletions = objsort.SortMeta(deletions, config.SortConfig(client.IsNamespaced))
-	for i := len(deletions) - 1; i >= 0; i-- {
-		ob := deletions[i]
-		name := client.DisplayName(ob)
-		res, err := client.Delete(ob, opts.DryRun)
-		if err != nil {
-			return err
+	var regular []model.K8sQbecMeta
+	byComponent := map[string][]model.K8sQbecMeta{}
+	for _, ob := range deletions {
+		if removedComponents[ob.Component()] {
+			byComponent[ob.Component()] = append(byComponent[ob.Component()], ob)
+			continue
+		}
+		regular = append(regular, ob)
+	}
+	var tombs *tombstones
+	if !opts.DryRun {
+		tombs = newTombstones(config, env, "apply", config.stamp)
+		defer tombs.record(client)
+	}
+	var rows []tableRow
+	deleteObjects := func(list []model.K8sQbecMeta, change string) error {
+		for i := len(list) - 1; i >= 0; i-- {
+			ob := list[i]
+			name := client.DisplayName(ob)
+			cc, err := clients.get(ob.Component())
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			res, err := cc.Delete(ob, remote.DeleteOptions{DryRun: opts.DryRun, Cascade: config.cascade})
+			if err != nil {
+				return err
+			}
+			if res.Type == remote.SyncDeleted {
+				tombs.add(ob)
+			}
+			groups.took(name, time.Since(start))
+			stats.update(name, res)
+			if gco.format == "table" {
+				rows = append(rows, objectRow(ob, change))
+				continue
+			}
+			groups.print(groups.add(name, ob), func(w io.Writer) {
+				sio.Fnoticeln(w, dryRun+"delete", name)
+				fmt.Fprintln(w, res.Details)
+			})
+		}
+		return nil
+	}
+	if err := deleteObjects(regular, "delete"); err != nil {
+		return nil, err
+	}
+	for _, r := range removed {
+		list := byComponent[r.name]
+		if len(list) == 0 {
+			continue
+		}
+		if gco.format != "table" {
+			sio.Noticef("%sdelete objects of component %s (%s)\n", dryRun, r.name, r.status())
+		}
+		if err := deleteObjects(list, changeComponentRemoved); err != nil {
+			return nil, err
+		}
+	}
+	groups.flush(sio.Output)
+	stats.RemovedComponents = removedStatus(removed)
+	if gco.format == "table" {
+		if err := writeTable(config.Stdout(), gcColumns, rows, terminalWidth()); err != nil {
+			return nil, err
 		}
-		stats.update(name, res)
-		sio.Noticeln(dryRun+"delete", name)
-		sio.Println(res.Details)
 	}
 
-	printStats(config.Stdout(), &stats)
+	stats.Stalled = stalled
 	if opts.DryRun {
 		sio.Noticeln("** dry-run mode, nothing was actually changed **")
 	}
+	if len(missing) > 0 {
+		return &stats, fmt.Errorf("%d object(s) do not exist and were not created: %s", len(missing), strings.Join(missing, ", "))
+	}
+	if len(stalled) > 0 {
+		var components []string
+		for component := range stalled {
+			components = append(components, component)
+		}
+		sort.Strings(components)
+		return &stats, fmt.Errorf("%d component(s) stalled: %s", len(components), strings.Join(components, ", "))
+	}
+	if !opts.DryRun {
+		// objects of removed components were all deleted when nothing limited garbage collection
+		collected := config.gc && len(fp.includes) == 0 && len(fp.excludes) == 0 && fp.selector == nil &&
+			(fp.kindFilter == nil || !fp.kindFilter.HasFilters()) && !gcKindFilter.HasFilters() && len(gco.namespaces) == 0
+		recordInventory(client, config, env, collected)
+	}
+	return &stats, nil
+}
+
+// inNamespaces returns the subset of the supplied objects that belong to one of the supplied namespaces.
+func inNamespaces(objects []model.K8sQbecMeta, namespaces []string) []model.K8sQbecMeta {
+	nsMap := map[string]bool{}
+	for _, ns := range namespaces {
+		nsMap[ns] = true
+	}
+	var ret []model.K8sQbecMeta
+	for _, ob := range objects {
+		if nsMap[ob.GetNamespace()] {
+			ret = append(ret, ob)
+		}
+	}
+	return ret
+}
+
+// componentWaves splits the supplied objects, sorted by component level, into consecutive lists of objects whose
+// components are at the same level.
+func componentWaves(objects []model.K8sLocalObject, levels map[string]int) [][]model.K8sLocalObject {
+	var ret [][]model.K8sLocalObject
+	for i, ob := range objects {
+		if i == 0 || levels[ob.Component()] != levels[objects[i-1].Component()] {
+			ret = append(ret, nil)
+		}
+		ret[len(ret)-1] = append(ret[len(ret)-1], ob)
+	}
+	return ret
+}
+
+// stallDependents marks the components of the supplied objects as stalled when a component that they depend on has
+// stalled, such that they are not applied before their dependencies are ready.
+func stallDependents(objects []model.K8sLocalObject, deps map[string][]string, stalled map[string]string) {
+	for _, ob := range objects {
+		component := ob.Component()
+		if _, ok := stalled[component]; ok {
+			continue
+		}
+		for _, d := range deps[component] {
+			if _, ok := stalled[d]; ok {
+				sio.Warnf("component %s: dependency %s stalled, skipping its objects\n", component, d)
+				stalled[component] = "dependency " + d + " stalled"
+				break
+			}
+		}
+	}
+}
+
+// showServerDryRunDiff writes the diff between the live object and the object returned by a server-side dry-run
+// to standard output in a single write.
+func showServerDryRunDiff(config applyCommandConfig, name string, res *remote.SyncResult) error {
+	var left interface{}
+	if res.Live != nil {
+		left = res.Live
+	}
+	b, err := diff.Objects(left, res.DryRunResult, diff.Options{
+		LeftName:  "live " + name,
+		RightName: "server dry-run " + name,
+		Colorize:  config.Colorize(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "diff %s", name)
+	}
+	if len(b) > 0 {
+		fmt.Fprintln(config.Stdout(), string(b))
+	}
 	return nil
+}
 
+// syncWithTimeout syncs the supplied object returning remote.ErrSyncTimeout if the sync does not complete before
+// the remaining time for the supplied limit is used up. A zero limit implies no timeout. Requests of a sync that
+// times out are canceled, but a change that the server received before the timeout may still be applied.
+func syncWithTimeout(client applyClient, ob model.K8sLocalObject, opts remote.SyncOptions, limit, used time.Duration) (*remote.SyncResult, error) {
+	if limit == 0 {
+		return client.Sync(ob, opts)
+	}
+	remaining := limit - used
+	if remaining <= 0 {
+		return nil, remote.ErrSyncTimeout
+	}
+	opts.Deadline = time.Now().Add(remaining)
+	res, err := client.Sync(ob, opts)
+	if errors.Cause(err) == remote.ErrSyncTimeout {
+		return nil, remote.ErrSyncTimeout
+	}
+	return res, err
 }
 
 func newApplyCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "apply [-n] <environment>",
+		Use:     "apply [-n] <environment>[,<environment>...]",
 		Short:   "apply one or more components to a Kubernetes cluster",
 		Example: applyExamples(),
 	}
@@ -188,13 +1179,41 @@ func newApplyCommand(op OptionsProvider) *cobra.Command {
 		clientProvider: func(env string) (applyClient, error) {
 			return op().Client(env)
 		},
-		filterFunc: addFilterParams(cmd, true),
+		filterFunc: addFilterParams(cmd, op, true),
 	}
 
 	cmd.Flags().BoolVar(&config.syncOptions.DisableCreate, "skip-create", false, "set to true to only update existing resources but not create new ones")
-	cmd.Flags().BoolVarP(&config.syncOptions.DryRun, "dry-run", "n", false, "dry-run, do not create/ update resources but show what would happen")
+	cmd.Flags().StringVar(&config.updateOnly, "update-only", "", "only update existing resources, set to error to fail the apply for resources that do not exist instead of skipping them")
+	cmd.Flags().Lookup("update-only").NoOptDefVal = updateOnlySkip
+	cmd.Flags().StringVarP(&config.dryRunMode, "dry-run", "n", "", "dry-run, do not create/ update resources but show what would happen, set to server to have the server process changes without persisting them")
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = dryRunClient
+	cmd.Flags().BoolVar(&config.showDiff, "show-diff", false, "with --dry-run=server, show diffs between live objects and the ones returned by the server")
 	cmd.Flags().BoolVarP(&config.syncOptions.ShowSecrets, "show-secrets", "S", false, "do not obfuscate secret values in the output")
 	cmd.Flags().BoolVar(&config.gc, "gc", true, "garbage collect extra objects on the server")
+	cmd.Flags().StringArrayVar(&config.gcOptions.kindIncludes, "gc-include-kind", nil, "only garbage collect objects with this kind")
+	cmd.Flags().StringArrayVar(&config.gcOptions.kindExcludes, "gc-exclude-kind", nil, "do not garbage collect objects with this kind")
+	cmd.Flags().StringArrayVar(&config.gcOptions.namespaces, "gc-namespaces", nil, "only garbage collect objects in this namespace, cluster-scoped objects are not collected")
+	cmd.Flags().BoolVar(&config.gcOptions.override, "override-protection", false, "garbage collect objects even if they are protected from deletion")
+	cmd.Flags().BoolVar(&config.gcOptions.dryRun, "gc-dry-run", false, "list objects that would be garbage collected without making any changes")
+	cmd.Flags().StringVarP(&config.gcOptions.format, "format", "o", "", "with --gc-dry-run, set to table to list the objects that would be garbage collected as a table")
+	addColumnsFlag(cmd, &config.gcOptions.columns, changeColumns)
+	cmd.Flags().BoolVar(&config.wait, "wait", false, "wait for created and updated objects to be ready before garbage collection")
+	cmd.Flags().DurationVar(&config.waitTimeout, "wait-timeout", 5*time.Minute, "max time to wait for objects to be ready")
+	cmd.Flags().StringVar(&config.timeoutPolicy, "timeout-policy", "", "what to do when a component exceeds its timeouts, one of fail or continue, overrides the policy in qbec.yaml")
+	cmd.Flags().StringVar(&config.envGroup, "env-group", "", "apply to all environments in this group instead of the environments in the argument")
+	cmd.Flags().IntVar(&config.parallelEnvs, "parallel-envs", 1, "number of environments to apply to in parallel when multiple environments are specified")
+	cmd.Flags().BoolVar(&config.continueOnError, "continue-on-error", false, "continue applying to other environments when one fails")
+	cmd.Flags().StringVar(&config.canaryEnv, "canary-env", "", "when applying to multiple environments, apply to this environment first and wait for its objects to be ready before the others")
+	cmd.Flags().StringVar(&config.canarySelector, "canary-selector", "", "label selector for canary objects that are applied first and must be ready before other objects are applied")
+	cmd.Flags().BoolVar(&config.changedOnly, "changed-only", false, "skip objects whose render hash matches the one stored on the server")
+	cmd.Flags().BoolVar(&config.checkQuotas, "check-quotas", false, "check that objects fit in the resource quotas and limit ranges of their namespaces before applying anything")
+	cmd.Flags().DurationVar(&config.spread, "spread", 0, "spread creates and updates of objects evenly over this duration, reporting progress, to avoid overloading the API server")
+	cmd.Flags().BoolVar(&config.confirmRemoval, "confirm-component-removal", false, "allow garbage collection of objects of components that were deleted, renamed or excluded from the environment")
+	addCascadeFlag(cmd, &config.cascade, "cascade policy for dependents of objects deleted by garbage collection")
+	cmd.Flags().BoolVar(&config.allowLarge, "allow-large-changes", false, "allow applies that exceed the change limits of the app")
+	cmd.Flags().StringVar(&config.resume, "resume", "", "resume a failed apply from the supplied checkpoint file, skipping objects applied before it was written")
+	addApplyStampFlags(cmd, &config.stamp)
+	addGroupByFlag(cmd, &config.groupBy)
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
@@ -17,13 +17,21 @@
 package commands
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestApplyBasic(t *testing.T) {
@@ -57,6 +65,108 @@ func TestApplyBasic(t *testing.T) {
 	s.assertErrorLineMatch(regexp.MustCompile(`sync ConfigMap:bar-system:svc2-cm`))
 }
 
+func TestApplyReplaceKinds(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.ReplaceKinds = []string{"secrets"}
+	replaced := map[string]bool{}
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		replaced[obj.GetName()] = opts.Replace
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "-c", "service2")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]bool{"svc2-cm": false, "svc2-secret": true}, replaced)
+}
+
+func TestApplyStamp(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	stamped := map[string]map[string]string{}
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		stamped[obj.GetName()] = opts.Annotations
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+	}
+	s.opts.client.metadataFunc = func(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error) {
+		return nil, fmt.Errorf("unexpected metadata update for %s", obj.GetName())
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "-c", "service2", "--run-url", "https://ci/run/42", "--pipeline-id", "p-7")
+	require.Nil(t, err)
+	expected := map[string]string{
+		model.QbecNames.RunURLAnnotation:     "https://ci/run/42",
+		model.QbecNames.PipelineIDAnnotation: "p-7",
+	}
+	assert.Equal(t, map[string]map[string]string{"svc2-cm": expected, "svc2-secret": expected}, stamped)
+}
+
+func TestApplyStampDryRun(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	var stamped []map[string]string
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		require.True(t, opts.DryRun)
+		stamped = append(stamped, opts.Annotations)
+		return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+	}
+	err := s.executeCommand("apply", "dev", "-n", "--gc=false", "--plan-hash", "abc123")
+	require.Nil(t, err)
+	require.NotEmpty(t, stamped)
+	for _, anns := range stamped {
+		assert.Equal(t, map[string]string{model.QbecNames.PlanHashAnnotation: "abc123"}, anns)
+	}
+}
+
+func TestApplyGroupBy(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		switch {
+		case obj.GetName() == "svc2-cm":
+			return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+		case obj.GetName() == "svc2-secret":
+			return &remote.SyncResult{Type: remote.SyncCreated, Details: "some yaml"}, nil
+		default:
+			return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+		}
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "--group-by", "component")
+	require.Nil(t, err)
+	stats := s.outputStats()
+	a := assert.New(t)
+	groups, ok := stats["groups"].(map[string]interface{})
+	require.True(t, ok)
+	a.Equal(2, len(groups))
+	svc2 := groups["service2"].(map[string]interface{})
+	a.EqualValues(1, svc2["created"])
+	a.EqualValues(1, svc2["updated"])
+	a.Contains(svc2, "duration")
+	cluster := groups["cluster-objects"].(map[string]interface{})
+	a.EqualValues(7, cluster["same"])
+	s.assertErrorLineMatch(regexp.MustCompile(`^component service2$`))
+	s.assertErrorLineNoMatch(regexp.MustCompile(`^component cluster-objects$`))
+}
+
+func TestApplyGroupByOrder(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncUpdated, Details: "updated"}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "--group-by", "component")
+	require.Nil(t, err)
+	a := assert.New(t)
+	out := s.stderr()
+	var positions []int
+	for _, c := range []string{"cluster-objects", "service2"} {
+		header := "component " + c + "\n"
+		a.Equal(1, strings.Count(out, header), c)
+		positions = append(positions, strings.Index(out, header))
+	}
+	a.True(positions[0] < positions[1])
+	a.True(strings.Index(out, "svc2-cm") > positions[1])
+	a.True(strings.Index(out, "svc2-secret") > positions[1])
+}
+
 func TestApplyFlags(t *testing.T) {
 	s := newScaffold(t)
 	defer s.reset()
@@ -88,12 +198,892 @@ func TestApplyFlags(t *testing.T) {
 	s.assertErrorLineMatch(regexp.MustCompile(`\*\* dry-run mode, nothing was actually changed \*\*`))
 }
 
+func TestApplyUpdateOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		err  string
+	}{
+		{name: "skip", mode: "--update-only"},
+		{name: "error", mode: "--update-only=error", err: "1 object(s) do not exist and were not created: Secret:bar-system:svc2-secret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			var captured remote.SyncOptions
+			s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+				captured = opts
+				switch {
+				case obj.GetName() == "svc2-cm":
+					return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+				case obj.GetName() == "svc2-secret":
+					return &remote.SyncResult{Type: remote.SyncSkip, Details: remote.CreateDisabled}, nil
+				default:
+					return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+				}
+			}
+			err := s.executeCommand("apply", "dev", test.mode, "--gc=false")
+			a := assert.New(t)
+			if test.err == "" {
+				require.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+				a.False(isUsageError(err))
+				a.Equal(test.err, err.Error())
+			}
+			stats := s.outputStats()
+			a.True(captured.DisableCreate)
+			a.EqualValues([]interface{}{"Secret:bar-system:svc2-secret"}, stats["skipped"])
+			a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-cm"}, stats["updated"])
+		})
+	}
+}
+
+func TestApplyConflicts(t *testing.T) {
+	conflict := remote.FieldConflict{Path: "data.foo", Manager: "kubectl-edit", Local: "bar", Live: "baz"}
+	t.Run("changed", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			if obj.GetName() == "svc2-cm" {
+				return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated", Conflicts: []remote.FieldConflict{conflict}}, nil
+			}
+			return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+		}
+		err := s.executeCommand("apply", "dev", "--gc=false")
+		require.Nil(t, err)
+		stats := s.outputStats()
+		a := assert.New(t)
+		a.EqualValues(map[string]interface{}{
+			"ConfigMap:bar-system:svc2-cm": []interface{}{
+				map[string]interface{}{"path": "data.foo", "manager": "kubectl-edit", "local": "bar", "live": "baz"},
+			},
+		}, stats["conflicts"])
+		s.assertErrorLineMatch(regexp.MustCompile(`ConfigMap:bar-system:svc2-cm: 1 field\(s\) managed by others changed`))
+	})
+	t.Run("failed", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			if obj.GetName() == "svc2-cm" {
+				return nil, errors.Wrap(&remote.ConflictError{Err: errors.New("rejected"), Conflicts: []remote.FieldConflict{conflict}}, "sync svc2-cm")
+			}
+			return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+		}
+		err := s.executeCommand("apply", "dev", "--gc=false")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Contains(err.Error(), `data.foo (managed by kubectl-edit): local "bar", live "baz"`)
+		stats := s.outputStats()
+		a.Contains(stats, "conflicts")
+	})
+}
+
+type testHashes struct {
+	changed map[string]bool
+	noHash  bool // objects exist without a render hash
+}
+
+func (h *testHashes) Hash(obj model.K8sMeta) string {
+	switch {
+	case h.noHash:
+		return ""
+	case h.changed[obj.GetName()]:
+		return "changed"
+	}
+	hash, _ := remote.RenderHash(obj.(model.K8sLocalObject))
+	return hash
+}
+
+func (h *testHashes) Exists(obj model.K8sMeta) bool {
+	return true
+}
+
+func TestApplyChangedOnly(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	var captured remote.ListQueryConfig
+	s.opts.client.hashesFunc = func(scope remote.ListQueryConfig) (remote.ObjectHashes, error) {
+		captured = scope
+		return &testHashes{changed: map[string]bool{"svc2-cm": true}}, nil
+	}
+	var synced []string
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		synced = append(synced, obj.GetName())
+		return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "--changed-only")
+	require.Nil(t, err)
+	stats := s.outputStats()
+	a := assert.New(t)
+	a.Equal("example1", captured.Application)
+	a.Equal("dev", captured.Environment)
+	a.EqualValues([]string{"svc2-cm"}, synced)
+	a.EqualValues(8, stats["same"])
+	a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-cm"}, stats["updated"])
+}
+
+func TestApplyChangeLimits(t *testing.T) {
+	extra := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"namespace": "bar-system", "name": "extra"},
+	}, "example1", "service2", "dev")
+	tests := []struct {
+		name    string
+		limits  model.ChangeLimits
+		changed map[string]bool
+		noHash  bool
+		args    []string
+		err     string
+		warning string
+		confirm string
+	}{
+		{
+			name:   "deletions",
+			limits: model.ChangeLimits{MaxDeletions: 1},
+			err:    "apply would delete 2 object(s), more than the limit of 1 in qbec.yaml, use --allow-large-changes if this is intended",
+		},
+		{
+			name:   "deletions allowed",
+			limits: model.ChangeLimits{MaxDeletions: 1},
+			args:   []string{"--allow-large-changes"},
+		},
+		{
+			name:    "changes",
+			limits:  model.ChangeLimits{MaxChangePercent: 20},
+			changed: map[string]bool{"svc2-cm": true},
+			err:     "apply would change 3 of 11 object(s) (27%), more than the limit of 20% in qbec.yaml, use --allow-large-changes if this is intended",
+		},
+		{
+			name:    "changes within limits",
+			limits:  model.ChangeLimits{MaxChangePercent: 30},
+			changed: map[string]bool{"svc2-cm": true},
+		},
+		{
+			name:    "no render hashes",
+			limits:  model.ChangeLimits{MaxChangePercent: 30},
+			noHash:  true,
+			warning: "9 object(s) have no render hash and are not counted against the change limits",
+		},
+		{
+			name:    "confirm",
+			limits:  model.ChangeLimits{MaxDeletions: 1, Confirm: true},
+			confirm: "apply would delete 2 object(s), more than the limit of 1 in qbec.yaml",
+		},
+		{
+			name:    "dry-run",
+			limits:  model.ChangeLimits{MaxDeletions: 1},
+			args:    []string{"--dry-run"},
+			warning: "apply would delete 2 object(s), more than the limit of 1 in qbec.yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			limits := test.limits
+			s.opts.app.Spec.ChangeLimits = &limits
+			s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+				return []model.K8sQbecMeta{extra, extra}, nil
+			}
+			s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+				return obj.(model.K8sLocalObject).ToUnstructured(), nil
+			}
+			s.opts.client.hashesFunc = func(scope remote.ListQueryConfig) (remote.ObjectHashes, error) {
+				return &testHashes{changed: test.changed, noHash: test.noHash}, nil
+			}
+			synced := 0
+			s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+				synced++
+				return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+			}
+			s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+				return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+			}
+			err := s.executeCommand(append([]string{"apply", "dev"}, test.args...)...)
+			if test.err != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, test.err, err.Error())
+				assert.Equal(t, 0, synced)
+				return
+			}
+			require.Nil(t, err)
+			if test.warning != "" {
+				s.assertErrorLineMatch(regexp.MustCompile(regexp.QuoteMeta(test.warning)))
+			}
+			if test.confirm != "" {
+				require.True(t, len(s.opts.confirms) > 0)
+				assert.Contains(t, s.opts.confirms[0], test.confirm)
+			}
+		})
+	}
+}
+
+func TestApplyWait(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		if obj.GetName() == "svc2-cm" {
+			return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+		}
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+	}
+	var waited []string
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		waited = append(waited, obj.GetName())
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "--wait")
+	require.Nil(t, err)
+	assert.EqualValues(t, []string{"svc2-cm"}, waited)
+	s.assertErrorLineMatch(regexp.MustCompile(`ready ConfigMap:bar-system:svc2-cm`))
+}
+
+func TestApplyComponentTimeouts(t *testing.T) {
+	slowSync := func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		if obj.Component() == "service2" {
+			time.Sleep(50 * time.Millisecond)
+			if !opts.Deadline.IsZero() && time.Now().After(opts.Deadline) {
+				return nil, remote.ErrSyncTimeout
+			}
+		}
+		return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+	}
+	t.Run("apply-continue", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.app.Spec.Components = map[string]model.ComponentSpec{"service2": {ApplyTimeout: "10ms"}}
+		s.opts.client.syncFunc = slowSync
+		err := s.executeCommand("apply", "dev", "--gc=false", "--timeout-policy", "continue")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Equal("1 component(s) stalled: service2", err.Error())
+		stats := s.outputStats()
+		a.EqualValues(map[string]interface{}{"service2": "apply timed out after 10ms"}, stats["stalled"])
+		a.Contains(stats["updated"], "Namespace::bar-system")
+		a.NotContains(stats["updated"], "ConfigMap:bar-system:svc2-cm")
+	})
+	t.Run("apply-fail", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.app.Spec.Components = map[string]model.ComponentSpec{"service2": {ApplyTimeout: "10ms"}}
+		s.opts.client.syncFunc = slowSync
+		err := s.executeCommand("apply", "dev", "--gc=false")
+		require.NotNil(t, err)
+		assert.Equal(t, "component service2: apply timed out after 10ms", err.Error())
+	})
+	t.Run("wait-continue", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.app.Spec.Components = map[string]model.ComponentSpec{"service2": {WaitTimeout: "10ms"}}
+		s.opts.app.Spec.TimeoutPolicy = model.TimeoutPolicyContinue
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+		}
+		s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+			u := obj.(model.K8sLocalObject).ToUnstructured()
+			if obj.(model.K8sLocalObject).Component() == "service2" {
+				u.Object["status"] = map[string]interface{}{
+					"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False"}},
+				}
+			}
+			return u, nil
+		}
+		err := s.executeCommand("apply", "dev", "--gc=false", "--wait")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Equal("1 component(s) stalled: service2", err.Error())
+		stats := s.outputStats()
+		a.Contains(stats["stalled"].(map[string]interface{})["service2"], "timed out waiting for")
+	})
+	t.Run("bad-policy", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		err := s.executeCommand("apply", "dev", "--timeout-policy", "ignore")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.True(isUsageError(err))
+		a.Equal(`invalid timeout policy "ignore", must be one of fail or continue`, err.Error())
+	})
+}
+
+func TestApplyComponentDependencies(t *testing.T) {
+	setup := func(t *testing.T, ready func(component string) bool) (*scaffold, *[]string) {
+		s := newScaffold(t)
+		s.opts.app.Spec.Components = map[string]model.ComponentSpec{"cluster-objects": {DependsOn: []string{"service2"}}}
+		var events []string
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			events = append(events, "sync "+obj.Component())
+			return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+		}
+		s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+			component := obj.(model.K8sLocalObject).Component()
+			events = append(events, "wait "+component)
+			u := obj.(model.K8sLocalObject).ToUnstructured()
+			if !ready(component) {
+				u.Object["status"] = map[string]interface{}{
+					"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False"}},
+				}
+			}
+			return u, nil
+		}
+		return s, &events
+	}
+	// compact returns the supplied events without consecutive duplicates
+	compact := func(events []string) []string {
+		var ret []string
+		for i, e := range events {
+			if i == 0 || e != events[i-1] {
+				ret = append(ret, e)
+			}
+		}
+		return ret
+	}
+	t.Run("wait", func(t *testing.T) {
+		s, events := setup(t, func(string) bool { return true })
+		defer s.reset()
+		err := s.executeCommand("apply", "dev", "--gc=false", "--wait")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"sync service2", "wait service2", "sync cluster-objects", "wait cluster-objects"}, compact(*events))
+	})
+	t.Run("no-wait", func(t *testing.T) {
+		s, events := setup(t, func(string) bool { return true })
+		defer s.reset()
+		err := s.executeCommand("apply", "dev", "--gc=false")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"sync service2", "sync cluster-objects"}, compact(*events))
+	})
+	t.Run("stalled-dependency", func(t *testing.T) {
+		s, events := setup(t, func(component string) bool { return component != "service2" })
+		defer s.reset()
+		s.opts.app.Spec.Components["service2"] = model.ComponentSpec{WaitTimeout: "10ms"}
+		err := s.executeCommand("apply", "dev", "--gc=false", "--wait", "--timeout-policy", "continue")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Equal("2 component(s) stalled: cluster-objects, service2", err.Error())
+		a.NotContains(*events, "sync cluster-objects")
+		stats := s.outputStats()
+		a.EqualValues("dependency service2 stalled", stats["stalled"].(map[string]interface{})["cluster-objects"])
+		s.assertErrorLineMatch(regexp.MustCompile(`component cluster-objects: dependency service2 stalled, skipping its objects`))
+	})
+	t.Run("annotations", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.app.Spec.Components = map[string]model.ComponentSpec{"cluster-objects": {DependsOn: []string{"service2"}}}
+		annotated := func(component, deps string) model.K8sLocalObject {
+			return model.NewK8sLocalObject(map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":        "cm",
+					"annotations": map[string]interface{}{model.QbecNames.ComponentDependsOnAnnotation: deps},
+				},
+			}, "example1", component, "dev")
+		}
+		a := assert.New(t)
+		a.Nil(checkAnnotatedDependencies(s.opts.app, []model.K8sLocalObject{annotated("service2", "service1")}))
+		err := checkAnnotatedDependencies(s.opts.app, []model.K8sLocalObject{annotated("service2", "service1, foo")})
+		require.NotNil(t, err)
+		a.Equal("component service2: qbec.io/component-depends-on annotation of ConfigMap cm refers to unknown component foo", err.Error())
+		err = checkAnnotatedDependencies(s.opts.app, []model.K8sLocalObject{annotated("service2", "service2")})
+		require.NotNil(t, err)
+		a.Equal("component service2: cannot depend on itself", err.Error())
+		err = checkAnnotatedDependencies(s.opts.app, []model.K8sLocalObject{annotated("service2", "cluster-objects")})
+		require.NotNil(t, err)
+		a.Equal("component dependency cycle: cluster-objects -> service2 -> cluster-objects", err.Error())
+	})
+}
+
+func TestApplyImpersonation(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Components = map[string]model.ComponentSpec{
+		"service2": {Impersonate: &model.Impersonation{User: "system:serviceaccount:bar-system:deployer", Groups: []string{"tenants"}}},
+	}
+	extra := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"namespace": "bar-system", "name": "old-cm"},
+	}, "example1", "service2", "dev")
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		return []model.K8sQbecMeta{extra}, nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, remote.ErrNotFound
+	}
+	var l sync.Mutex
+	identities := map[string]string{}
+	newClient := func(user string) *client {
+		return &client{
+			syncFunc: func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+				l.Lock()
+				defer l.Unlock()
+				identities["sync "+obj.GetName()] = user
+				return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+			},
+			deleteFunc: func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+				l.Lock()
+				defer l.Unlock()
+				identities["delete "+obj.GetName()] = user
+				return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+			},
+		}
+	}
+	base := newClient("")
+	s.opts.client.syncFunc = base.syncFunc
+	s.opts.client.deleteFunc = base.deleteFunc
+	var impersonations []string
+	s.opts.client.impersonateFunc = func(user string, groups []string) (Client, error) {
+		impersonations = append(impersonations, fmt.Sprintf("%s:%s", user, strings.Join(groups, ",")))
+		return newClient(user), nil
+	}
+	err := s.executeCommand("apply", "dev")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues([]string{"system:serviceaccount:bar-system:deployer:tenants"}, impersonations)
+	a.Equal("system:serviceaccount:bar-system:deployer", identities["sync svc2-cm"])
+	a.Equal("system:serviceaccount:bar-system:deployer", identities["delete old-cm"])
+	user, ok := identities["sync bar-system"]
+	a.True(ok)
+	a.Equal("", user)
+	s.assertErrorLineMatch(regexp.MustCompile(`component service2: impersonating system:serviceaccount:bar-system:deployer`))
+}
+
+func TestApplyServerDryRun(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	var captured remote.SyncOptions
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		captured = opts
+		if obj.GetName() != "svc2-cm" {
+			return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+		}
+		live := obj.ToUnstructured()
+		out := live.DeepCopy()
+		out.Object["data"] = map[string]interface{}{"foo": "baz"}
+		return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated", Live: live, DryRunResult: out}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--dry-run=server", "--show-diff", "--gc=false")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.True(captured.DryRun)
+	a.True(captured.ServerDryRun)
+	s.assertOutputLineMatch(regexp.MustCompile(`--- live ConfigMap:bar-system:svc2-cm`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\+\+\+ server dry-run ConfigMap:bar-system:svc2-cm`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^\+\s+foo: baz`))
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-cm"}, stats["updated"])
+}
+
+func TestApplyGCOptions(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	newObj := func(kind, ns, name string) model.K8sQbecMeta {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"namespace": ns, "name": name},
+		}, "example1", "service2", "dev")
+	}
+	extras := []model.K8sQbecMeta{
+		newObj("ConfigMap", "bar-system", "cm1"),
+		newObj("Secret", "other", "s1"),
+		newObj("ConfigMap", "other", "cm2"),
+	}
+	var captured remote.ListQueryConfig
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		captured = scope
+		var ret []model.K8sQbecMeta
+		for _, o := range extras {
+			if scope.KindFilter.ShouldInclude(o.GetKind()) {
+				ret = append(ret, o)
+			}
+		}
+		return ret, nil
+	}
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		return nil, fmt.Errorf("unexpected sync for %s", obj.GetName())
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, remote.ErrNotFound
+	}
+	var dryRuns []bool
+	var cascades []string
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		dryRuns = append(dryRuns, opts.DryRun)
+		cascades = append(cascades, opts.Cascade)
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc-dry-run", "--gc-include-kind", "configmap", "--gc-namespaces", "other", "--cascade", "orphan")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues(remote.ListQueryScope{Namespaces: []string{"other"}}, captured.ListQueryScope)
+	a.EqualValues([]bool{true}, dryRuns)
+	a.EqualValues([]string{remote.CascadeOrphan}, cascades)
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:other:cm2"}, stats["deleted"])
+	a.Nil(stats["same"])
+	s.assertErrorLineMatch(regexp.MustCompile(`\[dry-run\] delete ConfigMap:other:cm2`))
+}
+
+func TestApplyGCProtection(t *testing.T) {
+	newObj := func(kind, name string, annotations map[string]interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"namespace": "bar-system", "name": name, "annotations": annotations},
+		}, "example1", "service2", "dev")
+	}
+	extras := []model.K8sLocalObject{
+		newObj("PersistentVolumeClaim", "pvc1", nil),
+		newObj("ConfigMap", "cm1", map[string]interface{}{"qbec.io/protected": "true"}),
+		newObj("ConfigMap", "cm2", nil),
+	}
+	run := func(t *testing.T, args ...string) *scaffold {
+		s := newScaffold(t)
+		s.opts.app.Spec.ProtectedKinds = []string{"persistentvolumeclaims"}
+		s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+			var ret []model.K8sQbecMeta
+			for _, o := range extras {
+				ret = append(ret, o)
+			}
+			return ret, nil
+		}
+		s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+			return obj.(model.K8sLocalObject).ToUnstructured(), nil
+		}
+		s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+			return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+		}
+		err := s.executeCommand(append([]string{"apply", "dev", "--gc-dry-run"}, args...)...)
+		require.Nil(t, err)
+		return s
+	}
+	t.Run("protected", func(t *testing.T) {
+		s := run(t)
+		defer s.reset()
+		stats := s.outputStats()
+		a := assert.New(t)
+		a.EqualValues([]interface{}{"ConfigMap:bar-system:cm2"}, stats["deleted"])
+		a.EqualValues([]interface{}{"PersistentVolumeClaim:bar-system:pvc1", "ConfigMap:bar-system:cm1"}, stats["skipped"])
+		s.assertErrorLineMatch(regexp.MustCompile(`not deleting ConfigMap:bar-system:cm1, object has the qbec.io/protected annotation`))
+		s.assertErrorLineMatch(regexp.MustCompile(`not deleting PersistentVolumeClaim:bar-system:pvc1, kind PersistentVolumeClaim is protected`))
+	})
+	t.Run("override", func(t *testing.T) {
+		s := run(t, "--override-protection")
+		defer s.reset()
+		stats := s.outputStats()
+		assert.Equal(t, 3, len(stats["deleted"].([]interface{})))
+		assert.Nil(t, stats["skipped"])
+	})
+	t.Run("table", func(t *testing.T) {
+		s := run(t, "--override-protection", "-o", "table", "--columns", "kind,name,change")
+		defer s.reset()
+		s.assertOutputLineMatch(regexp.MustCompile(`^KIND\s+NAME\s+CHANGE$`))
+		s.assertOutputLineMatch(regexp.MustCompile(`^ConfigMap\s+cm2\s+delete$`))
+		s.assertOutputLineMatch(regexp.MustCompile(`^PersistentVolumeClaim\s+pvc1\s+delete$`))
+		s.assertErrorLineNoMatch(regexp.MustCompile(`delete ConfigMap:bar-system:cm2`))
+	})
+}
+
+func TestApplyMultipleEnvironments(t *testing.T) {
+	syncFunc := func(failEnv string) func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		return func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			if obj.Environment() == failEnv {
+				return nil, fmt.Errorf("sync failed")
+			}
+			return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+		}
+	}
+	t.Run("list", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = syncFunc("")
+		err := s.executeCommand("apply", "dev,prod", "--gc=false", "--parallel-envs", "2")
+		require.Nil(t, err)
+		stats := s.outputStats()
+		a := assert.New(t)
+		envs := stats["environments"].(map[string]interface{})
+		a.EqualValues(9, envs["dev"].(map[string]interface{})["same"])
+		a.Contains(envs, "prod")
+		a.Nil(stats["failed"])
+		s.assertErrorLineMatch(regexp.MustCompile(`applying to environment prod`))
+	})
+	t.Run("group-argument", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = syncFunc("")
+		err := s.executeCommand("apply", "all", "--gc=false")
+		require.Nil(t, err)
+		stats := s.outputStats()
+		a := assert.New(t)
+		a.Contains(stats["environments"], "dev")
+		a.Contains(stats["environments"], "prod")
+	})
+	t.Run("pattern", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = syncFunc("")
+		err := s.executeCommand("apply", "p*", "--gc=false")
+		require.Nil(t, err)
+		stats := s.outputStats()
+		a := assert.New(t)
+		envs := stats["environments"].(map[string]interface{})
+		a.Equal(1, len(envs))
+		a.Contains(envs, "prod")
+	})
+	t.Run("group-fail-fast", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = syncFunc("dev")
+		err := s.executeCommand("apply", "--env-group", "all", "--gc=false")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Equal("apply failed for 1 of 2 environment(s)", err.Error())
+		stats := s.outputStats()
+		a.EqualValues(map[string]interface{}{"dev": "sync failed"}, stats["failed"])
+		a.Nil(stats["environments"])
+	})
+	t.Run("group-continue", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = syncFunc("dev")
+		err := s.executeCommand("apply", "--env-group", "all", "--gc=false", "--continue-on-error")
+		require.NotNil(t, err)
+		stats := s.outputStats()
+		a := assert.New(t)
+		a.Contains(stats["failed"], "dev")
+		a.Contains(stats["environments"], "prod")
+	})
+	t.Run("canary-halt", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		s.opts.client.syncFunc = syncFunc("prod")
+		err := s.executeCommand("apply", "--env-group", "all", "--gc=false", "--canary-env", "prod", "--parallel-envs", "2")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Equal("canary environment prod failed, halting rollout: sync failed", err.Error())
+		stats := s.outputStats()
+		a.EqualValues(map[string]interface{}{"prod": "sync failed"}, stats["failed"])
+		a.Nil(stats["environments"])
+	})
+	t.Run("canary", func(t *testing.T) {
+		s := newScaffold(t)
+		defer s.reset()
+		var l sync.Mutex
+		var order []string
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			l.Lock()
+			defer l.Unlock()
+			if len(order) == 0 || order[len(order)-1] != obj.Environment() {
+				order = append(order, obj.Environment())
+			}
+			return &remote.SyncResult{Type: remote.SyncObjectsIdentical, Details: "sync skipped"}, nil
+		}
+		err := s.executeCommand("apply", "dev,prod", "--gc=false", "--canary-env", "prod")
+		require.Nil(t, err)
+		a := assert.New(t)
+		a.EqualValues([]string{"prod", "dev"}, order)
+		stats := s.outputStats()
+		a.Contains(stats["environments"], "dev")
+		a.Contains(stats["environments"], "prod")
+		s.assertErrorLineMatch(regexp.MustCompile(`applying to canary environment prod`))
+	})
+}
+
+func TestApplyCanaryObjects(t *testing.T) {
+	notReady := map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False", "message": "not ready"}},
+	}
+	newScaffoldWithStatus := func(t *testing.T, status map[string]interface{}) (*scaffold, *[]string) {
+		s := newScaffold(t)
+		var synced []string
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			synced = append(synced, obj.GetName())
+			return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+		}
+		s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+			u := obj.(model.K8sLocalObject).ToUnstructured()
+			if status != nil {
+				u.Object["status"] = status
+			}
+			return u, nil
+		}
+		return s, &synced
+	}
+	t.Run("healthy", func(t *testing.T) {
+		s, synced := newScaffoldWithStatus(t, nil)
+		defer s.reset()
+		err := s.executeCommand("apply", "dev", "--gc=false", "--canary-selector", "name=bar-system")
+		require.Nil(t, err)
+		a := assert.New(t)
+		require.True(t, len(*synced) > 1)
+		a.Equal("bar-system", (*synced)[0])
+		a.Contains(*synced, "svc2-cm")
+		s.assertErrorLineMatch(regexp.MustCompile(`applying 1 canary object\(s\)`))
+	})
+	t.Run("halt", func(t *testing.T) {
+		s, synced := newScaffoldWithStatus(t, notReady)
+		defer s.reset()
+		err := s.executeCommand("apply", "dev", "--gc=false", "--canary-selector", "name=bar-system", "--wait-timeout", "10ms")
+		require.NotNil(t, err)
+		a := assert.New(t)
+		a.Equal("canary objects not healthy, halting rollout\ncomponent cluster-objects: timed out waiting for 1 object(s)\nNamespace::bar-system: not ready", err.Error())
+		a.EqualValues([]string{"bar-system"}, *synced)
+	})
+}
+
+func TestApplyResume(t *testing.T) {
+	var synced []string
+	run := func(t *testing.T, fail bool, args ...string) (*scaffold, error) {
+		s := newScaffold(t)
+		defer s.reset()
+		synced = nil
+		s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+			if fail && obj.GetName() == "svc2-secret" {
+				return nil, errors.New("server unavailable")
+			}
+			synced = append(synced, obj.GetName())
+			return &remote.SyncResult{Type: remote.SyncUpdated}, nil
+		}
+		return s, s.executeCommand(append([]string{"apply", "dev", "--gc=false"}, args...)...)
+	}
+	defer os.RemoveAll(filepath.Join("../../examples/test-app", ".qbec"))
+	a := assert.New(t)
+	file := checkpointFile("dev")
+
+	s, err := run(t, true)
+	require.NotNil(t, err)
+	a.Equal("server unavailable", err.Error())
+	applied := len(synced)
+	s.assertErrorLineMatch(regexp.MustCompile(fmt.Sprintf(`wrote checkpoint for %d applied object\(s\) to %s`, applied, regexp.QuoteMeta(file))))
+	cp, err := loadApplyCheckpoint(filepath.Join("../../examples/test-app", file))
+	require.Nil(t, err)
+	a.Equal("example1", cp.App)
+	a.Equal("dev", cp.Env)
+	a.Equal(applied, len(cp.Completed))
+
+	s, err = run(t, false, "--resume", file)
+	require.Nil(t, err)
+	a.Contains(synced, "svc2-secret")
+	a.Equal(9-applied, len(synced))
+	stats := s.outputStats()
+	a.EqualValues(applied, stats["resumed"])
+	_, err = os.Stat(filepath.Join("../../examples/test-app", file))
+	a.True(os.IsNotExist(err))
+}
+
+func TestApplyResumeMismatch(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	defer os.RemoveAll(".qbec")
+	file := checkpointFile("dev")
+	require.Nil(t, saveApplyCheckpoint(file, newApplyCheckpoint("example1", "dev")))
+	err := s.executeCommand("apply", "prod", "--resume", file)
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.True(isUsageError(err))
+	a.Equal(fmt.Sprintf("checkpoint %s is for environment dev of app example1, not environment prod of app example1", file), err.Error())
+}
+
 func TestApplyNegative(t *testing.T) {
 	tests := []struct {
 		name     string
 		args     []string
 		asserter func(s *scaffold, err error)
 	}{
+		{
+			name: "bad dry-run mode",
+			args: []string{"apply", "dev", "--dry-run=remote"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid dry-run mode "remote", must be one of client or server`, err.Error())
+			},
+		},
+		{
+			name: "show diff without server dry-run",
+			args: []string{"apply", "dev", "-n", "--show-diff"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--show-diff requires --dry-run=server", err.Error())
+			},
+		},
+		{
+			name: "bad cascade",
+			args: []string{"apply", "dev", "--cascade", "delete"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid cascade policy "delete", must be one of foreground, background or orphan`, err.Error())
+			},
+		},
+		{
+			name: "negative spread",
+			args: []string{"apply", "dev", "--spread", "-1m"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("invalid spread duration -1m0s, must not be negative", err.Error())
+			},
+		},
+		{
+			name: "resume multiple envs",
+			args: []string{"apply", "dev,prod", "--resume", "checkpoint.json"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--resume requires a single environment", err.Error())
+			},
+		},
+		{
+			name: "bad group-by",
+			args: []string{"apply", "dev", "--group-by=app"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid group-by "app", must be one of component, kind or namespace`, err.Error())
+			},
+		},
+		{
+			name: "bad update-only mode",
+			args: []string{"apply", "dev", "--update-only=fail"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid update-only mode "fail", must be one of skip or error`, err.Error())
+			},
+		},
+		{
+			name: "canary env single",
+			args: []string{"apply", "dev", "--canary-env", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--canary-env requires multiple environments", err.Error())
+			},
+		},
+		{
+			name: "canary env not in list",
+			args: []string{"apply", "--env-group", "all", "--canary-env", "stage"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`canary environment "stage" is not one of the environments being applied`, err.Error())
+			},
+		},
+		{
+			name: "bad canary selector",
+			args: []string{"apply", "dev", "--canary-selector", "a=b=c"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Contains(err.Error(), `invalid canary selector "a=b=c"`)
+			},
+		},
 		{
 			name: "no env",
 			args: []string{"apply"},
@@ -130,6 +1120,33 @@ func TestApplyNegative(t *testing.T) {
 				a.Equal("cannot apply baseline environment, use a real environment", err.Error())
 			},
 		},
+		{
+			name: "env and group",
+			args: []string{"apply", "dev", "--env-group", "all"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot specify environments as well as an environment group`, err.Error())
+			},
+		},
+		{
+			name: "bad group",
+			args: []string{"apply", "--env-group", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment group "foo"`, err.Error())
+			},
+		},
+		{
+			name: "bad env in list",
+			args: []string{"apply", "dev,stage"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "stage"`, err.Error())
+			},
+		},
 		{
 			name: "c and C",
 			args: []string{"apply", "dev", "-c", "cluster-objects", "-C", "service2"},
@@ -139,6 +1156,42 @@ func TestApplyNegative(t *testing.T) {
 				a.Equal(`cannot include as well as exclude components, specify one or the other`, err.Error())
 			},
 		},
+		{
+			name: "gc dry-run without gc",
+			args: []string{"apply", "dev", "--gc=false", "--gc-dry-run"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot specify --gc-dry-run when garbage collection is disabled`, err.Error())
+			},
+		},
+		{
+			name: "table without gc dry-run",
+			args: []string{"apply", "dev", "-o", "table"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--format can only be used with --gc-dry-run`, err.Error())
+			},
+		},
+		{
+			name: "bad gc format",
+			args: []string{"apply", "dev", "--gc-dry-run", "-o", "yaml"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid output format: "yaml"`, err.Error())
+			},
+		},
+		{
+			name: "gc kind include and exclude",
+			args: []string{"apply", "dev", "--gc-include-kind", "secret", "--gc-exclude-kind", "configmap"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot include as well as exclude gc kinds, specify one or the other`, err.Error())
+			},
+		},
 		{
 			name: "k and K",
 			args: []string{"apply", "dev", "-k", "namespace", "-K", "secret"},
@@ -0,0 +1,354 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/eval"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// changedSinceLastRender is the reference that selects components changed since the last render that used it.
+const changedSinceLastRender = "last-render"
+
+// renderStateDir is the directory, relative to the app root, where input hashes of the last render are stored.
+const renderStateDir = ".qbec/last-render"
+
+// renderState has the hashes of input files keyed by component name and file path.
+type renderState map[string]map[string]string
+
+// componentInputs returns the input files for each of the supplied components keyed by component name. The
+// qbec.yaml file is considered an input for all components. The inputs of a helm chart or kustomization are the
+// params file, which has its values or patches, and the files of its directory when it is local. Those of a CUE
+// component are its file and the params file. The descriptor of a component, if any, is also one of its inputs, as
+// is the source of the generator of a generated component.
+func componentInputs(components []model.Component, paramsFile string, libPaths []string) (map[string][]string, error) {
+	appFile, err := filepath.Abs("qbec.yaml")
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string][]string{}
+	for _, c := range components {
+		var deps []string
+		if c.Chart != nil || c.Kustomization != nil || filepath.Ext(c.File) == ".cue" {
+			deps, err = generatedInputs(c, paramsFile, libPaths)
+		} else {
+			deps, err = eval.Dependencies(c.File, libPaths)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "dependencies for component %s", c.Name)
+		}
+		for _, f := range []string{c.DescriptorFile, generatorSource(c)} {
+			if f == "" {
+				continue
+			}
+			file, err := filepath.Abs(f)
+			if err != nil {
+				return nil, err
+			}
+			deps = append(deps, file)
+		}
+		ret[c.Name] = append(deps, appFile)
+	}
+	return ret, nil
+}
+
+// generatorSource returns the source of the generator of the supplied component, or an empty string when it is not
+// generated.
+func generatorSource(c model.Component) string {
+	if c.Generator == nil {
+		return ""
+	}
+	return c.Generator.Source
+}
+
+// generatedInputs returns the input files of the supplied helm chart, kustomization or CUE component.
+func generatedInputs(c model.Component, paramsFile string, libPaths []string) ([]string, error) {
+	deps, err := eval.Dependencies(paramsFile, libPaths)
+	if err != nil {
+		return nil, err
+	}
+	var dir string
+	switch {
+	case c.Chart != nil && c.Chart.IsLocal():
+		dir = c.Chart.Chart
+	case c.Kustomization != nil && !c.Kustomization.IsRemote():
+		dir = c.Kustomization.Path
+	case c.Chart == nil && c.Kustomization == nil:
+		file, err := filepath.Abs(c.File)
+		if err != nil {
+			return nil, err
+		}
+		return append(deps, file), nil
+	default:
+		return deps, nil
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		deps = append(deps, abs)
+		return nil
+	})
+	return deps, err
+}
+
+// gitChangedFiles returns the absolute paths of files that are different in the working tree from the supplied
+// git reference, including untracked files that are not ignored.
+func gitChangedFiles(ref string) ([]string, error) {
+	top, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	top = strings.TrimSpace(top)
+	diffs, err := runGit("-C", top, "diff", "--name-only", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := runGit("-C", top, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, line := range strings.Split(diffs+"\n"+untracked, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			ret = append(ret, filepath.Join(top, filepath.FromSlash(line)))
+		}
+	}
+	return ret, nil
+}
+
+func runGit(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v\n%s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// changedComponentsSinceRef returns the components that have at least one input in the supplied list of
+// changed files.
+func changedComponentsSinceRef(components []model.Component, inputs map[string][]string, changedFiles []string) []model.Component {
+	changed := map[string]bool{}
+	for _, f := range changedFiles {
+		changed[f] = true
+	}
+	var ret []model.Component
+	for _, c := range components {
+		for _, f := range inputs[c.Name] {
+			if changed[f] {
+				ret = append(ret, c)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func renderStateFile(env string) string {
+	return filepath.Join(renderStateDir, env+".json")
+}
+
+func loadRenderState(env string) (renderState, error) {
+	b, err := ioutil.ReadFile(renderStateFile(env))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return renderState{}, nil
+		}
+		return nil, err
+	}
+	var state renderState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", renderStateFile(env))
+	}
+	if state == nil {
+		state = renderState{}
+	}
+	return state, nil
+}
+
+func saveRenderState(env string, state renderState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(renderStateDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(renderStateFile(env), b, 0644)
+}
+
+func fileHash(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// changedComponentsSinceLastRender returns the components whose input hashes are different from the ones recorded
+// at the last render for the environment, along with a function that records the current hashes of the returned
+// components once they have been rendered successfully.
+func changedComponentsSinceLastRender(env string, components []model.Component, inputs map[string][]string) ([]model.Component, func() error, error) {
+	state, err := loadRenderState(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := map[string]string{}
+	current := func(c model.Component) (map[string]string, error) {
+		ret := map[string]string{}
+		for _, f := range inputs[c.Name] {
+			h, ok := hashes[f]
+			if !ok {
+				h, err = fileHash(f)
+				if err != nil {
+					return nil, err
+				}
+				hashes[f] = h
+			}
+			ret[f] = h
+		}
+		return ret, nil
+	}
+	var ret []model.Component
+	updates := renderState{}
+	for _, c := range components {
+		h, err := current(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !sameHashes(state[c.Name], h) {
+			ret = append(ret, c)
+			updates[c.Name] = h
+		}
+	}
+	save := func() error {
+		if len(updates) == 0 {
+			return nil
+		}
+		for k, v := range updates {
+			state[k] = v
+		}
+		return saveRenderState(env, state)
+	}
+	return ret, save, nil
+}
+
+func sameHashes(old, current map[string]string) bool {
+	if len(old) != len(current) {
+		return false
+	}
+	for k, v := range current {
+		if old[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// changedComponents returns the components that have changed since the supplied reference, which is either a git
+// reference or "last-render". It also returns a function to be called after the components have been rendered
+// successfully. The files of the transformers of the environment are inputs of all components.
+func changedComponents(req StdOptions, env string, fp filterParams, since string, changedFiles func(ref string) ([]string, error)) ([]model.Component, func() error, error) {
+	components, err := req.App().ComponentsForEnvironment(env, fp.includes, fp.excludes)
+	if err != nil {
+		return nil, nil, err
+	}
+	libPaths := req.VM().Config().LibPaths
+	inputs, err := componentInputs(components, req.App().Spec.ParamsFile, libPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range req.App().Transformers(env) {
+		deps, err := eval.Dependencies(t.File, libPaths)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "dependencies for transformer %s", t.Name)
+		}
+		for name := range inputs {
+			inputs[name] = append(inputs[name], deps...)
+		}
+	}
+	done := func() error { return nil }
+	if since == changedSinceLastRender {
+		components, done, err = changedComponentsSinceLastRender(env, components, inputs)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		files, err := changedFiles(since)
+		if err != nil {
+			return nil, nil, err
+		}
+		components = changedComponentsSinceRef(components, inputs, files)
+	}
+	sio.Noticef("%d component(s) changed since %s: %s\n", len(components), since, strings.Join(componentNames(components), ", "))
+	return components, done, nil
+}
+
+func componentNames(components []model.Component) []string {
+	var ret []string
+	for _, c := range components {
+		ret = append(ret, c.Name)
+	}
+	return ret
+}
+
+// changedObjects returns the objects for components that have changed since the supplied reference, which is
+// either a git reference or "last-render", along with the changed components. It also returns a function to be
+// called after the objects have been rendered successfully.
+func changedObjects(req StdOptions, env string, fp filterParams, since string, changedFiles func(ref string) ([]string, error)) ([]model.K8sLocalObject, []model.Component, func() error, error) {
+	components, done, err := changedComponents(req, env, fp, since, changedFiles)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(components) == 0 {
+		return nil, nil, done, nil
+	}
+	objects, err := componentObjects(req, env, components, fp.kindFilter)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return fp.selectObjects(objects), components, done, nil
+}
+
+// checkChangedSinceRef returns a usage error if the supplied reference is not a git reference, for commands that
+// select changed components without rendering them for output.
+func checkChangedSinceRef(since string) error {
+	if since == changedSinceLastRender {
+		return newUsageError(fmt.Sprintf("--changed-since %s can only be used with show, use a git reference", changedSinceLastRender))
+	}
+	return nil
+}
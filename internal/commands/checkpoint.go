@@ -0,0 +1,90 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+)
+
+// checkpointDir is the directory, relative to the app root, where checkpoints of failed applies are written.
+const checkpointDir = ".qbec/checkpoints"
+
+// applyCheckpoint records the objects that were applied successfully by an apply that failed, such that a later
+// apply can resume from where it stopped.
+type applyCheckpoint struct {
+	App       string            `json:"app"`
+	Env       string            `json:"env"`
+	Completed map[string]string `json:"completed"` // render hashes of applied objects keyed by object key
+}
+
+func newApplyCheckpoint(app, env string) *applyCheckpoint {
+	return &applyCheckpoint{App: app, Env: env, Completed: map[string]string{}}
+}
+
+// checkpointFile returns the file to which the checkpoint for the supplied environment is written.
+func checkpointFile(env string) string {
+	return filepath.Join(checkpointDir, "apply-"+env+".json")
+}
+
+// checkpointKey returns a key for the supplied object that does not depend on server metadata.
+func checkpointKey(ob model.K8sMeta) string {
+	return fmt.Sprintf("%s:%s:%s", ob.GetObjectKind().GroupVersionKind().GroupKind(), ob.GetNamespace(), ob.GetName())
+}
+
+// add records the supplied object, which has the supplied render hash, as applied.
+func (c *applyCheckpoint) add(ob model.K8sMeta, hash string) {
+	c.Completed[checkpointKey(ob)] = hash
+}
+
+// has returns true if the supplied object was applied with the same render hash when the checkpoint was written.
+func (c *applyCheckpoint) has(ob model.K8sMeta, hash string) bool {
+	h, ok := c.Completed[checkpointKey(ob)]
+	return ok && h == hash
+}
+
+func loadApplyCheckpoint(file string) (*applyCheckpoint, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var c applyCheckpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", file)
+	}
+	if c.Completed == nil {
+		c.Completed = map[string]string{}
+	}
+	return &c, nil
+}
+
+func saveApplyCheckpoint(file string, c *applyCheckpoint) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
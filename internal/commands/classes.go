@@ -0,0 +1,149 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// classKind is a cluster-scoped kind of object that is referenced by name from other objects. Versions are tried in
+// order until the server lists one of them.
+type classKind struct {
+	kind     string
+	versions []schema.GroupVersion
+}
+
+var (
+	priorityClassKind = classKind{kind: "PriorityClass", versions: []schema.GroupVersion{
+		{Group: "scheduling.k8s.io", Version: "v1"},
+		{Group: "scheduling.k8s.io", Version: "v1beta1"},
+	}}
+	runtimeClassKind = classKind{kind: "RuntimeClass", versions: []schema.GroupVersion{
+		{Group: "node.k8s.io", Version: "v1"},
+		{Group: "node.k8s.io", Version: "v1beta1"},
+	}}
+	storageClassKind = classKind{kind: "StorageClass", versions: []schema.GroupVersion{
+		{Group: "storage.k8s.io", Version: "v1"},
+		{Group: "storage.k8s.io", Version: "v1beta1"},
+	}}
+	ingressClassKind = classKind{kind: "IngressClass", versions: []schema.GroupVersion{
+		{Group: "networking.k8s.io", Version: "v1"},
+		{Group: "networking.k8s.io", Version: "v1beta1"},
+	}}
+)
+
+// classReference is a reference to a class by name.
+type classReference struct {
+	kind  classKind
+	field string
+	name  string
+}
+
+// classReferences returns the class references of the supplied object.
+func classReferences(u *unstructured.Unstructured) []classReference {
+	var ret []classReference
+	add := func(kind classKind, field string, v interface{}) {
+		if name, ok := v.(string); ok && name != "" { // an empty storage class explicitly requests no class
+			ret = append(ret, classReference{kind: kind, field: field, name: name})
+		}
+	}
+	if spec, _, ok := podTemplate(u); ok {
+		add(priorityClassKind, "priorityClassName", spec["priorityClassName"])
+		add(runtimeClassKind, "runtimeClassName", spec["runtimeClassName"])
+	}
+	gk := u.GroupVersionKind().GroupKind()
+	switch {
+	case gk.Group == "" && (gk.Kind == "PersistentVolumeClaim" || gk.Kind == "PersistentVolume"):
+		add(storageClassKind, "storageClassName", nestedValue(u.Object, "spec", "storageClassName"))
+	case gk.Group == "apps" && gk.Kind == "StatefulSet":
+		for _, t := range toMaps(nestedValue(u.Object, "spec", "volumeClaimTemplates")) {
+			add(storageClassKind, "storageClassName", nestedValue(t, "spec", "storageClassName"))
+		}
+	case (gk.Group == "extensions" || gk.Group == "networking.k8s.io") && gk.Kind == "Ingress":
+		add(ingressClassKind, "ingressClassName", nestedValue(u.Object, "spec", "ingressClassName"))
+	}
+	return ret
+}
+
+// classClient is the remote interface needed to check class references.
+type classClient interface {
+	DisplayName(o model.K8sMeta) string
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+}
+
+// classLister lists the names of classes on the server, caching the results for each kind.
+type classLister struct {
+	client classClient
+	cache  map[string]map[string]bool
+}
+
+// names returns the names of the classes of the supplied kind on the server, or nil if the server does not
+// support any version of the kind.
+func (c *classLister) names(kind classKind) map[string]bool {
+	if names, ok := c.cache[kind.kind]; ok {
+		return names
+	}
+	var names map[string]bool
+	for _, gv := range kind.versions {
+		list, err := c.client.ListObjects(gv.WithKind(kind.kind), "")
+		if err != nil {
+			continue
+		}
+		names = map[string]bool{}
+		for _, o := range list {
+			names[o.GetName()] = true
+		}
+		break
+	}
+	if names == nil {
+		sio.Warnf("unable to list %s objects, not checking references to them\n", kind.kind)
+	}
+	c.cache[kind.kind] = names
+	return names
+}
+
+// missingClasses returns messages for references from the supplied objects to classes that neither exist on the
+// server nor are part of the objects.
+func missingClasses(objects []model.K8sLocalObject, client classClient) []string {
+	local := map[string]bool{}
+	for _, o := range objects {
+		local[o.GetObjectKind().GroupVersionKind().Kind+":"+o.GetName()] = true
+	}
+	lister := &classLister{client: client, cache: map[string]map[string]bool{}}
+	var ret []string
+	for _, o := range objects {
+		seen := map[string]bool{}
+		for _, ref := range classReferences(o.ToUnstructured()) {
+			key := ref.kind.kind + ":" + ref.name
+			if local[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			names := lister.names(ref.kind)
+			if names == nil || names[ref.name] {
+				continue
+			}
+			ret = append(ret, fmt.Sprintf("%s: %s %q does not exist", client.DisplayName(o), ref.field, ref.name))
+		}
+	}
+	return ret
+}
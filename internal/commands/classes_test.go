@@ -0,0 +1,119 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMissingClasses(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	listed := map[string]int{}
+	s.opts.client.listObjectsFunc = func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		listed[gvk.GroupVersion().String()+"/"+gvk.Kind]++
+		switch gvk.Kind {
+		case "PriorityClass":
+			return []*unstructured.Unstructured{{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "high"}}}}, nil
+		case "IngressClass":
+			if gvk.Version == "v1" {
+				return nil, errors.New("not found")
+			}
+			return []*unstructured.Unstructured{{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "nginx"}}}}, nil
+		case "RuntimeClass":
+			return nil, errors.New("not found")
+		default:
+			return nil, nil
+		}
+	}
+	obj := func(data map[string]interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(data, "example1", "c1", "dev")
+	}
+	web := deployment("web", 1, nil)
+	spec := web["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	spec["priorityClassName"] = "high"
+	spec["runtimeClassName"] = "gvisor"
+	batch := deployment("batch", 1, nil)
+	batch["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["priorityClassName"] = "low"
+	objects := []model.K8sLocalObject{
+		obj(web),
+		obj(batch),
+		obj(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]interface{}{"name": "data", "namespace": "quota-ns"},
+			"spec":       map[string]interface{}{"storageClassName": "fast"},
+		}),
+		obj(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]interface{}{"name": "static", "namespace": "quota-ns"},
+			"spec":       map[string]interface{}{"storageClassName": ""},
+		}),
+		obj(map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "StatefulSet",
+			"metadata":   map[string]interface{}{"name": "db", "namespace": "quota-ns"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{"spec": map[string]interface{}{}},
+				"volumeClaimTemplates": []interface{}{
+					map[string]interface{}{"spec": map[string]interface{}{"storageClassName": "local"}},
+				},
+			},
+		}),
+		obj(map[string]interface{}{
+			"apiVersion": "storage.k8s.io/v1",
+			"kind":       "StorageClass",
+			"metadata":   map[string]interface{}{"name": "local"},
+		}),
+		obj(map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1beta1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "quota-ns"},
+			"spec":       map[string]interface{}{"ingressClassName": "nginx"},
+		}),
+	}
+	msgs := missingClasses(objects, s.opts.client)
+	assert.Equal(t, []string{
+		`Deployment:quota-ns:batch: priorityClassName "low" does not exist`,
+		`PersistentVolumeClaim:quota-ns:data: storageClassName "fast" does not exist`,
+	}, msgs)
+	assert.Equal(t, 1, listed["scheduling.k8s.io/v1/PriorityClass"])
+	assert.Equal(t, 1, listed["storage.k8s.io/v1/StorageClass"])
+	assert.Equal(t, 1, listed["networking.k8s.io/v1beta1/IngressClass"])
+	assert.Equal(t, 1, listed["node.k8s.io/v1beta1/RuntimeClass"])
+	s.assertErrorLineMatch(regexp.MustCompile(`unable to list RuntimeClass objects, not checking references to them`))
+}
+
+func TestValidateCheckClasses(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	s.opts.client.listObjectsFunc = func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		return nil, nil
+	}
+	err := s.executeCommand("validate", "dev", "-c", "cluster-objects", "--check-classes")
+	require.Nil(t, err)
+}
@@ -101,14 +101,26 @@ type Client interface {
 	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
 	Sync(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error)
 	ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, error)
+	FieldDefaults(obj *unstructured.Unstructured) ([]remote.FieldDefault, error)
 	ListExtraObjects(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error)
-	Delete(obj model.K8sMeta, dryRun bool) (*remote.SyncResult, error)
+	Delete(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error)
+	UpdateMetadata(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error)
+	RenderHashes(scope remote.ListQueryConfig) (remote.ObjectHashes, error)
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+	RecordTombstones(namespace, name string, tombstones []remote.Tombstone, max int) error
+	Tombstones(namespace, name string) ([]remote.Tombstone, error)
+	Inventory(namespace, name string) ([]string, error)
+	RecordInventory(namespace, name string, components []string) error
+	Impersonate(user string, groups []string) (Client, error)
+	ServerVersion() (string, error)
+	CanI(verb string, gvk schema.GroupVersionKind, namespace string) (bool, string, error)
 }
 
 // StdOptionsWithClient provides a remote client in addition to standard options.
 type StdOptionsWithClient interface {
-	StdOptions                         // base options
-	Client(env string) (Client, error) // a client valid for the supplied environment
+	StdOptions                                                  // base options
+	Client(env string) (Client, error)                          // a client valid for the supplied environment
+	ResolveContext(env string) (*remote.ResolvedContext, error) // the kubeconfig context the environment resolves to
 }
 
 // OptionsProvider provides standard configuration available to all commands
@@ -118,12 +130,24 @@ type OptionsProvider func() StdOptionsWithClient
 func Setup(root *cobra.Command, op OptionsProvider) {
 	root.AddCommand(newApplyCommand(op))
 	root.AddCommand(newValidateCommand(op))
+	root.AddCommand(newLintAPIsCommand(op))
 	root.AddCommand(newShowCommand(op))
 	root.AddCommand(newDiffCommand(op))
+	root.AddCommand(newCompareLiveCommand(op))
+	root.AddCommand(newStatusCommand(op))
 	root.AddCommand(newDeleteCommand(op))
+	root.AddCommand(newDeletedCommand(op))
+	root.AddCommand(newRelabelCommand(op))
+	root.AddCommand(newGraphCommand(op))
+	root.AddCommand(newPreviewCommand(op))
 	root.AddCommand(newComponentCommand(op))
+	root.AddCommand(newNewCommand(op))
 	root.AddCommand(newParamCommand(op))
+	root.AddCommand(newVarsCommand(op))
+	root.AddCommand(newEnvCommand(op))
 	root.AddCommand(newInitCommand())
+	root.AddCommand(newConvertCommand())
+	addEnvDefaults(root, op)
 }
 
 type worker func(object model.K8sLocalObject) error
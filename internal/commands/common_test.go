@@ -18,14 +18,17 @@ package commands
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"testing"
 
 	"github.com/pkg/errors"
 	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestRunInParallelNoObjects(t *testing.T) {
@@ -152,3 +155,128 @@ stats:
 `
 	assert.Equal(t, expected, buf.String())
 }
+
+// TestStdoutHasOnlyData ensures that commands producing machine-readable output do not write diagnostics to stdout
+// at any verbosity level.
+func TestStdoutHasOnlyData(t *testing.T) {
+	withLive := func(t *testing.T) *scaffold {
+		s := newScaffold(t)
+		setLiveObjects(s, map[string][]model.K8sLocalObject{
+			"dev":  {liveConfigMap("dev", "bar"), liveService("dev")},
+			"prod": {liveService("prod"), liveConfigMap("prod", "bar")},
+		})
+		return s
+	}
+	withValidator := func(t *testing.T) *scaffold {
+		s := newScaffold(t)
+		s.opts.client.validatorFunc = allValid
+		return s
+	}
+	tests := []struct {
+		args     []string
+		format   string                       // json or yaml when stdout must parse as such, blank for other output
+		fails    bool                         // the command fails after writing its output
+		scaffold func(t *testing.T) *scaffold // sets up the client for the command, newScaffold if not set
+	}{
+		{args: []string{"show", "dev"}, format: "yaml"},
+		{args: []string{"show", "dev", "-o", "json"}, format: "json"},
+		{args: []string{"show", "dev", "-O", "-o", "yaml"}, format: "yaml"},
+		{args: []string{"show", "dev", "-O", "-o", "json"}, format: "json"},
+		{args: []string{"show", "dev", "-k", "no-such-kind"}, format: "yaml"},
+		{args: []string{"component", "list", "dev", "-o", "yaml"}, format: "yaml"},
+		{args: []string{"component", "list", "dev", "-o", "json"}, format: "json"},
+		{args: []string{"component", "list", "dev", "-o", "wide"}},
+		{args: []string{"component", "diff", "dev", "prod"}},
+		{args: []string{"param", "list", "dev", "-o", "yaml"}, format: "yaml"},
+		{args: []string{"param", "list", "dev", "-o", "json"}, format: "json"},
+		{args: []string{"param", "list", "dev", "-o", "dotenv"}},
+		{args: []string{"param", "diff", "dev", "prod", "-o", "json"}, format: "json"},
+		{args: []string{"env", "list"}},
+		{args: []string{"env", "list", "-o", "json"}, format: "json"},
+		{args: []string{"graph", "dev"}},
+		{args: []string{"graph", "dev", "-o", "mermaid"}},
+		{args: []string{"apply", "dev", "-n", "--gc=false"}, format: "yaml"},
+		{args: []string{"validate", "dev"}, scaffold: withValidator},
+		{args: []string{"validate", "dev", "-o", "json"}, format: "json", scaffold: withValidator},
+		{args: []string{"status", "dev"}, scaffold: withLive},
+		{args: []string{"status", "dev", "-o", "json"}, format: "json", scaffold: withLive},
+		{args: []string{"status", "dev", "-o", "yaml"}, format: "yaml", scaffold: withLive},
+		{args: []string{"compare-live", "dev", "prod"}, scaffold: withLive},
+		{args: []string{"deleted", "dev", "-o", "json"}, format: "json", scaffold: deletedScaffold},
+		{args: []string{"deleted", "dev", "-o", "yaml"}, format: "yaml", scaffold: deletedScaffold},
+		{
+			args:   []string{"lint-apis", "dev", "-c", "cluster-objects", "-k", "clusterrolebindings", "-o", "json"},
+			format: "json",
+			fails:  true,
+			scaffold: func(t *testing.T) *scaffold {
+				s := newScaffold(t)
+				s.opts.client.versionFunc = serverVersion("1.25")
+				return s
+			},
+		},
+		{
+			args:  []string{"diff", "dev", "--show-deletes=false"},
+			fails: true,
+			scaffold: func(t *testing.T) *scaffold {
+				s := newScaffold(t)
+				s.opts.client.getFunc = (&dg{cmValue: "baz", secretValue: "baz"}).get
+				return s
+			},
+		},
+		{
+			args:  []string{"relabel", "dev", "-c", "service2"},
+			fails: true,
+			scaffold: func(t *testing.T) *scaffold {
+				s, _ := relabelScaffold(t)
+				return s
+			},
+		},
+		{
+			args: []string{"delete", "dev", "--local", "-c", "service2", "-n"},
+			scaffold: func(t *testing.T) *scaffold {
+				s := newScaffold(t)
+				s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+					return obj.(model.K8sLocalObject).ToUnstructured(), nil
+				}
+				return s
+			},
+		},
+	}
+	for _, verbosity := range []int{0, 4} {
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%v-%d", test.args, verbosity), func(t *testing.T) {
+				newS := test.scaffold
+				if newS == nil {
+					newS = newScaffold
+				}
+				s := newS(t)
+				defer s.reset()
+				s.opts.verbosity = verbosity
+				if s.opts.client.syncFunc == nil {
+					s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+						return &remote.SyncResult{Type: remote.SyncUpdated, Details: "data updated"}, nil
+					}
+				}
+				err := s.executeCommand(test.args...)
+				if test.fails {
+					require.NotNil(t, err)
+				} else {
+					require.Nil(t, err)
+				}
+				switch test.format {
+				case "json":
+					var data interface{}
+					err = json.Unmarshal([]byte(s.stdout()), &data)
+				case "yaml":
+					_, err = s.yamlOutput()
+				default:
+					err = nil
+				}
+				require.Nil(t, err, "stdout:\n%s", s.stdout())
+				a := assert.New(t)
+				a.NotContains(s.stdout(), "[warn]")
+				a.NotContains(s.stdout(), "Eval components")
+			})
+		}
+	}
+}
@@ -0,0 +1,280 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/diff"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// compareClient is the remote interface needed to compare the live objects of environments.
+type compareClient interface {
+	listClient
+	DisplayName(o model.K8sMeta) string
+	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
+}
+
+// liveKey returns the key under which live objects of different environments are matched. Objects in the default
+// namespace of their environment are matched regardless of the name of that namespace.
+func liveKey(o model.K8sMeta, defaultNs string) string {
+	gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+	ns := o.GetNamespace()
+	if ns == defaultNs {
+		ns = ""
+	}
+	return gk.Group + ":" + gk.Kind + ":" + ns + ":" + o.GetName()
+}
+
+// normalizeLive returns a copy of the supplied live object without the fields that are set by the server or by
+// qbec and are expected to be different for every environment.
+func normalizeLive(obj *unstructured.Unstructured, defaultNs string) *unstructured.Unstructured {
+	u := obj.DeepCopy()
+	delete(u.Object, "status")
+	for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink", "managedFields", "ownerReferences"} {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	if u.GetNamespace() == defaultNs {
+		unstructured.RemoveNestedField(u.Object, "metadata", "namespace")
+	}
+	if labels := u.GetLabels(); labels != nil {
+		delete(labels, model.QbecNames.EnvironmentLabel)
+		u.SetLabels(labels)
+	}
+	if anns := u.GetAnnotations(); anns != nil {
+		for _, a := range []string{
+			model.QbecNames.PristineAnnotation,
+			model.QbecNames.RenderHashAnnotation,
+			model.QbecNames.RunURLAnnotation,
+			model.QbecNames.PipelineIDAnnotation,
+			model.QbecNames.PlanHashAnnotation,
+			"kubectl.kubernetes.io/last-applied-configuration",
+			"deployment.kubernetes.io/revision",
+		} {
+			delete(anns, a)
+		}
+		u.SetAnnotations(anns)
+	}
+	gk := u.GroupVersionKind().GroupKind()
+	switch {
+	case gk.Group == "" && gk.Kind == "Service":
+		unstructured.RemoveNestedField(u.Object, "spec", "clusterIP")
+		unstructured.RemoveNestedField(u.Object, "spec", "clusterIPs")
+	case gk.Group == "" && gk.Kind == "ServiceAccount":
+		delete(u.Object, "secrets")
+	case gk.Group == "" && gk.Kind == "PersistentVolumeClaim":
+		unstructured.RemoveNestedField(u.Object, "spec", "volumeName")
+	}
+	return u
+}
+
+// compareStats has the results of comparing the live objects of two environments.
+type compareStats struct {
+	SameCount int                 `json:"same,omitempty"`
+	Different []string            `json:"different,omitempty"`
+	Missing   map[string][]string `json:"missing,omitempty"` // objects missing from an environment, keyed by environment
+}
+
+type compareCommandConfig struct {
+	StdOptions
+	showSecrets    bool
+	contextLines   int
+	di             diffIgnores
+	filterFunc     func() (filterParams, error)
+	clientProvider func(env string) (compareClient, error)
+}
+
+// liveObjects has the qbec-managed live objects of an environment, keyed by their live key.
+type liveObjects struct {
+	env       string
+	client    compareClient
+	defaultNs string
+	objects   map[string]model.K8sQbecMeta
+}
+
+func loadLiveObjects(env string, fp filterParams, config compareCommandConfig) (*liveObjects, error) {
+	client, err := config.clientProvider(env)
+	if err != nil {
+		return nil, err
+	}
+	all, err := allObjects(config, env)
+	if err != nil {
+		return nil, err
+	}
+	cf, _ := model.NewComponentFilter(fp.includes, fp.excludes)
+	defaultNs := config.DefaultNamespace(env)
+	scope, _ := listScope(client, all, defaultNs)
+	list, err := client.ListExtraObjects(nil, remote.ListQueryConfig{
+		Application:     config.App().Name(),
+		Environment:     env,
+		KindFilter:      fp.kindFilter,
+		LabelSelector:   fp.selectorString(),
+		ComponentFilter: cf,
+		ListQueryScope:  scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := &liveObjects{env: env, client: client, defaultNs: defaultNs, objects: map[string]model.K8sQbecMeta{}}
+	for _, o := range list {
+		ret.objects[liveKey(o, defaultNs)] = o
+	}
+	return ret, nil
+}
+
+// get returns the normalized live object for the supplied key.
+func (l *liveObjects) get(key string, showSecrets bool, di diffIgnores) (*unstructured.Unstructured, error) {
+	u, err := l.client.Get(l.objects[key])
+	if err != nil {
+		return nil, err
+	}
+	u = normalizeLive(u, l.defaultNs)
+	if !showSecrets {
+		u, _ = model.HideSensitiveInfo(u)
+	}
+	di.preprocess(u)
+	return u, nil
+}
+
+func doCompareLive(args []string, config compareCommandConfig) error {
+	if len(args) != 2 {
+		return newUsageError("exactly two environments required")
+	}
+	for _, env := range args {
+		if env == model.Baseline {
+			return newUsageError("cannot compare baseline environment, use a real environment")
+		}
+		if _, ok := config.App().Spec.Environments[env]; !ok {
+			return newUsageError(fmt.Sprintf("invalid environment %q", env))
+		}
+	}
+	if args[0] == args[1] {
+		return newUsageError("cannot compare an environment with itself")
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	left, err := loadLiveObjects(args[0], fp, config)
+	if err != nil {
+		return err
+	}
+	right, err := loadLiveObjects(args[1], fp, config)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for k := range left.objects {
+		keys = append(keys, k)
+	}
+	for k := range right.objects {
+		if _, ok := left.objects[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	if config.contextLines == 0 {
+		config.contextLines = -1
+	}
+	opts := diff.Options{Context: config.contextLines, Colorize: config.Colorize()}
+	stats := compareStats{Missing: map[string][]string{}}
+	w := config.Stdout()
+	for _, k := range keys {
+		lo, inLeft := left.objects[k]
+		ro, inRight := right.objects[k]
+		switch {
+		case !inRight:
+			name := left.client.DisplayName(lo)
+			stats.Missing[right.env] = append(stats.Missing[right.env], name)
+			fmt.Fprintf(w, "%s: only exists in %s\n", name, left.env)
+			continue
+		case !inLeft:
+			name := right.client.DisplayName(ro)
+			stats.Missing[left.env] = append(stats.Missing[left.env], name)
+			fmt.Fprintf(w, "%s: only exists in %s\n", name, right.env)
+			continue
+		}
+		name := left.client.DisplayName(lo)
+		l, err := left.get(k, config.showSecrets, config.di)
+		if err != nil {
+			return err
+		}
+		r, err := right.get(k, config.showSecrets, config.di)
+		if err != nil {
+			return err
+		}
+		fileOpts := opts
+		fileOpts.LeftName = left.env + " " + name
+		fileOpts.RightName = right.env + " " + right.client.DisplayName(ro)
+		b, err := diff.Objects(l, r, fileOpts)
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 {
+			if config.Verbosity() > 0 {
+				fmt.Fprintf(w, "%s unchanged\n", name)
+			}
+			stats.SameCount++
+			continue
+		}
+		fmt.Fprintln(w, string(b))
+		stats.Different = append(stats.Different, name)
+	}
+	printStats(w, &stats)
+
+	numDiffs := len(stats.Different) + len(stats.Missing[left.env]) + len(stats.Missing[right.env])
+	if numDiffs > 0 {
+		return fmt.Errorf("%d object(s) different between %s and %s", numDiffs, left.env, right.env)
+	}
+	sio.Noticef("live objects of %s and %s are the same\n", left.env, right.env)
+	return nil
+}
+
+func newCompareLiveCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "compare-live <environment> <environment>",
+		Short:   "diff the live objects of two environments, such as a primary and a standby cluster",
+		Example: compareLiveExamples(),
+	}
+
+	config := compareCommandConfig{
+		clientProvider: func(env string) (compareClient, error) {
+			return op().Client(env)
+		},
+		filterFunc: addFilterParams(cmd, op, true),
+	}
+	cmd.Flags().IntVar(&config.contextLines, "context", 3, "context lines for diff")
+	cmd.Flags().BoolVarP(&config.showSecrets, "show-secrets", "S", false, "do not obfuscate secret values in the diff")
+	cmd.Flags().BoolVar(&config.di.allAnnotations, "ignore-all-annotations", false, "remove all annotations from objects before diff")
+	cmd.Flags().StringArrayVar(&config.di.annotationNames, "ignore-annotation", nil, "remove specific annotation from objects before diff")
+	cmd.Flags().BoolVar(&config.di.allLabels, "ignore-all-labels", false, "remove all labels from objects before diff")
+	cmd.Flags().StringArrayVar(&config.di.labelNames, "ignore-label", nil, "remove specific label from objects before diff")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doCompareLive(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,183 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func liveConfigMap(env string, value string) model.K8sLocalObject {
+	return model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":              "live-cm",
+			"namespace":         "default",
+			"uid":               env + "-uid",
+			"resourceVersion":   env + "-rv",
+			"creationTimestamp": env + "-time",
+			"labels": map[string]interface{}{
+				"qbec.io/environment": env,
+			},
+			"annotations": map[string]interface{}{
+				"qbec.io/last-applied": env + "-pristine",
+			},
+		},
+		"data": map[string]interface{}{"foo": value},
+	}, "example1", "service2", env)
+}
+
+func liveService(env string) model.K8sLocalObject {
+	return model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":      "live-svc",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"clusterIP": env + "-ip",
+			"ports":     []interface{}{map[string]interface{}{"port": int64(80)}},
+		},
+		"status": map[string]interface{}{"loadBalancer": env},
+	}, "example1", "service2", env)
+}
+
+func setLiveObjects(s *scaffold, live map[string][]model.K8sLocalObject) {
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		var ret []model.K8sQbecMeta
+		for _, o := range live[scope.Environment] {
+			ret = append(ret, o)
+		}
+		return ret, nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+}
+
+func TestNormalizeLive(t *testing.T) {
+	a := assert.New(t)
+	u := normalizeLive(liveService("dev").ToUnstructured(), "default")
+	a.Equal("", u.GetNamespace())
+	a.Nil(u.Object["status"])
+	a.Equal(map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"port": int64(80)}},
+	}, u.Object["spec"])
+	u = normalizeLive(liveConfigMap("dev", "bar").ToUnstructured(), "other")
+	a.Equal("default", u.GetNamespace())
+	a.Empty(u.GetUID())
+	a.Equal("", u.GetResourceVersion())
+	a.NotContains(u.GetLabels(), model.QbecNames.EnvironmentLabel)
+	a.NotContains(u.GetAnnotations(), model.QbecNames.PristineAnnotation)
+}
+
+func TestCompareLiveSame(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setLiveObjects(s, map[string][]model.K8sLocalObject{
+		"dev":  {liveConfigMap("dev", "bar"), liveService("dev")},
+		"prod": {liveService("prod"), liveConfigMap("prod", "bar")},
+	})
+	err := s.executeCommand("compare-live", "dev", "prod")
+	require.Nil(t, err)
+	stats := s.outputStats()
+	assert.EqualValues(t, 2, stats["same"])
+	s.assertErrorLineMatch(regexp.MustCompile(`live objects of dev and prod are the same`))
+}
+
+func TestCompareLiveDifferent(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setLiveObjects(s, map[string][]model.K8sLocalObject{
+		"dev":  {liveConfigMap("dev", "bar"), liveService("dev")},
+		"prod": {liveConfigMap("prod", "baz")},
+	})
+	err := s.executeCommand("compare-live", "dev", "prod")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("2 object(s) different between dev and prod", err.Error())
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:default:live-cm"}, stats["different"])
+	a.EqualValues(map[string]interface{}{"prod": []interface{}{"Service:default:live-svc"}}, stats["missing"])
+	s.assertOutputLineMatch(regexp.MustCompile(`--- dev ConfigMap:default:live-cm`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\+\+\+ prod ConfigMap:default:live-cm`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^\+\s+foo: baz`))
+	s.assertOutputLineMatch(regexp.MustCompile(`Service:default:live-svc: only exists in dev`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`uid|resourceVersion|last-applied`))
+}
+
+func TestCompareLiveNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "one env",
+			args: []string{"compare-live", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("exactly two environments required", err.Error())
+			},
+		},
+		{
+			name: "same env",
+			args: []string{"compare-live", "dev", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("cannot compare an environment with itself", err.Error())
+			},
+		},
+		{
+			name: "baseline",
+			args: []string{"compare-live", "_", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("cannot compare baseline environment, use a real environment", err.Error())
+			},
+		},
+		{
+			name: "bad env",
+			args: []string{"compare-live", "dev", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "foo"`, err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
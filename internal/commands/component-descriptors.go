@@ -0,0 +1,248 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/eval"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/objsort"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// crdScopes returns whether the kinds of the custom resource definitions in the supplied objects are namespaced,
+// keyed by group and kind.
+func crdScopes(objects []model.K8sLocalObject) map[schema.GroupKind]bool {
+	ret := map[schema.GroupKind]bool{}
+	for _, o := range objects {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		if gvk.Group != "apiextensions.k8s.io" || gvk.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		spec, _ := o.ToUnstructured().Object["spec"].(map[string]interface{})
+		names, _ := spec["names"].(map[string]interface{})
+		group, _ := spec["group"].(string)
+		kind, _ := names["kind"].(string)
+		scope, _ := spec["scope"].(string)
+		ret[schema.GroupKind{Group: group, Kind: kind}] = scope != "Cluster"
+	}
+	return ret
+}
+
+// kindScopes returns the function that tells which kinds are namespaced in the supplied environment, from the client
+// of the environment. It returns nil when there is no client, for the baseline environment or for options without
+// clients.
+func kindScopes(req StdOptions, env string) (objsort.Namespaced, error) {
+	wc, ok := req.(StdOptionsWithClient)
+	if !ok || env == model.Baseline {
+		return nil, nil
+	}
+	client, err := wc.Client(env)
+	if err != nil {
+		return nil, err
+	}
+	return client.IsNamespaced, nil
+}
+
+// componentNamespaces sets the namespace of namespaced objects that do not have one to the namespace in the descriptor
+// of their component. The supplied function returns what tells which kinds are namespaced, and is only called when an
+// object may need a namespace, such that apps without component namespaces do not need a cluster to render. Custom
+// resource definitions in the supplied objects take precedence, since they may not be installed yet. Objects are left
+// alone when the scope of kinds is not known.
+func componentNamespaces(app *model.App, objects []model.K8sLocalObject, scopes func() (objsort.Namespaced, error)) error {
+	var namespaced objsort.Namespaced
+	var local map[schema.GroupKind]bool
+	for _, o := range objects {
+		if o.GetNamespace() != "" {
+			continue
+		}
+		c, _ := app.Component(o.Component())
+		if c.Descriptor == nil || c.Descriptor.Namespace == "" {
+			continue
+		}
+		if local == nil {
+			var err error
+			if namespaced, err = scopes(); err != nil {
+				return err
+			}
+			local = crdScopes(objects)
+		}
+		gvk := o.GetObjectKind().GroupVersionKind()
+		isNamespaced, ok := local[gvk.GroupKind()]
+		if !ok {
+			if namespaced == nil {
+				continue
+			}
+			var err error
+			if isNamespaced, err = namespaced(gvk); err != nil {
+				return errors.Wrapf(err, "component %s: set namespace of %s %s", c.Name, gvk.Kind, o.GetName())
+			}
+		}
+		if isNamespaced {
+			o.ToUnstructured().SetNamespace(c.Descriptor.Namespace)
+		}
+	}
+	return nil
+}
+
+// paramAt returns true if the supplied params have a non-null value at the supplied dotted path.
+func paramAt(params interface{}, path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		m, ok := params.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		params = m[part]
+	}
+	return params != nil
+}
+
+// checkRequiredParams returns an error if the params of the environment being evaluated do not set the params that
+// the descriptors of the supplied components require.
+func checkRequiredParams(components []model.Component, ctx eval.Context) error {
+	var required []model.Component
+	for _, c := range components {
+		if c.Descriptor != nil && len(c.Descriptor.RequiredParams) > 0 {
+			required = append(required, c)
+		}
+	}
+	if len(required) == 0 {
+		return nil
+	}
+	params, err := eval.Params(ctx.ParamsFile, ctx)
+	if err != nil {
+		return errors.Wrap(err, "evaluate params for required params")
+	}
+	all, _ := params["components"].(map[string]interface{})
+	var msgs []string
+	for _, c := range required {
+		var missing []string
+		for _, p := range c.Descriptor.RequiredParams {
+			if !paramAt(all[c.Name], p) {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) > 0 {
+			msgs = append(msgs, fmt.Sprintf("component %s: required param(s) %s not set", c.Name, strings.Join(missing, ", ")))
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("environment %s: %s", ctx.Env, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// warnedDeprecations has the names of deprecated components that were warned about, such that the warning for a
+// component is printed once per run even when it is rendered for many environments.
+var warnedDeprecations = struct {
+	l    sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+// pastSunset returns true if the supplied deprecation has a sunset date before the supplied time.
+func pastSunset(d *model.ComponentDeprecation, now time.Time) bool {
+	if d.Sunset == "" {
+		return false
+	}
+	sunset, err := time.Parse(model.SunsetLayout, d.Sunset)
+	return err == nil && now.After(sunset.AddDate(0, 0, 1))
+}
+
+// deprecationNotice returns the notice for the supplied deprecated component.
+func deprecationNotice(c model.Component, now time.Time) string {
+	d := c.Descriptor.Deprecated
+	switch {
+	case pastSunset(d, now):
+		return fmt.Sprintf("component %s is past its sunset date %s: %s", c.Name, d.Sunset, d.Message)
+	case d.Sunset != "":
+		return fmt.Sprintf("component %s is deprecated and will be removed by %s: %s", c.Name, d.Sunset, d.Message)
+	default:
+		return fmt.Sprintf("component %s is deprecated: %s", c.Name, d.Message)
+	}
+}
+
+// warnDeprecated prints a warning for each of the supplied components that is deprecated and was not warned about.
+func warnDeprecated(components []model.Component) {
+	warnedDeprecations.l.Lock()
+	defer warnedDeprecations.l.Unlock()
+	for _, c := range components {
+		if c.Descriptor == nil || c.Descriptor.Deprecated == nil || warnedDeprecations.seen[c.Name] {
+			continue
+		}
+		warnedDeprecations.seen[c.Name] = true
+		sio.Warnln(deprecationNotice(c, time.Now()))
+	}
+}
+
+// sunsetComponents returns the notices of the components of the supplied objects that are past their sunset date.
+func sunsetComponents(app *model.App, objects []model.K8sLocalObject, now time.Time) []string {
+	var ret []string
+	for _, name := range objectComponents(objects) {
+		c, ok := app.Component(name)
+		if ok && c.Descriptor != nil && c.Descriptor.Deprecated != nil && pastSunset(c.Descriptor.Deprecated, now) {
+			ret = append(ret, deprecationNotice(c, now))
+		}
+	}
+	return ret
+}
+
+// hasParamSchemas returns true if the descriptor of any of the supplied components has a param schema.
+func hasParamSchemas(app *model.App, names []string) bool {
+	for _, name := range names {
+		if c, ok := app.Component(name); ok && c.Descriptor != nil && c.Descriptor.ParamSchema != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// paramProblems returns the problems of the supplied params of components, keyed by component name, with respect to
+// the param schemas of the descriptors of the supplied components.
+func paramProblems(app *model.App, params map[string]interface{}, names []string) ([]string, error) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	var ret []string
+	for _, name := range sorted {
+		msgs, err := app.ValidateComponentParams(name, params[name])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, msgs...)
+	}
+	return ret, nil
+}
+
+// objectComponents returns the names of the components of the supplied objects.
+func objectComponents(objects []model.K8sLocalObject) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, o := range objects {
+		if !seen[o.Component()] {
+			seen[o.Component()] = true
+			names = append(names, o.Component())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
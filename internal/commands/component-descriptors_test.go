@@ -0,0 +1,224 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const extrasComponent = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extras
+data:
+  foo: bar
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterwidgets.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: ClusterWidget
+    plural: clusterwidgets
+---
+apiVersion: example.com/v1
+kind: ClusterWidget
+metadata:
+  name: global
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: extras
+`
+
+// useDescriptors writes the supplied descriptors keyed by component name and an extras component to the components
+// directory of the current app and reloads it.
+func useDescriptors(t *testing.T, s *scaffold, descriptors map[string]string) {
+	require.Nil(t, ioutil.WriteFile("components/extras.yaml", []byte(extrasComponent), 0644))
+	for name, spec := range descriptors {
+		d := "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n" + spec
+		require.Nil(t, ioutil.WriteFile("components/"+name+".component.yaml", []byte(d), 0644))
+	}
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+}
+
+func TestComponentListWide(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	useDescriptors(t, s, map[string]string{
+		"service2":        "  description: the second service\n  namespace: svc2\n  owners: [alice, bob]\n  tags: [backend, web]\n",
+		"cluster-objects": "  tags: [platform]\n",
+	})
+	err := s.executeCommand("component", "list", "dev", "-o", "wide")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^COMPONENT\s+FILE\s+NAMESPACE\s+OWNERS\s+TAGS\s+DESCRIPTION`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^service2\s+components/service2.jsonnet\s+svc2\s+alice,bob\s+backend,web\s+the second service$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^cluster-objects\s+components/cluster-objects.yaml\s+platform$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^extras\s+components/extras.yaml$`))
+}
+
+func TestComponentTagFilter(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	useDescriptors(t, s, map[string]string{
+		"service2":        "  tags: [backend]\n",
+		"cluster-objects": "  tags: [platform, backend]\n",
+	})
+	a := assert.New(t)
+
+	err := s.executeCommand("component", "list", "dev", "--component-tag", "platform")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^cluster-objects\s+`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`^service2\s+`))
+
+	s.outCapture.Reset()
+	err = s.executeCommand("show", "dev", "-O", "--component-tag", "backend", "-C", "cluster-objects")
+	require.Nil(t, err, "%v", err)
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`cluster-objects\s+`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`extras\s+`))
+
+	err = s.executeCommand("apply", "dev", "--component-tag", "frontend")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal("no components selected by component tag(s) frontend", err.Error())
+}
+
+func TestComponentDescriptorNamespace(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	useDescriptors(t, s, map[string]string{"extras": "  namespace: web\n"})
+	var asked []string
+	s.opts.client.nsFunc = func(kind schema.GroupVersionKind) (bool, error) {
+		asked = append(asked, kind.Kind)
+		switch kind.Kind {
+		case "ConfigMap":
+			return true, nil
+		case "ClusterWidget":
+			return false, fmt.Errorf("server does not know %s", kind.Kind)
+		default:
+			return false, nil
+		}
+	}
+	err := s.executeCommand("show", "dev", "-c", "extras")
+	require.Nil(t, err)
+	docs, err := s.yamlOutput()
+	require.Nil(t, err)
+	namespaces := map[string]interface{}{}
+	for _, doc := range docs {
+		o := doc.(map[string]interface{})
+		namespaces[o["kind"].(string)] = o["metadata"].(map[string]interface{})["namespace"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"ConfigMap":                "web",
+		"CustomResourceDefinition": nil,
+		"ClusterWidget":            nil,
+		"ClusterRole":              nil,
+	}, namespaces)
+	// the scope of the custom kind comes from its definition in the rendered objects
+	assert.NotContains(t, asked, "ClusterWidget")
+	assert.Contains(t, asked, "ClusterRole")
+}
+
+func TestComponentRequiredParams(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	useDescriptors(t, s, map[string]string{"service2": "  requiredParams: [cpu, limits.memory]\n"})
+	err := s.executeCommand("show", "dev")
+	require.NotNil(t, err)
+	assert.Equal(t, "environment dev: component service2: required param(s) limits.memory not set", err.Error())
+
+	useDescriptors(t, s, map[string]string{"service2": "  requiredParams: [cpu, memory]\n"})
+	err = s.executeCommand("show", "dev")
+	require.Nil(t, err, "%v", err)
+}
+
+func TestComponentDeprecation(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	s.opts.client.validatorFunc = factory
+	warnedDeprecations.seen = map[string]bool{}
+	useDescriptors(t, s, map[string]string{
+		"service2":        "  deprecated:\n    message: use service3 instead\n    sunset: 2000-01-01\n",
+		"cluster-objects": "  deprecated:\n    message: moved to the platform app\n    sunset: 2999-12-31\n",
+	})
+	a := assert.New(t)
+
+	err := s.executeCommand("show", "dev", "-O")
+	require.Nil(t, err, "%v", err)
+	s.assertErrorLineMatch(regexp.MustCompile(`component service2 is past its sunset date 2000-01-01: use service3 instead`))
+	s.assertErrorLineMatch(regexp.MustCompile(`component cluster-objects is deprecated and will be removed by 2999-12-31: moved to the platform app`))
+
+	err = s.executeCommand("validate", "dev", "--disable", "schema")
+	require.Nil(t, err, "%v", err)
+	a.Equal(1, strings.Count(s.stderr(), "component service2 is past its sunset date"))
+
+	err = s.executeCommand("validate", "dev", "--disable", "schema", "--check-sunset")
+	require.NotNil(t, err)
+	a.Equal("1 component(s) past their sunset date", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`component service2 is past its sunset date 2000-01-01: use service3 instead`))
+}
+
+func TestComponentParamSchema(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	useDescriptors(t, s, map[string]string{
+		"service2": "  paramSchema:\n    properties:\n      cpu: {type: string}\n      memory: {enum: [16Gi]}\n      longValue: {type: string}\n",
+	})
+	a := assert.New(t)
+
+	err := s.executeCommand("param", "list", "dev", "-C", "service1")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`component service2: unknown param longVal, did you mean longValue\?`))
+	s.assertErrorLineMatch(regexp.MustCompile(`component service2: params.memory in body should be one of \[16Gi\]`))
+
+	err = s.executeCommand("validate", "prod", "--disable", "schema")
+	require.NotNil(t, err)
+	a.Equal("1 param problem(s) found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`component service2: unknown param longVal, did you mean longValue\?`))
+
+	err = s.executeCommand("validate", "prod", "--disable", "schema,params")
+	require.Nil(t, err, "%v", err)
+}
@@ -0,0 +1,367 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+var (
+	reComponentName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	reNestedName    = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(/[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	reJsonnetID     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	reParamsStart   = regexp.MustCompile(`^(\s*)components\s*\+?:\s*\{\s*$`)
+)
+
+// jsonnetField returns the supplied name as a jsonnet field name, quoted when needed.
+func jsonnetField(name string) string {
+	if reJsonnetID.MatchString(name) {
+		return name
+	}
+	return "'" + name + "'"
+}
+
+// addBaseParams adds the supplied default parameters, as jsonnet fields, for the supplied component to the components
+// object of the supplied params file and returns the original content of the file. The second return value is false
+// if the file has no components object that can be edited.
+func addBaseParams(file, name string, fields []string) ([]byte, bool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	lines := strings.Split(string(b), "\n")
+	for i, l := range lines {
+		m := reParamsStart.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+		step := indent
+		if step == 0 {
+			step = 2
+		}
+		pad, inner := strings.Repeat(" ", indent+step), strings.Repeat(" ", indent+2*step)
+		params := []string{pad + jsonnetField(name) + ": {"}
+		for _, f := range fields {
+			params = append(params, inner+f)
+		}
+		params = append(params, pad+"},")
+		lines = append(lines[:i+1], append(params, lines[i+1:]...)...)
+		if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			return nil, false, err
+		}
+		return b, true, nil
+	}
+	return nil, false, nil
+}
+
+// componentEnabled returns true if the supplied component is enabled for the supplied environment, or by default
+// when the environment is empty.
+func componentEnabled(app *model.App, name, env string) bool {
+	enabled := !contains(app.Spec.Excludes, name)
+	if env == "" {
+		return enabled
+	}
+	e := app.Spec.Environments[env]
+	return (enabled && !contains(e.Excludes, name)) || contains(e.Includes, name)
+}
+
+// contains returns true if the supplied list has the supplied string.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEditableEnvs returns a usage error if any of the supplied environments is not an environment of the app that
+// can be edited.
+func checkEditableEnvs(app *model.App, envs []string) error {
+	for _, env := range envs {
+		if _, ok := app.Spec.Environments[env]; !ok {
+			return newUsageError(fmt.Sprintf("invalid environment %q", env))
+		}
+		if err := checkNotCluster(app, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDefaultEnabled edits qbec.yaml such that the supplied component is enabled or disabled by default.
+func setDefaultEnabled(e *specEditor, name string, enable bool) error {
+	spec, end, fi, err := e.spec()
+	if err != nil {
+		return err
+	}
+	if enable {
+		return e.removeFromList(spec, end, fi, "excludes", name, nil, false, "excludes")
+	}
+	return e.addToList(spec, end, fi, "excludes", name, nil, "excludes")
+}
+
+// setEnvEnabled edits qbec.yaml such that the supplied component, which has the supplied default state, is enabled
+// or disabled for an environment. An environment that has no list of its own gets a copy of the list it inherits.
+func setEnvEnabled(e *specEditor, app *model.App, name, env string, enable, defaultEnabled bool) error {
+	spec := app.Spec.Environments[env]
+	keepEmpty := spec.Parent != ""
+	drop, add := "includes", "excludes"
+	dropList, addList := spec.Includes, spec.Excludes
+	if enable {
+		drop, add = add, drop
+		dropList, addList = addList, dropList
+	}
+	i, end, fi, err := e.env(env)
+	if err != nil {
+		return err
+	}
+	if err := e.removeFromList(i, end, fi, drop, name, dropList, keepEmpty, drop+" of environment "+env); err != nil {
+		return err
+	}
+	if defaultEnabled == enable {
+		return nil
+	}
+	i, end, fi, err = e.env(env)
+	if err != nil {
+		return err
+	}
+	return e.addToList(i, end, fi, add, name, addList, add+" of environment "+env)
+}
+
+// checkComponentEnabled returns a check that the supplied component is enabled or disabled in the loaded app for the
+// supplied environments.
+func checkComponentEnabled(name string, envs []string, enable bool) func(app *model.App) error {
+	return func(app *model.App) error {
+		for _, env := range envs {
+			if componentEnabled(app, name, env) != enable {
+				where := "by default"
+				if env != "" {
+					where = "for environment " + env
+				}
+				return fmt.Errorf("component %s has the wrong state %s", name, where)
+			}
+		}
+		return nil
+	}
+}
+
+type componentAddCommandConfig struct {
+	StdOptions
+	envs         []string
+	template     string
+	templateDirs []string
+}
+
+func doComponentAdd(args []string, config componentAddCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one component name required")
+	}
+	name := args[0]
+	app := config.App()
+	re := reComponentName
+	if app.Spec.NestedComponents {
+		re = reNestedName
+	}
+	if !re.MatchString(name) {
+		return newUsageError(fmt.Sprintf("invalid component name %q, must match %s", name, re))
+	}
+	if c, ok := app.Component(name); ok {
+		return fmt.Errorf("component %s already exists in %s", name, c.File)
+	}
+	if err := checkEditableEnvs(app, config.envs); err != nil {
+		return err
+	}
+	file := filepath.Join(app.Spec.ComponentsDir, filepath.FromSlash(name)+".jsonnet")
+	paramsFile, err := filepath.Rel(filepath.Dir(file), app.Spec.ParamsFile)
+	if err != nil {
+		return err
+	}
+	data := componentTemplateData{Name: name, ParamsFile: filepath.ToSlash(paramsFile), Quoted: !reJsonnetID.MatchString(name)}
+	contents, fields, err := expandComponentTemplate(config.template, config.templateDirs, data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, contents, 0644); err != nil {
+		return err
+	}
+	sio.Noticeln("wrote", file)
+
+	baseFile := filepath.Join(filepath.Dir(app.Spec.ParamsFile), "environments", "base.libsonnet")
+	orig, ok, err := addBaseParams(baseFile, name, fields)
+	if err != nil {
+		os.Remove(file)
+		return err
+	}
+	if ok {
+		sio.Noticeln("added parameters for component", name, "to", baseFile)
+	} else {
+		sio.Warnf("no components object found in %s, add parameters for component %s to the params of your environments\n", baseFile, name)
+	}
+	if len(config.envs) == 0 {
+		return nil
+	}
+
+	err = editAppFile(func(e *specEditor) (func(app *model.App) error, error) {
+		if err := setDefaultEnabled(e, name, false); err != nil {
+			return nil, err
+		}
+		for _, env := range config.envs {
+			if err := setEnvEnabled(e, app, name, env, true, false); err != nil {
+				return nil, err
+			}
+		}
+		return func(app *model.App) error {
+			for _, env := range sortedEnvNames(app) {
+				if app.Cluster(env) != nil {
+					continue
+				}
+				if want := contains(config.envs, env); componentEnabled(app, name, env) != want {
+					return fmt.Errorf("component %s has the wrong state for environment %s", name, env)
+				}
+			}
+			return nil
+		}, nil
+	})
+	if err != nil {
+		os.Remove(file)
+		if ok {
+			ioutil.WriteFile(baseFile, orig, 0644)
+		}
+		return err
+	}
+	sio.Noticeln("enabled component", name, "only for", strings.Join(config.envs, ", "), "in qbec.yaml")
+	return nil
+}
+
+type componentToggleCommandConfig struct {
+	StdOptions
+}
+
+func doComponentToggle(args []string, config componentToggleCommandConfig, enable bool) error {
+	if len(args) == 0 {
+		return newUsageError("component name required")
+	}
+	name, envs := args[0], args[1:]
+	app := config.App()
+	if _, ok := app.Component(name); !ok {
+		return newUsageError(fmt.Sprintf("invalid component %q", name))
+	}
+	if err := checkEditableEnvs(app, envs); err != nil {
+		return err
+	}
+	action := "disabled"
+	if enable {
+		action = "enabled"
+	}
+	if len(envs) == 0 {
+		envs = []string{""}
+	}
+	var changes []string
+	for _, env := range envs {
+		if componentEnabled(app, name, env) == enable {
+			if env == "" {
+				sio.Noticef("component %s is already %s by default\n", name, action)
+			} else {
+				sio.Noticef("component %s is already %s for environment %s\n", name, action, env)
+			}
+			continue
+		}
+		changes = append(changes, env)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	err := editAppFile(func(e *specEditor) (func(app *model.App) error, error) {
+		var err error
+		for _, env := range changes {
+			if env == "" {
+				err = setDefaultEnabled(e, name, enable)
+			} else {
+				err = setEnvEnabled(e, app, name, env, enable, componentEnabled(app, name, ""))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return checkComponentEnabled(name, changes, enable), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, env := range changes {
+		if env == "" {
+			sio.Noticef("%s component %s by default in qbec.yaml\n", action, name)
+		} else {
+			sio.Noticef("%s component %s for environment %s in qbec.yaml\n", action, name, env)
+		}
+	}
+	return nil
+}
+
+func newComponentAddCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "add <component> [--template <part>+<part>...] [--env <environment>]...",
+		Short:   "add a jsonnet component with default parameters, optionally enabled only for some environments",
+		Example: componentAddExamples(),
+	}
+	config := componentAddCommandConfig{}
+	cmd.Flags().StringArrayVar(&config.envs, "env", nil, "environment to enable the component for, may be repeated, all environments when not set")
+	cmd.Flags().StringVar(&config.template, "template", defaultComponentTemplate, "template of the component as parts separated by +, such as deployment+service+hpa")
+	cmd.Flags().StringArrayVar(&config.templateDirs, "template-dir", filepath.SplitList(os.Getenv(componentTemplateDirsEnv)),
+		"directory with templates of component parts that take precedence over built-in parts, may be repeated (from "+componentTemplateDirsEnv+")")
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doComponentAdd(args, config))
+	}
+	return cmd
+}
+
+func newComponentToggleCommand(op OptionsProvider, enable bool) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "disable <component> [<environment>...]",
+		Short:   "disable a component by default or for environments in qbec.yaml, preserving its comments and formatting",
+		Example: componentDisableExamples(),
+	}
+	if enable {
+		cmd.Use = "enable <component> [<environment>...]"
+		cmd.Short = "enable a component by default or for environments in qbec.yaml, preserving its comments and formatting"
+		cmd.Example = componentEnableExamples()
+	}
+	config := componentToggleCommandConfig{}
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doComponentToggle(args, config, enable))
+	}
+	return cmd
+}
@@ -0,0 +1,270 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envComponentNames(t *testing.T, app *model.App, env string) []string {
+	comps, err := app.ComponentsForEnvironment(env, nil, nil)
+	require.Nil(t, err)
+	var ret []string
+	for _, c := range comps {
+		ret = append(ret, c.Name)
+	}
+	return ret
+}
+
+func TestComponentAdd(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("component", "add", "billing-api")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote components/billing-api.jsonnet`))
+	s.assertErrorLineMatch(regexp.MustCompile(`added parameters for component billing-api to environments/base.libsonnet`))
+	b, err := ioutil.ReadFile("components/billing-api.jsonnet")
+	require.Nil(t, err)
+	a.Contains(string(b), "local p = import '../params.libsonnet';\nlocal params = p.components['billing-api'];\n")
+	b, err = ioutil.ReadFile("environments/base.libsonnet")
+	require.Nil(t, err)
+	a.Contains(string(b), "    components: {\n        'billing-api': {\n            image: 'nginx:stable',\n            replicas: 1,\n        },\n        service1: {\n")
+
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Contains(envComponentNames(t, app, "prod"), "billing-api")
+	s.opts.app = app
+	err = s.executeCommand("show", "prod", "-c", "billing-api", "-O")
+	require.Nil(t, err)
+	a.Contains(s.stdout(), "billing-api")
+}
+
+func TestComponentAddNested(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("component", "add", "team-a/billing")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+
+	b, err := ioutil.ReadFile("qbec.yaml")
+	require.Nil(t, err)
+	b = bytes.Replace(b, []byte("spec:\n"), []byte("spec:\n  nestedComponents: true\n"), 1)
+	require.Nil(t, ioutil.WriteFile("qbec.yaml", b, 0644))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+	for _, name := range []string{"team-a/billing", "team-a/ledger"} {
+		err = s.executeCommand("component", "add", name)
+		require.Nil(t, err)
+	}
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote components/team-a/billing.jsonnet`))
+	b, err = ioutil.ReadFile("components/team-a/billing.jsonnet")
+	require.Nil(t, err)
+	a.Contains(string(b), "local p = import '../../params.libsonnet';\nlocal params = p.components['team-a/billing'];\n")
+
+	app, err = model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+	err = s.executeCommand("show", "prod", "-c", "team-a", "-O")
+	require.Nil(t, err)
+	a.Contains(s.stdout(), "team-a/billing")
+	a.Contains(s.stdout(), "team-a/ledger")
+	a.NotContains(s.stdout(), "cluster-objects")
+}
+
+func TestComponentAddForEnvs(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("component", "add", "billing", "--env", "dev")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`enabled component billing only for dev in qbec.yaml`))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal([]string{"service2", "billing"}, app.Spec.Excludes)
+	a.Equal([]string{"service2", "billing"}, app.Spec.Environments["dev"].Includes)
+	a.Contains(envComponentNames(t, app, "dev"), "billing")
+	a.NotContains(envComponentNames(t, app, "prod"), "billing")
+}
+
+func TestComponentEnableDisable(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	orig, err := ioutil.ReadFile("qbec.yaml")
+	require.Nil(t, err)
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	load := func() *model.App {
+		app, err := model.NewApp("qbec.yaml")
+		require.Nil(t, err)
+		s.opts.app = app
+		return app
+	}
+
+	err = s.executeCommand("component", "enable", "service1", "dev")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`enabled component service1 for environment dev in qbec.yaml`))
+	app := load()
+	a.Nil(app.Spec.Environments["dev"].Excludes)
+	a.Contains(envComponentNames(t, app, "dev"), "service1")
+
+	err = s.executeCommand("component", "disable", "service2", "dev", "prod")
+	require.Nil(t, err)
+	app = load()
+	a.Nil(app.Spec.Environments["dev"].Includes)
+	a.Nil(app.Spec.Environments["prod"].Includes)
+	a.NotContains(envComponentNames(t, app, "prod"), "service2")
+
+	err = s.executeCommand("component", "enable", "service2", "dev", "prod")
+	require.Nil(t, err)
+	load()
+	err = s.executeCommand("component", "disable", "service1", "dev")
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(string(orig), string(b))
+	load()
+
+	err = s.executeCommand("component", "enable", "service2")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`enabled component service2 by default in qbec.yaml`))
+	app = load()
+	a.Nil(app.Spec.Excludes)
+	a.Contains(envComponentNames(t, app, model.Baseline), "service2")
+
+	err = s.executeCommand("component", "disable", "service1", "prod")
+	require.Nil(t, err)
+	app = load()
+	a.Equal([]string{"service1"}, app.Spec.Environments["prod"].Excludes)
+}
+
+func TestComponentEditNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "add no args",
+			args: []string{"component", "add"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("exactly one component name required", err.Error())
+			},
+		},
+		{
+			name: "add bad name",
+			args: []string{"component", "add", "Billing"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid component name "Billing", must match ^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`, err.Error())
+			},
+		},
+		{
+			name: "add existing",
+			args: []string{"component", "add", "service1"},
+			asserter: func(s *scaffold, err error) {
+				assert.Equal(s.t, "component service1 already exists in components/service1.jsonnet", err.Error())
+			},
+		},
+		{
+			name: "add bad env",
+			args: []string{"component", "add", "billing", "--env", "stage"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "stage"`, err.Error())
+				_, statErr := os.Stat("components/billing.jsonnet")
+				a.True(os.IsNotExist(statErr))
+			},
+		},
+		{
+			name: "enable no args",
+			args: []string{"component", "enable"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("component name required", err.Error())
+			},
+		},
+		{
+			name: "enable bad component",
+			args: []string{"component", "enable", "billing", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid component "billing"`, err.Error())
+			},
+		},
+		{
+			name: "disable bad env",
+			args: []string{"component", "disable", "service1", "stage"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "stage"`, err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			reset := editInTempDir(t)
+			defer reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
+
+func TestComponentToggleNoop(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	err := s.executeCommand("component", "enable", "service2", "dev")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`component service2 is already enabled for environment dev`))
+	err = s.executeCommand("component", "disable", "service2")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`component service2 is already disabled by default`))
+}
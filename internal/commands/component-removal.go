@@ -0,0 +1,207 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// changeComponentRemoved is the change recorded in tables for deletions of objects of removed components.
+const changeComponentRemoved = "component-removed"
+
+// removedComponent has the deletion candidates of a component that is no longer part of an environment, because
+// it was deleted or renamed in source or excluded from the environment.
+type removedComponent struct {
+	name      string
+	renamedTo string              // the component that now renders live objects of the removed one, if any
+	objects   []model.K8sQbecMeta // live objects of the component that would be deleted
+}
+
+// status returns a short description of what happened to the component.
+func (r *removedComponent) status() string {
+	if r.renamedTo != "" {
+		return "renamed to " + r.renamedTo
+	}
+	return "removed"
+}
+
+// removedStatus returns the status of the supplied removed components keyed by name, nil if there are none.
+func removedStatus(removed []*removedComponent) map[string]string {
+	if len(removed) == 0 {
+		return nil
+	}
+	ret := map[string]string{}
+	for _, r := range removed {
+		ret[r.name] = r.status()
+	}
+	return ret
+}
+
+// inventoryLocation returns the namespace and name of the config map that has the inventory of the components
+// applied to the supplied environment.
+func inventoryLocation(opts StdOptions, env string) (namespace, name string) {
+	return opts.DefaultNamespace(env), fmt.Sprintf("qbec-inventory-%s-%s", opts.App().Name(), env)
+}
+
+// inventoryClient is the remote interface needed to read and record the inventory of applied components.
+type inventoryClient interface {
+	Inventory(namespace, name string) ([]string, error)
+	RecordInventory(namespace, name string, components []string) error
+}
+
+// removalClient is the remote interface needed to detect removed components.
+type removalClient interface {
+	listClient
+	Inventory(namespace, name string) ([]string, error)
+}
+
+// splitRemovedComponents separates the supplied deletion candidates into those of components of the app and those of
+// components that were removed from it, grouped by component in name order. A component is removed when the
+// recorded inventory of the environment has it and the app no longer does. Objects of components that the app has
+// but excludes for the environment, and of components that were never recorded, are regular deletions. When a
+// removed component still has live objects that are now rendered by another component, it is reported as renamed to
+// the component that renders most of them. The supplied query is used to list these objects, without its component
+// filter.
+func splitRemovedComponents(client removalClient, opts StdOptions, env string, all []model.K8sLocalObject,
+	deletions []model.K8sQbecMeta, query remote.ListQueryConfig) ([]model.K8sQbecMeta, []*removedComponent, error) {
+	app := opts.App()
+	defaultNs := opts.DefaultNamespace(env)
+	var recorded map[string]bool
+	var kept []model.K8sQbecMeta
+	byName := map[string]*removedComponent{}
+	var removed []*removedComponent
+	for _, ob := range deletions {
+		if _, ok := app.Component(ob.Component()); ok {
+			kept = append(kept, ob)
+			continue
+		}
+		if recorded == nil {
+			namespace, name := inventoryLocation(opts, env)
+			inventory, err := client.Inventory(namespace, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			recorded = map[string]bool{}
+			for _, c := range inventory {
+				recorded[c] = true
+			}
+		}
+		if !recorded[ob.Component()] {
+			kept = append(kept, ob)
+			continue
+		}
+		r := byName[ob.Component()]
+		if r == nil {
+			r = &removedComponent{name: ob.Component()}
+			byName[r.name] = r
+			removed = append(removed, r)
+		}
+		r.objects = append(r.objects, ob)
+	}
+	if len(removed) == 0 {
+		return kept, nil, nil
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].name < removed[j].name })
+
+	// detect renames from live objects of removed components that are now rendered by other components
+	query.ComponentFilter = nil
+	live, err := client.ListExtraObjects(nil, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	local := map[string]string{}
+	for _, o := range all {
+		local[liveKey(o, defaultNs)] = o.Component()
+	}
+	counts := map[string]map[string]int{}
+	for _, o := range live {
+		if byName[o.Component()] == nil {
+			continue
+		}
+		target, ok := local[liveKey(o, defaultNs)]
+		if !ok {
+			continue
+		}
+		if counts[o.Component()] == nil {
+			counts[o.Component()] = map[string]int{}
+		}
+		counts[o.Component()][target]++
+	}
+	for _, r := range removed {
+		best := 0
+		for target, n := range counts[r.name] {
+			if n > best || (n == best && target < r.renamedTo) {
+				best, r.renamedTo = n, target
+			}
+		}
+	}
+	return kept, removed, nil
+}
+
+// recordInventory records the components of the environment as the inventory of applied components. Components of
+// the previous inventory are kept unless all objects of removed components were garbage collected, such that later
+// runs still detect removed components with live objects. Failures are reported as warnings since the objects were
+// applied regardless.
+func recordInventory(client inventoryClient, opts StdOptions, env string, collected bool) {
+	components, err := opts.App().ComponentsForEnvironment(env, nil, nil)
+	if err != nil {
+		sio.Warnf("unable to record inventory of components: %v\n", err)
+		return
+	}
+	namespace, name := inventoryLocation(opts, env)
+	seen := map[string]bool{}
+	var list []string
+	for _, c := range components {
+		seen[c.Name] = true
+		list = append(list, c.Name)
+	}
+	if !collected {
+		previous, err := client.Inventory(namespace, name)
+		if err != nil {
+			sio.Warnf("unable to read inventory of components in config map %s/%s: %v\n", namespace, name, err)
+			return
+		}
+		for _, c := range previous {
+			if !seen[c] {
+				list = append(list, c)
+			}
+		}
+	}
+	if err := client.RecordInventory(namespace, name, list); err != nil {
+		sio.Warnf("unable to record inventory of components in config map %s/%s: %v\n", namespace, name, err)
+		return
+	}
+	sio.Debugf("recorded %d component(s) in config map %s/%s\n", len(list), namespace, name)
+}
+
+// removalError returns the error for deletions of objects of removed components that were not confirmed.
+func removalError(removed []*removedComponent) error {
+	count := 0
+	var names []string
+	for _, r := range removed {
+		count += len(r.objects)
+		names = append(names, fmt.Sprintf("%s (%s)", r.name, r.status()))
+	}
+	return fmt.Errorf("%d object(s) of removed component(s) %s would be deleted, use --confirm-component-removal to delete them",
+		count, strings.Join(names, ", "))
+}
@@ -0,0 +1,155 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func componentObject(component, kind, ns, name string) model.K8sQbecMeta {
+	return model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"namespace": ns, "name": name},
+	}, "example1", component, "dev")
+}
+
+// setRemovedComponents sets up live objects of a component, old-svc, that was renamed to service2 and of a component,
+// gone, that was deleted, in addition to an extra object of service2.
+func setRemovedComponents(s *scaffold) {
+	extras := []model.K8sQbecMeta{
+		componentObject("service2", "ConfigMap", "bar-system", "extra-cm"),
+		componentObject("old-svc", "ConfigMap", "bar-system", "old-cm"),
+		componentObject("gone", "Secret", "bar-system", "gone-secret"),
+	}
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		if len(ignore) > 0 {
+			return extras, nil
+		}
+		// the inventory also has the live objects that are now rendered by other components
+		return append([]model.K8sQbecMeta{componentObject("old-svc", "ConfigMap", "bar-system", "svc2-cm")}, extras...), nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, remote.ErrNotFound
+	}
+	s.opts.client.inventoryFunc = func(namespace, name string) ([]string, error) {
+		if namespace != "default" || name != "qbec-inventory-example1-dev" {
+			return nil, fmt.Errorf("unexpected inventory %s/%s", namespace, name)
+		}
+		return []string{"cluster-objects", "gone", "old-svc", "service2"}, nil
+	}
+}
+
+func TestApplyComponentRemovalUnconfirmed(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setRemovedComponents(s)
+	synced := 0
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		synced++
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical}, nil
+	}
+	err := s.executeCommand("apply", "dev")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("2 object(s) of removed component(s) gone (removed), old-svc (renamed to service2) would be deleted, use --confirm-component-removal to delete them", err.Error())
+	a.Equal(0, synced)
+	s.assertErrorLineMatch(regexp.MustCompile(`component old-svc renamed to service2, 1 live object\(s\) will be deleted`))
+}
+
+func TestApplyComponentRemovalConfirmed(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setRemovedComponents(s)
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical}, nil
+	}
+	var deleted []string
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		deleted = append(deleted, obj.GetName())
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	var recorded []string
+	s.opts.client.recordInvFunc = func(namespace, name string, components []string) error {
+		recorded = components
+		return nil
+	}
+	err := s.executeCommand("apply", "dev", "--confirm-component-removal")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal([]string{"extra-cm", "gone-secret", "old-cm"}, deleted)
+	// the removed components are dropped from the inventory once their objects are deleted
+	a.Equal([]string{"cluster-objects", "service2"}, recorded)
+	stats := s.outputStats()
+	a.EqualValues(map[string]interface{}{"gone": "removed", "old-svc": "renamed to service2"}, stats["removedComponents"])
+	s.assertErrorLineMatch(regexp.MustCompile(`^delete objects of component old-svc \(renamed to service2\)$`))
+}
+
+func TestApplyComponentRemovalDryRun(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setRemovedComponents(s)
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc-dry-run", "-o", "table")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^service2\s+ConfigMap\s+bar-system\s+extra-cm\s+delete$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^gone\s+Secret\s+bar-system\s+gone-secret\s+component-removed$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^old-svc\s+ConfigMap\s+bar-system\s+old-cm\s+component-removed$`))
+}
+
+func TestDiffComponentRemoval(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setRemovedComponents(s)
+	err := s.executeCommand("diff", "dev")
+	require.NotNil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^component gone removed, 1 live object\(s\) would be deleted$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^component old-svc renamed to service2, 1 live object\(s\) would be deleted$`))
+	stats := s.outputStats()
+	assert.EqualValues(t, map[string]interface{}{"gone": "removed", "old-svc": "renamed to service2"}, stats["removedComponents"])
+}
+
+func TestComponentRemovalInventory(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setRemovedComponents(s)
+	// service1 is part of the app but excluded for dev, and never-recorded was not applied by a version of qbec that
+	// records the inventory
+	extras := []model.K8sQbecMeta{
+		componentObject("service1", "ConfigMap", "bar-system", "svc1-cm"),
+		componentObject("never-recorded", "ConfigMap", "bar-system", "unknown-cm"),
+		componentObject("gone", "Secret", "bar-system", "gone-secret"),
+	}
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		return extras, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc-dry-run", "-o", "table")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^service1\s+ConfigMap\s+bar-system\s+svc1-cm\s+delete$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^never-recorded\s+ConfigMap\s+bar-system\s+unknown-cm\s+delete$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^gone\s+Secret\s+bar-system\s+gone-secret\s+component-removed$`))
+}
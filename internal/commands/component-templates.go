@@ -0,0 +1,309 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultComponentTemplate is the template of components that are added without one.
+const defaultComponentTemplate = "deployment"
+
+// componentTemplateDirsEnv is the environment variable with the list of template directories used when no
+// directories are supplied, such that an organization can share its templates across apps.
+const componentTemplateDirsEnv = "QBEC_TEMPLATE_DIRS"
+
+// componentPart is a part of a component template, with the template of the objects that it adds to the list of
+// objects of the component and the template of the default params that they read, one jsonnet field per line.
+type componentPart struct {
+	objects string
+	params  string
+}
+
+// builtinParts are the parts of component templates that are available without any template directory. Parts are
+// combined with a +, for example deployment+service+hpa.
+var builtinParts = map[string]componentPart{
+	"deployment": {
+		objects: `  {
+    apiVersion: 'apps/v1',
+    kind: 'Deployment',
+    metadata: {
+      name: '{{.Name}}',
+      labels: {
+        app: '{{.Name}}',
+      },
+    },
+    spec: {
+{{- if not .Parts.hpa}}
+      replicas: params.replicas,
+{{- end}}
+      selector: {
+        matchLabels: {
+          app: '{{.Name}}',
+        },
+      },
+      template: {
+        metadata: {
+          labels: {
+            app: '{{.Name}}',
+          },
+        },
+        spec: {
+          containers: [
+            {
+              name: 'main',
+              image: params.image,
+{{- if .Parts.service}}
+              ports: [
+                {
+                  containerPort: params.port,
+                },
+              ],
+{{- end}}
+{{- if .Parts.configmap}}
+              envFrom: [
+                {
+                  configMapRef: {
+                    name: '{{.Name}}',
+                  },
+                },
+              ],
+{{- end}}
+            },
+          ],
+        },
+      },
+    },
+  },
+`,
+		params: `image: 'nginx:stable',
+{{- if not .Parts.hpa}}
+replicas: 1,
+{{- end}}
+`,
+	},
+	"service": {
+		objects: `  {
+    apiVersion: 'v1',
+    kind: 'Service',
+    metadata: {
+      name: '{{.Name}}',
+      labels: {
+        app: '{{.Name}}',
+      },
+    },
+    spec: {
+      selector: {
+        app: '{{.Name}}',
+      },
+      ports: [
+        {
+          port: params.port,
+          targetPort: params.port,
+        },
+      ],
+    },
+  },
+`,
+		params: "port: 80,\n",
+	},
+	"hpa": {
+		objects: `  {
+    apiVersion: 'autoscaling/v2',
+    kind: 'HorizontalPodAutoscaler',
+    metadata: {
+      name: '{{.Name}}',
+      labels: {
+        app: '{{.Name}}',
+      },
+    },
+    spec: {
+      scaleTargetRef: {
+        apiVersion: 'apps/v1',
+        kind: 'Deployment',
+        name: '{{.Name}}',
+      },
+      minReplicas: params.minReplicas,
+      maxReplicas: params.maxReplicas,
+      metrics: [
+        {
+          type: 'Resource',
+          resource: {
+            name: 'cpu',
+            target: {
+              type: 'Utilization',
+              averageUtilization: params.cpuUtilization,
+            },
+          },
+        },
+      ],
+    },
+  },
+`,
+		params: "minReplicas: 1,\nmaxReplicas: 3,\ncpuUtilization: 80,\n",
+	},
+	"configmap": {
+		objects: `  {
+    apiVersion: 'v1',
+    kind: 'ConfigMap',
+    metadata: {
+      name: '{{.Name}}',
+      labels: {
+        app: '{{.Name}}',
+      },
+    },
+    data: params.config,
+  },
+`,
+		params: "config: {},\n",
+	},
+}
+
+// componentHeader is the start of every component file, which reads the params of the component.
+const componentHeader = `
+local p = import '{{.ParamsFile}}';
+local params = p.components{{if .Quoted}}['{{.Name}}']{{else}}.{{.Name}}{{end}};
+
+[
+`
+
+// componentTemplateData is the data that component templates are expanded with.
+type componentTemplateData struct {
+	Name       string          // name of the component
+	ParamsFile string          // path of the params file relative to the component file
+	Quoted     bool            // true if the name of the component must be quoted as a jsonnet field
+	Parts      map[string]bool // the parts of the template of the component
+}
+
+// loadComponentPart returns the supplied part of a component template from the first of the supplied directories
+// that has it, or the built-in part with that name. A part in a directory is a file named after the part with a
+// .jsonnet extension, and an optional file with its default params with a .params extension.
+func loadComponentPart(name string, dirs []string) (componentPart, bool, error) {
+	for _, dir := range dirs {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name+".jsonnet"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return componentPart{}, false, err
+		}
+		p, err := ioutil.ReadFile(filepath.Join(dir, name+".params"))
+		if err != nil && !os.IsNotExist(err) {
+			return componentPart{}, false, err
+		}
+		return componentPart{objects: string(b), params: string(p)}, true, nil
+	}
+	p, ok := builtinParts[name]
+	return p, ok, nil
+}
+
+// componentTemplateNames returns the sorted names of the built-in parts and those of the supplied directories.
+func componentTemplateNames(dirs []string) []string {
+	seen := map[string]bool{}
+	for name := range builtinParts {
+		seen[name] = true
+	}
+	for _, dir := range dirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.jsonnet"))
+		for _, f := range files {
+			seen[strings.TrimSuffix(filepath.Base(f), ".jsonnet")] = true
+		}
+	}
+	var ret []string
+	for name := range seen {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// expandComponentTemplate returns the contents of the file of a component and its default params as jsonnet fields
+// for the supplied template, which is a list of parts separated by a +.
+func expandComponentTemplate(spec string, dirs []string, data componentTemplateData) ([]byte, []string, error) {
+	names := strings.Split(spec, "+")
+	data.Parts = map[string]bool{}
+	var parts []componentPart
+	for _, name := range names {
+		if data.Parts[name] {
+			return nil, nil, newUsageError(fmt.Sprintf("duplicate part %q in component template %s", name, spec))
+		}
+		p, ok, err := loadComponentPart(name, dirs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return nil, nil, newUsageError(fmt.Sprintf("unknown component template part %q, available: %s", name, strings.Join(componentTemplateNames(dirs), ", ")))
+		}
+		data.Parts[name] = true
+		parts = append(parts, p)
+	}
+	expand := func(name, text string) (string, error) {
+		t, err := template.New(name).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("component template %s: %v", spec, err)
+		}
+		var w bytes.Buffer
+		if err := t.Execute(&w, data); err != nil {
+			return "", fmt.Errorf("component template %s: %v", spec, err)
+		}
+		return w.String(), nil
+	}
+	text := componentHeader
+	var params []string
+	seen := map[string]bool{}
+	for i, p := range parts {
+		text += p.objects
+		fields, err := expand(names[i]+".params", p.params)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, f := range strings.Split(fields, "\n") {
+			f = strings.TrimSpace(f)
+			if f != "" && !seen[f] {
+				seen[f] = true
+				params = append(params, f)
+			}
+		}
+	}
+	out, err := expand("component", text+"]\n")
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(out), params, nil
+}
+
+func newNewCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "new <subcommand>",
+		Short: "create parts of an app from templates",
+	}
+	c := newComponentAddCommand(op)
+	c.Use = "component <component> [--template <part>+<part>...] [--env <environment>]..."
+	c.Short = "add a jsonnet component from a template of parts, with default parameters"
+	c.Example = newComponentExamples()
+	cmd.AddCommand(c)
+	return cmd
+}
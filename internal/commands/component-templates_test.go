@@ -0,0 +1,96 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewComponentFromTemplate(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("new", "component", "web-service", "--template", "deployment+service+hpa")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote components/web-service.jsonnet`))
+	b, err := ioutil.ReadFile("components/web-service.jsonnet")
+	require.Nil(t, err)
+	code := string(b)
+	a.Contains(code, "local params = p.components['web-service'];\n")
+	a.Contains(code, "kind: 'HorizontalPodAutoscaler'")
+	a.Contains(code, "containerPort: params.port")
+	a.NotContains(code, "replicas: params.replicas")
+	b, err = ioutil.ReadFile("environments/base.libsonnet")
+	require.Nil(t, err)
+	a.Contains(string(b), "        'web-service': {\n            image: 'nginx:stable',\n            port: 80,\n"+
+		"            minReplicas: 1,\n            maxReplicas: 3,\n            cpuUtilization: 80,\n        },\n")
+
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+	err = s.executeCommand("show", "prod", "-c", "web-service", "-O")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^web-service\s+Deployment\s+web-service`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^web-service\s+Service\s+web-service`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^web-service\s+HorizontalPodAutoscaler\s+web-service`))
+}
+
+func TestNewComponentFromTemplateDir(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	require.Nil(t, os.Mkdir("templates", 0755))
+	worker := "  {\n    apiVersion: 'batch/v1',\n    kind: 'CronJob',\n    metadata: { name: '{{.Name}}' },\n" +
+		"    spec: { schedule: params.schedule{{if .Parts.configmap}}, configMap: '{{.Name}}'{{end}} },\n  },\n"
+	require.Nil(t, ioutil.WriteFile("templates/worker.jsonnet", []byte(worker), 0644))
+	require.Nil(t, ioutil.WriteFile("templates/worker.params", []byte("schedule: '@daily',\n"), 0644))
+
+	err := s.executeCommand("new", "component", "worker", "--template-dir", "templates", "--template", "worker+configmap")
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile("components/worker.jsonnet")
+	require.Nil(t, err)
+	a.Contains(string(b), "spec: { schedule: params.schedule, configMap: 'worker' },")
+	a.Contains(string(b), "data: params.config,")
+	b, err = ioutil.ReadFile("environments/base.libsonnet")
+	require.Nil(t, err)
+	a.Contains(string(b), "        worker: {\n            schedule: '@daily',\n            config: {},\n        },\n")
+
+	err = s.executeCommand("new", "component", "billing", "--template", "deployment+cron")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal(`unknown component template part "cron", available: configmap, deployment, hpa, service, worker`, err.Error())
+	_, err = os.Stat("components/billing.jsonnet")
+	a.True(os.IsNotExist(err))
+
+	err = s.executeCommand("new", "component", "billing", "--template", "service+service")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal(`duplicate part "service" in component template service+service`, err.Error())
+}
@@ -21,19 +21,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/diff"
 	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func newComponentCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "component <subcommand>",
-		Short: "component lists and diffs",
+		Short: "component lists, diffs and edits",
 	}
-	cmd.AddCommand(newComponentListCommand(op), newComponentDiffCommand(op))
+	cmd.AddCommand(newComponentListCommand(op), newComponentDiffCommand(op),
+		newComponentAddCommand(op), newComponentToggleCommand(op, true), newComponentToggleCommand(op, false))
 	return cmd
 }
 
@@ -58,6 +63,20 @@ func listComponents(components []model.Component, formatSpecified bool, format s
 		encoder := json.NewEncoder(w)
 		encoder.SetIndent("", "  ")
 		return encoder.Encode(components)
+	case "wide":
+		format := "%-30s %-40s %-20s %-20s %-20s %s"
+		row := func(cols ...interface{}) {
+			fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf(format, cols...), " "))
+		}
+		row("COMPONENT", "FILE", "NAMESPACE", "OWNERS", "TAGS", "DESCRIPTION")
+		for _, c := range components {
+			d := c.Descriptor
+			if d == nil {
+				d = &model.ComponentDescriptorSpec{}
+			}
+			row(c.Name, c.File, d.Namespace, strings.Join(d.Owners, ","), strings.Join(d.Tags, ","), d.Description)
+		}
+		return nil
 	default:
 		return newUsageError(fmt.Sprintf("listComponents: unsupported format %q", format))
 	}
@@ -67,6 +86,7 @@ type componentListCommandConfig struct {
 	StdOptions
 	format  string
 	objects bool
+	tags    []string
 }
 
 func doComponentList(args []string, config componentListCommandConfig) error {
@@ -81,7 +101,14 @@ func doComponentList(args []string, config componentListCommandConfig) error {
 		}
 		return showNames(objects, config.format != "", config.format, config.Stdout())
 	}
-	components, err := config.App().ComponentsForEnvironment(env, nil, nil)
+	var includes []string
+	if len(config.tags) > 0 {
+		var err error
+		if includes, err = componentsWithTags(config.App(), config.tags, nil, nil); err != nil {
+			return err
+		}
+	}
+	components, err := config.App().ComponentsForEnvironment(env, includes, nil)
 	if err != nil {
 		return err
 	}
@@ -97,7 +124,8 @@ func newComponentListCommand(op OptionsProvider) *cobra.Command {
 
 	config := componentListCommandConfig{}
 	cmd.Flags().BoolVarP(&config.objects, "objects", "O", false, "set to true to also list objects in each component")
-	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable input")
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable input, or wide to also show descriptors")
+	cmd.Flags().StringArrayVar(&config.tags, "component-tag", nil, "list just the components with this tag in their descriptors")
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
@@ -108,7 +136,110 @@ func newComponentListCommand(op OptionsProvider) *cobra.Command {
 
 type componentDiffCommandConfig struct {
 	StdOptions
-	objects bool
+	objects     bool
+	showSecrets bool
+}
+
+// localDisplayName returns a display name for the supplied local object in the format used for server objects,
+// without the server metadata to tell whether its kind is namespaced.
+func localDisplayName(o model.K8sMeta) string {
+	name := strings.ToLower(o.GetObjectKind().GroupVersionKind().Kind) + " " + o.GetName()
+	if ns := o.GetNamespace(); ns != "" {
+		name += " -n " + ns
+	}
+	return name
+}
+
+// doComponentObjectDiff renders the supplied component for two environments and shows the differences between its
+// objects. Objects in the default namespaces of the environments are matched regardless of the names of those
+// namespaces, and labels that qbec sets for every environment are ignored.
+func doComponentObjectDiff(component, leftEnv, rightEnv string, config componentDiffCommandConfig) error {
+	if _, ok := config.App().Component(component); !ok {
+		return newUsageError(fmt.Sprintf("invalid component %q", component))
+	}
+	if leftEnv == rightEnv {
+		return newUsageError("cannot diff an environment with itself")
+	}
+	if config.objects {
+		return newUsageError("cannot list objects when diffing a component")
+	}
+	render := func(env string) (map[string]*unstructured.Unstructured, map[string]string, error) {
+		objects, err := filteredObjects(config, env, filterParams{includes: []string{component}})
+		if err != nil {
+			return nil, nil, err
+		}
+		defaultNs := config.DefaultNamespace(env)
+		ret, names := map[string]*unstructured.Unstructured{}, map[string]string{}
+		for _, o := range objects {
+			k := liveKey(o, defaultNs)
+			u := normalizeLive(o.ToUnstructured(), defaultNs)
+			if !config.showSecrets {
+				u, _ = model.HideSensitiveInfo(u)
+			}
+			ret[k], names[k] = u, localDisplayName(o)
+		}
+		return ret, names, nil
+	}
+	left, leftNames, err := render(leftEnv)
+	if err != nil {
+		return err
+	}
+	right, rightNames, err := render(rightEnv)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for k := range left {
+		keys = append(keys, k)
+	}
+	for k := range right {
+		if _, ok := left[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	opts := diff.Options{Context: -1, Colorize: config.Colorize()}
+	stats := compareStats{Missing: map[string][]string{}}
+	w := config.Stdout()
+	for _, k := range keys {
+		lo, inLeft := left[k]
+		ro, inRight := right[k]
+		switch {
+		case !inRight:
+			stats.Missing[rightEnv] = append(stats.Missing[rightEnv], leftNames[k])
+			fmt.Fprintf(w, "%s: only exists in %s\n", leftNames[k], leftEnv)
+			continue
+		case !inLeft:
+			stats.Missing[leftEnv] = append(stats.Missing[leftEnv], rightNames[k])
+			fmt.Fprintf(w, "%s: only exists in %s\n", rightNames[k], rightEnv)
+			continue
+		}
+		fileOpts := opts
+		fileOpts.LeftName = leftEnv + " " + leftNames[k]
+		fileOpts.RightName = rightEnv + " " + rightNames[k]
+		b, err := diff.Objects(lo, ro, fileOpts)
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 {
+			if config.Verbosity() > 0 {
+				fmt.Fprintf(w, "%s unchanged\n", leftNames[k])
+			}
+			stats.SameCount++
+			continue
+		}
+		fmt.Fprintln(w, string(b))
+		stats.Different = append(stats.Different, leftNames[k])
+	}
+	printStats(w, &stats)
+
+	numDiffs := len(stats.Different) + len(stats.Missing[leftEnv]) + len(stats.Missing[rightEnv])
+	if numDiffs > 0 {
+		return fmt.Errorf("%d object(s) of component %s different between %s and %s", numDiffs, component, leftEnv, rightEnv)
+	}
+	sio.Noticef("objects of component %s are the same for %s and %s\n", component, leftEnv, rightEnv)
+	return nil
 }
 
 func doComponentDiff(args []string, config componentDiffCommandConfig) error {
@@ -120,8 +251,10 @@ func doComponentDiff(args []string, config componentDiffCommandConfig) error {
 	case 2:
 		leftEnv = args[0]
 		rightEnv = args[1]
+	case 3:
+		return doComponentObjectDiff(args[0], args[1], args[2], config)
 	default:
-		return newUsageError("one or two environments required")
+		return newUsageError("one or two environments, or a component and two environments, required")
 	}
 
 	getComponents := func(env string) (str string, name string, err error) {
@@ -191,13 +324,14 @@ func doComponentDiff(args []string, config componentDiffCommandConfig) error {
 
 func newComponentDiffCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "diff [-objects] <environment>|_ [<environment>|_]",
-		Short:   "diff component lists across two environments or between the baseline (use _ for baseline) and an environment",
+		Use:     "diff [-objects] <environment>|_ [<environment>|_] | <component> <environment>|_ <environment>|_",
+		Short:   "diff component lists across two environments or between the baseline (use _ for baseline) and an environment, or the objects of a component across two environments",
 		Example: componentDiffExamples(),
 	}
 
 	config := componentDiffCommandConfig{}
 	cmd.Flags().BoolVarP(&config.objects, "objects", "O", false, "set to true to also list objects in each component")
+	cmd.Flags().BoolVarP(&config.showSecrets, "show-secrets", "S", false, "do not obfuscate secret values when diffing the objects of a component")
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
@@ -17,10 +17,12 @@
 package commands
 
 import (
+	"io/ioutil"
 	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/splunk/qbec/internal/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -109,6 +111,40 @@ func TestComponentDiffObjects(t *testing.T) {
 	s.assertOutputLineMatch(regexp.MustCompile(`-service1\s+ConfigMap\s+svc1-cm\s+foo-system`))
 }
 
+func TestComponentDiffObjectsAcrossEnvs(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("component", "diff", "service2", "dev", "prod")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`objects of component service2 are the same for dev and prod`))
+
+	code := `local objects = import 'objects.libsonnet';
+
+{
+    configMap: objects.configmap('bar-system','svc2-cm', { foo : std.extVar('qbec.io/env') }),
+    secret: objects.secret('bar-system','svc2-secret', { foo : std.base64('bar') }),
+}
+`
+	require.Nil(t, ioutil.WriteFile("components/service2.jsonnet", []byte(code), 0644))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+	s.outCapture.Reset()
+	err = s.executeCommand("component", "diff", "service2", "dev", "prod")
+	require.NotNil(t, err)
+	a.False(isUsageError(err))
+	a.Equal("1 object(s) of component service2 different between dev and prod", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`--- dev configmap svc2-cm -n bar-system`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\+\+\+ prod configmap svc2-cm -n bar-system`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^-\s+foo: dev$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^\+\s+foo: prod$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`same: 1`))
+}
+
 func TestComponentNegative(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -157,7 +193,7 @@ func TestComponentNegative(t *testing.T) {
 			asserter: func(s *scaffold, err error) {
 				a := assert.New(s.t)
 				a.True(isUsageError(err))
-				a.Equal(`one or two environments required`, err.Error())
+				a.Equal(`one or two environments, or a component and two environments, required`, err.Error())
 			},
 		},
 		{
@@ -166,7 +202,34 @@ func TestComponentNegative(t *testing.T) {
 			asserter: func(s *scaffold, err error) {
 				a := assert.New(s.t)
 				a.True(isUsageError(err))
-				a.Equal(`one or two environments required`, err.Error())
+				a.Equal(`invalid component "dev"`, err.Error())
+			},
+		},
+		{
+			name: "diff 4 args",
+			args: []string{"component", "diff", "service2", "dev", "prod", "_"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`one or two environments, or a component and two environments, required`, err.Error())
+			},
+		},
+		{
+			name: "diff component same env",
+			args: []string{"component", "diff", "service2", "dev", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot diff an environment with itself`, err.Error())
+			},
+		},
+		{
+			name: "diff component objects",
+			args: []string{"component", "diff", "service2", "dev", "prod", "-O"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot list objects when diffing a component`, err.Error())
 			},
 		},
 		{
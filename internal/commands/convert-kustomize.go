@@ -0,0 +1,485 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// manualKustomizeFields are kustomization fields whose effects are not converted into qbec constructs.
+var manualKustomizeFields = map[string]string{
+	"namePrefix":         "names are prefixed in kustomize but components use the base names",
+	"nameSuffix":         "names are suffixed in kustomize but components use the base names",
+	"configMapGenerator": "generated config map names have content hashes in kustomize but are static in components",
+	"secretGenerator":    "generated secret names have content hashes in kustomize but are static in components",
+	"vars":               "variable substitutions are rendered as static values",
+	"replacements":       "replacements are rendered as static values",
+	"transformers":       "custom transformers are rendered as static values",
+	"generators":         "custom generators are rendered as static objects",
+	"helmCharts":         "inflated helm charts are rendered as static objects",
+	"components":         "kustomize components are rendered as static values",
+}
+
+type convertKustomizeCommandConfig struct {
+	appName     string                               // name of the app to create
+	env         string                               // environment name when the directory has no overlays
+	kustomize   func(args ...string) (string, error) // runs kustomize with the supplied arguments
+	contextInfo func() (*remote.ContextInfo, error)  // returns information on the current kube context
+}
+
+func runKustomize(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kustomize", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("kustomize %s: %v\n%s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// kustomization is a kustomization file and the directory it was found in.
+type kustomization struct {
+	dir  string
+	data map[string]interface{}
+}
+
+// loadKustomization loads the kustomization in the supplied directory, returning nil if there isn't one.
+func loadKustomization(dir string) (*kustomization, error) {
+	for _, f := range kustomizationFiles {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		var data map[string]interface{}
+		if err := yaml.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", filepath.Join(dir, f), err)
+		}
+		return &kustomization{dir: dir, data: data}, nil
+	}
+	return nil, nil
+}
+
+func (k *kustomization) stringValue(field string) string {
+	s, _ := k.data[field].(string)
+	return s
+}
+
+// resourceDirs returns the local directories listed as resources or bases of the kustomization. Remote resources
+// and files are ignored.
+func (k *kustomization) resourceDirs() []string {
+	var ret []string
+	for _, field := range []string{"resources", "bases"} {
+		list, _ := k.data[field].([]interface{})
+		for _, r := range list {
+			s, _ := r.(string)
+			if s == "" || strings.Contains(s, "://") {
+				continue
+			}
+			dir := filepath.Join(k.dir, s)
+			if st, err := os.Stat(dir); err == nil && st.IsDir() {
+				ret = append(ret, dir)
+			}
+		}
+	}
+	return ret
+}
+
+// manualFields returns report entries for fields of the kustomization that need manual attention.
+func (k *kustomization) manualFields() []string {
+	var ret []string
+	for field, reason := range manualKustomizeFields {
+		if _, ok := k.data[field]; ok {
+			ret = append(ret, fmt.Sprintf("%s: %s, %s", k.dir, field, reason))
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// kustomizeOverlays returns the overlays for the supplied directory keyed by environment name. Overlays are
+// directories under an overlays directory that have kustomizations. When there are none, the directory itself is
+// the only overlay for the supplied environment.
+func kustomizeOverlays(dir string, env string) (map[string]*kustomization, error) {
+	ret := map[string]*kustomization{}
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "overlays"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		k, err := loadKustomization(filepath.Join(dir, "overlays", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if k != nil {
+			ret[e.Name()] = k
+		}
+	}
+	if len(ret) > 0 {
+		return ret, nil
+	}
+	k, err := loadKustomization(dir)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, fmt.Errorf("no kustomization found in %s or its overlays", dir)
+	}
+	ret[env] = k
+	return ret, nil
+}
+
+// kustomizeBuild returns the objects produced by building the supplied directory.
+func kustomizeBuild(dir string, kustomize func(args ...string) (string, error)) ([]map[string]interface{}, error) {
+	out, err := kustomize("build", dir)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := parseHelmManifest(out)
+	if err != nil {
+		return nil, err
+	}
+	var ret []map[string]interface{}
+	for _, o := range objects {
+		ret = append(ret, o.data)
+	}
+	return ret, nil
+}
+
+func objectName(obj map[string]interface{}) string {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	name, _ := meta["name"].(string)
+	return name
+}
+
+// objectKey returns a key for the supplied object with the supplied name prefix and suffix removed.
+func objectKey(obj map[string]interface{}, prefix, suffix string) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(objectName(obj), prefix), suffix)
+	return fmt.Sprintf("%v %s", obj["kind"], name)
+}
+
+// deepCopyJSON returns a deep copy of an object decoded from JSON, for which the round trip cannot fail.
+func deepCopyJSON(obj map[string]interface{}) map[string]interface{} {
+	b, _ := json.Marshal(obj)
+	var ret map[string]interface{}
+	_ = json.Unmarshal(b, &ret)
+	return ret
+}
+
+// extractedParams returns the parameters extracted from a copy of the supplied object along with the copy.
+func extractedParams(obj map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	ex := newParamExtractor()
+	c := deepCopyJSON(obj)
+	ex.extract(c)
+	// replace placeholders with references that do not depend on the order of extraction
+	var replace func(v interface{}) interface{}
+	replace = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, child := range t {
+				t[k] = replace(child)
+			}
+		case []interface{}:
+			for i, child := range t {
+				t[i] = replace(child)
+			}
+		case string:
+			if ref, ok := ex.refs[t]; ok {
+				return ref
+			}
+		}
+		return v
+	}
+	replace(c)
+	return ex.params, c
+}
+
+// overrides returns the leaf values of the right map that are different from the ones in the left map.
+func overrides(left, right map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, r := range right {
+		rm, rok := r.(map[string]interface{})
+		lm, lok := left[k].(map[string]interface{})
+		switch {
+		case rok && lok:
+			if o := overrides(lm, rm); len(o) > 0 {
+				ret[k] = o
+			}
+		case !reflect.DeepEqual(left[k], r):
+			ret[k] = r
+		}
+	}
+	return ret
+}
+
+// diffPaths returns the paths of fields that are different between the supplied values.
+func diffPaths(left, right interface{}, path string) []string {
+	lm, lok := left.(map[string]interface{})
+	rm, rok := right.(map[string]interface{})
+	if !lok || !rok {
+		if reflect.DeepEqual(left, right) {
+			return nil
+		}
+		return []string{path}
+	}
+	keys := map[string]bool{}
+	for k := range lm {
+		keys[k] = true
+	}
+	for k := range rm {
+		keys[k] = true
+	}
+	var ret []string
+	for k := range keys {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		ret = append(ret, diffPaths(lm[k], rm[k], p)...)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// uniqueComponentName returns a component name for the supplied base directory that is not already taken.
+func uniqueComponentName(root, dir string, taken map[string]bool) string {
+	name := strings.Trim(invalidChars.ReplaceAllString(filepath.Base(dir), "-"), "-")
+	if taken[name] {
+		if rel, err := filepath.Rel(root, dir); err == nil {
+			name = strings.Trim(invalidChars.ReplaceAllString(rel, "-"), "-")
+		}
+	}
+	return name
+}
+
+func doConvertKustomize(args []string, config convertKustomizeCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("a single kustomize directory must be supplied")
+	}
+	if config.env == "" || config.env == model.Baseline {
+		return newUsageError(fmt.Sprintf("invalid environment name %q", config.env))
+	}
+	root, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	overlays, err := kustomizeOverlays(root, config.env)
+	if err != nil {
+		return err
+	}
+	appName := config.appName
+	if appName == "" {
+		appName = filepath.Base(root)
+	}
+	if abs, err := filepath.Abs(appName); err == nil && abs == root {
+		return newUsageError(fmt.Sprintf("app directory %s would be the kustomize directory, use --app-name to specify a different one", appName))
+	}
+	if err := ensureNewAppDir(appName); err != nil {
+		return err
+	}
+	var envs []string
+	for env := range overlays {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	// every local directory referenced by an overlay is a base that becomes a component
+	var report []string
+	baseNames := map[string]string{}
+	taken := map[string]bool{}
+	envBases := map[string]map[string]bool{}
+	for _, env := range envs {
+		k := overlays[env]
+		report = append(report, k.manualFields()...)
+		envBases[env] = map[string]bool{}
+		for _, dir := range k.resourceDirs() {
+			if _, ok := baseNames[dir]; !ok {
+				name := uniqueComponentName(root, dir, taken)
+				taken[name] = true
+				baseNames[dir] = name
+			}
+			envBases[env][baseNames[dir]] = true
+		}
+	}
+	var baseDirs []string
+	for dir := range baseNames {
+		baseDirs = append(baseDirs, dir)
+	}
+	sort.Strings(baseDirs)
+
+	ctx := currentContext(config.contextInfo)
+	sio.Noticef("using server URL %q for all environments\n", ctx.ServerURL)
+	app := newApp(appName)
+	converted := newConvertedApp("kustomize", app)
+
+	type baseObject struct {
+		name      string
+		component string
+		params    map[string]interface{}
+		data      map[string]interface{}
+	}
+	baseObjects := map[string]*baseObject{}
+	var componentNames []string
+	for _, dir := range baseDirs {
+		name := baseNames[dir]
+		componentNames = append(componentNames, name)
+		k, err := loadKustomization(dir)
+		if err != nil {
+			return err
+		}
+		if k != nil {
+			report = append(report, k.manualFields()...)
+		}
+		objects, err := kustomizeBuild(dir, config.kustomize)
+		if err != nil {
+			return err
+		}
+		ex := newParamExtractor()
+		var list []interface{}
+		for _, o := range objects {
+			params, data := extractedParams(o)
+			baseObjects[objectKey(o, "", "")] = &baseObject{name: objectName(o), component: name, params: params, data: data}
+			ex.extract(o)
+			list = append(list, o)
+		}
+		if err := converted.addComponent(name, list, ex); err != nil {
+			return err
+		}
+	}
+
+	total := 0
+	for _, env := range envs {
+		k := overlays[env]
+		objects, err := kustomizeBuild(k.dir, config.kustomize)
+		if err != nil {
+			return err
+		}
+		total += len(objects)
+		ns := k.stringValue("namespace")
+		if ns == "" {
+			ns = ctx.Namespace
+		}
+		prefix, suffix := k.stringValue("namePrefix"), k.stringValue("nameSuffix")
+		envParams := map[string]interface{}{}
+		seen := map[string]bool{}
+		var extra []interface{}
+		for _, o := range objects {
+			if meta, ok := o["metadata"].(map[string]interface{}); ok && meta["namespace"] == ns {
+				delete(meta, "namespace")
+			}
+			key := objectKey(o, prefix, suffix)
+			base, ok := baseObjects[key]
+			if !ok {
+				extra = append(extra, o)
+				continue
+			}
+			seen[key] = true
+			params, data := extractedParams(o)
+			// parameters are keyed by object names which may have been changed by the overlay
+			if v, ok := params[objectName(o)]; ok {
+				params = map[string]interface{}{base.name: v}
+			}
+			if o := overrides(base.params, params); len(o) > 0 {
+				cp, _ := envParams[base.component].(map[string]interface{})
+				if cp == nil {
+					cp = map[string]interface{}{}
+					envParams[base.component] = cp
+				}
+				for k, v := range o {
+					cp[k] = v
+				}
+			}
+			if paths := diffPaths(base.data, data, ""); len(paths) > 0 {
+				report = append(report, fmt.Sprintf("overlay %s: %s differs from component %s in %s", env, key, base.component, strings.Join(paths, ", ")))
+			}
+		}
+		var keys []string
+		for key, base := range baseObjects {
+			if envBases[env][base.component] && !seen[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			report = append(report, fmt.Sprintf("overlay %s: %s from component %s is not produced by the overlay", env, key, baseObjects[key].component))
+		}
+
+		environment := model.Environment{Server: ctx.ServerURL, DefaultNamespace: ns}
+		// objects that only exist in the overlay are in a component only included for its environment
+		if len(extra) > 0 {
+			name := strings.Trim(invalidChars.ReplaceAllString(env, "-"), "-") + "-resources"
+			if err := converted.addComponent(name, extra, newParamExtractor()); err != nil {
+				return err
+			}
+			converted.app.Spec.Excludes = append(converted.app.Spec.Excludes, name)
+			environment.Includes = []string{name}
+		}
+		for _, c := range componentNames {
+			if !envBases[env][c] {
+				environment.Excludes = append(environment.Excludes, c)
+			}
+		}
+		converted.app.Spec.Environments[env] = environment
+		converted.envParams[env] = envParams
+	}
+	converted.report = report
+	if err := converted.write(); err != nil {
+		return err
+	}
+	sio.Noticef("converted %d overlays with %d objects into %d components\n", len(envs), total, len(converted.components))
+	return nil
+}
+
+func newConvertKustomizeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "kustomize <dir>",
+		Short:   "create a qbec app from kustomize bases and overlays",
+		Example: convertKustomizeExamples(),
+	}
+
+	config := convertKustomizeCommandConfig{kustomize: runKustomize, contextInfo: remote.CurrentContextInfo}
+	cmd.Flags().StringVar(&config.appName, "app-name", "", "name of the app to create, defaults to the name of the directory")
+	cmd.Flags().StringVar(&config.env, "env", "default", "name of the environment to create when the directory does not have overlays")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		return wrapError(doConvertKustomize(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,221 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/splunk/qbec/internal/eval"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var baseBuild = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: main
+          image: nginx:1.0
+`
+
+var devBuild = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: web-dev
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: web-dev
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: main
+          image: nginx:1.1
+`
+
+var prodBuild = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: prod-web
+  namespace: web-prod
+  labels:
+    tier: prod
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prod-web
+  namespace: web-prod
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+        - name: main
+          image: nginx:1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prod-extra
+  namespace: web-prod
+data:
+  foo: bar
+`
+
+func writeKustomizeFile(t *testing.T, file, contents string) {
+	require.Nil(t, os.MkdirAll(filepath.Dir(file), 0755))
+	require.Nil(t, ioutil.WriteFile(file, []byte(contents), 0644))
+}
+
+func TestConvertKustomize(t *testing.T) {
+	defer convertInTempDir(t)()
+	writeKustomizeFile(t, "deploy/base/kustomization.yaml", "resources:\n  - service.yaml\n  - deployment.yaml\n")
+	writeKustomizeFile(t, "deploy/overlays/dev/kustomization.yaml", "namespace: web-dev\nresources:\n  - ../../base\nimages:\n  - name: nginx\n    newTag: '1.1'\n")
+	writeKustomizeFile(t, "deploy/overlays/prod/kustomization.yaml", "namespace: web-prod\nnamePrefix: prod-\nresources:\n  - ../../base\n  - extra.yaml\nconfigMapGenerator:\n  - name: foo\n")
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	builds := map[string]string{
+		filepath.Join(wd, "deploy", "base"):             baseBuild,
+		filepath.Join(wd, "deploy", "overlays", "dev"):  devBuild,
+		filepath.Join(wd, "deploy", "overlays", "prod"): prodBuild,
+	}
+	var built []string
+	err = doConvertKustomize([]string{"deploy"}, convertKustomizeCommandConfig{
+		appName:     "web",
+		env:         "default",
+		contextInfo: contextInfo,
+		kustomize: func(args ...string) (string, error) {
+			built = append(built, args[1])
+			out, ok := builds[args[1]]
+			if !ok {
+				return "", fmt.Errorf("unexpected build %s", args[1])
+			}
+			return out, nil
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 3, len(built))
+
+	require.Nil(t, os.Chdir("web"))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal([]string{"prod-resources"}, app.Spec.Excludes)
+	a.Equal("web-dev", app.Spec.Environments["dev"].DefaultNamespace)
+	a.Equal("web-prod", app.Spec.Environments["prod"].DefaultNamespace)
+	a.Equal([]string{"prod-resources"}, app.Spec.Environments["prod"].Includes)
+
+	objects := func(env string) map[string]map[string]interface{} {
+		components, err := app.ComponentsForEnvironment(env, nil, nil)
+		require.Nil(t, err)
+		objs, err := eval.Components(components, eval.Context{App: "web", Env: env})
+		require.Nil(t, err)
+		ret := map[string]map[string]interface{}{}
+		for _, o := range objs {
+			ret[o.GetKind()+" "+o.GetName()] = o.ToUnstructured().Object
+		}
+		return ret
+	}
+	image := func(obj map[string]interface{}) interface{} {
+		spec := obj["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+		return spec["containers"].([]interface{})[0].(map[string]interface{})["image"]
+	}
+
+	dev := objects("dev")
+	a.Equal(2, len(dev))
+	a.Equal("base", dev["Deployment web"]["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})[model.QbecNames.ComponentAnnotation])
+	a.Equal("nginx:1.1", image(dev["Deployment web"]))
+	a.EqualValues(1, dev["Deployment web"]["spec"].(map[string]interface{})["replicas"])
+
+	prod := objects("prod")
+	a.Equal(3, len(prod))
+	a.Equal("nginx:1.0", image(prod["Deployment web"]))
+	a.EqualValues(5, prod["Deployment web"]["spec"].(map[string]interface{})["replicas"])
+	a.NotNil(prod["ConfigMap prod-extra"])
+
+	b, err := ioutil.ReadFile("conversion-report.md")
+	require.Nil(t, err)
+	report := string(b)
+	a.Contains(report, "overlays/prod: configMapGenerator, generated config map names have content hashes")
+	a.Contains(report, "overlays/prod: namePrefix, names are prefixed in kustomize")
+	a.Contains(report, "overlay prod: Service web differs from component base in metadata.labels, metadata.name")
+	a.Contains(report, "overlay prod: Deployment web differs from component base in metadata.name")
+	a.NotContains(report, "overlay dev")
+}
+
+func TestConvertKustomizeNegative(t *testing.T) {
+	defer convertInTempDir(t)()
+	writeKustomizeFile(t, "empty/README.md", "nothing here")
+	writeKustomizeFile(t, "bad/kustomization.yaml", "resources: [foo\n")
+	writeKustomizeFile(t, "exists/kustomization.yaml", "resources: []\n")
+	writeKustomizeFile(t, "same/kustomization.yaml", "resources: []\n")
+	require.Nil(t, os.Mkdir("taken", 0755))
+	tests := []struct {
+		name   string
+		args   []string
+		config convertKustomizeCommandConfig
+		msg    string
+	}{
+		{name: "no-args", config: convertKustomizeCommandConfig{env: "default"}, msg: "a single kustomize directory must be supplied"},
+		{name: "baseline-env", args: []string{"empty"}, config: convertKustomizeCommandConfig{env: "_"}, msg: `invalid environment name "_"`},
+		{name: "no-kustomization", args: []string{"empty"}, config: convertKustomizeCommandConfig{env: "default"}, msg: "no kustomization found in"},
+		{name: "bad-kustomization", args: []string{"bad"}, config: convertKustomizeCommandConfig{env: "default"}, msg: "parse "},
+		{name: "app-is-source", args: []string{"same"}, config: convertKustomizeCommandConfig{env: "default"}, msg: "app directory same would be the kustomize directory"},
+		{name: "app-exists", args: []string{"exists"}, config: convertKustomizeCommandConfig{env: "default", appName: "taken"}, msg: "directory taken already exists"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.contextInfo = contextInfo
+			err := doConvertKustomize(test.args, test.config)
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.msg)
+		})
+	}
+}
@@ -0,0 +1,551 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// helmLabels are labels set by helm that no longer apply once objects are managed by qbec.
+var helmLabels = []string{"heritage", "helm.sh/chart", "app.kubernetes.io/managed-by"}
+
+var (
+	docSeparator  = regexp.MustCompile(`(?m)^---\s*$`)
+	sourceComment = regexp.MustCompile(`(?m)^# Source: (\S+)\s*$`)
+	invalidChars  = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+)
+
+func newConvertCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert <subcommand>",
+		Short: "convert applications managed by other tools to qbec apps",
+	}
+	cmd.AddCommand(newConvertHelmCommand(), newConvertKustomizeCommand())
+	return cmd
+}
+
+type convertHelmCommandConfig struct {
+	appName     string                               // name of the app to create
+	releaseName string                               // release name used to render charts
+	namespace   string                               // namespace of the release
+	env         string                               // name of the environment to create
+	valueFiles  []string                             // value files used to render charts
+	setValues   []string                             // value overrides used to render charts
+	helm        func(args ...string) (string, error) // runs helm with the supplied arguments
+	contextInfo func() (*remote.ContextInfo, error)  // returns information on the current kube context
+}
+
+func runHelm(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("helm", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("helm %s: %v\n%s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// helmObject is an object rendered by helm along with the template that produced it.
+type helmObject struct {
+	source string
+	data   map[string]interface{}
+}
+
+// parseHelmManifest returns the objects in the supplied multi-document manifest produced by helm.
+func parseHelmManifest(manifest string) ([]helmObject, error) {
+	var ret []helmObject
+	for _, doc := range docSeparator.Split(manifest, -1) {
+		var source string
+		if m := sourceComment.FindStringSubmatch(doc); m != nil {
+			source = m[1]
+		}
+		d := k8syaml.NewYAMLToJSONDecoder(strings.NewReader(doc))
+		for {
+			var data map[string]interface{}
+			if err := d.Decode(&data); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("parse manifest from %s: %v", source, err)
+			}
+			if len(data) == 0 {
+				continue
+			}
+			ret = append(ret, helmObject{source: source, data: data})
+		}
+	}
+	return ret, nil
+}
+
+// componentNameForSource returns a component name for the template that produced an object. Templates of
+// sub-charts are prefixed with the name of the sub-chart.
+func componentNameForSource(source string) string {
+	if source == "" {
+		return "main"
+	}
+	parts := strings.Split(source, "/")
+	base := strings.TrimSuffix(parts[len(parts)-1], filepath.Ext(parts[len(parts)-1]))
+	for i := len(parts) - 3; i > 0; i-- {
+		if parts[i] == "charts" {
+			base = parts[i+1] + "-" + base
+			break
+		}
+	}
+	return strings.Trim(invalidChars.ReplaceAllString(base, "-"), "-")
+}
+
+// paramExtractor replaces values that typically differ across environments with references to component
+// parameters and collects the values replaced as baseline parameters.
+type paramExtractor struct {
+	params map[string]interface{} // baseline parameters keyed by object name
+	refs   map[string]string      // jsonnet expressions keyed by the placeholder that replaced them
+}
+
+func newParamExtractor() *paramExtractor {
+	return &paramExtractor{params: map[string]interface{}{}, refs: map[string]string{}}
+}
+
+func (p *paramExtractor) replace(value interface{}, name string, path ...string) string {
+	obj, ok := p.params[name].(map[string]interface{})
+	if !ok {
+		obj = map[string]interface{}{}
+		p.params[name] = obj
+	}
+	m := obj
+	ref := "params[" + strconv.Quote(name) + "]"
+	for i, k := range path {
+		ref += "[" + strconv.Quote(k) + "]"
+		if i == len(path)-1 {
+			m[k] = value
+			break
+		}
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[k] = child
+		}
+		m = child
+	}
+	placeholder := fmt.Sprintf("__qbec_param_%d__", len(p.refs))
+	p.refs[placeholder] = ref
+	return placeholder
+}
+
+// podSpecPath returns the path to the pod spec for objects that have pod templates.
+func podSpecPath(kind string) []string {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		return []string{"spec", "template", "spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return nil
+	}
+}
+
+// extract replaces replica counts and container images of workloads in the supplied object with parameter references.
+func (p *paramExtractor) extract(obj map[string]interface{}) {
+	kind, _ := obj["kind"].(string)
+	path := podSpecPath(kind)
+	if path == nil {
+		return
+	}
+	meta, _ := obj["metadata"].(map[string]interface{})
+	name, _ := meta["name"].(string)
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		if r, ok := spec["replicas"]; ok {
+			spec["replicas"] = p.replace(r, name, "replicas")
+		}
+	}
+	var podSpec interface{} = obj
+	for _, k := range path {
+		m, ok := podSpec.(map[string]interface{})
+		if !ok {
+			return
+		}
+		podSpec = m[k]
+	}
+	ps, ok := podSpec.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, key := range []string{"initContainers", "containers"} {
+		containers, _ := ps[key].([]interface{})
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			cname, _ := container["name"].(string)
+			if image, ok := container["image"]; ok && cname != "" {
+				container["image"] = p.replace(image, name, "images", cname)
+			}
+		}
+	}
+}
+
+// toJsonnet returns the supplied value as jsonnet code with placeholders replaced by parameter references.
+func (p *paramExtractor) toJsonnet(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	code := buf.String()
+	for placeholder, ref := range p.refs {
+		code = strings.Replace(code, strconv.Quote(placeholder), ref, -1)
+	}
+	return code, nil
+}
+
+func removeHelmLabels(obj map[string]interface{}) {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	labels, _ := meta["labels"].(map[string]interface{})
+	for _, l := range helmLabels {
+		delete(labels, l)
+	}
+	if labels != nil && len(labels) == 0 {
+		delete(meta, "labels")
+	}
+}
+
+func helmManifest(source string, config convertHelmCommandConfig) (manifest string, name string, err error) {
+	_, statErr := os.Stat(source)
+	isChart := statErr == nil || strings.Contains(source, "/")
+	var nsArgs []string
+	if config.namespace != "" {
+		nsArgs = []string{"--namespace", config.namespace}
+	}
+	if !isChart {
+		if len(config.valueFiles) > 0 || len(config.setValues) > 0 || config.releaseName != "" {
+			return "", "", newUsageError("--values, --set and --release-name may only be specified for charts")
+		}
+		manifest, err = config.helm(append([]string{"get", "manifest", source}, nsArgs...)...)
+		return manifest, source, err
+	}
+	name = config.releaseName
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(source), ".tgz")
+	}
+	args := append([]string{"template", name, source}, nsArgs...)
+	for _, f := range config.valueFiles {
+		args = append(args, "--values", f)
+	}
+	for _, s := range config.setValues {
+		args = append(args, "--set", s)
+	}
+	manifest, err = config.helm(args...)
+	return manifest, name, err
+}
+
+func writeGeneratedFile(file string, contents string) error {
+	if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+		return err
+	}
+	sio.Noticeln("wrote", file)
+	return nil
+}
+
+// ensureNewAppDir returns an error if the directory for the supplied app already exists.
+func ensureNewAppDir(appName string) error {
+	if _, err := os.Stat(appName); err == nil {
+		return fmt.Errorf("directory %s already exists", appName)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// currentContext returns information on the current kube context, using fake values if it is not available.
+func currentContext(contextInfo func() (*remote.ContextInfo, error)) *remote.ContextInfo {
+	ctx, err := contextInfo()
+	if err != nil {
+		sio.Warnf("could not get current K8s context info, %v\n", err)
+		sio.Warnln("using fake parameters for environments")
+		ctx = &remote.ContextInfo{ServerURL: "https://minikube", Namespace: "default"}
+	}
+	return ctx
+}
+
+// convertedApp is an app converted from another tool, ready to be written to disk.
+type convertedApp struct {
+	tool       string                            // the tool from which the app was converted
+	app        model.QbecApp                     // the qbec.yaml contents
+	components map[string]string                 // component code keyed by component name
+	baseParams map[string]interface{}            // baseline parameters keyed by component name
+	envParams  map[string]map[string]interface{} // parameter overrides keyed by environment and component name
+	report     []string                          // constructs that need manual attention
+}
+
+func newConvertedApp(tool string, app model.QbecApp) *convertedApp {
+	return &convertedApp{
+		tool:       tool,
+		app:        app,
+		components: map[string]string{},
+		baseParams: map[string]interface{}{},
+		envParams:  map[string]map[string]interface{}{},
+	}
+}
+
+// addComponent adds a component with the supplied objects whose parameters have been extracted using the supplied
+// extractor.
+func (c *convertedApp) addComponent(name string, objects []interface{}, ex *paramExtractor) error {
+	code, err := ex.toJsonnet(objects)
+	if err != nil {
+		return err
+	}
+	preamble := "// converted from " + c.tool + "\n"
+	if len(ex.params) > 0 {
+		c.baseParams[name] = ex.params
+		preamble += fmt.Sprintf("local p = import '../params.libsonnet';\nlocal params = p.components[%s];\n\n", strconv.Quote(name))
+	}
+	c.components[name] = preamble + code
+	return nil
+}
+
+// jsonnetOverrides returns jsonnet code for an object that overrides the leaf values of the supplied map when
+// added to an existing object.
+func jsonnetOverrides(m map[string]interface{}, indent string) (string, error) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for _, k := range keys {
+		buf.WriteString(indent + "  " + strconv.Quote(k))
+		if child, ok := m[k].(map[string]interface{}); ok {
+			code, err := jsonnetOverrides(child, indent+"  ")
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(" +: " + code + ",\n")
+			continue
+		}
+		b, err := json.Marshal(m[k])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(": " + string(b) + ",\n")
+	}
+	buf.WriteString(indent + "}")
+	return buf.String(), nil
+}
+
+// write writes the app to a directory named after it.
+func (c *convertedApp) write() error {
+	appName := c.app.Metadata.Name
+	compsDir, envDir := filepath.Join(appName, "components"), filepath.Join(appName, "environments")
+	for _, dir := range []string{compsDir, envDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	var names []string
+	for name := range c.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeGeneratedFile(filepath.Join(compsDir, name+".jsonnet"), c.components[name]); err != nil {
+			return err
+		}
+	}
+
+	var envs []string
+	for env := range c.app.Spec.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	var envLines []string
+	for _, env := range envs {
+		envLines = append(envLines, fmt.Sprintf("  %s: import './environments/%s.libsonnet',", strconv.Quote(env), env))
+		overrides, err := jsonnetOverrides(c.envParams[env], "  ")
+		if err != nil {
+			return err
+		}
+		contents := fmt.Sprintf(`// this file has the param overrides for the %s environment
+local base = import './base.libsonnet';
+
+base {
+  components +: %s,
+}
+`, env, overrides)
+		if err := writeGeneratedFile(filepath.Join(envDir, env+".libsonnet"), contents); err != nil {
+			return err
+		}
+	}
+	code, err := newParamExtractor().toJsonnet(map[string]interface{}{"components": c.baseParams})
+	if err != nil {
+		return err
+	}
+	if err := writeGeneratedFile(filepath.Join(envDir, "base.libsonnet"), "// this file has the baseline default parameters extracted from "+c.tool+"\n"+code); err != nil {
+		return err
+	}
+	params := fmt.Sprintf(`// this file returns the params for the current qbec environment
+// you need to add an entry here every time you add a new environment.
+
+local env = std.extVar('qbec.io/env');
+local paramsMap = {
+  _: import './environments/base.libsonnet',
+%s
+};
+
+if std.objectHas(paramsMap, env) then paramsMap[env] else error 'environment ' + env + ' not defined in ' + std.thisFile
+`, strings.Join(envLines, "\n"))
+	if err := writeGeneratedFile(filepath.Join(appName, "params.libsonnet"), params); err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(c.app)
+	if err != nil {
+		return fmt.Errorf("yaml marshal: %v", err)
+	}
+	if err := writeGeneratedFile(filepath.Join(appName, "qbec.yaml"), string(b)); err != nil {
+		return err
+	}
+	if len(c.report) == 0 {
+		return nil
+	}
+	var report bytes.Buffer
+	fmt.Fprintf(&report, "# Conversion report\n\nThe following were not converted automatically and need manual attention:\n\n")
+	for _, r := range c.report {
+		sio.Warnln(r)
+		fmt.Fprintf(&report, "* %s\n", r)
+	}
+	return writeGeneratedFile(filepath.Join(appName, "conversion-report.md"), report.String())
+}
+
+func newApp(name string) model.QbecApp {
+	return model.QbecApp{
+		Kind:       "App",
+		APIVersion: model.LatestAPIVersion,
+		Metadata: model.AppMeta{
+			Name: name,
+		},
+		Spec: model.AppSpec{
+			Environments: map[string]model.Environment{},
+		},
+	}
+}
+
+func doConvertHelm(args []string, config convertHelmCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("a single release name or chart must be supplied")
+	}
+	if config.env == "" || config.env == model.Baseline {
+		return newUsageError(fmt.Sprintf("invalid environment name %q", config.env))
+	}
+	manifest, name, err := helmManifest(args[0], config)
+	if err != nil {
+		return err
+	}
+	appName := config.appName
+	if appName == "" {
+		appName = name
+	}
+	if err := ensureNewAppDir(appName); err != nil {
+		return err
+	}
+
+	objects, err := parseHelmManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects found for %s", args[0])
+	}
+
+	ctx := currentContext(config.contextInfo)
+	ns := config.namespace
+	if ns == "" {
+		ns = ctx.Namespace
+	}
+	sio.Noticef("using server URL %q and default namespace %q for the %s environment\n", ctx.ServerURL, ns, config.env)
+	app := newApp(appName)
+	app.Spec.Environments[config.env] = model.Environment{Server: ctx.ServerURL, DefaultNamespace: ns}
+	converted := newConvertedApp("helm", app)
+
+	components := map[string][]interface{}{}
+	extractors := map[string]*paramExtractor{}
+	for _, o := range objects {
+		comp := componentNameForSource(o.source)
+		if extractors[comp] == nil {
+			extractors[comp] = newParamExtractor()
+		}
+		meta, _ := o.data["metadata"].(map[string]interface{})
+		if annotations, ok := meta["annotations"].(map[string]interface{}); ok && annotations["helm.sh/hook"] != nil {
+			converted.report = append(converted.report, fmt.Sprintf("%s %v is a helm hook and will be applied as a regular object", o.data["kind"], meta["name"]))
+		}
+		removeHelmLabels(o.data)
+		extractors[comp].extract(o.data)
+		components[comp] = append(components[comp], o.data)
+	}
+	for comp, list := range components {
+		if err := converted.addComponent(comp, list, extractors[comp]); err != nil {
+			return err
+		}
+	}
+	if err := converted.write(); err != nil {
+		return err
+	}
+	sio.Noticef("converted %d objects into %d components\n", len(objects), len(components))
+	return nil
+}
+
+func newConvertHelmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "helm <release>|<chart>",
+		Short:   "create a qbec app from an installed helm release or a chart",
+		Example: convertHelmExamples(),
+	}
+
+	config := convertHelmCommandConfig{helm: runHelm, contextInfo: remote.CurrentContextInfo}
+	cmd.Flags().StringVar(&config.appName, "app-name", "", "name of the app to create, defaults to the release name")
+	cmd.Flags().StringVar(&config.releaseName, "release-name", "", "release name to use when rendering a chart, defaults to the chart name")
+	cmd.Flags().StringVar(&config.namespace, "namespace", "", "namespace of the release, defaults to the namespace of the current context")
+	cmd.Flags().StringVar(&config.env, "env", "default", "name of the environment to create")
+	cmd.Flags().StringArrayVarP(&config.valueFiles, "values", "f", nil, "value files to use when rendering a chart, can be specified multiple times")
+	cmd.Flags().StringArrayVar(&config.setValues, "set", nil, "value overrides to use when rendering a chart, can be specified multiple times")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		return wrapError(doConvertHelm(args, config))
+	}
+	return cmd
+}
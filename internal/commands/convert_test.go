@@ -0,0 +1,250 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/splunk/qbec/internal/eval"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var helmManifestOutput = `
+---
+# Source: web/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+  labels:
+    app: web
+    heritage: Helm
+    helm.sh/chart: web-0.1.0
+data:
+  index.html: hello
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    app.kubernetes.io/managed-by: Helm
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      initContainers:
+        - name: init
+          image: busybox:1.30
+      containers:
+        - name: main
+          image: nginx:stable
+---
+# Source: web/charts/redis/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web-redis
+spec:
+  ports:
+    - port: 6379
+`
+
+func convertInTempDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "convert")
+	require.Nil(t, err)
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	require.Nil(t, os.Chdir(dir))
+	return func() {
+		_ = os.Chdir(wd)
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func contextInfo() (*remote.ContextInfo, error) {
+	return &remote.ContextInfo{ServerURL: "https://k8s-dev", Namespace: "default"}, nil
+}
+
+func TestConvertHelmChart(t *testing.T) {
+	defer convertInTempDir(t)()
+	var helmArgs []string
+	err := doConvertHelm([]string{"./charts/web"}, convertHelmCommandConfig{
+		namespace:   "web-ns",
+		env:         "dev",
+		valueFiles:  []string{"dev.yaml"},
+		setValues:   []string{"replicas=3"},
+		contextInfo: contextInfo,
+		helm: func(args ...string) (string, error) {
+			helmArgs = args
+			return helmManifestOutput, nil
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"template", "web", "./charts/web", "--namespace", "web-ns", "--values", "dev.yaml", "--set", "replicas=3"}, helmArgs)
+
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	require.Nil(t, os.Chdir("web"))
+	defer func() { _ = os.Chdir(wd) }()
+
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, "web", app.Name())
+	assert.Equal(t, "https://k8s-dev", app.Spec.Environments["dev"].Server)
+	assert.Equal(t, "web-ns", app.Spec.Environments["dev"].DefaultNamespace)
+	components, err := app.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	var names []string
+	for _, c := range components {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"configmap", "deployment", "redis-service"}, names)
+
+	objects, err := eval.Components(components, eval.Context{App: "web", Env: "dev"})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(objects))
+	byName := map[string]model.K8sLocalObject{}
+	for _, o := range objects {
+		byName[o.GetName()] = o
+	}
+	cm := byName["web-config"]
+	require.NotNil(t, cm)
+	assert.Equal(t, "configmap", cm.Component())
+	assert.Equal(t, "web", cm.ToUnstructured().GetLabels()["app"])
+	assert.Equal(t, "", cm.ToUnstructured().GetLabels()["heritage"])
+	assert.Equal(t, "", cm.ToUnstructured().GetLabels()["helm.sh/chart"])
+
+	deploy := byName["web"]
+	require.NotNil(t, deploy)
+	assert.Equal(t, "", deploy.ToUnstructured().GetLabels()["app.kubernetes.io/managed-by"])
+	spec := deploy.ToUnstructured().Object["spec"].(map[string]interface{})
+	assert.EqualValues(t, 3, spec["replicas"])
+	podSpec := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	assert.Equal(t, "nginx:stable", podSpec["containers"].([]interface{})[0].(map[string]interface{})["image"])
+	assert.Equal(t, "busybox:1.30", podSpec["initContainers"].([]interface{})[0].(map[string]interface{})["image"])
+
+	b, err := ioutil.ReadFile(filepath.Join("components", "deployment.jsonnet"))
+	require.Nil(t, err)
+	assert.Contains(t, string(b), `params["web"]["replicas"]`)
+	assert.Contains(t, string(b), `params["web"]["images"]["main"]`)
+
+	params, err := eval.Params("params.libsonnet", eval.Context{App: "web", Env: "dev"})
+	require.Nil(t, err)
+	web := params["components"].(map[string]interface{})["deployment"].(map[string]interface{})["web"].(map[string]interface{})
+	assert.EqualValues(t, 3, web["replicas"])
+	assert.Equal(t, map[string]interface{}{"main": "nginx:stable", "init": "busybox:1.30"}, web["images"])
+}
+
+func TestConvertHelmRelease(t *testing.T) {
+	defer convertInTempDir(t)()
+	var helmArgs []string
+	err := doConvertHelm([]string{"web"}, convertHelmCommandConfig{
+		appName:     "web-app",
+		env:         "default",
+		contextInfo: contextInfo,
+		helm: func(args ...string) (string, error) {
+			helmArgs = args
+			return helmManifestOutput, nil
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"get", "manifest", "web"}, helmArgs)
+	require.Nil(t, os.Chdir("web-app"))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, "web-app", app.Name())
+	assert.Equal(t, "default", app.Spec.Environments["default"].DefaultNamespace)
+}
+
+func TestConvertHelmNegative(t *testing.T) {
+	defer convertInTempDir(t)()
+	helm := func(manifest string) func(args ...string) (string, error) {
+		return func(args ...string) (string, error) { return manifest, nil }
+	}
+	tests := []struct {
+		name   string
+		args   []string
+		config convertHelmCommandConfig
+		msg    string
+	}{
+		{
+			name:   "no-args",
+			config: convertHelmCommandConfig{env: "default"},
+			msg:    "a single release name or chart must be supplied",
+		},
+		{
+			name:   "baseline-env",
+			args:   []string{"web"},
+			config: convertHelmCommandConfig{env: "_"},
+			msg:    `invalid environment name "_"`,
+		},
+		{
+			name:   "release-values",
+			args:   []string{"web"},
+			config: convertHelmCommandConfig{env: "default", valueFiles: []string{"foo.yaml"}},
+			msg:    "--values, --set and --release-name may only be specified for charts",
+		},
+		{
+			name:   "no-objects",
+			args:   []string{"web"},
+			config: convertHelmCommandConfig{env: "default", helm: helm("---\n# Source: web/templates/empty.yaml\n")},
+			msg:    "no objects found for web",
+		},
+		{
+			name:   "bad-yaml",
+			args:   []string{"web"},
+			config: convertHelmCommandConfig{env: "default", helm: helm("# Source: web/templates/bad.yaml\nfoo: [bar\n")},
+			msg:    "parse manifest from web/templates/bad.yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.contextInfo = contextInfo
+			err := doConvertHelm(test.args, test.config)
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.msg)
+		})
+	}
+}
+
+func TestConvertComponentNames(t *testing.T) {
+	tests := map[string]string{
+		"":                                     "main",
+		"web/templates/deployment.yaml":        "deployment",
+		"web/templates/web.config.yaml":        "web-config",
+		"web/charts/redis/templates/svc.yaml":  "redis-svc",
+		"web/templates/nested/service_foo.yml": "service_foo",
+	}
+	for source, name := range tests {
+		assert.Equal(t, name, componentNameForSource(source), source)
+	}
+}
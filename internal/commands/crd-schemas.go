@@ -0,0 +1,175 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// isCRD returns true if the supplied object data is a custom resource definition.
+func isCRD(data map[string]interface{}) bool {
+	apiVersion, _ := data["apiVersion"].(string)
+	kind, _ := data["kind"].(string)
+	return strings.HasPrefix(apiVersion, "apiextensions.k8s.io/") && kind == "CustomResourceDefinition"
+}
+
+// crdSchemas are the schemas of custom resources keyed by group, version and kind, from custom resource definitions
+// that are available locally and may not be installed on the cluster.
+type crdSchemas map[schema.GroupVersionKind]*spec.Schema
+
+// add adds the schemas of the versions of the supplied custom resource definition. Versions without a schema are
+// ignored.
+func (c crdSchemas) add(data map[string]interface{}, source string) error {
+	group, _, _ := unstructured.NestedString(data, "spec", "group")
+	kind, _, _ := unstructured.NestedString(data, "spec", "names", "kind")
+	if group == "" || kind == "" {
+		return fmt.Errorf("%s: custom resource definition does not have a group and kind", source)
+	}
+	// v1beta1 definitions can have a single version and a schema for all versions
+	shared, _, _ := unstructured.NestedMap(data, "spec", "validation", "openAPIV3Schema")
+	versions, _, _ := unstructured.NestedSlice(data, "spec", "versions")
+	if v, _, _ := unstructured.NestedString(data, "spec", "version"); v != "" && len(versions) == 0 {
+		versions = []interface{}{map[string]interface{}{"name": v}}
+	}
+	for _, v := range versions {
+		version, _ := v.(map[string]interface{})
+		name, _ := version["name"].(string)
+		if name == "" {
+			continue
+		}
+		s := shared
+		if vs, ok, _ := unstructured.NestedMap(version, "schema", "openAPIV3Schema"); ok {
+			s = vs
+		}
+		if s == nil {
+			continue
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		var crdSchema spec.Schema
+		if err := json.Unmarshal(b, &crdSchema); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("%s: schema of %s version %s", source, kind, name))
+		}
+		c[schema.GroupVersionKind{Group: group, Version: name, Kind: kind}] = &crdSchema
+	}
+	return nil
+}
+
+// addFile adds the schemas of the custom resource definitions in the supplied YAML or JSON file. Other objects in
+// the file are ignored.
+func (c crdSchemas) addFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := k8syaml.NewYAMLToJSONDecoder(f)
+	for {
+		var data map[string]interface{}
+		if err := d.Decode(&data); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("parse %s: %v", file, err)
+		}
+		if isCRD(data) {
+			if err := c.add(data, file); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addDir adds the schemas of the custom resource definitions in the YAML and JSON files in the supplied directory and
+// its subdirectories.
+func (c crdSchemas) addDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+			return c.addFile(path)
+		default:
+			return nil
+		}
+	})
+}
+
+// crdValidator validates custom resources against the schema of their definition.
+type crdValidator struct {
+	schema *spec.Schema
+}
+
+func (v crdValidator) Validate(obj *unstructured.Unstructured) []error {
+	res := validate.NewSchemaValidator(v.schema, nil, "", strfmt.Default).Validate(obj.Object)
+	return res.Errors
+}
+
+// crdValidateClient validates custom resources against the schemas of local custom resource definitions, and
+// all other objects using the client that it wraps.
+type crdValidateClient struct {
+	validateClient
+	schemas crdSchemas
+}
+
+func (c *crdValidateClient) ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, error) {
+	if s, ok := c.schemas[gvk]; ok {
+		return crdValidator{schema: s}, nil
+	}
+	return c.validateClient.ValidatorFor(gvk)
+}
+
+// localCRDs returns the schemas of the custom resource definitions in the supplied directories and in the supplied
+// objects. Definitions in the objects take precedence since they are the ones that would be applied.
+func localCRDs(dirs []string, objects []model.K8sLocalObject, client validateClient) (crdSchemas, error) {
+	ret := crdSchemas{}
+	for _, dir := range dirs {
+		if err := ret.addDir(dir); err != nil {
+			return nil, errors.Wrap(err, "load custom resource definitions")
+		}
+	}
+	for _, o := range objects {
+		u := o.ToUnstructured()
+		if isCRD(u.Object) {
+			if err := ret.add(u.Object, client.DisplayName(o)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,136 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func customResource(apiVersion, kind string, spec map[string]interface{}) model.K8sLocalObject {
+	return model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": "cr1", "namespace": "default"},
+		"spec":       spec,
+	}, "app", "c1", "dev")
+}
+
+func TestLocalCRDs(t *testing.T) {
+	crds, err := localCRDs([]string{filepath.Join("testdata", "crds")}, nil, &client{})
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(3, len(crds))
+	for _, gvk := range []schema.GroupVersionKind{
+		{Group: "example.com", Version: "v1", Kind: "Widget"},
+		{Group: "example.com", Version: "v1alpha1", Kind: "Gadget"},
+		{Group: "example.com", Version: "v1beta1", Kind: "Gadget"},
+	} {
+		a.Contains(crds, gvk)
+	}
+
+	c := &crdValidateClient{validateClient: &client{validatorFunc: factory}, schemas: crds}
+	validator, err := c.ValidatorFor(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"})
+	require.Nil(t, err)
+	a.Nil(validator.Validate(customResource("example.com/v1", "Widget", map[string]interface{}{"color": "red", "size": 3}).ToUnstructured()))
+	errs := validator.Validate(customResource("example.com/v1", "Widget", map[string]interface{}{"color": "green", "size": 0}).ToUnstructured())
+	require.Equal(t, 2, len(errs))
+	a.Contains(errs[0].Error()+errs[1].Error(), "spec.color")
+	a.Contains(errs[0].Error()+errs[1].Error(), "spec.size")
+
+	validator, err = c.ValidatorFor(schema.GroupVersionKind{Group: "example.com", Version: "v1alpha1", Kind: "Gadget"})
+	require.Nil(t, err)
+	errs = validator.Validate(customResource("example.com/v1alpha1", "Gadget", map[string]interface{}{"replicas": "two"}).ToUnstructured())
+	require.Equal(t, 1, len(errs))
+	a.Contains(errs[0].Error(), "spec.replicas")
+
+	validator, err = c.ValidatorFor(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	require.Nil(t, err)
+	a.IsType(&v{}, validator)
+	validator, err = c.ValidatorFor(schema.GroupVersionKind{Group: "example.com", Version: "v2", Kind: "Widget"})
+	require.Nil(t, err)
+	a.IsType(&v{}, validator)
+}
+
+func TestLocalCRDsFromObjects(t *testing.T) {
+	crd := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+		"spec": map[string]interface{}{
+			"group": "example.com",
+			"names": map[string]interface{}{"kind": "Widget", "plural": "widgets"},
+			"versions": []interface{}{
+				map[string]interface{}{
+					"name": "v1",
+					"schema": map[string]interface{}{
+						"openAPIV3Schema": map[string]interface{}{
+							"type":       "object",
+							"properties": map[string]interface{}{"spec": map[string]interface{}{"type": "string"}},
+						},
+					},
+				},
+			},
+		},
+	}, "app", "c1", "dev")
+	crds, err := localCRDs([]string{filepath.Join("testdata", "crds")}, []model.K8sLocalObject{crd}, &client{})
+	require.Nil(t, err)
+	validator := crdValidator{schema: crds[schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}]}
+	errs := validator.Validate(customResource("example.com/v1", "Widget", map[string]interface{}{"color": "red"}).ToUnstructured())
+	require.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Error(), "spec")
+}
+
+func TestLocalCRDsNegative(t *testing.T) {
+	_, err := localCRDs([]string{filepath.Join("testdata", "no-such-dir")}, nil, &client{})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "load custom resource definitions")
+
+	bad := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "bad"},
+		"spec":       map[string]interface{}{},
+	}, "app", "c1", "dev")
+	_, err = localCRDs(nil, []model.K8sLocalObject{bad}, &client{})
+	require.NotNil(t, err)
+	assert.Equal(t, "CustomResourceDefinition::bad: custom resource definition does not have a group and kind", err.Error())
+}
+
+func TestValidateCRDDir(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "crds"))
+	require.Nil(t, err)
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.CRDDirs = []string{"no-such-dir"}
+	s.opts.client.validatorFunc = func(gvk schema.GroupVersionKind) (remote.Validator, error) {
+		return &v{}, nil
+	}
+	err = s.executeCommand("validate", "dev", "--crd-dir", dir)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no-such-dir")
+
+	s.opts.app.Spec.CRDDirs = nil
+	err = s.executeCommand("validate", "dev", "--crd-dir", dir, "-c", "cluster-objects")
+	require.Nil(t, err)
+}
@@ -0,0 +1,158 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// clusterScope is the key under which the impact of a delete lists cluster-scoped objects.
+const clusterScope = "(cluster)"
+
+// dependentKinds are the kinds of objects commonly created by controllers on behalf of other objects, and deleted
+// along with them through owner references.
+var dependentKinds = []schema.GroupVersionKind{
+	{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+	{Group: "apps", Version: "v1", Kind: "ControllerRevision"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Version: "v1", Kind: "Pod"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Group: "discovery.k8s.io", Version: "v1", Kind: "EndpointSlice"},
+}
+
+// impactClient is the remote interface needed to find the dependents of deleted objects.
+type impactClient interface {
+	IsNamespaced(kind schema.GroupVersionKind) (bool, error)
+	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+}
+
+// dependent is a live object that is deleted along with the object that owns it.
+type dependent struct {
+	object *unstructured.Unstructured
+	owner  string // kind and name of the owner
+}
+
+// findDependents returns the live objects of the dependent kinds that are owned by the supplied objects, directly or
+// through other dependents. Only the namespaces of the supplied objects are searched.
+func findDependents(client impactClient, objects []model.K8sQbecMeta) ([]dependent, error) {
+	owners := map[types.UID]string{}
+	namespaces := map[string]bool{}
+	for _, o := range objects {
+		u, err := client.Get(o)
+		if err == remote.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if u.GetUID() != "" {
+			owners[u.GetUID()] = fmt.Sprintf("%s %s", u.GetKind(), u.GetName())
+		}
+		if u.GetNamespace() != "" {
+			namespaces[u.GetNamespace()] = true
+		}
+	}
+	var nsList []string
+	for ns := range namespaces {
+		nsList = append(nsList, ns)
+	}
+	sort.Strings(nsList)
+
+	var candidates []*unstructured.Unstructured
+	for _, gvk := range dependentKinds {
+		for _, ns := range nsList {
+			list, err := client.ListObjects(gvk, ns)
+			if err != nil {
+				// kinds may not be served by older clusters or be forbidden for the user
+				sio.Warnf("unable to list %s objects, their dependents are not reported: %v\n", gvk.Kind, err)
+				break
+			}
+			candidates = append(candidates, list...)
+		}
+	}
+
+	// owners can be found in any order, keep going until no more dependents are found
+	var ret []dependent
+	found := map[types.UID]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, c := range candidates {
+			if c.GetUID() == "" || found[c.GetUID()] {
+				continue
+			}
+			for _, ref := range c.GetOwnerReferences() {
+				owner, ok := owners[ref.UID]
+				if !ok {
+					continue
+				}
+				found[c.GetUID()] = true
+				owners[c.GetUID()] = fmt.Sprintf("%s %s", c.GetKind(), c.GetName())
+				ret = append(ret, dependent{object: c, owner: owner})
+				changed = true
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+// deleteImpact returns the names of the supplied objects and dependents, by namespace and kind. Dependents are listed
+// with the objects that own them.
+func deleteImpact(client impactClient, objects []model.K8sQbecMeta, dependents []dependent, defaultNs string) (map[string]map[string][]string, error) {
+	ret := map[string]map[string][]string{}
+	add := func(ns, kind, name string) {
+		if ns == "" {
+			ns = clusterScope
+		}
+		if ret[ns] == nil {
+			ret[ns] = map[string][]string{}
+		}
+		ret[ns][kind] = append(ret[ns][kind], name)
+	}
+	for _, o := range objects {
+		namespaced, err := client.IsNamespaced(o.GetObjectKind().GroupVersionKind())
+		if err != nil {
+			return nil, err
+		}
+		ns := ""
+		if namespaced {
+			ns = o.GetNamespace()
+			if ns == "" {
+				ns = defaultNs
+			}
+		}
+		add(ns, o.GetKind(), o.GetName())
+	}
+	for _, d := range dependents {
+		add(d.object.GetNamespace(), d.object.GetKind(), fmt.Sprintf("%s (owned by %s)", d.object.GetName(), d.owner))
+	}
+	for _, kinds := range ret {
+		for _, names := range kinds {
+			sort.Strings(names)
+		}
+	}
+	return ret, nil
+}
@@ -18,25 +18,224 @@ package commands
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/objsort"
 	"github.com/splunk/qbec/internal/remote"
 	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// protectionClient is the remote interface needed to check whether objects are protected from deletion.
+type protectionClient interface {
+	DisplayName(o model.K8sMeta) string
+	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
+}
+
 // deleteClient is the remote interface needed for delete operations.
 type deleteClient interface {
 	listClient
-	DisplayName(o model.K8sMeta) string
-	Delete(obj model.K8sMeta, dryRun bool) (*remote.SyncResult, error)
+	protectionClient
+	Delete(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error)
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+	RecordTombstones(namespace, name string, tombstones []remote.Tombstone, max int) error
+}
+
+// removeProtected returns the subset of the supplied objects that may be deleted. An object is protected if its
+// kind is one of the protected kinds for the app or its server version has the protected annotation set to "true".
+// Objects listed from the server carry their annotations and are not fetched again, while the server versions of
+// local objects are. Protected objects are recorded as skipped in the supplied stats.
+func removeProtected(client protectionClient, app *model.App, objects []model.K8sQbecMeta, listed bool, stats *applyStats) ([]model.K8sQbecMeta, error) {
+	kinds, err := model.NewKindFilter(app.Spec.ProtectedKinds, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret []model.K8sQbecMeta
+	for _, ob := range objects {
+		reason := ""
+		if kinds.HasFilters() && kinds.ShouldInclude(ob.GetKind()) {
+			reason = fmt.Sprintf("kind %s is protected", ob.GetKind())
+		} else {
+			var anns map[string]string
+			if a, ok := ob.(annotated); ok && listed {
+				anns = a.GetAnnotations()
+			} else {
+				u, err := client.Get(ob)
+				if err != nil && err != remote.ErrNotFound {
+					return nil, err
+				}
+				if u != nil {
+					anns = u.GetAnnotations()
+				}
+			}
+			if anns[model.QbecNames.ProtectedAnnotation] == "true" {
+				reason = fmt.Sprintf("object has the %s annotation", model.QbecNames.ProtectedAnnotation)
+			}
+		}
+		if reason == "" {
+			ret = append(ret, ob)
+			continue
+		}
+		name := client.DisplayName(ob)
+		sio.Warnf("not deleting %s, %s, use --override-protection to delete it\n", name, reason)
+		stats.update(name, &remote.SyncResult{Type: remote.SyncSkip, Details: reason})
+	}
+	return ret, nil
+}
+
+// deleteWaitInterval is the interval at which deleted objects are checked when waiting for them to be gone.
+var deleteWaitInterval = 2 * time.Second
+
+// terminationStatus returns a description of why the supplied object that was deleted still exists.
+func terminationStatus(u *unstructured.Unstructured) string {
+	if u.GetDeletionTimestamp() == nil {
+		return "not deleted"
+	}
+	if finalizers := u.GetFinalizers(); len(finalizers) > 0 {
+		return "stuck terminating, waiting for finalizers " + strings.Join(finalizers, ", ")
+	}
+	return "stuck terminating"
+}
+
+// waitForDeletion waits until the supplied deleted objects no longer exist or the deadline passes, and returns
+// the objects that still exist with the reasons they do.
+func waitForDeletion(client protectionClient, objects []model.K8sQbecMeta, deadline time.Time) (map[string]string, error) {
+	pending := map[string]model.K8sQbecMeta{}
+	for _, o := range objects {
+		pending[client.DisplayName(o)] = o
+	}
+	sio.Noticef("waiting for %d object(s) to be deleted\n", len(pending))
+	status := map[string]string{}
+	for {
+		for name, o := range pending {
+			u, err := client.Get(o)
+			if err == remote.ErrNotFound {
+				delete(pending, name)
+				delete(status, name)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			status[name] = terminationStatus(u)
+		}
+		if len(pending) == 0 || !time.Now().Add(deleteWaitInterval).Before(deadline) {
+			return status, nil
+		}
+		time.Sleep(deleteWaitInterval)
+	}
+}
+
+// addressedDeletions returns the objects to be deleted that have one of the supplied addresses. It fails when an
+// address does not match any object.
+func addressedDeletions(objects []model.K8sQbecMeta, addrs []*objectAddress, env, defaultNs string) ([]model.K8sQbecMeta, error) {
+	var ret []model.K8sQbecMeta
+	found := map[*objectAddress]bool{}
+	for _, o := range objects {
+		for _, addr := range addrs {
+			if addr.matches(o, defaultNs) {
+				found[addr] = true
+				ret = append(ret, o)
+				break
+			}
+		}
+	}
+	for _, addr := range addrs {
+		if !found[addr] {
+			return nil, fmt.Errorf("no qbec-managed object %s found in environment %s", addr, env)
+		}
+	}
+	return ret, nil
+}
+
+// maxListedDeletions is the number of objects up to which the confirmation prompt for deletes lists every object.
+const maxListedDeletions = 10
+
+// deleteConfirmation returns the confirmation message for the supplied deletions, with more detail for deletions
+// that have a larger blast radius. A small number of objects are listed individually, larger numbers by kind, and
+// the namespaces and custom resource definitions whose deletion also deletes the objects in them are called out.
+func deleteConfirmation(client protectionClient, objects []model.K8sQbecMeta) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "will delete %d objects", len(objects))
+	if len(objects) <= maxListedDeletions {
+		for _, o := range objects {
+			fmt.Fprintf(&b, "\n  - %s", client.DisplayName(o))
+		}
+	} else {
+		counts := map[string]int{}
+		for _, o := range objects {
+			counts[o.GetKind()]++
+		}
+		var kinds []string
+		for k := range counts {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		for _, k := range kinds {
+			fmt.Fprintf(&b, "\n  - %d %s", counts[k], k)
+		}
+	}
+	var namespaces, crds []string
+	for _, o := range objects {
+		gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+		switch {
+		case gk.Group == "" && gk.Kind == "Namespace":
+			namespaces = append(namespaces, o.GetName())
+		case gk.Group == "apiextensions.k8s.io" && gk.Kind == "CustomResourceDefinition":
+			crds = append(crds, o.GetName())
+		}
+	}
+	if len(namespaces) > 0 {
+		fmt.Fprintf(&b, "\nthis also deletes all objects in namespaces %s", strings.Join(namespaces, ", "))
+	}
+	if len(crds) > 0 {
+		fmt.Fprintf(&b, "\nthis also deletes all custom resources of %s", strings.Join(crds, ", "))
+	}
+	return b.String()
+}
+
+// addCascadeFlag adds a flag for the cascade policy of deletions.
+func addCascadeFlag(cmd *cobra.Command, cascade *string, usage string) {
+	cmd.Flags().StringVar(cascade, "cascade", remote.CascadeForeground, fmt.Sprintf("%s, one of %s, %s or %s", usage,
+		remote.CascadeForeground, remote.CascadeBackground, remote.CascadeOrphan))
+}
+
+// checkCascade returns a usage error if the supplied cascade policy is invalid.
+func checkCascade(cascade string) error {
+	switch cascade {
+	case remote.CascadeForeground, remote.CascadeBackground, remote.CascadeOrphan:
+		return nil
+	default:
+		return newUsageError(fmt.Sprintf("invalid cascade policy %q, must be one of %s, %s or %s", cascade,
+			remote.CascadeForeground, remote.CascadeBackground, remote.CascadeOrphan))
+	}
+}
+
+// addDeleteFlags adds flags to control how objects are deleted and to wait for them to be gone.
+func addDeleteFlags(cmd *cobra.Command, config *deleteCommandConfig) {
+	addCascadeFlag(cmd, &config.cascade, "cascade policy for dependents of deleted objects")
+	cmd.Flags().BoolVar(&config.wait, "wait", false, "wait for deleted objects to be gone, including finalizers, before deleting objects that they may depend on")
+	cmd.Flags().DurationVar(&config.timeout, "timeout", 5*time.Minute, "with --wait, max time to wait for all objects to be deleted")
+	addTombstoneFlags(cmd, &config.stamp)
+	cmd.Flags().BoolVar(&config.impact, "impact", false, "with --dry-run, also list live objects owned by the objects that would be deleted, by namespace and kind")
 }
 
 type deleteCommandConfig struct {
 	StdOptions
 	dryRun         bool
 	useLocal       bool
+	override       bool
+	cascade        string
+	wait           bool
+	timeout        time.Duration
+	impact         bool
+	objects        []string // addresses of the only objects to delete
+	stamp          applyStamp
 	filterFunc     func() (filterParams, error)
 	clientProvider func(env string) (deleteClient, error)
 }
@@ -49,6 +248,23 @@ func doDelete(args []string, config deleteCommandConfig) error {
 	if env == model.Baseline { // cannot apply for the baseline environment
 		return newUsageError("cannot delete baseline environment, use a real environment")
 	}
+	if err := checkCascade(config.cascade); err != nil {
+		return err
+	}
+	if config.wait && config.timeout <= 0 {
+		return newUsageError(fmt.Sprintf("timeout must be positive, got %v", config.timeout))
+	}
+	if config.impact && !config.dryRun {
+		return newUsageError("--impact requires --dry-run")
+	}
+	var addrs []*objectAddress
+	for _, o := range config.objects {
+		addr, err := parseObjectAddress(o)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
 	fp, err := config.filterFunc()
 	if err != nil {
 		return err
@@ -86,6 +302,7 @@ func doDelete(args []string, config deleteCommandConfig) error {
 			Environment:     env,
 			ComponentFilter: cf,
 			KindFilter:      fp.kindFilter,
+			LabelSelector:   fp.selectorString(),
 			ListQueryScope:  scope,
 		})
 		deletions, err = lister.results()
@@ -94,38 +311,100 @@ func doDelete(args []string, config deleteCommandConfig) error {
 		}
 	}
 
+	if len(addrs) > 0 {
+		deletions, err = addressedDeletions(deletions, addrs, env, config.DefaultNamespace(env))
+		if err != nil {
+			return err
+		}
+	}
+
+	var stats applyStats
+	if !config.override {
+		deletions, err = removeProtected(client, config.App(), deletions, !config.useLocal, &stats)
+		if err != nil {
+			return err
+		}
+	}
+
 	dryRun := ""
 	if config.dryRun {
 		dryRun = "[dry-run] "
 	}
 
-	// process deletions
-	deletions = objsort.SortMeta(deletions, config.SortConfig(client.IsNamespaced))
+	if config.impact {
+		var dependents []dependent
+		if config.cascade != remote.CascadeOrphan {
+			dependents, err = findDependents(client, deletions)
+			if err != nil {
+				return err
+			}
+		}
+		stats.Impact, err = deleteImpact(client, deletions, dependents, config.DefaultNamespace(env))
+		if err != nil {
+			return err
+		}
+		sio.Noticef("%d object(s) would be deleted along with %d dependent(s)\n", len(deletions), len(dependents))
+	}
+
+	// process deletions in the reverse of apply order, one group of objects that do not depend on each other at a time
+	groups := objsort.GroupMeta(deletions, config.SortConfig(client.IsNamespaced))
 
 	if !config.dryRun && len(deletions) > 0 {
-		msg := fmt.Sprintf("will delete %d objects", len(deletions))
-		if err := config.Confirm(msg); err != nil {
+		if err := config.Confirm(deleteConfirmation(client, deletions)); err != nil {
 			return err
 		}
 	}
 
-	var stats applyStats
-	for i := len(deletions) - 1; i >= 0; i-- {
-		ob := deletions[i]
-		name := client.DisplayName(ob)
-		res, err := client.Delete(ob, config.dryRun)
+	var tombs *tombstones
+	if !config.dryRun {
+		tombs = newTombstones(config, env, "delete", config.stamp)
+		defer tombs.record(client)
+	}
+
+	deadline := time.Now().Add(config.timeout)
+	var stuck []string
+	for g := len(groups) - 1; g >= 0 && len(stuck) == 0; g-- {
+		group := groups[g]
+		for i := len(group) - 1; i >= 0; i-- {
+			ob := group[i]
+			name := client.DisplayName(ob)
+			res, err := client.Delete(ob, remote.DeleteOptions{DryRun: config.dryRun, Cascade: config.cascade})
+			if err != nil {
+				return err
+			}
+			if res.Type == remote.SyncDeleted {
+				tombs.add(ob)
+			}
+			stats.update(name, res)
+			sio.Noticeln(dryRun+"delete", name)
+			sio.Println(res.Details)
+		}
+		if !config.wait || config.dryRun {
+			continue
+		}
+		// wait for objects to be gone such that objects they depend on, like namespaces and custom resource
+		// definitions, are not deleted while they are still terminating
+		status, err := waitForDeletion(client, group, deadline)
 		if err != nil {
 			return err
 		}
-		stats.update(name, res)
-		sio.Noticeln(dryRun+"delete", name)
-		sio.Println(res.Details)
+		for name, s := range status {
+			stuck = append(stuck, fmt.Sprintf("%s: %s", name, s))
+		}
 	}
+	sort.Strings(stuck)
+	for _, s := range stuck {
+		sio.Warnln(s)
+	}
+	stats.Stuck = stuck
 
 	printStats(config.Stdout(), &stats)
 	if config.dryRun {
 		sio.Noticeln("** dry-run mode, nothing was actually changed **")
 	}
+	if len(stuck) > 0 {
+		return fmt.Errorf("%d object(s) were not deleted within %v, objects that they may depend on were not deleted", len(stuck), config.timeout)
+	}
 	return nil
 }
 
@@ -140,11 +419,14 @@ func newDeleteCommand(op OptionsProvider) *cobra.Command {
 		clientProvider: func(env string) (deleteClient, error) {
 			return op().Client(env)
 		},
-		filterFunc: addFilterParams(cmd, true),
+		filterFunc: addFilterParams(cmd, op, true),
 	}
 
 	cmd.Flags().BoolVarP(&config.dryRun, "dry-run", "n", false, "dry-run, do not delete resources but show what would happen")
 	cmd.Flags().BoolVar(&config.useLocal, "local", false, "use local object names to delete, do not derive list from server")
+	cmd.Flags().BoolVar(&config.override, "override-protection", false, "delete objects even if they are protected from deletion")
+	cmd.Flags().StringArrayVar(&config.objects, "object", nil, "delete just the qbec-managed object with this address, kind/namespace/name or kind/name, may be repeated")
+	addDeleteFlags(cmd, &config)
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
@@ -0,0 +1,346 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDeleteProtection(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.ProtectedKinds = []string{"Namespace"}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		u := obj.(model.K8sLocalObject).ToUnstructured()
+		if obj.GetName() == "svc2-secret" {
+			u.SetAnnotations(map[string]string{"qbec.io/protected": "true"})
+		}
+		return u, nil
+	}
+	var deleted []string
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		deleted = append(deleted, obj.GetName())
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "--local", "-c", "service2", "-c", "cluster-objects", "-k", "secret", "-k", "namespace", "-k", "configmap")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues([]string{"svc2-cm"}, deleted)
+	stats := s.outputStats()
+	a.Contains(stats["skipped"], "Secret:bar-system:svc2-secret")
+	a.Contains(stats["skipped"], "Namespace::bar-system")
+	s.assertErrorLineMatch(regexp.MustCompile(`not deleting Namespace::bar-system, kind Namespace is protected`))
+}
+
+func TestRemoveProtectedListed(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, fmt.Errorf("unexpected get of %s", obj.GetName())
+	}
+	newObj := func(name string, annotations map[string]interface{}) model.K8sQbecMeta {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"namespace": "bar-system", "name": name, "annotations": annotations},
+		}, "example1", "service2", "dev")
+	}
+	var stats applyStats
+	ret, err := removeProtected(s.opts.client, s.opts.app, []model.K8sQbecMeta{
+		newObj("cm1", map[string]interface{}{"qbec.io/protected": "true"}),
+		newObj("cm2", nil),
+	}, true, &stats)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ret))
+	assert.Equal(t, "cm2", ret[0].GetName())
+
+	_, err = removeProtected(s.opts.client, s.opts.app, []model.K8sQbecMeta{newObj("cm2", nil)}, false, &stats)
+	require.NotNil(t, err)
+	assert.Equal(t, "unexpected get of cm2", err.Error())
+}
+
+func TestDeleteWait(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	deleted := map[string]bool{}
+	var events []string
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		if deleted[obj.GetName()] {
+			events = append(events, "gone "+obj.GetName())
+			return nil, remote.ErrNotFound
+		}
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		deleted[obj.GetName()] = true
+		events = append(events, "delete "+obj.GetName())
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "--local", "-c", "service2", "-c", "cluster-objects", "--wait")
+	require.Nil(t, err)
+	a := assert.New(t)
+	index := func(event string) int {
+		for i, e := range events {
+			if e == event {
+				return i
+			}
+		}
+		t.Fatalf("no event %q in %v", event, events)
+		return -1
+	}
+	a.True(index("gone svc2-cm") < index("delete bar-system"))
+	a.True(index("gone svc2-secret") < index("delete bar-system"))
+	s.assertErrorLineMatch(regexp.MustCompile(`waiting for \d+ object\(s\) to be deleted`))
+}
+
+func TestDeleteCascade(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	cascades := map[string]bool{}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		cascades[opts.Cascade] = true
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "--local", "-c", "service2")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(map[string]bool{remote.CascadeForeground: true}, cascades)
+
+	cascades = map[string]bool{}
+	err = s.executeCommand("delete", "dev", "--local", "-c", "service2", "--cascade", "orphan")
+	require.Nil(t, err)
+	a.Equal(map[string]bool{remote.CascadeOrphan: true}, cascades)
+}
+
+func TestDeleteObjects(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	var deleted []string
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		deleted = append(deleted, obj.GetName())
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "--local", "--object", "configmaps/bar-system/svc2-cm", "--object", "namespace/bar-system")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues([]string{"svc2-cm", "bar-system"}, deleted)
+	require.Equal(t, 1, len(s.opts.confirms))
+	a.Equal("will delete 2 objects\n  - Namespace::bar-system\n  - ConfigMap:bar-system:svc2-cm\nthis also deletes all objects in namespaces bar-system", s.opts.confirms[0])
+}
+
+func TestDeleteObjectsNotFound(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("delete", "dev", "--local", "--object", "configmap/bar-system/svc2-cm", "--object", "secret/svc2-cm")
+	require.NotNil(t, err)
+	assert.Equal(t, "no qbec-managed object secret/svc2-cm found in environment dev", err.Error())
+}
+
+func TestDeleteConfirmation(t *testing.T) {
+	var objects []model.K8sQbecMeta
+	add := func(apiVersion, kind, name string) {
+		objects = append(objects, model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": name},
+		}, "app", "c1", "dev"))
+	}
+	for i := 0; i < 10; i++ {
+		add("v1", "ConfigMap", fmt.Sprintf("cm%d", i))
+	}
+	add("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com")
+	add("v1", "Namespace", "ns1")
+	add("v1", "Namespace", "ns2")
+	msg := deleteConfirmation(&client{}, objects)
+	assert.Equal(t, `will delete 13 objects
+  - 10 ConfigMap
+  - 1 CustomResourceDefinition
+  - 2 Namespace
+this also deletes all objects in namespaces ns1, ns2
+this also deletes all custom resources of widgets.example.com`, msg)
+}
+
+func impactObject(apiVersion, kind, ns, name, uid, ownerUID string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"namespace": ns, "name": name, "uid": uid},
+	}}
+	if ownerUID != "" {
+		u.SetOwnerReferences([]metav1.OwnerReference{{UID: types.UID(ownerUID), Kind: "Owner", Name: "owner"}})
+	}
+	return u
+}
+
+func TestDeleteImpact(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	web := model.NewK8sLocalObject(impactObject("apps/v1", "Deployment", "bar-system", "web", "d1", "").Object, "example1", "service2", "dev")
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		return []model.K8sQbecMeta{web}, nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	var listed []string
+	s.opts.client.listObjectsFunc = func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		listed = append(listed, gvk.Kind+":"+namespace)
+		switch gvk.Kind {
+		case "ReplicaSet":
+			return []*unstructured.Unstructured{impactObject("apps/v1", "ReplicaSet", "bar-system", "web-1", "r1", "d1")}, nil
+		case "Pod":
+			// pods are listed before replica sets that own them are known
+			return []*unstructured.Unstructured{
+				impactObject("v1", "Pod", "bar-system", "web-1-a", "p1", "r1"),
+				impactObject("v1", "Pod", "bar-system", "other", "p2", "r2"),
+			}, nil
+		case "EndpointSlice":
+			return nil, errors.New("server does not recognize gvk")
+		default:
+			return nil, nil
+		}
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "-n", "--impact")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Contains(listed, "Pod:bar-system")
+	stats := s.outputStats()
+	a.EqualValues(map[string]interface{}{
+		"bar-system": map[string]interface{}{
+			"Deployment": []interface{}{"web"},
+			"ReplicaSet": []interface{}{"web-1 (owned by Deployment web)"},
+			"Pod":        []interface{}{"web-1-a (owned by ReplicaSet web-1)"},
+		},
+	}, stats["impact"])
+	s.assertErrorLineMatch(regexp.MustCompile(`1 object\(s\) would be deleted along with 2 dependent\(s\)`))
+	s.assertErrorLineMatch(regexp.MustCompile(`unable to list EndpointSlice objects`))
+}
+
+func TestDeleteImpactOrphan(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	s.opts.client.listObjectsFunc = func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		return nil, fmt.Errorf("unexpected list of %s", gvk.Kind)
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "-n", "--impact", "--local", "-c", "service2", "-c", "cluster-objects", "-k", "namespace", "-k", "configmap", "--cascade", "orphan")
+	require.Nil(t, err)
+	stats := s.outputStats()
+	assert.EqualValues(t, map[string]interface{}{
+		"(cluster)":  map[string]interface{}{"Namespace": []interface{}{"bar-system", "foo-system"}},
+		"bar-system": map[string]interface{}{"ConfigMap": []interface{}{"svc2-cm"}},
+	}, stats["impact"])
+}
+
+func TestDeleteWaitStuck(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	defer func(d time.Duration) { deleteWaitInterval = d }(deleteWaitInterval)
+	deleteWaitInterval = time.Millisecond
+	deleted := map[string]bool{}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		u := obj.(model.K8sLocalObject).ToUnstructured()
+		if !deleted[obj.GetName()] {
+			return u, nil
+		}
+		if obj.GetName() != "svc2-cm" {
+			return nil, remote.ErrNotFound
+		}
+		now := metav1.Now()
+		u.SetDeletionTimestamp(&now)
+		u.SetFinalizers([]string{"example.com/cleanup"})
+		return u, nil
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		deleted[obj.GetName()] = true
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("delete", "dev", "--local", "-c", "service2", "-c", "cluster-objects", "--wait", "--timeout", "20ms")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 object(s) were not deleted within 20ms, objects that they may depend on were not deleted", err.Error())
+	a.False(deleted["bar-system"])
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-cm: stuck terminating, waiting for finalizers example.com/cleanup"}, stats["stuck"])
+}
+
+func TestDeleteNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		errorMsg string
+	}{
+		{
+			name:     "zero timeout",
+			args:     []string{"delete", "dev", "--wait", "--timeout", "0s"},
+			errorMsg: "timeout must be positive, got 0s",
+		},
+		{
+			name:     "bad cascade",
+			args:     []string{"delete", "dev", "--cascade", "Orphan"},
+			errorMsg: `invalid cascade policy "Orphan", must be one of foreground, background or orphan`,
+		},
+		{
+			name:     "bad object address",
+			args:     []string{"delete", "dev", "--object", "svc2-cm"},
+			errorMsg: `invalid object address "svc2-cm", must be kind/name or kind/namespace/name`,
+		},
+		{
+			name:     "impact without dry-run",
+			args:     []string{"delete", "dev", "--impact"},
+			errorMsg: "--impact requires --dry-run",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			a := assert.New(t)
+			a.True(isUsageError(err))
+			a.Equal(test.errorMsg, err.Error())
+		})
+	}
+}
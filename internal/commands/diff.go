@@ -21,6 +21,7 @@ import (
 	"io"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/diff"
@@ -76,6 +77,14 @@ type diffStats struct {
 	Deletions []string `json:"deletions,omitempty"`
 	SameCount int      `json:"same,omitempty"`
 	Errors    []string `json:"errors,omitempty"`
+	// components that are no longer part of the environment and whose objects would be deleted
+	RemovedComponents map[string]string `json:"removedComponents,omitempty"`
+	// changes that restart pods or disrupt workloads
+	Restarts   []string `json:"restarts,omitempty"`
+	Disruptive []string `json:"disruptive,omitempty"`
+	// per-group counts and durations when output is grouped
+	Groups    map[string]*groupStats `json:"groups,omitempty"`
+	sameNames []string               // names of objects that were the same
 }
 
 func (d *diffStats) added(s string) {
@@ -90,6 +99,17 @@ func (d *diffStats) changed(s string) {
 	d.Changes = append(d.Changes, s)
 }
 
+func (d *diffStats) classified(s string, i impact) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	switch i {
+	case impactRestart:
+		d.Restarts = append(d.Restarts, s)
+	case impactDisruptive:
+		d.Disruptive = append(d.Disruptive, s)
+	}
+}
+
 func (d *diffStats) deleted(s string) {
 	d.l.Lock()
 	defer d.l.Unlock()
@@ -100,6 +120,7 @@ func (d *diffStats) same(s string) {
 	d.l.Lock()
 	defer d.l.Unlock()
 	d.SameCount++
+	d.sameNames = append(d.sameNames, s)
 }
 
 func (d *diffStats) errors(s string) {
@@ -112,11 +133,14 @@ func (d *diffStats) done() {
 	sort.Strings(d.Additions)
 	sort.Strings(d.Changes)
 	sort.Strings(d.Errors)
+	sort.Strings(d.Restarts)
+	sort.Strings(d.Disruptive)
 }
 
 // diffClient is the remote interface needed for show operations.
 type diffClient interface {
 	listClient
+	Inventory(namespace, name string) ([]string, error)
 	DisplayName(o model.K8sMeta) string
 	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
 }
@@ -129,6 +153,16 @@ type differ struct {
 	ignores     diffIgnores
 	showSecrets bool
 	verbose     int
+	summary     bool       // record changes in rows instead of writing diffs
+	l           sync.Mutex // lock for rows
+	rows        []tableRow // changes recorded in summary mode
+}
+
+// record records a change to the supplied object for the summary.
+func (d *differ) record(ob model.K8sQbecMeta, change string) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.rows = append(d.rows, objectRow(ob, change))
 }
 
 func (d *differ) names(ob model.K8sQbecMeta) (name, leftName, rightName string) {
@@ -138,9 +172,16 @@ func (d *differ) names(ob model.K8sQbecMeta) (name, leftName, rightName string)
 	return
 }
 
-func (d *differ) fakeDiff(ob model.K8sQbecMeta, leftContent, rightContent string) error {
-	w := d.w
+func (d *differ) fakeDiff(w io.Writer, ob model.K8sQbecMeta, leftContent, rightContent string) error {
 	name, leftName, rightName := d.names(ob)
+	if d.summary {
+		change := "added"
+		if rightContent == "" {
+			change = "deleted"
+		}
+		d.record(ob, change)
+		return nil
+	}
 	fileOpts := d.opts
 	fileOpts.LeftName = leftName
 	fileOpts.RightName = rightName
@@ -154,18 +195,17 @@ func (d *differ) fakeDiff(ob model.K8sQbecMeta, leftContent, rightContent string
 	return nil
 }
 
-// diff diffs the supplied object with its remote version and writes output to its writer.
+// diff diffs the supplied object with its remote version and writes output to the supplied writer.
 // Care must be taken to ensure  that only a single write is made to the writer for every invocation.
 // Otherwise output will be interleaved across diffs.
-func (d *differ) diff(ob model.K8sLocalObject) error {
-	w := d.w
+func (d *differ) diff(w io.Writer, ob model.K8sLocalObject) error {
 	name, leftName, rightName := d.names(ob)
 
 	remoteObject, err := d.client.Get(ob)
 	if err != nil {
 		if err == remote.ErrNotFound {
 			d.stats.added(name)
-			return d.fakeDiff(ob, "", "\nobject doesn't exist on the server")
+			return d.fakeDiff(w, ob, "", "\nobject doesn't exist on the server")
 		}
 		d.stats.errors(name)
 		sio.Errorf("error fetching %s, %v\n", name, err)
@@ -194,14 +234,24 @@ func (d *differ) diff(ob model.K8sLocalObject) error {
 		return err
 	}
 
-	if len(b) == 0 {
-		if d.verbose > 0 {
+	switch {
+	case len(b) == 0:
+		if d.summary && d.verbose > 0 {
+			d.record(ob, "unchanged")
+		} else if d.verbose > 0 {
 			fmt.Fprintf(w, "%s unchanged\n", name)
 		}
 		d.stats.same(name)
-	} else {
-		fmt.Fprintln(w, string(b))
+	case d.summary:
+		i, _ := changeImpact(left, right)
+		d.record(ob, "changed")
+		d.stats.changed(name)
+		d.stats.classified(name, i)
+	default:
+		i, paths := changeImpact(left, right)
+		fmt.Fprintf(w, "%s\nimpact: %s, from changes to %s\n", b, i, summarizePaths(paths))
 		d.stats.changed(name)
+		d.stats.classified(name, i)
 	}
 	return nil
 }
@@ -212,38 +262,88 @@ type diffCommandConfig struct {
 	showSecrets    bool
 	parallel       int
 	contextLines   int
+	groupBy        string
+	summary        bool
+	columns        []string
 	di             diffIgnores
+	changedSince   string
 	filterFunc     func() (filterParams, error)
 	clientProvider func(env string) (diffClient, error)
+	changedFiles   func(ref string) ([]string, error)
 }
 
 func doDiff(args []string, config diffCommandConfig) error {
 	if len(args) != 1 {
 		return newUsageError("exactly one environment required")
 	}
+	envs, multi, err := expandEnvironments(config.App(), args[0])
+	if err != nil {
+		return err
+	}
+	if !multi {
+		return diffEnvironment(envs[0], config)
+	}
+	return runEnvironments(config.Stdout(), "diff", envs, func(env string) error {
+		return diffEnvironment(env, config)
+	})
+}
 
-	env := args[0]
+// diffEnvironment shows the differences between local and remote objects of a single environment.
+func diffEnvironment(env string, config diffCommandConfig) error {
 	if env == model.Baseline {
 		return newUsageError("cannot diff baseline environment, use a real environment")
 	}
-	fp, err := config.filterFunc()
+	if err := validateGroupBy(config.groupBy); err != nil {
+		return err
+	}
+	if len(config.columns) > 0 && !config.summary {
+		return newUsageError("--columns can only be used with --summary")
+	}
+	columns, err := tableColumns(config.columns, changeColumns)
 	if err != nil {
 		return err
 	}
-
-	objects, err := filteredObjects(config, env, fp)
+	if err := checkChangedSinceRef(config.changedSince); err != nil {
+		return err
+	}
+	fp, err := config.filterFunc()
 	if err != nil {
 		return err
 	}
 
+	var objects []model.K8sLocalObject
+	showDeletions := config.showDeletions
+	if config.changedSince != "" {
+		components, _, err := changedComponents(config, env, fp, config.changedSince, config.changedFiles)
+		if err != nil {
+			return err
+		}
+		if len(components) > 0 {
+			if objects, err = componentObjects(config, env, components, fp.kindFilter); err != nil {
+				return err
+			}
+			objects = fp.selectObjects(objects)
+		}
+		// only look for deletions of objects of changed components
+		fp.includes, fp.excludes = componentNames(components), nil
+		showDeletions = showDeletions && len(components) > 0
+	} else {
+		objects, err = filteredObjects(config, env, fp)
+		if err != nil {
+			return err
+		}
+	}
+
 	client, err := config.clientProvider(env)
 	if err != nil {
 		return err
 	}
 
 	var lister lister = &stubLister{}
-	if config.showDeletions {
-		all, err := allObjects(config, env)
+	var all []model.K8sLocalObject
+	var query remote.ListQueryConfig
+	if showDeletions {
+		all, err = allObjects(config, env)
 		if err != nil {
 			return err
 		}
@@ -253,16 +353,20 @@ func doDiff(args []string, config diffCommandConfig) error {
 		if err != nil {
 			return err
 		}
-		lister.start(all, remote.ListQueryConfig{
+		query = remote.ListQueryConfig{
 			Application:     config.App().Name(),
 			Environment:     env,
 			KindFilter:      fp.kindFilter,
+			LabelSelector:   fp.selectorString(),
 			ComponentFilter: cf,
 			ListQueryScope:  scope,
-		})
+		}
+		lister.start(all, query)
 	}
 
 	objects = objsort.Sort(objects, config.SortConfig(client.IsNamespaced))
+	groups := newGrouper(config.groupBy, config.DefaultNamespace(env), client.IsNamespaced)
+	groups.sort(objects)
 
 	// since the 0 value of context is turned to 3 by the diff library,
 	// special case to turn 0 into a negative number so that zero means zero.
@@ -279,27 +383,75 @@ func doDiff(args []string, config diffCommandConfig) error {
 		ignores:     config.di,
 		showSecrets: config.showSecrets,
 		verbose:     config.Verbosity(),
+		summary:     config.summary,
 	}
-	dErr := runInParallel(objects, d.diff, config.parallel)
+	dErr := runInParallel(objects, func(ob model.K8sLocalObject) error {
+		name := client.DisplayName(ob)
+		start := time.Now()
+		defer func() { groups.took(name, time.Since(start)) }()
+		return d.diff(groups.writer(groups.add(name, ob), w), ob)
+	}, config.parallel)
+	groups.flush(w)
 
 	var listErr error
 	if dErr == nil {
 		extra, err := lister.results()
+		var removed []*removedComponent
+		if err == nil && len(extra) > 0 {
+			extra, removed, err = splitRemovedComponents(client, config, env, all, extra, query)
+		}
 		if err != nil {
 			listErr = err
 		} else {
 			for _, ob := range extra {
 				name := client.DisplayName(ob)
 				d.stats.deleted(name)
-				if err := d.fakeDiff(ob, "\nobject doesn't exist locally", ""); err != nil {
+				if err := d.fakeDiff(groups.writer(groups.add(name, ob), w), ob, "\nobject doesn't exist locally", ""); err != nil {
 					return err
 				}
 			}
+			groups.flush(w)
+			// objects of removed components are shown in a separate section for each component
+			for _, r := range removed {
+				if !d.summary {
+					fmt.Fprintf(w, "component %s %s, %d live object(s) would be deleted\n\n", r.name, r.status(), len(r.objects))
+				}
+				for _, ob := range r.objects {
+					name := client.DisplayName(ob)
+					group := groups.add(name, ob)
+					d.stats.deleted(name)
+					if d.summary {
+						d.record(ob, changeComponentRemoved)
+						continue
+					}
+					if err := d.fakeDiff(groups.writer(group, w), ob, fmt.Sprintf("\ncomponent %s %s", r.name, r.status()), ""); err != nil {
+						return err
+					}
+				}
+				groups.flush(w)
+			}
+			d.stats.RemovedComponents = removedStatus(removed)
 		}
 	}
 
 	d.stats.done()
-	printStats(d.w, &d.stats)
+	if groups != nil {
+		d.stats.Groups = groups.summarize(
+			groupCount{d.stats.Additions, func(s *groupStats) { s.Additions++ }},
+			groupCount{d.stats.Changes, func(s *groupStats) { s.Changes++ }},
+			groupCount{d.stats.Deletions, func(s *groupStats) { s.Deletions++ }},
+			groupCount{d.stats.Errors, func(s *groupStats) { s.Errors++ }},
+			groupCount{d.stats.sameNames, func(s *groupStats) { s.Same++ }},
+		)
+	}
+	if config.summary {
+		sortRows(d.rows)
+		if err := writeTable(d.w, columns, d.rows, terminalWidth()); err != nil {
+			return err
+		}
+	} else {
+		printStats(d.w, &d.stats)
+	}
 	numDiffs := len(d.stats.Additions) + len(d.stats.Changes) + len(d.stats.Deletions)
 
 	switch {
@@ -316,7 +468,7 @@ func doDiff(args []string, config diffCommandConfig) error {
 
 func newDiffCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "diff <environment>",
+		Use:     "diff <environment>[,<environment>...]",
 		Short:   "diff one or more components against objects in a Kubernetes cluster",
 		Example: diffExamples(),
 	}
@@ -325,7 +477,8 @@ func newDiffCommand(op OptionsProvider) *cobra.Command {
 		clientProvider: func(env string) (diffClient, error) {
 			return op().Client(env)
 		},
-		filterFunc: addFilterParams(cmd, true),
+		filterFunc:   addFilterParams(cmd, op, true),
+		changedFiles: gitChangedFiles,
 	}
 	cmd.Flags().BoolVar(&config.showDeletions, "show-deletes", true, "include deletions in diff")
 	cmd.Flags().IntVar(&config.contextLines, "context", 3, "context lines for diff")
@@ -335,6 +488,10 @@ func newDiffCommand(op OptionsProvider) *cobra.Command {
 	cmd.Flags().StringArrayVar(&config.di.annotationNames, "ignore-annotation", nil, "remove specific annotation from objects before diff")
 	cmd.Flags().BoolVar(&config.di.allLabels, "ignore-all-labels", false, "remove all labels from objects before diff")
 	cmd.Flags().StringArrayVar(&config.di.labelNames, "ignore-label", nil, "remove specific label from objects before diff")
+	cmd.Flags().BoolVar(&config.summary, "summary", false, "show a table of added, changed and deleted objects instead of diffs")
+	cmd.Flags().StringVar(&config.changedSince, "changed-since", "", "only diff components whose input files changed since this git reference, including deletions of their objects")
+	addColumnsFlag(cmd, &config.columns, changeColumns)
+	addGroupByFlag(cmd, &config.groupBy)
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
@@ -18,6 +18,9 @@ package commands
 
 import (
 	"encoding/base64"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/splunk/qbec/internal/model"
@@ -98,6 +101,73 @@ func TestDiffBasic(t *testing.T) {
 	a.Contains(s.stdout(), redactedValue)
 	a.Contains(s.stdout(), "qbec.io/component: service2")
 	a.NotContains(s.stdout(), secretValue)
+	s.assertOutputLineMatch(regexp.MustCompile(`impact: non-disruptive, from changes to data.foo`))
+	a.Nil(stats["disruptive"])
+}
+
+func TestDiffSummary(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	d := &dg{cmValue: "baz", secretValue: "baz"}
+	s.opts.client.getFunc = d.get
+	err := s.executeCommand("diff", "dev", "--show-deletes=false", "--summary", "-c", "service2", "-k", "configmap", "-k", "secret")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("2 object(s) different", err.Error())
+	lines := strings.Split(strings.TrimSpace(s.stdout()), "\n")
+	require.Equal(t, 3, len(lines))
+	a.Regexp(regexp.MustCompile(`^COMPONENT\s+KIND\s+NAMESPACE\s+NAME\s+CHANGE$`), lines[0])
+	a.Regexp(regexp.MustCompile(`^service2\s+ConfigMap\s+bar-system\s+svc2-cm\s+changed$`), lines[1])
+	a.Regexp(regexp.MustCompile(`^service2\s+Secret\s+bar-system\s+svc2-secret\s+changed$`), lines[2])
+}
+
+func TestDiffSummaryColumns(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, remote.ErrNotFound
+	}
+	err := s.executeCommand("diff", "dev", "--show-deletes=false", "--summary", "--columns", "name,change", "-c", "service2")
+	require.NotNil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^NAME\s+CHANGE$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^svc2-cm\s+added$`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`object doesn't exist on the server`))
+}
+
+func TestDiffGroupBy(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	d := &dg{cmValue: "baz", secretValue: "bar"}
+	s.opts.client.getFunc = d.get
+	err := s.executeCommand("diff", "dev", "--show-deletes=false", "-c", "service2", "--group-by", "kind", "--ignore-all-annotations", "--ignore-all-labels")
+	require.NotNil(t, err)
+	stats := s.outputStats()
+	a := assert.New(t)
+	groups, ok := stats["groups"].(map[string]interface{})
+	require.True(t, ok)
+	a.EqualValues(1, groups["ConfigMap"].(map[string]interface{})["changes"])
+	a.EqualValues(1, groups["Secret"].(map[string]interface{})["same"])
+}
+
+func TestDiffGroupByOrder(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	d := &dg{cmValue: "baz", secretValue: "baz"}
+	s.opts.client.getFunc = d.get
+	err := s.executeCommand("diff", "dev", "--show-deletes=false", "-c", "service2", "--group-by", "kind", "--parallel", "5")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	out := s.stdout()
+	var positions []int
+	for _, kind := range []string{"ConfigMap", "Secret"} {
+		header := "kind " + kind + "\n"
+		a.Equal(1, strings.Count(out, header), kind)
+		positions = append(positions, strings.Index(out, header))
+	}
+	a.True(positions[0] < positions[1])
+	cm, secret := strings.Index(out, "svc2-cm"), strings.Index(out, "svc2-secret")
+	a.True(cm > positions[0] && cm < positions[1])
+	a.True(secret > positions[1])
 }
 
 func TestDiffBasicNoLabels(t *testing.T) {
@@ -193,6 +263,15 @@ func TestDiffNegative(t *testing.T) {
 				a.Equal("cannot diff baseline environment, use a real environment", err.Error())
 			},
 		},
+		{
+			name: "changed since last render",
+			args: []string{"diff", "dev", "--changed-since", "last-render"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--changed-since last-render can only be used with show, use a git reference", err.Error())
+			},
+		},
 		{
 			name: "c and C",
 			args: []string{"diff", "dev", "-c", "cluster-objects", "-C", "service2"},
@@ -223,3 +302,56 @@ func TestDiffNegative(t *testing.T) {
 	}
 
 }
+
+func TestDiffChangedSince(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed string
+		listed  bool
+		changes []interface{}
+	}{
+		{name: "component", changed: "components/service2.jsonnet", listed: true, changes: []interface{}{"ConfigMap:bar-system:svc2-cm", "Secret:bar-system:svc2-secret"}},
+		{name: "other", changed: "README.md"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			d := &dg{cmValue: "baz", secretValue: "baz"}
+			s.opts.client.getFunc = d.get
+			listed := false
+			s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+				listed = true
+				a := assert.New(t)
+				a.True(scope.ComponentFilter.ShouldInclude("service2"))
+				a.False(scope.ComponentFilter.ShouldInclude("cluster-objects"))
+				return nil, nil
+			}
+			changed, err := filepath.Abs(test.changed)
+			require.Nil(t, err)
+			err = doDiff([]string{"dev"}, diffCommandConfig{
+				StdOptions:    s.opts,
+				showDeletions: true,
+				parallel:      1,
+				contextLines:  3,
+				changedSince:  "main",
+				filterFunc:    func() (filterParams, error) { return filterParams{}, nil },
+				clientProvider: func(env string) (diffClient, error) {
+					return s.opts.client, nil
+				},
+				changedFiles: func(ref string) ([]string, error) {
+					return []string{changed}, nil
+				},
+			})
+			a := assert.New(t)
+			a.Equal(test.listed, listed)
+			if test.changes == nil {
+				require.Nil(t, err)
+				s.assertErrorLineMatch(regexp.MustCompile(`0 component\(s\) changed since main`))
+				return
+			}
+			require.NotNil(t, err)
+			a.EqualValues(test.changes, s.outputStats()["changes"])
+		})
+	}
+}
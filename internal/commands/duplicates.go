@@ -0,0 +1,165 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+)
+
+// maxDifferences is the maximum number of differing fields listed for near-identical objects.
+const maxDifferences = 3
+
+// objectContent has the leaf values of an object keyed by path, excluding metadata and status.
+type objectContent struct {
+	object model.K8sLocalObject
+	name   string
+	leaves map[string]string
+	digest string
+}
+
+// flatten adds the leaf values of the supplied value to the map under their paths.
+func flatten(prefix string, v interface{}, leaves map[string]string) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flatten(p, item, leaves)
+		}
+	case []interface{}:
+		for i, item := range value {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), item, leaves)
+		}
+	default:
+		b, _ := json.Marshal(value)
+		leaves[prefix] = string(b)
+	}
+}
+
+func newObjectContent(o model.K8sLocalObject, name string) *objectContent {
+	leaves := map[string]string{}
+	for k, v := range o.ToUnstructured().Object {
+		if k == "apiVersion" || k == "kind" || k == "metadata" || k == "status" {
+			continue
+		}
+		flatten(k, v, leaves)
+	}
+	var parts []string
+	for k, v := range leaves {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return &objectContent{object: o, name: name, leaves: leaves, digest: strings.Join(parts, "\n")}
+}
+
+// similarity returns the fraction of fields of both objects that have the same value in each of them, along with
+// the sorted paths of the fields that differ.
+func (c *objectContent) similarity(other *objectContent) (float64, []string) {
+	var diffs []string
+	same := 0
+	for k, v := range c.leaves {
+		if ov, ok := other.leaves[k]; ok && ov == v {
+			same++
+			continue
+		}
+		diffs = append(diffs, k)
+	}
+	for k := range other.leaves {
+		if _, ok := c.leaves[k]; !ok {
+			diffs = append(diffs, k)
+		}
+	}
+	sort.Strings(diffs)
+	return float64(same) / float64(same+len(diffs)), diffs
+}
+
+// label returns the display name of the object along with its component.
+func (c *objectContent) label() string {
+	return fmt.Sprintf("%s (%s)", c.name, c.object.Component())
+}
+
+// duplicateObjects returns messages for objects of the same kind in different components that have identical
+// content, or content where at least the supplied fraction of fields have the same values. Metadata is not compared
+// and objects without content, such as namespaces, are ignored.
+func duplicateObjects(objects []model.K8sLocalObject, client validateClient, threshold float64) []string {
+	byKind := map[string][]*objectContent{}
+	var kinds []string
+	for _, o := range objects {
+		c := newObjectContent(o, client.DisplayName(o))
+		if len(c.leaves) == 0 {
+			continue
+		}
+		gvk := o.GetObjectKind().GroupVersionKind()
+		gk := gvk.Kind + "." + gvk.Group
+		if _, ok := byKind[gk]; !ok {
+			kinds = append(kinds, gk)
+		}
+		byKind[gk] = append(byKind[gk], c)
+	}
+	sort.Strings(kinds)
+
+	var ret []string
+	for _, gk := range kinds {
+		// group identical objects first, such that copies are reported once
+		var groups [][]*objectContent
+		index := map[string]int{}
+		for _, c := range byKind[gk] {
+			if i, ok := index[c.digest]; ok {
+				groups[i] = append(groups[i], c)
+				continue
+			}
+			index[c.digest] = len(groups)
+			groups = append(groups, []*objectContent{c})
+		}
+		for _, g := range groups {
+			components := map[string]bool{}
+			var labels []string
+			for _, c := range g {
+				components[c.object.Component()] = true
+				labels = append(labels, c.label())
+			}
+			if len(components) > 1 {
+				ret = append(ret, fmt.Sprintf("identical content: %s", strings.Join(labels, ", ")))
+			}
+		}
+		if threshold >= 1 {
+			continue
+		}
+		for i, g1 := range groups {
+			for _, g2 := range groups[i+1:] {
+				left, right := g1[0], g2[0]
+				if left.object.Component() == right.object.Component() && len(g1) == 1 && len(g2) == 1 {
+					continue
+				}
+				sim, diffs := left.similarity(right)
+				if sim < threshold {
+					continue
+				}
+				ret = append(ret, fmt.Sprintf("%.0f%% similar content: %s, %s, differing in %s",
+					sim*100, left.label(), right.label(), summarizePaths(diffs)))
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,84 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateObjects(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	cm := func(component, name string, data map[string]interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			"data":       data,
+		}, "example1", component, "dev")
+	}
+	common := func(extra ...string) map[string]interface{} {
+		ret := map[string]interface{}{}
+		for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"} {
+			ret[k] = k
+		}
+		for _, k := range extra {
+			ret[k] = "other"
+		}
+		return ret
+	}
+	objects := []model.K8sLocalObject{
+		cm("c1", "cm1", map[string]interface{}{"foo": "bar"}),
+		cm("c2", "cm2", map[string]interface{}{"foo": "bar"}),
+		cm("c3", "cm3", map[string]interface{}{"foo": "bar"}),
+		cm("c1", "same-component", common()),
+		cm("c1", "same-component2", common()),
+		cm("c2", "near", common("j")),
+		cm("c3", "different", map[string]interface{}{"foo": "baz"}),
+		model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "ns1"},
+		}, "example1", "c1", "dev"),
+		model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "ns2"},
+		}, "example1", "c2", "dev"),
+	}
+	msgs := duplicateObjects(objects, s.opts.client, 0.9)
+	assert.Equal(t, []string{
+		"identical content: ConfigMap:default:cm1 (c1), ConfigMap:default:cm2 (c2), ConfigMap:default:cm3 (c3)",
+		"90% similar content: ConfigMap:default:same-component (c1), ConfigMap:default:near (c2), differing in data.j",
+	}, msgs)
+	msgs = duplicateObjects(objects, s.opts.client, 1)
+	assert.Equal(t, 1, len(msgs))
+}
+
+func TestValidateReportDuplicates(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	err := s.executeCommand("validate", "dev", "-c", "cluster-objects", "--report-duplicates")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`stats:`))
+}
@@ -0,0 +1,348 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// names of the checks made by env check
+const (
+	checkConnect      = "connect"
+	checkAuthenticate = "authenticate"
+	checkVersion      = "server-version"
+	checkKind         = "kind"
+	checkAccess       = "access"
+	checkNamespace    = "namespace"
+)
+
+// envCheckVerbs are the verbs that apply and garbage collection use for objects of the app.
+var envCheckVerbs = []string{"get", "list", "create", "patch", "delete"}
+
+// envCheck is the outcome of a single check of an environment.
+type envCheck struct {
+	Check  string `json:"check"`
+	Target string `json:"target,omitempty"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// envCheckReport is the report of all checks of an environment.
+type envCheckReport struct {
+	Environment string     `json:"environment"`
+	Passed      bool       `json:"passed"`
+	Checks      []envCheck `json:"checks"`
+}
+
+func (r *envCheckReport) pass(check, target, detail string) {
+	r.Checks = append(r.Checks, envCheck{Check: check, Target: target, Passed: true, Detail: detail})
+}
+
+func (r *envCheckReport) fail(check, target, detail string) {
+	r.Checks = append(r.Checks, envCheck{Check: check, Target: target, Detail: detail})
+}
+
+// failures returns the number of failed checks.
+func (r *envCheckReport) failures() int {
+	n := 0
+	for _, c := range r.Checks {
+		if !c.Passed {
+			n++
+		}
+	}
+	return n
+}
+
+// accessKey is a kind of objects in a namespace, applied by an identity, whose access is checked.
+type accessKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string // blank for cluster-scoped kinds
+	user      string // impersonated user, blank for the identity in the kubeconfig
+}
+
+// kindName returns the kind of the supplied group version kind qualified by its group, like Deployment.apps.
+func kindName(gvk schema.GroupVersionKind) string {
+	if gvk.Group == "" {
+		return gvk.Kind
+	}
+	return gvk.Kind + "." + gvk.Group
+}
+
+func (k accessKey) String() string {
+	s := kindName(k.gvk)
+	if k.namespace == "" {
+		s += " (cluster)"
+	} else {
+		s += " in namespace " + k.namespace
+	}
+	if k.user != "" {
+		s += " as " + k.user
+	}
+	return s
+}
+
+// checkServerVersion checks that the server version is known and that no objects use API versions that it removed.
+func checkServerVersion(r *envCheckReport, client Client, objects []model.K8sLocalObject) {
+	v, err := client.ServerVersion()
+	if err != nil {
+		r.fail(checkVersion, "", err.Error())
+		return
+	}
+	minor, err := remote.ParseKubernetesVersion(v)
+	if err != nil {
+		r.fail(checkVersion, v, err.Error())
+		return
+	}
+	removed, _ := apiFindings(apiUsages(objects, client, minor))
+	if len(removed) > 0 {
+		r.fail(checkVersion, v, strings.Join(removed, "; "))
+		return
+	}
+	r.pass(checkVersion, v, fmt.Sprintf("no objects use API versions removed in Kubernetes 1.%d", minor))
+}
+
+// checkAccessAndNamespaces checks that the kinds of the supplied objects are served, that the identities applying them
+// may perform all operations of apply on them and that the namespaces they are applied to exist or are created by
+// the app.
+func checkAccessAndNamespaces(r *envCheckReport, config envCheckCommandConfig, env string, client Client, objects []model.K8sLocalObject) error {
+	app := config.App()
+	defaultNs := config.DefaultNamespace(env)
+	unserved := map[schema.GroupVersionKind]error{}
+	keys := map[accessKey]*model.Impersonation{}
+	namespaces := map[string]bool{defaultNs: true}
+	created := map[string]bool{}
+	for _, o := range objects {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		if gvk.Group == "" && gvk.Kind == "Namespace" {
+			created[o.GetName()] = true
+		}
+		namespaced, err := client.IsNamespaced(gvk)
+		if err != nil {
+			unserved[gvk] = err
+			continue
+		}
+		key := accessKey{gvk: gvk}
+		if namespaced {
+			key.namespace = o.GetNamespace()
+			if key.namespace == "" {
+				key.namespace = defaultNs
+			}
+			namespaces[key.namespace] = true
+		}
+		imp := app.ComponentImpersonation(o.Component())
+		if imp != nil {
+			key.user = imp.User
+		}
+		keys[key] = imp
+	}
+
+	var gvks []schema.GroupVersionKind
+	for gvk := range unserved {
+		gvks = append(gvks, gvk)
+	}
+	sort.Slice(gvks, func(i, j int) bool { return gvks[i].String() < gvks[j].String() })
+	for _, gvk := range gvks {
+		r.fail(checkKind, kindName(gvk), fmt.Sprintf("%s is not served: %v", gvk.GroupVersion(), unserved[gvk]))
+	}
+
+	var sorted []accessKey
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	clients := map[string]Client{"": client}
+	for _, k := range sorted {
+		c, ok := clients[k.user]
+		if !ok {
+			imp := keys[k]
+			var err error
+			if c, err = client.Impersonate(imp.User, imp.Groups); err != nil {
+				return err
+			}
+			clients[k.user] = c
+		}
+		var denied, failed []string
+		for _, verb := range envCheckVerbs {
+			allowed, _, err := c.CanI(verb, k.gvk, k.namespace)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", verb, err))
+				continue
+			}
+			if !allowed {
+				denied = append(denied, verb)
+			}
+		}
+		switch {
+		case len(failed) > 0:
+			r.fail(checkAccess, k.String(), strings.Join(failed, "; "))
+		case len(denied) > 0:
+			r.fail(checkAccess, k.String(), "not allowed to "+strings.Join(denied, ", "))
+		default:
+			r.pass(checkAccess, k.String(), "allowed to "+strings.Join(envCheckVerbs, ", "))
+		}
+	}
+
+	var nsNames []string
+	for ns := range namespaces {
+		nsNames = append(nsNames, ns)
+	}
+	sort.Strings(nsNames)
+	for _, ns := range nsNames {
+		if created[ns] {
+			r.pass(checkNamespace, ns, "created by the app")
+			continue
+		}
+		_, err := client.Get(model.NewK8sObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": ns},
+		}))
+		switch {
+		case err == remote.ErrNotFound:
+			r.fail(checkNamespace, ns, "does not exist")
+		case err != nil:
+			r.fail(checkNamespace, ns, err.Error())
+		default:
+			r.pass(checkNamespace, ns, "exists")
+		}
+	}
+	return nil
+}
+
+func printEnvCheck(config envCheckCommandConfig, r *envCheckReport) error {
+	w := config.Stdout()
+	switch config.format {
+	case "yaml":
+		b, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	green, red, reset := "", "", ""
+	if config.Colorize() {
+		green, red, reset = escGreen, escRed, escReset
+	}
+	for _, c := range r.Checks {
+		color, mark := green, unicodeCheck
+		if !c.Passed {
+			color, mark = red, unicodeX
+		}
+		line := c.Check
+		if c.Target != "" {
+			line += " " + c.Target
+		}
+		if c.Detail != "" {
+			line += ": " + c.Detail
+		}
+		fmt.Fprintf(w, "%s%s %s%s\n", color, mark, line, reset)
+	}
+	return nil
+}
+
+type envCheckCommandConfig struct {
+	StdOptionsWithClient
+	format     string
+	filterFunc func() (filterParams, error)
+}
+
+func doEnvCheck(args []string, config envCheckCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	env := args[0]
+	if env == model.Baseline {
+		return newUsageError("cannot check baseline environment, use a real environment")
+	}
+	e, ok := config.App().Spec.Environments[env]
+	if !ok {
+		return newUsageError(fmt.Sprintf("invalid environment %q", env))
+	}
+	switch config.format {
+	case "", "json", "yaml":
+	default:
+		return newUsageError(fmt.Sprintf("invalid output format: %q", config.format))
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	objects, err := filteredObjects(config, env, fp)
+	if err != nil {
+		return err
+	}
+
+	r := &envCheckReport{Environment: env}
+	binding := envInfo{Server: e.Server, Context: e.Context, ContextPattern: e.ContextPattern}.binding()
+	client, err := config.Client(env)
+	switch {
+	case err != nil && apiErrors.IsUnauthorized(errors.Cause(err)):
+		r.pass(checkConnect, binding, "server reachable")
+		r.fail(checkAuthenticate, "", err.Error())
+	case err != nil:
+		r.fail(checkConnect, binding, err.Error())
+	default:
+		r.pass(checkConnect, binding, "server reachable")
+		r.pass(checkAuthenticate, "", "credentials accepted")
+		checkServerVersion(r, client, objects)
+		if err := checkAccessAndNamespaces(r, config, env, client, objects); err != nil {
+			return err
+		}
+	}
+	failed := r.failures()
+	r.Passed = failed == 0
+	if err := printEnvCheck(config, r); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d check(s) failed for environment %s", failed, len(r.Checks), env)
+	}
+	return nil
+}
+
+func newEnvCheckCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "check <environment> [-c component]...",
+		Short:   "check that an environment can be deployed to, before anything is applied",
+		Example: envCheckExamples(),
+	}
+	config := envCheckCommandConfig{}
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display a machine readable report")
+	config.filterFunc = addFilterParams(cmd, op, false)
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptionsWithClient = op()
+		return wrapError(doEnvCheck(args, config))
+	}
+	return cmd
+}
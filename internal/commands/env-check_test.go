@@ -0,0 +1,146 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func setEnvCheckClient(s *scaffold, deny func(verb string, gvk schema.GroupVersionKind, namespace string) bool, missing map[string]bool) {
+	s.opts.client.versionFunc = func() (string, error) { return "1.20", nil }
+	s.opts.client.canIFunc = func(verb string, gvk schema.GroupVersionKind, namespace string) (bool, string, error) {
+		return !deny(verb, gvk, namespace), "", nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		if obj.GetKind() != "Namespace" {
+			return nil, remote.ErrNotFound
+		}
+		if missing[obj.GetName()] {
+			return nil, remote.ErrNotFound
+		}
+		return &unstructured.Unstructured{}, nil
+	}
+}
+
+func TestEnvCheck(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setEnvCheckClient(s, func(verb string, gvk schema.GroupVersionKind, namespace string) bool { return false }, nil)
+	err := s.executeCommand("env", "check", "dev", "-C", "cluster-objects")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^✔ connect https://dev-server: server reachable$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^✔ authenticate: credentials accepted$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^✔ server-version 1.20: no objects use API versions removed in Kubernetes 1.20$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^✔ access ConfigMap in namespace bar-system: allowed to get, list, create, patch, delete$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^✔ namespace bar-system: exists$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^✔ namespace default: exists$`))
+}
+
+func TestEnvCheckFailures(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setEnvCheckClient(s, func(verb string, gvk schema.GroupVersionKind, namespace string) bool {
+		return gvk.Kind == "ConfigMap" && (verb == "delete" || verb == "patch")
+	}, map[string]bool{"default": true})
+	s.opts.app.Spec.Components = map[string]model.ComponentSpec{
+		"service2": {Impersonate: &model.Impersonation{User: "deployer"}},
+	}
+	err := s.executeCommand("env", "check", "dev", "-o", "json")
+	require.NotNil(t, err)
+	var r envCheckReport
+	require.Nil(t, s.jsonOutput(&r))
+	a := assert.New(t)
+	a.False(r.Passed)
+	a.Equal("dev", r.Environment)
+	failed := map[string]string{}
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failed[c.Check+" "+c.Target] = c.Detail
+		}
+	}
+	a.Contains(r.Checks, envCheck{Check: "namespace", Target: "bar-system", Passed: true, Detail: "created by the app"})
+	a.Contains(r.Checks, envCheck{Check: "access", Target: "PodSecurityPolicy.extensions (cluster)", Passed: true, Detail: "allowed to get, list, create, patch, delete"})
+	a.Equal(map[string]string{
+		"access ConfigMap in namespace bar-system as deployer": "not allowed to patch, delete",
+		"namespace default": "does not exist",
+		"server-version 1.20": "PodSecurityPolicy::100-default uses apiVersion extensions/v1beta1 which was removed in Kubernetes 1.16, use policy/v1beta1; " +
+			"PodSecurityPolicy::200-allow-root uses apiVersion extensions/v1beta1 which was removed in Kubernetes 1.16, use policy/v1beta1",
+	}, failed)
+	a.Regexp(`^3 of \d+ check\(s\) failed for environment dev$`, err.Error())
+}
+
+func TestEnvCheckNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "no env",
+			args: []string{"env", "check"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("exactly one environment required", err.Error())
+			},
+		},
+		{
+			name: "baseline",
+			args: []string{"env", "check", "_"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("cannot check baseline environment, use a real environment", err.Error())
+			},
+		},
+		{
+			name: "bad env",
+			args: []string{"env", "check", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "foo"`, err.Error())
+			},
+		},
+		{
+			name: "bad format",
+			args: []string{"env", "check", "dev", "-o", "xml"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid output format: "xml"`, err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// envDefaultCommands are the commands whose flags may be defaulted by environments.
+var envDefaultCommands = map[string]bool{
+	"apply":    true,
+	"diff":     true,
+	"delete":   true,
+	"validate": true,
+	"show":     true,
+}
+
+// addEnvDefaults makes the commands of the supplied root that support environment defaults apply them before they run.
+func addEnvDefaults(root *cobra.Command, op OptionsProvider) {
+	for _, cmd := range root.Commands() {
+		if !envDefaultCommands[cmd.Name()] || cmd.RunE == nil {
+			continue
+		}
+		run := cmd.RunE
+		cmd.RunE = func(c *cobra.Command, args []string) error {
+			if err := applyEnvDefaults(c, op().App(), args); err != nil {
+				return wrapError(err)
+			}
+			return run(c, args)
+		}
+	}
+}
+
+// defaultTargets returns the environments that the supplied command will run for. Arguments that cannot be expanded
+// are ignored, the command reports them when it runs.
+func defaultTargets(c *cobra.Command, app *model.App, args []string) []string {
+	if f := c.Flags().Lookup("env-group"); f != nil && f.Value.String() != "" {
+		return expandClusters(app, app.Spec.EnvGroups[f.Value.String()])
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	envs, _, err := expandEnvironments(app, args[0])
+	if err != nil {
+		return nil
+	}
+	var ret []string
+	for _, env := range envs {
+		if _, ok := app.Spec.Environments[env]; ok {
+			ret = append(ret, env)
+		}
+	}
+	return ret
+}
+
+// applyEnvDefaults sets the flags of the supplied command that were not specified on the command line to the defaults
+// of the environments that it runs for, and turns off --yes for environments that require confirmation. When the
+// command runs for multiple environments, they must agree on the defaults.
+func applyEnvDefaults(c *cobra.Command, app *model.App, args []string) error {
+	envs := defaultTargets(c, app, args)
+	if len(envs) == 0 {
+		return nil
+	}
+	values := map[string]interface{}{}
+	owners := map[string]string{}
+	for _, env := range envs {
+		for name, v := range app.Spec.Environments[env].Defaults[c.Name()] {
+			if _, ok := owners[name]; !ok {
+				owners[name], values[name] = env, v
+			}
+		}
+	}
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		owner := owners[name]
+		f := c.Flags().Lookup(name)
+		if f == nil {
+			return newUsageError(fmt.Sprintf("environment %s: unknown flag %q in defaults for %s", owner, name, c.Name()))
+		}
+		if f.Changed {
+			continue
+		}
+		for _, env := range envs {
+			v, ok := app.Spec.Environments[env].Defaults[c.Name()][name]
+			if !ok || !reflect.DeepEqual(v, values[name]) {
+				return newUsageError(fmt.Sprintf("environments %s and %s have different defaults for %s flag %s, specify it on the command line", owner, env, c.Name(), name))
+			}
+		}
+		list, ok := values[name].([]interface{})
+		if !ok {
+			list = []interface{}{values[name]}
+		}
+		for _, v := range list {
+			if err := c.Flags().Set(name, fmt.Sprint(v)); err != nil {
+				return newUsageError(fmt.Sprintf("environment %s: default for %s flag %s: %v", owner, c.Name(), name, err))
+			}
+		}
+	}
+	f := c.Flags().Lookup("yes")
+	if f == nil || f.Value.String() != "true" {
+		return nil
+	}
+	for _, env := range envs {
+		if app.Spec.Environments[env].RequireConfirmation {
+			sio.Noticef("environment %s requires confirmation, ignoring --yes\n", env)
+			return c.Flags().Set("yes", "false")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setEnvDefaults(s *scaffold, env string, cmd string, flags map[string]interface{}) {
+	e := s.opts.app.Spec.Environments[env]
+	e.Defaults = map[string]map[string]interface{}{cmd: flags}
+	s.opts.app.Spec.Environments[env] = e
+}
+
+func TestEnvDefaultsApplied(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setEnvDefaults(s, "dev", "show", map[string]interface{}{"format": "json", "sort-apply": true})
+	err := s.executeCommand("show", "dev")
+	require.Nil(t, err)
+	var data interface{}
+	require.Nil(t, s.jsonOutput(&data))
+	pos1 := strings.Index(s.stdout(), `"name": "foo-system"`)
+	pos2 := strings.Index(s.stdout(), `"name": "100-default"`)
+	assert.True(t, pos1 > pos2) // namespace after psp in apply sort
+}
+
+func TestEnvDefaultsCommandLineWins(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setEnvDefaults(s, "dev", "show", map[string]interface{}{"format": "json"})
+	err := s.executeCommand("show", "dev", "-o", "yaml")
+	require.Nil(t, err)
+	var data interface{}
+	assert.NotNil(t, s.jsonOutput(&data))
+}
+
+func TestEnvDefaultsNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		envs     map[string]map[string]interface{}
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "unknown flag",
+			envs: map[string]map[string]interface{}{"dev": {"upgrade": true}},
+			args: []string{"diff", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`environment dev: unknown flag "upgrade" in defaults for diff`, err.Error())
+			},
+		},
+		{
+			name: "bad value",
+			envs: map[string]map[string]interface{}{"dev": {"parallel": "many"}},
+			args: []string{"diff", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Contains(err.Error(), "environment dev: default for diff flag parallel:")
+			},
+		},
+		{
+			name: "different values",
+			envs: map[string]map[string]interface{}{"dev": {"parallel": 2}, "prod": {"parallel": 4}},
+			args: []string{"diff", "dev,prod"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("environments dev and prod have different defaults for diff flag parallel, specify it on the command line", err.Error())
+			},
+		},
+		{
+			name: "missing in one env",
+			envs: map[string]map[string]interface{}{"prod": {"parallel": 4}},
+			args: []string{"diff", "dev,prod"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("environments prod and dev have different defaults for diff flag parallel, specify it on the command line", err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			for env, flags := range test.envs {
+				setEnvDefaults(s, env, "diff", flags)
+			}
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
+
+func TestEnvDefaultsRequireConfirmation(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	e := s.opts.app.Spec.Environments["prod"]
+	e.RequireConfirmation = true
+	s.opts.app.Spec.Environments["prod"] = e
+
+	var yes bool
+	cmd := &cobra.Command{Use: "apply"}
+	cmd.Flags().BoolVar(&yes, "yes", false, "")
+	require.Nil(t, cmd.Flags().Set("yes", "true"))
+	a := assert.New(t)
+
+	require.Nil(t, applyEnvDefaults(cmd, s.opts.app, []string{"dev"}))
+	a.True(yes)
+
+	require.Nil(t, applyEnvDefaults(cmd, s.opts.app, []string{"all"}))
+	a.False(yes)
+	s.assertErrorLineMatch(regexp.MustCompile(`environment prod requires confirmation, ignoring --yes`))
+}
@@ -0,0 +1,792 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// specEditor edits the environments of a qbec.yaml file in place. Only the lines of edited attributes change, such
+// that the comments and formatting of everything else are preserved. Environments must be written in block style,
+// as qbec init does.
+type specEditor struct {
+	lines []string
+}
+
+func newSpecEditor(b []byte) *specEditor {
+	return &specEditor{lines: strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")}
+}
+
+// bytes returns the edited file.
+func (e *specEditor) bytes() []byte {
+	return []byte(strings.Join(e.lines, "\n") + "\n")
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// isContent returns true if the supplied line is not blank, a comment or a document marker.
+func isContent(line string) bool {
+	t := strings.TrimSpace(line)
+	return t != "" && !strings.HasPrefix(t, "#") && t != "---"
+}
+
+// yamlScalar returns the supplied string as a YAML scalar, quoted when needed.
+func yamlScalar(s string) string {
+	b, _ := yaml.Marshal(s)
+	return strings.TrimSpace(string(b))
+}
+
+// splitComment splits the supplied value of a mapping key into the value and a trailing comment.
+func splitComment(v string) (value, comment string) {
+	if strings.HasPrefix(v, "#") {
+		return "", v
+	}
+	start := 0
+	if len(v) > 0 && (v[0] == '"' || v[0] == '\'') {
+		q := v[0]
+		end := -1
+		for i := 1; i < len(v); i++ {
+			if q == '"' && v[i] == '\\' {
+				i++
+				continue
+			}
+			if v[i] == q {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return v, ""
+		}
+		start = end + 1
+	}
+	if pos := strings.Index(v[start:], " #"); pos >= 0 {
+		return strings.TrimSpace(v[:start+pos]), v[start+pos+1:]
+	}
+	return v, ""
+}
+
+// splitLine returns the key, value and trailing comment of the supplied line of a block mapping, with ok set to false
+// for lines that are not mapping keys.
+func splitLine(line string) (key, value, comment string, ok bool) {
+	t := strings.TrimLeft(line, " ")
+	var rest string
+	if len(t) > 0 && (t[0] == '"' || t[0] == '\'') {
+		end := strings.IndexByte(t[1:], t[0])
+		if end < 0 {
+			return "", "", "", false
+		}
+		if err := yaml.Unmarshal([]byte(t[:end+2]), &key); err != nil {
+			return "", "", "", false
+		}
+		rest = t[end+2:]
+	} else {
+		pos := -1
+		for i := 0; i < len(t); i++ {
+			if t[i] == ':' && (i == len(t)-1 || t[i+1] == ' ') {
+				pos = i
+				break
+			}
+		}
+		if pos <= 0 || strings.HasPrefix(t, "- ") || strings.HasPrefix(t, "#") {
+			return "", "", "", false
+		}
+		key, rest = t[:pos], t[pos:]
+	}
+	if !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+		return "", "", "", false
+	}
+	value, comment = splitComment(strings.TrimSpace(rest[1:]))
+	return key, value, comment, true
+}
+
+// blockEnd returns the index after the last content line of the block of the key at the supplied line. Lines of a
+// sequence at the indentation of the key belong to its block.
+func (e *specEditor) blockEnd(i int) int {
+	indent := indentOf(e.lines[i])
+	end := i + 1
+	for j := i + 1; j < len(e.lines); j++ {
+		l := e.lines[j]
+		if !isContent(l) {
+			continue
+		}
+		if in := indentOf(l); in < indent || (in == indent && !strings.HasPrefix(strings.TrimSpace(l), "- ")) {
+			break
+		}
+		end = j + 1
+	}
+	return end
+}
+
+// childIndent returns the indentation of the keys in the block of the key at the supplied line, or -1 if the block
+// has none.
+func (e *specEditor) childIndent(i, end int) int {
+	for j := i + 1; j < end; j++ {
+		if isContent(e.lines[j]) && indentOf(e.lines[j]) > indentOf(e.lines[i]) {
+			return indentOf(e.lines[j])
+		}
+	}
+	return -1
+}
+
+// findKey returns the line of the supplied key at the supplied indentation between the supplied lines, or -1.
+func (e *specEditor) findKey(start, end, indent int, key string) int {
+	for j := start; j < end; j++ {
+		if !isContent(e.lines[j]) || indentOf(e.lines[j]) != indent {
+			continue
+		}
+		if k, _, _, ok := splitLine(e.lines[j]); ok && k == key {
+			return j
+		}
+	}
+	return -1
+}
+
+func (e *specEditor) insert(at int, lines ...string) {
+	e.lines = append(e.lines[:at], append(lines, e.lines[at:]...)...)
+}
+
+func (e *specEditor) remove(start, end int) {
+	e.lines = append(e.lines[:start], e.lines[end:]...)
+}
+
+// blockHeader returns an error if the key at the supplied line has an inline value other than an empty mapping,
+// which is replaced by a block.
+func (e *specEditor) blockHeader(i int, what string) error {
+	k, v, comment, _ := splitLine(e.lines[i])
+	switch v {
+	case "":
+		return nil
+	case "{}":
+		e.lines[i] = strings.Repeat(" ", indentOf(e.lines[i])) + yamlScalar(k) + ":" + strings.TrimRight(" "+comment, " ")
+		return nil
+	default:
+		return fmt.Errorf("%s in qbec.yaml is not in block style and cannot be edited", what)
+	}
+}
+
+// spec returns the line of the spec key, the end of its block and the indentation of its attributes.
+func (e *specEditor) spec() (int, int, int, error) {
+	spec := e.findKey(0, len(e.lines), 0, "spec")
+	if spec < 0 {
+		return 0, 0, 0, fmt.Errorf("no spec found in qbec.yaml")
+	}
+	if err := e.blockHeader(spec, "spec"); err != nil {
+		return 0, 0, 0, err
+	}
+	specEnd := e.blockEnd(spec)
+	indent := e.childIndent(spec, specEnd)
+	if indent < 0 {
+		indent = 2
+	}
+	return spec, specEnd, indent, nil
+}
+
+// environments returns the line of the environments key and the indentation of its environments.
+func (e *specEditor) environments() (int, int, error) {
+	spec, specEnd, specIndent, err := e.spec()
+	if err != nil {
+		return 0, 0, err
+	}
+	h := e.findKey(spec+1, specEnd, specIndent, "environments")
+	if h < 0 {
+		return 0, 0, fmt.Errorf("no environments found in qbec.yaml")
+	}
+	if err := e.blockHeader(h, "environments"); err != nil {
+		return 0, 0, err
+	}
+	indent := e.childIndent(h, e.blockEnd(h))
+	if indent < 0 {
+		indent = indentOf(e.lines[h]) + 2
+	}
+	return h, indent, nil
+}
+
+// env returns the line of the supplied environment, the end of its block and the indentation of its attributes.
+func (e *specEditor) env(name string) (int, int, int, error) {
+	h, indent, err := e.environments()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	i := e.findKey(h+1, e.blockEnd(h), indent, name)
+	if i < 0 {
+		return 0, 0, 0, fmt.Errorf("environment %s is not defined in qbec.yaml", name)
+	}
+	if err := e.blockHeader(i, "environment "+name); err != nil {
+		return 0, 0, 0, err
+	}
+	end := e.blockEnd(i)
+	fi := e.childIndent(i, end)
+	if fi < 0 {
+		fi = indent + (indent - indentOf(e.lines[h]))
+	}
+	return i, end, fi, nil
+}
+
+// addEnv adds an environment with the supplied attributes at the end of the environments.
+func (e *specEditor) addEnv(name string) error {
+	h, indent, err := e.environments()
+	if err != nil {
+		return err
+	}
+	if e.findKey(h+1, e.blockEnd(h), indent, name) >= 0 {
+		return fmt.Errorf("environment %s is already defined in qbec.yaml", name)
+	}
+	e.insert(e.blockEnd(h), strings.Repeat(" ", indent)+yamlScalar(name)+":")
+	return nil
+}
+
+// removeEnv removes the supplied environment along with the comment lines directly above it.
+func (e *specEditor) removeEnv(name string) error {
+	i, end, _, err := e.env(name)
+	if err != nil {
+		return err
+	}
+	start := i
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(e.lines[start-1]), "#") && indentOf(e.lines[start-1]) == indentOf(e.lines[i]) {
+		start--
+	}
+	e.remove(start, end)
+	return nil
+}
+
+// setValue sets the supplied attribute of an environment to a scalar value, keeping the comment of an existing
+// value. New attributes are added after the existing ones.
+func (e *specEditor) setValue(name, key, value string) error {
+	i, end, fi, err := e.env(name)
+	if err != nil {
+		return err
+	}
+	line := strings.Repeat(" ", fi) + yamlScalar(key) + ": " + yamlScalar(value)
+	j := e.findKey(i+1, end, fi, key)
+	if j < 0 {
+		e.insert(end, line)
+		return nil
+	}
+	if _, _, comment, _ := splitLine(e.lines[j]); comment != "" {
+		line += " " + comment
+	}
+	e.lines[j] = line
+	return nil
+}
+
+// unsetValue removes the supplied attribute of an environment, if present.
+func (e *specEditor) unsetValue(name, key string) error {
+	i, end, fi, err := e.env(name)
+	if err != nil {
+		return err
+	}
+	if j := e.findKey(i+1, end, fi, key); j >= 0 {
+		e.remove(j, e.blockEnd(j))
+	}
+	return nil
+}
+
+// setMapValue sets a key of a mapping attribute of an environment, like properties, adding the attribute if needed.
+func (e *specEditor) setMapValue(name, attr, key, value string) error {
+	i, end, fi, err := e.env(name)
+	if err != nil {
+		return err
+	}
+	step := fi - indentOf(e.lines[i])
+	m := e.findKey(i+1, end, fi, attr)
+	if m < 0 {
+		e.insert(end, strings.Repeat(" ", fi)+yamlScalar(attr)+":", strings.Repeat(" ", fi+step)+yamlScalar(key)+": "+yamlScalar(value))
+		return nil
+	}
+	if err := e.blockHeader(m, attr+" of environment "+name); err != nil {
+		return err
+	}
+	mEnd := e.blockEnd(m)
+	ki := e.childIndent(m, mEnd)
+	if ki < 0 {
+		ki = fi + step
+	}
+	line := strings.Repeat(" ", ki) + yamlScalar(key) + ": " + yamlScalar(value)
+	j := e.findKey(m+1, mEnd, ki, key)
+	if j < 0 {
+		e.insert(mEnd, line)
+		return nil
+	}
+	if _, _, comment, _ := splitLine(e.lines[j]); comment != "" {
+		line += " " + comment
+	}
+	e.lines[j] = line
+	return nil
+}
+
+// unsetMapValue removes a key of a mapping attribute of an environment, removing the attribute when it has no
+// keys left.
+func (e *specEditor) unsetMapValue(name, attr, key string) error {
+	i, end, fi, err := e.env(name)
+	if err != nil {
+		return err
+	}
+	m := e.findKey(i+1, end, fi, attr)
+	if m < 0 {
+		return nil
+	}
+	if err := e.blockHeader(m, attr+" of environment "+name); err != nil {
+		return err
+	}
+	mEnd := e.blockEnd(m)
+	j := e.findKey(m+1, mEnd, e.childIndent(m, mEnd), key)
+	if j < 0 {
+		return nil
+	}
+	e.remove(j, e.blockEnd(j))
+	if e.childIndent(m, e.blockEnd(m)) < 0 {
+		e.remove(m, e.blockEnd(m))
+	}
+	return nil
+}
+
+// seqLines returns the lines of a new sequence of the supplied key with the supplied items, at the supplied indentation.
+func seqLines(indent int, key string, items []string) []string {
+	if len(items) == 0 {
+		return []string{strings.Repeat(" ", indent) + yamlScalar(key) + ": []"}
+	}
+	ret := []string{strings.Repeat(" ", indent) + yamlScalar(key) + ":"}
+	for _, item := range items {
+		ret = append(ret, strings.Repeat(" ", indent)+"- "+yamlScalar(item))
+	}
+	return ret
+}
+
+// seqHeader returns an error if the sequence key at the supplied line has an inline value other than an empty
+// sequence, which is replaced by a block. The second return value is false if the sequence is empty.
+func (e *specEditor) seqHeader(j int, what string) (bool, error) {
+	k, v, comment, _ := splitLine(e.lines[j])
+	switch v {
+	case "":
+		return true, nil
+	case "[]":
+		e.lines[j] = strings.Repeat(" ", indentOf(e.lines[j])) + yamlScalar(k) + ":" + strings.TrimRight(" "+comment, " ")
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s in qbec.yaml is not in block style and cannot be edited", what)
+	}
+}
+
+// seqItem returns the line of the supplied item in the sequence of the key at the supplied line, or -1.
+func (e *specEditor) seqItem(j int, item string) int {
+	for k := j + 1; k < e.blockEnd(j); k++ {
+		t := strings.TrimSpace(e.lines[k])
+		if !isContent(e.lines[k]) || !strings.HasPrefix(t, "- ") {
+			continue
+		}
+		v, _ := splitComment(strings.TrimSpace(t[2:]))
+		var s string
+		if err := yaml.Unmarshal([]byte(v), &s); err == nil && s == item {
+			return k
+		}
+	}
+	return -1
+}
+
+// addToList adds an item to the sequence of the supplied key in the block of the key at the supplied line, whose
+// attributes have the supplied indentation. A sequence that does not exist is added with the supplied current items,
+// which are inherited from elsewhere, followed by the item.
+func (e *specEditor) addToList(i, end, fi int, key, item string, current []string, what string) error {
+	j := e.findKey(i+1, end, fi, key)
+	if j < 0 {
+		e.insert(end, seqLines(fi, key, append(append([]string{}, current...), item))...)
+		return nil
+	}
+	if _, err := e.seqHeader(j, what); err != nil {
+		return err
+	}
+	if e.seqItem(j, item) >= 0 {
+		return nil
+	}
+	indent := fi
+	jEnd := e.blockEnd(j)
+	for k := j + 1; k < jEnd; k++ {
+		if isContent(e.lines[k]) {
+			indent = indentOf(e.lines[k])
+			break
+		}
+	}
+	e.insert(jEnd, strings.Repeat(" ", indent)+"- "+yamlScalar(item))
+	return nil
+}
+
+// removeFromList removes an item from the sequence of the supplied key in the block of the key at the supplied line,
+// whose attributes have the supplied indentation. A sequence that does not exist is added with the supplied current
+// items, which are inherited from elsewhere, except the item. A sequence that becomes empty is removed, or set to []
+// when keepEmpty is true.
+func (e *specEditor) removeFromList(i, end, fi int, key, item string, current []string, keepEmpty bool, what string) error {
+	j := e.findKey(i+1, end, fi, key)
+	if j < 0 {
+		var rest []string
+		for _, c := range current {
+			if c != item {
+				rest = append(rest, c)
+			}
+		}
+		if len(rest) < len(current) {
+			e.insert(end, seqLines(fi, key, rest)...)
+		}
+		return nil
+	}
+	hasItems, err := e.seqHeader(j, what)
+	if err != nil || !hasItems {
+		return err
+	}
+	k := e.seqItem(j, item)
+	if k < 0 {
+		return nil
+	}
+	e.remove(k, k+1)
+	if e.blockEnd(j) == j+1 {
+		if keepEmpty {
+			k, _, comment, _ := splitLine(e.lines[j])
+			e.lines[j] = strings.Repeat(" ", indentOf(e.lines[j])) + yamlScalar(k) + ": []" + strings.TrimRight(" "+comment, " ")
+		} else {
+			e.remove(j, j+1)
+		}
+	}
+	return nil
+}
+
+// writeAppFile replaces qbec.yaml in the current directory with the supplied content after checking that it loads
+// as a valid app that passes the supplied check.
+func writeAppFile(content []byte, check func(app *model.App) error) error {
+	tmp := appFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	app, err := model.NewApp(tmp)
+	if err == nil {
+		err = check(app)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("edited qbec.yaml is invalid, not updated: %v", err)
+	}
+	return os.Rename(tmp, appFile)
+}
+
+type envEditCommandConfig struct {
+	StdOptions
+	server          string
+	context         string
+	contextPattern  string
+	namespace       string
+	parent          string
+	properties      []string
+	unsetProperties []string
+}
+
+// bindings returns the server and context attributes to set, with a usage error if more than one is set.
+func (c envEditCommandConfig) bindings() (map[string]string, error) {
+	ret := map[string]string{}
+	for attr, v := range map[string]string{"server": c.server, "context": c.context, "contextPattern": c.contextPattern} {
+		if v != "" {
+			ret[attr] = v
+		}
+	}
+	if len(ret) > 1 {
+		return nil, newUsageError("only one of --server, --context and --context-pattern may be set")
+	}
+	return ret, nil
+}
+
+func (c envEditCommandConfig) parsedProperties() (map[string]string, error) {
+	ret := map[string]string{}
+	for _, p := range c.properties {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, newUsageError(fmt.Sprintf("invalid property %q, must be of the form key=value", p))
+		}
+		ret[parts[0]] = parts[1]
+	}
+	return ret, nil
+}
+
+// apply applies the attributes of the command to the supplied environment and returns a check that the loaded app
+// has them.
+func (c envEditCommandConfig) apply(e *specEditor, name string) (func(app *model.App) error, error) {
+	bindings, err := c.bindings()
+	if err != nil {
+		return nil, err
+	}
+	props, err := c.parsedProperties()
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range []string{"server", "context", "contextPattern"} {
+		if len(bindings) == 0 {
+			break
+		}
+		if v, ok := bindings[attr]; ok {
+			err = e.setValue(name, attr, v)
+		} else {
+			err = e.unsetValue(name, attr)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range []struct{ attr, value string }{{"defaultNamespace", c.namespace}, {"parent", c.parent}} {
+		if a.value == "" {
+			continue
+		}
+		if err := e.setValue(name, a.attr, a.value); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range sortedStringKeys(props) {
+		if err := e.setMapValue(name, "properties", k, props[k]); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range c.unsetProperties {
+		if err := e.unsetMapValue(name, "properties", k); err != nil {
+			return nil, err
+		}
+	}
+	return func(app *model.App) error {
+		env, ok := app.Spec.Environments[name]
+		if !ok {
+			return fmt.Errorf("environment %s not found", name)
+		}
+		actual := map[string]string{"server": env.Server, "context": env.Context, "contextPattern": env.ContextPattern}
+		for attr, v := range bindings {
+			if actual[attr] != v {
+				return fmt.Errorf("environment %s has %s %q instead of %q", name, attr, actual[attr], v)
+			}
+		}
+		if c.namespace != "" && env.DefaultNamespace != c.namespace {
+			return fmt.Errorf("environment %s has default namespace %q instead of %q", name, env.DefaultNamespace, c.namespace)
+		}
+		for k, v := range props {
+			if env.Properties[k] != v {
+				return fmt.Errorf("environment %s has property %s %q instead of %q", name, k, env.Properties[k], v)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// sortedStringKeys returns the keys of the supplied map in sorted order.
+func sortedStringKeys(m map[string]string) []string {
+	var ret []string
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// editAppFile edits qbec.yaml in the current directory with the supplied function, which returns a check for the
+// loaded app after the edit.
+func editAppFile(edit func(e *specEditor) (func(app *model.App) error, error)) error {
+	b, err := ioutil.ReadFile(appFile)
+	if err != nil {
+		return err
+	}
+	e := newSpecEditor(b)
+	check, err := edit(e)
+	if err != nil {
+		return err
+	}
+	return writeAppFile(e.bytes(), check)
+}
+
+func doEnvAdd(args []string, config envEditCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	name := args[0]
+	if len(config.unsetProperties) > 0 {
+		return newUsageError("--unset-property cannot be used when adding an environment")
+	}
+	bindings, err := config.bindings()
+	if err != nil {
+		return err
+	}
+	if len(bindings) == 0 && config.parent == "" {
+		return newUsageError("one of --server, --context, --context-pattern or --parent is required")
+	}
+	if _, ok := config.App().Spec.Environments[name]; ok {
+		return fmt.Errorf("environment %s already exists", name)
+	}
+	err = editAppFile(func(e *specEditor) (func(app *model.App) error, error) {
+		if err := e.addEnv(name); err != nil {
+			return nil, err
+		}
+		return config.apply(e, name)
+	})
+	if err != nil {
+		return err
+	}
+	sio.Noticeln("added environment", name, "to qbec.yaml")
+	return nil
+}
+
+func doEnvSet(args []string, config envEditCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	name := args[0]
+	if config.server == "" && config.context == "" && config.contextPattern == "" && config.namespace == "" &&
+		config.parent == "" && len(config.properties) == 0 && len(config.unsetProperties) == 0 {
+		return newUsageError("nothing to set")
+	}
+	if _, ok := config.App().Spec.Environments[name]; !ok {
+		return newUsageError(fmt.Sprintf("invalid environment %q", name))
+	}
+	if err := checkNotCluster(config.App(), name); err != nil {
+		return err
+	}
+	err := editAppFile(func(e *specEditor) (func(app *model.App) error, error) {
+		return config.apply(e, name)
+	})
+	if err != nil {
+		return err
+	}
+	sio.Noticeln("updated environment", name, "in qbec.yaml")
+	return nil
+}
+
+func doEnvRemove(args []string, config envEditCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	name := args[0]
+	app := config.App()
+	if _, ok := app.Spec.Environments[name]; !ok {
+		return newUsageError(fmt.Sprintf("invalid environment %q", name))
+	}
+	if err := checkNotCluster(app, name); err != nil {
+		return err
+	}
+	for _, other := range sortedEnvNames(app) {
+		if app.Spec.Environments[other].Parent == name {
+			return fmt.Errorf("environment %s is the parent of environment %s", name, other)
+		}
+	}
+	for _, group := range sortedKeys(app.Spec.EnvGroups) {
+		for _, member := range app.Spec.EnvGroups[group] {
+			if member == name {
+				return fmt.Errorf("environment %s is a member of environment group %s", name, group)
+			}
+		}
+	}
+	err := editAppFile(func(e *specEditor) (func(app *model.App) error, error) {
+		if err := e.removeEnv(name); err != nil {
+			return nil, err
+		}
+		return func(app *model.App) error {
+			if _, ok := app.Spec.Environments[name]; ok {
+				return fmt.Errorf("environment %s still exists", name)
+			}
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+	sio.Noticeln("removed environment", name, "from qbec.yaml")
+	return nil
+}
+
+// checkNotCluster returns a usage error if the supplied environment is the environment of a cluster, which is not
+// defined in qbec.yaml by itself.
+func checkNotCluster(app *model.App, name string) error {
+	if c := app.Cluster(name); c != nil {
+		return newUsageError(fmt.Sprintf("environment %s is cluster %s of environment %s, edit environment %s instead", name, c.Name, c.Base, c.Base))
+	}
+	return nil
+}
+
+// sortedEnvNames returns the names of the environments of the supplied app in sorted order.
+func sortedEnvNames(app *model.App) []string {
+	var ret []string
+	for name := range app.Spec.Environments {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// addEnvEditFlags adds the flags for environment attributes to the supplied command.
+func addEnvEditFlags(cmd *cobra.Command, config *envEditCommandConfig) {
+	cmd.Flags().StringVar(&config.server, "server", "", "server URL of the environment")
+	cmd.Flags().StringVar(&config.context, "context", "", "kubeconfig context of the environment")
+	cmd.Flags().StringVar(&config.contextPattern, "context-pattern", "", "regular expression matching the single kubeconfig context of the environment")
+	cmd.Flags().StringVar(&config.namespace, "namespace", "", "default namespace of the environment")
+	cmd.Flags().StringVar(&config.parent, "parent", "", "environment to inherit unset attributes from")
+	cmd.Flags().StringArrayVar(&config.properties, "property", nil, "property to set as key=value, may be repeated")
+}
+
+func newEnvAddCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "add <environment> --server <url>|--context <name>|--context-pattern <regex>|--parent <environment>",
+		Short:   "add an environment to qbec.yaml, preserving its comments and formatting",
+		Example: envAddExamples(),
+	}
+	config := envEditCommandConfig{}
+	addEnvEditFlags(cmd, &config)
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doEnvAdd(args, config))
+	}
+	return cmd
+}
+
+func newEnvSetCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "set <environment>",
+		Short:   "change attributes of an environment in qbec.yaml, preserving its comments and formatting",
+		Example: envSetExamples(),
+	}
+	config := envEditCommandConfig{}
+	addEnvEditFlags(cmd, &config)
+	cmd.Flags().StringArrayVar(&config.unsetProperties, "unset-property", nil, "property to remove, may be repeated")
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doEnvSet(args, config))
+	}
+	return cmd
+}
+
+func newEnvRemoveCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "remove <environment>",
+		Short:   "remove an environment from qbec.yaml, preserving its comments and formatting",
+		Example: envRemoveExamples(),
+	}
+	config := envEditCommandConfig{}
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doEnvRemove(args, config))
+	}
+	return cmd
+}
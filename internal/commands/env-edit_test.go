@@ -0,0 +1,428 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const editTestApp = `---
+# the app
+apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: example1
+spec:
+  excludes:
+  - service2
+  environments:
+    # the dev cluster
+    dev:
+      server: https://dev-server # moved in 2019
+      includes:
+      - service2
+      properties:
+        domain: dev.example.com # public
+        legacy: "true"
+    prod: {}
+  # trailing comment
+  libPaths:
+  - lib
+`
+
+func TestSpecEditor(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(e *specEditor) error
+		expected string
+	}{
+		{
+			name: "set existing",
+			edit: func(e *specEditor) error {
+				return e.setValue("dev", "server", "https://dev-2")
+			},
+			expected: `      server: https://dev-2 # moved in 2019
+`,
+		},
+		{
+			name: "set new",
+			edit: func(e *specEditor) error {
+				return e.setValue("dev", "defaultNamespace", "web")
+			},
+			expected: `        legacy: "true"
+      defaultNamespace: web
+    prod: {}
+`,
+		},
+		{
+			name: "set in empty",
+			edit: func(e *specEditor) error {
+				return e.setValue("prod", "context", "prod-admin")
+			},
+			expected: `    prod:
+      context: prod-admin
+  # trailing comment
+`,
+		},
+		{
+			name: "unset",
+			edit: func(e *specEditor) error {
+				return e.unsetValue("dev", "includes")
+			},
+			expected: `      server: https://dev-server # moved in 2019
+      properties:
+`,
+		},
+		{
+			name: "set property",
+			edit: func(e *specEditor) error {
+				if err := e.setMapValue("dev", "properties", "domain", "dev2.example.com"); err != nil {
+					return err
+				}
+				return e.setMapValue("dev", "properties", "tier", "gold")
+			},
+			expected: `        domain: dev2.example.com # public
+        legacy: "true"
+        tier: gold
+`,
+		},
+		{
+			name: "new properties",
+			edit: func(e *specEditor) error {
+				return e.setMapValue("prod", "properties", "domain", "example.com")
+			},
+			expected: `    prod:
+      properties:
+        domain: example.com
+`,
+		},
+		{
+			name: "unset properties",
+			edit: func(e *specEditor) error {
+				if err := e.unsetMapValue("dev", "properties", "domain"); err != nil {
+					return err
+				}
+				return e.unsetMapValue("dev", "properties", "legacy")
+			},
+			expected: `      - service2
+    prod: {}
+`,
+		},
+		{
+			name: "add",
+			edit: func(e *specEditor) error {
+				if err := e.addEnv("stage"); err != nil {
+					return err
+				}
+				return e.setValue("stage", "server", "https://stage:443")
+			},
+			expected: `    prod: {}
+    stage:
+      server: https://stage:443
+  # trailing comment
+`,
+		},
+		{
+			name: "add to list",
+			edit: func(e *specEditor) error {
+				i, end, fi, err := e.env("dev")
+				if err != nil {
+					return err
+				}
+				return e.addToList(i, end, fi, "includes", "service1", nil, "includes")
+			},
+			expected: `      includes:
+      - service2
+      - service1
+      properties:
+`,
+		},
+		{
+			name: "add new list",
+			edit: func(e *specEditor) error {
+				i, end, fi, err := e.env("prod")
+				if err != nil {
+					return err
+				}
+				return e.addToList(i, end, fi, "excludes", "service1", []string{"routes"}, "excludes")
+			},
+			expected: `    prod:
+      excludes:
+      - routes
+      - service1
+  # trailing comment
+`,
+		},
+		{
+			name: "remove from list",
+			edit: func(e *specEditor) error {
+				i, end, fi, err := e.spec()
+				if err != nil {
+					return err
+				}
+				return e.removeFromList(i, end, fi, "excludes", "service2", nil, false, "excludes")
+			},
+			expected: `spec:
+  environments:
+`,
+		},
+		{
+			name: "remove from list keep empty",
+			edit: func(e *specEditor) error {
+				i, end, fi, err := e.env("dev")
+				if err != nil {
+					return err
+				}
+				return e.removeFromList(i, end, fi, "includes", "service2", nil, true, "includes")
+			},
+			expected: `      server: https://dev-server # moved in 2019
+      includes: []
+      properties:
+`,
+		},
+		{
+			name: "remove from inherited list",
+			edit: func(e *specEditor) error {
+				i, end, fi, err := e.env("prod")
+				if err != nil {
+					return err
+				}
+				return e.removeFromList(i, end, fi, "includes", "service2", []string{"service2", "routes"}, true, "includes")
+			},
+			expected: `    prod:
+      includes:
+      - routes
+  # trailing comment
+`,
+		},
+		{
+			name: "remove",
+			edit: func(e *specEditor) error {
+				return e.removeEnv("dev")
+			},
+			expected: `  environments:
+    prod: {}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newSpecEditor([]byte(editTestApp))
+			require.Nil(t, test.edit(e))
+			out := string(e.bytes())
+			assert.Contains(t, out, test.expected)
+			assert.Contains(t, out, "---\n# the app\n")
+			assert.Contains(t, out, "  # trailing comment\n  libPaths:\n  - lib\n")
+		})
+	}
+}
+
+func TestSpecEditorNegative(t *testing.T) {
+	e := newSpecEditor([]byte(editTestApp))
+	a := assert.New(t)
+	err := e.setValue("stage", "server", "https://stage")
+	require.NotNil(t, err)
+	a.Equal("environment stage is not defined in qbec.yaml", err.Error())
+	err = e.addEnv("dev")
+	require.NotNil(t, err)
+	a.Equal("environment dev is already defined in qbec.yaml", err.Error())
+
+	e = newSpecEditor([]byte("spec:\n  excludes: [service2]\n"))
+	spec, end, fi, err := e.spec()
+	require.Nil(t, err)
+	err = e.addToList(spec, end, fi, "excludes", "service1", nil, "excludes")
+	require.NotNil(t, err)
+	a.Equal("excludes in qbec.yaml is not in block style and cannot be edited", err.Error())
+
+	e = newSpecEditor([]byte("spec:\n  environments: { dev: { server: https://dev } }\n"))
+	err = e.setValue("dev", "server", "https://dev-2")
+	require.NotNil(t, err)
+	a.Equal("environments in qbec.yaml is not in block style and cannot be edited", err.Error())
+}
+
+// editInTempDir changes to a temporary copy of the qbec.yaml, params and components of the test app and returns a
+// function to change back.
+func editInTempDir(t *testing.T) func() {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "env-edit")
+	require.Nil(t, err)
+	for _, f := range []string{"qbec.yaml", "params.libsonnet"} {
+		b, err := ioutil.ReadFile(f)
+		require.Nil(t, err)
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, f), b, 0644))
+	}
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	copyDir := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(wd, path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, rel), b, 0644)
+	}
+	for _, d := range []string{"components", "environments", "lib"} {
+		require.Nil(t, filepath.Walk(filepath.Join(wd, d), copyDir))
+	}
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEnvAddSetRemove(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	orig, err := ioutil.ReadFile("qbec.yaml")
+	require.Nil(t, err)
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err = s.executeCommand("env", "add", "stage", "--context", "stage-admin", "--namespace", "web", "--property", "domain=stage.example.com")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`added environment stage to qbec.yaml`))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(model.Environment{Context: "stage-admin", DefaultNamespace: "web", Properties: map[string]string{"domain": "stage.example.com"}}, app.Spec.Environments["stage"])
+
+	s.opts.app = app
+	err = s.executeCommand("env", "set", "stage", "--server", "https://stage-server", "--unset-property", "domain")
+	require.Nil(t, err)
+	app, err = model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(model.Environment{Server: "https://stage-server", DefaultNamespace: "web"}, app.Spec.Environments["stage"])
+
+	s.opts.app = app
+	err = s.executeCommand("env", "remove", "stage")
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(string(orig), string(b))
+}
+
+func TestEnvEditNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "add no args",
+			args: []string{"env", "add", "--server", "https://foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("exactly one environment required", err.Error())
+			},
+		},
+		{
+			name: "add no binding",
+			args: []string{"env", "add", "stage"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("one of --server, --context, --context-pattern or --parent is required", err.Error())
+			},
+		},
+		{
+			name: "add two bindings",
+			args: []string{"env", "add", "stage", "--server", "https://foo", "--context", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("only one of --server, --context and --context-pattern may be set", err.Error())
+			},
+		},
+		{
+			name: "add existing",
+			args: []string{"env", "add", "dev", "--server", "https://foo"},
+			asserter: func(s *scaffold, err error) {
+				assert.Equal(s.t, "environment dev already exists", err.Error())
+			},
+		},
+		{
+			name: "add bad property",
+			args: []string{"env", "add", "stage", "--server", "https://foo", "--property", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid property "foo", must be of the form key=value`, err.Error())
+			},
+		},
+		{
+			name: "add bad parent",
+			args: []string{"env", "add", "stage", "--parent", "base"},
+			asserter: func(s *scaffold, err error) {
+				assert.Equal(s.t, `edited qbec.yaml is invalid, not updated: environment stage: parent "base" is not an environment`, err.Error())
+				_, statErr := os.Stat("qbec.yaml.tmp")
+				assert.True(s.t, os.IsNotExist(statErr))
+			},
+		},
+		{
+			name: "set nothing",
+			args: []string{"env", "set", "dev"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("nothing to set", err.Error())
+			},
+		},
+		{
+			name: "set bad env",
+			args: []string{"env", "set", "stage", "--namespace", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "stage"`, err.Error())
+			},
+		},
+		{
+			name: "remove group member",
+			args: []string{"env", "remove", "dev"},
+			asserter: func(s *scaffold, err error) {
+				assert.Equal(s.t, "environment dev is a member of environment group all", err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			reset := editInTempDir(t)
+			defer reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
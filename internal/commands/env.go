@@ -0,0 +1,170 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/remote"
+)
+
+func newEnvCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env <subcommand>",
+		Short: "environment lists and edits",
+	}
+	cmd.AddCommand(newEnvListCommand(op), newEnvCheckCommand(op), newEnvAddCommand(op), newEnvSetCommand(op), newEnvRemoveCommand(op))
+	return cmd
+}
+
+// envInfo is the listing of a single environment.
+type envInfo struct {
+	Name             string                  `json:"name"`
+	Server           string                  `json:"server,omitempty"`
+	Context          string                  `json:"context,omitempty"`
+	ContextPattern   string                  `json:"contextPattern,omitempty"`
+	Clusters         []string                `json:"clusters,omitempty"`
+	DefaultNamespace string                  `json:"defaultNamespace"`
+	Resolved         *remote.ResolvedContext `json:"resolved,omitempty"`
+	Error            string                  `json:"error,omitempty"`
+}
+
+// binding returns how the environment is bound to a cluster, for display.
+func (e envInfo) binding() string {
+	switch {
+	case e.Context != "":
+		return "context " + e.Context
+	case e.ContextPattern != "":
+		return "contexts matching " + e.ContextPattern
+	case len(e.Clusters) > 0:
+		return "clusters " + strings.Join(e.Clusters, ", ")
+	default:
+		return e.Server
+	}
+}
+
+func listEnvs(envs []envInfo, resolve bool, format string, w io.Writer) error {
+	switch format {
+	case "":
+		if !resolve {
+			fmt.Fprintf(w, "%-20s %-20s %s\n", "ENVIRONMENT", "NAMESPACE", "BINDING")
+			for _, e := range envs {
+				fmt.Fprintf(w, "%-20s %-20s %s\n", e.Name, e.DefaultNamespace, e.binding())
+			}
+			return nil
+		}
+		fmt.Fprintf(w, "%-20s %-20s %-30s %-30s %s\n", "ENVIRONMENT", "NAMESPACE", "CONTEXT", "CLUSTER", "SERVER")
+		for _, e := range envs {
+			if e.Resolved == nil {
+				fmt.Fprintf(w, "%-20s %-20s error: %s\n", e.Name, e.DefaultNamespace, e.Error)
+				continue
+			}
+			ctx := e.Resolved.Context
+			if ctx == "" {
+				ctx = "-"
+			}
+			fmt.Fprintf(w, "%-20s %-20s %-30s %-30s %s\n", e.Name, e.DefaultNamespace, ctx, e.Resolved.Cluster, e.Resolved.ServerURL)
+		}
+		return nil
+	case "yaml":
+		b, err := yaml.Marshal(envs)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(envs)
+	default:
+		return newUsageError(fmt.Sprintf("listEnvs: unsupported format %q", format))
+	}
+}
+
+type envListCommandConfig struct {
+	StdOptionsWithClient
+	format  string
+	resolve bool
+}
+
+func doEnvList(args []string, config envListCommandConfig) error {
+	if len(args) != 0 {
+		return newUsageError("no arguments expected")
+	}
+	app := config.App()
+	var names []string
+	for name := range app.Spec.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var envs []envInfo
+	failed := 0
+	for _, name := range names {
+		e := app.Spec.Environments[name]
+		info := envInfo{
+			Name:             name,
+			Server:           e.Server,
+			Context:          e.Context,
+			ContextPattern:   e.ContextPattern,
+			Clusters:         app.ClusterEnvironments(name),
+			DefaultNamespace: e.DefaultNamespace,
+		}
+		if info.DefaultNamespace == "" {
+			info.DefaultNamespace = "default"
+		}
+		if config.resolve {
+			rc, err := config.ResolveContext(name)
+			if err != nil {
+				info.Error = err.Error()
+				failed++
+			}
+			info.Resolved = rc
+		}
+		envs = append(envs, info)
+	}
+	if err := listEnvs(envs, config.resolve, config.format, config.Stdout()); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d environment(s) could not be resolved", failed)
+	}
+	return nil
+}
+
+func newEnvListCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list [--resolve]",
+		Short:   "list the environments of the app and the servers or kubeconfig contexts they are bound to",
+		Example: envListExamples(),
+	}
+	config := envListCommandConfig{}
+	cmd.Flags().BoolVar(&config.resolve, "resolve", false, "show the kubeconfig context, cluster and server that each environment resolves to")
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable input")
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptionsWithClient = op()
+		return wrapError(doEnvList(args, config))
+	}
+	return cmd
+}
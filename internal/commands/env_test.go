@@ -0,0 +1,81 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvList(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Environments["stage"] = model.Environment{ContextPattern: "^stage-", DefaultNamespace: "web"}
+	err := s.executeCommand("env", "list")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^ENVIRONMENT\s+NAMESPACE\s+BINDING$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^dev\s+default\s+https://dev-server$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^stage\s+web\s+contexts matching \^stage-$`))
+}
+
+func TestEnvListResolve(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Environments["stage"] = model.Environment{Context: "stage-1"}
+	s.opts.contexts = map[string]*remote.ResolvedContext{
+		"dev":   {Context: "dev", Cluster: "dev-cluster", ServerURL: "https://dev-server"},
+		"stage": {Context: "stage-1", Cluster: "stage-cluster", ServerURL: "https://stage-1"},
+	}
+	err := s.executeCommand("env", "list", "--resolve")
+	require.NotNil(t, err)
+	assert.Equal(t, "1 environment(s) could not be resolved", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`^ENVIRONMENT\s+NAMESPACE\s+CONTEXT\s+CLUSTER\s+SERVER$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^dev\s+default\s+dev\s+dev-cluster\s+https://dev-server$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^prod\s+default\s+error: no context for env prod$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^stage\s+default\s+stage-1\s+stage-cluster\s+https://stage-1$`))
+}
+
+func TestEnvListJSON(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.contexts = map[string]*remote.ResolvedContext{
+		"dev":  {Context: "dev", Cluster: "dev-cluster", ServerURL: "https://dev-server"},
+		"prod": {Cluster: "prod-cluster", ServerURL: "https://prod-server"},
+	}
+	err := s.executeCommand("env", "list", "--resolve", "-o", "json")
+	require.Nil(t, err)
+	var out []envInfo
+	err = s.jsonOutput(&out)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(out))
+	assert.Equal(t, envInfo{Name: "prod", Server: "https://prod-server", DefaultNamespace: "default", Resolved: s.opts.contexts["prod"]}, out[1])
+}
+
+func TestEnvListNegative(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("env", "list", "dev")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.True(isUsageError(err))
+	a.Equal("no arguments expected", err.Error())
+}
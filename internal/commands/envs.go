@@ -0,0 +1,135 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// expandClusters replaces environments that are deployed to multiple clusters with the environments of their
+// clusters.
+func expandClusters(app *model.App, envs []string) []string {
+	var ret []string
+	for _, env := range envs {
+		if clusters := app.ClusterEnvironments(env); clusters != nil {
+			ret = append(ret, clusters...)
+			continue
+		}
+		ret = append(ret, env)
+	}
+	return ret
+}
+
+// expandEnvironments returns the environments named by the supplied argument, a comma-separated list of environment
+// names, environment groups and glob patterns like us-*. Groups and patterns are expanded in place, in the order in
+// which they list or sort the environments, and environments deployed to multiple clusters are expanded to the
+// environments of their clusters. Environments named more than once are only returned the first time. Patterns do not match cluster environments. The second return value is false if
+// the argument is a single name that is not a group or a multi-cluster environment, which includes names of
+// environments that do not exist.
+func expandEnvironments(app *model.App, arg string) ([]string, bool, error) {
+	parts := strings.Split(arg, ",")
+	if len(parts) == 1 && !strings.ContainsAny(arg, "*?[") {
+		if _, ok := app.Spec.EnvGroups[arg]; !ok {
+			if clusters := app.ClusterEnvironments(arg); clusters != nil {
+				return clusters, true, nil
+			}
+			return []string{arg}, false, nil
+		}
+	}
+	var names []string
+	for name := range app.Spec.Environments {
+		if app.Cluster(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var ret []string
+	for _, p := range parts {
+		if members, ok := app.Spec.EnvGroups[p]; ok {
+			ret = append(ret, members...)
+			continue
+		}
+		if !strings.ContainsAny(p, "*?[") {
+			ret = append(ret, p)
+			continue
+		}
+		var matched []string
+		for _, name := range names {
+			ok, err := path.Match(p, name)
+			if err != nil {
+				return nil, false, newUsageError(fmt.Sprintf("invalid environment pattern %q", p))
+			}
+			if ok {
+				matched = append(matched, name)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, false, newUsageError(fmt.Sprintf("no environments match %q", p))
+		}
+		ret = append(ret, matched...)
+	}
+	return dedupe(expandClusters(app, ret)), true, nil
+}
+
+// dedupe returns the supplied names without duplicates, keeping the first occurrence of each name.
+func dedupe(names []string) []string {
+	seen := map[string]bool{}
+	var ret []string
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// envResults is the combined summary of running a command for multiple environments.
+type envResults struct {
+	Succeeded []string          `json:"succeeded,omitempty"`
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+// runEnvironments runs the supplied function for each environment in turn and prints a combined summary of the
+// results at the end. A usage error stops the run immediately.
+func runEnvironments(w io.Writer, action string, envs []string, run func(env string) error) error {
+	summary := envResults{Failed: map[string]string{}}
+	for _, env := range envs {
+		sio.Noticeln("running", action, "for environment", env)
+		if err := run(env); err != nil {
+			if isUsageError(err) {
+				return err
+			}
+			sio.Errorf("environment %s: %v\n", env, err)
+			summary.Failed[env] = err.Error()
+			continue
+		}
+		summary.Succeeded = append(summary.Succeeded, env)
+	}
+	printStats(w, &summary)
+	if len(summary.Failed) > 0 {
+		return fmt.Errorf("%s failed for %d of %d environment(s)", action, len(summary.Failed), len(envs))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnvironments(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	tests := []struct {
+		arg   string
+		envs  []string
+		multi bool
+	}{
+		{arg: "dev", envs: []string{"dev"}},
+		{arg: "foo", envs: []string{"foo"}},
+		{arg: "_", envs: []string{"_"}},
+		{arg: "all", envs: []string{"dev", "prod"}, multi: true},
+		{arg: "prod,dev", envs: []string{"prod", "dev"}, multi: true},
+		{arg: "*", envs: []string{"dev", "prod"}, multi: true},
+		{arg: "d?v", envs: []string{"dev"}, multi: true},
+		{arg: "p*,all", envs: []string{"prod", "dev"}, multi: true},
+		{arg: "dev,dev", envs: []string{"dev"}, multi: true},
+	}
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			envs, multi, err := expandEnvironments(s.opts.App(), test.arg)
+			require.Nil(t, err)
+			a := assert.New(t)
+			a.Equal(test.envs, envs)
+			a.Equal(test.multi, multi)
+		})
+	}
+	a := assert.New(t)
+	_, _, err := expandEnvironments(s.opts.App(), "us-*")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal(`no environments match "us-*"`, err.Error())
+	_, _, err = expandEnvironments(s.opts.App(), "dev,[")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal(`invalid environment pattern "["`, err.Error())
+}
+
+func TestDiffMultipleEnvironments(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	d := &dg{cmValue: "bar", secretValue: "bar"}
+	s.opts.client.getFunc = d.get
+	err := s.executeCommand("diff", "all", "-c", "service2", "--ignore-all-annotations", "--ignore-all-labels", "--show-deletes=false")
+	require.Nil(t, err)
+	stats := s.outputStats()
+	assert.EqualValues(t, []interface{}{"dev", "prod"}, stats["succeeded"])
+	s.assertErrorLineMatch(regexp.MustCompile(`running diff for environment prod`))
+}
+
+func TestValidateMultipleEnvironments(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	err := s.executeCommand("validate", "*")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("validate failed for 2 of 2 environment(s)", err.Error())
+	stats := s.outputStats()
+	a.EqualValues(map[string]interface{}{"dev": "1 invalid objects found", "prod": "1 invalid objects found"}, stats["failed"])
+	s.assertErrorLineMatch(regexp.MustCompile(`environment dev: 1 invalid objects found`))
+
+	err = s.executeCommand("validate", "all", "-o", "json")
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal("--format cannot be used with multiple environments", err.Error())
+}
+
+// loadClusterApp replaces the app of the scaffold with one in which prod is deployed to two clusters.
+func loadClusterApp(t *testing.T, s *scaffold) {
+	b, err := ioutil.ReadFile("qbec.yaml")
+	require.Nil(t, err)
+	clusters := `      clusters:
+      - name: us-east
+        server: https://us-east-server
+        properties:
+          domain: us-east.example.com
+      - name: eu-west
+        server: https://eu-west-server
+`
+	contents := strings.Replace(string(b), "      server: https://prod-server\n", clusters, 1)
+	file := "qbec-clusters.yaml"
+	require.Nil(t, ioutil.WriteFile(file, []byte(contents), 0644))
+	defer os.Remove(file)
+	app, err := model.NewApp(file)
+	require.Nil(t, err)
+	s.opts.app = app
+}
+
+func TestExpandEnvironmentsClusters(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	loadClusterApp(t, s)
+	tests := []struct {
+		arg   string
+		envs  []string
+		multi bool
+	}{
+		{arg: "prod", envs: []string{"prod.us-east", "prod.eu-west"}, multi: true},
+		{arg: "prod.eu-west", envs: []string{"prod.eu-west"}},
+		{arg: "all", envs: []string{"dev", "prod.us-east", "prod.eu-west"}, multi: true},
+		{arg: "p*", envs: []string{"prod.us-east", "prod.eu-west"}, multi: true},
+		{arg: "dev,prod.us-east", envs: []string{"dev", "prod.us-east"}, multi: true},
+	}
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			envs, multi, err := expandEnvironments(s.opts.App(), test.arg)
+			require.Nil(t, err)
+			a := assert.New(t)
+			a.Equal(test.envs, envs)
+			a.Equal(test.multi, multi)
+		})
+	}
+}
+
+func TestDiffClusters(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	loadClusterApp(t, s)
+	d := &dg{cmValue: "bar", secretValue: "bar"}
+	s.opts.client.getFunc = d.get
+	err := s.executeCommand("diff", "prod", "-c", "service2", "--ignore-all-annotations", "--ignore-all-labels", "--show-deletes=false")
+	require.Nil(t, err)
+	stats := s.outputStats()
+	assert.EqualValues(t, []interface{}{"prod.us-east", "prod.eu-west"}, stats["succeeded"])
+	s.assertErrorLineMatch(regexp.MustCompile(`running diff for environment prod.eu-west`))
+}
+
+func TestShowCluster(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	loadClusterApp(t, s)
+	err := s.executeCommand("show", "prod.us-east", "-c", "service2", "-k", "configmap", "-o", "yaml")
+	require.Nil(t, err)
+	out, err := s.yamlOutput()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(out))
+	labels := out[0].(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	assert.Equal(t, "prod.us-east", labels[model.QbecNames.EnvironmentLabel])
+}
@@ -50,8 +50,41 @@ func applyExamples() string {
 	return exampleHelp(
 		newExample("apply dev", "create/ update all dev components and delete extra objects on the server"),
 		newExample("apply -n dev", "show what apply would do for the dev environment"),
+		newExample("apply --dry-run=server --show-diff dev", "have the server process all changes without persisting them and show diffs of the results"),
 		newExample("apply dev -c redis -K secret", "update all objects except secrets just for the redis component"),
 		newExample("apply dev --gc=false", "only create/ update, do not delete extra objects from the server"),
+		newExample("apply dev --update-only=error", "only update existing objects and fail if any object does not exist"),
+		newExample("apply dev --gc-dry-run --gc-exclude-kind persistentvolumeclaim", "list objects that would be garbage collected, except volume claims"),
+		newExample("apply dev --gc-dry-run -o table", "list objects that would be garbage collected as a table"),
+		newExample("apply stage,prod --continue-on-error", "apply to the stage and prod environments one after the other"),
+		newExample("apply 'us-*' --parallel-envs 2", "apply to all environments with names starting with us-, 2 at a time"),
+		newExample("apply --env-group prod-fleet --parallel-envs 5", "apply to all environments in the prod-fleet group, 5 at a time"),
+		newExample("apply --env-group prod-fleet --canary-env prod-east", "apply to prod-east first and to the other environments only after its objects are ready"),
+		newExample("apply dev --canary-selector track=canary", "apply objects labeled as canaries first and halt if they do not become ready"),
+		newExample("apply dev --wait", "wait for all created/ updated objects to be ready, including custom resources"),
+		newExample("apply dev --changed-only", "only update objects whose local configuration has changed since the last apply"),
+		newExample("apply dev --check-quotas", "fail before applying anything if objects do not fit in the resource quotas of their namespaces"),
+		newExample("apply dev --resume .qbec/checkpoints/apply-dev.json", "continue a failed apply, skipping objects it already applied"),
+		newExample("apply dev --confirm-component-removal", "apply and garbage collect objects of components that were deleted or renamed in source"),
+		newExample("apply dev --allow-large-changes", "apply even when more objects are changed or deleted than the change limits in qbec.yaml allow"),
+		newExample("apply prod --spread 10m", "spread creates and updates over 10 minutes to avoid overloading the API server"),
+		newExample("apply dev --group-by component", "show output under component headers with per-component counts and durations in the summary"),
+		newExample("apply prod --run-url $CI_JOB_URL --pipeline-id $CI_PIPELINE_ID", "record the CI run and pipeline on the objects that are created or updated"),
+	)
+}
+
+func statusExamples() string {
+	return exampleHelp(
+		newExample("status prod", "list live objects of the prod environment with the CI runs that last changed them"),
+		newExample("status prod -c redis --columns kind,name,run-url", "show just the kinds, names and run URLs of the objects of the redis component"),
+		newExample("status prod -o json", "list the details in JSON format"),
+	)
+}
+
+func deletedExamples() string {
+	return exampleHelp(
+		newExample("deleted prod", "list objects of the prod environment that were deleted by apply or delete, newest first"),
+		newExample("deleted prod --since 24h -o yaml", "list the objects deleted in the last day in YAML format"),
 	)
 }
 
@@ -60,9 +93,35 @@ func showExamples() string {
 		newExample("show dev", "show all components for the 'dev' environment in YAML"),
 		newExample("show dev -c postgres -c redis -o json", "expand just 2 components and output JSON"),
 		newExample("show dev -C postgres -C redis", "expand all but 2 components"),
+		newExample("show dev -c team-a", "expand all nested components under the team-a directory"),
 		newExample("show dev -k deployment -k configmap", "show only deployments and config maps"),
 		newExample("show dev -K secret", "show all objects except secrets"),
+		newExample("show dev --component-tag networking", "show objects of the components tagged networking in their descriptors"),
+		newExample("show dev -l tier=frontend", "show only objects with the label tier set to frontend"),
 		newExample("show dev -O", "list all objects for the dev environment"),
+		newExample("show dev -o table --columns kind,namespace,name", "list objects as a table with selected columns"),
+		newExample("show dev --redact --redact-pattern 'password=\\S+'", "show objects with secrets and passwords hidden, for sharing"),
+		newExample("show --all-envs -o dir --out-dir ./rendered", "write the objects of the baseline and every environment to ./rendered/<env>/ in a single run"),
+		newExample("show dev --changed-since main", "show objects only for components with inputs changed since the main branch"),
+		newExample("show dev -o yaml-list | kubectl apply -f -", "show all objects wrapped in a single v1 List object"),
+		newExample("show dev --report", "show object counts and sizes per component, flagging objects that are too large to apply"),
+		newExample("show dev --annotate-provenance", "show output with annotations recording the source file and git commit of every object"),
+		newExample("show dev --stable", "show output in a fixed order with normalized numbers, for committing to source control"),
+		newExample("show dev -o dir --out-dir ./rendered", "write one YAML file per object to ./rendered/<component>/<kind>-<name>.yaml, removing stale files"),
+		newExample("show dev -o kustomize --out-dir ./base", "write one YAML file per object and a kustomization.yaml listing them, for use as a kustomize base"),
+		newExample("show dev -o dir --out-dir ./rendered --file-pattern '{namespace}/{kind}-{name}.yaml'", "write files organized by namespace instead"),
+		newExample("show dev --changed-since last-render", "show objects only for components with inputs changed since the last such render"),
+		newExample("show dev -c redis --explain-defaults", "show objects of the redis component with comments listing the fields defaulted by the server"),
+		newExample("show dev --object deployment/my-ns/my-app", "show just the my-app deployment in the my-ns namespace"),
+		newExample("show dev --k8s-version 1.27 --sort-apply", "show objects in apply order for Kubernetes 1.27, without contacting a cluster"),
+	)
+}
+
+func graphExamples() string {
+	return exampleHelp(
+		newExample("graph dev | dot -Tsvg > dev.svg", "render the objects of the dev environment and their references as an SVG image using graphviz"),
+		newExample("graph dev -o mermaid", "show the graph as a mermaid flowchart, for use in markdown documents"),
+		newExample("graph dev --sort-apply", "number objects in the order in which apply would create them"),
 	)
 }
 
@@ -73,6 +132,33 @@ func deleteExamples() string {
 		newExample("delete dev -c redis -k secret", "delete all secrets for the redis component"),
 		newExample("delete dev --local", "use object names from local component files for deletion list",
 			"by default, the list is produced using server queries"),
+		newExample("delete dev --wait --timeout 10m", "wait for objects to be gone before deleting the namespaces and other objects they depend on"),
+		newExample("delete dev --object deployment/my-ns/my-app", "delete just the my-app deployment in the my-ns namespace"),
+		newExample("delete dev -l tier=frontend", "delete the objects of the dev environment whose labels match the selector"),
+		newExample("delete -n dev --impact", "show objects that would be deleted for the dev environment along with the live objects they own"),
+		newExample("delete dev -c db -k statefulset --cascade orphan", "delete the stateful sets of the db component but keep their pods"),
+	)
+}
+
+func relabelExamples() string {
+	return exampleHelp(
+		newExample("relabel dev", "report live objects for the dev environment with inconsistent qbec labels or annotations"),
+		newExample("relabel dev --fix", "repair the labels and annotations of live objects for the dev environment"),
+	)
+}
+
+func previewCreateExamples() string {
+	return exampleHelp(
+		newExample("preview create dev --suffix pr-123", "apply the dev environment as the dev-pr-123 environment with namespaces suffixed by pr-123"),
+		newExample("preview create dev --suffix pr-123 --prop host={suffix}.preview.example.com", "make a hostname for the preview available to components",
+			"as std.extVar('qbec.io/preview').props.host"),
+		newExample("preview create dev --suffix pr-123 -c service2 -n", "show what would be applied for the service2 component of the preview"),
+	)
+}
+
+func previewDeleteExamples() string {
+	return exampleHelp(
+		newExample("preview delete dev --suffix pr-123", "delete all objects of the dev-pr-123 preview environment"),
 	)
 }
 
@@ -82,12 +168,48 @@ func diffExamples() string {
 		newExample("diff dev -c redis --show-deletes=false", "show differences for the redis component for the dev environment",
 			"ignore extra remote objects"),
 		newExample("diff dev -ignore-all-labels", "do not take labels into account when calculating the diff"),
+		newExample("diff dev --group-by namespace", "order diffs by namespace and summarize differences per namespace"),
+		newExample("diff prod-fleet", "show differences for all environments in the prod-fleet group, with a combined summary"),
+		newExample("diff dev --summary --columns kind,name,change", "show a table of the objects that would change instead of diffs"),
+		newExample("diff dev --changed-since main", "show differences only for components with inputs changed since the main branch"),
+	)
+}
+
+func compareLiveExamples() string {
+	return exampleHelp(
+		newExample("compare-live prod prod-dr", "diff the live objects of the prod environment against those of its standby"),
+		newExample("compare-live prod prod-dr -K secret --ignore-annotation example.com/region", "compare all objects except secrets, ignoring an annotation that is expected to differ"),
 	)
 }
 
 func validateExamples() string {
 	return exampleHelp(
 		newExample("validate dev", "validate all objects for all components against the dev environment"),
+		newExample("validate dev --check-hosts", "also check that ingress hostnames are not used by other environments with the same server"),
+		newExample("validate dev --check-live-hosts", "also check that ingress hostnames are not used by ingresses of other apps or environments on the server"),
+		newExample("validate dev --check-scheduling", "also check that workloads can be scheduled on the nodes of the cluster"),
+		newExample("validate dev --check-quotas", "also check that workloads fit in the resource quotas of their namespaces"),
+		newExample("validate dev --report-duplicates", "also report objects with identical or near-identical content in different components"),
+		newExample("validate dev --check-semantics", "also check selectors, backends and secret references between objects of the app"),
+		newExample("validate dev --check-secrets", "also check secrets for plaintext credentials, empty values and data over the size limit"),
+		newExample("validate dev --check-classes", "also check that referenced priority, runtime, storage and ingress classes exist"),
+		newExample("validate dev --check-apis", "also check for API versions that are deprecated or removed in the Kubernetes version of the cluster"),
+		newExample("validate dev --k8s-version 1.27 --k8s-schema swagger.json", "validate against Kubernetes 1.27 without contacting a cluster"),
+		newExample("validate dev --offline --k8s-version 1.27", "validate against the upstream schema of Kubernetes 1.27, cached after the first download"),
+		newExample("validate dev --crd-dir vendor/crds", "also validate custom resources against the definitions in vendor/crds"),
+		newExample("validate dev --changed-since main", "validate only components with inputs changed since the main branch"),
+		newExample("validate dev -o sarif", "write a SARIF report of problems for code scanning tools"),
+		newExample("validate dev -o junit", "write a JUnit XML report for CI test report views"),
+		newExample("validate dev --skip-policies", "validate objects without checking them against the policies of the app"),
+		newExample("validate dev --enable semantics,apis --disable schema -v", "only run the listed validators along with policies, and print the time each one takes"),
+	)
+}
+
+func lintAPIsExamples() string {
+	return exampleHelp(
+		newExample("lint-apis dev", "report objects of the dev environment that use API versions deprecated or removed in the version of its cluster"),
+		newExample("lint-apis dev --k8s-version 1.25", "check the objects of the dev environment before upgrading its cluster to Kubernetes 1.25"),
+		newExample("lint-apis dev -o json", "report deprecated and removed API versions in JSON format"),
 	)
 }
 
@@ -96,6 +218,8 @@ func componentListExamples() string {
 		newExample("component list dev", "list all components for the dev environment"),
 		newExample("component list dev -O", "list all objects for the dev environment"),
 		newExample("component list _", "list all baseline components"),
+		newExample("component list dev -o wide", "list components with the namespaces, owners, tags and descriptions of their descriptors"),
+		newExample("component list dev --component-tag networking", "list the components tagged networking in their descriptors"),
 	)
 }
 
@@ -103,6 +227,7 @@ func componentDiffExamples() string {
 	return exampleHelp(
 		newExample("component diff dev", "show differences in component lists between baseline and dev"),
 		newExample("component diff dev prod -O", "show differences in object lists between dev and prod"),
+		newExample("component diff web dev prod", "show differences in the objects of the web component between dev and prod"),
 	)
 }
 
@@ -111,6 +236,78 @@ func paramListExamples() string {
 		newExample("param list dev", "list all parameters for the dev environment"),
 		newExample("param list _", "list baseline parameters for all components"),
 		newExample("param list dev -c redis", "list parameters for the redis component for the dev environment"),
+		newExample("param list prod -o dotenv", "list parameters for prod as a dotenv file with variables like REDIS_IMAGE"),
+		newExample("param list prod --show-source", "list parameters for prod along with the baseline or prod file and line that sets each"),
+	)
+}
+
+func varsListExamples() string {
+	return exampleHelp(
+		newExample("vars list", "list the variables declared in qbec.yaml along with their descriptions and defaults"),
+		newExample("vars list --vm:ext-str image_tag=v1.2 -o json", "show which variables are supplied by a command line, in JSON format"),
+	)
+}
+
+func envListExamples() string {
+	return exampleHelp(
+		newExample("env list", "list the environments of the app and the servers or contexts they are bound to"),
+		newExample("env list --resolve", "show the kubeconfig context, cluster and server that each environment resolves to"),
+	)
+}
+
+func envCheckExamples() string {
+	return exampleHelp(
+		newExample("env check prod", "check connectivity, permissions, namespaces and the server version of prod before deploying"),
+		newExample("env check prod -o json", "produce a machine readable report of the checks"),
+	)
+}
+
+func envAddExamples() string {
+	return exampleHelp(
+		newExample("env add stage --context stage-admin --namespace web", "add a stage environment bound to a kubeconfig context"),
+		newExample("env add prod-eu --parent prod --property domain=eu.example.com", "add an environment that inherits from prod"),
+	)
+}
+
+func envSetExamples() string {
+	return exampleHelp(
+		newExample("env set prod --server https://prod-2.example.com", "move the prod environment to a new server"),
+		newExample("env set prod --property tier=gold --unset-property legacy", "set one property and remove another"),
+	)
+}
+
+func envRemoveExamples() string {
+	return exampleHelp(
+		newExample("env remove stage", "remove the stage environment from qbec.yaml"),
+	)
+}
+
+func componentAddExamples() string {
+	return exampleHelp(
+		newExample("component add billing", "add a billing component that is enabled for all environments"),
+		newExample("component add billing --env dev --env stage", "add a billing component that is enabled only for dev and stage"),
+		newExample("component add web --template deployment+service+hpa", "add a web component with a deployment, a service and an autoscaler"),
+	)
+}
+
+func newComponentExamples() string {
+	return exampleHelp(
+		newExample("new component web-service --template deployment+service+hpa", "add a web-service component with a deployment, a service and an autoscaler"),
+		newExample("new component worker --template-dir ~/templates --template worker+configmap", "add a worker component from a part of a template directory and a built-in part"),
+	)
+}
+
+func componentEnableExamples() string {
+	return exampleHelp(
+		newExample("component enable billing", "enable the billing component by default"),
+		newExample("component enable billing prod", "enable the billing component for the prod environment"),
+	)
+}
+
+func componentDisableExamples() string {
+	return exampleHelp(
+		newExample("component disable billing", "disable the billing component by default"),
+		newExample("component disable billing dev stage", "disable the billing component for the dev and stage environments"),
 	)
 }
 
@@ -118,5 +315,34 @@ func paramDiffExamples() string {
 	return exampleHelp(
 		newExample("param diff dev", "show differences in parameter values between baseline and dev"),
 		newExample("param diff dev prod", "show differences in parameter values  between dev and prod"),
+		newExample("param diff dev prod web -o table", "show a table of the parameters of the web component that differ between dev and prod"),
+	)
+}
+
+func paramSetExamples() string {
+	return exampleHelp(
+		newExample("param set prod web image nginx:1.25", "set the image parameter of the web component for the prod environment",
+			"params files are edited line by line, so the parameter must be in the layout of qbec init with its value on a single line"),
+		newExample("param set _ web replicas 2 --json", "set the baseline replicas parameter of the web component to the number 2"),
+	)
+}
+
+func paramUnsetExamples() string {
+	return exampleHelp(
+		newExample("param unset prod web image", "remove the image parameter of the web component from the params of prod, such that its baseline value is used",
+			"as for param set, the value of the parameter must be on a single line"),
+	)
+}
+
+func convertHelmExamples() string {
+	return exampleHelp(
+		newExample("convert helm my-release --namespace web", "create a qbec app from the manifests of an installed helm release"),
+		newExample("convert helm ./charts/nginx -f prod-values.yaml --app-name nginx", "create a qbec app from a chart rendered with the supplied values"),
+	)
+}
+
+func convertKustomizeExamples() string {
+	return exampleHelp(
+		newExample("convert kustomize ./deploy", "create a qbec app with components for the bases and environments for the overlays in ./deploy/overlays"),
 	)
 }
@@ -17,26 +17,79 @@
 package commands
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/eval"
 	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/objsort"
 	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type filterParams struct {
 	includes   []string
 	excludes   []string
 	kindFilter model.Filter
+	selector   labels.Selector // nil when objects are not filtered by labels
 }
 
-func addFilterParams(cmd *cobra.Command, includeKindFilters bool) func() (filterParams, error) {
-	var includes, excludes, kindIncludes, kindExcludes []string
+// selectorString returns the label selector as a string, or an empty string when there is no selector.
+func (fp filterParams) selectorString() string {
+	if fp.selector == nil {
+		return ""
+	}
+	return fp.selector.String()
+}
 
-	cmd.Flags().StringArrayVarP(&includes, "component", "c", nil, "include just this component")
-	cmd.Flags().StringArrayVarP(&excludes, "exclude-component", "C", nil, "exclude this component")
+// selectObjects returns the objects that match the label selector of the filter.
+func (fp filterParams) selectObjects(objects []model.K8sLocalObject) []model.K8sLocalObject {
+	if fp.selector == nil {
+		return objects
+	}
+	var ret []model.K8sLocalObject
+	for _, o := range objects {
+		if fp.selector.Matches(labels.Set(o.ToUnstructured().GetLabels())) {
+			ret = append(ret, o)
+		}
+	}
+	if len(objects) > 0 && len(ret) == 0 {
+		sio.Warnf("0 of %d matches for label selector %q\n", len(objects), fp.selector.String())
+	}
+	return ret
+}
+
+// componentsWithTags returns the supplied component includes and excludes restricted to the components that have
+// any of the supplied tags in their descriptors.
+func componentsWithTags(app *model.App, tags, includes, excludes []string) ([]string, error) {
+	var ret []string
+	for _, name := range app.ComponentsWithTags(tags) {
+		if len(includes) > 0 && !contains(includes, name) {
+			continue
+		}
+		if contains(excludes, name) {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	if len(ret) == 0 {
+		return nil, newUsageError(fmt.Sprintf("no components selected by component tag(s) %s", strings.Join(tags, ", ")))
+	}
+	return ret, nil
+}
+
+func addFilterParams(cmd *cobra.Command, op OptionsProvider, includeKindFilters bool) func() (filterParams, error) {
+	var includes, excludes, tags, kindIncludes, kindExcludes []string
+	var selector string
+
+	cmd.Flags().StringArrayVarP(&includes, "component", "c", nil, "include just this component, or the nested components under this directory")
+	cmd.Flags().StringArrayVarP(&excludes, "exclude-component", "C", nil, "exclude this component, or the nested components under this directory")
+	cmd.Flags().StringArrayVar(&tags, "component-tag", nil, "include just the components with this tag in their descriptors")
 	if includeKindFilters {
 		cmd.Flags().StringArrayVarP(&kindIncludes, "kind", "k", nil, "include objects with this kind")
 		cmd.Flags().StringArrayVarP(&kindExcludes, "exclude-kind", "K", nil, "exclude objects with this kind")
+		cmd.Flags().StringVarP(&selector, "selector", "l", "", "include objects whose labels match this selector, e.g. tier=frontend")
 	}
 	return func() (filterParams, error) {
 		if len(includes) > 0 && len(excludes) > 0 {
@@ -46,10 +99,29 @@ func addFilterParams(cmd *cobra.Command, includeKindFilters bool) func() (filter
 		if err != nil {
 			return filterParams{}, newUsageError(err.Error())
 		}
+		inc, exc := includes, excludes
+		if app := op().App(); app != nil {
+			inc, exc = app.ExpandComponentNames(includes), app.ExpandComponentNames(excludes)
+		}
+		if len(tags) > 0 {
+			inc, err = componentsWithTags(op().App(), tags, inc, exc)
+			if err != nil {
+				return filterParams{}, err
+			}
+			exc = nil
+		}
+		var sel labels.Selector
+		if selector != "" {
+			sel, err = labels.Parse(selector)
+			if err != nil {
+				return filterParams{}, newUsageError(fmt.Sprintf("invalid selector %q: %v", selector, err))
+			}
+		}
 		return filterParams{
-			includes:   includes,
-			excludes:   excludes,
+			includes:   inc,
+			excludes:   exc,
 			kindFilter: of,
+			selector:   sel,
 		}, nil
 	}
 }
@@ -63,17 +135,80 @@ func filteredObjects(req StdOptions, env string, fp filterParams) ([]model.K8sLo
 	if err != nil {
 		return nil, err
 	}
-	jvm := req.VM()
-	output, err := eval.Components(components, eval.Context{
+	objects, err := componentObjects(req, env, components, fp.kindFilter)
+	if err != nil {
+		return nil, err
+	}
+	return fp.selectObjects(objects), nil
+}
+
+// componentObjects evaluates the supplied components and returns the objects that match the kind filter.
+func componentObjects(req StdOptions, env string, components []model.Component, of model.Filter) ([]model.K8sLocalObject, error) {
+	jvm, err := renderVM(req)
+	if err != nil {
+		return nil, err
+	}
+	var props map[string]string
+	if env != model.Baseline {
+		props, err = envProperties(req.App(), env)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.App().ValidateProperties(env, props); err != nil {
+			return nil, err
+		}
+	}
+	components, err = pinnedComponents(req.App(), env, components)
+	if err != nil {
+		return nil, err
+	}
+	warnDeprecated(components)
+	preview := req.App().Preview(env)
+	cluster, err := evalCluster(req.App(), env)
+	if err != nil {
+		return nil, err
+	}
+	ctx := eval.Context{
 		App:     req.App().Name(),
 		Env:     env,
+		Preview: preview,
+		Cluster: cluster,
 		VM:      jvm,
 		Verbose: req.Verbosity() > 1,
-	})
+
+		ParamsFile:       req.App().Spec.ParamsFile,
+		Properties:       props,
+		DefaultNamespace: req.DefaultNamespace(env),
+		Limits: func(component string) eval.Limits {
+			timeout, maxMemory := req.App().ComponentEvalLimits(component)
+			return eval.Limits{Timeout: timeout, MaxMemory: maxMemory}
+		},
+	}
+	if env != model.Baseline {
+		if err := checkRequiredParams(components, ctx); err != nil {
+			return nil, err
+		}
+	}
+	output, err := eval.Components(components, ctx)
 	if err != nil {
 		return nil, err
 	}
-	of := fp.kindFilter
+	if err := checkAnnotatedDependencies(req.App(), output); err != nil {
+		return nil, err
+	}
+	if err := componentNamespaces(req.App(), output, func() (objsort.Namespaced, error) { return kindScopes(req, env) }); err != nil {
+		return nil, err
+	}
+	output, err = eval.Transform(output, req.App().Transformers(env), ctx)
+	if err != nil {
+		return nil, err
+	}
+	if preview != nil {
+		previewNamespaces(preview, output)
+	}
+	if err := templateHosts(req.App(), env, req.DefaultNamespace(env), output); err != nil {
+		return nil, err
+	}
 	if of == nil || !of.HasFilters() {
 		return output, nil
 	}
@@ -88,3 +223,20 @@ func filteredObjects(req StdOptions, env string, fp filterParams) ([]model.K8sLo
 	}
 	return ret, nil
 }
+
+// checkAnnotatedDependencies returns an error if the component dependency annotations of the supplied objects refer
+// to components that do not exist, or create a cycle with the dependencies declared in qbec.yaml.
+func checkAnnotatedDependencies(app *model.App, objects []model.K8sLocalObject) error {
+	for _, o := range objects {
+		for _, d := range objsort.AnnotatedDependencies(o) {
+			if _, ok := app.Component(d); !ok {
+				return fmt.Errorf("component %s: %s annotation of %s %s refers to unknown component %s",
+					o.Component(), model.QbecNames.ComponentDependsOnAnnotation, o.GetKind(), o.GetName(), d)
+			}
+			if d == o.Component() {
+				return fmt.Errorf("component %s: cannot depend on itself", d)
+			}
+		}
+	}
+	return model.CheckComponentDependencies(objsort.ComponentDependencies(objects, app.ComponentDependencies()))
+}
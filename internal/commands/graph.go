@@ -0,0 +1,295 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/objsort"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// reasons for edges between objects
+const (
+	edgeSelects   = "selects"     // a service selects the pods of a workload
+	edgeInstance  = "instance-of" // a custom resource is an instance of a custom resource definition
+	edgeNamespace = "namespace"   // a namespaced object is in a namespace
+	edgeDependsOn = "depends-on"  // an object explicitly depends on another using an annotation
+)
+
+// graphEdge is a reference from one object to another, by index.
+type graphEdge struct {
+	from, to int
+	reason   string
+}
+
+// objectGraph has objects grouped by component and the references between them.
+type objectGraph struct {
+	objects    []model.K8sLocalObject
+	ordered    bool // true if objects are in apply order
+	components []string
+	edges      []graphEdge
+}
+
+// podLabels returns the labels of the pods created by the supplied workload object, or nil if it does not create pods.
+func podLabels(u *unstructured.Unstructured) map[string]string {
+	if _, _, ok := podTemplate(u); !ok {
+		return nil
+	}
+	gk := u.GroupVersionKind().GroupKind()
+	switch {
+	case gk.Group == "" && gk.Kind == "Pod":
+		return u.GetLabels()
+	case gk.Group == "batch" && gk.Kind == "CronJob":
+		return toStringMap(nestedValue(u.Object, "spec", "jobTemplate", "spec", "template", "metadata", "labels"))
+	default:
+		return toStringMap(nestedValue(u.Object, "spec", "template", "metadata", "labels"))
+	}
+}
+
+// dependencyKey returns the key under which an object is looked up for depends-on references.
+func dependencyKey(kind, namespace, name string) string {
+	return strings.ToLower(kind) + "/" + namespace + "/" + name
+}
+
+// newObjectGraph returns the graph for the supplied objects with edges derived from references between them.
+// References to objects that are not part of the supplied list are not included.
+func newObjectGraph(objects []model.K8sLocalObject, ordered bool) *objectGraph {
+	g := &objectGraph{objects: objects, ordered: ordered}
+	seenComponents := map[string]bool{}
+	namespaces := map[string]int{}
+	crds := map[string]int{}
+	byKey := map[string]int{}
+	for i, o := range objects {
+		if !seenComponents[o.Component()] {
+			seenComponents[o.Component()] = true
+			g.components = append(g.components, o.Component())
+		}
+		gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+		u := o.ToUnstructured()
+		switch {
+		case gk.Group == "" && gk.Kind == "Namespace":
+			namespaces[o.GetName()] = i
+		case gk.Group == "apiextensions.k8s.io" && gk.Kind == "CustomResourceDefinition":
+			group, _ := nestedValue(u.Object, "spec", "group").(string)
+			kind, _ := nestedValue(u.Object, "spec", "names", "kind").(string)
+			crds[kind+"."+group] = i
+		}
+		byKey[dependencyKey(gk.Kind, o.GetNamespace(), o.GetName())] = i
+	}
+
+	seen := map[graphEdge]bool{}
+	add := func(from, to int, reason string) {
+		e := graphEdge{from: from, to: to, reason: reason}
+		if from == to || seen[e] {
+			return
+		}
+		seen[e] = true
+		g.edges = append(g.edges, e)
+	}
+	for i, o := range objects {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		u := o.ToUnstructured()
+		if j, ok := namespaces[o.GetNamespace()]; ok {
+			add(i, j, edgeNamespace)
+		}
+		if j, ok := crds[gvk.Kind+"."+gvk.Group]; ok {
+			add(i, j, edgeInstance)
+		}
+		if gvk.Group == "" && gvk.Kind == "Service" {
+			if sel := toStringMap(nestedValue(u.Object, "spec", "selector")); len(sel) > 0 {
+				selector := labels.SelectorFromSet(labels.Set(sel))
+				for j, w := range objects {
+					if w.GetNamespace() != o.GetNamespace() {
+						continue
+					}
+					if l := podLabels(w.ToUnstructured()); l != nil && selector.Matches(labels.Set(l)) {
+						add(i, j, edgeSelects)
+					}
+				}
+			}
+		}
+		deps := u.GetAnnotations()[model.QbecNames.DependsOnAnnotation]
+		for _, ref := range strings.Split(deps, ",") {
+			ref = strings.TrimSpace(ref)
+			if ref == "" {
+				continue
+			}
+			parts := strings.Split(ref, "/")
+			var key string
+			switch len(parts) {
+			case 2:
+				key = dependencyKey(parts[0], o.GetNamespace(), parts[1])
+			case 3:
+				key = dependencyKey(parts[0], parts[1], parts[2])
+			default:
+				sio.Warnf("%s %s: invalid depends-on reference %q, must be kind/name or kind/namespace/name\n", gvk.Kind, o.GetName(), ref)
+				continue
+			}
+			j, ok := byKey[key]
+			if !ok && len(parts) == 2 {
+				j, ok = byKey[dependencyKey(parts[0], "", parts[1])] // reference to a cluster-scoped object
+			}
+			if !ok {
+				sio.Warnf("%s %s: depends-on reference %q does not match any object\n", gvk.Kind, o.GetName(), ref)
+				continue
+			}
+			add(i, j, edgeDependsOn)
+		}
+	}
+	return g
+}
+
+// label returns the display label for the object at the supplied index.
+func (g *objectGraph) label(i int) string {
+	o := g.objects[i]
+	name := o.GetName()
+	if o.GetNamespace() != "" {
+		name = o.GetNamespace() + "/" + name
+	}
+	l := o.GetObjectKind().GroupVersionKind().Kind + " " + name
+	if g.ordered {
+		l = fmt.Sprintf("%d. %s", i+1, l)
+	}
+	return l
+}
+
+// writeDot writes the graph in the graphviz dot format.
+func (g *objectGraph) writeDot(w io.Writer, name string) {
+	fmt.Fprintf(w, "digraph %s {\n", strconv.Quote(name))
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for c, component := range g.components {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", c)
+		fmt.Fprintf(w, "    label=%s;\n", strconv.Quote(component))
+		for i, o := range g.objects {
+			if o.Component() == component {
+				fmt.Fprintf(w, "    n%d [label=%s];\n", i, strconv.Quote(g.label(i)))
+			}
+		}
+		fmt.Fprintln(w, "  }")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "  n%d -> n%d [label=%s];\n", e.from, e.to, strconv.Quote(e.reason))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writeMermaid writes the graph as a mermaid flowchart.
+func (g *objectGraph) writeMermaid(w io.Writer) {
+	quote := func(s string) string {
+		return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+	}
+	fmt.Fprintln(w, "graph LR")
+	for c, component := range g.components {
+		fmt.Fprintf(w, "  subgraph c%d [%s]\n", c, quote(component))
+		for i, o := range g.objects {
+			if o.Component() == component {
+				fmt.Fprintf(w, "    n%d[%s]\n", i, quote(g.label(i)))
+			}
+		}
+		fmt.Fprintln(w, "  end")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "  n%d -->|%s| n%d\n", e.from, e.reason, e.to)
+	}
+}
+
+// graphClient is the remote interface needed for graph operations.
+type graphClient interface {
+	IsNamespaced(kind schema.GroupVersionKind) (bool, error)
+}
+
+type graphCommandConfig struct {
+	StdOptions
+	format         string
+	sortAsApply    bool
+	filterFunc     func() (filterParams, error)
+	clientProvider func(env string) (graphClient, error)
+}
+
+func doGraph(args []string, config graphCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	env := args[0]
+	switch config.format {
+	case "dot", "mermaid":
+	default:
+		return newUsageError(fmt.Sprintf("invalid output format: %q", config.format))
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	objects, err := filteredObjects(config, env, fp)
+	if err != nil {
+		return err
+	}
+	ordered := false
+	if config.sortAsApply {
+		if env == model.Baseline {
+			sio.Warnln("cannot sort in apply order for baseline environment")
+		} else {
+			client, err := config.clientProvider(env)
+			if err != nil {
+				return err
+			}
+			objects = objsort.Sort(objects, config.SortConfig(client.IsNamespaced))
+			ordered = true
+		}
+	}
+	g := newObjectGraph(objects, ordered)
+	if config.format == "mermaid" {
+		g.writeMermaid(config.Stdout())
+		return nil
+	}
+	g.writeDot(config.Stdout(), config.App().Name()+"-"+env)
+	return nil
+}
+
+func newGraphCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "graph <environment>",
+		Short:   "show a graph of the objects of an environment and the references between them",
+		Example: graphExamples(),
+	}
+
+	config := graphCommandConfig{
+		clientProvider: func(env string) (graphClient, error) {
+			return op().Client(env)
+		},
+		filterFunc: addFilterParams(cmd, op, true),
+	}
+
+	cmd.Flags().StringVarP(&config.format, "format", "o", "dot", "Output format. Supported values are: dot, mermaid")
+	cmd.Flags().BoolVar(&config.sortAsApply, "sort-apply", false, "number objects in apply order (requires cluster access)")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doGraph(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,190 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func graphObjects() []model.K8sLocalObject {
+	obj := func(component string, data map[string]interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(data, "example1", component, "dev")
+	}
+	web := deployment("web", 1, nil)
+	web["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"] = map[string]interface{}{
+		"labels": map[string]interface{}{"app": "web", "tier": "frontend"},
+	}
+	return []model.K8sLocalObject{
+		obj("base", map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "quota-ns"},
+		}),
+		obj("base", map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+			"spec": map[string]interface{}{
+				"group": "example.com",
+				"names": map[string]interface{}{"kind": "Widget", "plural": "widgets"},
+			},
+		}),
+		obj("web", web),
+		obj("web", map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "quota-ns"},
+			"spec":       map[string]interface{}{"selector": map[string]interface{}{"app": "web"}},
+		}),
+		obj("web", map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata": map[string]interface{}{
+				"name":      "w",
+				"namespace": "quota-ns",
+				"annotations": map[string]interface{}{
+					"qbec.io/depends-on": "service/web, customresourcedefinition/widgets.example.com, secret/missing, bad",
+				},
+			},
+		}),
+	}
+}
+
+func TestObjectGraph(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	g := newObjectGraph(graphObjects(), false)
+	a := assert.New(t)
+	a.Equal([]string{"base", "web"}, g.components)
+	a.Equal([]graphEdge{
+		{from: 2, to: 0, reason: edgeNamespace},
+		{from: 3, to: 0, reason: edgeNamespace},
+		{from: 3, to: 2, reason: edgeSelects},
+		{from: 4, to: 0, reason: edgeNamespace},
+		{from: 4, to: 1, reason: edgeInstance},
+		{from: 4, to: 3, reason: edgeDependsOn},
+		{from: 4, to: 1, reason: edgeDependsOn},
+	}, g.edges)
+	s.assertErrorLineMatch(regexp.MustCompile(`Widget w: depends-on reference "secret/missing" does not match any object`))
+	s.assertErrorLineMatch(regexp.MustCompile(`Widget w: invalid depends-on reference "bad", must be kind/name or kind/namespace/name`))
+}
+
+func TestObjectGraphOutput(t *testing.T) {
+	g := newObjectGraph(graphObjects()[:3], true)
+	var dot bytes.Buffer
+	g.writeDot(&dot, "example1-dev")
+	assert.Equal(t, `digraph "example1-dev" {
+  rankdir=LR;
+  node [shape=box];
+  subgraph cluster_0 {
+    label="base";
+    n0 [label="1. Namespace quota-ns"];
+    n1 [label="2. CustomResourceDefinition widgets.example.com"];
+  }
+  subgraph cluster_1 {
+    label="web";
+    n2 [label="3. Deployment quota-ns/web"];
+  }
+  n2 -> n0 [label="namespace"];
+}
+`, dot.String())
+	var mermaid bytes.Buffer
+	g.writeMermaid(&mermaid)
+	assert.Equal(t, `graph LR
+  subgraph c0 ["base"]
+    n0["1. Namespace quota-ns"]
+    n1["2. CustomResourceDefinition widgets.example.com"]
+  end
+  subgraph c1 ["web"]
+    n2["3. Deployment quota-ns/web"]
+  end
+  n2 -->|namespace| n0
+`, mermaid.String())
+}
+
+func TestGraphBasic(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("graph", "dev", "--sort-apply")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^digraph "example1-dev" {$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`n\d+ \[label="3\. Namespace bar-system"\];`))
+	s.assertOutputLineMatch(regexp.MustCompile(`n\d+ \[label="5\. ConfigMap bar-system/svc2-cm"\];`))
+	s.assertOutputLineMatch(regexp.MustCompile(`n4 -> n2 \[label="namespace"\];`))
+	s.assertOutputLineMatch(regexp.MustCompile(`label="service2"`))
+}
+
+func TestGraphMermaid(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("graph", "dev", "-o", "mermaid", "-c", "cluster-objects")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^graph LR$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`subgraph c0 \["cluster-objects"\]`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`service2`))
+}
+
+func TestGraphNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "no env",
+			args: []string{"graph"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("exactly one environment required", err.Error())
+			},
+		},
+		{
+			name: "bad format",
+			args: []string{"graph", "dev", "-o", "svg"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid output format: "svg"`, err.Error())
+			},
+		},
+		{
+			name: "bad env",
+			args: []string{"graph", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.False(isUsageError(err))
+				a.Equal(`invalid environment "foo"`, err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
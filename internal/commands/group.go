@@ -0,0 +1,239 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// attributes by which output can be grouped
+const (
+	groupByComponent = "component"
+	groupByKind      = "kind"
+	groupByNamespace = "namespace"
+)
+
+// clusterGroup is the namespace group for cluster-scoped objects.
+const clusterGroup = "<cluster>"
+
+func addGroupByFlag(cmd *cobra.Command, groupBy *string) {
+	cmd.Flags().StringVar(groupBy, "group-by", "", "group output and summaries by one of component, kind or namespace")
+}
+
+func validateGroupBy(by string) error {
+	switch by {
+	case "", groupByComponent, groupByKind, groupByNamespace:
+		return nil
+	default:
+		return newUsageError(fmt.Sprintf("invalid group-by %q, must be one of %s, %s or %s", by, groupByComponent, groupByKind, groupByNamespace))
+	}
+}
+
+// grouper assigns objects to groups and tracks the groups and durations of objects by display name.
+type grouper struct {
+	by         string
+	defaultNs  string
+	namespaced func(gvk schema.GroupVersionKind) (bool, error)
+	l          sync.Mutex
+	groups     map[string]string        // group keyed by object display name
+	durations  map[string]time.Duration // time taken to process objects keyed by display name
+	out        map[string]*groupBuffer  // output of objects keyed by group, until it is flushed
+}
+
+// groupBuffer is the buffered output of a group, which may be written concurrently.
+type groupBuffer struct {
+	l   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *groupBuffer) Write(p []byte) (int, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.buf.Write(p)
+}
+
+// newGrouper returns a grouper for the supplied valid attribute, or nil if no grouping is required. All methods
+// that record information may be called on a nil grouper.
+func newGrouper(by string, defaultNs string, namespaced func(gvk schema.GroupVersionKind) (bool, error)) *grouper {
+	if by == "" {
+		return nil
+	}
+	return &grouper{
+		by:         by,
+		defaultNs:  defaultNs,
+		namespaced: namespaced,
+		groups:     map[string]string{},
+		durations:  map[string]time.Duration{},
+		out:        map[string]*groupBuffer{},
+	}
+}
+
+// group returns the group of the supplied object.
+func (g *grouper) group(ob model.K8sQbecMeta) string {
+	switch g.by {
+	case groupByComponent:
+		return ob.Component()
+	case groupByKind:
+		return ob.GetKind()
+	default:
+		if ns := ob.GetNamespace(); ns != "" {
+			return ns
+		}
+		if isNs, err := g.namespaced(ob.GetObjectKind().GroupVersionKind()); err == nil && isNs {
+			return g.defaultNs
+		}
+		return clusterGroup
+	}
+}
+
+// add records the group of the supplied object under its display name and returns the group.
+func (g *grouper) add(name string, ob model.K8sQbecMeta) string {
+	if g == nil {
+		return ""
+	}
+	group := g.group(ob)
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.groups[name] = group
+	return group
+}
+
+// took adds the supplied duration to the processing time of the named object.
+func (g *grouper) took(name string, d time.Duration) {
+	if g == nil {
+		return
+	}
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.durations[name] += d
+}
+
+// sort sorts the supplied objects by group, retaining the existing order within each group.
+func (g *grouper) sort(objects []model.K8sLocalObject) {
+	if g == nil {
+		return
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return g.group(objects[i]) < g.group(objects[j])
+	})
+}
+
+// groupStats are the per-group counts of objects.
+type groupStats struct {
+	Created   int    `json:"created,omitempty"`
+	Updated   int    `json:"updated,omitempty"`
+	Skipped   int    `json:"skipped,omitempty"`
+	Deleted   int    `json:"deleted,omitempty"`
+	Additions int    `json:"additions,omitempty"`
+	Changes   int    `json:"changes,omitempty"`
+	Deletions int    `json:"deletions,omitempty"`
+	Errors    int    `json:"errors,omitempty"`
+	Same      int    `json:"same,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// writer returns the writer for the output of objects of the supplied group. When output is grouped, this buffers
+// everything written until flush is called, such that the output of each group is shown together even though
+// objects are processed in dependency order or in parallel. Otherwise it is the supplied writer.
+func (g *grouper) writer(group string, w io.Writer) io.Writer {
+	if g == nil {
+		return w
+	}
+	g.l.Lock()
+	defer g.l.Unlock()
+	buf, ok := g.out[group]
+	if !ok {
+		buf = &groupBuffer{}
+		g.out[group] = buf
+	}
+	return buf
+}
+
+// print calls the supplied function with the writer for the output of an object of the supplied group, which is
+// the writer of sio when output is not grouped.
+func (g *grouper) print(group string, fn func(w io.Writer)) {
+	fn(g.writer(group, sio.Output))
+}
+
+// flush writes the buffered output of every group that has output to the supplied writer under a header for the
+// group, in group order, and clears it.
+func (g *grouper) flush(w io.Writer) {
+	if g == nil {
+		return
+	}
+	g.l.Lock()
+	defer g.l.Unlock()
+	var groups []string
+	for group, buf := range g.out {
+		if buf.buf.Len() > 0 {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		sio.Fnoticef(w, "%s %s\n", g.by, group)
+		w.Write(g.out[group].buf.Bytes())
+	}
+	g.out = map[string]*groupBuffer{}
+}
+
+// groupCount increments a count of group stats for every object in a list of display names.
+type groupCount struct {
+	names []string
+	inc   func(s *groupStats)
+}
+
+// summarize returns the stats of all groups for the supplied counts, along with the total time taken to process
+// the objects of each group.
+func (g *grouper) summarize(counts ...groupCount) map[string]*groupStats {
+	ret := map[string]*groupStats{}
+	get := func(name string) *groupStats {
+		group := g.groups[name]
+		s, ok := ret[group]
+		if !ok {
+			s = &groupStats{}
+			ret[group] = s
+		}
+		return s
+	}
+	for _, c := range counts {
+		for _, name := range c.names {
+			c.inc(get(name))
+		}
+	}
+	durations := map[string]time.Duration{}
+	for name, d := range g.durations {
+		get(name)
+		durations[g.groups[name]] += d
+	}
+	for group, d := range durations {
+		if d > 0 {
+			ret[group].Duration = d.Round(time.Millisecond).String()
+		}
+	}
+	return ret
+}
@@ -0,0 +1,177 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// hostObject returns true if the supplied type is an ingress or a route that has hostnames.
+func hostObject(gvk schema.GroupVersionKind) bool {
+	switch gvk.Kind {
+	case "Ingress":
+		return gvk.Group == "extensions" || gvk.Group == "networking.k8s.io"
+	case "HTTPRoute", "GRPCRoute", "TLSRoute":
+		return gvk.Group == "gateway.networking.k8s.io"
+	}
+	return false
+}
+
+// mapHosts replaces every hostname of the supplied ingress or route object with the result of the mapper.
+func mapHosts(u *unstructured.Unstructured, mapper func(host string) (string, error)) error {
+	mapList := func(list []interface{}) error {
+		for i, h := range list {
+			if s, ok := h.(string); ok {
+				out, err := mapper(s)
+				if err != nil {
+					return err
+				}
+				list[i] = out
+			}
+		}
+		return nil
+	}
+	spec, _ := u.Object["spec"].(map[string]interface{})
+	if spec == nil {
+		return nil
+	}
+	if u.GetKind() != "Ingress" {
+		hosts, _ := spec["hostnames"].([]interface{})
+		return mapList(hosts)
+	}
+	rules, _ := spec["rules"].([]interface{})
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		if h, ok := rule["host"].(string); ok {
+			out, err := mapper(h)
+			if err != nil {
+				return err
+			}
+			rule["host"] = out
+		}
+	}
+	tls, _ := spec["tls"].([]interface{})
+	for _, t := range tls {
+		entry, _ := t.(map[string]interface{})
+		hosts, _ := entry["hosts"].([]interface{})
+		if err := mapList(hosts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectHosts returns the distinct hostnames of the supplied ingress or route object in sorted order.
+func objectHosts(u *unstructured.Unstructured) []string {
+	seen := map[string]bool{}
+	_ = mapHosts(u, func(host string) (string, error) {
+		if host != "" {
+			seen[host] = true
+		}
+		return host, nil
+	})
+	var ret []string
+	for h := range seen {
+		ret = append(ret, h)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+var reHostPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// envProperties returns the decrypted properties of the supplied environment. For previews, properties of the preview
+// override those of the base environment.
+func envProperties(app *model.App, env string) (map[string]string, error) {
+	ret := map[string]string{}
+	for k, v := range app.Spec.Environments[env].Properties {
+		ret[k] = v
+	}
+	if p := app.Preview(env); p != nil {
+		for k, v := range p.Props {
+			ret[k] = v
+		}
+	}
+	return app.DecryptProperties(env, ret)
+}
+
+// evalCluster returns the cluster of the supplied environment, or of the base of its preview, with decrypted
+// properties, for use in evaluation. It returns nil if the environment is not a cluster.
+func evalCluster(app *model.App, env string) (*model.Cluster, error) {
+	c := app.Cluster(env)
+	if p := app.Preview(env); p != nil {
+		c = app.Cluster(p.Base)
+	}
+	if c == nil {
+		return nil, nil
+	}
+	props, err := app.DecryptProperties(c.Env, c.Properties)
+	if err != nil {
+		return nil, err
+	}
+	ret := *c
+	ret.Properties = props
+	return &ret, nil
+}
+
+// templateHosts replaces placeholders in hostnames of ingress and route objects for the supplied environment.
+// The placeholders {env} and {namespace} are replaced with the environment name and its default namespace and
+// {<name>} with the value of the named environment property.
+func templateHosts(app *model.App, env string, defaultNs string, objects []model.K8sLocalObject) error {
+	if _, ok := app.Spec.Environments[env]; !ok {
+		return nil
+	}
+	values, err := envProperties(app, env)
+	if err != nil {
+		return err
+	}
+	values["env"] = env
+	values["namespace"] = defaultNs
+	for _, o := range objects {
+		if !hostObject(o.GetObjectKind().GroupVersionKind()) {
+			continue
+		}
+		err := mapHosts(o.ToUnstructured(), func(host string) (string, error) {
+			var unknown []string
+			out := reHostPlaceholder.ReplaceAllStringFunc(host, func(m string) string {
+				name := strings.Trim(m, "{}")
+				v, ok := values[name]
+				if !ok {
+					unknown = append(unknown, name)
+					return m
+				}
+				return v
+			})
+			if len(unknown) > 0 {
+				return "", fmt.Errorf("%s: host %q has unknown placeholder(s) %s, must be env, namespace or a property of environment %s",
+					o, host, strings.Join(unknown, ", "), env)
+			}
+			return out, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// newRoutesScaffold returns a scaffold for the routes app, whose dev and dev2 environments share a server, with the
+// domain properties of the environments set to the supplied values.
+func newRoutesScaffold(t *testing.T, devDomain, dev2Domain string) *scaffold {
+	s := newScaffoldIn(t, "testdata/routes-app")
+	for env, domain := range map[string]string{"dev": devDomain, "dev2": dev2Domain} {
+		e := s.opts.app.Spec.Environments[env]
+		e.Properties = map[string]string{"domain": domain}
+		s.opts.app.Spec.Environments[env] = e
+	}
+	return s
+}
+
+func routeHosts(t *testing.T, s *scaffold, env string) []string {
+	objects, err := filteredObjects(s.opts, env, filterParams{includes: []string{"routes"}})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(objects))
+	return objectHosts(objects[0].ToUnstructured())
+}
+
+func TestTemplateHosts(t *testing.T) {
+	s := newRoutesScaffold(t, "example.com", "example.org")
+	defer s.reset()
+	a := assert.New(t)
+	a.EqualValues([]string{"svc2-dev.example.com", "svc2.example.com"}, routeHosts(t, s, "dev"))
+	a.EqualValues([]string{"svc2-dev2.example.org", "svc2.example.org"}, routeHosts(t, s, "dev2"))
+}
+
+func TestTemplateHostsPreview(t *testing.T) {
+	s := newRoutesScaffold(t, "example.com", "example.org")
+	defer s.reset()
+	_, err := s.opts.app.AddPreview("dev", "pr-1", map[string]string{"domain": "{suffix}.example.com"})
+	require.Nil(t, err)
+	assert.EqualValues(t, []string{"svc2-dev-pr-1.pr-1.example.com", "svc2.pr-1.example.com"}, routeHosts(t, s, "dev-pr-1"))
+}
+
+func TestTemplateHostsUnknownPlaceholder(t *testing.T) {
+	s := newRoutesScaffold(t, "example.com", "example.org")
+	defer s.reset()
+	dev := s.opts.app.Spec.Environments["dev"]
+	dev.Properties = nil
+	s.opts.app.Spec.Environments["dev"] = dev
+	err := s.executeCommand("show", "dev", "-c", "routes")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), `host "svc2.{domain}" has unknown placeholder(s) domain, must be env, namespace or a property of environment dev`)
+}
+
+func TestTemplateHostsEncrypted(t *testing.T) {
+	s := newRoutesScaffold(t, "ENC[rot13:cmtuemN5ci5wYno=]", "ENC[bad:cmtuemN5ci5wYno=]")
+	defer s.reset()
+	s.opts.app.Spec.KeyProviders = []model.KeyProvider{{Name: "rot13", Command: []string{"tr", "a-z", "n-za-m"}}}
+	assert.EqualValues(t, []string{"svc2-dev.example.com", "svc2.example.com"}, routeHosts(t, s, "dev"))
+	_, err := filteredObjects(s.opts, "dev2", filterParams{includes: []string{"routes"}})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "env dev2: decrypt property domain: undefined key provider bad")
+}
+
+func TestPropertySchema(t *testing.T) {
+	s := newRoutesScaffold(t, "dev.example.com", "dev2.example.com")
+	defer s.reset()
+	s.opts.app.Spec.PropertySchema = map[string]interface{}{
+		"required":             []interface{}{"domain"},
+		"properties":           map[string]interface{}{"domain": map[string]interface{}{"type": "string"}},
+		"additionalProperties": false,
+	}
+	err := s.executeCommand("show", "dev")
+	require.Nil(t, err)
+
+	dev := s.opts.app.Spec.Environments["dev"]
+	dev.Properties = map[string]string{"domian": "dev.example.com"}
+	s.opts.app.Spec.Environments["dev"] = dev
+	err = s.executeCommand("show", "dev")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Contains(err.Error(), "environment dev: 2 property validation error(s): ")
+	a.Contains(err.Error(), "property.domian in body is a forbidden property")
+	a.Contains(err.Error(), "property.domain in body is required")
+}
+
+func TestValidateCheckHosts(t *testing.T) {
+	s := newRoutesScaffold(t, "example.com", "example.com")
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	err := s.executeCommand("validate", "dev", "-c", "routes", "--check-hosts")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 host conflict(s) found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ host svc2.example.com of Ingress:bar-system:svc2-ingress is also used by Ingress:bar-system:svc2-ingress in environment dev2`))
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"host svc2.example.com of Ingress:bar-system:svc2-ingress is also used by Ingress:bar-system:svc2-ingress in environment dev2"}, stats["hostConflicts"])
+}
+
+func TestValidateCheckHostsNoConflicts(t *testing.T) {
+	s := newRoutesScaffold(t, "example.com", "example.org")
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	err := s.executeCommand("validate", "dev", "-c", "routes", "--check-hosts")
+	require.Nil(t, err)
+}
+
+func TestValidateCheckLiveHosts(t *testing.T) {
+	s := newRoutesScaffold(t, "example.com", "example.org")
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	ingress := func(ns, name string, labels map[string]interface{}, host string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1beta1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"namespace": ns, "name": name, "labels": labels},
+			"spec": map[string]interface{}{
+				"rules": []interface{}{map[string]interface{}{"host": host}},
+			},
+		}}
+	}
+	var listed schema.GroupVersionKind
+	s.opts.client.listObjectsFunc = func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		listed = gvk
+		return []*unstructured.Unstructured{
+			ingress("bar-system", "svc2-ingress", map[string]interface{}{
+				model.QbecNames.ApplicationLabel: "example1",
+				model.QbecNames.EnvironmentLabel: "dev",
+			}, "svc2.example.com"),
+			ingress("web", "web", nil, "svc2-dev.example.com"),
+			ingress("other", "other", nil, "other.example.com"),
+		}, nil
+	}
+	err := s.executeCommand("validate", "dev", "-c", "routes", "--check-live-hosts")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("Ingress", listed.Kind)
+	a.Equal("1 host conflict(s) found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ host svc2-dev.example.com of Ingress:bar-system:svc2-ingress is also used by live object Ingress:web:web`))
+}
@@ -0,0 +1,135 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+)
+
+// defaultRegistry is the registry of images that do not name one.
+const defaultRegistry = "docker.io"
+
+// imageRef is a parsed container image reference.
+type imageRef struct {
+	registry   string // registry host, defaultRegistry when not specified
+	repository string // path of the image in the registry
+	tag        string // tag, blank when not specified
+	digest     string // digest, blank when not specified
+}
+
+// parseImage parses the supplied image reference, of the form [registry/]repository[:tag][@digest].
+func parseImage(image string) imageRef {
+	var ret imageRef
+	name := image
+	if pos := strings.Index(name, "@"); pos >= 0 {
+		name, ret.digest = name[:pos], name[pos+1:]
+	}
+	if pos := strings.LastIndex(name, ":"); pos > strings.LastIndex(name, "/") {
+		name, ret.tag = name[:pos], name[pos+1:]
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ret.registry, ret.repository = parts[0], parts[1]
+	} else {
+		ret.registry, ret.repository = defaultRegistry, name
+		if len(parts) == 1 {
+			ret.repository = "library/" + name
+		}
+	}
+	return ret
+}
+
+// allowedRegistry returns true if the supplied image is pulled from one of the supplied registries or registry paths.
+func allowedRegistry(ref imageRef, registries []string) bool {
+	if len(registries) == 0 {
+		return true
+	}
+	name := ref.registry + "/" + ref.repository
+	for _, r := range registries {
+		r = strings.TrimSuffix(r, "/")
+		if r == ref.registry || r == name || strings.HasPrefix(name, r+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// exemptImage returns true if the supplied image matches one of the supplied patterns.
+func exemptImage(image string, exceptions []string) bool {
+	for _, pattern := range exceptions {
+		if ok, _ := path.Match(pattern, image); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containerImages returns the images of the containers of the supplied object keyed by container name, in the order
+// of the containers, or nil if the object does not have a pod template.
+func containerImages(o model.K8sLocalObject) (names []string, images map[string]string) {
+	spec, _, ok := podTemplate(o.ToUnstructured())
+	if !ok {
+		return nil, nil
+	}
+	images = map[string]string{}
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, c := range toMaps(spec[field]) {
+			name, _ := c["name"].(string)
+			image, _ := c["image"].(string)
+			if image == "" {
+				continue
+			}
+			names = append(names, name)
+			images[name] = image
+		}
+	}
+	return names, images
+}
+
+// imageViolations returns violations of the supplied image policy by the containers of the supplied objects. Images
+// matching the supplied exceptions are not checked.
+func imageViolations(objects []model.K8sLocalObject, client validateClient, env string, p *model.ImagePolicy, exceptions []string) []string {
+	if p == nil {
+		return nil
+	}
+	var ret []string
+	for _, o := range objects {
+		names, images := containerImages(o)
+		for _, container := range names {
+			image := images[container]
+			if exemptImage(image, exceptions) {
+				continue
+			}
+			ref := parseImage(image)
+			prefix := fmt.Sprintf("%s: image %s of container %s", client.DisplayName(o), image, container)
+			if !allowedRegistry(ref, p.AllowedRegistries) {
+				ret = append(ret, prefix+" is not from an allowed registry")
+			}
+			if p.ForbidLatest && (ref.tag == "latest" || (ref.tag == "" && ref.digest == "")) {
+				ret = append(ret, prefix+" uses the latest tag")
+			}
+			if p.RequireDigest && ref.digest == "" {
+				ret = append(ret, fmt.Sprintf("%s is not pinned by digest in environment %s", prefix, env))
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImage(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(imageRef{registry: "docker.io", repository: "library/nginx"}, parseImage("nginx"))
+	a.Equal(imageRef{registry: "docker.io", repository: "bitnami/redis", tag: "6.2"}, parseImage("bitnami/redis:6.2"))
+	a.Equal(imageRef{registry: "localhost:5000", repository: "app", tag: "dev"}, parseImage("localhost:5000/app:dev"))
+	a.Equal(imageRef{registry: "gcr.io", repository: "proj/app", tag: "1.0", digest: "sha256:abc"}, parseImage("gcr.io/proj/app:1.0@sha256:abc"))
+	a.Equal(imageRef{registry: "gcr.io", repository: "proj/app", digest: "sha256:abc"}, parseImage("gcr.io/proj/app@sha256:abc"))
+}
+
+func TestAllowedRegistry(t *testing.T) {
+	a := assert.New(t)
+	a.True(allowedRegistry(parseImage("nginx"), nil))
+	a.True(allowedRegistry(parseImage("nginx"), []string{"docker.io"}))
+	a.True(allowedRegistry(parseImage("gcr.io/proj/app"), []string{"gcr.io/proj"}))
+	a.True(allowedRegistry(parseImage("gcr.io/proj/app"), []string{"gcr.io/proj/"}))
+	a.False(allowedRegistry(parseImage("gcr.io/proj2/app"), []string{"gcr.io/proj"}))
+	a.False(allowedRegistry(parseImage("nginx"), []string{"gcr.io"}))
+}
+
+func TestImageViolations(t *testing.T) {
+	objects := []model.K8sLocalObject{
+		semanticObject(t, "web", `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: web
+        image: gcr.io/proj/web:latest
+      - name: proxy
+        image: gcr.io/proj/proxy:1.2@sha256:abc
+      - name: agent
+        image: quay.io/vendor/agent:3.1
+`),
+		semanticObject(t, "web", `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  image: nginx
+`),
+	}
+	p := &model.ImagePolicy{AllowedRegistries: []string{"gcr.io/proj"}, ForbidLatest: true, RequireDigest: true}
+	a := assert.New(t)
+	a.Equal([]string{
+		"Deployment::web: image busybox of container init is not from an allowed registry",
+		"Deployment::web: image busybox of container init uses the latest tag",
+		"Deployment::web: image busybox of container init is not pinned by digest in environment prod",
+		"Deployment::web: image gcr.io/proj/web:latest of container web uses the latest tag",
+		"Deployment::web: image gcr.io/proj/web:latest of container web is not pinned by digest in environment prod",
+	}, imageViolations(objects, &client{}, "prod", p, []string{"quay.io/vendor/*"}))
+	a.Nil(imageViolations(objects, &client{}, "prod", nil, nil))
+}
+
+func TestValidateImagePolicy(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	s.opts.verbosity = 1
+	s.opts.app.Spec.ImagePolicy = &model.ImagePolicy{ForbidLatest: true}
+	err := s.executeCommand("validate", "dev")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`^validator images took \d+`))
+}
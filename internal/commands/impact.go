@@ -0,0 +1,151 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// impact is the expected effect of applying a change to an object on the workloads of a cluster.
+type impact int
+
+// impacts in increasing order of risk
+const (
+	impactNone       impact = iota // the change is applied in place without restarting anything
+	impactRestart                  // pods are replaced by a rolling update
+	impactDisruptive               // the object must be recreated or its pods are replaced all at once
+)
+
+func (i impact) String() string {
+	switch i {
+	case impactRestart:
+		return "rolling-restart"
+	case impactDisruptive:
+		return "disruptive"
+	default:
+		return "non-disruptive"
+	}
+}
+
+// hasPath returns true if the supplied path is the prefix or one of the prefixes, or is nested under one of them.
+func hasPath(path string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// changedPaths returns the sorted paths of leaf values that differ between the supplied objects.
+func changedPaths(left, right map[string]interface{}) []string {
+	l, r := map[string]string{}, map[string]string{}
+	flatten("", left, l)
+	flatten("", right, r)
+	var ret []string
+	for k, v := range l {
+		if rv, ok := r[k]; !ok || rv != v {
+			ret = append(ret, k)
+		}
+	}
+	for k := range r {
+		if _, ok := l[k]; !ok {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// pathImpact returns the impact of a change to the value at the supplied path of an object.
+func pathImpact(gk schema.GroupKind, path string, left, right *unstructured.Unstructured) impact {
+	if hasPath(path, "metadata", "status") {
+		return impactNone
+	}
+	workload := gk.Group == "" && gk.Kind == "ReplicationController" ||
+		(gk.Group == "apps" || gk.Group == "extensions") && (gk.Kind == "Deployment" || gk.Kind == "ReplicaSet" || gk.Kind == "DaemonSet") ||
+		gk.Group == "apps" && gk.Kind == "StatefulSet"
+	switch {
+	case gk.Group == "" && gk.Kind == "Pod":
+		return impactDisruptive
+	case workload:
+		switch {
+		case hasPath(path, "spec.selector"):
+			return impactDisruptive
+		case gk.Kind == "StatefulSet" && hasPath(path, "spec.volumeClaimTemplates", "spec.serviceName", "spec.podManagementPolicy"):
+			return impactDisruptive
+		case hasPath(path, "spec.template"):
+			if strategy, _ := nestedValue(right.Object, "spec", "strategy", "type").(string); strategy == "Recreate" {
+				return impactDisruptive
+			}
+			return impactRestart
+		}
+	case gk.Group == "batch" && gk.Kind == "Job":
+		if hasPath(path, "spec.selector", "spec.template", "spec.completions") {
+			return impactDisruptive
+		}
+	case gk.Group == "" && gk.Kind == "Service":
+		if hasPath(path, "spec.clusterIP", "spec.type") {
+			return impactDisruptive
+		}
+	case gk.Group == "" && gk.Kind == "PersistentVolumeClaim":
+		if hasPath(path, "spec") && !hasPath(path, "spec.resources.requests.storage") {
+			return impactDisruptive
+		}
+	case gk.Group == "" && gk.Kind == "PersistentVolume":
+		if hasPath(path, "spec") {
+			return impactDisruptive
+		}
+	case gk.Group == "" && (gk.Kind == "ConfigMap" || gk.Kind == "Secret"):
+		if immutable, _ := nestedValue(left.Object, "immutable").(bool); immutable && !hasPath(path, "immutable") {
+			return impactDisruptive
+		}
+	}
+	return impactNone
+}
+
+// changeImpact returns the impact of changing the supplied live object to the supplied local one, along with
+// the paths of the changes that have that impact.
+func changeImpact(left, right *unstructured.Unstructured) (impact, []string) {
+	gk := right.GroupVersionKind().GroupKind()
+	ret := impactNone
+	var paths []string
+	for _, p := range changedPaths(left.Object, right.Object) {
+		i := pathImpact(gk, p, left, right)
+		switch {
+		case i > ret:
+			ret = i
+			paths = []string{p}
+		case i == ret:
+			paths = append(paths, p)
+		}
+	}
+	return ret, paths
+}
+
+// summarizePaths returns the supplied paths as a comma-separated list, truncated to a maximum number of paths.
+func summarizePaths(paths []string) string {
+	if len(paths) <= maxDifferences {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:maxDifferences], ", "), len(paths)-maxDifferences)
+}
@@ -0,0 +1,129 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestChangeImpact(t *testing.T) {
+	obj := func(apiVersion, kind string, fields map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "foo", "namespace": "bar"},
+		}}
+		for k, v := range fields {
+			u.Object[k] = v
+		}
+		return u
+	}
+	deploySpec := func(image, strategy string, labels map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"spec": map[string]interface{}{
+				"replicas": 1,
+				"selector": map[string]interface{}{"matchLabels": labels},
+				"strategy": map[string]interface{}{"type": strategy},
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{map[string]interface{}{"name": "main", "image": image}},
+					},
+				},
+			},
+		}
+	}
+	labels := map[string]interface{}{"app": "foo"}
+	tests := []struct {
+		name   string
+		left   *unstructured.Unstructured
+		right  *unstructured.Unstructured
+		impact impact
+		paths  []string
+	}{
+		{
+			name:   "config map data",
+			left:   obj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "1"}}),
+			right:  obj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "2"}}),
+			impact: impactNone,
+			paths:  []string{"data.a"},
+		},
+		{
+			name:   "immutable config map",
+			left:   obj("v1", "ConfigMap", map[string]interface{}{"immutable": true, "data": map[string]interface{}{"a": "1"}}),
+			right:  obj("v1", "ConfigMap", map[string]interface{}{"immutable": true, "data": map[string]interface{}{"a": "2"}}),
+			impact: impactDisruptive,
+			paths:  []string{"data.a"},
+		},
+		{
+			name:   "image",
+			left:   obj("apps/v1", "Deployment", deploySpec("nginx:1", "RollingUpdate", labels)),
+			right:  obj("apps/v1", "Deployment", deploySpec("nginx:2", "RollingUpdate", labels)),
+			impact: impactRestart,
+			paths:  []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name:   "recreate strategy",
+			left:   obj("apps/v1", "Deployment", deploySpec("nginx:1", "Recreate", labels)),
+			right:  obj("apps/v1", "Deployment", deploySpec("nginx:2", "Recreate", labels)),
+			impact: impactDisruptive,
+			paths:  []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name:   "selector",
+			left:   obj("apps/v1", "Deployment", deploySpec("nginx:1", "RollingUpdate", labels)),
+			right:  obj("apps/v1", "Deployment", deploySpec("nginx:2", "RollingUpdate", map[string]interface{}{"app": "bar"})),
+			impact: impactDisruptive,
+			paths:  []string{"spec.selector.matchLabels.app"},
+		},
+		{
+			name:   "pvc resize",
+			left:   obj("v1", "PersistentVolumeClaim", map[string]interface{}{"spec": map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"storage": "1Gi"}}}}),
+			right:  obj("v1", "PersistentVolumeClaim", map[string]interface{}{"spec": map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"storage": "2Gi"}}}}),
+			impact: impactNone,
+			paths:  []string{"spec.resources.requests.storage"},
+		},
+		{
+			name:   "pvc class",
+			left:   obj("v1", "PersistentVolumeClaim", map[string]interface{}{"spec": map[string]interface{}{"storageClassName": "slow"}}),
+			right:  obj("v1", "PersistentVolumeClaim", map[string]interface{}{"spec": map[string]interface{}{"storageClassName": "fast"}}),
+			impact: impactDisruptive,
+			paths:  []string{"spec.storageClassName"},
+		},
+		{
+			name:   "labels",
+			left:   obj("v1", "Pod", nil),
+			right:  obj("v1", "Pod", map[string]interface{}{"metadata": map[string]interface{}{"name": "foo", "namespace": "bar", "labels": labels}}),
+			impact: impactNone,
+			paths:  []string{"metadata.labels.app"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i, paths := changeImpact(test.left, test.right)
+			assert.Equal(t, test.impact, i)
+			assert.Equal(t, test.paths, paths)
+		})
+	}
+}
+
+func TestSummarizePaths(t *testing.T) {
+	assert.Equal(t, "a, b", summarizePaths([]string{"a", "b"}))
+	assert.Equal(t, "a, b, c and 2 more", summarizePaths([]string{"a", "b", "c", "d", "e"}))
+}
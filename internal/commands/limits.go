@@ -0,0 +1,42 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/splunk/qbec/internal/model"
+)
+
+// checkChangeLimits returns an error if an apply of the supplied number of objects, of which some are created or
+// updated, along with the supplied number of deletions exceeds the change limits of the app.
+func checkChangeLimits(limits *model.ChangeLimits, total, changed, deletions int) error {
+	if limits.MaxDeletions > 0 && deletions > limits.MaxDeletions {
+		return fmt.Errorf("apply would delete %d object(s), more than the limit of %d in qbec.yaml, use --allow-large-changes if this is intended",
+			deletions, limits.MaxDeletions)
+	}
+	all := total + deletions
+	if limits.MaxChangePercent > 0 && all > 0 {
+		count := changed + deletions
+		percent := count * 100 / all
+		if count*100 > limits.MaxChangePercent*all {
+			return fmt.Errorf("apply would change %d of %d object(s) (%d%%), more than the limit of %d%% in qbec.yaml, use --allow-large-changes if this is intended",
+				count, all, percent, limits.MaxChangePercent)
+		}
+	}
+	return nil
+}
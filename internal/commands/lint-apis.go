@@ -0,0 +1,220 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// statuses of API versions used by objects
+const (
+	apiDeprecated = "deprecated"
+	apiRemoved    = "removed"
+)
+
+// apiUsage is the use of a deprecated or removed API version by an object.
+type apiUsage struct {
+	Object      string `json:"object"`
+	Component   string `json:"component"`
+	APIVersion  string `json:"apiVersion"`
+	Status      string `json:"status"`
+	RemovedIn   string `json:"removedIn,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+func (u apiUsage) String() string {
+	var s string
+	if u.Status == apiRemoved {
+		s = fmt.Sprintf("%s uses apiVersion %s which was removed in Kubernetes %s", u.Object, u.APIVersion, u.RemovedIn)
+	} else {
+		s = fmt.Sprintf("%s uses apiVersion %s which is deprecated and will be removed in Kubernetes %s", u.Object, u.APIVersion, u.RemovedIn)
+	}
+	if u.Replacement == "" {
+		return s + ", no replacement is available"
+	}
+	return s + ", use " + u.Replacement
+}
+
+// lintAPIsClient is the remote interface needed to lint API versions.
+type lintAPIsClient interface {
+	DisplayName(o model.K8sMeta) string
+	ServerVersion() (string, error)
+}
+
+// targetMinor returns the minor version of Kubernetes 1.x of the cluster or the targeted Kubernetes version.
+func targetMinor(client lintAPIsClient) (int, error) {
+	v, err := client.ServerVersion()
+	if err != nil {
+		return 0, err
+	}
+	return remote.ParseKubernetesVersion(v)
+}
+
+// apiUsages returns the uses of API versions by the supplied objects that are deprecated or removed in
+// Kubernetes 1.<minor>, in object order.
+func apiUsages(objects []model.K8sLocalObject, client lintAPIsClient, minor int) []apiUsage {
+	ret := []apiUsage{}
+	for _, o := range objects {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		status := remote.APIVersionStatus(gvk, minor)
+		if status == nil {
+			continue
+		}
+		u := apiUsage{
+			Object:     client.DisplayName(o),
+			Component:  o.Component(),
+			APIVersion: gvk.GroupVersion().String(),
+			Status:     apiDeprecated,
+			RemovedIn:  fmt.Sprintf("1.%d", status.RemovedIn),
+		}
+		if status.Removed {
+			u.Status = apiRemoved
+		}
+		if !status.Replacement.Empty() {
+			u.Replacement = status.Replacement.String()
+		}
+		ret = append(ret, u)
+	}
+	return ret
+}
+
+// apiFindings returns the messages for the supplied API usages, split into removed and deprecated versions.
+func apiFindings(usages []apiUsage) (removed, deprecated []string) {
+	for _, u := range usages {
+		if u.Status == apiRemoved {
+			removed = append(removed, u.String())
+		} else {
+			deprecated = append(deprecated, u.String())
+		}
+	}
+	return removed, deprecated
+}
+
+type lintAPIsCommandConfig struct {
+	StdOptions
+	format         string
+	offline        *offlineTarget
+	filterFunc     func() (filterParams, error)
+	clientProvider func(env string) (lintAPIsClient, error)
+}
+
+func doLintAPIs(args []string, config lintAPIsCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	env := args[0]
+	if env == model.Baseline {
+		return newUsageError("cannot lint baseline environment, use a real environment")
+	}
+	switch config.format {
+	case "", "json", "yaml":
+	default:
+		return newUsageError(fmt.Sprintf("invalid output format: %q", config.format))
+	}
+	if err := config.offline.check(); err != nil {
+		return err
+	}
+	if config.offline.enabled() {
+		config.clientProvider = func(env string) (lintAPIsClient, error) {
+			return config.offline.client(config, env)
+		}
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	objects, err := filteredObjects(config, env, fp)
+	if err != nil {
+		return err
+	}
+	client, err := config.clientProvider(env)
+	if err != nil {
+		return err
+	}
+	minor, err := targetMinor(client)
+	if err != nil {
+		return err
+	}
+	usages := apiUsages(objects, client, minor)
+	removed, deprecated := apiFindings(usages)
+
+	w := config.Stdout()
+	switch config.format {
+	case "yaml":
+		b, err := yaml.Marshal(usages)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(usages); err != nil {
+			return err
+		}
+	default:
+		red, dim, reset := "", "", ""
+		if config.Colorize() {
+			red, dim, reset = escRed, escDim, escReset
+		}
+		for _, m := range removed {
+			fmt.Fprintf(w, "%s%s %s%s\n", red, unicodeX, m, reset)
+		}
+		for _, m := range deprecated {
+			fmt.Fprintf(w, "%s%s %s%s\n", dim, unicodeQuestion, m, reset)
+		}
+		if len(usages) == 0 {
+			sio.Noticef("no deprecated or removed API versions used for Kubernetes 1.%d\n", minor)
+		}
+	}
+	if len(removed) > 0 {
+		return fmt.Errorf("%d object(s) use API versions removed in Kubernetes 1.%d", len(removed), minor)
+	}
+	return nil
+}
+
+func newLintAPIsCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "lint-apis <environment>",
+		Short:   "report objects that use API versions deprecated or removed in the Kubernetes version of the cluster",
+		Example: lintAPIsExamples(),
+	}
+
+	config := lintAPIsCommandConfig{
+		clientProvider: func(env string) (lintAPIsClient, error) {
+			return op().Client(env)
+		},
+		filterFunc: addFilterParams(cmd, op, true),
+		offline:    &offlineTarget{clients: map[string]*offlineClient{}},
+	}
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable output")
+	cmd.Flags().StringVar(&config.offline.version, "k8s-version", "", "check against this Kubernetes version, e.g. 1.25, instead of the version of the cluster")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doLintAPIs(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,174 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serverVersion(v string) func() (string, error) {
+	return func() (string, error) { return v, nil }
+}
+
+func TestLintAPIs(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.versionFunc = serverVersion("1.21")
+	err := s.executeCommand("lint-apis", "dev", "-c", "cluster-objects")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("2 object(s) use API versions removed in Kubernetes 1.21", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`PodSecurityPolicy::100-default uses apiVersion extensions/v1beta1 which was removed in Kubernetes 1\.16, use policy/v1beta1`))
+	s.assertOutputLineMatch(regexp.MustCompile(`ClusterRole::allow-root-psp-policy uses apiVersion rbac.authorization.k8s.io/v1beta1 which is deprecated and will be removed in Kubernetes 1\.22, use rbac.authorization.k8s.io/v1`))
+}
+
+func TestLintAPIsJSON(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.versionFunc = serverVersion("1.25")
+	err := s.executeCommand("lint-apis", "dev", "-c", "cluster-objects", "-k", "clusterrolebindings", "-o", "json")
+	require.NotNil(t, err)
+	var usages []apiUsage
+	require.Nil(t, s.jsonOutput(&usages))
+	assert.Equal(t, []apiUsage{
+		{
+			Object:      "ClusterRoleBinding::allow-root-psp-policy",
+			Component:   "cluster-objects",
+			APIVersion:  "rbac.authorization.k8s.io/v1beta1",
+			Status:      apiRemoved,
+			RemovedIn:   "1.22",
+			Replacement: "rbac.authorization.k8s.io/v1",
+		},
+		{
+			Object:      "ClusterRoleBinding::default-psp-policy",
+			Component:   "cluster-objects",
+			APIVersion:  "rbac.authorization.k8s.io/v1beta1",
+			Status:      apiRemoved,
+			RemovedIn:   "1.22",
+			Replacement: "rbac.authorization.k8s.io/v1",
+		},
+	}, usages)
+}
+
+func TestLintAPIsClean(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.versionFunc = serverVersion("1.27")
+	err := s.executeCommand("lint-apis", "dev", "-c", "service2", "-o", "json")
+	require.Nil(t, err)
+	var usages []apiUsage
+	require.Nil(t, s.jsonOutput(&usages))
+	assert.Equal(t, []apiUsage{}, usages)
+}
+
+func TestLintAPIsOffline(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.versionFunc = func() (string, error) {
+		return "", errors.New("cluster must not be contacted")
+	}
+	err := s.executeCommand("lint-apis", "dev", "-c", "cluster-objects", "--k8s-version", "1.20")
+	require.NotNil(t, err)
+	assert.Equal(t, "2 object(s) use API versions removed in Kubernetes 1.20", err.Error())
+}
+
+func TestValidateCheckAPIs(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	s.opts.client.versionFunc = serverVersion("1.21")
+	err := s.executeCommand("validate", "dev", "--check-apis", "-o", "json")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("2 object(s) use removed API versions", err.Error())
+	var r validateReport
+	require.Nil(t, s.jsonOutput(&r))
+	counts := map[string]int{}
+	for _, f := range r.Findings {
+		counts[f.Check+"/"+f.Level]++
+	}
+	a.Equal(map[string]int{"removed-api/error": 2, "deprecated-api/warning": 3}, counts)
+}
+
+func TestLintAPIsNegative(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		version string
+		asserts func(t *testing.T, err error)
+	}{
+		{
+			name: "no env",
+			args: []string{"lint-apis"},
+			asserts: func(t *testing.T, err error) {
+				a := assert.New(t)
+				a.True(isUsageError(err))
+				a.Equal("exactly one environment required", err.Error())
+			},
+		},
+		{
+			name: "baseline",
+			args: []string{"lint-apis", "_"},
+			asserts: func(t *testing.T, err error) {
+				a := assert.New(t)
+				a.True(isUsageError(err))
+				a.Equal("cannot lint baseline environment, use a real environment", err.Error())
+			},
+		},
+		{
+			name: "bad format",
+			args: []string{"lint-apis", "dev", "-o", "table"},
+			asserts: func(t *testing.T, err error) {
+				a := assert.New(t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid output format: "table"`, err.Error())
+			},
+		},
+		{
+			name: "bad version",
+			args: []string{"lint-apis", "dev", "--k8s-version", "2.0"},
+			asserts: func(t *testing.T, err error) {
+				a := assert.New(t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid Kubernetes version "2.0", must be of the form 1.<minor>`, err.Error())
+			},
+		},
+		{
+			name:    "unsupported server version",
+			args:    []string{"lint-apis", "dev"},
+			version: "1.12",
+			asserts: func(t *testing.T, err error) {
+				assert.Equal(t, "unsupported Kubernetes version 1.12, must be between 1.16 and 1.30", err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			s.opts.client.versionFunc = serverVersion(test.version)
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserts(t, err)
+		})
+	}
+}
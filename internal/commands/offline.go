@@ -0,0 +1,145 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// schemaCacheDir is the directory, relative to the app root, where upstream schemas of Kubernetes versions are cached.
+const schemaCacheDir = ".qbec/schemas"
+
+// offlineTarget is a Kubernetes version that commands target instead of a cluster.
+type offlineTarget struct {
+	version string
+	schema  string
+	cached  bool // use the cached upstream schema of the version
+	clients map[string]*offlineClient
+}
+
+// addOfflineFlags adds flags to target a Kubernetes version without contacting a cluster.
+func addOfflineFlags(cmd *cobra.Command) *offlineTarget {
+	t := &offlineTarget{clients: map[string]*offlineClient{}}
+	cmd.Flags().StringVar(&t.version, "k8s-version", "", "target this Kubernetes version, e.g. 1.27, using bundled capabilities instead of contacting a cluster")
+	cmd.Flags().StringVar(&t.schema, "k8s-schema", "", "with --k8s-version, the file or URL of the Open API document (swagger.json) of that version, for schema validation and server defaults")
+	return t
+}
+
+// enabled returns true if a Kubernetes version is targeted.
+func (t *offlineTarget) enabled() bool {
+	return t != nil && t.version != ""
+}
+
+// check returns a usage error for invalid flags.
+func (t *offlineTarget) check() error {
+	if t == nil {
+		return nil
+	}
+	if t.schema != "" && t.version == "" {
+		return newUsageError("--k8s-schema can only be used with --k8s-version")
+	}
+	if t.cached && t.version == "" {
+		return newUsageError("--offline requires --k8s-version to select the schema")
+	}
+	if t.cached && t.schema != "" {
+		return newUsageError("--offline cannot be used with --k8s-schema")
+	}
+	if t.version == "" {
+		return nil
+	}
+	if _, err := remote.ParseKubernetesVersion(t.version); err != nil {
+		return newUsageError(err.Error())
+	}
+	return nil
+}
+
+// client returns the client for the supplied environment, creating it on first use.
+func (t *offlineTarget) client(opts StdOptions, env string) (*offlineClient, error) {
+	if c, ok := t.clients[env]; ok {
+		return c, nil
+	}
+	schema := t.schema
+	if t.cached {
+		var err error
+		if schema, err = remote.CachedSchema(schemaCacheDir, t.version); err != nil {
+			return nil, err
+		}
+	}
+	sm, err := remote.NewOfflineMetadata(t.version, schema, opts.DefaultNamespace(env), opts.Verbosity())
+	if err != nil {
+		return nil, err
+	}
+	c := &offlineClient{sm: sm, version: t.version}
+	t.clients[env] = c
+	return c, nil
+}
+
+// warnUnserved warns about objects whose apiVersion is not served by the targeted version.
+func (t *offlineTarget) warnUnserved(opts StdOptions, env string, objects []model.K8sLocalObject) error {
+	c, err := t.client(opts, env)
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := c.sm.UnservedError(o.GetObjectKind().GroupVersionKind()); err != nil {
+			sio.Warnf("%s: %v\n", c.DisplayName(o), err)
+		}
+	}
+	return nil
+}
+
+// offlineClient implements the remote operations of commands that can target a Kubernetes version from offline
+// metadata. Operations that need live objects fail.
+type offlineClient struct {
+	sm      *remote.ServerMetadata
+	version string
+}
+
+func (c *offlineClient) ServerVersion() (string, error) {
+	return c.version, nil
+}
+
+func (c *offlineClient) DisplayName(o model.K8sMeta) string {
+	return c.sm.DisplayName(o)
+}
+
+func (c *offlineClient) IsNamespaced(kind schema.GroupVersionKind) (bool, error) {
+	return c.sm.IsNamespaced(kind)
+}
+
+func (c *offlineClient) ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, error) {
+	return c.sm.ValidatorFor(gvk)
+}
+
+func (c *offlineClient) FieldDefaults(obj *unstructured.Unstructured) ([]remote.FieldDefault, error) {
+	return c.sm.FieldDefaults(obj)
+}
+
+func (c *offlineClient) Get(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("cannot get %s objects when targeting a Kubernetes version", obj.GetKind())
+}
+
+func (c *offlineClient) ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("cannot list %s objects when targeting a Kubernetes version", gvk.Kind)
+}
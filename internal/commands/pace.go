@@ -0,0 +1,83 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"time"
+
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// progressSteps is the number of times progress is reported while operations are spread out.
+const progressSteps = 10
+
+// pacer spreads a number of operations evenly over a duration and reports progress. Operations that are skipped
+// do not use up time. A nil pacer does not wait.
+type pacer struct {
+	total    int
+	interval time.Duration
+	last     time.Time
+	count    int
+	reported int
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+// newPacer returns a pacer that spreads the supplied number of operations over the supplied duration, or nil if
+// operations should not be spread out.
+func newPacer(spread time.Duration, total int) *pacer {
+	if spread <= 0 || total == 0 {
+		return nil
+	}
+	sio.Noticef("spreading %d object(s) over %v\n", total, spread)
+	return &pacer{
+		total:    total,
+		interval: spread / time.Duration(total),
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// wait waits until the next operation is due, an interval after the previous one.
+func (p *pacer) wait() {
+	if p == nil {
+		return
+	}
+	if p.last.IsZero() {
+		p.last = p.now()
+		return
+	}
+	if d := p.last.Add(p.interval).Sub(p.now()); d > 0 {
+		p.sleep(d)
+	}
+	p.last = p.now()
+}
+
+// done records a completed operation and reports progress every time another step of the total is completed.
+func (p *pacer) done() {
+	if p == nil {
+		return
+	}
+	p.count++
+	step := p.count * progressSteps / p.total
+	if step == p.reported {
+		return
+	}
+	p.reported = step
+	remaining := p.interval * time.Duration(p.total-p.count)
+	sio.Noticef("processed %d of %d object(s), at most %v remaining\n", p.count, p.total, remaining.Round(time.Second))
+}
@@ -0,0 +1,60 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacer(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	assert.Nil(t, newPacer(0, 10))
+	assert.Nil(t, newPacer(time.Minute, 0))
+	var nilPacer *pacer
+	nilPacer.wait()
+	nilPacer.done()
+
+	p := newPacer(10*time.Minute, 20)
+	require.NotNil(t, p)
+	now := time.Now()
+	var slept []time.Duration
+	p.now = func() time.Time { return now }
+	p.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 { // odd objects are skipped without waiting
+			p.wait()
+			now = now.Add(10 * time.Second)
+		}
+		p.done()
+	}
+	require.Equal(t, 9, len(slept))
+	for _, d := range slept {
+		assert.Equal(t, 20*time.Second, d)
+	}
+	s.assertErrorLineMatch(regexp.MustCompile(`spreading 20 object\(s\) over 10m0s`))
+	s.assertErrorLineMatch(regexp.MustCompile(`processed 2 of 20 object\(s\), at most 9m0s remaining`))
+	s.assertErrorLineMatch(regexp.MustCompile(`processed 20 of 20 object\(s\), at most 0s remaining`))
+}
@@ -0,0 +1,399 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+var reJsonnetString = regexp.MustCompile(`^[^'\\\x00-\x1f]*$`)
+
+// jsonnetFieldPattern returns a pattern that matches the supplied name as a jsonnet field name, quoted or not.
+func jsonnetFieldPattern(name string) string {
+	q := regexp.QuoteMeta(name)
+	if reJsonnetID.MatchString(name) {
+		return `(?:` + q + `|'` + q + `'|"` + q + `")`
+	}
+	return `(?:'` + q + `'|"` + q + `")`
+}
+
+// jsonnetValue returns the supplied value as jsonnet code that fits on a single line, with strings in single quotes
+// when they do not need escapes.
+func jsonnetValue(v interface{}) (string, error) {
+	if s, ok := v.(string); ok && reJsonnetString.MatchString(s) {
+		return "'" + s + "'", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// envParamsFile returns the params file of the supplied environment, or the baseline for _, found as an import in
+// the params file of the app, which is how files laid out by qbec init map environments to their params.
+func envParamsFile(app *model.App, env string) (string, error) {
+	b, err := ioutil.ReadFile(app.Spec.ParamsFile)
+	if err != nil {
+		return "", err
+	}
+	re := regexp.MustCompile(`^\s*` + jsonnetFieldPattern(env) + `\s*:\s*import\s+['"]([^'"]+)['"]`)
+	for _, l := range strings.Split(string(b), "\n") {
+		if m := re.FindStringSubmatch(l); m != nil {
+			return filepath.Join(filepath.Dir(app.Spec.ParamsFile), filepath.FromSlash(m[1])), nil
+		}
+	}
+	return "", fmt.Errorf("no import found for %s in %s, use --file to specify its params file", env, app.Spec.ParamsFile)
+}
+
+// isJsonnetContent returns true if the supplied line is not blank or a single line comment.
+func isJsonnetContent(line string) bool {
+	t := strings.TrimSpace(line)
+	return t != "" && !strings.HasPrefix(t, "//") && !strings.HasPrefix(t, "#")
+}
+
+// paramsEditor edits the parameters of components in a params file in the layout of qbec init, where the
+// parameters of each component are in an object that starts on its own line in the components object.
+type paramsEditor struct {
+	file  string
+	lines []string
+}
+
+// blockEnd returns the index of the line that closes the object started on the supplied line.
+func (e *paramsEditor) blockEnd(i int) (int, error) {
+	indent := indentOf(e.lines[i])
+	for j := i + 1; j < len(e.lines); j++ {
+		t := strings.TrimSpace(e.lines[j])
+		if t != "" && indentOf(e.lines[j]) <= indent && strings.HasPrefix(t, "}") {
+			return j, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: no end found for the object at line %d", e.file, i+1)
+}
+
+// childIndent returns the indent of the fields of the object between the supplied lines.
+func (e *paramsEditor) childIndent(i, end int) int {
+	for j := i + 1; j < end; j++ {
+		if isJsonnetContent(e.lines[j]) {
+			return indentOf(e.lines[j])
+		}
+	}
+	step := 0
+	for _, l := range e.lines {
+		if n := indentOf(l); isJsonnetContent(l) && n > 0 && (step == 0 || n < step) {
+			step = n
+		}
+	}
+	if step == 0 {
+		step = 2
+	}
+	return indentOf(e.lines[i]) + step
+}
+
+// insert inserts the supplied lines before the supplied line of the object that starts at the supplied line, adding
+// a comma to the field before them when it has none.
+func (e *paramsEditor) insert(start, at int, lines ...string) {
+	for j := at - 1; j > start; j-- {
+		if isJsonnetContent(e.lines[j]) {
+			if !strings.HasSuffix(strings.TrimRight(e.lines[j], " "), ",") {
+				e.lines[j] = strings.TrimRight(e.lines[j], " ") + ","
+			}
+			break
+		}
+	}
+	e.lines = append(e.lines[:at], append(lines, e.lines[at:]...)...)
+}
+
+// find returns the index of the line with the supplied field, at the supplied indent, between the supplied lines
+// and -1 if there is none.
+func (e *paramsEditor) find(start, end, indent int, re *regexp.Regexp) int {
+	for j := start + 1; j < end; j++ {
+		if indentOf(e.lines[j]) == indent && re.MatchString(e.lines[j]) {
+			return j
+		}
+	}
+	return -1
+}
+
+// components returns the line that starts the components object and whether it is extended with +:.
+func (e *paramsEditor) components() (int, bool, error) {
+	for i, l := range e.lines {
+		if m := reParamsStart.FindStringSubmatch(l); m != nil {
+			return i, strings.Contains(l, "+"), nil
+		}
+	}
+	return 0, false, fmt.Errorf("%s: no components object found", e.file)
+}
+
+// componentBlock returns the start and end lines of the object with the params of the supplied component, with a
+// start of -1 when there is none.
+func (e *paramsEditor) componentBlock(component string) (int, int, error) {
+	ci, _, err := e.components()
+	if err != nil {
+		return 0, 0, err
+	}
+	cend, err := e.blockEnd(ci)
+	if err != nil {
+		return 0, 0, err
+	}
+	re := regexp.MustCompile(`^\s*` + jsonnetFieldPattern(component) + `\s*\+?:\s*\{\s*$`)
+	i := e.find(ci, cend, e.childIndent(ci, cend), re)
+	if i < 0 {
+		return -1, 0, nil
+	}
+	end, err := e.blockEnd(i)
+	return i, end, err
+}
+
+// field returns the line with the supplied param in the supplied object, or -1 if there is none. The value of the
+// param must be on the same line.
+func (e *paramsEditor) field(start, end int, component, name string) (int, error) {
+	re := regexp.MustCompile(`^\s*` + jsonnetFieldPattern(name) + `\s*\+?:(.*)$`)
+	j := e.find(start, end, e.childIndent(start, end), re)
+	if j < 0 {
+		return -1, nil
+	}
+	v := strings.TrimSuffix(strings.TrimSpace(re.FindStringSubmatch(e.lines[j])[1]), ",")
+	if v == "" || strings.HasSuffix(v, "{") || strings.HasSuffix(v, "[") || strings.HasSuffix(v, "(") || strings.HasPrefix(v, "|||") {
+		return 0, fmt.Errorf("%s: value of parameter %s of component %s is not on a single line at line %d", e.file, name, component, j+1)
+	}
+	return j, nil
+}
+
+// line returns the 1-based line of the supplied param of the supplied component, or 0 when the file does not set it
+// in the params object of the component.
+func (e *paramsEditor) line(component, name string) int {
+	start, end, err := e.componentBlock(component)
+	if err != nil || start < 0 {
+		return 0
+	}
+	re := regexp.MustCompile(`^\s*` + jsonnetFieldPattern(name) + `\s*\+?:`)
+	return e.find(start, end, e.childIndent(start, end), re) + 1
+}
+
+// set sets the supplied param of the supplied component to the supplied jsonnet value, adding the object with the
+// params of the component when needed.
+func (e *paramsEditor) set(component, name, value string) error {
+	start, end, err := e.componentBlock(component)
+	if err != nil {
+		return err
+	}
+	if start < 0 {
+		ci, extend, err := e.components()
+		if err != nil {
+			return err
+		}
+		cend, _ := e.blockEnd(ci)
+		pad := strings.Repeat(" ", e.childIndent(ci, cend))
+		sep := ": {"
+		if extend {
+			sep = " +: {"
+		}
+		e.insert(ci, cend, pad+jsonnetField(component)+sep, pad+"},")
+		start, end = cend, cend+1
+	}
+	j, err := e.field(start, end, component, name)
+	if err != nil {
+		return err
+	}
+	line := strings.Repeat(" ", e.childIndent(start, end)) + jsonnetField(name) + ": " + value + ","
+	if j >= 0 {
+		e.lines[j] = line
+		return nil
+	}
+	e.insert(start, end, line)
+	return nil
+}
+
+// unset removes the supplied param of the supplied component, and the object with the params of the component when
+// it has no other params. It returns false if the param is not set.
+func (e *paramsEditor) unset(component, name string) (bool, error) {
+	start, end, err := e.componentBlock(component)
+	if err != nil || start < 0 {
+		return false, err
+	}
+	j, err := e.field(start, end, component, name)
+	if err != nil || j < 0 {
+		return false, err
+	}
+	e.lines = append(e.lines[:j], e.lines[j+1:]...)
+	end--
+	for k := start + 1; k < end; k++ {
+		if isJsonnetContent(e.lines[k]) {
+			return true, nil
+		}
+	}
+	e.lines = append(e.lines[:start], e.lines[end+1:]...)
+	return true, nil
+}
+
+type paramEditCommandConfig struct {
+	StdOptions
+	file      string
+	jsonValue bool
+}
+
+// editParams edits the params file of the supplied environment with the supplied function, and restores it if the
+// params of the environment fail to evaluate after the edit or do not pass the supplied check.
+func editParams(config paramEditCommandConfig, env string, edit func(e *paramsEditor) error, check func(params interface{}) error) (string, error) {
+	app := config.App()
+	if _, ok := app.Spec.Environments[env]; env != model.Baseline && !ok {
+		return "", newUsageError(fmt.Sprintf("invalid environment %q", env))
+	}
+	file := config.file
+	if file == "" {
+		f, err := envParamsFile(app, env)
+		if err != nil {
+			return "", err
+		}
+		file = f
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	e := &paramsEditor{file: file, lines: strings.Split(string(b), "\n")}
+	if err := edit(e); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(file, []byte(strings.Join(e.lines, "\n")), 0644); err != nil {
+		return "", err
+	}
+	err = func() error {
+		paramsObject, err := envParams(config.StdOptions, env)
+		if err != nil {
+			return err
+		}
+		components, _ := paramsObject["components"].(map[string]interface{})
+		return check(components)
+	}()
+	if err != nil {
+		if rErr := ioutil.WriteFile(file, b, 0644); rErr != nil {
+			return "", fmt.Errorf("edited %s is invalid: %v, and restoring its original content failed, the file is left edited: %v", file, err, rErr)
+		}
+		return "", fmt.Errorf("edited %s is invalid, not updated: %v", file, err)
+	}
+	return file, nil
+}
+
+// checkParamComponent returns a usage error if the supplied component is not a component of the app.
+func checkParamComponent(app *model.App, component string) error {
+	if _, ok := app.Component(component); !ok {
+		return newUsageError(fmt.Sprintf("invalid component %q", component))
+	}
+	return nil
+}
+
+func doParamSet(args []string, config paramEditCommandConfig) error {
+	if len(args) != 4 {
+		return newUsageError("an environment, component, parameter name and value required")
+	}
+	env, component, name := args[0], args[1], args[2]
+	if err := checkParamComponent(config.App(), component); err != nil {
+		return err
+	}
+	var value interface{} = args[3]
+	if config.jsonValue {
+		if err := json.Unmarshal([]byte(args[3]), &value); err != nil {
+			return newUsageError(fmt.Sprintf("invalid JSON value %q: %v", args[3], err))
+		}
+	}
+	code, err := jsonnetValue(value)
+	if err != nil {
+		return err
+	}
+	file, err := editParams(config, env,
+		func(e *paramsEditor) error { return e.set(component, name, code) },
+		func(params interface{}) error {
+			p, _ := params.(map[string]interface{})
+			values, _ := p[component].(map[string]interface{})
+			if actual, ok := values[name]; !ok || !reflect.DeepEqual(actual, value) {
+				return fmt.Errorf("parameter %s of component %s is overridden elsewhere", name, component)
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	sio.Noticef("set parameter %s of component %s to %s in %s\n", name, component, code, file)
+	return nil
+}
+
+func doParamUnset(args []string, config paramEditCommandConfig) error {
+	if len(args) != 3 {
+		return newUsageError("an environment, component and parameter name required")
+	}
+	env, component, name := args[0], args[1], args[2]
+	if err := checkParamComponent(config.App(), component); err != nil {
+		return err
+	}
+	file, err := editParams(config, env,
+		func(e *paramsEditor) error {
+			ok, err := e.unset(component, name)
+			if err == nil && !ok {
+				err = fmt.Errorf("parameter %s of component %s is not set in %s", name, component, e.file)
+			}
+			return err
+		},
+		func(params interface{}) error { return nil })
+	if err != nil {
+		return err
+	}
+	sio.Noticef("removed parameter %s of component %s from %s\n", name, component, file)
+	return nil
+}
+
+func newParamSetCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "set <environment>|_ <component> <name> <value> [--json] [--file <params-file>]",
+		Short:   "set the value of a component parameter in the params file of an environment or the baseline",
+		Example: paramSetExamples(),
+	}
+	config := paramEditCommandConfig{}
+	cmd.Flags().BoolVar(&config.jsonValue, "json", false, "parse the value as JSON instead of using it as a string")
+	cmd.Flags().StringVar(&config.file, "file", "", "params file to edit, found from the imports of the params file of the app by default")
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doParamSet(args, config))
+	}
+	return cmd
+}
+
+func newParamUnsetCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "unset <environment>|_ <component> <name> [--file <params-file>]",
+		Short:   "remove the value of a component parameter from the params file of an environment or the baseline",
+		Example: paramUnsetExamples(),
+	}
+	config := paramEditCommandConfig{}
+	cmd.Flags().StringVar(&config.file, "file", "", "params file to edit, found from the imports of the params file of the app by default")
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doParamUnset(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,176 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readParamsFile(t *testing.T, file string) string {
+	b, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+	return string(b)
+}
+
+func TestParamSet(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("param", "set", "dev", "service2", "cpu", "200m")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`set parameter cpu of component service2 to '200m' in environments/dev.libsonnet`))
+	a.Contains(readParamsFile(t, "environments/dev.libsonnet"), "        service2 +: {\n            cpu: '200m',\n        },\n")
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "set", "prod", "service2", "replicas", "3", "--json")
+	require.Nil(t, err)
+	a.Contains(readParamsFile(t, "environments/prod.libsonnet"), "            memory: '16Gi',\n            replicas: 3,\n        }\n")
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "set", "dev", "service1", "memory", "it's big", "--json=false")
+	require.Nil(t, err)
+	a.Contains(readParamsFile(t, "environments/dev.libsonnet"), "        },\n        service1 +: {\n            memory: \"it's big\",\n        },\n    }\n")
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "set", "_", "service1", "cpu", "20m")
+	require.Nil(t, err)
+	a.Contains(readParamsFile(t, "environments/base.libsonnet"), "        service1: {\n            cpu: '20m',\n")
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "list", "dev")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`service1\s+cpu\s+"20m"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service1\s+memory\s+"it's big"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+cpu\s+"200m"`))
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "list", "prod")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+replicas\s+3`))
+}
+
+func TestParamSetOverridden(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	orig := readParamsFile(t, "environments/base.libsonnet")
+	err := s.executeCommand("param", "set", "--file", "environments/base.libsonnet", "dev", "service2", "cpu", "1")
+	require.NotNil(t, err)
+	assert.Equal(t, "edited environments/base.libsonnet is invalid, not updated: parameter cpu of component service2 is overridden elsewhere", err.Error())
+	assert.Equal(t, orig, readParamsFile(t, "environments/base.libsonnet"))
+}
+
+func TestParamUnset(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	a := assert.New(t)
+
+	err := s.executeCommand("param", "unset", "dev", "service2", "cpu")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`removed parameter cpu of component service2 from environments/dev.libsonnet`))
+	a.Equal("local base = import './base.libsonnet';\n\nbase {\n    components +: {\n    }\n}\n", readParamsFile(t, "environments/dev.libsonnet"))
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "list", "dev")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+cpu\s+"100m"`))
+
+	err = s.executeCommand("param", "unset", "dev", "service2", "cpu")
+	require.NotNil(t, err)
+	a.Equal("parameter cpu of component service2 is not set in environments/dev.libsonnet", err.Error())
+}
+
+func TestParamEditNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "set no args",
+			args: []string{"param", "set", "dev", "service2", "cpu"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("an environment, component, parameter name and value required", err.Error())
+			},
+		},
+		{
+			name: "unset no args",
+			args: []string{"param", "unset", "dev", "service2"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("an environment, component and parameter name required", err.Error())
+			},
+		},
+		{
+			name: "bad env",
+			args: []string{"param", "set", "stage", "service2", "cpu", "1"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "stage"`, err.Error())
+			},
+		},
+		{
+			name: "bad component",
+			args: []string{"param", "unset", "dev", "service3", "cpu"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid component "service3"`, err.Error())
+			},
+		},
+		{
+			name: "bad json",
+			args: []string{"param", "set", "dev", "service2", "cpu", "{", "--json"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Contains(err.Error(), `invalid JSON value "{"`)
+			},
+		},
+		{
+			name: "no components object",
+			args: []string{"param", "set", "--file", "params.libsonnet", "dev", "service2", "cpu", "1"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.Equal("params.libsonnet: no components object found", err.Error())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
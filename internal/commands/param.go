@@ -21,7 +21,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
@@ -36,14 +40,71 @@ var maxDisplayValueLength = 1024
 func newParamCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "param <subcommand>",
-		Short:   "parameter lists and diffs",
+		Short:   "parameter lists, diffs and edits",
 		Aliases: []string{"params"},
 	}
-	cmd.AddCommand(newParamListCommand(op), newParamDiffCommand(op))
+	cmd.AddCommand(newParamListCommand(op), newParamDiffCommand(op), newParamSetCommand(op), newParamUnsetCommand(op))
 	return cmd
 }
 
-func listParams(components map[string]interface{}, formatSpecified bool, format string, w io.Writer) error {
+// paramSources returns where the supplied params of components for an environment come from, keyed by component
+// and param name. A param set in the params file of the environment comes from that file and line, a param with the
+// value of the baseline comes from the baseline file and line, and any other param from the environment.
+func paramSources(config StdOptions, env string, components map[string]interface{}) (map[[2]string]string, error) {
+	var baseline map[string]interface{}
+	if env != model.Baseline {
+		p, err := envParams(config, model.Baseline)
+		if err != nil {
+			return nil, err
+		}
+		baseline, _ = p["components"].(map[string]interface{})
+	}
+	editor := func(env string) *paramsEditor {
+		file, err := envParamsFile(config.App(), env)
+		if err != nil {
+			return nil
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		return &paramsEditor{file: file, lines: strings.Split(string(b), "\n")}
+	}
+	located := func(label string, e *paramsEditor, component, name string) string {
+		if e == nil {
+			return label
+		}
+		if line := e.line(component, name); line > 0 {
+			return fmt.Sprintf("%s %s:%d", label, e.file, line)
+		}
+		return label
+	}
+	envFile, baseFile := editor(env), editor(model.Baseline)
+	ret := map[[2]string]string{}
+	for c, v := range components {
+		values, _ := v.(map[string]interface{})
+		baseValues, _ := baseline[c].(map[string]interface{})
+		for n, v := range values {
+			key := [2]string{c, n}
+			switch {
+			case env == model.Baseline:
+				ret[key] = located("baseline", baseFile, c, n)
+			case envFile != nil && envFile.line(c, n) > 0:
+				ret[key] = located(env, envFile, c, n)
+			default:
+				if bv, ok := baseValues[n]; ok && reflect.DeepEqual(bv, v) {
+					ret[key] = located("baseline", baseFile, c, n)
+				} else {
+					ret[key] = env
+				}
+			}
+		}
+	}
+	return ret, nil
+}
+
+// listParams lists the supplied params of components, with the source of each when sources are supplied.
+func listParams(components map[string]interface{}, sources map[[2]string]string, formatSpecified bool, format string, w io.Writer) error {
 	var p []param
 	for c, v := range components {
 		val, ok := v.(map[string]interface{})
@@ -52,7 +113,7 @@ func listParams(components map[string]interface{}, formatSpecified bool, format
 			continue
 		}
 		for n, v := range val {
-			p = append(p, param{Component: c, Name: n, Value: v})
+			p = append(p, param{Component: c, Name: n, Value: v, Source: sources[[2]string{c, n}]})
 		}
 	}
 	sort.Slice(p, func(i, j int) bool {
@@ -61,15 +122,23 @@ func listParams(components map[string]interface{}, formatSpecified bool, format
 		}
 		return p[i].Name < p[j].Name
 	})
-	if !formatSpecified {
-		fmt.Fprintf(w, "%-30s %-30s %s\n", "COMPONENT", "NAME", "VALUE")
+	if !formatSpecified || format == "table" {
+		if sources != nil {
+			fmt.Fprintf(w, "%-30s %-30s %-50s %s\n", "COMPONENT", "NAME", "SOURCE", "VALUE")
+		} else {
+			fmt.Fprintf(w, "%-30s %-30s %s\n", "COMPONENT", "NAME", "VALUE")
+		}
 		for _, param := range p {
 			valBytes, _ := json.Marshal(param.Value)
 			valStr := string(valBytes)
 			if len(valStr) > maxDisplayValueLength {
 				valStr = valStr[:maxDisplayValueLength-3] + "..."
 			}
-			fmt.Fprintf(w, "%-30s %-30s %s\n", param.Component, param.Name, valStr)
+			if sources != nil {
+				fmt.Fprintf(w, "%-30s %-30s %-50s %s\n", param.Component, param.Name, param.Source, valStr)
+			} else {
+				fmt.Fprintf(w, "%-30s %-30s %s\n", param.Component, param.Name, valStr)
+			}
 		}
 		return nil
 	}
@@ -86,15 +155,81 @@ func listParams(components map[string]interface{}, formatSpecified bool, format
 		encoder := json.NewEncoder(w)
 		encoder.SetIndent("", "  ")
 		return encoder.Encode(p)
+	case "dotenv":
+		owners := map[string]string{}
+		for _, param := range p {
+			key := dotenvKey(param.Component, param.Name)
+			if owner, ok := owners[key]; ok {
+				return fmt.Errorf("parameters %s and %s.%s have the same dotenv key %s", owner, param.Component, param.Name, key)
+			}
+			owners[key] = param.Component + "." + param.Name
+			fmt.Fprintf(w, "%s=%s\n", key, dotenvValue(param.Value))
+		}
+		return nil
 	default:
 		return newUsageError(fmt.Sprintf("listParams: unsupported format %q", format))
 	}
 }
 
+var (
+	reDotenvUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	reDotenvPlain  = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+)
+
+// dotenvKey returns the dotenv variable for the supplied param of the supplied component, in upper case with
+// characters that are not allowed in variable names replaced by underscores.
+func dotenvKey(component, name string) string {
+	key := strings.ToUpper(reDotenvUnsafe.ReplaceAllString(component+"_"+name, "_"))
+	if key[0] >= '0' && key[0] <= '9' {
+		key = "_" + key
+	}
+	return key
+}
+
+// dotenvValue returns the supplied value for a dotenv file. Strings are used as is and other values as JSON, quoted
+// with single quotes when they have special characters, or as a JSON string when they also have quotes or newlines.
+// Dollar signs are escaped in JSON strings since dotenv parsers expand variables in double quotes.
+func dotenvValue(v interface{}) string {
+	str, ok := v.(string)
+	if !ok {
+		b, _ := json.Marshal(v)
+		str = string(b)
+	}
+	switch {
+	case reDotenvPlain.MatchString(str):
+		return str
+	case !strings.ContainsAny(str, "'\n"):
+		return "'" + str + "'"
+	default:
+		b, _ := json.Marshal(str)
+		return strings.Replace(string(b), "$", `\$`, -1)
+	}
+}
+
 type param struct {
 	Component string      `json:"component"`
 	Name      string      `json:"name"`
 	Value     interface{} `json:"value"`
+	Source    string      `json:"source,omitempty"`
+}
+
+// envParams returns the params object of the supplied environment, or the baseline for _.
+func envParams(config StdOptions, env string) (map[string]interface{}, error) {
+	vm, err := renderVM(config)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := evalCluster(config.App(), env)
+	if err != nil {
+		return nil, err
+	}
+	return eval.Params(config.App().Spec.ParamsFile, eval.Context{
+		VM:      vm,
+		App:     config.App().Name(),
+		Env:     env,
+		Cluster: cluster,
+		Verbose: config.Verbosity() > 1,
+	})
 }
 
 func extractComponentParams(paramsObject map[string]interface{}, fp filterParams) (map[string]interface{}, error) {
@@ -123,6 +258,7 @@ func extractComponentParams(paramsObject map[string]interface{}, fp filterParams
 type paramListCommandConfig struct {
 	StdOptions
 	format     string
+	showSource bool
 	filterFunc func() (filterParams, error)
 }
 
@@ -135,14 +271,7 @@ func doParamList(args []string, config paramListCommandConfig) error {
 	if env != "_" && !ok {
 		return fmt.Errorf("invalid environment %q", env)
 	}
-	paramsFile := config.App().Spec.ParamsFile
-	vm := config.VM()
-	paramsObject, err := eval.Params(paramsFile, eval.Context{
-		VM:      vm,
-		App:     config.App().Name(),
-		Env:     env,
-		Verbose: config.Verbosity() > 1,
-	})
+	paramsObject, err := envParams(config.StdOptions, env)
 	if err != nil {
 		return err
 	}
@@ -154,19 +283,40 @@ func doParamList(args []string, config paramListCommandConfig) error {
 	if err != nil {
 		return err
 	}
-	return listParams(components, config.format != "", config.format, config.Stdout())
+	var sources map[[2]string]string
+	if config.showSource {
+		if sources, err = paramSources(config.StdOptions, env, components); err != nil {
+			return err
+		}
+	}
+	if err := listParams(components, sources, config.format != "", config.format, config.Stdout()); err != nil {
+		return err
+	}
+	var names []string
+	for name := range components {
+		names = append(names, name)
+	}
+	problems, err := paramProblems(config.App(), components, names)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		sio.Warnln(p)
+	}
+	return nil
 }
 
 func newParamListCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "list [-c component]...  <environment>|_",
+		Use:     "list [-c component]...  <environment>|_ [--show-source]",
 		Short:   "list all parameters for an environment, optionally for a subset of components",
 		Example: paramListExamples(),
 	}
 	config := paramListCommandConfig{
-		filterFunc: addFilterParams(cmd, false),
+		filterFunc: addFilterParams(cmd, op, false),
 	}
-	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable input")
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml|dotenv to display machine readable output, or table for the default output")
+	cmd.Flags().BoolVar(&config.showSource, "show-source", false, "show whether each value comes from the baseline or the environment, with the file and line that sets it when known")
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
 		return wrapError(doParamList(args, config))
@@ -176,11 +326,106 @@ func newParamListCommand(op OptionsProvider) *cobra.Command {
 
 type paramDiffCommandConfig struct {
 	StdOptions
+	format     string
 	filterFunc func() (filterParams, error)
 }
 
+// paramDifference is a parameter of a component with a different value in two environments. Whether each environment
+// sets the parameter is explicit, such that an environment that does not set it is told apart from one that sets it
+// to null.
+type paramDifference struct {
+	Component string      `json:"component"`
+	Name      string      `json:"name"`
+	Left      interface{} `json:"left"`
+	Right     interface{} `json:"right"`
+	InLeft    bool        `json:"inLeft"`
+	InRight   bool        `json:"inRight"`
+}
+
+// paramDifferences returns the parameters that are different in the supplied component params, sorted by component
+// and name.
+func paramDifferences(left, right map[string]interface{}) []paramDifference {
+	all := map[[2]string]*paramDifference{}
+	add := func(components map[string]interface{}, isLeft bool) {
+		for c, v := range components {
+			values, _ := v.(map[string]interface{})
+			for n, v := range values {
+				d, ok := all[[2]string{c, n}]
+				if !ok {
+					d = &paramDifference{Component: c, Name: n}
+					all[[2]string{c, n}] = d
+				}
+				if isLeft {
+					d.Left, d.InLeft = v, true
+				} else {
+					d.Right, d.InRight = v, true
+				}
+			}
+		}
+	}
+	add(left, true)
+	add(right, false)
+	var diffs []paramDifference
+	for _, d := range all {
+		if d.InLeft != d.InRight || !reflect.DeepEqual(d.Left, d.Right) {
+			diffs = append(diffs, *d)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Component != diffs[j].Component {
+			return diffs[i].Component < diffs[j].Component
+		}
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
+
+// displayParamValue returns the supplied value as JSON for display, truncated to the max display length, or a
+// placeholder when the value is not set.
+func displayParamValue(v interface{}, set bool) string {
+	if !set {
+		return "<not set>"
+	}
+	valBytes, _ := json.Marshal(v)
+	valStr := string(valBytes)
+	if len(valStr) > maxDisplayValueLength {
+		valStr = valStr[:maxDisplayValueLength-3] + "..."
+	}
+	return valStr
+}
+
+// printParamDifferences prints the supplied differences between the params of the supplied environments as a table,
+// or in the supplied machine readable format.
+func printParamDifferences(diffs []paramDifference, leftName, rightName, format string, w io.Writer) error {
+	switch format {
+	case "table":
+		fmt.Fprintf(w, "%-30s %-30s %-30s %s\n", "COMPONENT", "NAME", strings.ToUpper(leftName), strings.ToUpper(rightName))
+		for _, d := range diffs {
+			fmt.Fprintf(w, "%-30s %-30s %-30s %s\n", d.Component, d.Name, displayParamValue(d.Left, d.InLeft), displayParamValue(d.Right, d.InRight))
+		}
+		return nil
+	case "yaml":
+		b, err := yaml.Marshal(diffs)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	case "json":
+		if diffs == nil {
+			diffs = []paramDifference{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	default:
+		return newUsageError(fmt.Sprintf("param diff: unsupported format %q", format))
+	}
+}
+
 func doParamDiff(args []string, config paramDiffCommandConfig) error {
-	var leftEnv, rightEnv string
+	var leftEnv, rightEnv, component string
 	switch len(args) {
 	case 1:
 		leftEnv = model.Baseline
@@ -188,76 +433,94 @@ func doParamDiff(args []string, config paramDiffCommandConfig) error {
 	case 2:
 		leftEnv = args[0]
 		rightEnv = args[1]
+	case 3:
+		leftEnv = args[0]
+		rightEnv = args[1]
+		component = args[2]
+		if _, ok := config.App().Component(component); !ok {
+			return newUsageError(fmt.Sprintf("invalid component %q", component))
+		}
 	default:
-		return newUsageError("one or two environments required")
+		return newUsageError("one or two environments, optionally followed by a component, required")
 	}
 
 	fp, err := config.filterFunc()
 	if err != nil {
 		return err
 	}
-	getParams := func(env string) (str string, name string, err error) {
+	getParams := func(env string) (components map[string]interface{}, name string, err error) {
 		_, ok := config.App().Spec.Environments[env]
 		if env != "_" && !ok {
-			return "", "", fmt.Errorf("invalid environment %q", env)
+			return nil, "", fmt.Errorf("invalid environment %q", env)
 		}
-		paramsFile := config.App().Spec.ParamsFile
-		vm := config.VM()
-		paramsObject, err := eval.Params(paramsFile, eval.Context{
-			VM:      vm,
-			App:     config.App().Name(),
-			Env:     env,
-			Verbose: config.Verbosity() > 1,
-		})
+		paramsObject, err := envParams(config.StdOptions, env)
 		if err != nil {
-			return "", "", err
+			return nil, "", err
 		}
-		components, err := extractComponentParams(paramsObject, fp)
+		components, err = extractComponentParams(paramsObject, fp)
 		if err != nil {
-			return "", "", err
+			return nil, "", err
 		}
-		var buf bytes.Buffer
-		if err := listParams(components, false, "", &buf); err != nil {
-			return "", "", err
+		if component != "" {
+			values, ok := components[component]
+			components = map[string]interface{}{}
+			if ok {
+				components[component] = values
+			}
 		}
 		name = "environment: " + env
 		if env == model.Baseline {
 			name = "baseline"
 		}
-		return buf.String(), name, nil
+		return components, name, nil
 	}
 
-	var left, right, leftName, rightName string
-
-	left, leftName, err = getParams(leftEnv)
+	left, leftName, err := getParams(leftEnv)
 	if err != nil {
 		return err
 	}
-	right, rightName, err = getParams(rightEnv)
+	right, rightName, err := getParams(rightEnv)
 	if err != nil {
 		return err
 	}
 
+	if config.format != "" {
+		column := func(env string) string {
+			if env == model.Baseline {
+				return "baseline"
+			}
+			return env
+		}
+		return printParamDifferences(paramDifferences(left, right), column(leftEnv), column(rightEnv), config.format, config.Stdout())
+	}
+
+	var leftList, rightList bytes.Buffer
+	if err := listParams(left, nil, false, "", &leftList); err != nil {
+		return err
+	}
+	if err := listParams(right, nil, false, "", &rightList); err != nil {
+		return err
+	}
 	opts := diff.Options{Context: -1, LeftName: leftName, RightName: rightName, Colorize: config.Colorize()}
-	d, err := diff.Strings(left, right, opts)
+	d, err := diff.Strings(leftList.String(), rightList.String(), opts)
 	if err != nil {
 		return err
 	}
 	fmt.Fprintln(config.Stdout(), string(d))
 	return nil
-
 }
 
 func newParamDiffCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "diff [-c component]... <environment>|_ [<environment>|_]",
+		Use:     "diff [-c component]... <environment>|_ [<environment>|_ [<component>]] [-o table|json|yaml]",
 		Short:   "diff parameter lists across two environments or between the baseline (use _ for baseline) and an environment",
 		Example: paramDiffExamples(),
 	}
 
 	config := paramDiffCommandConfig{
-		filterFunc: addFilterParams(cmd, false),
+		filterFunc: addFilterParams(cmd, op, false),
 	}
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use table to show only the parameters that differ, or json|yaml for the same in machine readable form")
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
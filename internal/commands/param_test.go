@@ -17,6 +17,7 @@
 package commands
 
 import (
+	"io/ioutil"
 	"regexp"
 	"testing"
 
@@ -67,6 +68,73 @@ func TestParamListJSON(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestParamListTable(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("param", "list", "dev", "-o", "table")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`COMPONENT\s+NAME\s+VALUE`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+cpu\s+"50m"`))
+}
+
+func TestParamListDotenv(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	require.Nil(t, s.executeCommand("param", "set", "dev", "service2", "labels", `{"tier":"web"}`, "--json"))
+	require.Nil(t, s.executeCommand("param", "set", "dev", "service2", "note", "it's here", "--json=false"))
+	require.Nil(t, s.executeCommand("param", "set", "dev", "service2", "price", "it's $5", "--json=false"))
+	require.Nil(t, s.executeCommand("param", "set", "dev", "service2", "total", "$HOME", "--json=false"))
+	s.outCapture.Reset()
+	err := s.executeCommand("param", "list", "dev", "-o", "dotenv")
+	require.Nil(t, err)
+	assert.Equal(t, `SERVICE1_CPU=10m
+SERVICE1_MEMORY=4Gi
+SERVICE2_CPU=50m
+SERVICE2_LABELS='{"tier":"web"}'
+SERVICE2_LONGVAL='a really long value'
+SERVICE2_MEMORY=8Gi
+SERVICE2_NOTE="it's here"
+SERVICE2_PRICE="it's \$5"
+SERVICE2_TOTAL='$HOME'
+`, s.stdout())
+}
+
+func TestParamListSource(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("param", "list", "prod", "--show-source")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`COMPONENT\s+NAME\s+SOURCE\s+VALUE`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service1\s+cpu\s+prod environments/prod.libsonnet:6\s+"1"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service1\s+memory\s+baseline environments/base.libsonnet:5\s+"4Gi"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+cpu\s+baseline environments/base.libsonnet:8\s+"100m"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+memory\s+prod environments/prod.libsonnet:9\s+"16Gi"`))
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "list", "_", "--show-source", "-o", "json", "-c", "service1")
+	require.Nil(t, err)
+	var data []map[string]interface{}
+	require.Nil(t, s.jsonOutput(&data))
+	assert.Equal(t, []map[string]interface{}{
+		{"component": "service1", "name": "cpu", "value": "10m", "source": "baseline environments/base.libsonnet:4"},
+		{"component": "service1", "name": "memory", "value": "4Gi", "source": "baseline environments/base.libsonnet:5"},
+	}, data)
+}
+
+func TestParamListSourceComputed(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	require.Nil(t, ioutil.WriteFile("environments/dev.libsonnet", []byte("local base = import './base.libsonnet';\n\nbase {\n    components +: {\n        service2 +: { cpu: '50m' },\n    }\n}\n"), 0644))
+	err := s.executeCommand("param", "list", "dev", "--show-source", "-c", "service2")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+cpu\s+dev\s+"50m"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+memory\s+baseline environments/base.libsonnet:9\s+"8Gi"`))
+}
+
 func TestParamDiffBasic(t *testing.T) {
 	s := newScaffold(t)
 	defer s.reset()
@@ -89,6 +157,49 @@ func TestParamDiff2Envs(t *testing.T) {
 	s.assertOutputLineMatch(regexp.MustCompile(`\+service1\s+cpu\s+"1"`))
 }
 
+func TestParamDiffTable(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("param", "diff", "dev", "prod", "-o", "table")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`COMPONENT\s+NAME\s+DEV\s+PROD`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service1\s+cpu\s+"10m"\s+"1"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+cpu\s+"50m"\s+"100m"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+memory\s+"8Gi"\s+"16Gi"`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`longVal`))
+}
+
+func TestParamDiffComponent(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	require.Nil(t, s.executeCommand("param", "set", "prod", "service2", "replicas", "3", "--json"))
+	s.outCapture.Reset()
+	err := s.executeCommand("param", "diff", "_", "prod", "service2", "-o", "json")
+	require.Nil(t, err)
+	var data []map[string]interface{}
+	require.Nil(t, s.jsonOutput(&data))
+	assert.Equal(t, []map[string]interface{}{
+		{"component": "service2", "name": "memory", "left": "8Gi", "right": "16Gi", "inLeft": true, "inRight": true},
+		{"component": "service2", "name": "replicas", "left": nil, "right": float64(3), "inLeft": false, "inRight": true},
+	}, data)
+
+	s.outCapture.Reset()
+	err = s.executeCommand("param", "diff", "_", "prod", "service2", "-o", "table")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`COMPONENT\s+NAME\s+BASELINE\s+PROD`))
+	s.assertOutputLineMatch(regexp.MustCompile(`service2\s+replicas\s+<not set>\s+3`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`service1`))
+}
+
+func TestParamDifferencesNull(t *testing.T) {
+	left := map[string]interface{}{"web": map[string]interface{}{"proxy": nil}}
+	right := map[string]interface{}{"web": map[string]interface{}{}}
+	diffs := paramDifferences(left, right)
+	assert.Equal(t, []paramDifference{{Component: "web", Name: "proxy", InLeft: true}}, diffs)
+}
+
 func TestParamNegative(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -115,11 +226,11 @@ func TestParamNegative(t *testing.T) {
 		},
 		{
 			name: "list bad format",
-			args: []string{"param", "list", "dev", "-o", "table"},
+			args: []string{"param", "list", "dev", "-o", "xml"},
 			asserter: func(s *scaffold, err error) {
 				a := assert.New(s.t)
 				a.True(isUsageError(err))
-				a.Equal(`listParams: unsupported format "table"`, err.Error())
+				a.Equal(`listParams: unsupported format "xml"`, err.Error())
 			},
 		},
 		{
@@ -137,7 +248,7 @@ func TestParamNegative(t *testing.T) {
 			asserter: func(s *scaffold, err error) {
 				a := assert.New(s.t)
 				a.True(isUsageError(err))
-				a.Equal(`one or two environments required`, err.Error())
+				a.Equal(`one or two environments, optionally followed by a component, required`, err.Error())
 			},
 		},
 		{
@@ -146,7 +257,25 @@ func TestParamNegative(t *testing.T) {
 			asserter: func(s *scaffold, err error) {
 				a := assert.New(s.t)
 				a.True(isUsageError(err))
-				a.Equal(`one or two environments required`, err.Error())
+				a.Equal(`invalid component "_"`, err.Error())
+			},
+		},
+		{
+			name: "diff 4 args",
+			args: []string{"param", "diff", "dev", "prod", "service1", "service2"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`one or two environments, optionally followed by a component, required`, err.Error())
+			},
+		},
+		{
+			name: "diff bad format",
+			args: []string{"param", "diff", "dev", "prod", "-o", "xml"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`param diff: unsupported format "xml"`, err.Error())
 			},
 		},
 		{
@@ -0,0 +1,161 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// pinnedRefDir is the directory, relative to the app root, where the app is extracted at the git refs to which
+// components are pinned.
+const pinnedRefDir = ".qbec/refs"
+
+// extractTar extracts the regular files and directories of the supplied tar archive into the supplied directory.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(h.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("invalid path %s in archive", h.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(target, b, os.FileMode(h.Mode)&0755|0644); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// pinnedTree returns the directory of the app, which is the current directory, as of the supplied git ref. The app
+// directory is extracted from the repository on first use and reused for later runs at the same commit.
+func pinnedTree(ref string) (string, error) {
+	commit, err := runGit("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("invalid git ref %q", ref)
+	}
+	commit = strings.TrimSpace(commit)
+	top, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	prefix, err := runGit("rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	prefix = strings.TrimSpace(prefix)
+	dir := filepath.Join(pinnedRefDir, commit)
+	appDir := filepath.Join(dir, filepath.FromSlash(prefix))
+	if _, err := os.Stat(dir); err == nil {
+		return appDir, nil
+	}
+	args := []string{"-C", strings.TrimSpace(top), "archive", "--format=tar", commit}
+	if prefix != "" {
+		args = append(args, "--", prefix)
+	}
+	archive, err := runGit(args...)
+	if err != nil {
+		return "", err
+	}
+	// extract to a temporary directory first so that concurrent runs never see partial trees
+	tmp := dir + ".tmp"
+	os.RemoveAll(tmp)
+	if err := extractTar(strings.NewReader(archive), tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", errors.Wrapf(err, "extract %s", ref)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return appDir, nil
+}
+
+// pinnedComponents returns the supplied components with the files of components that the supplied environment pins
+// to a git ref replaced by their files as of that ref. Relative imports of a pinned component resolve in the same
+// revision; library paths still resolve in the working tree.
+func pinnedComponents(app *model.App, env string, components []model.Component) ([]model.Component, error) {
+	refs := app.Spec.Environments[env].ComponentRefs
+	if len(refs) == 0 {
+		return components, nil
+	}
+	trees := map[string]string{}
+	var ret []model.Component
+	for _, c := range components {
+		ref, ok := refs[c.Name]
+		if !ok {
+			ret = append(ret, c)
+			continue
+		}
+		if c.Chart != nil {
+			return nil, fmt.Errorf("component %s: helm charts cannot be pinned to a git ref, pin the chart version instead", c.Name)
+		}
+		if c.Kustomization != nil {
+			return nil, fmt.Errorf("component %s: kustomizations cannot be pinned to a git ref, pin the ref of the remote base instead", c.Name)
+		}
+		dir, ok := trees[ref]
+		if !ok {
+			var err error
+			dir, err = pinnedTree(ref)
+			if err != nil {
+				return nil, errors.Wrapf(err, "component %s", c.Name)
+			}
+			trees[ref] = dir
+		}
+		file := filepath.Join(dir, c.File)
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("component %s: file %s does not exist at %s", c.Name, c.File, ref)
+		}
+		sio.Debugf("component %s: using %s at %s\n", c.Name, c.File, ref)
+		pinned := model.Component{Name: c.Name, File: file}
+		if c.Generator != nil {
+			// the generator function is pinned, the names and data of its components are those of the working tree
+			pinned.Generator, pinned.GeneratorData = c.Generator, c.GeneratorData
+		}
+		ret = append(ret, pinned)
+	}
+	return ret, nil
+}
@@ -0,0 +1,139 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pinnedConfigMap = `{
+  apiVersion: 'v1',
+  kind: 'ConfigMap',
+  metadata: { name: '%s' },
+  data: { version: '%s' },
+}
+`
+
+// pinnedRepo creates a git repository with an app in a subdirectory, whose ingress component is at version v1 in
+// the v1 tag and at version v2 in the working tree, and changes to the app directory.
+func pinnedRepo(t *testing.T) func() {
+	if _, err := runGit("version"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo, err := ioutil.TempDir("", "pins")
+	require.Nil(t, err)
+	dir := filepath.Join(repo, "deploy")
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: pins
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+    prod:
+      server: https://prod-server
+      componentRefs:
+        ingress: v1
+`
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	write := func(version string) {
+		for _, c := range []string{"ingress", "api"} {
+			content := fmt.Sprintf(pinnedConfigMap, c, version)
+			require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", c+".jsonnet"), []byte(content), 0644))
+		}
+	}
+	git := func(args ...string) {
+		_, err := runGit(append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.Nil(t, err)
+	}
+	write("v1")
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "v1")
+	git("tag", "v1")
+	write("v2")
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(repo)
+	}
+}
+
+func TestPinnedComponents(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	defer pinnedRepo(t)()
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+
+	err = s.executeCommand("show", "prod", "-c", "ingress", "-c", "api")
+	require.Nil(t, err)
+	out, err := s.yamlOutput()
+	require.Nil(t, err)
+	versions := map[string]interface{}{}
+	for _, o := range out {
+		m := o.(map[string]interface{})
+		versions[m["metadata"].(map[string]interface{})["name"].(string)] = m["data"].(map[string]interface{})["version"]
+	}
+	assert.Equal(t, map[string]interface{}{"ingress": "v1", "api": "v2"}, versions)
+	_, err = os.Stat(pinnedRefDir)
+	assert.Nil(t, err)
+
+	s.outCapture.Reset()
+	err = s.executeCommand("show", "dev", "-c", "ingress")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`version: v2`))
+}
+
+func TestPinnedComponentsNegative(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	defer pinnedRepo(t)()
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+
+	e := app.Spec.Environments["prod"]
+	e.ComponentRefs = map[string]string{"ingress": "v3"}
+	app.Spec.Environments["prod"] = e
+	err = s.executeCommand("show", "prod")
+	require.NotNil(t, err)
+	assert.Equal(t, `component ingress: invalid git ref "v3"`, err.Error())
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join("components", "new.jsonnet"), []byte(fmt.Sprintf(pinnedConfigMap, "new", "v2")), 0644))
+	app, err = model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+	e = app.Spec.Environments["prod"]
+	e.ComponentRefs = map[string]string{"new": "v1"}
+	app.Spec.Environments["prod"] = e
+	err = s.executeCommand("show", "prod")
+	require.NotNil(t, err)
+	assert.Equal(t, "component new: file components/new.jsonnet does not exist at v1", err.Error())
+}
@@ -0,0 +1,264 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"github.com/splunk/qbec/internal/vm"
+)
+
+// policyObjectsVarName is the code variable that has the objects checked by a policy.
+const policyObjectsVarName = "qbec.io/policyObjects"
+
+// regoPolicyExtension is the extension of policy files written in Rego, which are evaluated by the Open Policy Agent.
+// Policies in other files are jsonnet functions.
+const regoPolicyExtension = ".rego"
+
+// policyViolation is a violation of a policy by a rendered object.
+type policyViolation struct {
+	Policy    string `json:"policy"`
+	Level     string `json:"level"`
+	Object    string `json:"object"`
+	Component string `json:"component"`
+	File      string `json:"file,omitempty"` // source file of the component, only set in reports
+	Message   string `json:"message"`
+}
+
+func (p policyViolation) String() string {
+	return fmt.Sprintf("%s violates policy %s: %s", p.Object, p.Policy, p.Message)
+}
+
+// policyFinding is a violation returned by a policy for an object. Policies return either plain messages or objects
+// with a message and an optional level, which can lower the level of the violation to warn.
+type policyFinding struct {
+	Message string
+	Level   string
+}
+
+// checkPolicies returns the violations of the policies of the app by the supplied objects of an environment. Each
+// policy is evaluated once with all the objects of the kinds it applies to.
+func checkPolicies(config StdOptions, env string, objects []model.K8sLocalObject, client validateClient) ([]policyViolation, error) {
+	app := config.App()
+	if len(app.Spec.Policies) == 0 {
+		return nil, nil
+	}
+	jvm, err := renderVM(config)
+	if err != nil {
+		return nil, err
+	}
+	var ret []policyViolation
+	for _, p := range app.Spec.Policies {
+		level := app.PolicyLevel(env, p)
+		if level == model.PolicyLevelDisabled {
+			sio.Debugf("policy %s is disabled for environment %s\n", p.Name, env)
+			continue
+		}
+		kinds, err := model.NewKindFilter(p.Kinds, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "policy %s", p.Name)
+		}
+		var subset []model.K8sLocalObject
+		for _, o := range objects {
+			if !kinds.HasFilters() || kinds.ShouldInclude(o.GetKind()) {
+				subset = append(subset, o)
+			}
+		}
+		if len(subset) == 0 {
+			continue
+		}
+		var findings [][]policyFinding
+		if filepath.Ext(p.File) == regoPolicyExtension {
+			findings, err = evalRegoPolicy(env, p.File, subset)
+		} else {
+			findings, err = evalPolicy(jvm.Config(), env, p.File, subset)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "policy %s", p.Name)
+		}
+		for i, list := range findings {
+			for _, f := range list {
+				l := level
+				if f.Level == model.PolicyLevelWarn {
+					l = f.Level
+				}
+				ret = append(ret, policyViolation{
+					Policy:    p.Name,
+					Level:     l,
+					Object:    client.DisplayName(subset[i]),
+					Component: subset[i].Component(),
+					Message:   f.Message,
+				})
+			}
+		}
+	}
+	return ret, nil
+}
+
+// evalPolicy evaluates the supplied policy file for each of the supplied objects and returns the findings of every
+// object, in order.
+func evalPolicy(config vm.Config, env string, file string, objects []model.K8sLocalObject) ([][]policyFinding, error) {
+	var data []interface{}
+	for _, o := range objects {
+		data = append(data, o.ToUnstructured().Object)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	// start from fresh maps of variables so that the base config is not modified
+	cfg := config
+	cfg.Vars = nil
+	cfg.CodeVars = nil
+	jvm := vm.New(cfg.WithVars(config.Vars).WithVars(map[string]string{model.QbecNames.EnvVarName: env}).
+		WithCodeVars(config.CodeVars).WithCodeVars(map[string]string{policyObjectsVarName: string(b)}))
+	code := fmt.Sprintf("local policy = %s;\nstd.map(policy, std.extVar('%s'))", vm.Import(file), policyObjectsVarName)
+	out, err := jvm.EvaluateSnippet("policy-loader.jsonnet", code)
+	if err != nil {
+		return nil, err
+	}
+	var results []interface{}
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		return nil, errors.Wrap(err, "unmarshal policy result")
+	}
+	var ret [][]policyFinding
+	for _, r := range results {
+		list, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("policy must return an array of violation messages, got %v", r)
+		}
+		var findings []policyFinding
+		for _, m := range list {
+			f, err := toPolicyFinding(m)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, f)
+		}
+		ret = append(ret, findings)
+	}
+	return ret, nil
+}
+
+// regoRules are the rules of a Rego policy package that have violations, with the level that they force. Violations
+// in the deny set have the level of the policy.
+var regoRules = []struct {
+	name  string
+	level string
+}{
+	{name: "deny"},
+	{name: "warn", level: model.PolicyLevelWarn},
+}
+
+// evalRegoPolicy evaluates the supplied Rego policy file for each of the supplied objects and returns the findings of
+// every object, in order. Each object is the input of the policy and the environment is available as data.qbec.env.
+func evalRegoPolicy(env string, file string, objects []model.K8sLocalObject) ([][]policyFinding, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	module, err := ast.ParseModule(file, string(b))
+	if err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, fmt.Errorf("%s: no package declared", file)
+	}
+	ctx := context.Background()
+	query, err := rego.New(
+		rego.Query(module.Package.Path.String()),
+		rego.Module(file, string(b)),
+		rego.Store(inmem.NewFromObject(map[string]interface{}{
+			"qbec": map[string]interface{}{"env": env},
+		})),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ret [][]policyFinding
+	for _, o := range objects {
+		rs, err := query.Eval(ctx, rego.EvalInput(o.ToUnstructured().Object))
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]interface{}
+		if len(rs) > 0 && len(rs[0].Expressions) > 0 {
+			doc, _ = rs[0].Expressions[0].Value.(map[string]interface{})
+		}
+		var findings []policyFinding
+		for _, rule := range regoRules {
+			v, ok := doc[rule.name]
+			if !ok {
+				continue
+			}
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("policy rule %s must be a set of violation messages, got %v", rule.name, v)
+			}
+			for _, m := range list {
+				f, err := toPolicyFinding(m)
+				if err != nil {
+					return nil, err
+				}
+				if rule.level != "" {
+					f.Level = rule.level
+				}
+				findings = append(findings, f)
+			}
+		}
+		ret = append(ret, findings)
+	}
+	return ret, nil
+}
+
+// toPolicyFinding returns the finding for an element of the array returned by a policy, a message or an object with
+// a message and level.
+func toPolicyFinding(v interface{}) (policyFinding, error) {
+	switch f := v.(type) {
+	case string:
+		return policyFinding{Message: f}, nil
+	case map[string]interface{}:
+		message, _ := f["message"].(string)
+		if message == "" {
+			return policyFinding{}, fmt.Errorf("policy finding must have a message, got %v", v)
+		}
+		level, _ := f["level"].(string)
+		switch level {
+		case "", model.PolicyLevelDeny, model.PolicyLevelWarn:
+		default:
+			return policyFinding{}, fmt.Errorf("policy finding %q has invalid level %q, must be %s or %s", message, level, model.PolicyLevelDeny, model.PolicyLevelWarn)
+		}
+		for k := range f {
+			if k != "message" && k != "level" {
+				return policyFinding{}, fmt.Errorf("policy finding %q has unknown attribute %q", message, k)
+			}
+		}
+		return policyFinding{Message: message, Level: level}, nil
+	default:
+		return policyFinding{}, fmt.Errorf("policy must return an array of violation messages, got %v", v)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func policyFile(t *testing.T, name string) string {
+	file, err := filepath.Abs(filepath.Join("testdata", "policies", name))
+	require.Nil(t, err)
+	return file
+}
+
+type validValidator struct{}
+
+func (validValidator) Validate(obj *unstructured.Unstructured) []error {
+	return nil
+}
+
+func allValid(gvk schema.GroupVersionKind) (remote.Validator, error) {
+	return validValidator{}, nil
+}
+
+func setPolicies(s *scaffold, policies ...model.Policy) {
+	s.opts.app.Spec.Policies = policies
+}
+
+func TestValidatePolicies(t *testing.T) {
+	teamLabel := policyFile(t, "team-label.jsonnet")
+	noFooKeys := policyFile(t, "no-foo-keys.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	setPolicies(s,
+		model.Policy{Name: "team-label", File: teamLabel, Level: model.PolicyLevelWarn},
+		model.Policy{Name: "no-foo-keys", File: noFooKeys, Kinds: []string{"configmaps"}},
+	)
+	err := s.executeCommand("validate", "dev", "-c", "service2", "-c", "cluster-objects")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 policy violation(s) found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ ConfigMap:bar-system:svc2-cm violates policy no-foo-keys: key foo is not allowed in environment dev`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\? Namespace::bar-system violates policy team-label: missing required label team \(warning\)`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\? Secret:bar-system:svc2-secret violates policy team-label: missing required label team \(warning\)`))
+	s.assertOutputLineMatch(regexp.MustCompile(`policyViolations:`))
+	s.assertOutputLineMatch(regexp.MustCompile(`level: deny`))
+	s.assertOutputLineMatch(regexp.MustCompile(`object: ConfigMap:bar-system:svc2-cm`))
+	a.NotRegexp(`Secret:bar-system:svc2-secret violates policy no-foo-keys`, s.stdout())
+}
+
+func TestValidateRegoPolicies(t *testing.T) {
+	noFooKeys := policyFile(t, "no-foo-keys.rego")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	setPolicies(s, model.Policy{Name: "no-foo-keys", File: noFooKeys})
+	err := s.executeCommand("validate", "dev", "-c", "service2", "-c", "cluster-objects")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 policy violation(s) found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ ConfigMap:bar-system:svc2-cm violates policy no-foo-keys: key foo is not allowed in environment dev`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\? Namespace::bar-system violates policy no-foo-keys: missing required label team \(warning\)`))
+	a.NotRegexp(`Secret:bar-system:svc2-secret violates policy no-foo-keys: key foo`, s.stdout())
+}
+
+func TestValidatePoliciesEnvLevels(t *testing.T) {
+	teamLabel := policyFile(t, "team-label.jsonnet")
+	noFooKeys := policyFile(t, "no-foo-keys.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	setPolicies(s,
+		model.Policy{Name: "team-label", File: teamLabel},
+		model.Policy{Name: "no-foo-keys", File: noFooKeys, Kinds: []string{"configmaps"}},
+	)
+	dev := s.opts.app.Spec.Environments["dev"]
+	dev.Policies = map[string]string{"team-label": model.PolicyLevelDisabled, "no-foo-keys": model.PolicyLevelWarn}
+	s.opts.app.Spec.Environments["dev"] = dev
+	err := s.executeCommand("validate", "dev", "-c", "service2")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`\? ConfigMap:bar-system:svc2-cm violates policy no-foo-keys: key foo is not allowed in environment dev \(warning\)`))
+	assert.NotRegexp(t, `team-label`, s.stdout())
+}
+
+func TestValidatePolicyFindings(t *testing.T) {
+	dataFindings := policyFile(t, "data-findings.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	setPolicies(s, model.Policy{Name: "data", File: dataFindings, Kinds: []string{"configmaps"}})
+	err := s.executeCommand("validate", "dev", "-c", "service2")
+	require.NotNil(t, err)
+	assert.Equal(t, "1 policy violation(s) found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ ConfigMap:bar-system:svc2-cm violates policy data: key foo is not allowed`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\? ConfigMap:bar-system:svc2-cm violates policy data: no type set \(warning\)`))
+}
+
+func TestValidatePolicyFindingsWarnLevel(t *testing.T) {
+	dataFindings := policyFile(t, "data-findings.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	setPolicies(s, model.Policy{Name: "data", File: dataFindings, Level: model.PolicyLevelWarn, Kinds: []string{"configmaps"}})
+	err := s.executeCommand("validate", "dev", "-c", "service2")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`\? ConfigMap:bar-system:svc2-cm violates policy data: key foo is not allowed \(warning\)`))
+}
+
+func TestToPolicyFinding(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected policyFinding
+		errorMsg string
+	}{
+		{value: "bad", expected: policyFinding{Message: "bad"}},
+		{value: map[string]interface{}{"message": "bad"}, expected: policyFinding{Message: "bad"}},
+		{value: map[string]interface{}{"message": "bad", "level": "warn"}, expected: policyFinding{Message: "bad", Level: "warn"}},
+		{value: map[string]interface{}{"level": "warn"}, errorMsg: "policy finding must have a message, got map[level:warn]"},
+		{value: map[string]interface{}{"message": "bad", "path": "spec"}, errorMsg: `policy finding "bad" has unknown attribute "path"`},
+		{value: 10.0, errorMsg: "policy must return an array of violation messages, got 10"},
+	}
+	for _, test := range tests {
+		f, err := toPolicyFinding(test.value)
+		if test.errorMsg != "" {
+			require.NotNil(t, err)
+			assert.Equal(t, test.errorMsg, err.Error())
+			continue
+		}
+		require.Nil(t, err)
+		assert.Equal(t, test.expected, f)
+	}
+}
+
+func TestValidateSkipPolicies(t *testing.T) {
+	noFooKeys := policyFile(t, "no-foo-keys.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	setPolicies(s, model.Policy{Name: "no-foo-keys", File: noFooKeys})
+	err := s.executeCommand("validate", "dev", "-c", "service2", "--skip-policies")
+	require.Nil(t, err)
+	assert.NotRegexp(t, `no-foo-keys`, s.stdout())
+}
+
+func TestValidatePoliciesNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   model.Policy
+		asserter func(t *testing.T, err error)
+	}{
+		{
+			name:   "bad result",
+			policy: model.Policy{Name: "bad", File: policyFile(t, "bad-result.jsonnet")},
+			asserter: func(t *testing.T, err error) {
+				assert.Equal(t, "policy bad: policy must return an array of violation messages, got not a list", err.Error())
+			},
+		},
+		{
+			name:   "bad level",
+			policy: model.Policy{Name: "bad", File: policyFile(t, "bad-level.jsonnet")},
+			asserter: func(t *testing.T, err error) {
+				assert.Equal(t, `policy bad: policy finding "bad level" has invalid level "error", must be deny or warn`, err.Error())
+			},
+		},
+		{
+			name:   "bad rego result",
+			policy: model.Policy{Name: "bad", File: policyFile(t, "bad-result.rego")},
+			asserter: func(t *testing.T, err error) {
+				assert.Equal(t, "policy bad: policy rule deny must be a set of violation messages, got not a set", err.Error())
+			},
+		},
+		{
+			name:   "missing file",
+			policy: model.Policy{Name: "missing", File: policyFile(t, "missing.jsonnet")},
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "policy missing:")
+				assert.Contains(t, err.Error(), "missing.jsonnet")
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			s.opts.client.validatorFunc = allValid
+			setPolicies(s, test.policy)
+			err := s.executeCommand("validate", "dev", "-c", "service2")
+			require.NotNil(t, err)
+			test.asserter(t, err)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// previewNamespaces moves the supplied objects to the namespaces of the preview. Namespace objects are renamed and
+// objects in explicit namespaces are moved to the corresponding preview namespace. Objects without a namespace
+// end up in the default namespace of the preview when applied.
+func previewNamespaces(p *model.Preview, objects []model.K8sLocalObject) {
+	for _, o := range objects {
+		u := o.ToUnstructured()
+		gvk := o.GetObjectKind().GroupVersionKind()
+		if gvk.Group == "" && gvk.Kind == "Namespace" {
+			u.SetName(p.NamespaceFor(u.GetName()))
+			continue
+		}
+		if ns := u.GetNamespace(); ns != "" {
+			u.SetNamespace(p.NamespaceFor(ns))
+		}
+	}
+}
+
+// previewOptions are the options to derive a preview environment.
+type previewOptions struct {
+	suffix string   // the preview suffix
+	props  []string // properties as key=value pairs
+}
+
+func addPreviewFlags(cmd *cobra.Command) *previewOptions {
+	var opts previewOptions
+	cmd.Flags().StringVar(&opts.suffix, "suffix", "", "suffix that identifies the preview, appended to the environment name and namespaces")
+	cmd.Flags().StringArrayVar(&opts.props, "prop", nil, "property for the preview as key=value, {env}, {base}, {suffix} and {namespace} in the value are replaced")
+	return &opts
+}
+
+// addPreview adds the preview environment for the supplied arguments to the app and returns it.
+func addPreview(app *model.App, args []string, opts *previewOptions) (*model.Preview, error) {
+	if len(args) != 1 {
+		return nil, newUsageError("exactly one environment required")
+	}
+	if opts.suffix == "" {
+		return nil, newUsageError("preview suffix must be specified using --suffix")
+	}
+	props := map[string]string{}
+	for _, p := range opts.props {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, newUsageError(fmt.Sprintf("invalid property %q, must be of the form key=value", p))
+		}
+		props[parts[0]] = parts[1]
+	}
+	p, err := app.AddPreview(args[0], opts.suffix, props)
+	if err != nil {
+		return nil, newUsageError(err.Error())
+	}
+	sio.Noticef("preview environment %s, default namespace %s\n", p.Env, p.Namespace)
+	return p, nil
+}
+
+type previewCreateCommandConfig struct {
+	applyCommandConfig
+	preview *previewOptions
+}
+
+func doPreviewCreate(args []string, config previewCreateCommandConfig) error {
+	p, err := addPreview(config.App(), args, config.preview)
+	if err != nil {
+		return err
+	}
+	// cluster-scoped objects would be shared with the base environment and deleted along with the preview
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	objects, err := filteredObjects(config, p.Env, fp)
+	if err != nil {
+		return err
+	}
+	client, err := config.clientProvider(p.Env)
+	if err != nil {
+		return err
+	}
+	var clusterObjects []string
+	for _, o := range objects {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		if gvk.Group == "" && gvk.Kind == "Namespace" {
+			continue
+		}
+		namespaced, err := client.IsNamespaced(gvk)
+		if err != nil {
+			return err
+		}
+		if !namespaced {
+			clusterObjects = append(clusterObjects, client.DisplayName(o))
+		}
+	}
+	if len(clusterObjects) > 0 {
+		return fmt.Errorf("preview environments cannot have cluster-scoped objects other than namespaces, found %s; use component or kind filters to exclude them", strings.Join(clusterObjects, ", "))
+	}
+	config.objects = objects
+	return doApply([]string{p.Env}, config.applyCommandConfig)
+}
+
+func newPreviewCreateCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "create [-n] --suffix <suffix> <base-environment>",
+		Short:   "apply a temporary environment derived from a base environment",
+		Example: previewCreateExamples(),
+	}
+
+	config := previewCreateCommandConfig{
+		applyCommandConfig: applyCommandConfig{
+			clientProvider: func(env string) (applyClient, error) {
+				return op().Client(env)
+			},
+			filterFunc: addFilterParams(cmd, op, true),
+			gc:         true,
+		},
+		preview: addPreviewFlags(cmd),
+	}
+
+	cmd.Flags().StringVarP(&config.dryRunMode, "dry-run", "n", "", "dry-run, do not create/ update resources but show what would happen, set to server to have the server process changes without persisting them")
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = dryRunClient
+	cmd.Flags().BoolVarP(&config.syncOptions.ShowSecrets, "show-secrets", "S", false, "do not obfuscate secret values in the output")
+	cmd.Flags().BoolVar(&config.wait, "wait", false, "wait for created and updated objects to be ready before garbage collection")
+	cmd.Flags().DurationVar(&config.waitTimeout, "wait-timeout", 5*time.Minute, "max time to wait for objects to be ready")
+	addCascadeFlag(cmd, &config.cascade, "cascade policy for dependents of objects deleted by garbage collection")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doPreviewCreate(args, config))
+	}
+	return cmd
+}
+
+type previewDeleteCommandConfig struct {
+	deleteCommandConfig
+	preview *previewOptions
+}
+
+func doPreviewDelete(args []string, config previewDeleteCommandConfig) error {
+	p, err := addPreview(config.App(), args, config.preview)
+	if err != nil {
+		return err
+	}
+	return doDelete([]string{p.Env}, config.deleteCommandConfig)
+}
+
+func newPreviewDeleteCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete [-n] --suffix <suffix> <base-environment>",
+		Short:   "delete all objects of a temporary environment derived from a base environment",
+		Example: previewDeleteExamples(),
+	}
+
+	config := previewDeleteCommandConfig{
+		deleteCommandConfig: deleteCommandConfig{
+			clientProvider: func(env string) (deleteClient, error) {
+				return op().Client(env)
+			},
+			filterFunc: addFilterParams(cmd, op, true),
+		},
+		preview: addPreviewFlags(cmd),
+	}
+
+	cmd.Flags().BoolVarP(&config.dryRun, "dry-run", "n", false, "dry-run, do not delete resources but show what would happen")
+	addDeleteFlags(cmd, &config.deleteCommandConfig)
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doPreviewDelete(args, config))
+	}
+	return cmd
+}
+
+func newPreviewCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "preview <subcommand>",
+		Short: "create and delete temporary environments derived from existing ones",
+	}
+	cmd.AddCommand(newPreviewCreateCommand(op), newPreviewDeleteCommand(op))
+	return cmd
+}
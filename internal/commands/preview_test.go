@@ -0,0 +1,118 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPreviewCreate(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	var synced []string
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		synced = append(synced, obj.GetKind()+":"+obj.GetNamespace()+":"+obj.GetName()+":"+obj.Environment())
+		return &remote.SyncResult{Type: remote.SyncCreated}, nil
+	}
+	var scope remote.ListQueryConfig
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, config remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		scope = config
+		return nil, nil
+	}
+	err := s.executeCommand("preview", "create", "dev", "--suffix", "pr-1", "-c", "service2", "-c", "cluster-objects", "-k", "namespace", "-k", "configmap")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues([]string{
+		"Namespace::bar-system-pr-1:dev-pr-1",
+		"Namespace::foo-system-pr-1:dev-pr-1",
+		"ConfigMap:bar-system-pr-1:svc2-cm:dev-pr-1",
+	}, synced)
+	a.Equal("dev-pr-1", scope.Environment)
+	a.Equal("example1", scope.Application)
+	s.assertErrorLineMatch(regexp.MustCompile(`preview environment dev-pr-1, default namespace default-pr-1`))
+}
+
+func TestPreviewCreateClusterObjects(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("preview", "create", "dev", "--suffix", "pr-1")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.False(isUsageError(err))
+	a.Contains(err.Error(), "preview environments cannot have cluster-scoped objects other than namespaces, found PodSecurityPolicy::100-default, PodSecurityPolicy::200-allow-root")
+}
+
+func TestPreviewDelete(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	var scope remote.ListQueryConfig
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, config remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		scope = config
+		return []model.K8sQbecMeta{
+			model.NewK8sLocalObject(map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"namespace": "bar-system-pr-1", "name": "svc2-cm"},
+			}, "example1", "service2", "dev-pr-1"),
+		}, nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, remote.ErrNotFound
+	}
+	var deleted []string
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		deleted = append(deleted, obj.GetNamespace()+":"+obj.GetName())
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	err := s.executeCommand("preview", "delete", "dev", "--suffix", "pr-1")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal("dev-pr-1", scope.Environment)
+	a.Contains(scope.Namespaces, "bar-system-pr-1")
+	a.NotContains(scope.Namespaces, "bar-system")
+	a.EqualValues([]string{"bar-system-pr-1:svc2-cm"}, deleted)
+}
+
+func TestPreviewNegative(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		msg  string
+	}{
+		{"no env", []string{"preview", "create", "--suffix", "pr-1"}, "exactly one environment required"},
+		{"no suffix", []string{"preview", "delete", "dev"}, "preview suffix must be specified using --suffix"},
+		{"bad env", []string{"preview", "create", "stage", "--suffix", "pr-1"}, `invalid environment "stage"`},
+		{"bad prop", []string{"preview", "create", "dev", "--suffix", "pr-1", "--prop", "host"}, `invalid property "host", must be of the form key=value`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			assert.True(t, isUsageError(err))
+			assert.Equal(t, test.msg, err.Error())
+		})
+	}
+}
@@ -0,0 +1,435 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	quotaGVK      = schema.GroupVersionKind{Version: "v1", Kind: "ResourceQuota"}
+	limitRangeGVK = schema.GroupVersionKind{Version: "v1", Kind: "LimitRange"}
+)
+
+// quotaClient is the remote interface needed to check resource quotas.
+type quotaClient interface {
+	DisplayName(o model.K8sMeta) string
+	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+}
+
+// resourceList is a list of resource quantities keyed by quota resource name, e.g. requests.cpu.
+type resourceList map[string]resource.Quantity
+
+// add adds the supplied list multiplied by n to this one.
+func (r resourceList) add(other resourceList, n int64) {
+	for k, q := range other {
+		sum := r[k]
+		sum.Add(*resource.NewMilliQuantity(q.MilliValue()*n, q.Format))
+		r[k] = sum
+	}
+}
+
+// sub subtracts the supplied list from this one.
+func (r resourceList) sub(other resourceList) {
+	for k, q := range other {
+		diff := r[k]
+		diff.Sub(q)
+		r[k] = diff
+	}
+}
+
+// toQuantity converts a value in an object to a quantity.
+func toQuantity(v interface{}) (resource.Quantity, error) {
+	return resource.ParseQuantity(fmt.Sprint(v))
+}
+
+// toResourceList converts a map of resource names to values in an object to a resource list.
+func toResourceList(v interface{}) (resourceList, error) {
+	ret := resourceList{}
+	m, _ := v.(map[string]interface{})
+	for k, val := range m {
+		q, err := toQuantity(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		ret[k] = q
+	}
+	return ret, nil
+}
+
+// containerLimits are the defaults and maximums for containers from limit ranges in a namespace.
+type containerLimits struct {
+	defaultRequests resourceList
+	defaultLimits   resourceList
+	max             resourceList
+}
+
+// containerLimitsFor returns the container limits from the supplied limit range objects.
+func containerLimitsFor(ranges []*unstructured.Unstructured) (*containerLimits, error) {
+	ret := &containerLimits{defaultRequests: resourceList{}, defaultLimits: resourceList{}, max: resourceList{}}
+	for _, lr := range ranges {
+		items, _ := nestedValue(lr.Object, "spec", "limits").([]interface{})
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			if m["type"] != "Container" {
+				continue
+			}
+			for _, x := range []struct {
+				field string
+				list  resourceList
+			}{
+				{"defaultRequest", ret.defaultRequests},
+				{"default", ret.defaultLimits},
+				{"max", ret.max},
+			} {
+				l, err := toResourceList(m[x.field])
+				if err != nil {
+					return nil, errors.Wrapf(err, "limit range %s/%s", lr.GetNamespace(), lr.GetName())
+				}
+				for k, q := range l {
+					x.list[k] = q
+				}
+			}
+		}
+	}
+	// requests default to limits when not specified
+	for k, q := range ret.defaultLimits {
+		if _, ok := ret.defaultRequests[k]; !ok {
+			ret.defaultRequests[k] = q
+		}
+	}
+	return ret, nil
+}
+
+// podTemplate returns the pod spec for the supplied workload object and the number of pods it will run. Daemon
+// sets are counted as a single pod since the number of nodes is not known.
+func podTemplate(u *unstructured.Unstructured) (map[string]interface{}, int64, bool) {
+	gk := u.GroupVersionKind().GroupKind()
+	var path []string
+	countPath := []string{"spec", "replicas"}
+	switch {
+	case gk.Group == "" && gk.Kind == "Pod":
+		path = []string{"spec"}
+		countPath = nil
+	case gk.Group == "" && gk.Kind == "ReplicationController",
+		(gk.Group == "apps" || gk.Group == "extensions") && (gk.Kind == "Deployment" || gk.Kind == "ReplicaSet"),
+		gk.Group == "apps" && gk.Kind == "StatefulSet":
+		path = []string{"spec", "template", "spec"}
+	case (gk.Group == "apps" || gk.Group == "extensions") && gk.Kind == "DaemonSet":
+		path = []string{"spec", "template", "spec"}
+		countPath = nil
+	case gk.Group == "batch" && gk.Kind == "Job":
+		path = []string{"spec", "template", "spec"}
+		countPath = []string{"spec", "parallelism"}
+	case gk.Group == "batch" && gk.Kind == "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+		countPath = []string{"spec", "jobTemplate", "spec", "parallelism"}
+	default:
+		return nil, 0, false
+	}
+	spec, _ := nestedValue(u.Object, path...).(map[string]interface{})
+	if spec == nil {
+		return nil, 0, false
+	}
+	count := int64(1)
+	if countPath != nil {
+		switch n := nestedValue(u.Object, countPath...).(type) {
+		case int64:
+			count = n
+		case float64:
+			count = int64(n)
+		}
+	}
+	return spec, count, true
+}
+
+// objectUsage returns the resources that the supplied object consumes from resource quotas, applying defaults from
+// the supplied container limits. It also returns violations of the maximums allowed for containers.
+func objectUsage(u *unstructured.Unstructured, limits *containerLimits) (resourceList, []string, error) {
+	ret := resourceList{}
+	if u.GetKind() == "PersistentVolumeClaim" && u.GroupVersionKind().Group == "" {
+		if storage := nestedValue(u.Object, "spec", "resources", "requests", "storage"); storage != nil {
+			q, err := toQuantity(storage)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "storage request")
+			}
+			ret["requests.storage"] = q
+		}
+		ret["persistentvolumeclaims"] = *resource.NewQuantity(1, resource.DecimalSI)
+		return ret, nil, nil
+	}
+	spec, count, ok := podTemplate(u)
+	if !ok {
+		return ret, nil, nil
+	}
+	var violations []string
+	pod := resourceList{"pods": *resource.NewQuantity(1, resource.DecimalSI)}
+	containers, _ := spec["containers"].([]interface{})
+	for _, c := range containers {
+		cm, _ := c.(map[string]interface{})
+		requests, err := toResourceList(nestedValue(cm, "resources", "requests"))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "container %v requests", cm["name"])
+		}
+		lims, err := toResourceList(nestedValue(cm, "resources", "limits"))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "container %v limits", cm["name"])
+		}
+		// requests default to explicit limits, then to the defaults of limit ranges
+		for k, q := range lims {
+			if _, ok := requests[k]; !ok {
+				requests[k] = q
+			}
+		}
+		for k, q := range limits.defaultRequests {
+			if _, ok := requests[k]; !ok {
+				requests[k] = q
+			}
+		}
+		for k, q := range limits.defaultLimits {
+			if _, ok := lims[k]; !ok {
+				lims[k] = q
+			}
+		}
+		for _, k := range sortedResourceNames(limits.max) {
+			maximum := limits.max[k]
+			if l, ok := lims[k]; ok && l.Cmp(maximum) > 0 {
+				violations = append(violations, fmt.Sprintf("container %v has a %s limit of %s, over the maximum of %s", cm["name"], k, l.String(), maximum.String()))
+			}
+		}
+		for k, q := range requests {
+			pod.add(resourceList{"requests." + k: q}, 1)
+		}
+		for k, q := range lims {
+			pod.add(resourceList{"limits." + k: q}, 1)
+		}
+	}
+	ret.add(pod, count)
+	return ret, violations, nil
+}
+
+// nestedValue returns the value at the supplied path of fields in a map, or nil if it does not exist.
+func nestedValue(m map[string]interface{}, fields ...string) interface{} {
+	var v interface{} = m
+	for _, f := range fields {
+		parent, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = parent[f]
+	}
+	return v
+}
+
+func sortedResourceNames(r resourceList) []string {
+	var ret []string
+	for k := range r {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// quotaNames maps resource names in quotas that have aliases to their canonical names.
+var quotaNames = map[string]string{
+	"cpu":     "requests.cpu",
+	"memory":  "requests.memory",
+	"storage": "requests.storage",
+}
+
+// quotaProblems sums the resources requested by the supplied objects for every namespace and compares them with the
+// space left in the resource quotas of the namespace. Objects that already exist only count for the difference
+// between their local and live versions. It returns the shortfalls, and the containers that exceed the maximums of
+// limit ranges, keyed by namespace along with the sorted namespaces that have problems.
+func quotaProblems(client quotaClient, objects []model.K8sLocalObject, defaultNs string) (map[string][]string, []string, error) {
+	byNs := map[string][]model.K8sLocalObject{}
+	var namespaces []string
+	for _, o := range objects {
+		u := o.ToUnstructured()
+		if _, _, ok := podTemplate(u); !ok && !(u.GetKind() == "PersistentVolumeClaim" && u.GroupVersionKind().Group == "") {
+			continue
+		}
+		ns := o.GetNamespace()
+		if ns == "" {
+			ns = defaultNs
+		}
+		if _, ok := byNs[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		byNs[ns] = append(byNs[ns], o)
+	}
+	sort.Strings(namespaces)
+	ret := map[string][]string{}
+	var failed []string
+	for _, ns := range namespaces {
+		quotas, err := client.ListObjects(quotaGVK, ns)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "list resource quotas in %s", ns)
+		}
+		ranges, err := client.ListObjects(limitRangeGVK, ns)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "list limit ranges in %s", ns)
+		}
+		limits, err := containerLimitsFor(ranges)
+		if err != nil {
+			return nil, nil, err
+		}
+		var problems []string
+		needed := resourceList{}
+		for _, o := range byNs[ns] {
+			name := client.DisplayName(o)
+			usage, violations, err := objectUsage(o.ToUnstructured(), limits)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, name)
+			}
+			for _, v := range violations {
+				problems = append(problems, fmt.Sprintf("%s: %s", name, v))
+			}
+			needed.add(usage, 1)
+			live, err := client.Get(o)
+			if err != nil {
+				if err == remote.ErrNotFound {
+					continue
+				}
+				return nil, nil, err
+			}
+			liveUsage, _, err := objectUsage(live, limits)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "live "+name)
+			}
+			needed.sub(liveUsage)
+		}
+		for _, q := range quotas {
+			hard, err := toResourceList(nestedValue(q.Object, "spec", "hard"))
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "resource quota %s/%s", ns, q.GetName())
+			}
+			used, err := toResourceList(nestedValue(q.Object, "status", "used"))
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "resource quota %s/%s", ns, q.GetName())
+			}
+			for _, k := range sortedResourceNames(hard) {
+				key := k
+				if alias, ok := quotaNames[k]; ok {
+					key = alias
+				}
+				need, ok := needed[key]
+				if !ok || need.Sign() <= 0 {
+					continue
+				}
+				available := hard[k]
+				available.Sub(used[k])
+				if need.Cmp(available) > 0 {
+					short := need.DeepCopy()
+					short.Sub(available)
+					problems = append(problems, fmt.Sprintf("quota %s: %s needs %s more than available (additional %s, available %s)",
+						q.GetName(), k, short.String(), need.String(), available.String()))
+				}
+			}
+		}
+		if len(problems) > 0 {
+			failed = append(failed, ns)
+			ret[ns] = problems
+		}
+	}
+	return ret, failed, nil
+}
+
+// checkQuotas checks that the supplied objects fit in the live resource quotas and limit ranges of their namespaces.
+// It returns an error with a per-namespace report when they do not.
+func checkQuotas(client quotaClient, objects []model.K8sLocalObject, defaultNs string) error {
+	problems, failed, err := quotaProblems(client, objects, defaultNs)
+	if err != nil {
+		return err
+	}
+	for _, ns := range failed {
+		sio.Errorf("namespace %s:\n\t- %s\n", ns, strings.Join(problems[ns], "\n\t- "))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("resource quotas or limit ranges would be exceeded in %d namespace(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// declaredQuotaClient adds the resource quotas and limit ranges rendered by the app to those of the cluster. A declared
+// object replaces the live object with the same name, keeping the usage recorded in the status of the live quota. When
+// offline, only declared objects are used and no objects are assumed to exist on the cluster.
+type declaredQuotaClient struct {
+	quotaClient
+	offline   bool
+	declared  []model.K8sLocalObject
+	defaultNs string
+}
+
+func (c *declaredQuotaClient) Get(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+	if c.offline {
+		return nil, remote.ErrNotFound
+	}
+	return c.quotaClient.Get(obj)
+}
+
+func (c *declaredQuotaClient) ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	live := map[string]*unstructured.Unstructured{}
+	var liveNames []string
+	if !c.offline {
+		list, err := c.quotaClient.ListObjects(gvk, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range list {
+			live[l.GetName()] = l
+			liveNames = append(liveNames, l.GetName())
+		}
+	}
+	var ret []*unstructured.Unstructured
+	declared := map[string]bool{}
+	for _, o := range c.declared {
+		ns := o.GetNamespace()
+		if ns == "" {
+			ns = c.defaultNs
+		}
+		if o.GetObjectKind().GroupVersionKind().GroupKind() != gvk.GroupKind() || ns != namespace {
+			continue
+		}
+		u := o.ToUnstructured()
+		if l, ok := live[u.GetName()]; ok {
+			u = u.DeepCopy()
+			if status, ok := l.Object["status"]; ok {
+				u.Object["status"] = status
+			}
+		}
+		declared[u.GetName()] = true
+		ret = append(ret, u)
+	}
+	for _, name := range liveNames {
+		if !declared[name] {
+			ret = append(ret, live[name])
+		}
+	}
+	return ret, nil
+}
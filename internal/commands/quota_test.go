@@ -0,0 +1,215 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func deployment(name string, replicas int64, resources map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"namespace": "quota-ns", "name": name},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "main", "resources": resources},
+					},
+				},
+			},
+		},
+	}
+}
+
+func quotaObjects(quota map[string]interface{}, limits []interface{}) func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	return func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		if namespace != "quota-ns" {
+			return nil, nil
+		}
+		if gvk.Kind == "ResourceQuota" {
+			return []*unstructured.Unstructured{{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ResourceQuota",
+				"metadata":   map[string]interface{}{"namespace": namespace, "name": "compute"},
+				"spec":       map[string]interface{}{"hard": quota["hard"]},
+				"status":     map[string]interface{}{"used": quota["used"]},
+			}}}, nil
+		}
+		if limits == nil {
+			return nil, nil
+		}
+		return []*unstructured.Unstructured{{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "LimitRange",
+			"metadata":   map[string]interface{}{"namespace": namespace, "name": "limits"},
+			"spec":       map[string]interface{}{"limits": limits},
+		}}}, nil
+	}
+}
+
+func TestResourceListAdd(t *testing.T) {
+	r := resourceList{"requests.cpu": resource.MustParse("1")}
+	r.add(resourceList{"requests.cpu": resource.MustParse("250m"), "limits.memory": resource.MustParse("1Gi")}, 1000000)
+	a := assert.New(t)
+	cpu, memory := r["requests.cpu"], r["limits.memory"]
+	a.Equal(0, cpu.Cmp(resource.MustParse("250001")))
+	a.Equal(0, memory.Cmp(resource.MustParse("1000000Gi")))
+}
+
+func TestCheckQuotas(t *testing.T) {
+	requests := map[string]interface{}{"requests": map[string]interface{}{"cpu": "500m", "memory": "256Mi"}}
+	quota := map[string]interface{}{
+		"hard": map[string]interface{}{"requests.cpu": "2", "memory": "2Gi", "pods": 10},
+		"used": map[string]interface{}{"requests.cpu": "1", "memory": "1Gi", "pods": 2},
+	}
+	tests := []struct {
+		name     string
+		objects  []map[string]interface{}
+		live     map[string]interface{}
+		limits   []interface{}
+		problems []string
+	}{
+		{
+			name:    "fits",
+			objects: []map[string]interface{}{deployment("web", 2, requests)},
+		},
+		{
+			name:     "shortfall",
+			objects:  []map[string]interface{}{deployment("web", 3, requests)},
+			problems: []string{`quota compute: requests.cpu needs 500m more than available \(additional 1500m, available 1\)`},
+		},
+		{
+			name:    "existing object",
+			objects: []map[string]interface{}{deployment("web", 3, requests)},
+			live:    deployment("web", 2, requests),
+		},
+		{
+			name:     "limit range defaults",
+			objects:  []map[string]interface{}{deployment("web", 2, nil)},
+			limits:   []interface{}{map[string]interface{}{"type": "Container", "defaultRequest": map[string]interface{}{"memory": "1Gi"}}},
+			problems: []string{`quota compute: memory needs 1Gi more than available \(additional 2Gi, available 1Gi\)`},
+		},
+		{
+			name:    "limit range maximum",
+			objects: []map[string]interface{}{deployment("web", 1, map[string]interface{}{"limits": map[string]interface{}{"cpu": "4"}})},
+			limits:  []interface{}{map[string]interface{}{"type": "Container", "max": map[string]interface{}{"cpu": "2"}}},
+			problems: []string{
+				`Deployment:quota-ns:web: container main has a cpu limit of 4, over the maximum of 2`,
+				`quota compute: requests.cpu needs 3 more than available \(additional 4, available 1\)`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			s.opts.client.listObjectsFunc = quotaObjects(quota, test.limits)
+			s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+				if test.live == nil {
+					return nil, remote.ErrNotFound
+				}
+				return &unstructured.Unstructured{Object: test.live}, nil
+			}
+			var objects []model.K8sLocalObject
+			for _, o := range test.objects {
+				objects = append(objects, model.NewK8sLocalObject(o, "example1", "c1", "dev"))
+			}
+			err := checkQuotas(s.opts.client, objects, "default")
+			if len(test.problems) == 0 {
+				require.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Equal(t, "resource quotas or limit ranges would be exceeded in 1 namespace(s): quota-ns", err.Error())
+			s.assertErrorLineMatch(regexp.MustCompile(`namespace quota-ns:`))
+			for _, p := range test.problems {
+				s.assertErrorLineMatch(regexp.MustCompile(p))
+			}
+		})
+	}
+}
+
+func TestApplyCheckQuotas(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.listObjectsFunc = quotaObjects(map[string]interface{}{
+		"hard": map[string]interface{}{"persistentvolumeclaims": 0},
+	}, nil)
+	synced := false
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		synced = true
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false", "--check-quotas")
+	require.Nil(t, err)
+	assert.True(t, synced)
+}
+
+func TestDeclaredQuotaProblems(t *testing.T) {
+	requests := map[string]interface{}{"requests": map[string]interface{}{"cpu": "500m"}}
+	declaredQuota := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ResourceQuota",
+		"metadata":   map[string]interface{}{"namespace": "quota-ns", "name": "compute"},
+		"spec":       map[string]interface{}{"hard": map[string]interface{}{"requests.cpu": "2"}},
+	}, "example1", "quotas", "dev")
+	web := model.NewK8sLocalObject(deployment("web", 3, requests), "example1", "c1", "dev")
+	a := assert.New(t)
+
+	// the declared quota fits the workload when nothing is used
+	s := newScaffold(t)
+	defer s.reset()
+	client := &declaredQuotaClient{quotaClient: s.opts.client, offline: true, declared: []model.K8sLocalObject{declaredQuota, web}}
+	problems, namespaces, err := quotaProblems(client, []model.K8sLocalObject{web}, "default")
+	require.Nil(t, err)
+	a.Nil(namespaces)
+	a.Equal(map[string][]string{}, problems)
+
+	// the declared quota replaces the live one, keeping its usage
+	s.opts.client.listObjectsFunc = quotaObjects(map[string]interface{}{
+		"hard": map[string]interface{}{"requests.cpu": "10"},
+		"used": map[string]interface{}{"requests.cpu": "1"},
+	}, nil)
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) { return nil, remote.ErrNotFound }
+	client.offline = false
+	problems, namespaces, err = quotaProblems(client, []model.K8sLocalObject{web}, "default")
+	require.Nil(t, err)
+	a.Equal([]string{"quota-ns"}, namespaces)
+	a.Equal([]string{"quota compute: requests.cpu needs 500m more than available (additional 1500m, available 1)"}, problems["quota-ns"])
+}
+
+func TestValidateCheckQuotas(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	s.opts.verbosity = 1
+	err := s.executeCommand("validate", "dev", "--check-quotas")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`^validator quotas took \d+`))
+}
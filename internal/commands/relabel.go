@@ -0,0 +1,263 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// relabelClient is the remote interface needed for relabel operations.
+type relabelClient interface {
+	protectionClient
+	listClient
+	UpdateMetadata(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error)
+}
+
+// metadataIssue is a qbec label or annotation of a live object that does not have its expected value.
+type metadataIssue struct {
+	annotation bool   // true for annotations, false for labels
+	key        string // the label or annotation key
+	want       string // the expected value
+	got        string // the live value, blank if missing
+}
+
+func (m metadataIssue) String() string {
+	kind := "label"
+	if m.annotation {
+		kind = "annotation"
+	}
+	if m.got == "" && m.want == "" {
+		return fmt.Sprintf("%s %s is missing and cannot be repaired since the object is no longer rendered", kind, m.key)
+	}
+	if m.got == "" {
+		return fmt.Sprintf("%s %s is missing, want %q", kind, m.key, m.want)
+	}
+	return fmt.Sprintf("%s %s is %q, want %q", kind, m.key, m.got, m.want)
+}
+
+// ownedByQbec returns true if the live object has any of the labels or annotations that qbec sets.
+func ownedByQbec(live *unstructured.Unstructured) bool {
+	labels := live.GetLabels()
+	anns := live.GetAnnotations()
+	return labels[model.QbecNames.ApplicationLabel] != "" ||
+		labels[model.QbecNames.EnvironmentLabel] != "" ||
+		anns[model.QbecNames.ComponentAnnotation] != "" ||
+		anns[model.QbecNames.PristineAnnotation] != ""
+}
+
+// expectedMetadata has the values of the qbec labels and component annotation that a live object should have.
+type expectedMetadata struct {
+	app       string
+	env       string
+	component string // blank when it cannot be determined
+}
+
+// metadataIssues returns the qbec labels and annotations of the live object that are different from the expected
+// ones. A missing component annotation is reported with a blank expected value when the component is not known.
+func metadataIssues(want expectedMetadata, live *unstructured.Unstructured) []metadataIssue {
+	var ret []metadataIssue
+	labels := live.GetLabels()
+	for _, l := range []struct{ key, want string }{
+		{model.QbecNames.ApplicationLabel, want.app},
+		{model.QbecNames.EnvironmentLabel, want.env},
+	} {
+		if got := labels[l.key]; got != l.want {
+			ret = append(ret, metadataIssue{key: l.key, want: l.want, got: got})
+		}
+	}
+	key := model.QbecNames.ComponentAnnotation
+	if got := live.GetAnnotations()[key]; got != want.component {
+		ret = append(ret, metadataIssue{annotation: true, key: key, want: want.component, got: got})
+	}
+	return ret
+}
+
+// relabelStats has the results of a relabel operation.
+type relabelStats struct {
+	Consistent   int      `json:"consistent"`             // count of objects with consistent metadata
+	Inconsistent []string `json:"inconsistent,omitempty"` // objects with inconsistent metadata
+	Fixed        []string `json:"fixed,omitempty"`        // objects whose metadata was repaired
+	Unrepairable []string `json:"unrepairable,omitempty"` // objects whose metadata cannot be repaired
+	Unowned      []string `json:"unowned,omitempty"`      // live objects without any qbec metadata
+	NotFound     int      `json:"notFound,omitempty"`     // count of objects that do not exist on the server
+}
+
+type relabelCommandConfig struct {
+	StdOptions
+	fix            bool
+	filterFunc     func() (filterParams, error)
+	clientProvider func(env string) (relabelClient, error)
+}
+
+type relabelFix struct {
+	obj         model.K8sMeta
+	name        string
+	labels      map[string]string
+	annotations map[string]string
+}
+
+func doRelabel(args []string, config relabelCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	env := args[0]
+	if env == model.Baseline {
+		return newUsageError("cannot relabel baseline environment, use a real environment")
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	objects, err := filteredObjects(config, env, fp)
+	if err != nil {
+		return err
+	}
+	client, err := config.clientProvider(env)
+	if err != nil {
+		return err
+	}
+
+	// live objects of the environment that are no longer rendered are checked along with the rendered ones
+	all, err := allObjects(config, env)
+	if err != nil {
+		return err
+	}
+	var ignore []model.K8sQbecMeta
+	for _, o := range all {
+		ignore = append(ignore, o)
+	}
+	cf, err := model.NewComponentFilter(fp.includes, fp.excludes)
+	if err != nil {
+		return err
+	}
+	scope, _ := listScope(client, all, config.DefaultNamespace(env))
+	extra, err := client.ListExtraObjects(ignore, remote.ListQueryConfig{
+		Application:     config.App().Name(),
+		Environment:     env,
+		KindFilter:      fp.kindFilter,
+		LabelSelector:   fp.selectorString(),
+		ComponentFilter: cf,
+		ListQueryScope:  scope,
+	})
+	if err != nil {
+		return err
+	}
+	type candidate struct {
+		obj  model.K8sMeta
+		want expectedMetadata
+	}
+	var candidates []candidate
+	for _, ob := range objects {
+		candidates = append(candidates, candidate{obj: ob, want: expectedMetadata{app: ob.Application(), env: ob.Environment(), component: ob.Component()}})
+	}
+	for _, ob := range extra {
+		candidates = append(candidates, candidate{obj: ob, want: expectedMetadata{app: config.App().Name(), env: env, component: ob.Component()}})
+	}
+
+	var stats relabelStats
+	var fixes []relabelFix
+	out := config.Stdout()
+	for _, c := range candidates {
+		name := client.DisplayName(c.obj)
+		live, err := client.Get(c.obj)
+		if err != nil {
+			if err == remote.ErrNotFound {
+				stats.NotFound++
+				continue
+			}
+			return err
+		}
+		if !ownedByQbec(live) {
+			sio.Warnf("%s has no qbec labels or annotations and was not created by qbec, skipped\n", name)
+			stats.Unowned = append(stats.Unowned, name)
+			continue
+		}
+		issues := metadataIssues(c.want, live)
+		if len(issues) == 0 {
+			stats.Consistent++
+			continue
+		}
+		stats.Inconsistent = append(stats.Inconsistent, name)
+		fix := relabelFix{obj: c.obj, name: name, labels: map[string]string{}, annotations: map[string]string{}}
+		fmt.Fprintln(out, name)
+		for _, issue := range issues {
+			fmt.Fprintf(out, "  - %s\n", issue)
+			switch {
+			case issue.want == "":
+				stats.Unrepairable = append(stats.Unrepairable, name)
+			case issue.annotation:
+				fix.annotations[issue.key] = issue.want
+			default:
+				fix.labels[issue.key] = issue.want
+			}
+		}
+		if len(fix.labels)+len(fix.annotations) > 0 {
+			fixes = append(fixes, fix)
+		}
+	}
+
+	if config.fix && len(fixes) > 0 {
+		if err := config.Confirm(fmt.Sprintf("will relabel %d objects", len(fixes))); err != nil {
+			return err
+		}
+		for _, f := range fixes {
+			if _, err := client.UpdateMetadata(f.obj, f.labels, f.annotations, false); err != nil {
+				return err
+			}
+			sio.Noticeln("relabel", f.name)
+			stats.Fixed = append(stats.Fixed, f.name)
+		}
+	}
+
+	printStats(out, &stats)
+	if !config.fix && len(fixes) > 0 {
+		return fmt.Errorf("%d object(s) with inconsistent labels or annotations, use --fix to repair them", len(fixes))
+	}
+	if len(stats.Unrepairable) > 0 {
+		return fmt.Errorf("%d object(s) that are no longer rendered have no component annotation, add it by hand or delete them", len(stats.Unrepairable))
+	}
+	return nil
+}
+
+func newRelabelCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "relabel [--fix] <environment>",
+		Short:   "report and repair inconsistent qbec labels and annotations of live objects",
+		Example: relabelExamples(),
+	}
+
+	config := relabelCommandConfig{
+		clientProvider: func(env string) (relabelClient, error) {
+			return op().Client(env)
+		},
+		filterFunc: addFilterParams(cmd, op, true),
+	}
+
+	cmd.Flags().BoolVar(&config.fix, "fix", false, "update live objects to have the expected labels and annotations")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doRelabel(args, config))
+	}
+	return cmd
+}
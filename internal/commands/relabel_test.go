@@ -0,0 +1,133 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func relabelScaffold(t *testing.T, extra ...model.K8sQbecMeta) (*scaffold, map[string]map[string]string) {
+	s := newScaffold(t)
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		return extra, nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		u := obj.(model.K8sLocalObject).ToUnstructured().DeepCopy()
+		switch obj.GetName() {
+		case "svc2-cm":
+			labels := u.GetLabels()
+			labels["qbec.io/environment"] = "prod"
+			delete(labels, "qbec.io/application")
+			u.SetLabels(labels)
+		case "svc2-secret":
+			u.SetLabels(nil)
+			u.SetAnnotations(nil)
+		case "svc2-old":
+			u.SetAnnotations(nil)
+		}
+		return u, nil
+	}
+	fixed := map[string]map[string]string{}
+	s.opts.client.metadataFunc = func(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error) {
+		fixed[obj.GetName()] = labels
+		return &remote.SyncResult{Type: remote.SyncUpdated}, nil
+	}
+	return s, fixed
+}
+
+func TestRelabelReport(t *testing.T) {
+	s, fixed := relabelScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("relabel", "dev", "-c", "service2")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 object(s) with inconsistent labels or annotations, use --fix to repair them", err.Error())
+	a.Equal(0, len(fixed))
+	s.assertOutputLineMatch(regexp.MustCompile(`^ConfigMap:bar-system:svc2-cm$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`label qbec.io/application is missing, want "example1"`))
+	s.assertOutputLineMatch(regexp.MustCompile(`label qbec.io/environment is "prod", want "dev"`))
+	s.assertErrorLineMatch(regexp.MustCompile(`Secret:bar-system:svc2-secret has no qbec labels or annotations`))
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-cm"}, stats["inconsistent"])
+	a.EqualValues([]interface{}{"Secret:bar-system:svc2-secret"}, stats["unowned"])
+}
+
+func TestRelabelFix(t *testing.T) {
+	s, fixed := relabelScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("relabel", "dev", "-c", "service2", "--fix")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues(map[string]map[string]string{
+		"svc2-cm": {"qbec.io/application": "example1", "qbec.io/environment": "dev"},
+	}, fixed)
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-cm"}, stats["fixed"])
+}
+
+func TestRelabelNotRendered(t *testing.T) {
+	// live objects that are listed have the component from their annotation, which is blank when it is missing
+	old := func(name, component string) model.K8sQbecMeta {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"namespace": "bar-system", "name": name},
+		}, "example1", component, "dev")
+	}
+	s, fixed := relabelScaffold(t, old("svc2-old", ""), old("svc2-kept", "service2"))
+	defer s.reset()
+	err := s.executeCommand("relabel", "dev", "-c", "service2", "--fix")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 object(s) that are no longer rendered have no component annotation, add it by hand or delete them", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`^ConfigMap:bar-system:svc2-old$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`annotation qbec.io/component is missing and cannot be repaired`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`^ConfigMap:bar-system:svc2-kept$`))
+	a.Contains(fixed, "svc2-cm")
+	a.NotContains(fixed, "svc2-old")
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:bar-system:svc2-old"}, stats["unrepairable"])
+	a.EqualValues(1, stats["consistent"])
+}
+
+func TestRelabelNegative(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		msg  string
+	}{
+		{"no env", []string{"relabel"}, "exactly one environment required"},
+		{"baseline", []string{"relabel", "_"}, "cannot relabel baseline environment, use a real environment"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			assert.True(t, isUsageError(err))
+			assert.Equal(t, test.msg, err.Error())
+		})
+	}
+}
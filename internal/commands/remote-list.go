@@ -54,6 +54,19 @@ type listResult struct {
 }
 
 func newRemoteLister(client listClient, allObjects []model.K8sLocalObject, defaultNs string) (*remoteLister, remote.ListQueryScope, error) {
+	scope, unknown := listScope(client, allObjects, defaultNs)
+	return &remoteLister{
+			client:       client,
+			ch:           make(chan listResult, 1),
+			unknownTypes: unknown,
+		},
+		scope,
+		nil
+}
+
+// listScope returns the list query scope needed to cover all the supplied objects along with a set of types
+// for which server metadata could not be found.
+func listScope(client listClient, allObjects []model.K8sLocalObject, defaultNs string) (remote.ListQueryScope, map[schema.GroupVersionKind]bool) {
 	nsMap := map[string]bool{}
 	if defaultNs != "" {
 		nsMap[defaultNs] = true
@@ -87,16 +100,10 @@ func newRemoteLister(client listClient, allObjects []model.K8sLocalObject, defau
 	}
 	sort.Strings(nsList)
 
-	return &remoteLister{
-			client:       client,
-			ch:           make(chan listResult, 1),
-			unknownTypes: unknown,
-		},
-		remote.ListQueryScope{
-			Namespaces:     nsList,
-			ClusterObjects: clusterObjects,
-		},
-		nil
+	return remote.ListQueryScope{
+		Namespaces:     nsList,
+		ClusterObjects: clusterObjects,
+	}, unknown
 }
 
 func (r *remoteLister) start(ignores []model.K8sLocalObject, config remote.ListQueryConfig) {
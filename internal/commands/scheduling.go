@@ -0,0 +1,275 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var nodeGVK = schema.GroupVersionKind{Version: "v1", Kind: "Node"}
+
+// reasons why a pod cannot be scheduled on a node
+const (
+	reasonNodeName     = "do not have the requested node name"
+	reasonNodeSelector = "do not match the node selector"
+	reasonAffinity     = "do not match the required node affinity"
+	reasonTaints       = "have taints that are not tolerated"
+)
+
+// schedulingClient is the remote interface needed to check whether workloads can be scheduled.
+type schedulingClient interface {
+	DisplayName(o model.K8sMeta) string
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+}
+
+// node has the attributes of a node that are used for scheduling.
+type node struct {
+	name   string
+	labels map[string]string
+	taints []map[string]interface{}
+}
+
+// toStringMap returns the string values of the supplied map.
+func toStringMap(v interface{}) map[string]string {
+	ret := map[string]string{}
+	m, _ := v.(map[string]interface{})
+	for k, val := range m {
+		ret[k] = fmt.Sprint(val)
+	}
+	return ret
+}
+
+// toMaps returns the maps in the supplied list.
+func toMaps(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	var ret []map[string]interface{}
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// toStrings returns the string values of the supplied list.
+func toStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var ret []string
+	for _, item := range list {
+		ret = append(ret, fmt.Sprint(item))
+	}
+	return ret
+}
+
+// matchExpression returns true if the supplied value of a label or field satisfies the node selector requirement.
+func matchExpression(req map[string]interface{}, value string, exists bool) bool {
+	values := toStrings(req["values"])
+	contains := func() bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	compare := func(gt bool) bool {
+		if !exists || len(values) != 1 {
+			return false
+		}
+		l, err1 := strconv.ParseInt(value, 10, 64)
+		r, err2 := strconv.ParseInt(values[0], 10, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		if gt {
+			return l > r
+		}
+		return l < r
+	}
+	switch req["operator"] {
+	case "In":
+		return exists && contains()
+	case "NotIn":
+		return !exists || !contains()
+	case "Exists":
+		return exists
+	case "DoesNotExist":
+		return !exists
+	case "Gt":
+		return compare(true)
+	case "Lt":
+		return compare(false)
+	default:
+		return false
+	}
+}
+
+// matchTerm returns true if the node satisfies all requirements of the supplied node selector term.
+func (n *node) matchTerm(term map[string]interface{}) bool {
+	for _, req := range toMaps(term["matchExpressions"]) {
+		v, ok := n.labels[fmt.Sprint(req["key"])]
+		if !matchExpression(req, v, ok) {
+			return false
+		}
+	}
+	for _, req := range toMaps(term["matchFields"]) {
+		if req["key"] != "metadata.name" || !matchExpression(req, n.name, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// taintValue returns the supplied value of a taint or toleration as a string, treating missing values as empty.
+func taintValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// tolerates returns true if one of the supplied tolerations tolerates the taint.
+func tolerates(tolerations []map[string]interface{}, taint map[string]interface{}) bool {
+	for _, t := range tolerations {
+		if effect, ok := t["effect"]; ok && effect != "" && effect != taint["effect"] {
+			continue
+		}
+		key, _ := t["key"].(string)
+		if key == "" {
+			if t["operator"] == "Exists" {
+				return true
+			}
+			continue
+		}
+		if key != taint["key"] {
+			continue
+		}
+		switch t["operator"] {
+		case "Exists":
+			return true
+		case nil, "", "Equal":
+			if taintValue(t["value"]) == taintValue(taint["value"]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unschedulableReason returns the reason why a pod with the supplied spec cannot be scheduled on the node, or an
+// empty string if it can.
+func (n *node) unschedulableReason(spec map[string]interface{}) string {
+	if name, ok := spec["nodeName"].(string); ok && name != "" && name != n.name {
+		return reasonNodeName
+	}
+	for k, v := range toStringMap(spec["nodeSelector"]) {
+		if n.labels[k] != v {
+			return reasonNodeSelector
+		}
+	}
+	terms := toMaps(nestedValue(spec, "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms"))
+	if len(terms) > 0 {
+		matched := false
+		for _, term := range terms {
+			if n.matchTerm(term) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return reasonAffinity
+		}
+	}
+	tolerations := toMaps(spec["tolerations"])
+	for _, taint := range n.taints {
+		if taint["effect"] != "NoSchedule" && taint["effect"] != "NoExecute" {
+			continue
+		}
+		if !tolerates(tolerations, taint) {
+			return reasonTaints
+		}
+	}
+	return ""
+}
+
+// schedulableNodes returns the nodes of the cluster that accept new pods.
+func schedulableNodes(client schedulingClient) ([]*node, error) {
+	list, err := client.ListObjects(nodeGVK, "")
+	if err != nil {
+		return nil, err
+	}
+	var ret []*node
+	for _, n := range list {
+		if unschedulable, _ := nestedValue(n.Object, "spec", "unschedulable").(bool); unschedulable {
+			continue
+		}
+		ret = append(ret, &node{
+			name:   n.GetName(),
+			labels: n.GetLabels(),
+			taints: toMaps(nestedValue(n.Object, "spec", "taints")),
+		})
+	}
+	return ret, nil
+}
+
+// unschedulableWorkloads returns messages for workloads in the supplied objects whose pods cannot be scheduled on
+// any node of the cluster, along with a summary of the reasons for every node that was rejected.
+func unschedulableWorkloads(objects []model.K8sLocalObject, client schedulingClient) ([]string, error) {
+	nodes, err := schedulableNodes(client)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		sio.Warnln("no schedulable nodes found, not checking if workloads can be scheduled")
+		return nil, nil
+	}
+	var ret []string
+	for _, o := range objects {
+		spec, _, ok := podTemplate(o.ToUnstructured())
+		if !ok {
+			continue
+		}
+		counts := map[string]int{}
+		feasible := false
+		for _, n := range nodes {
+			reason := n.unschedulableReason(spec)
+			if reason == "" {
+				feasible = true
+				break
+			}
+			counts[reason]++
+		}
+		if feasible {
+			continue
+		}
+		var reasons []string
+		for reason, count := range counts {
+			reasons = append(reasons, fmt.Sprintf("%d %s", count, reason))
+		}
+		sort.Strings(reasons)
+		ret = append(ret, fmt.Sprintf("%s cannot be scheduled on any of %d node(s): %s", client.DisplayName(o), len(nodes), strings.Join(reasons, ", ")))
+	}
+	return ret, nil
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testNodes(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	n := func(name string, labels map[string]interface{}, spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"metadata":   map[string]interface{}{"name": name, "labels": labels},
+			"spec":       spec,
+		}}
+	}
+	return []*unstructured.Unstructured{
+		n("node1", map[string]interface{}{"pool": "general", "zone": "a"}, nil),
+		n("node2", map[string]interface{}{"pool": "gpu", "zone": "b", "cores": "16"}, map[string]interface{}{
+			"taints": []interface{}{map[string]interface{}{"key": "gpu", "value": "true", "effect": "NoSchedule"}},
+		}),
+		n("node3", map[string]interface{}{"pool": "batch", "zone": "c"}, map[string]interface{}{"unschedulable": true}),
+	}, nil
+}
+
+func TestUnschedulableWorkloads(t *testing.T) {
+	terms := func(exprs ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"nodeAffinity": map[string]interface{}{
+				"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+					"nodeSelectorTerms": []interface{}{map[string]interface{}{"matchExpressions": exprs}},
+				},
+			},
+		}
+	}
+	expr := func(key, op string, values ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"key": key, "operator": op, "values": values}
+	}
+	gpuToleration := []interface{}{map[string]interface{}{"key": "gpu", "operator": "Equal", "value": "true", "effect": "NoSchedule"}}
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		message string
+	}{
+		{"no constraints", map[string]interface{}{}, ""},
+		{"selector", map[string]interface{}{"nodeSelector": map[string]interface{}{"zone": "a"}}, ""},
+		{"bad selector", map[string]interface{}{"nodeSelector": map[string]interface{}{"zone": "c"}}, "2 do not match the node selector"},
+		{"tainted", map[string]interface{}{"nodeSelector": map[string]interface{}{"pool": "gpu"}}, "1 do not match the node selector, 1 have taints that are not tolerated"},
+		{"tolerated", map[string]interface{}{"nodeSelector": map[string]interface{}{"pool": "gpu"}, "tolerations": gpuToleration}, ""},
+		{"tolerate all", map[string]interface{}{"nodeSelector": map[string]interface{}{"pool": "gpu"}, "tolerations": []interface{}{map[string]interface{}{"operator": "Exists"}}}, ""},
+		{"affinity", map[string]interface{}{"affinity": terms(expr("zone", "In", "b", "c")), "tolerations": gpuToleration}, ""},
+		{"bad affinity", map[string]interface{}{"affinity": terms(expr("zone", "NotIn", "a", "b"))}, "2 do not match the required node affinity"},
+		{"affinity gt", map[string]interface{}{"affinity": terms(expr("cores", "Gt", "32"))}, "2 do not match the required node affinity"},
+		{"node name", map[string]interface{}{"nodeName": "node3"}, "2 do not have the requested node name"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			s.opts.client.listObjectsFunc = testNodes
+			d := deployment("web", 1, nil)
+			template := d["spec"].(map[string]interface{})["template"].(map[string]interface{})
+			for k, v := range template["spec"].(map[string]interface{}) {
+				test.spec[k] = v
+			}
+			template["spec"] = test.spec
+			msgs, err := unschedulableWorkloads([]model.K8sLocalObject{model.NewK8sLocalObject(d, "example1", "c1", "dev")}, s.opts.client)
+			require.Nil(t, err)
+			if test.message == "" {
+				assert.Equal(t, 0, len(msgs))
+				return
+			}
+			require.Equal(t, 1, len(msgs))
+			assert.Equal(t, "Deployment:quota-ns:web cannot be scheduled on any of 2 node(s): "+test.message, msgs[0])
+		})
+	}
+}
+
+func TestValidateCheckScheduling(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	var listed schema.GroupVersionKind
+	s.opts.client.listObjectsFunc = func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+		listed = gvk
+		return nil, nil
+	}
+	err := s.executeCommand("validate", "dev", "-c", "cluster-objects", "--check-scheduling")
+	require.Nil(t, err)
+	assert.Equal(t, "Node", listed.Kind)
+	s.assertErrorLineMatch(regexp.MustCompile(`no schedulable nodes found, not checking if workloads can be scheduled`))
+}
@@ -0,0 +1,181 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/splunk/qbec/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// thresholds above which a secret value is considered a random credential
+const (
+	minSecretEntropyLength = 16  // shorter values are not checked for entropy
+	minSecretEntropy       = 3.5 // bits per character
+)
+
+// reSecretReference matches values that refer to a credential supplied elsewhere, such as ${API_TOKEN},
+// $(API_TOKEN), {{ .token }} and <token>.
+var reSecretReference = regexp.MustCompile(`^(\$\{[^}]+\}|\$\([^)]+\)|\{\{.*\}\}|<[^>]+>)$`)
+
+// sensitiveKeyNames are parts of secret keys, lower-cased and without separators, that hold credentials.
+var sensitiveKeyNames = []string{"password", "passwd", "secret", "token", "apikey", "privatekey", "accesskey", "credential"}
+
+// sensitiveKey returns true if the supplied secret key is named like one that holds a credential.
+func sensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, sep := range []string{"-", "_", "."} {
+		k = strings.Replace(k, sep, "", -1)
+	}
+	for _, n := range sensitiveKeyNames {
+		if strings.Contains(k, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy returns the Shannon entropy of the supplied string in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var ret float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		ret -= p * math.Log2(p)
+	}
+	return ret
+}
+
+// settingValue returns true if the supplied value of a sensitive key is not a credential, such as the number or flag
+// of a setting like token-ttl or a reference to a credential supplied elsewhere.
+func settingValue(v string) bool {
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseBool(v); err == nil {
+		return true
+	}
+	return reSecretReference.MatchString(v)
+}
+
+// randomValue returns true if the supplied value looks like a generated credential.
+func randomValue(v string) bool {
+	if len(v) < minSecretEntropyLength || strings.Contains(v, "://") || strings.IndexFunc(v, unicode.IsSpace) >= 0 {
+		return false
+	}
+	return entropy(v) >= minSecretEntropy
+}
+
+// plaintextReason returns why the supplied value of a secret key looks like a credential committed in source, or a
+// blank string if it does not.
+func plaintextReason(key, value string) string {
+	switch {
+	case strings.Contains(value, "-----BEGIN ") && strings.Contains(value, "PRIVATE KEY-----"):
+		return "private key"
+	case sensitiveKey(key) && !settingValue(value):
+		return "sensitive key name"
+	case randomValue(value):
+		return "high entropy"
+	default:
+		return ""
+	}
+}
+
+// allowedSecretKeys returns the keys of the supplied secret that are not checked, as listed by its annotation.
+func allowedSecretKeys(u *unstructured.Unstructured) map[string]bool {
+	ret := map[string]bool{}
+	for _, k := range strings.Split(u.GetAnnotations()[model.QbecNames.AllowedSecretKeysAnnotation], ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			ret[k] = true
+		}
+	}
+	return ret
+}
+
+// secretValues returns the values of the supplied secret keyed by data key, with data values decoded. Values of data
+// that are not valid base64 are skipped since schema validation reports them.
+func secretValues(u *unstructured.Unstructured) map[string]string {
+	ret := map[string]string{}
+	for k, v := range toStringMap(u.Object["data"]) {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			continue
+		}
+		ret[k] = string(b)
+	}
+	for k, v := range toStringMap(u.Object["stringData"]) {
+		ret[k] = v
+	}
+	return ret
+}
+
+// secretProblems returns problems with the secrets among the supplied objects: values that look like credentials
+// committed in plaintext, empty values and data over the size limit of the API server. Keys listed by the
+// allowed-secret-keys annotation of a secret, or all keys when it is "*", are not checked.
+func secretProblems(objects []model.K8sLocalObject, client validateClient) []string {
+	var ret []string
+	for _, o := range objects {
+		gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+		if gk.Group != "" || gk.Kind != "Secret" {
+			continue
+		}
+		u := o.ToUnstructured()
+		allowed := allowedSecretKeys(u)
+		if allowed["*"] {
+			continue
+		}
+		name := client.DisplayName(o)
+		values := secretValues(u)
+		var keys []string
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		size := 0
+		for _, k := range keys {
+			v := values[k]
+			size += len(v)
+			if allowed[k] {
+				continue
+			}
+			if v == "" {
+				ret = append(ret, fmt.Sprintf("%s: value of key %s is empty", name, k))
+				continue
+			}
+			if reason := plaintextReason(k, v); reason != "" {
+				ret = append(ret, fmt.Sprintf("%s: value of key %s looks like a plaintext credential (%s)", name, k, reason))
+			}
+		}
+		if size > maxConfigDataSize {
+			ret = append(ret, fmt.Sprintf("%s: data is %s, over the limit of %s", name, formatSize(size), formatSize(maxConfigDataSize)))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,270 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// appObjects indexes the objects rendered for an environment of the app, to check references between them.
+type appObjects struct {
+	defaultNs string
+	services  map[string]bool                // namespace/name of services
+	secrets   map[string]bool                // namespace/name of secrets
+	pods      map[string][]map[string]string // labels of the pods of workloads keyed by namespace
+}
+
+// namespace returns the namespace of the supplied object, using the default namespace when it is not set.
+func (a *appObjects) namespace(o model.K8sMeta) string {
+	if ns := o.GetNamespace(); ns != "" {
+		return ns
+	}
+	return a.defaultNs
+}
+
+func newAppObjects(objects []model.K8sLocalObject, defaultNs string) *appObjects {
+	a := &appObjects{
+		defaultNs: defaultNs,
+		services:  map[string]bool{},
+		secrets:   map[string]bool{},
+		pods:      map[string][]map[string]string{},
+	}
+	for _, o := range objects {
+		ns := a.namespace(o)
+		gvk := o.GetObjectKind().GroupVersionKind()
+		switch {
+		case gvk.Group == "" && gvk.Kind == "Service":
+			a.services[ns+"/"+o.GetName()] = true
+		case gvk.Group == "" && gvk.Kind == "Secret":
+			a.secrets[ns+"/"+o.GetName()] = true
+		}
+		if l := podLabels(o.ToUnstructured()); l != nil {
+			a.pods[ns] = append(a.pods[ns], l)
+		}
+	}
+	return a
+}
+
+// selects returns true if the supplied selector matches the pods of at least one workload in the namespace.
+func (a *appObjects) selects(ns string, selector labels.Selector) bool {
+	for _, l := range a.pods[ns] {
+		if selector.Matches(labels.Set(l)) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceSelectorProblems returns a problem if the supplied service has a selector that matches no workload.
+func serviceSelectorProblems(u *unstructured.Unstructured, name string, a *appObjects) []string {
+	selector := toStringMap(nestedValue(u.Object, "spec", "selector"))
+	if len(selector) == 0 {
+		return nil
+	}
+	if a.selects(a.namespace(u), labels.SelectorFromSet(selector)) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: selector %s matches no pods of workloads in the app", name, labels.SelectorFromSet(selector))}
+}
+
+// disruptionBudgetProblems returns a problem if the supplied pod disruption budget selects no workload.
+func disruptionBudgetProblems(u *unstructured.Unstructured, name string, a *appObjects) []string {
+	m, _ := nestedValue(u.Object, "spec", "selector").(map[string]interface{})
+	var ls metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &ls); err != nil {
+		return []string{fmt.Sprintf("%s: invalid selector: %v", name, err)}
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: invalid selector: %v", name, err)}
+	}
+	if a.selects(a.namespace(u), selector) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: selector %s matches no pods of workloads in the app", name, selector)}
+}
+
+// backendServices returns the names and namespaces of the services referenced as backends by the supplied ingress
+// or HTTP route.
+func backendServices(u *unstructured.Unstructured, ns string) []string {
+	var ret []string
+	add := func(n interface{}) {
+		if s, ok := n.(string); ok && s != "" {
+			ret = append(ret, ns+"/"+s)
+		}
+	}
+	if u.GetKind() == "HTTPRoute" {
+		for _, rule := range toMaps(nestedValue(u.Object, "spec", "rules")) {
+			for _, ref := range toMaps(rule["backendRefs"]) {
+				if g, _ := ref["group"].(string); g != "" {
+					continue
+				}
+				if k, _ := ref["kind"].(string); k != "" && k != "Service" {
+					continue
+				}
+				refNs := ns
+				if s, ok := ref["namespace"].(string); ok && s != "" {
+					refNs = s
+				}
+				if s, ok := ref["name"].(string); ok && s != "" {
+					ret = append(ret, refNs+"/"+s)
+				}
+			}
+		}
+		return ret
+	}
+	backends := []interface{}{
+		nestedValue(u.Object, "spec", "defaultBackend"),
+		nestedValue(u.Object, "spec", "backend"),
+	}
+	for _, rule := range toMaps(nestedValue(u.Object, "spec", "rules")) {
+		for _, p := range toMaps(nestedValue(rule, "http", "paths")) {
+			backends = append(backends, p["backend"])
+		}
+	}
+	for _, b := range backends {
+		m, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		add(nestedValue(m, "service", "name")) // networking.k8s.io/v1
+		add(m["serviceName"])                  // v1beta1
+	}
+	return ret
+}
+
+// backendProblems returns problems for services referenced by the supplied ingress or route that are not in the app.
+func backendProblems(u *unstructured.Unstructured, name string, a *appObjects) []string {
+	var ret []string
+	seen := map[string]bool{}
+	for _, s := range backendServices(u, a.namespace(u)) {
+		if a.services[s] || seen[s] {
+			continue
+		}
+		seen[s] = true
+		ret = append(ret, fmt.Sprintf("%s: backend service %s is not in the app", name, s))
+	}
+	return ret
+}
+
+// secretRefProblems returns problems for required secrets referenced by the environment of containers of the supplied
+// workload that are not in the app.
+func secretRefProblems(u *unstructured.Unstructured, name string, a *appObjects) []string {
+	spec, _, ok := podTemplate(u)
+	if !ok {
+		return nil
+	}
+	ns := a.namespace(u)
+	var ret []string
+	seen := map[string]bool{}
+	check := func(container string, ref map[string]interface{}) {
+		secret, _ := ref["name"].(string)
+		if optional, _ := ref["optional"].(bool); secret == "" || optional {
+			return
+		}
+		key := container + "/" + secret
+		if a.secrets[ns+"/"+secret] || seen[key] {
+			return
+		}
+		seen[key] = true
+		ret = append(ret, fmt.Sprintf("%s: container %s references secret %s which is not in the app", name, container, secret))
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		for _, c := range toMaps(spec[field]) {
+			cName, _ := c["name"].(string)
+			for _, e := range toMaps(c["env"]) {
+				if ref, ok := nestedValue(e, "valueFrom", "secretKeyRef").(map[string]interface{}); ok {
+					check(cName, ref)
+				}
+			}
+			for _, e := range toMaps(c["envFrom"]) {
+				if ref, ok := e["secretRef"].(map[string]interface{}); ok {
+					check(cName, ref)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// duplicateAddresses returns problems for objects with the same kind, namespace and name rendered more than once.
+func duplicateAddresses(objects []model.K8sLocalObject, client validateClient, a *appObjects) []string {
+	components := map[string][]string{}
+	names := map[string]string{}
+	var keys []string
+	for _, o := range objects {
+		gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+		key := fmt.Sprintf("%s/%s/%s", gk.String(), a.namespace(o), o.GetName())
+		if _, ok := components[key]; !ok {
+			keys = append(keys, key)
+			names[key] = client.DisplayName(o)
+		}
+		components[key] = append(components[key], o.Component())
+	}
+	var ret []string
+	for _, key := range keys {
+		list := components[key]
+		if len(list) < 2 {
+			continue
+		}
+		unique := map[string]bool{}
+		var comps []string
+		for _, c := range list {
+			if !unique[c] {
+				unique[c] = true
+				comps = append(comps, c)
+			}
+		}
+		sort.Strings(comps)
+		ret = append(ret, fmt.Sprintf("%s is rendered %d times, by component(s) %s", names[key], len(list), strings.Join(comps, ", ")))
+	}
+	return ret
+}
+
+// semanticProblems returns problems with references between the supplied objects that would only surface at runtime.
+// References are resolved against all objects of the app for the environment, of which the supplied objects may be a
+// subset.
+func semanticProblems(objects, all []model.K8sLocalObject, client validateClient, defaultNs string) []string {
+	a := newAppObjects(all, defaultNs)
+	var ret []string
+	for _, o := range objects {
+		u := o.ToUnstructured()
+		name := client.DisplayName(o)
+		gvk := o.GetObjectKind().GroupVersionKind()
+		switch {
+		case gvk.Group == "" && gvk.Kind == "Service":
+			if t, _ := nestedValue(u.Object, "spec", "type").(string); t != "ExternalName" {
+				ret = append(ret, serviceSelectorProblems(u, name, a)...)
+			}
+		case gvk.Group == "policy" && gvk.Kind == "PodDisruptionBudget":
+			ret = append(ret, disruptionBudgetProblems(u, name, a)...)
+		case gvk.Kind == "Ingress" && hostObject(gvk), gvk.Kind == "HTTPRoute" && hostObject(gvk):
+			ret = append(ret, backendProblems(u, name, a)...)
+		default:
+			ret = append(ret, secretRefProblems(u, name, a)...)
+		}
+	}
+	return append(ret, duplicateAddresses(objects, client, a)...)
+}
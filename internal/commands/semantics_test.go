@@ -0,0 +1,225 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func semanticObject(t *testing.T, component, text string) model.K8sLocalObject {
+	var data map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(text), &data))
+	return model.NewK8sLocalObject(data, "app", component, "dev")
+}
+
+func semanticObjects(t *testing.T) []model.K8sLocalObject {
+	return []model.K8sLocalObject{
+		semanticObject(t, "web", `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: web
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: web-creds
+              key: password
+        - name: TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: missing-token
+              key: token
+        - name: OPTIONAL
+          valueFrom:
+            secretKeyRef:
+              name: missing-optional
+              key: value
+              optional: true
+        envFrom:
+        - secretRef:
+            name: missing-env
+`),
+		semanticObject(t, "web", `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            app: cleanup
+        spec:
+          containers:
+          - name: cleanup
+            image: cleanup
+`),
+		semanticObject(t, "web", `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-creds
+`),
+		semanticObject(t, "web", `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+`),
+		semanticObject(t, "web", `
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+spec:
+  selector:
+    app: api
+`),
+		semanticObject(t, "web", `
+apiVersion: v1
+kind: Service
+metadata:
+  name: external
+spec:
+  type: ExternalName
+  externalName: example.com
+`),
+		semanticObject(t, "web", `
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: cleanup
+spec:
+  selector:
+    matchExpressions:
+    - key: app
+      operator: In
+      values: [cleanup]
+`),
+		semanticObject(t, "web", `
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: api
+  namespace: other
+spec:
+  selector:
+    matchLabels:
+      app: web
+`),
+		semanticObject(t, "ingress", `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  defaultBackend:
+    service:
+      name: web
+  rules:
+  - http:
+      paths:
+      - path: /admin
+        backend:
+          service:
+            name: admin
+`),
+		semanticObject(t, "ingress", `
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: web
+spec:
+  rules:
+  - backendRefs:
+    - name: web
+    - name: web
+      namespace: other
+    - name: bucket
+      group: storage.example.com
+      kind: Bucket
+`),
+		semanticObject(t, "ingress", `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+`),
+		semanticObject(t, "web", `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+  namespace: default
+`),
+	}
+}
+
+func TestSemanticProblems(t *testing.T) {
+	objects := semanticObjects(t)
+	problems := semanticProblems(objects, objects, &client{}, "default")
+	assert.Equal(t, []string{
+		"Deployment::web: container web references secret missing-token which is not in the app",
+		"Deployment::web: container web references secret missing-env which is not in the app",
+		"Service::api: selector app=api matches no pods of workloads in the app",
+		"PodDisruptionBudget:other:api: selector app=web matches no pods of workloads in the app",
+		"Ingress::web: backend service default/admin is not in the app",
+		"HTTPRoute::web: backend service other/web is not in the app",
+		"ConfigMap::web is rendered 2 times, by component(s) ingress, web",
+	}, problems)
+}
+
+func TestSemanticProblemsSubset(t *testing.T) {
+	objects := semanticObjects(t)
+	// the ingress references a service of another component that is not being validated
+	var ingresses []model.K8sLocalObject
+	for _, o := range objects {
+		if o.Component() == "ingress" && o.GetKind() == "Ingress" {
+			ingresses = append(ingresses, o)
+		}
+	}
+	problems := semanticProblems(ingresses, objects, &client{}, "default")
+	assert.Equal(t, []string{"Ingress::web: backend service default/admin is not in the app"}, problems)
+}
+
+func TestValidateCheckSemantics(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = allValid
+	err := s.executeCommand("validate", "dev", "--check-semantics")
+	require.Nil(t, err)
+}
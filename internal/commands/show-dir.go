@@ -0,0 +1,217 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// defaultFilePattern is the default pattern for file names of objects written to a directory.
+const defaultFilePattern = "{component}/{kind}-{name}.yaml"
+
+// dirManifestFile is the file in the output directory that lists the files written by the last render such that
+// stale files can be removed.
+const dirManifestFile = ".qbec-files.json"
+
+// kustomizationFile is the file in the output directory that lists the files written for the kustomize format.
+const kustomizationFile = "kustomization.yaml"
+
+// dirManifestEntry is a file written for an object.
+type dirManifestEntry struct {
+	Component string `json:"component"`
+	Kind      string `json:"kind"`
+}
+
+// dirManifest has the entries for all files written to a directory keyed by path relative to the directory.
+type dirManifest map[string]dirManifestEntry
+
+var fileNameReplacer = strings.NewReplacer("/", "_", ":", "_", "\\", "_")
+
+// objectFile returns the file for the supplied object relative to the output directory using the supplied pattern.
+// The placeholders {component}, {env}, {group}, {kind}, {namespace} and {name} are replaced with attributes of the
+// object, with the kind in lower case and cluster-scoped objects having an empty namespace.
+func objectFile(pattern string, o model.K8sLocalObject) (string, error) {
+	gvk := o.GetObjectKind().GroupVersionKind()
+	r := strings.NewReplacer(
+		"{component}", fileNameReplacer.Replace(o.Component()),
+		"{env}", fileNameReplacer.Replace(o.Environment()),
+		"{group}", fileNameReplacer.Replace(gvk.Group),
+		"{kind}", strings.ToLower(gvk.Kind),
+		"{namespace}", fileNameReplacer.Replace(o.GetNamespace()),
+		"{name}", fileNameReplacer.Replace(o.GetName()),
+	)
+	if filepath.IsAbs(pattern) {
+		return "", fmt.Errorf("file pattern %q must be relative to the output directory", pattern)
+	}
+	// placeholders with empty values, like the namespace of cluster-scoped objects, may produce a leading separator
+	file := filepath.Clean(strings.TrimLeft(r.Replace(pattern), "/"))
+	if file == "." || file == ".." || strings.HasPrefix(file, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file %q for %s is not inside the output directory", file, o)
+	}
+	return file, nil
+}
+
+// dirOutput describes the objects written to a directory.
+type dirOutput struct {
+	dir           string          // the output directory
+	pattern       string          // the file pattern
+	components    map[string]bool // the components selected for rendering, nil when all components were
+	selected      bool            // true if objects were selected by a label selector
+	kindFilter    model.Filter    // the kind filter used for rendering
+	kustomization bool            // true if a kustomization listing all files must be written
+}
+
+func loadDirManifest(dir string) (dirManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, dirManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dirManifest{}, nil
+		}
+		return nil, err
+	}
+	var m dirManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", dirManifestFile)
+	}
+	if m == nil {
+		m = dirManifest{}
+	}
+	return m, nil
+}
+
+// writeObjectsToDir writes one YAML file per object to the output directory and removes files written by an
+// earlier render that are no longer produced. When only some components or kinds were rendered, only stale files of
+// those components and kinds are removed. When objects were selected by labels, files of objects that were not
+// rendered are retained since the labels of the objects in them are not known.
+func writeObjectsToDir(objects []model.K8sLocalObject, out dirOutput) error {
+	previous, err := loadDirManifest(out.dir)
+	if err != nil {
+		return err
+	}
+	// compute all files before writing anything such that clashes do not leave partial output
+	files := make([]string, len(objects))
+	owners := map[string]model.K8sLocalObject{}
+	for i, o := range objects {
+		file, err := objectFile(out.pattern, o)
+		if err != nil {
+			return err
+		}
+		if out.kustomization && file == kustomizationFile {
+			return fmt.Errorf("file for %s cannot be %s, use --file-pattern to choose a different file", o, kustomizationFile)
+		}
+		if other, ok := owners[file]; ok {
+			return fmt.Errorf("%s and %s map to the same file %s, use --file-pattern to disambiguate", other, o, file)
+		}
+		owners[file] = o
+		files[i] = file
+	}
+	current := dirManifest{}
+	for i, o := range objects {
+		file := files[i]
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(out.dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+		current[file] = dirManifestEntry{Component: o.Component(), Kind: o.GetObjectKind().GroupVersionKind().Kind}
+	}
+
+	var stale []string
+	for file, e := range previous {
+		if _, ok := current[file]; ok {
+			continue
+		}
+		kindFiltered := out.kindFilter != nil && out.kindFilter.HasFilters()
+		if out.selected || (out.components != nil && !out.components[e.Component]) || (kindFiltered && !out.kindFilter.ShouldInclude(e.Kind)) {
+			current[file] = e // retain files for objects that were not rendered
+			continue
+		}
+		stale = append(stale, file)
+	}
+	sort.Strings(stale)
+	for _, file := range stale {
+		path := filepath.Join(out.dir, file)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removeEmptyDirs(out.dir, filepath.Dir(path))
+	}
+
+	b, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(out.dir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(out.dir, dirManifestFile), b, 0644); err != nil {
+		return err
+	}
+	if out.kustomization {
+		if err := writeKustomization(out.dir, current); err != nil {
+			return err
+		}
+	}
+	sio.Noticef("wrote %d file(s) to %s, removed %d stale file(s)\n", len(objects), out.dir, len(stale))
+	return nil
+}
+
+// writeKustomization writes a kustomization to the output directory that has all files of the manifest as resources.
+func writeKustomization(dir string, m dirManifest) error {
+	var resources []string
+	for file := range m {
+		resources = append(resources, filepath.ToSlash(file))
+	}
+	sort.Strings(resources)
+	b, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  resources,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, kustomizationFile), b, 0644)
+}
+
+// removeEmptyDirs removes the supplied directory and its parents up to, but not including, the root when they
+// are empty.
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil { // fails for directories that are not empty
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+)
+
+// objectAddress identifies a single object of an environment.
+type objectAddress struct {
+	kind       string
+	namespace  string // blank when the address does not have a namespace
+	name       string
+	kindFilter model.Filter
+}
+
+// parseObjectAddress parses an address of the form kind/name or kind/namespace/name. The kind ignores case and
+// may be plural, as in kind filters.
+func parseObjectAddress(s string) (*objectAddress, error) {
+	parts := strings.Split(s, "/")
+	for _, p := range parts {
+		if p == "" {
+			parts = nil
+			break
+		}
+	}
+	var addr objectAddress
+	switch len(parts) {
+	case 2:
+		addr = objectAddress{kind: parts[0], name: parts[1]}
+	case 3:
+		addr = objectAddress{kind: parts[0], namespace: parts[1], name: parts[2]}
+	default:
+		return nil, newUsageError(fmt.Sprintf("invalid object address %q, must be kind/name or kind/namespace/name", s))
+	}
+	kf, err := model.NewKindFilter([]string{addr.kind}, nil)
+	if err != nil {
+		return nil, newUsageError(err.Error())
+	}
+	addr.kindFilter = kf
+	return &addr, nil
+}
+
+func (a *objectAddress) String() string {
+	if a.namespace == "" {
+		return a.kind + "/" + a.name
+	}
+	return a.kind + "/" + a.namespace + "/" + a.name
+}
+
+// matches returns true if the supplied object has the address. Objects without a namespace are in the supplied
+// default namespace and an address without a namespace matches objects that are cluster-scoped or in the default
+// namespace.
+func (a *objectAddress) matches(o model.K8sMeta, defaultNs string) bool {
+	if o.GetName() != a.name || !a.kindFilter.ShouldInclude(o.GetKind()) {
+		return false
+	}
+	ns := o.GetNamespace()
+	if ns == "" || ns == defaultNs {
+		return a.namespace == "" || a.namespace == defaultNs
+	}
+	return ns == a.namespace
+}
+
+// addressedObject returns the object with the supplied address from the components of the environment that match
+// the filter. Components are evaluated one at a time, starting with those whose names are similar to the name of
+// the object, and components after the first one that produces the object are not evaluated.
+func addressedObject(req StdOptions, env string, fp filterParams, addr *objectAddress) ([]model.K8sLocalObject, error) {
+	components, err := req.App().ComponentsForEnvironment(env, fp.includes, fp.excludes)
+	if err != nil {
+		return nil, err
+	}
+	likely := func(c model.Component) bool {
+		return strings.Contains(addr.name, c.Name) || strings.Contains(c.Name, addr.name)
+	}
+	sort.SliceStable(components, func(i, j int) bool {
+		return likely(components[i]) && !likely(components[j])
+	})
+	defaultNs := req.DefaultNamespace(env)
+	for _, c := range components {
+		objects, err := componentObjects(req, env, []model.Component{c}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			if addr.matches(o, defaultNs) {
+				return []model.K8sLocalObject{o}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("object %s not found in environment %s", addr, env)
+}
@@ -17,15 +17,22 @@
 package commands
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/objsort"
+	"github.com/splunk/qbec/internal/remote"
 	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -81,46 +88,367 @@ func showNames(objects []model.K8sLocalObject, formatSpecified bool, format stri
 	}
 }
 
+// stableValue returns a copy of the supplied value where floating point numbers that are integers, which is how
+// numbers from jsonnet are decoded, are converted to integers such that they are not rendered in exponent notation.
+func stableValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			ret[k] = stableValue(item)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(value))
+		for i, item := range value {
+			ret[i] = stableValue(item)
+		}
+		return ret
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// stableObjects returns the supplied objects with normalized values, sorted by component, namespace, group,
+// version, kind and name such that the output does not depend on the order in which objects were produced.
+func stableObjects(objects []model.K8sLocalObject) []model.K8sLocalObject {
+	key := func(o model.K8sLocalObject) string {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		return fmt.Sprintf("%s:%s:%s:%s:%s:%s", o.Component(), o.GetNamespace(), gvk.Group, gvk.Version, gvk.Kind, o.GetName())
+	}
+	ret := make([]model.K8sLocalObject, 0, len(objects))
+	for _, o := range objects {
+		data := stableValue(o.ToUnstructured().Object).(map[string]interface{})
+		ret = append(ret, model.NewK8sLocalObject(data, o.Application(), o.Component(), o.Environment()))
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return key(ret[i]) < key(ret[j])
+	})
+	return ret
+}
+
+// listObject returns a v1 List that has the supplied objects as items.
+func listObject(objects []model.K8sLocalObject) map[string]interface{} {
+	items := make([]interface{}, 0, len(objects))
+	for _, o := range objects {
+		items = append(items, o)
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	}
+}
+
+// annotateProvenance returns the supplied objects with annotations recording the source file of their component
+// and, when known, the git commit of the source tree.
+func annotateProvenance(objects []model.K8sLocalObject, components []model.Component, commit string) []model.K8sLocalObject {
+	files := map[string]string{}
+	for _, c := range components {
+		files[c.Name] = filepath.ToSlash(c.File)
+	}
+	ret := make([]model.K8sLocalObject, 0, len(objects))
+	for _, o := range objects {
+		u := o.ToUnstructured().DeepCopy()
+		anns := u.GetAnnotations()
+		if anns == nil {
+			anns = map[string]string{}
+		}
+		anns[model.QbecNames.ComponentAnnotation] = o.Component()
+		if file := files[o.Component()]; file != "" {
+			anns[model.QbecNames.SourceFileAnnotation] = file
+		}
+		if commit != "" {
+			anns[model.QbecNames.GitCommitAnnotation] = commit
+		}
+		u.SetAnnotations(anns)
+		ret = append(ret, model.NewK8sLocalObject(u.Object, o.Application(), o.Component(), o.Environment()))
+	}
+	return ret
+}
+
+// gitCommit returns the commit that is checked out in the current directory.
+func gitCommit() (string, error) {
+	out, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
 // showClient is the remote interface needed for show operations.
 type showClient interface {
 	IsNamespaced(kind schema.GroupVersionKind) (bool, error)
+	FieldDefaults(obj *unstructured.Unstructured) ([]remote.FieldDefault, error)
+}
+
+// writeFieldDefaults writes the supplied defaults as YAML comments.
+func writeFieldDefaults(w io.Writer, defaults []remote.FieldDefault) {
+	if len(defaults) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# fields that will be defaulted by the server:\n")
+	for _, d := range defaults {
+		fmt.Fprintf(&buf, "#   %s: %s\n", d.Path, d.Value)
+	}
+	w.Write(buf.Bytes())
 }
 
 type showCommandConfig struct {
 	StdOptions
 	showSecrets     bool
+	redact          bool
+	redactPatterns  []string
+	redactor        *model.Redactor
 	format          string
 	formatSpecified bool
 	sortAsApply     bool
+	stable          bool
 	namesOnly       bool
+	changedSince    string
+	provenance      bool
+	outDir          string
+	filePattern     string
+	allEnvs         bool
+	report          bool
+	columns         []string
+	object          string
+	explainDefaults bool
+	address         *objectAddress
+	offline         *offlineTarget
 	filterFunc      func() (filterParams, error)
 	clientProvider  func(env string) (showClient, error)
+	changedFiles    func(ref string) ([]string, error)
+	gitCommit       func() (string, error)
+}
+
+// stdoutOptions are options that write output to a different writer.
+type stdoutOptions struct {
+	StdOptions
+	w io.Writer
+}
+
+func (s stdoutOptions) Stdout() io.Writer {
+	return s.w
+}
+
+// allEnvironments returns the baseline environment followed by all environments of the app in sorted order.
+func allEnvironments(app *model.App) []string {
+	var envs []string
+	for env := range app.Spec.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	return append([]string{model.Baseline}, envs...)
 }
 
 func doShow(args []string, config showCommandConfig) error {
-	if len(args) != 1 {
+	switch {
+	case config.allEnvs && len(args) > 0:
+		return newUsageError("cannot specify an environment with --all-envs")
+	case !config.allEnvs && len(args) != 1:
 		return newUsageError("exactly one environment required")
 	}
-	env := args[0]
 	format := config.format
-	if format != "json" && format != "yaml" {
+	switch format {
+	case "json", "yaml", "json-list", "yaml-list", "dir", "kustomize", "table":
+	default:
 		return newUsageError(fmt.Sprintf("invalid output format: %q", format))
 	}
+	toDir := format == "dir" || format == "kustomize"
+	switch {
+	case toDir && config.outDir == "":
+		return newUsageError(fmt.Sprintf("--out-dir is required for the %s format", format))
+	case (toDir || format == "json-list" || format == "yaml-list") && config.namesOnly:
+		return newUsageError(fmt.Sprintf("cannot list object names with the %s format", format))
+	case !toDir && config.outDir != "":
+		return newUsageError("--out-dir can only be used with the dir and kustomize formats")
+	}
+	columns, err := tableColumns(config.columns, objectColumns)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(config.columns) > 0 && format != "table":
+		return newUsageError("--columns can only be used with the table format")
+	case format == "table" && config.namesOnly:
+		return newUsageError("cannot list object names with the table format, it only shows names")
+	}
+	config.columns = columns
+	if config.explainDefaults && (format != "yaml" || config.namesOnly || config.report) {
+		return newUsageError("--explain-defaults can only be used to show objects in the yaml format")
+	}
+	if config.report && (config.formatSpecified || config.namesOnly) {
+		return newUsageError("--report cannot be used with --format or --objects")
+	}
+	if err := config.offline.check(); err != nil {
+		return err
+	}
+	if config.offline.enabled() {
+		config.clientProvider = func(env string) (showClient, error) {
+			return config.offline.client(config, env)
+		}
+	}
+	if len(config.redactPatterns) > 0 && !config.redact {
+		return newUsageError("--redact-pattern requires --redact")
+	}
+	if config.redact {
+		if config.showSecrets {
+			return newUsageError("cannot redact output that shows secrets")
+		}
+		patterns := append(append([]string{}, config.App().Spec.RedactPatterns...), config.redactPatterns...)
+		r, err := model.NewRedactor(patterns)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		config.redactor = r
+	}
 	fp, err := config.filterFunc()
 	if err != nil {
 		return err
 	}
-	objects, err := filteredObjects(config, env, fp)
+	if config.object != "" {
+		switch {
+		case config.allEnvs || config.changedSince != "":
+			return newUsageError("--object cannot be used with --all-envs or --changed-since")
+		case toDir:
+			return newUsageError(fmt.Sprintf("--object cannot be used with the %s format", format))
+		case fp.kindFilter.HasFilters() || fp.selector != nil:
+			return newUsageError("--object cannot be used with kind filters or label selectors")
+		}
+		config.address, err = parseObjectAddress(config.object)
+		if err != nil {
+			return err
+		}
+	}
+	if config.allEnvs {
+		return showEnvironments(allEnvironments(config.App()), fp, config)
+	}
+	return showEnvironment(args[0], fp, config)
+}
+
+// showEnvironments shows the objects of the supplied environments, in a directory per environment for directory
+// formats, as a JSON object keyed by environment for JSON formats, and in sections that start with a comment naming
+// the environment otherwise.
+func showEnvironments(envs []string, fp filterParams, config showCommandConfig) error {
+	format := config.format
+	toDir := format == "dir" || format == "kustomize"
+	toJSON := format == "json" || format == "json-list"
+	sections := map[string]json.RawMessage{}
+	for _, env := range envs {
+		envConfig := config
+		switch {
+		case toDir:
+			envConfig.outDir = filepath.Join(config.outDir, env)
+		case toJSON:
+			var buf bytes.Buffer
+			envConfig.StdOptions = stdoutOptions{StdOptions: config.StdOptions, w: &buf}
+			if err := showEnvironment(env, fp, envConfig); err != nil {
+				return err
+			}
+			sections[env] = buf.Bytes()
+			continue
+		default:
+			fmt.Fprintf(config.Stdout(), "# environment: %s\n", env)
+		}
+		if err := showEnvironment(env, fp, envConfig); err != nil {
+			return err
+		}
+	}
+	if !toJSON {
+		return nil
+	}
+	encoder := json.NewEncoder(config.Stdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sections)
+}
+
+// showEnvironment shows the objects of the supplied environment.
+func showEnvironment(env string, fp filterParams, config showCommandConfig) error {
+	format := config.format
+	var err error
+	var objects []model.K8sLocalObject
+	var selected []model.Component // the components selected for rendering when only some of them are
+	rendered := func() error { return nil }
+	switch {
+	case config.address != nil:
+		objects, err = addressedObject(config, env, fp, config.address)
+	case config.changedSince != "":
+		objects, selected, rendered, err = changedObjects(config, env, fp, config.changedSince, config.changedFiles)
+		if selected == nil {
+			selected = []model.Component{}
+		}
+	default:
+		objects, err = filteredObjects(config, env, fp)
+		if err == nil && (len(fp.includes) > 0 || len(fp.excludes) > 0) {
+			selected, err = config.App().ComponentsForEnvironment(env, fp.includes, fp.excludes)
+		}
+	}
 	if err != nil {
 		return err
 	}
+	if config.offline.enabled() && env != model.Baseline {
+		if err := config.offline.warnUnserved(config, env, objects); err != nil {
+			return err
+		}
+	}
+	if config.provenance {
+		components, err := config.App().ComponentsForEnvironment(env, nil, nil)
+		if err != nil {
+			return err
+		}
+		commit, err := config.gitCommit()
+		if err != nil {
+			sio.Warnln("unable to determine git commit, not recording it in provenance annotations:", err)
+			commit = ""
+		}
+		objects = annotateProvenance(objects, components, commit)
+	}
+	if config.report {
+		return showSizeReport(config.Stdout(), objects, config.App().Spec.SizeBudgets)
+	}
+	out := dirOutput{
+		dir:           config.outDir,
+		pattern:       config.filePattern,
+		selected:      fp.selector != nil,
+		kindFilter:    fp.kindFilter,
+		kustomization: format == "kustomize",
+	}
+	if selected != nil {
+		out.components = map[string]bool{}
+		for _, c := range selected {
+			out.components[c.Name] = true
+		}
+	}
+	if err := showObjects(objects, env, config, out); err != nil {
+		return err
+	}
+	return rendered()
+}
+
+func showObjects(objects []model.K8sLocalObject, env string, config showCommandConfig, out dirOutput) error {
+	format := config.format
 
-	if !config.showSecrets {
+	if config.redactor != nil {
+		for i, o := range objects {
+			objects[i] = config.redactor.Redact(o)
+		}
+	} else if !config.showSecrets {
 		for i, o := range objects {
 			objects[i], _ = model.HideSensitiveLocalInfo(o)
 		}
 	}
 
+	if config.stable {
+		objects = stableObjects(objects)
+	}
+
 	if config.sortAsApply {
 		if env == model.Baseline {
 			sio.Warnln("cannot sort in apply order for baseline environment")
@@ -138,7 +466,25 @@ func doShow(args []string, config showCommandConfig) error {
 	}
 
 	switch format {
+	case "table":
+		rows := make([]tableRow, 0, len(objects))
+		for _, o := range objects {
+			rows = append(rows, objectRow(o, ""))
+		}
+		return writeTable(config.Stdout(), config.columns, rows, terminalWidth())
 	case "yaml":
+		var client showClient
+		if config.explainDefaults {
+			if env == model.Baseline {
+				sio.Warnln("cannot explain defaults for baseline environment")
+			} else {
+				c, err := config.clientProvider(env)
+				if err != nil {
+					return err
+				}
+				client = c
+			}
+		}
 		for _, o := range objects {
 			b, err := yaml.Marshal(o)
 			if err != nil {
@@ -146,12 +492,35 @@ func doShow(args []string, config showCommandConfig) error {
 			}
 			fmt.Fprintln(config.Stdout(), "---")
 			fmt.Fprintf(config.Stdout(), "%s\n", b)
+			if client != nil {
+				defaults, err := client.FieldDefaults(o.ToUnstructured())
+				if err != nil && err != remote.ErrSchemaNotFound {
+					return err
+				}
+				writeFieldDefaults(config.Stdout(), defaults)
+			}
 		}
 		return nil
 	case "json":
 		encoder := json.NewEncoder(config.Stdout())
 		encoder.SetIndent("", "  ")
 		return encoder.Encode(objects)
+	case "json-list", "yaml-list":
+		list := listObject(objects)
+		if format == "json-list" {
+			encoder := json.NewEncoder(config.Stdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(list)
+		}
+		b, err := yaml.Marshal(list)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(config.Stdout(), "---")
+		fmt.Fprintf(config.Stdout(), "%s\n", b)
+		return nil
+	case "dir", "kustomize":
+		return writeObjectsToDir(objects, out)
 	default:
 		return fmt.Errorf("show: unsupported format %q", format)
 	}
@@ -168,13 +537,28 @@ func newShowCommand(op OptionsProvider) *cobra.Command {
 		clientProvider: func(env string) (showClient, error) {
 			return op().Client(env)
 		},
-		filterFunc: addFilterParams(cmd, true),
+		filterFunc:   addFilterParams(cmd, op, true),
+		changedFiles: gitChangedFiles,
+		gitCommit:    gitCommit,
 	}
 
-	cmd.Flags().StringVarP(&config.format, "format", "o", "yaml", "Output format. Supported values are: json, yaml")
+	cmd.Flags().StringVarP(&config.format, "format", "o", "yaml", "Output format. Supported values are: json, yaml, json-list, yaml-list, dir, kustomize, table")
 	cmd.Flags().BoolVarP(&config.namesOnly, "objects", "O", false, "Only print names of objects instead of their contents")
-	cmd.Flags().BoolVar(&config.sortAsApply, "sort-apply", false, "sort output in apply order (requires cluster access)")
+	cmd.Flags().BoolVar(&config.sortAsApply, "sort-apply", false, "sort output in apply order (requires cluster access or --k8s-version)")
+	cmd.Flags().BoolVar(&config.stable, "stable", false, "produce byte-stable output with objects in a fixed order and normalized numbers, for output that is committed to source control")
 	cmd.Flags().BoolVarP(&config.showSecrets, "show-secrets", "S", false, "do not obfuscate secret values in the output")
+	cmd.Flags().BoolVar(&config.redact, "redact", false, "hide secret string data and values matching the redaction patterns of qbec.yaml, for output that is shared")
+	cmd.Flags().StringArrayVar(&config.redactPatterns, "redact-pattern", nil, "with --redact, an additional regular expression for sensitive parts of string values")
+	cmd.Flags().StringVar(&config.outDir, "out-dir", "", "with the dir and kustomize formats, the directory to write one YAML file per object to, removing stale files written earlier")
+	cmd.Flags().StringVar(&config.filePattern, "file-pattern", defaultFilePattern, "with the dir and kustomize formats, the file for each object relative to the output directory, can use {component}, {env}, {group}, {kind}, {namespace} and {name}")
+	cmd.Flags().BoolVar(&config.provenance, "annotate-provenance", false, "add annotations to objects recording the component, source file and git commit from which they were generated")
+	cmd.Flags().BoolVar(&config.explainDefaults, "explain-defaults", false, "add YAML comments listing fields that are not set and will be defaulted by the server, from its Open API schema (requires cluster access or --k8s-version with --k8s-schema)")
+	cmd.Flags().BoolVar(&config.allEnvs, "all-envs", false, "show objects for the baseline and all environments in a single run, instead of a single environment")
+	addColumnsFlag(cmd, &config.columns, objectColumns)
+	cmd.Flags().BoolVar(&config.report, "report", false, "print object counts and serialized sizes instead of objects, flagging objects and components that exceed size limits")
+	cmd.Flags().StringVar(&config.object, "object", "", "only show the object with this address, of the form kind/name or kind/namespace/name, evaluating as few components as possible")
+	cmd.Flags().StringVar(&config.changedSince, "changed-since", "", "only show components whose input files changed since this git reference or since the last-render")
+	config.offline = addOfflineFlags(cmd)
 
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
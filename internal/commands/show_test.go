@@ -18,12 +18,21 @@ package commands
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/ghodss/yaml"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestShowBasic(t *testing.T) {
@@ -56,6 +65,17 @@ func TestShowApplySort(t *testing.T) {
 	assert.True(t, pos1 > pos2) // namespace after psp in apply sort
 }
 
+func TestShowApplySortCustomOrder(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.ApplyOrder = []model.KindOrder{{Kind: "Namespace", Order: 5}}
+	err := s.executeCommand("show", "dev", "--sort-apply")
+	require.Nil(t, err)
+	pos1 := strings.Index(s.stdout(), "name: foo-system")
+	pos2 := strings.Index(s.stdout(), "name: 100-default")
+	assert.True(t, pos1 < pos2) // namespace before psp with custom order
+}
+
 func TestShowApplySortBaseline(t *testing.T) {
 	s := newScaffold(t)
 	defer s.reset()
@@ -172,6 +192,29 @@ func TestShowObjectsKindFilter3(t *testing.T) {
 	assert.Contains(t, s.stderr(), "matches for kind filter, check for typos and abbreviations")
 }
 
+func TestShowObjectsSelector(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "-l", "system=true")
+	require.Nil(t, err)
+	out, err := s.yamlOutput()
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(out))
+	s.assertOutputLineMatch(regexp.MustCompile(`\s+name: bar-system`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`\s+name: svc2-secret`))
+}
+
+func TestShowObjectsSelectorNoMatch(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "-l", "system=false")
+	require.Nil(t, err)
+	out, err := s.yamlOutput()
+	require.Nil(t, err)
+	assert.True(t, len(out) == 0)
+	assert.Contains(t, s.stderr(), `0 of 9 matches for label selector "system=false"`)
+}
+
 func TestShowHiddenSecrets(t *testing.T) {
 	s := newScaffold(t)
 	defer s.reset()
@@ -194,12 +237,532 @@ func TestShowOpenSecrets(t *testing.T) {
 	s.assertOutputLineMatch(regexp.MustCompile(secretValue))
 }
 
+func TestShowChangedSinceRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		changed  string
+		expected []string
+	}{
+		{name: "component", changed: "components/service2.jsonnet", expected: []string{"svc2-cm", "svc2-secret"}},
+		{name: "lib", changed: "lib/objects.libsonnet", expected: []string{"svc2-cm", "svc2-secret"}},
+		{name: "app", changed: "qbec.yaml", expected: []string{"foo-system", "svc2-cm"}},
+		{name: "other", changed: "README.md"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			changed, err := filepath.Abs(test.changed)
+			require.Nil(t, err)
+			err = doShow([]string{"dev"}, showCommandConfig{
+				StdOptions:   s.opts,
+				format:       "yaml",
+				namesOnly:    true,
+				changedSince: "HEAD~1",
+				filterFunc:   func() (filterParams, error) { return filterParams{}, nil },
+				changedFiles: func(ref string) ([]string, error) {
+					assert.Equal(t, "HEAD~1", ref)
+					return []string{changed}, nil
+				},
+			})
+			require.Nil(t, err)
+			a := assert.New(t)
+			for _, name := range test.expected {
+				a.Contains(s.stdout(), name)
+			}
+			if test.changed != "qbec.yaml" {
+				a.NotContains(s.stdout(), "foo-system")
+			}
+		})
+	}
+}
+
+func TestShowChangedSinceLastRender(t *testing.T) {
+	run := func(t *testing.T) *scaffold {
+		s := newScaffold(t)
+		defer s.reset()
+		err := s.executeCommand("show", "dev", "-O", "--changed-since", "last-render")
+		require.Nil(t, err)
+		return s
+	}
+	defer os.RemoveAll(filepath.Join("../../examples/test-app", ".qbec"))
+	a := assert.New(t)
+
+	s := run(t)
+	a.Contains(s.stdout(), "svc2-cm")
+	a.Contains(s.stdout(), "foo-system")
+	s.assertErrorLineMatch(regexp.MustCompile(`2 component\(s\) changed since last-render: cluster-objects, service2`))
+
+	s = run(t)
+	a.NotContains(s.stdout(), "svc2-cm")
+	s.assertErrorLineMatch(regexp.MustCompile(`0 component\(s\) changed since last-render`))
+
+	stateFile := filepath.Join("../../examples/test-app", renderStateDir, "dev.json")
+	b, err := ioutil.ReadFile(stateFile)
+	require.Nil(t, err)
+	var state renderState
+	require.Nil(t, json.Unmarshal(b, &state))
+	for f := range state["service2"] {
+		state["service2"][f] = "changed"
+	}
+	b, err = json.Marshal(state)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(stateFile, b, 0644))
+
+	s = run(t)
+	a.Contains(s.stdout(), "svc2-cm")
+	a.NotContains(s.stdout(), "foo-system")
+}
+
+func TestShowProvenance(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit func() (string, error)
+		assert func(t *testing.T, s *scaffold)
+	}{
+		{
+			name:   "with commit",
+			commit: func() (string, error) { return "abc123", nil },
+			assert: func(t *testing.T, s *scaffold) {
+				s.assertOutputLineMatch(regexp.MustCompile(`qbec.io/git-commit: abc123`))
+			},
+		},
+		{
+			name:   "without commit",
+			commit: func() (string, error) { return "", errors.New("not a git repository") },
+			assert: func(t *testing.T, s *scaffold) {
+				assert.NotContains(t, s.stdout(), "qbec.io/git-commit")
+				s.assertErrorLineMatch(regexp.MustCompile(`unable to determine git commit, not recording it in provenance annotations: not a git repository`))
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := doShow([]string{"dev"}, showCommandConfig{
+				StdOptions: s.opts,
+				format:     "yaml",
+				provenance: true,
+				filterFunc: func() (filterParams, error) { return filterParams{includes: []string{"service2"}}, nil },
+				gitCommit:  test.commit,
+			})
+			require.Nil(t, err)
+			s.assertOutputLineMatch(regexp.MustCompile(`qbec.io/component: service2`))
+			s.assertOutputLineMatch(regexp.MustCompile(`qbec.io/source-file: components/service2.jsonnet`))
+			test.assert(t, s)
+		})
+	}
+}
+
+func TestShowList(t *testing.T) {
+	for _, format := range []string{"json-list", "yaml-list"} {
+		t.Run(format, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand("show", "dev", "-o", format)
+			require.Nil(t, err)
+			var list struct {
+				APIVersion string                   `json:"apiVersion"`
+				Kind       string                   `json:"kind"`
+				Items      []map[string]interface{} `json:"items"`
+			}
+			if format == "json-list" {
+				err = s.jsonOutput(&list)
+			} else {
+				err = yaml.Unmarshal([]byte(s.stdout()), &list)
+			}
+			require.Nil(t, err)
+			assert.Equal(t, "v1", list.APIVersion)
+			assert.Equal(t, "List", list.Kind)
+			assert.Equal(t, 9, len(list.Items))
+		})
+	}
+}
+
+func TestShowStable(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	file := filepath.Join("components", "numbers.jsonnet")
+	run := func(code string) string {
+		require.Nil(t, ioutil.WriteFile(file, []byte(code), 0644))
+		app, err := model.NewApp("qbec.yaml")
+		require.Nil(t, err)
+		s.opts.app = app
+		s.outCapture.Reset()
+		err = s.executeCommand("show", "dev", "--stable")
+		require.Nil(t, err)
+		return s.stdout()
+	}
+	// same objects, produced in a different order and with numbers written differently
+	first := run(`[
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'num-b' }, spec: { count: 10000000, ratio: 0.5 } },
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'num-a' }, spec: { count: 1e7 } },
+]`)
+	second := run(`[
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'num-a' }, spec: { count: 1e7 } },
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: 'num-b' }, spec: { count: 1e7, ratio: 5e-1 } },
+]`)
+	a := assert.New(t)
+	a.Equal(first, second)
+	a.Contains(first, "count: 10000000\n")
+	a.Contains(first, "ratio: 0.5\n")
+	a.NotContains(first, "e+07")
+	pos1 := strings.Index(first, "name: foo-system")
+	pos2 := strings.Index(first, "name: num-a")
+	pos3 := strings.Index(first, "name: num-b")
+	pos4 := strings.Index(first, "name: svc2-cm")
+	a.True(pos1 > 0)
+	a.True(pos1 < pos2) // cluster-objects before numbers
+	a.True(pos2 < pos3) // sorted by name within a component
+	a.True(pos3 < pos4) // numbers before service2
+}
+
+func TestStableValue(t *testing.T) {
+	in := map[string]interface{}{
+		"replicas": float64(1000000),
+		"ratio":    0.5,
+		"ports":    []interface{}{float64(8080), "http"},
+	}
+	out := stableValue(in).(map[string]interface{})
+	assert.Equal(t, int64(1000000), out["replicas"])
+	assert.Equal(t, 0.5, out["ratio"])
+	assert.Equal(t, []interface{}{int64(8080), "http"}, out["ports"])
+	assert.Equal(t, float64(1000000), in["replicas"])
+}
+
+func TestShowAllEnvs(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "--all-envs", "-c", "cluster-objects")
+	require.Nil(t, err)
+	out := s.stdout()
+	a := assert.New(t)
+	pos1 := strings.Index(out, "# environment: _\n")
+	pos2 := strings.Index(out, "# environment: dev\n")
+	pos3 := strings.Index(out, "# environment: prod\n")
+	a.True(pos1 == 0)
+	a.True(pos2 > pos1)
+	a.True(pos3 > pos2)
+	a.Contains(out[pos2:pos3], "qbec.io/environment: dev")
+	a.Contains(out[pos3:], "qbec.io/environment: prod")
+}
+
+func TestShowAllEnvsJSON(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "--all-envs", "-o", "json", "-k", "namespace")
+	require.Nil(t, err)
+	var data map[string][]map[string]interface{}
+	require.Nil(t, s.jsonOutput(&data))
+	a := assert.New(t)
+	a.Equal(3, len(data))
+	for _, env := range []string{"_", "dev", "prod"} {
+		a.Equal(2, len(data[env]), env)
+	}
+}
+
+func TestShowAllEnvsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "show-all-envs")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := newScaffold(t)
+	defer s.reset()
+	err = s.executeCommand("show", "--all-envs", "-o", "dir", "--out-dir", dir)
+	require.Nil(t, err)
+	for _, file := range []string{"_/cluster-objects/namespace-bar-system.yaml", "dev/service2/configmap-svc2-cm.yaml", "prod/service2/configmap-svc2-cm.yaml"} {
+		_, err := os.Stat(filepath.Join(dir, file))
+		assert.Nil(t, err, file)
+	}
+}
+
+func TestShowRedact(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.RedactPatterns = []string{"^ba"}
+	err := s.executeCommand("show", "dev", "-c", "service2", "--redact", "--redact-pattern", "^svc2-secret$")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`foo: redacted\.\S+r$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`name: redacted\.`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`foo: bar`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`name: svc2-secret`))
+}
+
+func TestShowTable(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "-o", "table", "-c", "service2")
+	require.Nil(t, err)
+	a := assert.New(t)
+	lines := strings.Split(strings.TrimSpace(s.stdout()), "\n")
+	require.Equal(t, 3, len(lines))
+	a.Regexp(regexp.MustCompile(`^COMPONENT\s+KIND\s+NAMESPACE\s+NAME$`), lines[0])
+	a.Regexp(regexp.MustCompile(`^service2\s+ConfigMap\s+bar-system\s+svc2-cm$`), lines[1])
+	a.Regexp(regexp.MustCompile(`^service2\s+Secret\s+bar-system\s+svc2-secret$`), lines[2])
+}
+
+func TestShowTableColumns(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "-o", "table", "-c", "service2", "--columns", "name,kind")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^NAME\s+KIND$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^svc2-cm\s+ConfigMap$`))
+}
+
+func TestShowObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		expected string
+	}{
+		{"namespaced", "configmap/bar-system/svc2-cm", `^service2\s+ConfigMap\s+bar-system\s+svc2-cm$`},
+		{"plural kind", "ConfigMaps/bar-system/svc2-cm", `^service2\s+ConfigMap\s+bar-system\s+svc2-cm$`},
+		{"cluster-scoped", "clusterrole/allow-root-psp-policy", `^cluster-objects\s+ClusterRole\s+allow-root-psp-policy$`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand("show", "dev", "-o", "table", "--object", test.address)
+			require.Nil(t, err)
+			lines := strings.Split(strings.TrimSpace(s.stdout()), "\n")
+			require.Equal(t, 2, len(lines))
+			assert.Regexp(t, regexp.MustCompile(test.expected), lines[1])
+		})
+	}
+}
+
+func TestShowExplainDefaults(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.defaultsFunc = func(obj *unstructured.Unstructured) ([]remote.FieldDefault, error) {
+		if obj.GetKind() != "ConfigMap" {
+			return nil, remote.ErrSchemaNotFound
+		}
+		return []remote.FieldDefault{{Path: "immutable", Value: "false"}}, nil
+	}
+	err := s.executeCommand("show", "dev", "-c", "service2", "--explain-defaults")
+	require.Nil(t, err)
+	out := s.stdout()
+	a := assert.New(t)
+	a.Equal(1, strings.Count(out, "# fields that will be defaulted by the server:\n#   immutable: false\n"))
+	a.Contains(out, "kind: Secret")
+}
+
+func TestShowK8sVersion(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "-c", "cluster-objects", "--k8s-version", "1.22", "--sort-apply")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`podsecuritypolicy 100-default \(source cluster-objects\): apiVersion extensions/v1beta1 is not served for PodSecurityPolicy by Kubernetes 1.22, use policy/v1beta1`))
+	assert.Contains(t, s.stdout(), "name: 100-default")
+}
+
+func TestShowObjectNotFound(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "--object", "configmap/svc2-cm")
+	require.NotNil(t, err)
+	assert.Equal(t, "object configmap/svc2-cm not found in environment dev", err.Error())
+}
+
+func TestShowReport(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("show", "dev", "--report")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^COMPONENT\s+KIND\s+NAME\s+SIZE\s+NOTE$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^service2\s+ConfigMap\s+bar-system/svc2-cm\s+\d+ B\s*$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^service2\s+\d+\s+\d+(\.\d)? K?i?B\s*$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^TOTAL\s+9\s+`))
+	s.assertOutputLineNoMatch(regexp.MustCompile(`^apiVersion:`))
+}
+
+func TestShowReportBudget(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.SizeBudgets = &model.SizeBudgets{MaxObjectSize: 100}
+	err := s.executeCommand("show", "dev", "--report", "-c", "service2")
+	require.NotNil(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^\d+ object\(s\) or component\(s\) exceed size limits$`), err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`svc2-cm\s+\d+ B\s+exceeds budget of 100 B$`))
+}
+
+func TestShowDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "show-dir")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	run := func(t *testing.T, args ...string) *scaffold {
+		s := newScaffold(t)
+		defer s.reset()
+		err := s.executeCommand(append([]string{"show", "dev", "-o", "dir", "--out-dir", dir}, args...)...)
+		require.Nil(t, err)
+		return s
+	}
+	a := assert.New(t)
+	exists := func(file string) bool {
+		_, err := os.Stat(filepath.Join(dir, file))
+		return err == nil
+	}
+
+	s := run(t)
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote 9 file\(s\) to .*, removed 0 stale file\(s\)`))
+	a.True(exists("service2/configmap-svc2-cm.yaml"))
+	a.True(exists("cluster-objects/namespace-bar-system.yaml"))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "service2/secret-svc2-secret.yaml"))
+	require.Nil(t, err)
+	a.Contains(string(b), "name: svc2-secret")
+	a.NotContains(string(b), "---")
+
+	// stale files are only removed for rendered components
+	m, err := loadDirManifest(dir)
+	require.Nil(t, err)
+	for _, file := range []string{"service2/configmap-old.yaml", "cluster-objects/old/namespace-old.yaml"} {
+		require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, file), []byte("old"), 0644))
+		m[file] = dirManifestEntry{Component: strings.Split(file, "/")[0], Kind: "ConfigMap"}
+	}
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "unmanaged.yaml"), []byte("keep"), 0644))
+	b, err = json.Marshal(m)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, dirManifestFile), b, 0644))
+
+	s = run(t, "-c", "service2")
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote 2 file\(s\) to .*, removed 1 stale file\(s\)`))
+	a.False(exists("service2/configmap-old.yaml"))
+	a.True(exists("cluster-objects/old/namespace-old.yaml"))
+	a.True(exists("cluster-objects/namespace-bar-system.yaml"))
+
+	// files of objects outside a label selector are retained
+	s = run(t, "-l", "system=true")
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote 2 file\(s\) to .*, removed 0 stale file\(s\)`))
+	a.True(exists("service2/configmap-svc2-cm.yaml"))
+	a.True(exists("service2/secret-svc2-secret.yaml"))
+	a.True(exists("cluster-objects/old/namespace-old.yaml"))
+
+	s = run(t, "--file-pattern", "{namespace}/{kind}-{name}.yaml")
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote 9 file\(s\) to .*, removed 10 stale file\(s\)`))
+	a.True(exists("bar-system/configmap-svc2-cm.yaml"))
+	a.True(exists("namespace-bar-system.yaml"))
+	a.False(exists("cluster-objects"))
+	a.True(exists("unmanaged.yaml"))
+}
+
+// writeDirManifest writes files for the supplied manifest entries to the supplied directory, along with the
+// manifest that lists them.
+func writeDirManifest(t *testing.T, dir string, m dirManifest) {
+	for file := range m {
+		require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, file), []byte("old"), 0644))
+	}
+	b, err := json.Marshal(m)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, dirManifestFile), b, 0644))
+}
+
+func TestShowDirEmptyComponent(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	require.Nil(t, ioutil.WriteFile(filepath.Join("components", "empty.jsonnet"), []byte("{}"), 0644))
+	app, err := model.NewApp("qbec.yaml")
+	require.Nil(t, err)
+	s.opts.app = app
+	writeDirManifest(t, "out", dirManifest{
+		"empty/configmap-gone.yaml":    {Component: "empty", Kind: "ConfigMap"},
+		"service2/configmap-kept.yaml": {Component: "service2", Kind: "ConfigMap"},
+	})
+
+	// files of a selected component that no longer renders objects are stale
+	err = s.executeCommand("show", "dev", "-o", "dir", "--out-dir", "out", "-c", "empty")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`wrote 0 file\(s\) to out, removed 1 stale file\(s\)`))
+	a := assert.New(t)
+	_, err = os.Stat(filepath.Join("out", "empty/configmap-gone.yaml"))
+	a.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join("out", "service2/configmap-kept.yaml"))
+	a.Nil(err)
+}
+
+func TestShowKustomize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "show-kustomize")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := newScaffold(t)
+	defer s.reset()
+	err = s.executeCommand("show", "dev", "-o", "kustomize", "--out-dir", dir, "-c", "service2")
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	require.Nil(t, err)
+	var k struct {
+		APIVersion string   `json:"apiVersion"`
+		Kind       string   `json:"kind"`
+		Resources  []string `json:"resources"`
+	}
+	require.Nil(t, yaml.Unmarshal(b, &k))
+	a := assert.New(t)
+	a.Equal("kustomize.config.k8s.io/v1beta1", k.APIVersion)
+	a.Equal("Kustomization", k.Kind)
+	a.Equal([]string{"service2/configmap-svc2-cm.yaml", "service2/secret-svc2-secret.yaml"}, k.Resources)
+	_, err = os.Stat(filepath.Join(dir, "service2/configmap-svc2-cm.yaml"))
+	a.Nil(err)
+}
+
 func TestShowNegative(t *testing.T) {
 	tests := []struct {
 		name     string
 		args     []string
 		asserter func(s *scaffold, err error)
 	}{
+		{
+			name: "bad object address",
+			args: []string{"show", "dev", "--object", "svc2-cm"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid object address "svc2-cm", must be kind/name or kind/namespace/name`, err.Error())
+			},
+		},
+		{
+			name: "explain defaults with json",
+			args: []string{"show", "dev", "-o", "json", "--explain-defaults"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--explain-defaults can only be used to show objects in the yaml format", err.Error())
+			},
+		},
+		{
+			name: "object with kind filter",
+			args: []string{"show", "dev", "--object", "configmap/svc2-cm", "-k", "secret"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--object cannot be used with kind filters or label selectors", err.Error())
+			},
+		},
+		{
+			name: "object with all envs",
+			args: []string{"show", "--all-envs", "--object", "configmap/svc2-cm"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--object cannot be used with --all-envs or --changed-since", err.Error())
+			},
+		},
+		{
+			name: "object with dir",
+			args: []string{"show", "dev", "-o", "dir", "--out-dir", "out", "--object", "configmap/svc2-cm"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--object cannot be used with the dir format", err.Error())
+			},
+		},
 		{
 			name: "no env",
 			args: []string{"show"},
@@ -229,11 +792,56 @@ func TestShowNegative(t *testing.T) {
 		},
 		{
 			name: "bad format",
-			args: []string{"show", "dev", "-o", "table"},
+			args: []string{"show", "dev", "-o", "xml"},
 			asserter: func(s *scaffold, err error) {
 				a := assert.New(s.t)
 				a.True(isUsageError(err))
-				a.Equal(`invalid output format: "table"`, err.Error())
+				a.Equal(`invalid output format: "xml"`, err.Error())
+			},
+		},
+		{
+			name: "dir without out-dir",
+			args: []string{"show", "dev", "-o", "dir"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--out-dir is required for the dir format`, err.Error())
+			},
+		},
+		{
+			name: "out-dir without dir",
+			args: []string{"show", "dev", "--out-dir", "rendered"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--out-dir can only be used with the dir and kustomize formats`, err.Error())
+			},
+		},
+		{
+			name: "list names",
+			args: []string{"show", "dev", "-O", "-o", "yaml-list"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot list object names with the yaml-list format`, err.Error())
+			},
+		},
+		{
+			name: "kustomization clash",
+			args: []string{"show", "dev", "-o", "kustomize", "--out-dir", filepath.Join(os.TempDir(), "qbec-show-clash"), "-c", "service2", "-k", "configmaps", "--file-pattern", "kustomization.yaml"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.False(isUsageError(err))
+				a.Contains(err.Error(), "cannot be kustomization.yaml, use --file-pattern to choose a different file")
+			},
+		},
+		{
+			name: "dir clash",
+			args: []string{"show", "dev", "-o", "dir", "--out-dir", filepath.Join(os.TempDir(), "qbec-show-clash"), "--file-pattern", "{component}.yaml"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.False(isUsageError(err))
+				a.Contains(err.Error(), "map to the same file cluster-objects.yaml, use --file-pattern to disambiguate")
 			},
 		},
 		{
@@ -254,6 +862,78 @@ func TestShowNegative(t *testing.T) {
 				a.Equal(`cannot include as well as exclude kinds, specify one or the other`, err.Error())
 			},
 		},
+		{
+			name: "env with all envs",
+			args: []string{"show", "dev", "--all-envs"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot specify an environment with --all-envs`, err.Error())
+			},
+		},
+		{
+			name: "redact with secrets",
+			args: []string{"show", "dev", "--redact", "-S"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`cannot redact output that shows secrets`, err.Error())
+			},
+		},
+		{
+			name: "redact pattern without redact",
+			args: []string{"show", "dev", "--redact-pattern", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--redact-pattern requires --redact`, err.Error())
+			},
+		},
+		{
+			name: "bad redact pattern",
+			args: []string{"show", "dev", "--redact", "--redact-pattern", "("},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Contains(err.Error(), `redaction pattern "("`)
+			},
+		},
+		{
+			name: "columns without table",
+			args: []string{"show", "dev", "--columns", "kind"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--columns can only be used with the table format`, err.Error())
+			},
+		},
+		{
+			name: "bad column",
+			args: []string{"show", "dev", "-o", "table", "--columns", "kind,change"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid column "change", must be one of component, kind, namespace, name`, err.Error())
+			},
+		},
+		{
+			name: "report with format",
+			args: []string{"show", "dev", "--report", "-o", "json"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--report cannot be used with --format or --objects`, err.Error())
+			},
+		},
+		{
+			name: "bad selector",
+			args: []string{"show", "dev", "-l", "a=b=c"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Contains(err.Error(), `invalid selector "a=b=c"`)
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -265,3 +945,26 @@ func TestShowNegative(t *testing.T) {
 		})
 	}
 }
+
+func TestShowTransformers(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	reset := editInTempDir(t)
+	defer reset()
+	transformer := `function(object) object {
+  metadata+: { labels+: { 'cost-center': 'platform-' + std.extVar('qbec.io/env') } },
+}
+`
+	require.Nil(t, ioutil.WriteFile("cost.libsonnet", []byte(transformer), 0644))
+	s.opts.app.Spec.Transformers = []model.Transformer{{Name: "cost", File: "cost.libsonnet"}}
+	err := s.executeCommand("show", "dev", "-c", "service2")
+	require.Nil(t, err)
+	docs, err := s.yamlOutput()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(docs))
+	for _, doc := range docs {
+		labels := doc.(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+		assert.Equal(t, "platform-dev", labels["cost-center"])
+		assert.Equal(t, "dev", labels[model.QbecNames.EnvironmentLabel])
+	}
+}
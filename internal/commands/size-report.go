@@ -0,0 +1,130 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/splunk/qbec/internal/model"
+)
+
+// size limits of clusters
+const (
+	maxEtcdObjectSize = 1536 * 1024 // default max request size of etcd, which limits the size of stored objects
+	maxConfigDataSize = 1024 * 1024 // max size of config maps and secrets enforced by the API server
+)
+
+// objectSize is the serialized size of a rendered object.
+type objectSize struct {
+	object model.K8sLocalObject
+	size   int
+	note   string // reason the object exceeds a limit, if it does
+}
+
+// formatSize returns a human readable representation of the supplied number of bytes.
+func formatSize(n int) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// objectSizeLimit returns the size limit for the supplied object and a description of where the limit comes from.
+func objectSizeLimit(o model.K8sLocalObject, budgets model.SizeBudgets) (int, string) {
+	limit, source := maxEtcdObjectSize, "cluster limit"
+	gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+	if gk.Group == "" && (gk.Kind == "ConfigMap" || gk.Kind == "Secret") {
+		limit = maxConfigDataSize
+	}
+	if budgets.MaxObjectSize > 0 && budgets.MaxObjectSize < limit {
+		limit, source = budgets.MaxObjectSize, "budget"
+	}
+	return limit, source
+}
+
+// showSizeReport writes the serialized sizes of the supplied objects, followed by the object counts and sizes of
+// their components, to the supplied writer. It returns an error if any object or component exceeds its size limit.
+func showSizeReport(w io.Writer, objects []model.K8sLocalObject, budgets *model.SizeBudgets) error {
+	var b model.SizeBudgets
+	if budgets != nil {
+		b = *budgets
+	}
+	var sizes []objectSize
+	var components []string
+	counts := map[string]int{}
+	totals := map[string]int{}
+	exceeded := 0
+	for _, o := range objects {
+		data, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		s := objectSize{object: o, size: len(data)}
+		if limit, source := objectSizeLimit(o, b); s.size > limit {
+			s.note = fmt.Sprintf("exceeds %s of %s", source, formatSize(limit))
+			exceeded++
+		}
+		sizes = append(sizes, s)
+		if _, ok := counts[o.Component()]; !ok {
+			components = append(components, o.Component())
+		}
+		counts[o.Component()]++
+		totals[o.Component()] += s.size
+	}
+	sort.Strings(components)
+	sort.SliceStable(sizes, func(i, j int) bool {
+		left, right := sizes[i], sizes[j]
+		if left.object.Component() != right.object.Component() {
+			return left.object.Component() < right.object.Component()
+		}
+		return left.size > right.size
+	})
+
+	fmt.Fprintf(w, "%-30s %-30s %-40s %10s  %s\n", "COMPONENT", "KIND", "NAME", "SIZE", "NOTE")
+	for _, s := range sizes {
+		o := s.object
+		name := o.GetName()
+		if o.GetNamespace() != "" {
+			name = o.GetNamespace() + "/" + name
+		}
+		fmt.Fprintf(w, "%-30s %-30s %-40s %10s  %s\n", o.Component(), o.GetObjectKind().GroupVersionKind().Kind, name, formatSize(s.size), s.note)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-30s %8s %10s  %s\n", "COMPONENT", "OBJECTS", "SIZE", "NOTE")
+	total := 0
+	for _, c := range components {
+		note := ""
+		if b.MaxComponentSize > 0 && totals[c] > b.MaxComponentSize {
+			note = fmt.Sprintf("exceeds budget of %s", formatSize(b.MaxComponentSize))
+			exceeded++
+		}
+		fmt.Fprintf(w, "%-30s %8d %10s  %s\n", c, counts[c], formatSize(totals[c]), note)
+		total += totals[c]
+	}
+	fmt.Fprintf(w, "%-30s %8d %10s\n", "TOTAL", len(objects), formatSize(total))
+	if exceeded > 0 {
+		return fmt.Errorf("%d object(s) or component(s) exceed size limits", exceeded)
+	}
+	return nil
+}
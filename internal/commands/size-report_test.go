@@ -0,0 +1,74 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSize(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("512 B", formatSize(512))
+	a.Equal("1.5 KiB", formatSize(1536))
+	a.Equal("2.0 MiB", formatSize(2*1024*1024))
+}
+
+func TestSizeReport(t *testing.T) {
+	configMap := func(name string, size int) model.K8sLocalObject {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "ns1"},
+			"data":       map[string]interface{}{"foo": strings.Repeat("x", size)},
+		}, "app", "c1", "dev")
+	}
+	objects := []model.K8sLocalObject{
+		configMap("small", 10),
+		configMap("huge", maxConfigDataSize),
+		model.NewK8sLocalObject(deployment("web", 1, nil), "app", "c2", "dev"),
+	}
+
+	var buf bytes.Buffer
+	err := showSizeReport(&buf, objects, nil)
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 object(s) or component(s) exceed size limits", err.Error())
+	lines := strings.Split(buf.String(), "\n")
+	a.Regexp(regexp.MustCompile(`^c1\s+ConfigMap\s+ns1/huge\s+1\.0 MiB\s+exceeds cluster limit of 1\.0 MiB$`), lines[1])
+	a.Regexp(regexp.MustCompile(`^c1\s+ConfigMap\s+ns1/small\s+\d+ B\s*$`), lines[2])
+	a.Regexp(regexp.MustCompile(`^c2\s+Deployment\s+quota-ns/web\s+\d+ B\s*$`), lines[3])
+	a.Regexp(regexp.MustCompile(`^c1\s+2\s+1\.0 MiB\s*$`), lines[6])
+	a.Regexp(regexp.MustCompile(`^TOTAL\s+3\s+1\.0 MiB$`), lines[8])
+
+	buf.Reset()
+	err = showSizeReport(&buf, objects[:1], &model.SizeBudgets{MaxObjectSize: 50, MaxComponentSize: 60})
+	require.NotNil(t, err)
+	a.Equal("2 object(s) or component(s) exceed size limits", err.Error())
+	a.Regexp(regexp.MustCompile(`ns1/small\s+\d+ B\s+exceeds budget of 50 B`), buf.String())
+	a.Regexp(regexp.MustCompile(`c1\s+1\s+\d+ B\s+exceeds budget of 60 B`), buf.String())
+
+	buf.Reset()
+	err = showSizeReport(&buf, objects[:1], &model.SizeBudgets{MaxObjectSize: 1024})
+	require.Nil(t, err)
+}
@@ -0,0 +1,214 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// columns of status tables in addition to object columns
+const (
+	colPipeline = "pipeline"
+	colRunURL   = "run-url"
+	colPlanHash = "plan-hash"
+)
+
+var statusColumns = []string{colComponent, colKind, colNamespace, colName, colPipeline, colRunURL, colPlanHash}
+
+// applyStamp has the details of the deploy that are recorded on objects changed by an apply, such that live
+// objects can be correlated to the CI run that last changed them.
+type applyStamp struct {
+	runURL     string
+	pipelineID string
+	planHash   string
+}
+
+// annotations returns the annotations to stamp objects with, nil if no details were supplied.
+func (s applyStamp) annotations() map[string]string {
+	ret := map[string]string{}
+	for k, v := range map[string]string{
+		model.QbecNames.RunURLAnnotation:     s.runURL,
+		model.QbecNames.PipelineIDAnnotation: s.pipelineID,
+		model.QbecNames.PlanHashAnnotation:   s.planHash,
+	} {
+		if v != "" {
+			ret[k] = v
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// addApplyStampFlags adds flags for the deploy details to stamp on changed objects, defaulting them from the environment.
+func addApplyStampFlags(cmd *cobra.Command, s *applyStamp) {
+	cmd.Flags().StringVar(&s.runURL, "run-url", os.Getenv("QBEC_RUN_URL"), "record this CI run URL on created and updated objects (from QBEC_RUN_URL)")
+	cmd.Flags().StringVar(&s.pipelineID, "pipeline-id", os.Getenv("QBEC_PIPELINE_ID"), "record this pipeline id on created and updated objects (from QBEC_PIPELINE_ID)")
+	cmd.Flags().StringVar(&s.planHash, "plan-hash", os.Getenv("QBEC_PLAN_HASH"), "record this plan hash on created and updated objects (from QBEC_PLAN_HASH)")
+}
+
+// objectStatus has the deploy details recorded on a live object.
+type objectStatus struct {
+	Component  string `json:"component"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	PipelineID string `json:"pipelineId,omitempty"`
+	RunURL     string `json:"runUrl,omitempty"`
+	PlanHash   string `json:"planHash,omitempty"`
+}
+
+// annotated is implemented by listed objects, which carry the annotations of their live versions that commands need.
+type annotated interface {
+	GetAnnotations() map[string]string
+}
+
+type statusCommandConfig struct {
+	StdOptions
+	format         string
+	columns        []string
+	filterFunc     func() (filterParams, error)
+	clientProvider func(env string) (listClient, error)
+}
+
+func doStatus(args []string, config statusCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	env := args[0]
+	if env == model.Baseline {
+		return newUsageError("cannot show status for baseline environment, use a real environment")
+	}
+	if _, ok := config.App().Spec.Environments[env]; !ok {
+		return newUsageError(fmt.Sprintf("invalid environment %q", env))
+	}
+	switch config.format {
+	case "", "json", "yaml":
+	default:
+		return newUsageError(fmt.Sprintf("invalid output format: %q", config.format))
+	}
+	if len(config.columns) > 0 && config.format != "" {
+		return newUsageError("--columns can only be used with the table format")
+	}
+	columns, err := tableColumns(config.columns, statusColumns)
+	if err != nil {
+		return err
+	}
+	fp, err := config.filterFunc()
+	if err != nil {
+		return err
+	}
+	client, err := config.clientProvider(env)
+	if err != nil {
+		return err
+	}
+	all, err := allObjects(config, env)
+	if err != nil {
+		return err
+	}
+	cf, _ := model.NewComponentFilter(fp.includes, fp.excludes)
+	scope, _ := listScope(client, all, config.DefaultNamespace(env))
+	list, err := client.ListExtraObjects(nil, remote.ListQueryConfig{
+		Application:     config.App().Name(),
+		Environment:     env,
+		KindFilter:      fp.kindFilter,
+		LabelSelector:   fp.selectorString(),
+		ComponentFilter: cf,
+		ListQueryScope:  scope,
+	})
+	if err != nil {
+		return err
+	}
+
+	var rows []tableRow
+	for _, o := range list {
+		var anns map[string]string
+		if a, ok := o.(annotated); ok {
+			anns = a.GetAnnotations()
+		}
+		row := objectRow(o, "")
+		row[colPipeline] = anns[model.QbecNames.PipelineIDAnnotation]
+		row[colRunURL] = anns[model.QbecNames.RunURLAnnotation]
+		row[colPlanHash] = anns[model.QbecNames.PlanHashAnnotation]
+		rows = append(rows, row)
+	}
+	sortRows(rows)
+	if len(rows) == 0 {
+		sio.Noticef("no live objects found for environment %s\n", env)
+	}
+
+	w := config.Stdout()
+	if config.format == "" {
+		return writeTable(w, columns, rows, terminalWidth())
+	}
+	statuses := []objectStatus{}
+	for _, r := range rows {
+		statuses = append(statuses, objectStatus{
+			Component:  r[colComponent],
+			Kind:       r[colKind],
+			Namespace:  r[colNamespace],
+			Name:       r[colName],
+			PipelineID: r[colPipeline],
+			RunURL:     r[colRunURL],
+			PlanHash:   r[colPlanHash],
+		})
+	}
+	if config.format == "yaml" {
+		b, err := yaml.Marshal(statuses)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+func newStatusCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status <environment>",
+		Short:   "list live objects of an environment with the details of the deploys that last changed them",
+		Example: statusExamples(),
+	}
+
+	config := statusCommandConfig{
+		clientProvider: func(env string) (listClient, error) {
+			return op().Client(env)
+		},
+		filterFunc: addFilterParams(cmd, op, true),
+	}
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable output instead of a table")
+	addColumnsFlag(cmd, &config.columns, statusColumns)
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doStatus(args, config))
+	}
+	return cmd
+}
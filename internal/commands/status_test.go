@@ -0,0 +1,173 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func stampedConfigMap(name string, anns map[string]interface{}) model.K8sLocalObject {
+	return model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   "default",
+			"annotations": anns,
+		},
+	}, "example1", "service2", "dev")
+}
+
+func TestApplyStampAnnotations(t *testing.T) {
+	a := assert.New(t)
+	a.Nil(applyStamp{}.annotations())
+	a.Equal(map[string]string{
+		model.QbecNames.RunURLAnnotation:   "https://ci/run/1",
+		model.QbecNames.PlanHashAnnotation: "abc",
+	}, applyStamp{runURL: "https://ci/run/1", planHash: "abc"}.annotations())
+}
+
+func TestStatus(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setLiveObjects(s, map[string][]model.K8sLocalObject{
+		"dev": {
+			stampedConfigMap("stamped", map[string]interface{}{
+				model.QbecNames.RunURLAnnotation:     "https://ci/run/42",
+				model.QbecNames.PipelineIDAnnotation: "p-7",
+				model.QbecNames.PlanHashAnnotation:   "abc123",
+			}),
+			stampedConfigMap("plain", nil),
+		},
+	})
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, fmt.Errorf("status should use the listed objects, got a get for %s", obj.GetName())
+	}
+	err := s.executeCommand("status", "dev")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^COMPONENT\s+KIND\s+NAMESPACE\s+NAME\s+PIPELINE\s+RUN-URL\s+PLAN-HASH$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^service2\s+ConfigMap\s+default\s+stamped\s+p-7\s+https://ci/run/42\s+abc123$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^service2\s+ConfigMap\s+default\s+plain\s*$`))
+}
+
+func TestStatusFormats(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setLiveObjects(s, map[string][]model.K8sLocalObject{
+		"dev": {stampedConfigMap("stamped", map[string]interface{}{model.QbecNames.RunURLAnnotation: "https://ci/run/42"})},
+	})
+	err := s.executeCommand("status", "dev", "-o", "json")
+	require.Nil(t, err)
+	var out []map[string]interface{}
+	require.Nil(t, s.jsonOutput(&out))
+	require.Equal(t, 1, len(out))
+	a := assert.New(t)
+	a.Equal("stamped", out[0]["name"])
+	a.Equal("https://ci/run/42", out[0]["runUrl"])
+	a.NotContains(out[0], "pipelineId")
+}
+
+func TestStatusColumns(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	setLiveObjects(s, map[string][]model.K8sLocalObject{
+		"dev": {stampedConfigMap("stamped", map[string]interface{}{model.QbecNames.RunURLAnnotation: "https://ci/run/42"})},
+	})
+	err := s.executeCommand("status", "dev", "--columns", "name,run-url")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^NAME\s+RUN-URL$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^stamped\s+https://ci/run/42$`))
+}
+
+func TestStatusNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		asserter func(s *scaffold, err error)
+	}{
+		{
+			name: "no env",
+			args: []string{"status"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("exactly one environment required", err.Error())
+			},
+		},
+		{
+			name: "baseline",
+			args: []string{"status", "_"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("cannot show status for baseline environment, use a real environment", err.Error())
+			},
+		},
+		{
+			name: "bad env",
+			args: []string{"status", "foo"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid environment "foo"`, err.Error())
+			},
+		},
+		{
+			name: "bad format",
+			args: []string{"status", "dev", "-o", "table"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid output format: "table"`, err.Error())
+			},
+		},
+		{
+			name: "columns with format",
+			args: []string{"status", "dev", "-o", "json", "--columns", "name"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal("--columns can only be used with the table format", err.Error())
+			},
+		},
+		{
+			name: "bad column",
+			args: []string{"status", "dev", "--columns", "change"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Contains(err.Error(), `invalid column "change"`)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			test.asserter(s, err)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+)
+
+// columns of object tables
+const (
+	colComponent = "component"
+	colKind      = "kind"
+	colNamespace = "namespace"
+	colName      = "name"
+	colChange    = "change"
+)
+
+var (
+	objectColumns = []string{colComponent, colKind, colNamespace, colName}
+	changeColumns = []string{colComponent, colKind, colNamespace, colName, colChange}
+)
+
+// minColumnWidth is the width below which columns are not truncated to fit the terminal.
+const minColumnWidth = 8
+
+// terminalWidth returns the width of the terminal that standard output is written to, or 0 if it is not a terminal.
+var terminalWidth = func() int {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		return 0
+	}
+	return readline.GetScreenWidth()
+}
+
+// tableRow is a row of an object table keyed by column.
+type tableRow map[string]string
+
+// objectRow returns the table row for the supplied object with the supplied change, if any.
+func objectRow(o model.K8sQbecMeta, change string) tableRow {
+	return tableRow{
+		colComponent: o.Component(),
+		colKind:      o.GetObjectKind().GroupVersionKind().Kind,
+		colNamespace: o.GetNamespace(),
+		colName:      o.GetName(),
+		colChange:    change,
+	}
+}
+
+// sortRows sorts the supplied rows by component, kind, namespace and name.
+func sortRows(rows []tableRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, c := range objectColumns {
+			if rows[i][c] != rows[j][c] {
+				return rows[i][c] < rows[j][c]
+			}
+		}
+		return false
+	})
+}
+
+// tableColumns returns the columns of a table from the supplied list, the allowed columns when it is empty.
+func tableColumns(selected []string, allowed []string) ([]string, error) {
+	if len(selected) == 0 {
+		return allowed, nil
+	}
+	valid := map[string]bool{}
+	for _, c := range allowed {
+		valid[c] = true
+	}
+	var ret []string
+	for _, c := range selected {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !valid[c] {
+			return nil, newUsageError(fmt.Sprintf("invalid column %q, must be one of %s", c, strings.Join(allowed, ", ")))
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// addColumnsFlag adds a flag to the supplied command to select the columns of table output.
+func addColumnsFlag(cmd *cobra.Command, target *[]string, allowed []string) {
+	cmd.Flags().StringSliceVar(target, "columns", nil, fmt.Sprintf("comma-separated columns of table output, from %s", strings.Join(allowed, ", ")))
+}
+
+// truncate returns the supplied string shortened to the supplied width.
+func truncate(s string, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	return s[:width-3] + "..."
+}
+
+// writeTable writes the supplied rows as a table with the supplied columns in a single write. When the width is
+// positive, the widest columns are truncated such that lines fit into it.
+func writeTable(w io.Writer, columns []string, rows []tableRow, width int) error {
+	widths := make([]int, len(columns))
+	for i, c := range columns {
+		widths[i] = len(c)
+		for _, r := range rows {
+			if l := len(r[c]); l > widths[i] {
+				widths[i] = l
+			}
+		}
+	}
+	if width > 0 {
+		total := func() int {
+			n := len(widths) - 1 // separators
+			for _, cw := range widths {
+				n += cw
+			}
+			return n
+		}
+		for total() > width {
+			widest := 0
+			for i := range widths {
+				if widths[i] > widths[widest] {
+					widest = i
+				}
+			}
+			if widths[widest] <= minColumnWidth {
+				break
+			}
+			widths[widest]--
+		}
+	}
+	var buf bytes.Buffer
+	line := func(values []string) {
+		for i, v := range values {
+			v = truncate(v, widths[i])
+			if i == len(values)-1 {
+				buf.WriteString(v)
+				break
+			}
+			fmt.Fprintf(&buf, "%-*s ", widths[i], v)
+		}
+		buf.WriteString("\n")
+	}
+	var header []string
+	for _, c := range columns {
+		header = append(header, strings.ToUpper(c))
+	}
+	line(header)
+	for _, r := range rows {
+		var values []string
+		for _, c := range columns {
+			values = append(values, r[c])
+		}
+		line(values)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
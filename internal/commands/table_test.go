@@ -0,0 +1,65 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTable(t *testing.T) {
+	rows := []tableRow{
+		{colKind: "ConfigMap", colName: "a-very-long-config-map-name", colChange: "added"},
+		{colKind: "Secret", colName: "s1", colChange: "changed"},
+	}
+	columns := []string{colKind, colName, colChange}
+	var buf bytes.Buffer
+	require.Nil(t, writeTable(&buf, columns, rows, 0))
+	assert.Equal(t, `KIND      NAME                        CHANGE
+ConfigMap a-very-long-config-map-name added
+Secret    s1                          changed
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, writeTable(&buf, columns, rows, 30))
+	assert.Equal(t, `KIND      NAME         CHANGE
+ConfigMap a-very-lo... added
+Secret    s1           changed
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, writeTable(&buf, columns, rows, 5))
+	assert.Equal(t, `KIND     NAME     CHANGE
+Confi... a-ver... added
+Secret   s1       changed
+`, buf.String())
+}
+
+func TestTableColumns(t *testing.T) {
+	cols, err := tableColumns(nil, objectColumns)
+	require.Nil(t, err)
+	assert.Equal(t, objectColumns, cols)
+	cols, err = tableColumns([]string{"Name", " kind"}, objectColumns)
+	require.Nil(t, err)
+	assert.Equal(t, []string{colName, colKind}, cols)
+	_, err = tableColumns([]string{"age"}, objectColumns)
+	require.NotNil(t, err)
+	assert.True(t, isUsageError(err))
+}
@@ -0,0 +1,3 @@
+package qbec.policies.bad
+
+deny = "not a set"
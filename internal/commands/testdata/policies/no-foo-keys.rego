@@ -0,0 +1,14 @@
+# config maps must not have a foo key, and every object should have a team label
+package qbec.policies.keys
+
+deny[msg] {
+	input.kind == "ConfigMap"
+	_ = input.data[k]
+	k == "foo"
+	msg := sprintf("key %s is not allowed in environment %s", [k, data.qbec.env])
+}
+
+warn[msg] {
+	not input.metadata.labels.team
+	msg := "missing required label team"
+}
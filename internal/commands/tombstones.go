@@ -0,0 +1,243 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// defaultMaxTombstones is the number of deleted objects that are kept when the app does not set a max.
+const defaultMaxTombstones = 500
+
+const (
+	colDeletedAt = "deleted-at"
+	colCommand   = "command"
+)
+
+var deletedColumns = []string{colDeletedAt, colCommand, colComponent, colKind, colNamespace, colName, colPipeline, colRunURL}
+
+// tombstoneLocation returns the namespace and name of the config map that has the tombstones of the supplied
+// environment, along with the max number of tombstones to keep. It returns false when the app does not record
+// tombstones.
+func tombstoneLocation(opts StdOptions, env string) (namespace, name string, max int, ok bool) {
+	ts := opts.App().Spec.Tombstones
+	if ts == nil {
+		return "", "", 0, false
+	}
+	namespace = ts.Namespace
+	if namespace == "" {
+		namespace = opts.DefaultNamespace(env)
+	}
+	max = ts.MaxEntries
+	if max <= 0 {
+		max = defaultMaxTombstones
+	}
+	return namespace, fmt.Sprintf("qbec-tombstones-%s-%s", opts.App().Name(), env), max, true
+}
+
+// tombstoneClient is the remote interface needed to record deleted objects.
+type tombstoneClient interface {
+	RecordTombstones(namespace, name string, tombstones []remote.Tombstone, max int) error
+}
+
+// tombstones collects the objects deleted by a command, to record them in the tombstones config map of the
+// environment. A nil value does not record anything and is returned when the app does not record tombstones.
+type tombstones struct {
+	namespace string
+	name      string
+	max       int
+	command   string
+	stamp     applyStamp
+	list      []remote.Tombstone
+}
+
+// newTombstones returns the tombstones for objects deleted by the supplied command, nil if the app does not record
+// tombstones.
+func newTombstones(opts StdOptions, env, command string, stamp applyStamp) *tombstones {
+	namespace, name, max, ok := tombstoneLocation(opts, env)
+	if !ok {
+		return nil
+	}
+	return &tombstones{namespace: namespace, name: name, max: max, command: command, stamp: stamp}
+}
+
+// add adds a tombstone for the supplied object that was deleted.
+func (t *tombstones) add(ob model.K8sQbecMeta) {
+	if t == nil {
+		return
+	}
+	t.list = append(t.list, remote.Tombstone{
+		Kind:       ob.GetKind(),
+		Namespace:  ob.GetNamespace(),
+		Name:       ob.GetName(),
+		Component:  ob.Component(),
+		DeletedAt:  time.Now().UTC(),
+		Command:    t.command,
+		RunURL:     t.stamp.runURL,
+		PipelineID: t.stamp.pipelineID,
+	})
+}
+
+// record records the tombstones that were added. Failures are reported as warnings since the objects were deleted
+// regardless.
+func (t *tombstones) record(client tombstoneClient) {
+	if t == nil || len(t.list) == 0 {
+		return
+	}
+	if err := client.RecordTombstones(t.namespace, t.name, t.list, t.max); err != nil {
+		sio.Warnf("unable to record %d deleted object(s) in config map %s/%s: %v\n", len(t.list), t.namespace, t.name, err)
+		return
+	}
+	sio.Debugf("recorded %d deleted object(s) in config map %s/%s\n", len(t.list), t.namespace, t.name)
+}
+
+// addTombstoneFlags adds flags for the deploy details recorded with deleted objects, defaulting them from the
+// environment.
+func addTombstoneFlags(cmd *cobra.Command, s *applyStamp) {
+	cmd.Flags().StringVar(&s.runURL, "run-url", os.Getenv("QBEC_RUN_URL"), "record this CI run URL with deleted objects, when the app records them (from QBEC_RUN_URL)")
+	cmd.Flags().StringVar(&s.pipelineID, "pipeline-id", os.Getenv("QBEC_PIPELINE_ID"), "record this pipeline id with deleted objects, when the app records them (from QBEC_PIPELINE_ID)")
+}
+
+// deletedClient is the remote interface needed to list deleted objects.
+type deletedClient interface {
+	Tombstones(namespace, name string) ([]remote.Tombstone, error)
+}
+
+type deletedCommandConfig struct {
+	StdOptions
+	format         string
+	columns        []string
+	since          time.Duration
+	clientProvider func(env string) (deletedClient, error)
+}
+
+func doDeleted(args []string, config deletedCommandConfig) error {
+	if len(args) != 1 {
+		return newUsageError("exactly one environment required")
+	}
+	env := args[0]
+	if env == model.Baseline {
+		return newUsageError("cannot list deleted objects for baseline environment, use a real environment")
+	}
+	if _, ok := config.App().Spec.Environments[env]; !ok {
+		return newUsageError(fmt.Sprintf("invalid environment %q", env))
+	}
+	switch config.format {
+	case "", "json", "yaml":
+	default:
+		return newUsageError(fmt.Sprintf("invalid output format: %q", config.format))
+	}
+	if len(config.columns) > 0 && config.format != "" {
+		return newUsageError("--columns can only be used with the table format")
+	}
+	if config.since < 0 {
+		return newUsageError(fmt.Sprintf("invalid duration %v for --since, must not be negative", config.since))
+	}
+	columns, err := tableColumns(config.columns, deletedColumns)
+	if err != nil {
+		return err
+	}
+	namespace, name, _, ok := tombstoneLocation(config, env)
+	if !ok {
+		return newUsageError("the app does not record deleted objects, set tombstones in qbec.yaml to record them")
+	}
+	client, err := config.clientProvider(env)
+	if err != nil {
+		return err
+	}
+	all, err := client.Tombstones(namespace, name)
+	if err != nil {
+		return err
+	}
+	list := []remote.Tombstone{}
+	for _, t := range all {
+		if config.since > 0 && time.Since(t.DeletedAt) > config.since {
+			continue
+		}
+		list = append(list, t)
+	}
+	// newest first
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].DeletedAt.After(list[j].DeletedAt)
+	})
+	if len(list) == 0 {
+		sio.Noticef("no deleted objects recorded for environment %s\n", env)
+	}
+
+	w := config.Stdout()
+	switch config.format {
+	case "yaml":
+		b, err := yaml.Marshal(list)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	}
+	var rows []tableRow
+	for _, t := range list {
+		rows = append(rows, tableRow{
+			colDeletedAt: t.DeletedAt.Format(time.RFC3339),
+			colCommand:   t.Command,
+			colComponent: t.Component,
+			colKind:      t.Kind,
+			colNamespace: t.Namespace,
+			colName:      t.Name,
+			colPipeline:  t.PipelineID,
+			colRunURL:    t.RunURL,
+		})
+	}
+	return writeTable(w, columns, rows, terminalWidth())
+}
+
+func newDeletedCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "deleted <environment>",
+		Short:   "list objects of an environment that were deleted by apply or delete, newest first",
+		Example: deletedExamples(),
+	}
+
+	config := deletedCommandConfig{
+		clientProvider: func(env string) (deletedClient, error) {
+			return op().Client(env)
+		},
+	}
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable output instead of a table")
+	cmd.Flags().DurationVar(&config.since, "since", 0, "only list objects deleted within this duration, e.g. 24h")
+	addColumnsFlag(cmd, &config.columns, deletedColumns)
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doDeleted(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,201 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type recordedTombstones struct {
+	namespace  string
+	name       string
+	max        int
+	tombstones []remote.Tombstone
+}
+
+func recordTombstones(s *scaffold) *recordedTombstones {
+	var rec recordedTombstones
+	s.opts.client.recordFunc = func(namespace, name string, tombstones []remote.Tombstone, max int) error {
+		rec.namespace, rec.name, rec.max = namespace, name, max
+		rec.tombstones = append(rec.tombstones, tombstones...)
+		return nil
+	}
+	return &rec
+}
+
+func TestDeleteTombstones(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Tombstones = &model.Tombstones{}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		if obj.GetName() == "svc2-secret" {
+			return &remote.SyncResult{Type: remote.SyncSkip, Details: "object not found on the server"}, nil
+		}
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	rec := recordTombstones(s)
+	err := s.executeCommand("delete", "dev", "--local", "-c", "service2", "--run-url", "https://ci/run/42")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal("default", rec.namespace)
+	a.Equal("qbec-tombstones-example1-dev", rec.name)
+	a.Equal(defaultMaxTombstones, rec.max)
+	require.Equal(t, 1, len(rec.tombstones))
+	ts := rec.tombstones[0]
+	a.Equal("ConfigMap", ts.Kind)
+	a.Equal("bar-system", ts.Namespace)
+	a.Equal("svc2-cm", ts.Name)
+	a.Equal("service2", ts.Component)
+	a.Equal("delete", ts.Command)
+	a.Equal("https://ci/run/42", ts.RunURL)
+	a.False(ts.DeletedAt.IsZero())
+}
+
+func TestDeleteTombstonesDryRun(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Tombstones = &model.Tombstones{}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return obj.(model.K8sLocalObject).ToUnstructured(), nil
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	rec := recordTombstones(s)
+	err := s.executeCommand("delete", "dev", "--local", "-c", "service2", "-n")
+	require.Nil(t, err)
+	assert.Nil(t, rec.tombstones)
+}
+
+func TestApplyTombstones(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Tombstones = &model.Tombstones{Namespace: "qbec", MaxEntries: 20}
+	s.opts.client.listExtraFunc = func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+		return []model.K8sQbecMeta{stampedConfigMap("old", nil)}, nil
+	}
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical}, nil
+	}
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		return nil, remote.ErrNotFound
+	}
+	s.opts.client.deleteFunc = func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+		return &remote.SyncResult{Type: remote.SyncDeleted}, nil
+	}
+	s.opts.client.recordFunc = func(namespace, name string, tombstones []remote.Tombstone, max int) error {
+		return errors.New("forbidden")
+	}
+	err := s.executeCommand("apply", "dev", "--pipeline-id", "p-7")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`unable to record 1 deleted object\(s\) in config map qbec/qbec-tombstones-example1-dev: forbidden`))
+
+	rec := recordTombstones(s)
+	err = s.executeCommand("apply", "dev", "--pipeline-id", "p-7")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal("qbec", rec.namespace)
+	a.Equal(20, rec.max)
+	require.Equal(t, 1, len(rec.tombstones))
+	a.Equal("old", rec.tombstones[0].Name)
+	a.Equal("apply", rec.tombstones[0].Command)
+	a.Equal("p-7", rec.tombstones[0].PipelineID)
+}
+
+func deletedScaffold(t *testing.T) *scaffold {
+	s := newScaffold(t)
+	s.opts.app.Spec.Tombstones = &model.Tombstones{}
+	now := time.Now().UTC()
+	s.opts.client.tombstonesFunc = func(namespace, name string) ([]remote.Tombstone, error) {
+		if namespace != "default" || name != "qbec-tombstones-example1-dev" {
+			return nil, nil
+		}
+		return []remote.Tombstone{
+			{Kind: "ConfigMap", Namespace: "bar-system", Name: "cm-old", Component: "service2", Command: "delete", DeletedAt: now.Add(-48 * time.Hour)},
+			{Kind: "Secret", Namespace: "bar-system", Name: "s-new", Component: "service2", Command: "apply", DeletedAt: now.Add(-time.Hour), RunURL: "https://ci/run/42"},
+		}, nil
+	}
+	return s
+}
+
+func TestDeleted(t *testing.T) {
+	s := deletedScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("deleted", "dev", "--columns", "command,kind,name,run-url")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^COMMAND\s+KIND\s+NAME\s+RUN-URL$`))
+	a := assert.New(t)
+	a.Regexp(`(?s)apply\s+Secret\s+s-new\s+https://ci/run/42\s*\ndelete\s+ConfigMap\s+cm-old`, s.stdout())
+}
+
+func TestDeletedSince(t *testing.T) {
+	s := deletedScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("deleted", "dev", "--since", "24h", "-o", "json")
+	require.Nil(t, err)
+	var out []map[string]interface{}
+	require.Nil(t, s.jsonOutput(&out))
+	require.Equal(t, 1, len(out))
+	assert.Equal(t, "s-new", out[0]["name"])
+}
+
+func TestDeletedNone(t *testing.T) {
+	s := deletedScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("deleted", "prod", "-o", "yaml")
+	require.Nil(t, err)
+	s.assertErrorLineMatch(regexp.MustCompile(`no deleted objects recorded for environment prod`))
+}
+
+func TestDeletedNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		errorMsg string
+	}{
+		{name: "no env", args: []string{"deleted"}, errorMsg: "exactly one environment required"},
+		{name: "baseline", args: []string{"deleted", "_"}, errorMsg: "cannot list deleted objects for baseline environment, use a real environment"},
+		{name: "bad env", args: []string{"deleted", "foo"}, errorMsg: `invalid environment "foo"`},
+		{name: "bad format", args: []string{"deleted", "dev", "-o", "table"}, errorMsg: `invalid output format: "table"`},
+		{name: "columns with format", args: []string{"deleted", "dev", "-o", "json", "--columns", "name"}, errorMsg: "--columns can only be used with the table format"},
+		{name: "negative since", args: []string{"deleted", "dev", "--since", "-1h"}, errorMsg: "invalid duration -1h0m0s for --since, must not be negative"},
+		{name: "not recorded", args: []string{"deleted", "dev"}, errorMsg: "the app does not record deleted objects, set tombstones in qbec.yaml to record them"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newScaffold(t)
+			defer s.reset()
+			err := s.executeCommand(test.args...)
+			require.NotNil(t, err)
+			a := assert.New(t)
+			a.True(isUsageError(err))
+			a.Equal(test.errorMsg, err.Error())
+		})
+	}
+}
@@ -43,12 +43,23 @@ import (
 )
 
 type client struct {
-	nsFunc        func(kind schema.GroupVersionKind) (bool, error)
-	getFunc       func(obj model.K8sMeta) (*unstructured.Unstructured, error)
-	syncFunc      func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error)
-	validatorFunc func(gvk schema.GroupVersionKind) (remote.Validator, error)
-	listExtraFunc func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error)
-	deleteFunc    func(obj model.K8sMeta, dryRun bool) (*remote.SyncResult, error)
+	nsFunc          func(kind schema.GroupVersionKind) (bool, error)
+	getFunc         func(obj model.K8sMeta) (*unstructured.Unstructured, error)
+	syncFunc        func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error)
+	validatorFunc   func(gvk schema.GroupVersionKind) (remote.Validator, error)
+	defaultsFunc    func(obj *unstructured.Unstructured) ([]remote.FieldDefault, error)
+	listExtraFunc   func(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error)
+	deleteFunc      func(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error)
+	metadataFunc    func(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error)
+	hashesFunc      func(scope remote.ListQueryConfig) (remote.ObjectHashes, error)
+	listObjectsFunc func(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+	recordFunc      func(namespace, name string, tombstones []remote.Tombstone, max int) error
+	tombstonesFunc  func(namespace, name string) ([]remote.Tombstone, error)
+	inventoryFunc   func(namespace, name string) ([]string, error)
+	recordInvFunc   func(namespace, name string, components []string) error
+	impersonateFunc func(user string, groups []string) (Client, error)
+	versionFunc     func() (string, error)
+	canIFunc        func(verb string, gvk schema.GroupVersionKind, namespace string) (bool, string, error)
 }
 
 func (c *client) DisplayName(o model.K8sMeta) string {
@@ -86,6 +97,13 @@ func (c *client) ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, er
 	return nil, errors.New("not implemented")
 }
 
+func (c *client) FieldDefaults(obj *unstructured.Unstructured) ([]remote.FieldDefault, error) {
+	if c.defaultsFunc != nil {
+		return c.defaultsFunc(obj)
+	}
+	return nil, errors.New("not implemented")
+}
+
 func (c *client) ListExtraObjects(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
 	if c.listExtraFunc != nil {
 		return c.listExtraFunc(ignore, scope)
@@ -93,13 +111,83 @@ func (c *client) ListExtraObjects(ignore []model.K8sQbecMeta, scope remote.ListQ
 	return nil, errors.New("not implemented")
 }
 
-func (c *client) Delete(obj model.K8sMeta, dryRun bool) (*remote.SyncResult, error) {
+func (c *client) Delete(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
 	if c.deleteFunc != nil {
-		return c.deleteFunc(obj, dryRun)
+		return c.deleteFunc(obj, opts)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (c *client) UpdateMetadata(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error) {
+	if c.metadataFunc != nil {
+		return c.metadataFunc(obj, labels, annotations, dryRun)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (c *client) ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	if c.listObjectsFunc != nil {
+		return c.listObjectsFunc(gvk, namespace)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (c *client) RenderHashes(scope remote.ListQueryConfig) (remote.ObjectHashes, error) {
+	if c.hashesFunc != nil {
+		return c.hashesFunc(scope)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (c *client) RecordTombstones(namespace, name string, tombstones []remote.Tombstone, max int) error {
+	if c.recordFunc != nil {
+		return c.recordFunc(namespace, name, tombstones, max)
+	}
+	return errors.New("not implemented")
+}
+
+func (c *client) Tombstones(namespace, name string) ([]remote.Tombstone, error) {
+	if c.tombstonesFunc != nil {
+		return c.tombstonesFunc(namespace, name)
 	}
 	return nil, errors.New("not implemented")
 }
 
+func (c *client) Inventory(namespace, name string) ([]string, error) {
+	if c.inventoryFunc != nil {
+		return c.inventoryFunc(namespace, name)
+	}
+	return nil, nil
+}
+
+func (c *client) RecordInventory(namespace, name string, components []string) error {
+	if c.recordInvFunc != nil {
+		return c.recordInvFunc(namespace, name, components)
+	}
+	return nil
+}
+
+func (c *client) Impersonate(user string, groups []string) (Client, error) {
+	if c.impersonateFunc != nil {
+		return c.impersonateFunc(user, groups)
+	}
+	return c, nil
+}
+
+func (c *client) ServerVersion() (string, error) {
+	if c.versionFunc != nil {
+		return c.versionFunc()
+	}
+	return "", errors.New("not implemented")
+}
+
+func (c *client) CanI(verb string, gvk schema.GroupVersionKind, namespace string) (bool, string, error) {
+	if c.canIFunc != nil {
+		return c.canIFunc(verb, gvk, namespace)
+	}
+	return false, "", errors.New("not implemented")
+}
+
 type opts struct {
 	app       *model.App
 	client    *client
@@ -107,6 +195,8 @@ type opts struct {
 	verbosity int
 	out       io.Writer
 	defaultNs string
+	confirms  []string                           // messages of confirmations
+	contexts  map[string]*remote.ResolvedContext // resolved kubeconfig contexts keyed by environment
 }
 
 func (o *opts) App() *model.App {
@@ -129,7 +219,9 @@ func (o *opts) Verbosity() int {
 
 func (o *opts) SortConfig(provider objsort.Namespaced) objsort.Config {
 	return objsort.Config{
-		NamespacedIndicator: provider,
+		OrderingProvider:      objsort.KindOrdering(o.app.ApplyOrders()),
+		ComponentDependencies: o.app.ComponentDependencies(),
+		NamespacedIndicator:   provider,
 	}
 }
 
@@ -144,11 +236,20 @@ func (o *opts) Client(env string) (Client, error) {
 	return o.client, nil
 }
 
+func (o *opts) ResolveContext(env string) (*remote.ResolvedContext, error) {
+	rc, ok := o.contexts[env]
+	if !ok {
+		return nil, fmt.Errorf("no context for env %s", env)
+	}
+	return rc, nil
+}
+
 func (o *opts) Stdout() io.Writer {
 	return o.out
 }
 
 func (o *opts) Confirm(msg string) error {
+	o.confirms = append(o.confirms, msg)
 	fmt.Fprintln(os.Stderr, msg)
 	return nil
 }
@@ -273,7 +374,13 @@ func (s *scaffold) outputStats() map[string]interface{} {
 }
 
 func newScaffold(t *testing.T) *scaffold {
-	reset := setPwd(t, "../../examples/test-app")
+	return newScaffoldIn(t, "../../examples/test-app")
+}
+
+// newScaffoldIn returns a scaffold for the app in the supplied directory, for tests that need objects that the
+// example app does not have.
+func newScaffoldIn(t *testing.T, dir string) *scaffold {
+	reset := setPwd(t, dir)
 	app, err := model.NewApp("qbec.yaml")
 	require.Nil(t, err)
 	out := bytes.NewBuffer(nil)
@@ -0,0 +1,279 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// name of the check that validates objects against the schemas of their kinds
+const checkSchema = "schema"
+
+// validateInput is what the checks of validate operate on.
+type validateInput struct {
+	config    validateCommandConfig
+	env       string
+	objects   []model.K8sLocalObject
+	client    validateClient
+	validator *validator // records and prints the results of the schema check
+}
+
+// validateCheck is a named check of validate. Enabled checks run concurrently, each returning its own findings for
+// the objects being validated.
+type validateCheck struct {
+	name    string
+	live    bool                                    // needs live objects of the cluster
+	enabled func(config validateCommandConfig) bool // whether the check runs without --enable and --disable
+	run     func(in validateInput) (validateFindings, error)
+}
+
+// validateChecks are all checks of validate, in the order in which their timings are reported.
+var validateChecks = []validateCheck{
+	{
+		name:    checkSchema,
+		enabled: func(validateCommandConfig) bool { return true },
+		run: func(in validateInput) (validateFindings, error) {
+			return validateFindings{}, runInParallel(in.objects, in.validator.validate, in.config.parallel)
+		},
+	},
+	{
+		name:    "policies",
+		enabled: func(config validateCommandConfig) bool { return !config.skipPolicies },
+		run: func(in validateInput) (f validateFindings, err error) {
+			f.policies, err = checkPolicies(in.config.StdOptions, in.env, in.objects, in.client)
+			return f, err
+		},
+	},
+	{
+		name:    "images",
+		enabled: func(validateCommandConfig) bool { return true },
+		run: func(in validateInput) (f validateFindings, err error) {
+			p, exceptions := in.config.App().ImagePolicy(in.env)
+			f.add(findingImagePolicy, imageViolations(in.objects, in.client, in.env, p, exceptions))
+			return f, nil
+		},
+	},
+	{
+		name:    "hosts",
+		enabled: func(config validateCommandConfig) bool { return config.checkHosts },
+		run: func(in validateInput) (f validateFindings, err error) {
+			conflicts, err := envHostConflicts(in.config, in.env, in.objects, in.client)
+			f.add(findingHostConflict, conflicts)
+			return f, err
+		},
+	},
+	{
+		name:    "live-hosts",
+		live:    true,
+		enabled: func(config validateCommandConfig) bool { return config.checkLiveHosts },
+		run: func(in validateInput) (f validateFindings, err error) {
+			conflicts, err := liveHostConflicts(in.config, in.env, in.objects, in.client)
+			f.add(findingHostConflict, conflicts)
+			return f, err
+		},
+	},
+	{
+		name:    "scheduling",
+		live:    true,
+		enabled: func(config validateCommandConfig) bool { return config.checkScheduling },
+		run: func(in validateInput) (f validateFindings, err error) {
+			unschedulable, err := unschedulableWorkloads(in.objects, in.client)
+			f.add(findingUnschedulable, unschedulable)
+			return f, err
+		},
+	},
+	{
+		name:    "classes",
+		live:    true,
+		enabled: func(config validateCommandConfig) bool { return config.checkClasses },
+		run: func(in validateInput) (f validateFindings, err error) {
+			f.add(findingMissingClass, missingClasses(in.objects, in.client))
+			return f, nil
+		},
+	},
+	{
+		name:    "quotas",
+		enabled: func(config validateCommandConfig) bool { return config.checkQuotas },
+		run: func(in validateInput) (f validateFindings, err error) {
+			all, err := allObjects(in.config, in.env)
+			if err != nil {
+				return f, err
+			}
+			defaultNs := in.config.DefaultNamespace(in.env)
+			client := &declaredQuotaClient{quotaClient: in.client, offline: in.config.offline.enabled(), declared: all, defaultNs: defaultNs}
+			problems, namespaces, err := quotaProblems(client, in.objects, defaultNs)
+			if err != nil {
+				return f, err
+			}
+			for _, ns := range namespaces {
+				for _, p := range problems[ns] {
+					f.add(findingQuota, []string{fmt.Sprintf("namespace %s: %s", ns, p)})
+				}
+			}
+			return f, nil
+		},
+	},
+	{
+		name:    "semantics",
+		enabled: func(config validateCommandConfig) bool { return config.checkSemantics },
+		run: func(in validateInput) (f validateFindings, err error) {
+			all, err := allObjects(in.config, in.env)
+			if err != nil {
+				return f, err
+			}
+			f.add(findingSemantic, semanticProblems(in.objects, all, in.client, in.config.DefaultNamespace(in.env)))
+			return f, nil
+		},
+	},
+	{
+		name:    "secrets",
+		enabled: func(config validateCommandConfig) bool { return config.checkSecrets },
+		run: func(in validateInput) (f validateFindings, err error) {
+			f.add(findingSecret, secretProblems(in.objects, in.client))
+			return f, nil
+		},
+	},
+	{
+		name:    "apis",
+		enabled: func(config validateCommandConfig) bool { return config.checkAPIs },
+		run: func(in validateInput) (f validateFindings, err error) {
+			minor, err := targetMinor(in.client)
+			if err != nil {
+				return f, err
+			}
+			removed, deprecated := apiFindings(apiUsages(in.objects, in.client, minor))
+			f.add(findingRemovedAPI, removed)
+			f.add(findingDeprecatedAPI, deprecated)
+			return f, nil
+		},
+	},
+	{
+		name:    "sunset",
+		enabled: func(config validateCommandConfig) bool { return config.checkSunset },
+		run: func(in validateInput) (f validateFindings, err error) {
+			f.add(findingSunset, sunsetComponents(in.config.App(), in.objects, time.Now()))
+			return f, nil
+		},
+	},
+	{
+		name:    "params",
+		enabled: func(validateCommandConfig) bool { return true },
+		run: func(in validateInput) (f validateFindings, err error) {
+			names := objectComponents(in.objects)
+			if !hasParamSchemas(in.config.App(), names) {
+				return f, nil
+			}
+			params, err := envParams(in.config.StdOptions, in.env)
+			if err != nil {
+				return f, err
+			}
+			components, _ := params["components"].(map[string]interface{})
+			problems, err := paramProblems(in.config.App(), components, names)
+			f.add(findingParam, problems)
+			return f, err
+		},
+	},
+	{
+		name:    "duplicates",
+		enabled: func(config validateCommandConfig) bool { return config.duplicates },
+		run: func(in validateInput) (f validateFindings, err error) {
+			f.add(findingDuplicate, duplicateObjects(in.objects, in.client, in.config.similarity))
+			return f, nil
+		},
+	},
+}
+
+// checkNames returns the names of all checks.
+func checkNames() []string {
+	var ret []string
+	for _, c := range validateChecks {
+		ret = append(ret, c.name)
+	}
+	return ret
+}
+
+// enabledChecks returns the checks enabled by the supplied config. Checks listed by --enable run in addition to those
+// enabled by their own flags and checks listed by --disable never run.
+func enabledChecks(config validateCommandConfig) ([]validateCheck, error) {
+	known := map[string]bool{}
+	for _, c := range validateChecks {
+		known[c.name] = true
+	}
+	toSet := func(names []string) (map[string]bool, error) {
+		ret := map[string]bool{}
+		for _, n := range names {
+			if !known[n] {
+				return nil, newUsageError(fmt.Sprintf("unknown validator %q, must be one of %s", n, strings.Join(checkNames(), ", ")))
+			}
+			ret[n] = true
+		}
+		return ret, nil
+	}
+	enable, err := toSet(config.enable)
+	if err != nil {
+		return nil, err
+	}
+	disable, err := toSet(config.disable)
+	if err != nil {
+		return nil, err
+	}
+	var ret []validateCheck
+	for _, c := range validateChecks {
+		if enable[c.name] && disable[c.name] {
+			return nil, newUsageError(fmt.Sprintf("validator %s cannot be both enabled and disabled", c.name))
+		}
+		if (enable[c.name] || c.enabled(config)) && !disable[c.name] {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// checkResult is the outcome of running a check.
+type checkResult struct {
+	findings validateFindings
+	err      error
+	elapsed  time.Duration
+}
+
+// runChecks runs the supplied checks concurrently and returns their results in the same order.
+func runChecks(in validateInput, checks []validateCheck) []checkResult {
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c validateCheck) {
+			defer wg.Done()
+			start := time.Now()
+			f, err := c.run(in)
+			results[i] = checkResult{findings: f, err: err, elapsed: time.Since(start)}
+		}(i, c)
+	}
+	wg.Wait()
+	if in.config.Verbosity() > 0 {
+		for i, c := range checks {
+			sio.Debugf("validator %s took %v\n", c.name, results[i].elapsed.Round(time.Millisecond))
+		}
+	}
+	return results
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func enabledCheckNames(t *testing.T, config validateCommandConfig) []string {
+	checks, err := enabledChecks(config)
+	require.Nil(t, err)
+	var ret []string
+	for _, c := range checks {
+		ret = append(ret, c.name)
+	}
+	return ret
+}
+
+func TestEnabledChecks(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]string{"schema", "policies", "images", "params"}, enabledCheckNames(t, validateCommandConfig{}))
+	a.Equal([]string{"schema", "images", "semantics", "params", "duplicates"}, enabledCheckNames(t, validateCommandConfig{
+		checkSemantics: true,
+		duplicates:     true,
+		skipPolicies:   true,
+	}))
+	a.Equal([]string{"policies", "hosts", "apis", "params"}, enabledCheckNames(t, validateCommandConfig{
+		checkHosts: true,
+		enable:     []string{"apis"},
+		disable:    []string{"schema", "images"},
+	}))
+	a.Equal([]string{"schema"}, enabledCheckNames(t, validateCommandConfig{
+		checkClasses: true,
+		disable:      []string{"classes", "policies", "images", "params"},
+	}))
+
+	_, err := enabledChecks(validateCommandConfig{enable: []string{"lint"}})
+	require.NotNil(t, err)
+	a.True(isUsageError(err))
+	a.Equal(`unknown validator "lint", must be one of schema, policies, images, hosts, live-hosts, scheduling, classes, quotas, semantics, secrets, apis, sunset, params, duplicates`, err.Error())
+
+	_, err = enabledChecks(validateCommandConfig{enable: []string{"apis"}, disable: []string{"apis"}})
+	require.NotNil(t, err)
+	a.Equal(`validator apis cannot be both enabled and disabled`, err.Error())
+}
+
+func TestValidateDisableSchema(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	s.opts.verbosity = 1
+	err := s.executeCommand("validate", "dev", "--disable", "schema", "--enable", "semantics")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.NotContains(s.stdout(), "svc2-cm is invalid")
+	s.assertErrorLineNoMatch(regexp.MustCompile(`validator schema`))
+	s.assertErrorLineMatch(regexp.MustCompile(`^validator semantics took \d+`))
+	s.assertErrorLineMatch(regexp.MustCompile(`^validator policies took \d+`))
+}
+
+func TestValidateEnableDuplicatesSimilarity(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("validate", "dev", "--enable", "duplicates", "--duplicate-similarity", "0")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.True(isUsageError(err))
+	a.Equal("duplicate similarity must be greater than 0 and at most 1, got 0", err.Error())
+}
+
+func TestValidateEnableLiveOffline(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("validate", "dev", "--k8s-version", "1.27", "--enable", "scheduling")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.True(isUsageError(err))
+	a.Equal("--k8s-version cannot be used with the scheduling validator, which needs live objects of the cluster", err.Error())
+}
@@ -0,0 +1,314 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+)
+
+// statuses of validated objects
+const (
+	resultValid   = "valid"
+	resultInvalid = "invalid"
+	resultUnknown = "unknown" // no schema found
+	resultError   = "error"   // the schema could not be fetched
+)
+
+// levels of findings and report entries
+const (
+	levelError   = "error"
+	levelWarning = "warning"
+	levelNote    = "note"
+)
+
+// appFile is the file reported as the location of problems that cannot be attributed to a single component.
+const appFile = "qbec.yaml"
+
+// validateResult is the outcome of validating a single object against the schema of its kind.
+type validateResult struct {
+	Object    string   `json:"object"`
+	Component string   `json:"component"`
+	File      string   `json:"file,omitempty"`
+	Status    string   `json:"status"`
+	Messages  []string `json:"messages,omitempty"`
+}
+
+// validateReport is the machine readable report of a validate run.
+type validateReport struct {
+	Environment      string            `json:"environment"`
+	Results          []validateResult  `json:"results"`
+	Findings         []validateFinding `json:"findings,omitempty"`
+	PolicyViolations []policyViolation `json:"policyViolations,omitempty"`
+}
+
+// newValidateReport returns the report for the supplied results and findings. Policy violations are mapped to the
+// source files of their components.
+func newValidateReport(env string, results []validateResult, findings validateFindings, files map[string]string) *validateReport {
+	r := &validateReport{Environment: env, Results: results}
+	if r.Results == nil {
+		r.Results = []validateResult{}
+	}
+	r.Findings = findings.sorted()
+	for _, p := range findings.policies {
+		p.File = files[p.Component]
+		r.PolicyViolations = append(r.PolicyViolations, p)
+	}
+	return r
+}
+
+// write writes the report in the supplied format, one of json, sarif or junit.
+func (r *validateReport) write(w io.Writer, format string) error {
+	var data interface{}
+	switch format {
+	case "json":
+		data = r
+	case "sarif":
+		data = r.sarif()
+	case "junit":
+		b, err := xml.MarshalIndent(r.junit(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s%s\n", xml.Header, b)
+		return nil
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// fileOrApp returns the supplied file or the app file when it is not known.
+func fileOrApp(file string) string {
+	if file == "" {
+		return appFile
+	}
+	return file
+}
+
+// SARIF 2.1.0 types, limited to what the report uses.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func (r *validateReport) sarif() *sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "qbec",
+			InformationURI: "https://qbec.io",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	seenRules := map[string]bool{}
+	add := func(rule, description, level, message, file string, props map[string]string) {
+		if !seenRules[rule] {
+			seenRules[rule] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule, ShortDescription: sarifMessage{Text: description}})
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:     rule,
+			Level:      level,
+			Message:    sarifMessage{Text: message},
+			Locations:  []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: fileOrApp(file)}}}},
+			Properties: props,
+		})
+	}
+	for _, res := range r.Results {
+		props := map[string]string{"object": res.Object, "component": res.Component, "environment": r.Environment}
+		switch res.Status {
+		case resultInvalid:
+			for _, m := range res.Messages {
+				add("invalid-object", "object does not conform to the schema of its kind", levelError, fmt.Sprintf("%s is invalid: %s", res.Object, m), res.File, props)
+			}
+		case resultError:
+			add("schema-error", "schema of the object kind could not be fetched", levelError, fmt.Sprintf("%s: %s", res.Object, strings.Join(res.Messages, ", ")), res.File, props)
+		case resultUnknown:
+			add("unknown-schema", "no schema found for the object kind", levelNote, fmt.Sprintf("%s: %s", res.Object, strings.Join(res.Messages, ", ")), res.File, props)
+		}
+	}
+	for _, p := range r.PolicyViolations {
+		level := levelError
+		if p.Level == model.PolicyLevelWarn {
+			level = levelWarning
+		}
+		props := map[string]string{"object": p.Object, "component": p.Component, "environment": r.Environment, "policy": p.Policy}
+		add("policy/"+p.Policy, fmt.Sprintf("violation of policy %s", p.Policy), level, p.String(), p.File, props)
+	}
+	for _, f := range r.Findings {
+		add(f.Check, fmt.Sprintf("%s check", f.Check), f.Level, f.Message, "", map[string]string{"environment": r.Environment})
+	}
+	return &sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}
+}
+
+// JUnit XML types, as understood by common CI test report tools.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// add adds a test case to the suite, updating its counts.
+func (s *junitTestSuite) add(c junitTestCase) {
+	s.Tests++
+	switch {
+	case c.Failure != nil:
+		s.Failures++
+	case c.Error != nil:
+		s.Errors++
+	case c.Skipped != nil:
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+func (r *validateReport) junit() *junitTestSuites {
+	schemas := junitTestSuite{Name: "schema"}
+	for _, res := range r.Results {
+		c := junitTestCase{Name: res.Object, ClassName: res.Component, File: res.File}
+		text := strings.Join(res.Messages, "\n")
+		switch res.Status {
+		case resultInvalid:
+			c.Failure = &junitMessage{Message: "object is invalid", Text: text}
+		case resultError:
+			c.Error = &junitMessage{Message: "schema fetch error", Text: text}
+		case resultUnknown:
+			c.Skipped = &junitMessage{Message: text}
+		}
+		schemas.add(c)
+	}
+	suites := []junitTestSuite{schemas}
+	if len(r.PolicyViolations) > 0 {
+		policies := junitTestSuite{Name: "policies"}
+		for _, p := range r.PolicyViolations {
+			c := junitTestCase{Name: fmt.Sprintf("%s: %s", p.Policy, p.Object), ClassName: p.Component, File: p.File}
+			if p.Level == model.PolicyLevelWarn {
+				c.SystemOut = "warning: " + p.Message
+			} else {
+				c.Failure = &junitMessage{Message: p.Message, Text: p.String()}
+			}
+			policies.add(c)
+		}
+		suites = append(suites, policies)
+	}
+	if len(r.Findings) > 0 {
+		checks := junitTestSuite{Name: "checks"}
+		for _, f := range r.Findings {
+			c := junitTestCase{Name: f.Message, ClassName: f.Check, File: appFile}
+			if f.Level == levelError {
+				c.Failure = &junitMessage{Message: f.Message}
+			} else {
+				c.SystemOut = f.Message
+			}
+			checks.add(c)
+		}
+		suites = append(suites, checks)
+	}
+	ret := &junitTestSuites{Name: "qbec validate " + r.Environment, Suites: suites}
+	for _, s := range suites {
+		ret.Tests += s.Tests
+		ret.Failures += s.Failures
+		ret.Errors += s.Errors
+	}
+	return ret
+}
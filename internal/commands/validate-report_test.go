@@ -0,0 +1,151 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReportJSON(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	err := s.executeCommand("validate", "dev", "-o", "json")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 invalid objects found", err.Error())
+	a.NotContains(s.stdout(), "is valid")
+	var r validateReport
+	require.Nil(t, s.jsonOutput(&r))
+	a.Equal("dev", r.Environment)
+	statuses := map[string]validateResult{}
+	for _, res := range r.Results {
+		statuses[res.Object] = res
+	}
+	cm := statuses["ConfigMap:bar-system:svc2-cm"]
+	a.Equal(resultInvalid, cm.Status)
+	a.Equal("service2", cm.Component)
+	a.Equal("components/service2.jsonnet", cm.File)
+	a.Equal([]string{"bad config map"}, cm.Messages)
+	a.Equal(resultValid, statuses["Secret:bar-system:svc2-secret"].Status)
+	a.Equal(resultUnknown, statuses["PodSecurityPolicy::100-default"].Status)
+	a.Equal("components/cluster-objects.yaml", statuses["PodSecurityPolicy::100-default"].File)
+}
+
+func TestValidateReportSARIF(t *testing.T) {
+	noFooKeys := policyFile(t, "no-foo-keys.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	setPolicies(s, model.Policy{Name: "no-foo-keys", File: noFooKeys, Level: model.PolicyLevelWarn, Kinds: []string{"secrets"}})
+	err := s.executeCommand("validate", "dev", "--format", "sarif")
+	require.NotNil(t, err)
+	var log sarifLog
+	require.Nil(t, s.jsonOutput(&log))
+	a := assert.New(t)
+	a.Equal("2.1.0", log.Version)
+	require.Equal(t, 1, len(log.Runs))
+	run := log.Runs[0]
+	a.Equal("qbec", run.Tool.Driver.Name)
+	results := map[string]sarifResult{}
+	for _, res := range run.Results {
+		results[res.RuleID] = res
+	}
+	invalid, ok := results["invalid-object"]
+	require.True(t, ok)
+	a.Equal(levelError, invalid.Level)
+	a.Equal("ConfigMap:bar-system:svc2-cm is invalid: bad config map", invalid.Message.Text)
+	a.Equal("components/service2.jsonnet", invalid.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	a.Equal("ConfigMap:bar-system:svc2-cm", invalid.Properties["object"])
+	a.Equal(levelNote, results["unknown-schema"].Level)
+	policy, ok := results["policy/no-foo-keys"]
+	require.True(t, ok)
+	a.Equal(levelWarning, policy.Level)
+	a.Equal("Secret:bar-system:svc2-secret violates policy no-foo-keys: key foo is not allowed in environment dev", policy.Message.Text)
+	a.Equal("components/service2.jsonnet", policy.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	var ids []string
+	for _, rule := range run.Tool.Driver.Rules {
+		ids = append(ids, rule.ID)
+	}
+	a.ElementsMatch([]string{"invalid-object", "unknown-schema", "policy/no-foo-keys"}, ids)
+}
+
+func TestValidateReportJUnit(t *testing.T) {
+	noFooKeys := policyFile(t, "no-foo-keys.jsonnet")
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	setPolicies(s, model.Policy{Name: "no-foo-keys", File: noFooKeys, Kinds: []string{"configmaps"}})
+	err := s.executeCommand("validate", "dev", "-o", "junit")
+	require.NotNil(t, err)
+	var suites junitTestSuites
+	require.Nil(t, xml.Unmarshal([]byte(s.stdout()), &suites))
+	a := assert.New(t)
+	a.Equal("qbec validate dev", suites.Name)
+	a.Equal(2, suites.Failures)
+	require.Equal(t, 2, len(suites.Suites))
+	schemas := suites.Suites[0]
+	a.Equal("schema", schemas.Name)
+	a.Equal(1, schemas.Failures)
+	a.Equal(2, schemas.Skipped)
+	for _, c := range schemas.Cases {
+		if c.Name == "ConfigMap:bar-system:svc2-cm" {
+			a.Equal("service2", c.ClassName)
+			a.Equal("components/service2.jsonnet", c.File)
+			require.NotNil(t, c.Failure)
+			a.Equal("bad config map", c.Failure.Text)
+		}
+	}
+	policies := suites.Suites[1]
+	a.Equal("policies", policies.Name)
+	require.Equal(t, 1, len(policies.Cases))
+	a.Equal("no-foo-keys: ConfigMap:bar-system:svc2-cm", policies.Cases[0].Name)
+	require.NotNil(t, policies.Cases[0].Failure)
+	a.Equal("key foo is not allowed in environment dev", policies.Cases[0].Failure.Message)
+}
+
+func TestValidateReportFindings(t *testing.T) {
+	var f, checked validateFindings
+	f.add(findingDuplicate, []string{"ConfigMap:ns:a and ConfigMap:ns:b are identical"})
+	f.add(findingHostConflict, []string{"host a.example.com of Ingress:ns:a is also used by Ingress:ns:b in environment prod"})
+	checked.merge("hosts", f)
+	r := newValidateReport("dev", nil, checked, nil)
+	a := assert.New(t)
+	a.Equal([]validateResult{}, r.Results)
+	require.Equal(t, 2, len(r.Findings))
+	a.Equal(validateFinding{Source: "hosts", Check: "host-conflict", Level: levelError, Message: r.Findings[0].Message}, r.Findings[0])
+	a.Equal(levelNote, r.Findings[1].Level)
+
+	log := r.sarif()
+	require.Equal(t, 2, len(log.Runs[0].Results))
+	a.Equal(appFile, log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+
+	suites := r.junit()
+	a.Equal(1, suites.Failures)
+	require.Equal(t, 2, len(suites.Suites))
+	checks := suites.Suites[1]
+	a.Equal("checks", checks.Name)
+	a.Equal("host-conflict", checks.Cases[0].ClassName)
+	a.NotNil(checks.Cases[0].Failure)
+	a.Nil(checks.Cases[1].Failure)
+	a.Equal("ConfigMap:ns:a and ConfigMap:ns:b are identical", checks.Cases[1].SystemOut)
+}
@@ -19,12 +19,17 @@ package commands
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/remote"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -47,6 +52,29 @@ type validatorStats struct {
 	Errors     []string `json:"errors,omitempty"`
 }
 
+// summary returns the stats along with the messages of the supplied findings under the stats keys of their kinds and
+// the supplied policy violations.
+func (v *validatorStats) summary(findings []validateFinding, policies []policyViolation) map[string]interface{} {
+	ret := map[string]interface{}{}
+	if v.ValidCount > 0 {
+		ret["valid"] = v.ValidCount
+	}
+	for k, list := range map[string][]string{"unknown": v.Unknown, "invalid": v.Invalid, "errors": v.Errors} {
+		if len(list) > 0 {
+			ret[k] = list
+		}
+	}
+	for _, f := range findings {
+		key := findingKinds[f.Check].stat
+		list, _ := ret[key].([]string)
+		ret[key] = append(list, f.Message)
+	}
+	if len(policies) > 0 {
+		ret["policyViolations"] = policies
+	}
+	return ret
+}
+
 func (v *validatorStats) valid(s string) {
 	v.l.Lock()
 	defer v.l.Unlock()
@@ -74,7 +102,10 @@ func (v *validatorStats) errors(s string) {
 // validateClient is the remote interface needed for validate operations.
 type validateClient interface {
 	DisplayName(o model.K8sMeta) string
+	Get(obj model.K8sMeta) (*unstructured.Unstructured, error)
 	ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, error)
+	ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error)
+	ServerVersion() (string, error)
 }
 
 type validator struct {
@@ -82,6 +113,14 @@ type validator struct {
 	client                 validateClient
 	stats                  validatorStats
 	red, green, dim, reset string
+	l                      sync.Mutex
+	results                map[string]validateResult // results keyed by object display name
+}
+
+func (v *validator) result(obj model.K8sLocalObject, name, status string, messages []string) {
+	v.l.Lock()
+	defer v.l.Unlock()
+	v.results[name] = validateResult{Object: name, Component: obj.Component(), Status: status, Messages: messages}
 }
 
 func (v *validator) validate(obj model.K8sLocalObject) error {
@@ -91,16 +130,19 @@ func (v *validator) validate(obj model.K8sLocalObject) error {
 		if err == remote.ErrSchemaNotFound {
 			fmt.Fprintf(v.w, "%s%s %s: no schema found, cannot validate%s\n", v.dim, unicodeQuestion, name, v.reset)
 			v.stats.unknown(name)
+			v.result(obj, name, resultUnknown, []string{"no schema found, cannot validate"})
 			return nil
 		}
 		fmt.Fprintf(v.w, "%s%s %s: schema fetch error %v%s\n", v.red, unicodeX, name, err, v.reset)
 		v.stats.errors(name)
+		v.result(obj, name, resultError, []string{fmt.Sprintf("schema fetch error %v", err)})
 		return err
 	}
 	errs := schema.Validate(obj.ToUnstructured())
 	if len(errs) == 0 {
 		fmt.Fprintf(v.w, "%s%s %s is valid%s\n", v.green, unicodeCheck, name, v.reset)
 		v.stats.valid(name)
+		v.result(obj, name, resultValid, nil)
 		return nil
 	}
 	var lines []string
@@ -109,54 +151,373 @@ func (v *validator) validate(obj model.K8sLocalObject) error {
 	}
 	fmt.Fprintf(v.w, "%s%s %s is invalid\n\t- %s%s\n", v.red, unicodeX, name, strings.Join(lines, "\n\t- "), v.reset)
 	v.stats.invalid(name)
+	v.result(obj, name, resultInvalid, lines)
 	return nil
 }
 
-func validateObjects(objs []model.K8sLocalObject, client validateClient, parallel int, colors bool, out io.Writer) error {
+// kinds of findings of checks
+const (
+	findingHostConflict  = "host-conflict"
+	findingUnschedulable = "unschedulable"
+	findingMissingClass  = "missing-class"
+	findingSemantic      = "semantic"
+	findingSecret        = "secret"
+	findingImagePolicy   = "image-policy"
+	findingQuota         = "quota"
+	findingRemovedAPI    = "removed-api"
+	findingDeprecatedAPI = "deprecated-api"
+	findingSunset        = "sunset-component"
+	findingParam         = "param"
+	findingDuplicate     = "duplicate-object"
+)
+
+// findingKind describes how findings of a kind are reported.
+type findingKind struct {
+	order   int    // findings are reported and fail validation in this order
+	level   string // only findings with the error level fail validation
+	stat    string // key of the findings in the stats of text output
+	failure string // error format for findings of the kind, with their count as argument
+}
+
+var findingKinds = map[string]findingKind{
+	findingHostConflict:  {order: 1, level: levelError, stat: "hostConflicts", failure: "%d host conflict(s) found"},
+	findingUnschedulable: {order: 2, level: levelError, stat: "unschedulable", failure: "%d workload(s) cannot be scheduled"},
+	findingMissingClass:  {order: 3, level: levelError, stat: "missingClasses", failure: "%d missing class reference(s) found"},
+	findingSemantic:      {order: 4, level: levelError, stat: "semanticProblems", failure: "%d semantic problem(s) found"},
+	findingSecret:        {order: 5, level: levelError, stat: "secretProblems", failure: "%d secret problem(s) found"},
+	findingImagePolicy:   {order: 6, level: levelError, stat: "imageViolations", failure: "%d image policy violation(s) found"},
+	findingQuota:         {order: 7, level: levelError, stat: "quotaProblems", failure: "%d resource quota problem(s) found"},
+	findingRemovedAPI:    {order: 8, level: levelError, stat: "removedAPIs", failure: "%d object(s) use removed API versions"},
+	findingSunset:        {order: 9, level: levelError, stat: "sunsetComponents", failure: "%d component(s) past their sunset date"},
+	findingParam:         {order: 10, level: levelError, stat: "paramProblems", failure: "%d param problem(s) found"},
+	findingDeprecatedAPI: {order: 11, level: levelWarning, stat: "deprecatedAPIs"},
+	findingDuplicate:     {order: 12, level: levelNote, stat: "duplicates"},
+}
+
+// validateFinding is a problem found by a check that is not specific to the schema of a single object.
+type validateFinding struct {
+	Source  string `json:"source"` // the check that found the problem
+	Check   string `json:"check"`  // the kind of problem
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// validateFindings are the findings of checks. Policy violations are kept apart since they are reported with the
+// objects and components that caused them.
+type validateFindings struct {
+	list     []validateFinding
+	policies []policyViolation
+}
+
+// add adds findings of the supplied kind with the supplied messages. The source is set when checks are run.
+func (f *validateFindings) add(kind string, messages []string) {
+	for _, m := range messages {
+		f.list = append(f.list, validateFinding{Check: kind, Level: findingKinds[kind].level, Message: m})
+	}
+}
+
+// merge adds the supplied findings of a check to these findings.
+func (f *validateFindings) merge(source string, other validateFindings) {
+	for _, x := range other.list {
+		x.Source = source
+		f.list = append(f.list, x)
+	}
+	f.policies = append(f.policies, other.policies...)
+}
+
+// sorted returns the findings in the order of their kinds, keeping the order of findings of the same kind.
+func (f *validateFindings) sorted() []validateFinding {
+	ret := append([]validateFinding{}, f.list...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return findingKinds[ret[i].Check].order < findingKinds[ret[j].Check].order
+	})
+	return ret
+}
+
+// validateOutput is how the results of validation are reported.
+type validateOutput struct {
+	w      io.Writer
+	format string            // blank for text, or one of json, sarif or junit
+	colors bool              // colorize text output
+	env    string            // the environment being validated
+	files  map[string]string // source files of components keyed by component name
+}
+
+// validateObjects runs the supplied checks for the objects of the input and reports their results.
+func validateObjects(in validateInput, checks []validateCheck, out validateOutput) error {
+	objs, client := in.objects, in.client
+	w := out.w
+	if out.format != "" {
+		// only the report is written for machine readable formats
+		w = ioutil.Discard
+	}
 	v := &validator{
-		w:      &lockWriter{Writer: out},
-		client: client,
+		w:       &lockWriter{Writer: w},
+		client:  client,
+		results: map[string]validateResult{},
 	}
-	if colors {
+	if out.colors && out.format == "" {
 		v.green = escGreen
 		v.red = escRed
 		v.dim = escDim
 		v.reset = escReset
 	}
 
-	vErr := runInParallel(objs, v.validate, parallel)
-	printStats(v.w, &v.stats)
+	in.validator = v
+	var findings validateFindings
+	var vErr error
+	for i, r := range runChecks(in, checks) {
+		switch {
+		case r.err == nil:
+			findings.merge(checks[i].name, r.findings)
+		case checks[i].name == checkSchema:
+			// schema errors are reported along with the results of other checks
+			vErr = r.err
+		default:
+			return r.err
+		}
+	}
+	list := findings.sorted()
+	counts := map[string]int{}
+	for _, f := range list {
+		if f.Level == levelError {
+			fmt.Fprintf(v.w, "%s%s %s%s\n", v.red, unicodeX, f.Message, v.reset)
+			counts[f.Check]++
+		} else {
+			fmt.Fprintf(v.w, "%s%s %s%s\n", v.dim, unicodeQuestion, f.Message, v.reset)
+		}
+	}
+	denied := 0
+	for _, p := range findings.policies {
+		if p.Level == model.PolicyLevelWarn {
+			fmt.Fprintf(v.w, "%s%s %s (warning)%s\n", v.dim, unicodeQuestion, p, v.reset)
+			continue
+		}
+		fmt.Fprintf(v.w, "%s%s %s%s\n", v.red, unicodeX, p, v.reset)
+		denied++
+	}
+	if out.format == "" {
+		printStats(v.w, v.stats.summary(list, findings.policies))
+	} else {
+		var results []validateResult
+		for _, o := range objs {
+			if r, ok := v.results[client.DisplayName(o)]; ok {
+				r.File = out.files[r.Component]
+				results = append(results, r)
+			}
+		}
+		r := newValidateReport(out.env, results, findings, out.files)
+		if err := r.write(out.w, out.format); err != nil {
+			return err
+		}
+	}
 
-	switch {
-	case vErr != nil:
+	if vErr != nil {
 		return vErr
-	case len(v.stats.Invalid) > 0:
+	}
+	if len(v.stats.Invalid) > 0 {
 		return fmt.Errorf("%d invalid objects found", len(v.stats.Invalid))
-	default:
-		return nil
 	}
+	for _, f := range list {
+		if n := counts[f.Check]; n > 0 {
+			return fmt.Errorf(findingKinds[f.Check].failure, n)
+		}
+	}
+	if denied > 0 {
+		return fmt.Errorf("%d policy violation(s) found", denied)
+	}
+	return nil
+}
+
+// hostUsers returns the display names of ingress and route objects keyed by the hostnames they use.
+func hostUsers(objs []model.K8sLocalObject, client validateClient) map[string][]string {
+	ret := map[string][]string{}
+	for _, o := range objs {
+		if !hostObject(o.GetObjectKind().GroupVersionKind()) {
+			continue
+		}
+		for _, h := range objectHosts(o.ToUnstructured()) {
+			ret[h] = append(ret[h], client.DisplayName(o))
+		}
+	}
+	return ret
+}
+
+// sameBinding returns true if the supplied environments are bound to the same server or kubeconfig contexts.
+// Environments deployed to multiple clusters are not bound to anything themselves.
+func sameBinding(a, b model.Environment) bool {
+	if len(a.Clusters) > 0 || len(b.Clusters) > 0 {
+		return false
+	}
+	return a.Server == b.Server && a.Context == b.Context && a.ContextPattern == b.ContextPattern
+}
+
+// envHostConflicts returns conflicts for hostnames of the supplied objects that are also rendered by other
+// environments of the app that are bound to the same server or contexts.
+func envHostConflicts(config validateCommandConfig, env string, objs []model.K8sLocalObject, client validateClient) ([]string, error) {
+	local := hostUsers(objs, client)
+	if len(local) == 0 {
+		return nil, nil
+	}
+	app := config.App()
+	current := app.Spec.Environments[env]
+	var envs []string
+	for name, e := range app.Spec.Environments {
+		if name != env && sameBinding(e, current) {
+			envs = append(envs, name)
+		}
+	}
+	sort.Strings(envs)
+	var ret []string
+	for _, other := range envs {
+		otherObjects, err := allObjects(config, other)
+		if err != nil {
+			return nil, errors.Wrap(err, "evaluate environment "+other)
+		}
+		others := hostUsers(otherObjects, client)
+		for _, h := range sortedKeys(local) {
+			for _, name := range others[h] {
+				ret = append(ret, fmt.Sprintf("host %s of %s is also used by %s in environment %s", h, strings.Join(local[h], ", "), name, other))
+			}
+		}
+	}
+	return ret, nil
+}
+
+// liveHostConflicts returns conflicts for hostnames of the supplied objects that are used by ingress and route
+// objects on the server that do not belong to the same app and environment.
+func liveHostConflicts(config validateCommandConfig, env string, objs []model.K8sLocalObject, client validateClient) ([]string, error) {
+	local := hostUsers(objs, client)
+	if len(local) == 0 {
+		return nil, nil
+	}
+	seen := map[schema.GroupVersionKind]bool{}
+	var ret []string
+	for _, o := range objs {
+		gvk := o.GetObjectKind().GroupVersionKind()
+		if !hostObject(gvk) || seen[gvk] {
+			continue
+		}
+		seen[gvk] = true
+		list, err := client.ListObjects(gvk, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, live := range list {
+			labels := live.GetLabels()
+			if labels[model.QbecNames.ApplicationLabel] == config.App().Name() && labels[model.QbecNames.EnvironmentLabel] == env {
+				continue
+			}
+			name := client.DisplayName(model.NewK8sObject(live.Object))
+			for _, h := range objectHosts(live) {
+				if users, ok := local[h]; ok {
+					ret = append(ret, fmt.Sprintf("host %s of %s is also used by live object %s", h, strings.Join(users, ", "), name))
+				}
+			}
+		}
+	}
+	return ret, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	var ret []string
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
 }
 
 type validateCommandConfig struct {
 	StdOptions
-	parallel       int
-	filterFunc     func() (filterParams, error)
-	clientProvider func(env string) (validateClient, error)
+	parallel        int
+	checkHosts      bool
+	checkLiveHosts  bool
+	checkScheduling bool
+	checkClasses    bool
+	checkSemantics  bool
+	checkSecrets    bool
+	checkQuotas     bool
+	checkAPIs       bool
+	checkSunset     bool
+	duplicates      bool
+	similarity      float64
+	crdDirs         []string
+	skipPolicies    bool
+	enable          []string
+	disable         []string
+	changedSince    string
+	format          string
+	offline         *offlineTarget
+	filterFunc      func() (filterParams, error)
+	clientProvider  func(env string) (validateClient, error)
+	changedFiles    func(ref string) ([]string, error)
 }
 
 func doValidate(args []string, config validateCommandConfig) error {
 	if len(args) != 1 {
 		return newUsageError("exactly one environment required")
 	}
-	env := args[0]
+	envs, multi, err := expandEnvironments(config.App(), args[0])
+	if err != nil {
+		return err
+	}
+	if !multi {
+		return validateEnvironment(envs[0], config)
+	}
+	if config.format != "" {
+		return newUsageError("--format cannot be used with multiple environments")
+	}
+	return runEnvironments(config.Stdout(), "validate", envs, func(env string) error {
+		return validateEnvironment(env, config)
+	})
+}
+
+// validateEnvironment validates the objects of a single environment.
+func validateEnvironment(env string, config validateCommandConfig) error {
 	if env == model.Baseline {
 		return newUsageError("cannot validate baseline environment, use a real environment")
 	}
+	switch config.format {
+	case "", "json", "sarif", "junit":
+	default:
+		return newUsageError(fmt.Sprintf("invalid output format: %q", config.format))
+	}
+	checks, err := enabledChecks(config)
+	if err != nil {
+		return err
+	}
+	for _, c := range checks {
+		if c.name == "duplicates" && (config.similarity <= 0 || config.similarity > 1) {
+			return newUsageError(fmt.Sprintf("duplicate similarity must be greater than 0 and at most 1, got %v", config.similarity))
+		}
+	}
+	if err := config.offline.check(); err != nil {
+		return err
+	}
+	if err := checkChangedSinceRef(config.changedSince); err != nil {
+		return err
+	}
+	if config.offline.enabled() {
+		for _, c := range checks {
+			if c.live {
+				return newUsageError(fmt.Sprintf("--k8s-version cannot be used with the %s validator, which needs live objects of the cluster", c.name))
+			}
+		}
+		config.clientProvider = func(env string) (validateClient, error) {
+			return config.offline.client(config, env)
+		}
+	}
 	fp, err := config.filterFunc()
 	if err != nil {
 		return err
 	}
-	objects, err := filteredObjects(config, env, fp)
+	var objects []model.K8sLocalObject
+	if config.changedSince != "" {
+		objects, _, _, err = changedObjects(config, env, fp, config.changedSince, config.changedFiles)
+	} else {
+		objects, err = filteredObjects(config, env, fp)
+	}
 	if err != nil {
 		return err
 	}
@@ -164,13 +525,29 @@ func doValidate(args []string, config validateCommandConfig) error {
 	if err != nil {
 		return err
 	}
-	return validateObjects(objects, client, config.parallel, config.Colorize(), config.Stdout())
-
+	crds, err := localCRDs(append(append([]string{}, config.App().Spec.CRDDirs...), config.crdDirs...), objects, client)
+	if err != nil {
+		return err
+	}
+	if len(crds) > 0 {
+		client = &crdValidateClient{validateClient: client, schemas: crds}
+	}
+	components, err := config.App().ComponentsForEnvironment(env, nil, nil)
+	if err != nil {
+		return err
+	}
+	files := map[string]string{}
+	for _, c := range components {
+		files[c.Name] = filepath.ToSlash(c.File)
+	}
+	out := validateOutput{w: config.Stdout(), format: config.format, colors: config.Colorize(), env: env, files: files}
+	in := validateInput{config: config, env: env, objects: objects, client: client}
+	return validateObjects(in, checks, out)
 }
 
 func newValidateCommand(op OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "validate <environment>",
+		Use:     "validate <environment>[,<environment>...]",
 		Short:   "validate one or more components against the spec of a kubernetes cluster",
 		Example: validateExamples(),
 	}
@@ -179,10 +556,30 @@ func newValidateCommand(op OptionsProvider) *cobra.Command {
 		clientProvider: func(env string) (validateClient, error) {
 			return op().Client(env)
 		},
-		filterFunc: addFilterParams(cmd, true),
+		filterFunc:   addFilterParams(cmd, op, true),
+		changedFiles: gitChangedFiles,
 	}
 
 	cmd.Flags().IntVar(&config.parallel, "parallel", 5, "number of parallel routines to run")
+	cmd.Flags().BoolVar(&config.checkHosts, "check-hosts", false, "check that hostnames of ingress and route objects are not used by other environments with the same server")
+	cmd.Flags().BoolVar(&config.checkLiveHosts, "check-live-hosts", false, "check that hostnames of ingress and route objects are not used by other ingress and route objects on the server")
+	cmd.Flags().BoolVar(&config.checkScheduling, "check-scheduling", false, "check that workloads can be scheduled on at least one node based on node selectors, affinities and tolerations")
+	cmd.Flags().BoolVar(&config.checkClasses, "check-classes", false, "check that priority, runtime, storage and ingress classes referenced by objects exist on the server")
+	cmd.Flags().BoolVar(&config.checkSemantics, "check-semantics", false, "check references between objects of the app: service and disruption budget selectors, ingress and route backends, secrets used by containers, and objects rendered more than once")
+	cmd.Flags().BoolVar(&config.checkSecrets, "check-secrets", false, "check secrets for values that look like plaintext credentials, empty values and data over the size limit")
+	cmd.Flags().BoolVar(&config.checkQuotas, "check-quotas", false, "check that workloads fit in the resource quotas and limit ranges of their namespaces, live or rendered by the app")
+	cmd.Flags().BoolVar(&config.checkAPIs, "check-apis", false, "check for API versions that are deprecated or removed in the Kubernetes version of the server, or the one set by --k8s-version")
+	cmd.Flags().BoolVar(&config.checkSunset, "check-sunset", false, "fail for deprecated components that are past the sunset date of their descriptors")
+	cmd.Flags().BoolVar(&config.duplicates, "report-duplicates", false, "report objects of the same kind with identical or near-identical content across components")
+	cmd.Flags().Float64Var(&config.similarity, "duplicate-similarity", 0.9, "fraction of fields that must have the same values for objects to be reported as near-identical, 1 to only report identical objects")
+	cmd.Flags().StringArrayVar(&config.crdDirs, "crd-dir", nil, "validate custom resources against the custom resource definitions in the YAML and JSON files of this directory, in addition to the crdDirs of the app")
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|sarif|junit to write a machine readable report instead of text, for CI and code scanning tools")
+	cmd.Flags().BoolVar(&config.skipPolicies, "skip-policies", false, "do not check objects against the policies of the app, same as --disable policies")
+	cmd.Flags().StringSliceVar(&config.enable, "enable", nil, fmt.Sprintf("comma-separated validators to run in addition to the default ones, from %s", strings.Join(checkNames(), ", ")))
+	cmd.Flags().StringSliceVar(&config.disable, "disable", nil, "comma-separated validators not to run, including default ones")
+	cmd.Flags().StringVar(&config.changedSince, "changed-since", "", "only validate components whose input files changed since this git reference")
+	config.offline = addOfflineFlags(cmd)
+	cmd.Flags().BoolVar(&config.offline.cached, "offline", false, "with --k8s-version, validate against the upstream schema of that version, cached in "+schemaCacheDir+" and downloaded on first use")
 	cmd.RunE = func(c *cobra.Command, args []string) error {
 		config.StdOptions = op()
 		return wrapError(doValidate(args, config))
@@ -18,6 +18,9 @@ package commands
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 
@@ -56,6 +59,41 @@ func TestValidateAll(t *testing.T) {
 	s.assertOutputLineMatch(regexp.MustCompile(`- bad config map`))
 }
 
+func TestValidateK8sVersion(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = func(gvk schema.GroupVersionKind) (remote.Validator, error) {
+		return nil, fmt.Errorf("cluster should not be used")
+	}
+	err := s.executeCommand("validate", "dev", "--k8s-version", "1.22")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Regexp(`^\d+ invalid objects found$`, err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ clusterrole allow-root-psp-policy \(source cluster-objects\) is invalid`))
+	s.assertOutputLineMatch(regexp.MustCompile(`- apiVersion rbac.authorization.k8s.io/v1beta1 is not served for ClusterRole by Kubernetes 1.22, use rbac.authorization.k8s.io/v1`))
+	s.assertOutputLineMatch(regexp.MustCompile(`- apiVersion extensions/v1beta1 is not served for PodSecurityPolicy by Kubernetes 1.22, use policy/v1beta1`))
+	s.assertOutputLineMatch(regexp.MustCompile(`\? namespaces bar-system \(source cluster-objects\): no schema found, cannot validate`))
+}
+
+func TestValidateOffline(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = func(gvk schema.GroupVersionKind) (remote.Validator, error) {
+		return nil, fmt.Errorf("cluster should not be used")
+	}
+	doc, err := ioutil.ReadFile("../../internal/remote/testdata/swagger-namespace.json")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(schemaCacheDir, 0755))
+	defer os.RemoveAll(".qbec")
+	require.Nil(t, ioutil.WriteFile(filepath.Join(schemaCacheDir, "swagger-1.27.json"), doc, 0644))
+	err = s.executeCommand("validate", "dev", "--offline", "--k8s-version", "1.27", "-k", "namespaces")
+	require.NotNil(t, err)
+	// the cached test schema only has a few fields of object metadata
+	assert.Equal(t, "2 invalid objects found", err.Error())
+	s.assertOutputLineMatch(regexp.MustCompile(`✘ namespaces bar-system \(source cluster-objects\) is invalid`))
+	s.assertOutputLineMatch(regexp.MustCompile(`unknown field "labels" in io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta`))
+}
+
 func TestValidateNegative(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -117,6 +155,69 @@ func TestValidateNegative(t *testing.T) {
 				a.Equal(`cannot validate baseline environment, use a real environment`, err.Error())
 			},
 		},
+		{
+			name: "bad format",
+			args: []string{"validate", "dev", "-o", "xml"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`invalid output format: "xml"`, err.Error())
+			},
+		},
+		{
+			name: "bad similarity",
+			args: []string{"validate", "dev", "--report-duplicates", "--duplicate-similarity", "1.5"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`duplicate similarity must be greater than 0 and at most 1, got 1.5`, err.Error())
+			},
+		},
+		{
+			name: "schema without version",
+			args: []string{"validate", "dev", "--k8s-schema", "swagger.json"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--k8s-schema can only be used with --k8s-version`, err.Error())
+			},
+		},
+		{
+			name: "offline without version",
+			args: []string{"validate", "dev", "--offline"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--offline requires --k8s-version to select the schema`, err.Error())
+			},
+		},
+		{
+			name: "offline with schema",
+			args: []string{"validate", "dev", "--offline", "--k8s-version", "1.27", "--k8s-schema", "swagger.json"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--offline cannot be used with --k8s-schema`, err.Error())
+			},
+		},
+		{
+			name: "bad version",
+			args: []string{"validate", "dev", "--k8s-version", "1.12"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`unsupported Kubernetes version 1.12, must be between 1.16 and 1.30`, err.Error())
+			},
+		},
+		{
+			name: "version with live checks",
+			args: []string{"validate", "dev", "--k8s-version", "1.27", "--check-classes"},
+			asserter: func(s *scaffold, err error) {
+				a := assert.New(s.t)
+				a.True(isUsageError(err))
+				a.Equal(`--k8s-version cannot be used with the classes validator, which needs live objects of the cluster`, err.Error())
+			},
+		},
 		{
 			name: "errors",
 			args: []string{"validate", "dev"},
@@ -146,3 +247,41 @@ func TestValidateNegative(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateChangedSince(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.validatorFunc = factory
+	changed, err := filepath.Abs("components/service2.jsonnet")
+	require.Nil(t, err)
+	err = doValidate([]string{"dev"}, validateCommandConfig{
+		StdOptions:   s.opts,
+		parallel:     1,
+		similarity:   1,
+		changedSince: "main",
+		filterFunc:   func() (filterParams, error) { return filterParams{}, nil },
+		clientProvider: func(env string) (validateClient, error) {
+			return s.opts.client, nil
+		},
+		changedFiles: func(ref string) ([]string, error) {
+			assert.Equal(t, "main", ref)
+			return []string{changed}, nil
+		},
+	})
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Equal("1 invalid objects found", err.Error())
+	s.assertErrorLineMatch(regexp.MustCompile(`1 component\(s\) changed since main: service2`))
+	s.assertOutputLineMatch(regexp.MustCompile(`✔ Secret:bar-system:svc2-secret is valid`))
+	a.NotContains(s.stdout(), "100-default")
+}
+
+func TestValidateChangedSinceLastRender(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	err := s.executeCommand("validate", "dev", "--changed-since", "last-render")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.True(isUsageError(err))
+	a.Equal("--changed-since last-render can only be used with show, use a git reference", err.Error())
+}
@@ -0,0 +1,226 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/vm"
+)
+
+// kinds of declared variables
+const (
+	varExternal = "external"
+	varTopLevel = "top-level"
+)
+
+// varDecl is a declared variable along with its kind and whether it was supplied on the command line.
+type varDecl struct {
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+	Supplied    bool   `json:"supplied"`
+}
+
+// varMaps are the string and code variables of a kind in a VM config.
+type varMaps struct {
+	kind    string
+	decls   []model.Var
+	strings map[string]string
+	codes   map[string]string
+}
+
+func copyVars(m map[string]string) map[string]string {
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
+
+// varType returns the type of the supplied variable declaration.
+func varType(v model.Var) string {
+	if v.Type == "" {
+		return "string"
+	}
+	return v.Type
+}
+
+// declaredVarMaps returns the declared variables of the app along with copies of the corresponding values in the
+// supplied config.
+func declaredVarMaps(vars *model.Vars, cfg vm.Config) []*varMaps {
+	if vars == nil {
+		vars = &model.Vars{}
+	}
+	return []*varMaps{
+		{kind: varExternal, decls: vars.External, strings: copyVars(cfg.Vars), codes: copyVars(cfg.CodeVars)},
+		{kind: varTopLevel, decls: vars.TopLevel, strings: copyVars(cfg.TopLevelVars), codes: copyVars(cfg.TopLevelCodeVars)},
+	}
+}
+
+// lookup returns the values of the type of the supplied variable and those of the other type.
+func (m *varMaps) lookup(v model.Var) (own, other map[string]string) {
+	if varType(v) == "code" {
+		return m.codes, m.strings
+	}
+	return m.strings, m.codes
+}
+
+// declaredVars returns the variables declared by the app in declaration order, external variables first.
+func declaredVars(vars *model.Vars, cfg vm.Config) []varDecl {
+	var ret []varDecl
+	for _, m := range declaredVarMaps(vars, cfg) {
+		for _, v := range m.decls {
+			own, _ := m.lookup(v)
+			_, supplied := own[v.Name]
+			ret = append(ret, varDecl{
+				Kind:        m.kind,
+				Name:        v.Name,
+				Type:        varType(v),
+				Description: v.Description,
+				Default:     v.Default,
+				Required:    v.Required,
+				Supplied:    supplied,
+			})
+		}
+	}
+	return ret
+}
+
+// resolveVars returns a copy of the supplied config with defaults set for declared variables that were not
+// supplied. It returns an error listing all required variables that are missing and all variables supplied with
+// the wrong type.
+func resolveVars(vars *model.Vars, cfg vm.Config) (vm.Config, error) {
+	maps := declaredVarMaps(vars, cfg)
+	var problems bytes.Buffer
+	count := 0
+	for _, m := range maps {
+		for _, v := range m.decls {
+			own, other := m.lookup(v)
+			if _, ok := own[v.Name]; ok {
+				continue
+			}
+			problem := ""
+			switch _, ok := other[v.Name]; {
+			case ok:
+				problem = "wrong type"
+			case v.Required:
+				problem = "missing"
+			case v.Default != "":
+				own[v.Name] = v.Default
+			case varType(v) == "code":
+				own[v.Name] = "null"
+			default:
+				own[v.Name] = ""
+			}
+			if problem != "" {
+				if count == 0 {
+					fmt.Fprintf(&problems, "%-10s %-30s %-7s %-11s %s\n", "KIND", "NAME", "TYPE", "PROBLEM", "DESCRIPTION")
+				}
+				count++
+				fmt.Fprintf(&problems, "%-10s %-30s %-7s %-11s %s\n", m.kind, v.Name, varType(v), problem, v.Description)
+			}
+		}
+	}
+	if count > 0 {
+		return cfg, fmt.Errorf("%d declared variable(s) not supplied correctly, use --vm:ext-str, --vm:ext-code, --vm:tla-str or --vm:tla-code to set them\n%s",
+			count, problems.String())
+	}
+	ret := cfg
+	ret.Vars, ret.CodeVars = maps[0].strings, maps[0].codes
+	ret.TopLevelVars, ret.TopLevelCodeVars = maps[1].strings, maps[1].codes
+	return ret, nil
+}
+
+// renderVM returns a VM for evaluating the app, with the declared variables of the app checked and defaulted.
+func renderVM(req StdOptions) (*vm.VM, error) {
+	cfg, err := resolveVars(req.App().Spec.Vars, req.VM().Config())
+	if err != nil {
+		return nil, err
+	}
+	return vm.New(cfg), nil
+}
+
+func newVarsCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vars <subcommand>",
+		Short: "declared variable lists",
+	}
+	cmd.AddCommand(newVarsListCommand(op))
+	return cmd
+}
+
+func listVars(decls []varDecl, format string, w io.Writer) error {
+	switch format {
+	case "":
+		fmt.Fprintf(w, "%-10s %-30s %-7s %-9s %-9s %-20s %s\n", "KIND", "NAME", "TYPE", "REQUIRED", "SUPPLIED", "DEFAULT", "DESCRIPTION")
+		for _, d := range decls {
+			fmt.Fprintf(w, "%-10s %-30s %-7s %-9t %-9t %-20s %s\n", d.Kind, d.Name, d.Type, d.Required, d.Supplied, d.Default, d.Description)
+		}
+		return nil
+	case "yaml":
+		b, err := yaml.Marshal(decls)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "%s\n", b)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(decls)
+	default:
+		return newUsageError(fmt.Sprintf("listVars: unsupported format %q", format))
+	}
+}
+
+type varsListCommandConfig struct {
+	StdOptions
+	format string
+}
+
+func doVarsList(args []string, config varsListCommandConfig) error {
+	if len(args) != 0 {
+		return newUsageError("no arguments expected")
+	}
+	return listVars(declaredVars(config.App().Spec.Vars, config.VM().Config()), config.format, config.Stdout())
+}
+
+func newVarsListCommand(op OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list the external and top-level variables declared in qbec.yaml and whether they are supplied",
+		Example: varsListExamples(),
+	}
+	config := varsListCommandConfig{}
+	cmd.Flags().StringVarP(&config.format, "format", "o", "", "use json|yaml to display machine readable input")
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		config.StdOptions = op()
+		return wrapError(doVarsList(args, config))
+	}
+	return cmd
+}
@@ -0,0 +1,99 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testVars() *model.Vars {
+	return &model.Vars{
+		External: []model.Var{
+			{Name: "image_tag", Description: "tag of the image to deploy", Required: true},
+			{Name: "debug", Type: "code", Default: "false"},
+			{Name: "owner"},
+		},
+		TopLevel: []model.Var{
+			{Name: "replicas", Type: "code"},
+		},
+	}
+}
+
+func TestResolveVars(t *testing.T) {
+	a := assert.New(t)
+	in := vm.Config{Vars: map[string]string{"image_tag": "v1"}}
+	cfg, err := resolveVars(testVars(), in)
+	require.Nil(t, err)
+	a.Equal(map[string]string{"image_tag": "v1", "owner": ""}, cfg.Vars)
+	a.Equal(map[string]string{"debug": "false"}, cfg.CodeVars)
+	a.Equal(map[string]string{"replicas": "null"}, cfg.TopLevelCodeVars)
+	a.Equal(map[string]string{"image_tag": "v1"}, in.Vars)
+
+	cfg, err = resolveVars(nil, in)
+	require.Nil(t, err)
+	a.Equal(in.Vars, cfg.Vars)
+}
+
+func TestResolveVarsNegative(t *testing.T) {
+	_, err := resolveVars(testVars(), vm.Config{TopLevelVars: map[string]string{"replicas": "3"}})
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Contains(err.Error(), "2 declared variable(s) not supplied correctly")
+	a.Regexp(regexp.MustCompile(`(?m)^external\s+image_tag\s+string\s+missing\s+tag of the image to deploy$`), err.Error())
+	a.Regexp(regexp.MustCompile(`(?m)^top-level\s+replicas\s+code\s+wrong type\s*$`), err.Error())
+}
+
+func TestVarsList(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Vars = testVars()
+	err := s.executeCommand("vars", "list")
+	require.Nil(t, err)
+	s.assertOutputLineMatch(regexp.MustCompile(`^KIND\s+NAME\s+TYPE\s+REQUIRED\s+SUPPLIED\s+DEFAULT\s+DESCRIPTION$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^external\s+image_tag\s+string\s+true\s+false\s+tag of the image to deploy$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^external\s+debug\s+code\s+false\s+false\s+false\s*$`))
+	s.assertOutputLineMatch(regexp.MustCompile(`^top-level\s+replicas\s+code\s+false\s+false\s*$`))
+}
+
+func TestVarsListJSON(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Vars = testVars()
+	err := s.executeCommand("vars", "list", "-o", "json")
+	require.Nil(t, err)
+	var out []varDecl
+	err = s.jsonOutput(&out)
+	require.Nil(t, err)
+	require.Equal(t, 4, len(out))
+	assert.Equal(t, varDecl{Kind: varExternal, Name: "image_tag", Type: "string", Description: "tag of the image to deploy", Required: true}, out[0])
+}
+
+func TestShowMissingVars(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.app.Spec.Vars = testVars()
+	err := s.executeCommand("show", "dev")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "1 declared variable(s) not supplied correctly")
+	assert.Contains(t, err.Error(), "image_tag")
+}
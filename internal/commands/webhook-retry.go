@@ -0,0 +1,153 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// webhookFailure matches errors for requests that failed because a webhook could not be called, as opposed to
+// requests that were denied by a webhook.
+var webhookFailure = regexp.MustCompile(`failed calling (?:admission )?webhook "([^"]+)"`)
+
+// number of times and interval at which objects that are rejected by webhooks that are not available are retried
+// after the dependencies of the webhooks are ready
+var (
+	webhookRetries    = 5
+	webhookRetryDelay = 3 * time.Second
+)
+
+// failedWebhook returns the name of the webhook that could not be called when the supplied error is caused by such a
+// failure, an empty string otherwise.
+func failedWebhook(err error) string {
+	if err == nil {
+		return ""
+	}
+	m := webhookFailure.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// webhookDependencies returns the objects that a webhook needs to be called, that is its service and the workloads
+// selected by the service, from the supplied objects. It returns nil when the supplied objects do not have a webhook
+// configuration for the webhook or when the webhook does not use a service that is one of the objects.
+func webhookDependencies(objects []model.K8sLocalObject, webhook string, defaultNs string) []model.K8sLocalObject {
+	namespace := func(o model.K8sLocalObject) string {
+		if o.GetNamespace() == "" {
+			return defaultNs
+		}
+		return o.GetNamespace()
+	}
+	var svcNs, svcName string
+	for _, o := range objects {
+		gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+		if gk.Group != "admissionregistration.k8s.io" || (gk.Kind != "MutatingWebhookConfiguration" && gk.Kind != "ValidatingWebhookConfiguration") {
+			continue
+		}
+		hooks, _ := nestedValue(o.ToUnstructured().Object, "webhooks").([]interface{})
+		for _, h := range hooks {
+			hook, _ := h.(map[string]interface{})
+			if name, _ := hook["name"].(string); name != webhook {
+				continue
+			}
+			svcName, _ = nestedValue(hook, "clientConfig", "service", "name").(string)
+			svcNs, _ = nestedValue(hook, "clientConfig", "service", "namespace").(string)
+		}
+	}
+	if svcName == "" {
+		return nil
+	}
+	if svcNs == "" {
+		svcNs = defaultNs
+	}
+	var ret []model.K8sLocalObject
+	for _, o := range objects {
+		gk := o.GetObjectKind().GroupVersionKind().GroupKind()
+		if gk.Group != "" || gk.Kind != "Service" || o.GetName() != svcName || namespace(o) != svcNs {
+			continue
+		}
+		ret = append(ret, o)
+		sel := toStringMap(nestedValue(o.ToUnstructured().Object, "spec", "selector"))
+		if len(sel) == 0 {
+			continue
+		}
+		selector := labels.SelectorFromSet(labels.Set(sel))
+		for _, w := range objects {
+			if namespace(w) != svcNs {
+				continue
+			}
+			if l := podLabels(w.ToUnstructured()); l != nil && selector.Matches(labels.Set(l)) {
+				ret = append(ret, w)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// deferredObject is an object that was rejected because a webhook could not be called and that is retried once the
+// dependencies of the webhook are ready.
+type deferredObject struct {
+	object  model.K8sLocalObject
+	name    string                 // display name of the object
+	webhook string                 // the webhook that could not be called
+	deps    []model.K8sLocalObject // the objects that the webhook needs to be called
+	err     error                  // the last error for the object
+}
+
+// readyDeferred returns the deferred objects whose webhook dependencies are not deferred themselves, along with the
+// remaining ones. When none are ready, the objects wait for each other and an error describing the cycle is returned.
+func readyDeferred(deferred []*deferredObject, display func(o model.K8sMeta) string) (ready, rest []*deferredObject, _ error) {
+	pending := map[string]bool{}
+	for _, d := range deferred {
+		pending[d.name] = true
+	}
+	for _, d := range deferred {
+		blocked := false
+		for _, dep := range d.deps {
+			if pending[display(dep)] {
+				blocked = true
+				break
+			}
+		}
+		if blocked {
+			rest = append(rest, d)
+		} else {
+			ready = append(ready, d)
+		}
+	}
+	if len(ready) == 0 && len(rest) > 0 {
+		var msgs []string
+		for _, d := range rest {
+			msgs = append(msgs, fmt.Sprintf("%s (webhook %s)", d.name, d.webhook))
+		}
+		sort.Strings(msgs)
+		return nil, nil, fmt.Errorf("cycle between webhooks and the objects they depend on, cannot apply %s", strings.Join(msgs, ", "))
+	}
+	return ready, rest, nil
+}
@@ -0,0 +1,157 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func webhookObjects() []model.K8sLocalObject {
+	obj := func(data map[string]interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(data, "example1", "hooks", "dev")
+	}
+	server := deployment("hook-server", 1, nil)
+	server["metadata"].(map[string]interface{})["namespace"] = "hooks"
+	server["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"] = map[string]interface{}{
+		"labels": map[string]interface{}{"app": "hook-server"},
+	}
+	return []model.K8sLocalObject{
+		obj(map[string]interface{}{
+			"apiVersion": "admissionregistration.k8s.io/v1beta1",
+			"kind":       "ValidatingWebhookConfiguration",
+			"metadata":   map[string]interface{}{"name": "validator"},
+			"webhooks": []interface{}{
+				map[string]interface{}{
+					"name": "validate.example.com",
+					"clientConfig": map[string]interface{}{
+						"service": map[string]interface{}{"name": "hook-server", "namespace": "hooks"},
+					},
+				},
+			},
+		}),
+		obj(server),
+		obj(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "hook-server", "namespace": "hooks"},
+			"spec":       map[string]interface{}{"selector": map[string]interface{}{"app": "hook-server"}},
+		}),
+		obj(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "consumer", "namespace": "hooks"},
+		}),
+	}
+}
+
+func webhookError(name string) error {
+	return errors.New(`Internal error occurred: failed calling admission webhook "` + name + `": Post https://hook-server.hooks.svc:443/validate: dial tcp: connection refused`)
+}
+
+func TestFailedWebhook(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("validate.example.com", failedWebhook(webhookError("validate.example.com")))
+	a.Equal("mutate.example.com", failedWebhook(errors.New(`failed calling webhook "mutate.example.com": context deadline exceeded`)))
+	a.Equal("", failedWebhook(errors.New(`admission webhook "validate.example.com" denied the request: bad`)))
+	a.Equal("", failedWebhook(nil))
+}
+
+func TestWebhookDependencies(t *testing.T) {
+	objects := webhookObjects()
+	deps := webhookDependencies(objects, "validate.example.com", "default")
+	require.Equal(t, 2, len(deps))
+	a := assert.New(t)
+	a.Equal("Service", deps[0].GetKind())
+	a.Equal("Deployment", deps[1].GetKind())
+	a.Nil(webhookDependencies(objects, "other.example.com", "default"))
+	a.Nil(webhookDependencies(objects[1:], "validate.example.com", "default"))
+}
+
+func TestReadyDeferred(t *testing.T) {
+	objects := webhookObjects()
+	display := func(o model.K8sMeta) string { return o.GetKind() + ":" + o.GetName() }
+	consumer := &deferredObject{object: objects[3], name: "ConfigMap:consumer", webhook: "validate.example.com", deps: objects[1:3]}
+	ready, rest, err := readyDeferred([]*deferredObject{consumer}, display)
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal([]*deferredObject{consumer}, ready)
+	a.Nil(rest)
+
+	server := &deferredObject{object: objects[1], name: "Deployment:hook-server", webhook: "validate.example.com", deps: objects[1:3]}
+	_, _, err = readyDeferred([]*deferredObject{consumer, server}, display)
+	require.NotNil(t, err)
+	a.Equal("cycle between webhooks and the objects they depend on, cannot apply ConfigMap:consumer (webhook validate.example.com), Deployment:hook-server (webhook validate.example.com)", err.Error())
+}
+
+func TestApplyWebhookNotInApply(t *testing.T) {
+	s := newScaffold(t)
+	defer s.reset()
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		if obj.GetName() == "svc2-cm" {
+			return nil, webhookError("validate.example.com")
+		}
+		return &remote.SyncResult{Type: remote.SyncObjectsIdentical}, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false")
+	require.NotNil(t, err)
+	a := assert.New(t)
+	a.Contains(err.Error(), `failed calling admission webhook "validate.example.com"`)
+	s.assertErrorLineNoMatch(regexp.MustCompile(`will retry`))
+}
+
+func TestApplyWebhookRequeue(t *testing.T) {
+	s := newScaffoldIn(t, "testdata/webhook-app")
+	defer s.reset()
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+	attempts := map[string]int{}
+	s.opts.client.syncFunc = func(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+		attempts[obj.GetName()]++
+		if strings.HasPrefix(obj.GetName(), "consumer-") && attempts[obj.GetName()] < 3 {
+			return nil, webhookError("validate.example.com")
+		}
+		return &remote.SyncResult{Type: remote.SyncCreated, Details: "created"}, nil
+	}
+	var waited []string
+	s.opts.client.getFunc = func(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+		waited = append(waited, obj.GetName())
+		u := obj.(model.K8sLocalObject).ToUnstructured()
+		if u.GetKind() == "Deployment" {
+			u.Object["status"] = map[string]interface{}{"replicas": int64(1), "updatedReplicas": int64(1), "availableReplicas": int64(1)}
+		}
+		return u, nil
+	}
+	err := s.executeCommand("apply", "dev", "--gc=false")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(map[string]int{"consumer-a": 3, "consumer-b": 3, "hook-server": 2, "validator": 1}, attempts)
+	a.Contains(waited, "hook-server")
+	s.assertErrorLineMatch(regexp.MustCompile(`waiting for 2 webhook dependencies to be ready`))
+	s.assertErrorLineMatch(regexp.MustCompile(`ConfigMap:hooks:consumer-a: webhook validate.example.com is not available, will retry`))
+	stats := s.outputStats()
+	a.EqualValues([]interface{}{"ConfigMap:hooks:consumer-a", "ConfigMap:hooks:consumer-b"}, stats["requeued"])
+}
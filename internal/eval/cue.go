@@ -0,0 +1,111 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// cueObjectsField is the field of a CUE component that has its objects.
+const cueObjectsField = "objects"
+
+// runCue runs cue with the supplied arguments and returns its standard output. CUE components are evaluated by the
+// cue binary, which must be on the path.
+var runCue = func(args ...string) (string, error) {
+	exe, err := exec.LookPath("cue")
+	if err != nil {
+		return "", fmt.Errorf("CUE components need the cue binary on the path, see https://cuelang.org/docs/install: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("cue %s: %v\n%s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// isCueComponent returns true if the supplied component is a CUE file.
+func isCueComponent(c model.Component) bool {
+	return c.Generator == nil && strings.HasSuffix(c.File, ".cue")
+}
+
+// cueObjects returns the objects of the supplied CUE component, which is exported by cue unified with a JSON value
+// that has the supplied params of the component under params and the details of the evaluation under qbec.
+func cueObjects(c model.Component, params interface{}, ctx Context) (interface{}, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	properties := ctx.Properties
+	if properties == nil {
+		properties = map[string]string{}
+	}
+	input := map[string]interface{}{
+		"params": params,
+		"qbec": map[string]interface{}{
+			"app":       ctx.App,
+			"env":       ctx.Env,
+			"namespace": ctx.DefaultNamespace,
+			"props":     properties,
+		},
+	}
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s: marshal params", c.Name)
+	}
+	inputFile, err := ioutil.TempFile("", "qbec-cue-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(inputFile.Name())
+	if _, err := inputFile.Write(b); err != nil {
+		inputFile.Close()
+		return nil, err
+	}
+	if err := inputFile.Close(); err != nil {
+		return nil, err
+	}
+	args := []string{"export", c.File, inputFile.Name(), "--out", "json", "-e", cueObjectsField}
+	if ctx.Verbose {
+		sio.Debugln("Export CUE component: cue " + strings.Join(args, " "))
+	}
+	out, err := runCue(args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s", c.Name)
+	}
+	var objs interface{}
+	if err := json.Unmarshal([]byte(out), &objs); err != nil {
+		return nil, errors.Wrapf(err, "component %s: parse exported objects", c.Name)
+	}
+	switch objs.(type) {
+	case []interface{}, map[string]interface{}:
+		return objs, nil
+	default:
+		return nil, fmt.Errorf("component %s: %s must be a list or an object of objects", c.Name, cueObjectsField)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFakeCue exports CUE components by returning the supplied output, or a deployment built from the params and
+// qbec details of the input when the output is empty, and returns the arguments of the last export.
+func setupFakeCue(t *testing.T, output string) (*[]string, func()) {
+	var last []string
+	orig := runCue
+	runCue = func(args ...string) (string, error) {
+		last = args
+		if output != "" {
+			return output, nil
+		}
+		b, err := ioutil.ReadFile(args[2])
+		if err != nil {
+			return "", err
+		}
+		var input struct {
+			Params map[string]interface{} `json:"params"`
+			Qbec   map[string]interface{} `json:"qbec"`
+		}
+		if err := json.Unmarshal(b, &input); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`[{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":%q},"spec":{"replicas":%v}}]`,
+			input.Qbec["namespace"], input.Params["replicas"]), nil
+	}
+	return &last, func() { runCue = orig }
+}
+
+func TestEvalCue(t *testing.T) {
+	args, reset := setupFakeCue(t, "")
+	defer reset()
+	ctx := Context{App: "app1", Env: "prod", ParamsFile: "testdata/params.cue.libsonnet", DefaultNamespace: "web-ns"}
+	objs, err := Components([]model.Component{
+		{Name: "a", File: "testdata/components/a.json"},
+		{Name: "web", File: "testdata/cue/web.cue"},
+	}, ctx)
+	require.Nil(t, err)
+	a := assert.New(t)
+	var web model.K8sLocalObject
+	for _, o := range objs {
+		if o.Component() == "web" {
+			web = o
+		}
+	}
+	require.NotNil(t, web)
+	a.Equal("Deployment", web.GetKind())
+	a.Equal("web-ns", web.GetNamespace())
+	a.Equal("prod", web.Environment())
+	a.EqualValues(4, web.ToUnstructured().Object["spec"].(map[string]interface{})["replicas"])
+	require.Equal(t, 7, len(*args))
+	a.Equal([]string{"export", "testdata/cue/web.cue"}, (*args)[:2])
+	a.Equal([]string{"--out", "json", "-e", "objects"}, (*args)[3:])
+}
+
+func TestEvalCueBinary(t *testing.T) {
+	if _, err := exec.LookPath("cue"); err != nil {
+		t.Skip("cue binary not on the path")
+	}
+	ctx := Context{App: "app1", Env: "prod", ParamsFile: "testdata/params.cue.libsonnet", DefaultNamespace: "web-ns"}
+	objs, err := Components([]model.Component{{Name: "web", File: "testdata/cue/web.cue"}}, ctx)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(objs))
+	a := assert.New(t)
+	web := objs[0]
+	a.Equal("Deployment", web.GetKind())
+	a.Equal("web", web.GetName())
+	a.Equal("web-ns", web.GetNamespace())
+	a.EqualValues(4, web.ToUnstructured().Object["spec"].(map[string]interface{})["replicas"])
+}
+
+func TestEvalCueNegative(t *testing.T) {
+	ctx := Context{App: "app1", Env: "dev", ParamsFile: "testdata/params.cue.libsonnet"}
+	comps := []model.Component{{Name: "web", File: "testdata/cue/web.cue"}}
+
+	_, reset := setupFakeCue(t, `"not objects"`)
+	_, err := Components(comps, ctx)
+	reset()
+	require.NotNil(t, err)
+	assert.Equal(t, "component web: objects must be a list or an object of objects", err.Error())
+
+	orig := runCue
+	runCue = func(args ...string) (string, error) {
+		return "", fmt.Errorf("cue export: exit status 1\nparams.replicas: invalid value 0")
+	}
+	defer func() { runCue = orig }()
+	_, err = Components(comps, ctx)
+	require.NotNil(t, err)
+	assert.Equal(t, "component web: cue export: exit status 1\nparams.replicas: invalid value 0", err.Error())
+}
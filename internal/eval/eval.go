@@ -30,22 +30,74 @@ import (
 
 // Context is the evaluation context
 type Context struct {
-	App     string // the application for which the evaluation is done
-	Env     string // the environment for which the evaluation is done
-	VM      *vm.VM // the base VM to use for eval
-	Verbose bool   // show generated code
+	App     string         // the application for which the evaluation is done
+	Env     string         // the environment for which the evaluation is done
+	Preview *model.Preview // preview details when the environment is a preview, nil otherwise
+	Cluster *model.Cluster // cluster details when the environment or the base of its preview is a cluster, nil otherwise
+	VM      *vm.VM         // the base VM to use for eval
+	Verbose bool           // show generated code
+
+	ParamsFile       string                        // the params file with the params of helm chart, kustomization and templated components
+	Properties       map[string]string             // the properties of the environment, for templates in YAML and JSON components
+	DefaultNamespace string                        // the namespace that helm charts are rendered for unless they or their descriptors set one
+	Limits           func(component string) Limits // returns the evaluation limits of a jsonnet component, no limits when nil
+}
+
+// envConfig returns the VM configuration with the environment variables set for the supplied context. For
+// previews and clusters, the environment variable is set to the base environment such that its parameters are used,
+// which for previews of clusters is the environment of the cluster.
+func envConfig(base vm.Config, ctx Context) (vm.Config, error) {
+	env := ctx.Env
+	preview, cluster := "null", "null"
+	if ctx.Preview != nil {
+		env = ctx.Preview.Base
+		b, err := json.Marshal(ctx.Preview)
+		if err != nil {
+			return base, errors.Wrap(err, "marshal preview")
+		}
+		preview = string(b)
+	}
+	if ctx.Cluster != nil {
+		env = ctx.Cluster.Base
+		b, err := json.Marshal(ctx.Cluster)
+		if err != nil {
+			return base, errors.Wrap(err, "marshal cluster")
+		}
+		cluster = string(b)
+	}
+	return base.WithVars(map[string]string{model.QbecNames.EnvVarName: env}).
+		WithCodeVars(map[string]string{
+			model.QbecNames.PreviewVarName: preview,
+			model.QbecNames.ClusterVarName: cluster,
+		}), nil
 }
 
 // Components evaluates the specified components using the specific runtime
-// parameters file and returns the result.
+// parameters file and returns the result. YAML and JSON components are expanded as templates, helm chart components
+// are rendered by helm, kustomizations are built by kustomize, CUE components are exported by cue and generated
+// components are yielded by the function of their generator.
 func Components(components []model.Component, ctx Context) ([]model.K8sLocalObject, error) {
 	if ctx.VM == nil {
 		ctx.VM = vm.New(vm.Config{})
 	}
-	cCode, err := evalComponents(components, ctx)
+	var files, others []model.Component
+	for _, c := range components {
+		if c.Chart != nil || c.Kustomization != nil || isDataComponent(c) || isCueComponent(c) {
+			others = append(others, c)
+		} else {
+			files = append(files, c)
+		}
+	}
+	cCode, err := evalComponents(files, ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "evaluate components")
 	}
+	if len(others) > 0 {
+		cCode, err = addObjects(cCode, others, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
 	objs, err := k8sObjectsFromJSONString(cCode, ctx.App, ctx.Env)
 	if err != nil {
 		return nil, errors.Wrap(err, "extract objects")
@@ -60,7 +112,10 @@ func Params(file string, ctx Context) (map[string]interface{}, error) {
 	if baseVM == nil {
 		baseVM = vm.New(vm.Config{})
 	}
-	cfg := baseVM.Config().WithVars(map[string]string{model.QbecNames.EnvVarName: ctx.Env})
+	cfg, err := envConfig(baseVM.Config(), ctx)
+	if err != nil {
+		return nil, err
+	}
 	jvm := vm.New(cfg)
 	code := fmt.Sprintf("import '%s'", file)
 	if ctx.Verbose {
@@ -80,25 +135,105 @@ func Params(file string, ctx Context) (map[string]interface{}, error) {
 	return ret, nil
 }
 
-func evalComponents(list []model.Component, ctx Context) (string, error) {
-	cfg := ctx.VM.Config().WithVars(map[string]string{model.QbecNames.EnvVarName: ctx.Env})
-	jvm := vm.New(cfg)
-	var lines []string
+// addObjects adds the objects of the supplied YAML, JSON, CUE, helm chart and kustomization components to the supplied
+// JSON output of evaluated components. The params of these components are taken from the params file, which is only
+// evaluated when they are needed.
+func addObjects(output string, list []model.Component, ctx Context) (string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &data); err != nil {
+		return "", err
+	}
+	var params map[string]interface{}
+	loadParams := func() (map[string]interface{}, error) {
+		if params == nil {
+			p, err := Params(ctx.ParamsFile, ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, "evaluate params for components")
+			}
+			params = p
+		}
+		return params, nil
+	}
 	for _, c := range list {
+		if isDataComponent(c) {
+			objs, err := dataObjects(c, ctx, loadParams)
+			if err != nil {
+				return "", err
+			}
+			data[c.Name] = objs
+			continue
+		}
+		p, err := loadParams()
+		if err != nil {
+			return "", err
+		}
+		components, _ := p["components"].(map[string]interface{})
+		var objs interface{}
 		switch {
-		case strings.HasSuffix(c.File, ".yaml"):
-			lines = append(lines, fmt.Sprintf("'%s': parseYaml(importstr '%s')", c.Name, c.File))
-		case strings.HasSuffix(c.File, ".json"):
-			lines = append(lines, fmt.Sprintf("'%s': parseJson(importstr '%s')", c.Name, c.File))
+		case c.Chart != nil:
+			objs, err = chartObjects(c, components[c.Name], ctx)
+		case c.Kustomization != nil:
+			objs, err = kustomizeObjects(c, components[c.Name], ctx)
 		default:
-			lines = append(lines, fmt.Sprintf("'%s': import '%s'", c.Name, c.File))
+			objs, err = cueObjects(c, components[c.Name], ctx)
 		}
+		if err != nil {
+			return "", err
+		}
+		data[c.Name] = objs
 	}
-	preamble := []string{
-		"local parseYaml = std.native('parseYaml');",
-		"local parseJson = std.native('parseJson');",
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
 	}
-	code := strings.Join(preamble, "\n") + "\n{\n  " + strings.Join(lines, ",\n  ") + "\n}"
+	return string(b), nil
+}
+
+// evalComponents evaluates the supplied jsonnet components, calling the function of the generator of generated
+// components with their name and data, and returns an object keyed by component name. Components with evaluation
+// limits are evaluated on their own. No components are evaluated after an evaluation was aborted.
+func evalComponents(list []model.Component, ctx Context) (string, error) {
+	if err := abortedError(); err != nil {
+		return "", err
+	}
+	cfg, err := envConfig(ctx.VM.Config(), ctx)
+	if err != nil {
+		return "", err
+	}
+	jvm := vm.New(cfg)
+	var lines []string
+	limited := map[string]json.RawMessage{}
+	for _, c := range list {
+		expr := fmt.Sprintf("import '%s'", c.File)
+		if c.Generator != nil {
+			name, err := json.Marshal(strings.TrimPrefix(c.Name, c.Generator.Name+"/"))
+			if err != nil {
+				return "", err
+			}
+			data, err := json.Marshal(c.GeneratorData)
+			if err != nil {
+				return "", errors.Wrapf(err, "marshal data of component %s", c.Name)
+			}
+			expr = fmt.Sprintf("(import '%s')(%s, %s)", c.File, name, data)
+		}
+		var limits Limits
+		if ctx.Limits != nil {
+			limits = ctx.Limits(c.Name)
+		}
+		if !limits.isSet() {
+			lines = append(lines, fmt.Sprintf("'%s': %s", c.Name, expr))
+			continue
+		}
+		if ctx.Verbose {
+			sio.Debugf("Eval component %s with limits:\n%s\n", c.Name, expr)
+		}
+		out, err := evaluateWithLimits(cfg, c.Name, "component-loader.jsonnet", expr, limits)
+		if err != nil {
+			return "", err
+		}
+		limited[c.Name] = json.RawMessage(out)
+	}
+	code := "{\n  " + strings.Join(lines, ",\n  ") + "\n}"
 	if ctx.Verbose {
 		sio.Debugln("Eval components:\n" + code)
 	}
@@ -109,7 +244,21 @@ func evalComponents(list []model.Component, ctx Context) (string, error) {
 	if ctx.Verbose {
 		sio.Debugln("Eval components output:\n" + prettyJSON(ret))
 	}
-	return ret, nil
+	if len(limited) == 0 {
+		return ret, nil
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(ret), &all); err != nil {
+		return "", err
+	}
+	for name, out := range limited {
+		all[name] = out
+	}
+	b, err := json.Marshal(all)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
 }
 
 func prettyJSON(s string) string {
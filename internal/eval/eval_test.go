@@ -17,6 +17,7 @@
 package eval
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/splunk/qbec/internal/model"
@@ -39,6 +40,63 @@ func TestEvalParams(t *testing.T) {
 	a.EqualValues("dev", base["env"])
 }
 
+func TestEvalParamsPreview(t *testing.T) {
+	base := func(ctx Context) map[string]interface{} {
+		paramsMap, err := Params("testdata/params.preview.libsonnet", ctx)
+		require.Nil(t, err)
+		comps, ok := paramsMap["components"].(map[string]interface{})
+		require.True(t, ok)
+		base, ok := comps["base"].(map[string]interface{})
+		require.True(t, ok)
+		return base
+	}
+	a := assert.New(t)
+	p := base(Context{Env: "dev"})
+	a.EqualValues("dev", p["env"])
+	a.EqualValues("dev.example.com", p["host"])
+
+	p = base(Context{Env: "dev-pr-1", Preview: &model.Preview{
+		Env:    "dev-pr-1",
+		Base:   "dev",
+		Suffix: "pr-1",
+		Props:  map[string]string{"host": "pr-1.example.com"},
+	}})
+	a.EqualValues("dev", p["env"])
+	a.EqualValues("pr-1.example.com", p["host"])
+}
+
+func TestEvalParamsCluster(t *testing.T) {
+	base := func(ctx Context) map[string]interface{} {
+		paramsMap, err := Params("testdata/params.cluster.libsonnet", ctx)
+		require.Nil(t, err)
+		comps, ok := paramsMap["components"].(map[string]interface{})
+		require.True(t, ok)
+		base, ok := comps["base"].(map[string]interface{})
+		require.True(t, ok)
+		return base
+	}
+	a := assert.New(t)
+	p := base(Context{Env: "prod"})
+	a.EqualValues(map[string]interface{}{"env": "prod", "cluster": "default", "host": "prod.example.com"}, p)
+
+	cluster := &model.Cluster{
+		Env:        "prod.us-east",
+		Base:       "prod",
+		Name:       "us-east",
+		Properties: map[string]string{"domain": "us-east.example.com"},
+	}
+	p = base(Context{Env: "prod.us-east", Cluster: cluster})
+	a.EqualValues(map[string]interface{}{"env": "prod", "cluster": "us-east", "host": "us-east.example.com"}, p)
+
+	p = base(Context{Env: "prod.us-east-pr-1", Cluster: cluster, Preview: &model.Preview{
+		Env:    "prod.us-east-pr-1",
+		Base:   "prod.us-east",
+		Suffix: "pr-1",
+	}})
+	a.EqualValues("prod", p["env"])
+	a.EqualValues("us-east", p["cluster"])
+}
+
 func TestEvalParamsNegative(t *testing.T) {
 	_, err := Params("testdata/params.invalid.libsonnet", Context{Env: "dev"})
 	require.NotNil(t, err)
@@ -120,3 +178,24 @@ func TestEvalComponentsBadObjects(t *testing.T) {
 	require.NotNil(t, err)
 	require.Contains(t, err.Error(), `unexpected type for object (string) at path "$.bad[0].foo"`)
 }
+
+func TestEvalGeneratedComponents(t *testing.T) {
+	g := &model.Generator{Name: "tenants", File: "testdata/generators/tenant.libsonnet", Source: "tenants.yaml"}
+	objs, err := Components([]model.Component{
+		{Name: "a", File: "testdata/components/a.json"},
+		{Name: "tenants/acme", File: g.File, Generator: g, GeneratorData: map[string]interface{}{"plan": "gold"}},
+		{Name: "tenants/globex", File: g.File, Generator: g},
+	}, Context{App: "app1", Env: "dev"})
+	require.Nil(t, err)
+	a := assert.New(t)
+	plans := map[string]interface{}{}
+	for _, o := range objs {
+		if o.Component() == "a" {
+			continue
+		}
+		a.Equal("dev", o.GetNamespace())
+		a.Equal("tenant-"+strings.TrimPrefix(o.Component(), "tenants/"), o.GetName())
+		plans[o.Component()] = o.ToUnstructured().Object["data"].(map[string]interface{})["plan"]
+	}
+	a.Equal(map[string]interface{}{"tenants/acme": "gold", "tenants/globex": "free"}, plans)
+}
@@ -0,0 +1,469 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/getter"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/renderutil"
+	"k8s.io/helm/pkg/repo"
+)
+
+// chartCacheDir is the directory, relative to the app root, where charts pulled from repositories and OCI registries
+// are cached.
+const chartCacheDir = ".qbec/charts"
+
+// media types of the OCI manifests of charts and of the layers that have the chart archives.
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociChartMediaType    = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// chartGetters fetch the indexes and charts of chart repositories.
+var chartGetters = getter.Providers{
+	{
+		Schemes: []string{"http", "https"},
+		New: func(u, certFile, keyFile, caFile string) (getter.Getter, error) {
+			return getter.NewHTTPGetter(u, certFile, keyFile, caFile)
+		},
+	},
+}
+
+// registryClient is the HTTP client for OCI registries.
+var registryClient = &http.Client{Timeout: 30 * time.Second}
+
+// exactChartVersion matches chart versions that are not ranges. Only charts pulled for these versions are cached
+// since a range can resolve to a newer version later.
+var exactChartVersion = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// renderedCharts caches the objects of rendered charts keyed by a hash of the chart, its values and namespace, such
+// that charts are rendered at most once per run for the same inputs.
+var renderedCharts = struct {
+	l       sync.Mutex
+	objects map[string][]interface{}
+}{objects: map[string][]interface{}{}}
+
+func hashOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// pullRepoChart returns the archive of the named chart in the supplied chart repository, for a version that may be
+// a range.
+func pullRepoChart(repoURL, name, version string) ([]byte, error) {
+	u, err := repo.FindChartInRepoURL(repoURL, name, version, "", "", "", chartGetters)
+	if err != nil {
+		return nil, err
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	newGetter, err := chartGetters.ByScheme(pu.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	g, err := newGetter(u, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	b, err := g.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// challengeParam matches the parameters of an authentication challenge.
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryToken returns an anonymous token from the authorization server of the supplied bearer challenge.
+func registryToken(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	u, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid realm in authentication challenge %q", challenge)
+	}
+	q := u.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	u.RawQuery = q.Encode()
+	res, err := registryClient.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get token: %s", res.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "decode token")
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("no token returned by %s", u.Host)
+	}
+	return body.Token, nil
+}
+
+// registryGet returns the content of the supplied path of an OCI repository. The supplied token is set to an
+// anonymous token when the registry asks for one.
+func registryGet(registry, repository, p, accept string, token *string) ([]byte, error) {
+	get := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v2/%s/%s", registry, repository, p), nil)
+		if err != nil {
+			return nil, err
+		}
+		if *token != "" {
+			req.Header.Set("Authorization", "Bearer "+*token)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		return registryClient.Do(req)
+	}
+	res, err := get()
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized && *token == "" {
+		res.Body.Close()
+		if *token, err = registryToken(res.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, err
+		}
+		if res, err = get(); err != nil {
+			return nil, err
+		}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %s", p, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// pullOCIChart returns the archive of the supplied version of an oci:// chart, verified against its digest.
+func pullOCIChart(ref, version string) ([]byte, error) {
+	s := strings.TrimPrefix(ref, "oci://")
+	pos := strings.Index(s, "/")
+	if pos <= 0 || pos == len(s)-1 {
+		return nil, fmt.Errorf("invalid oci reference %q, must be oci://<registry>/<repository>", ref)
+	}
+	registry, repository := s[:pos], s[pos+1:]
+	var token string
+	// OCI tags cannot have a '+', which helm replaces with an underscore when pushing charts
+	b, err := registryGet(registry, repository, "manifests/"+strings.Replace(version, "+", "_", -1), ociManifestMediaType, &token)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal manifest")
+	}
+	for _, l := range manifest.Layers {
+		if l.MediaType != ociChartMediaType {
+			continue
+		}
+		content, err := registryGet(registry, repository, "blobs/"+l.Digest, "", &token)
+		if err != nil {
+			return nil, err
+		}
+		if actual := "sha256:" + hashOf(string(content)); actual != l.Digest {
+			return nil, fmt.Errorf("chart digest mismatch, want %s, got %s", l.Digest, actual)
+		}
+		return content, nil
+	}
+	return nil, fmt.Errorf("manifest of %s:%s has no chart layer", ref, version)
+}
+
+// pullChart returns the archive of the supplied chart from a repository or OCI registry, pulling it into the cache
+// when it is not already there. Charts with a version range are pulled every time and stored by their content.
+func pullChart(h *model.HelmChart) (string, error) {
+	key := h.Repo + "|" + h.Chart + "|" + h.Version
+	exact := exactChartVersion.MatchString(h.Version)
+	if exact {
+		file := filepath.Join(chartCacheDir, hashOf(key), path.Base(h.Chart)+".tgz")
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	var b []byte
+	var err error
+	if h.IsOCI() {
+		b, err = pullOCIChart(h.Chart, h.Version)
+	} else {
+		b, err = pullRepoChart(h.Repo, h.Chart, h.Version)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !exact {
+		key += "|" + hashOf(string(b))
+	}
+	dir := filepath.Join(chartCacheDir, hashOf(key))
+	file := filepath.Join(dir, path.Base(h.Chart)+".tgz")
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := ioutil.WriteFile(filepath.Join(tmp, filepath.Base(file)), b, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(file); statErr != nil {
+			return "", err
+		}
+	}
+	return file, nil
+}
+
+// chartRequirements returns the dependencies of the supplied local chart from its requirements.yaml, or from its
+// Chart.yaml for charts with API version v2. In the latter case, they are added to the chart as its requirements
+// such that their conditions, tags, aliases and imported values are processed when it is rendered.
+func chartRequirements(c *chart.Chart, dir string) (*chartutil.Requirements, error) {
+	reqs, err := chartutil.LoadRequirements(c)
+	if err != chartutil.ErrRequirementsNotFound {
+		return reqs, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	reqs = &chartutil.Requirements{}
+	if err := yaml.Unmarshal(b, reqs); err != nil {
+		return nil, errors.Wrap(err, "parse Chart.yaml")
+	}
+	if len(reqs.Dependencies) > 0 {
+		out, err := yaml.Marshal(reqs)
+		if err != nil {
+			return nil, err
+		}
+		c.Files = append(c.Files, &any.Any{TypeUrl: "requirements.yaml", Value: out})
+	}
+	return reqs, nil
+}
+
+// loadDependency loads the chart of the supplied dependency of the local chart in the supplied directory.
+func loadDependency(d *chartutil.Dependency, dir string) (*chart.Chart, error) {
+	var h *model.HelmChart
+	switch {
+	case strings.HasPrefix(d.Repository, "file://"):
+		return chartutil.Load(filepath.Join(dir, strings.TrimPrefix(d.Repository, "file://")))
+	case strings.HasPrefix(d.Repository, "oci://"):
+		h = &model.HelmChart{Chart: strings.TrimSuffix(d.Repository, "/") + "/" + d.Name, Version: d.Version}
+	case strings.HasPrefix(d.Repository, "http://"), strings.HasPrefix(d.Repository, "https://"):
+		h = &model.HelmChart{Chart: d.Name, Repo: d.Repository, Version: d.Version}
+	default:
+		return nil, fmt.Errorf("repository %q is not a URL", d.Repository)
+	}
+	file, err := pullChart(h)
+	if err != nil {
+		return nil, errors.Wrap(err, "pull")
+	}
+	return chartutil.Load(file)
+}
+
+// loadChart loads the supplied chart, pulling it when it is not local. The dependencies of a local chart that are not
+// in its charts directory are pulled and added to it as subcharts.
+func loadChart(h *model.HelmChart) (*chart.Chart, error) {
+	if !h.IsLocal() {
+		file, err := pullChart(h)
+		if err != nil {
+			return nil, errors.Wrap(err, "pull")
+		}
+		return chartutil.Load(file)
+	}
+	c, err := chartutil.Load(h.Chart)
+	if err != nil {
+		return nil, err
+	}
+	reqs, err := chartRequirements(c, h.Chart)
+	if err != nil {
+		return nil, errors.Wrap(err, "load dependencies")
+	}
+	present := map[string]bool{}
+	for _, sub := range c.Dependencies {
+		present[sub.Metadata.Name] = true
+	}
+	for _, d := range reqs.Dependencies {
+		if present[d.Name] {
+			continue
+		}
+		sub, err := loadDependency(d, h.Chart)
+		if err != nil {
+			return nil, errors.Wrapf(err, "dependency %s", d.Name)
+		}
+		c.Dependencies = append(c.Dependencies, sub)
+		present[d.Name] = true
+	}
+	return c, nil
+}
+
+// chartManifests returns the objects of the CRDs in the crds directories of the supplied chart and its enabled
+// subcharts, followed by those of the rendered templates in the order of their names. Notes are ignored.
+func chartManifests(c *chart.Chart, rendered map[string]string) ([]interface{}, error) {
+	var docs []string
+	var addCRDs func(c *chart.Chart)
+	addCRDs = func(c *chart.Chart) {
+		for _, f := range c.Files {
+			ext := path.Ext(f.TypeUrl)
+			if strings.HasPrefix(f.TypeUrl, "crds/") && (ext == ".yaml" || ext == ".yml" || ext == ".json") {
+				docs = append(docs, string(f.Value))
+			}
+		}
+		for _, sub := range c.Dependencies {
+			addCRDs(sub)
+		}
+	}
+	addCRDs(c)
+	var names []string
+	for name := range rendered {
+		if path.Base(name) == "NOTES.txt" || strings.HasPrefix(path.Base(name), "_") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		docs = append(docs, rendered[name])
+	}
+	objs := []interface{}{}
+	for _, doc := range docs {
+		d := k8syaml.NewYAMLToJSONDecoder(strings.NewReader(doc))
+		for {
+			var obj interface{}
+			if err := d.Decode(&obj); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, errors.Wrap(err, "parse rendered manifests")
+			}
+			if obj != nil {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return objs, nil
+}
+
+// renderChart returns the objects that the supplied chart renders with the supplied values and namespace.
+func renderChart(h *model.HelmChart, values map[string]interface{}, namespace string, verbose bool) ([]interface{}, error) {
+	if h.Namespace != "" {
+		namespace = h.Namespace
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	key := hashOf(fmt.Sprintf("%s|%s|%s|%s", h, h.ReleaseName, namespace, b))
+	renderedCharts.l.Lock()
+	objs, ok := renderedCharts.objects[key]
+	renderedCharts.l.Unlock()
+	if ok {
+		return objs, nil
+	}
+	c, err := loadChart(h)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		sio.Debugf("Render chart %s as release %s in namespace %q with values:\n%s\n", h, h.ReleaseName, namespace, b)
+	}
+	rendered, err := renderutil.Render(c, &chart.Config{Raw: string(b)}, renderutil.Options{
+		ReleaseOptions: chartutil.ReleaseOptions{Name: h.ReleaseName, Namespace: namespace, Revision: 1, IsInstall: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	objs, err = chartManifests(c, rendered)
+	if err != nil {
+		return nil, err
+	}
+	renderedCharts.l.Lock()
+	renderedCharts.objects[key] = objs
+	renderedCharts.l.Unlock()
+	return objs, nil
+}
+
+// chartObjects returns the objects of the supplied helm chart component rendered with the supplied params as values.
+func chartObjects(c model.Component, params interface{}, ctx Context) ([]interface{}, error) {
+	values := map[string]interface{}{}
+	if params != nil {
+		m, ok := params.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("component %s: params of a helm chart must be an object of chart values", c.Name)
+		}
+		values = m
+	}
+	namespace := ctx.DefaultNamespace
+	if c.Descriptor != nil && c.Descriptor.Namespace != "" {
+		namespace = c.Descriptor.Namespace
+	}
+	objs, err := renderChart(c.Chart, values, namespace, ctx.Verbose)
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s: render helm chart %s", c.Name, c.Chart)
+	}
+	return objs, nil
+}
@@ -0,0 +1,302 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/repo"
+)
+
+func resetCharts() {
+	renderedCharts.objects = map[string][]interface{}{}
+}
+
+// inTempDir changes the working directory to a temporary one, such that charts are pulled into a fresh cache, and
+// returns a function that changes it back.
+func inTempDir(t *testing.T) func() {
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	dir, err := ioutil.TempDir("", "helm-charts")
+	require.Nil(t, err)
+	require.Nil(t, os.Chdir(dir))
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+// packageChart returns the archive of the chart in the supplied directory.
+func packageChart(t *testing.T, dir string) []byte {
+	c, err := chartutil.Load(dir)
+	require.Nil(t, err)
+	out, err := ioutil.TempDir("", "helm-package")
+	require.Nil(t, err)
+	defer os.RemoveAll(out)
+	file, err := chartutil.Save(c, out)
+	require.Nil(t, err)
+	b, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+	return b
+}
+
+// chartRepo is a chart repository that serves the supplied chart and counts the requests for it.
+type chartRepo struct {
+	*httptest.Server
+	pulls int
+}
+
+func newChartRepo(t *testing.T, dir string) *chartRepo {
+	b := packageChart(t, dir)
+	c, err := chartutil.Load(dir)
+	require.Nil(t, err)
+	r := &chartRepo{}
+	name := fmt.Sprintf("%s-%s.tgz", c.Metadata.Name, c.Metadata.Version)
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/index.yaml":
+			index := repo.NewIndexFile()
+			index.Add(c.Metadata, name, r.URL, "")
+			out, err := yaml.Marshal(index)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write(out)
+		case "/" + name:
+			r.pulls++
+			w.Write(b)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return r
+}
+
+func TestEvalHelmChartLocal(t *testing.T) {
+	resetCharts()
+	ctx := Context{App: "app1", Env: "dev", ParamsFile: "testdata/params.helm.libsonnet", DefaultNamespace: "web"}
+	comps := []model.Component{
+		{Name: "a", File: "testdata/components/a.json"},
+		{Name: "nginx", File: "testdata/charts/nginx", Chart: &model.HelmChart{Name: "nginx", Chart: "testdata/charts/nginx", ReleaseName: "edge"}},
+	}
+	objs, err := Components(comps, ctx)
+	require.Nil(t, err)
+	a := assert.New(t)
+	var found []model.K8sLocalObject
+	for _, o := range objs {
+		if o.Component() == "nginx" {
+			found = append(found, o)
+		}
+	}
+	require.Equal(t, 2, len(found))
+	a.Equal("CustomResourceDefinition", found[0].GetKind())
+	a.Equal("routes.example.com", found[0].GetName())
+	d := found[1]
+	a.Equal("Deployment", d.GetKind())
+	a.Equal("edge", d.GetName())
+	a.Equal("web", d.GetNamespace())
+	a.Equal("dev", d.Environment())
+	labels := d.ToUnstructured().GetLabels()
+	a.Equal("nginx", labels["app"])
+	a.Equal("edge", labels["release"])
+	a.EqualValues(3, d.ToUnstructured().Object["spec"].(map[string]interface{})["replicas"])
+	a.Equal(1, len(renderedCharts.objects))
+
+	// the same chart with the same values is only rendered once
+	_, err = Components(comps, ctx)
+	require.Nil(t, err)
+	a.Equal(1, len(renderedCharts.objects))
+	ctx.Env = "prod"
+	objs, err = Components(comps, ctx)
+	require.Nil(t, err)
+	a.Equal(2, len(renderedCharts.objects))
+	for _, o := range objs {
+		if o.GetKind() == "Deployment" {
+			a.EqualValues(4, o.ToUnstructured().Object["spec"].(map[string]interface{})["replicas"])
+		}
+	}
+}
+
+func TestEvalHelmChartDependencies(t *testing.T) {
+	resetCharts()
+	a := assert.New(t)
+	chart := &model.HelmChart{Name: "umbrella", Chart: "testdata/charts/umbrella", ReleaseName: "umbrella", Namespace: "cache"}
+	objs, err := renderChart(chart, map[string]interface{}{}, "web", false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(objs))
+	svc := objs[0].(map[string]interface{})
+	a.Equal("Service", svc["kind"])
+	a.Equal(map[string]interface{}{"name": "umbrella-redis", "namespace": "cache"}, svc["metadata"])
+	_, err = os.Stat("testdata/charts/umbrella/charts")
+	a.True(os.IsNotExist(err))
+
+	// conditions of the dependencies in Chart.yaml are honored
+	objs, err = renderChart(chart, map[string]interface{}{"redis": map[string]interface{}{"enabled": false}}, "web", false)
+	require.Nil(t, err)
+	a.Equal(0, len(objs))
+}
+
+func TestEvalHelmChartRemoteDependencies(t *testing.T) {
+	resetCharts()
+	r := newChartRepo(t, "testdata/charts/redis")
+	defer r.Close()
+	dir, err := ioutil.TempDir("", "helm-umbrella")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "templates"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: umbrella\nversion: 1.0.0\n"), 0644))
+	reqs := fmt.Sprintf("dependencies:\n- name: redis\n  version: ^17.0.0\n  repository: %s\n", r.URL)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "requirements.yaml"), []byte(reqs), 0644))
+	defer inTempDir(t)()
+
+	chart := &model.HelmChart{Name: "umbrella", Chart: dir, ReleaseName: "umbrella"}
+	objs, err := renderChart(chart, map[string]interface{}{}, "web", false)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(objs))
+	assert.Equal(t, "Service", objs[0].(map[string]interface{})["kind"])
+	assert.Equal(t, 1, r.pulls)
+}
+
+func TestEvalHelmChartRemote(t *testing.T) {
+	resetCharts()
+	r := newChartRepo(t, "testdata/charts/nginx")
+	defer r.Close()
+	defer inTempDir(t)()
+
+	a := assert.New(t)
+	chart := &model.HelmChart{Name: "nginx", Chart: "nginx", Repo: r.URL, Version: "1.0.0", ReleaseName: "nginx"}
+	objs, err := renderChart(chart, map[string]interface{}{}, "web", false)
+	require.Nil(t, err)
+	a.Equal(2, len(objs))
+	a.Equal(1, r.pulls)
+	archives, err := filepath.Glob(filepath.Join(chartCacheDir, "*", "nginx.tgz"))
+	require.Nil(t, err)
+	a.Equal(1, len(archives))
+
+	// the pulled chart is used from the cache
+	_, err = renderChart(chart, map[string]interface{}{"replicas": 2}, "web", false)
+	require.Nil(t, err)
+	a.Equal(1, r.pulls)
+	a.Equal(2, len(renderedCharts.objects))
+}
+
+func TestEvalHelmChartRemoteRange(t *testing.T) {
+	resetCharts()
+	r := newChartRepo(t, "testdata/charts/nginx")
+	defer r.Close()
+	defer inTempDir(t)()
+
+	a := assert.New(t)
+	chart := &model.HelmChart{Name: "nginx", Chart: "nginx", Repo: r.URL, Version: "^1.0.0", ReleaseName: "nginx"}
+	_, err := renderChart(chart, map[string]interface{}{}, "web", false)
+	require.Nil(t, err)
+	a.Equal(1, r.pulls)
+
+	// a version range is resolved again, and the chart is stored once for the same content
+	_, err = renderChart(chart, map[string]interface{}{"replicas": 2}, "web", false)
+	require.Nil(t, err)
+	a.Equal(2, r.pulls)
+	archives, err := filepath.Glob(filepath.Join(chartCacheDir, "*", "nginx.tgz"))
+	require.Nil(t, err)
+	a.Equal(1, len(archives))
+}
+
+func TestEvalHelmChartOCI(t *testing.T) {
+	resetCharts()
+	b := packageChart(t, "testdata/charts/nginx")
+	sum := sha256.Sum256(b)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	var s *httptest.Server
+	s = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			if req.URL.Query().Get("scope") != "repository:charts/nginx:pull" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token":"t1"}`))
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer t1" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:charts/nginx:pull"`, s.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/v2/charts/nginx/manifests/1.0.0_build.1":
+			fmt.Fprintf(w, `{"layers":[{"mediaType":"%s","digest":"sha256:0"},{"mediaType":"%s","digest":"%s"}]}`,
+				"application/vnd.cncf.helm.config.v1+json", ociChartMediaType, digest)
+		case "/v2/charts/nginx/blobs/" + digest:
+			w.Write(b)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	orig := registryClient
+	registryClient = s.Client()
+	defer func() { registryClient = orig }()
+	defer inTempDir(t)()
+
+	ref := "oci://" + strings.TrimPrefix(s.URL, "https://") + "/charts/nginx"
+	chart := &model.HelmChart{Name: "nginx", Chart: ref, Version: "1.0.0+build.1", ReleaseName: "nginx"}
+	objs, err := renderChart(chart, map[string]interface{}{}, "web", false)
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(objs))
+
+	chart.Version = "2.0.0"
+	_, err = renderChart(chart, map[string]interface{}{}, "web", false)
+	require.NotNil(t, err)
+	assert.Equal(t, "pull: get manifests/2.0.0: 404 Not Found", err.Error())
+}
+
+func TestEvalHelmChartNegative(t *testing.T) {
+	resetCharts()
+	ctx := Context{App: "app1", Env: "dev", ParamsFile: "testdata/params.helm.libsonnet"}
+	comps := []model.Component{
+		{Name: "bad", File: "testdata/charts/nginx", Chart: &model.HelmChart{Name: "bad", Chart: "testdata/charts/nginx", ReleaseName: "bad"}},
+	}
+	_, err := Components(comps, ctx)
+	require.NotNil(t, err)
+	assert.Equal(t, "component bad: params of a helm chart must be an object of chart values", err.Error())
+
+	comps = []model.Component{
+		{Name: "broken", File: "testdata/charts/broken", Chart: &model.HelmChart{Name: "broken", Chart: "testdata/charts/broken", ReleaseName: "broken"}},
+	}
+	_, err = Components(comps, ctx)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "component broken: render helm chart testdata/charts/broken: parse error")
+
+	comps[0].Chart.Chart = "testdata/charts/missing"
+	_, err = Components(comps, ctx)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "component broken: render helm chart testdata/charts/missing:")
+}
@@ -0,0 +1,140 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/parser"
+	"github.com/pkg/errors"
+)
+
+// Dependencies returns the absolute paths of the supplied file and all files that it imports, directly or
+// indirectly, in sorted order. Imports are resolved in the same way as the jsonnet VM does, relative to the
+// importing file first and then in the supplied library paths, searched last to first. Imports that cannot be
+// resolved are ignored since evaluating the file will fail in any case.
+func Dependencies(file string, libPaths []string) ([]string, error) {
+	seen := map[string]bool{}
+	var visit func(file string, isCode bool) error
+	visit = func(file string, isCode bool) error {
+		if seen[file] {
+			return nil
+		}
+		seen[file] = true
+		if !isCode {
+			return nil
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		node, err := parse(file, string(b))
+		if err != nil {
+			return errors.Wrapf(err, "parse %s", file)
+		}
+		for _, imp := range imports(node) {
+			resolved := resolveImport(filepath.Dir(file), imp.path, libPaths)
+			if resolved == "" {
+				continue
+			}
+			if err := visit(resolved, imp.code); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(abs)
+	if err := visit(abs, ext != ".yaml" && ext != ".json"); err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(seen))
+	for f := range seen {
+		ret = append(ret, f)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// parse returns the AST for the supplied code without desugaring it, such that it can be walked using
+// the parser's functions for child nodes.
+func parse(file string, code string) (ast.Node, error) {
+	tokens, err := parser.Lex(file, code)
+	if err != nil {
+		return nil, err
+	}
+	return parser.Parse(tokens)
+}
+
+type importRef struct {
+	path string // the imported path as written in the file
+	code bool   // true for imports of jsonnet code as opposed to strings
+}
+
+// imports returns the imports found anywhere in the supplied node.
+func imports(node ast.Node) []importRef {
+	var ret []importRef
+	var walk func(n ast.Node)
+	walk = func(n ast.Node) {
+		if n == nil { // optional children, e.g. a missing else branch
+			return
+		}
+		switch i := n.(type) {
+		case *ast.Import:
+			ret = append(ret, importRef{path: i.File.Value, code: true})
+		case *ast.ImportStr:
+			ret = append(ret, importRef{path: i.File.Value})
+		}
+		for _, c := range parser.Children(n) {
+			walk(c)
+		}
+	}
+	walk(node)
+	return ret
+}
+
+// resolveImport returns the absolute path of the imported file or a blank string if it could not be found.
+func resolveImport(dir string, imported string, libPaths []string) string {
+	candidates := []string{imported}
+	if !filepath.IsAbs(imported) {
+		candidates = []string{filepath.Join(dir, imported)}
+		for i := len(libPaths) - 1; i >= 0; i-- {
+			candidates = append(candidates, filepath.Join(libPaths[i], imported))
+		}
+	}
+	for _, c := range candidates {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+		if st, err := os.Stat(c); err == nil && !st.IsDir() {
+			abs, err := filepath.Abs(c)
+			if err != nil {
+				return ""
+			}
+			return abs
+		}
+	}
+	return ""
+}
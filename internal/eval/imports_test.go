@@ -0,0 +1,60 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func relativeDeps(t *testing.T, file string, libPaths []string) []string {
+	deps, err := Dependencies(file, libPaths)
+	require.Nil(t, err)
+	base, err := filepath.Abs("testdata/imports")
+	require.Nil(t, err)
+	var ret []string
+	for _, d := range deps {
+		rel, err := filepath.Rel(base, d)
+		require.Nil(t, err)
+		ret = append(ret, filepath.ToSlash(rel))
+	}
+	return ret
+}
+
+func TestDependencies(t *testing.T) {
+	a := assert.New(t)
+	deps := relativeDeps(t, "testdata/imports/main.jsonnet", []string{"testdata/imports/vendor", "testdata/imports/lib"})
+	a.EqualValues([]string{"a.libsonnet", "data.txt", "lib/b.libsonnet", "lib/c.libsonnet", "main.jsonnet"}, deps)
+
+	deps = relativeDeps(t, "testdata/imports/main.jsonnet", []string{"testdata/imports/lib", "testdata/imports/vendor"})
+	a.EqualValues([]string{"a.libsonnet", "data.txt", "main.jsonnet", "vendor/b.libsonnet"}, deps)
+
+	deps = relativeDeps(t, "testdata/imports/config.yaml", nil)
+	a.EqualValues([]string{"config.yaml"}, deps)
+}
+
+func TestDependenciesNegative(t *testing.T) {
+	_, err := Dependencies("testdata/params.invalid.libsonnet", nil)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "parse")
+
+	_, err = Dependencies("testdata/imports/does-not-exist.jsonnet", nil)
+	require.NotNil(t, err)
+}
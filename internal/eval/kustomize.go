@@ -0,0 +1,178 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/k8sdeps"
+	"sigs.k8s.io/kustomize/pkg/fs"
+	"sigs.k8s.io/kustomize/pkg/loader"
+	"sigs.k8s.io/kustomize/pkg/target"
+)
+
+// runKustomize builds the kustomization at the supplied path, a directory or a remote base, with the embedded
+// kustomize library and returns the YAML of the built objects.
+var runKustomize = func(path string) (string, error) {
+	fSys := fs.MakeRealFS()
+	ldr, err := loader.NewLoader(path, fSys)
+	if err != nil {
+		return "", err
+	}
+	defer ldr.Cleanup()
+	f := k8sdeps.NewFactory()
+	kt, err := target.NewKustTarget(ldr, f.ResmapF, f.TransformerF)
+	if err != nil {
+		return "", err
+	}
+	m, err := kt.MakeCustomizedResMap()
+	if err != nil {
+		return "", err
+	}
+	b, err := m.EncodeAsYaml()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// kustomizeBuild is the output of building a kustomization, which is built once by the first caller that needs it.
+type kustomizeBuild struct {
+	once   sync.Once
+	output string
+	err    error
+}
+
+// builtKustomizations caches the builds of kustomizations keyed by path, such that a kustomization is built at most
+// once per run even when environments are evaluated in parallel. The lock only guards the map, builds of different
+// kustomizations run concurrently.
+var builtKustomizations = struct {
+	l      sync.Mutex
+	builds map[string]*kustomizeBuild
+}{builds: map[string]*kustomizeBuild{}}
+
+// buildKustomization returns the objects produced by building the supplied kustomization.
+func buildKustomization(k *model.Kustomization, verbose bool) ([]interface{}, error) {
+	builtKustomizations.l.Lock()
+	b, ok := builtKustomizations.builds[k.Path]
+	if !ok {
+		b = &kustomizeBuild{}
+		builtKustomizations.builds[k.Path] = b
+	}
+	builtKustomizations.l.Unlock()
+	b.once.Do(func() {
+		if verbose {
+			sio.Debugln("Build kustomization " + k.Path)
+		}
+		b.output, b.err = runKustomize(k.Path)
+	})
+	if b.err != nil {
+		return nil, b.err
+	}
+	out := b.output
+
+	// objects are decoded for every call since patches modify them
+	objs := []interface{}{}
+	d := k8syaml.NewYAMLToJSONDecoder(strings.NewReader(out))
+	for {
+		var doc interface{}
+		if err := d.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "parse built manifests")
+		}
+		if doc != nil {
+			objs = append(objs, doc)
+		}
+	}
+	return objs, nil
+}
+
+// mergePatch returns the result of applying the supplied JSON merge patch to the supplied value.
+func mergePatch(value, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	v, ok := value.(map[string]interface{})
+	if !ok {
+		v = map[string]interface{}{}
+	}
+	for k, pv := range p {
+		if pv == nil {
+			delete(v, k)
+			continue
+		}
+		v[k] = mergePatch(v[k], pv)
+	}
+	return v
+}
+
+// patchKey returns the key of the supplied object that patches are matched by, which is its kind and name.
+func patchKey(obj interface{}) string {
+	m, _ := obj.(map[string]interface{})
+	meta, _ := m["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v/%v", m["kind"], meta["name"])
+}
+
+// kustomizeObjects returns the objects of the supplied kustomization component with the supplied params applied as
+// merge patches keyed by the kind and name of the objects that they patch.
+func kustomizeObjects(c model.Component, params interface{}, ctx Context) ([]interface{}, error) {
+	patches := map[string]interface{}{}
+	if params != nil {
+		m, ok := params.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("component %s: params of a kustomization must be an object of patches keyed by kind/name", c.Name)
+		}
+		patches = m
+	}
+	objs, err := buildKustomization(c.Kustomization, ctx.Verbose)
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s: build kustomization %s", c.Name, c.Kustomization.Path)
+	}
+	matched := map[string]bool{}
+	for i, obj := range objs {
+		key := patchKey(obj)
+		if patch, ok := patches[key]; ok {
+			if _, ok := patch.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("component %s: patch %s must be an object", c.Name, key)
+			}
+			objs[i] = mergePatch(obj, patch)
+			matched[key] = true
+		}
+	}
+	var unmatched []string
+	for key := range patches {
+		if !matched[key] {
+			unmatched = append(unmatched, key)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return nil, fmt.Errorf("component %s: patches %s do not match any object", c.Name, strings.Join(unmatched, ", "))
+	}
+	return objs, nil
+}
@@ -0,0 +1,123 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFakeKustomize builds kustomizations by returning the deployment in their directory and returns the list of
+// builds that are run.
+func setupFakeKustomize(t *testing.T) (*[]string, func()) {
+	var builds []string
+	orig := runKustomize
+	runKustomize = func(path string) (string, error) {
+		builds = append(builds, path)
+		b, err := ioutil.ReadFile(filepath.Join(path, "deployment.yaml"))
+		return string(b), err
+	}
+	builtKustomizations.builds = map[string]*kustomizeBuild{}
+	return &builds, func() { runKustomize = orig }
+}
+
+func kustomizeComponent(name string) model.Component {
+	k := &model.Kustomization{Name: name, Path: "testdata/kustomize/base"}
+	return model.Component{Name: name, File: k.Path, Kustomization: k}
+}
+
+func TestEvalKustomization(t *testing.T) {
+	builds, reset := setupFakeKustomize(t)
+	defer reset()
+	ctx := Context{App: "app1", Env: "dev", ParamsFile: "testdata/params.kustomize.libsonnet"}
+	comps := []model.Component{
+		{Name: "a", File: "testdata/components/a.json"},
+		kustomizeComponent("web"),
+	}
+	replicas := func(objs []model.K8sLocalObject) interface{} {
+		for _, o := range objs {
+			if o.Component() == "web" {
+				spec := o.ToUnstructured().Object["spec"].(map[string]interface{})
+				return spec["replicas"]
+			}
+		}
+		return nil
+	}
+	objs, err := Components(comps, ctx)
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.EqualValues(3, replicas(objs))
+
+	// the kustomization is built once and patched for every environment
+	ctx.Env = "prod"
+	objs, err = Components(comps, ctx)
+	require.Nil(t, err)
+	a.EqualValues(4, replicas(objs))
+	a.Equal([]string{"testdata/kustomize/base"}, *builds)
+
+	// components without params have the objects of the build
+	objs, err = Components([]model.Component{kustomizeComponent("plain")}, ctx)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(objs))
+	spec := objs[0].ToUnstructured().Object["spec"].(map[string]interface{})
+	a.EqualValues(1, spec["replicas"])
+}
+
+func TestEvalKustomizationNegative(t *testing.T) {
+	_, reset := setupFakeKustomize(t)
+	defer reset()
+	ctx := Context{App: "app1", Env: "dev", ParamsFile: "testdata/params.kustomize.libsonnet"}
+	tests := []struct {
+		name     string
+		errorMsg string
+	}{
+		{"notObject", "component notObject: params of a kustomization must be an object of patches keyed by kind/name"},
+		{"badPatch", "component badPatch: patch Deployment/web must be an object"},
+		{"unmatched", "component unmatched: patches Deployment/api, Service/web do not match any object"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Components([]model.Component{kustomizeComponent(test.name)}, ctx)
+			require.NotNil(t, err)
+			assert.Equal(t, test.errorMsg, err.Error())
+		})
+	}
+
+	runKustomize = func(path string) (string, error) {
+		return "", fmt.Errorf("no resources")
+	}
+	builtKustomizations.builds = map[string]*kustomizeBuild{}
+	_, err := Components([]model.Component{kustomizeComponent("web")}, ctx)
+	require.NotNil(t, err)
+	assert.Equal(t, "component web: build kustomization testdata/kustomize/base: no resources", err.Error())
+}
+
+func TestRunKustomize(t *testing.T) {
+	out, err := runKustomize("testdata/kustomize/base")
+	require.Nil(t, err)
+	assert.Contains(t, out, "kind: Deployment")
+	assert.Contains(t, out, "name: web")
+
+	_, err = runKustomize("testdata/kustomize/missing")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/splunk/qbec/internal/vm"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// memoryCheckInterval is how often the memory used by an evaluation with a memory limit is checked.
+var memoryCheckInterval = 50 * time.Millisecond
+
+// memoryLimited is held by evaluations with a memory limit such that they are run one at a time and do not count the
+// allocations of each other.
+var memoryLimited sync.Mutex
+
+// aborted is the error of the first evaluation that exceeded its limits. That evaluation keeps running and allocating
+// in the background, so the limits of later evaluations cannot be enforced and they fail with this error instead,
+// such that the command fails right away.
+var aborted struct {
+	l   sync.Mutex
+	err error
+}
+
+// abortedError returns an error for evaluations that start after an evaluation was aborted, or nil if none was.
+func abortedError() error {
+	aborted.l.Lock()
+	defer aborted.l.Unlock()
+	if aborted.err == nil {
+		return nil
+	}
+	return fmt.Errorf("an earlier evaluation was aborted: %v", aborted.err)
+}
+
+// abort records the supplied error of an aborted evaluation, unless one was recorded already, and returns it.
+func abort(err error) error {
+	aborted.l.Lock()
+	defer aborted.l.Unlock()
+	if aborted.err == nil {
+		aborted.err = err
+	}
+	return err
+}
+
+// Limits are the limits on the evaluation of a single jsonnet component, with zero values for no limit.
+type Limits struct {
+	Timeout   time.Duration // max time to evaluate the component
+	MaxMemory int64         // max bytes that the evaluation may allocate
+}
+
+// isSet returns true if any limit is set.
+func (l Limits) isSet() bool {
+	return l.Timeout > 0 || l.MaxMemory > 0
+}
+
+// evalResult is the outcome of evaluating a snippet.
+type evalResult struct {
+	output string
+	err    error
+}
+
+// evaluateWithLimits evaluates the supplied snippet for a component in a new VM with the supplied config and returns
+// an error naming the component if the evaluation takes longer or allocates more memory than its limits allow. The
+// jsonnet VM cannot be interrupted, so an aborted evaluation keeps running in the background until the process exits,
+// and all evaluations that start after it fail.
+//
+// Memory is measured as the bytes allocated by the process during the evaluation and is checked periodically, so the
+// limit is approximate. Evaluations with a memory limit are run serially, but allocations of other evaluations that
+// run at the same time, such as those of components without limits in other environments, are counted as well.
+func evaluateWithLimits(cfg vm.Config, component, file, code string, limits Limits) (string, error) {
+	done := make(chan evalResult, 1)
+	var start runtime.MemStats
+	if limits.MaxMemory > 0 {
+		memoryLimited.Lock()
+		defer memoryLimited.Unlock()
+		runtime.ReadMemStats(&start)
+	}
+	if err := abortedError(); err != nil {
+		return "", err
+	}
+	go func() {
+		out, err := vm.New(cfg).EvaluateSnippet(file, code)
+		done <- evalResult{output: out, err: err}
+	}()
+	var timeout <-chan time.Time
+	if limits.Timeout > 0 {
+		t := time.NewTimer(limits.Timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var check <-chan time.Time
+	if limits.MaxMemory > 0 {
+		t := time.NewTicker(memoryCheckInterval)
+		defer t.Stop()
+		check = t.C
+	}
+	for {
+		select {
+		case r := <-done:
+			return r.output, r.err
+		case <-timeout:
+			return "", abort(fmt.Errorf("component %s: evaluation did not finish within %v", component, limits.Timeout))
+		case <-check:
+			var current runtime.MemStats
+			runtime.ReadMemStats(&current)
+			if current.TotalAlloc-start.TotalAlloc > uint64(limits.MaxMemory) {
+				return "", abort(fmt.Errorf("component %s: evaluation allocated more than %s", component,
+					resource.NewQuantity(limits.MaxMemory, resource.BinarySI)))
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limitsOf(m map[string]Limits) func(string) Limits {
+	return func(component string) Limits {
+		return m[component]
+	}
+}
+
+func TestEvalWithLimits(t *testing.T) {
+	ctx := Context{App: "app1", Env: "dev", Limits: limitsOf(map[string]Limits{
+		"slow": {Timeout: time.Minute, MaxMemory: 1 << 30},
+	})}
+	objs, err := Components([]model.Component{
+		{Name: "a", File: "testdata/components/a.json"},
+		{Name: "c", File: "testdata/components/c.jsonnet"},
+		{Name: "slow", File: "testdata/components/slow.jsonnet"},
+	}, ctx)
+	require.Nil(t, err)
+	a := assert.New(t)
+	names := map[string]string{}
+	for _, o := range objs {
+		names[o.Component()] = o.GetName()
+	}
+	a.Equal("jsonnet-config-map", names["c"])
+	a.Equal("slow", names["slow"])
+	for _, o := range objs {
+		if o.Component() == "slow" {
+			a.Equal("65536", o.ToUnstructured().Object["data"].(map[string]interface{})["total"])
+		}
+	}
+}
+
+func TestEvalWithLimitsNegative(t *testing.T) {
+	origInterval := memoryCheckInterval
+	memoryCheckInterval = time.Millisecond
+	defer func() { memoryCheckInterval = origInterval }()
+	comps := []model.Component{
+		{Name: "c", File: "testdata/components/c.jsonnet"},
+		{Name: "slow", File: "testdata/components/slow.jsonnet"},
+	}
+	tests := []struct {
+		name     string
+		limits   Limits
+		errorMsg string
+	}{
+		{"timeout", Limits{Timeout: time.Millisecond}, "evaluate components: component slow: evaluation did not finish within 1ms"},
+		{"memory", Limits{MaxMemory: 1024}, "evaluate components: component slow: evaluation allocated more than 1Ki"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() { aborted.err = nil }()
+			ctx := Context{App: "app1", Env: "dev", Limits: limitsOf(map[string]Limits{"slow": test.limits})}
+			_, err := Components(comps, ctx)
+			require.NotNil(t, err)
+			assert.Equal(t, test.errorMsg, err.Error())
+
+			// evaluations fail after an aborted one, even without limits
+			_, err = Components(comps[:1], Context{App: "app1", Env: "prod"})
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), "an earlier evaluation was aborted: component slow: ")
+		})
+	}
+}
+
+func TestEvalWithMemoryLimitSerial(t *testing.T) {
+	memoryLimited.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := evaluateWithLimits(vm.Config{}, "c", "c.jsonnet", "{}", Limits{MaxMemory: 1 << 30})
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("evaluation with a memory limit ran while another one was in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+	memoryLimited.Unlock()
+	require.Nil(t, <-done)
+
+	memoryLimited.Lock()
+	defer memoryLimited.Unlock()
+	out, err := evaluateWithLimits(vm.Config{}, "c", "c.jsonnet", "{}", Limits{Timeout: time.Minute})
+	require.Nil(t, err)
+	assert.Equal(t, "{ }\n", out)
+}
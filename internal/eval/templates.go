@@ -0,0 +1,242 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// environmentsAnnotation is the annotation of documents in YAML and JSON components that restricts them to a
+// comma-separated list of environments.
+const environmentsAnnotation = "qbec.io/environments"
+
+// reTemplateVar matches template variables in YAML and JSON components, with an additional leading $ to escape them.
+var reTemplateVar = regexp.MustCompile(`\$(\$?)\{qbec\.([^{}]*)\}`)
+
+// isDataComponent returns true if the supplied component is a YAML or JSON file.
+func isDataComponent(c model.Component) bool {
+	return c.Generator == nil && (strings.HasSuffix(c.File, ".yaml") || strings.HasSuffix(c.File, ".json"))
+}
+
+// templateValue returns the value of the supplied template variable for a component.
+type templateValue func(name string) (interface{}, error)
+
+// templateValues returns a function that returns the values of template variables of the supplied component. Params
+// are evaluated the first time that they are needed, using the supplied function.
+func templateValues(c model.Component, ctx Context, params func() (map[string]interface{}, error)) templateValue {
+	return func(name string) (interface{}, error) {
+		switch {
+		case name == "app":
+			return ctx.App, nil
+		case name == "env":
+			return ctx.Env, nil
+		case name == "namespace":
+			return ctx.DefaultNamespace, nil
+		case strings.HasPrefix(name, "props."):
+			prop := strings.TrimPrefix(name, "props.")
+			v, ok := ctx.Properties[prop]
+			if !ok {
+				return nil, fmt.Errorf("environment %s has no property %s", ctx.Env, prop)
+			}
+			return v, nil
+		case strings.HasPrefix(name, "params."):
+			p, err := params()
+			if err != nil {
+				return nil, err
+			}
+			all, _ := p["components"].(map[string]interface{})
+			var v interface{} = all[c.Name]
+			for _, part := range strings.Split(strings.TrimPrefix(name, "params."), ".") {
+				m, _ := v.(map[string]interface{})
+				v = m[part]
+			}
+			if v == nil {
+				return nil, fmt.Errorf("param %s is not set", strings.TrimPrefix(name, "params."))
+			}
+			return v, nil
+		default:
+			return nil, fmt.Errorf("unknown template variable qbec.%s", name)
+		}
+	}
+}
+
+// expandString returns the supplied string with the template variables in it replaced by their values, with values
+// that are not strings inserted as JSON.
+func expandString(s string, values templateValue) (string, error) {
+	var firstErr error
+	out := reTemplateVar.ReplaceAllStringFunc(s, func(m string) string {
+		parts := reTemplateVar.FindStringSubmatch(m)
+		if parts[1] != "" {
+			return m[1:]
+		}
+		v, err := values(parts[2])
+		if err == nil {
+			if str, ok := v.(string); ok {
+				return str
+			}
+			var b []byte
+			b, err = json.Marshal(v)
+			v = string(b)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return ""
+		}
+		return v.(string)
+	})
+	return out, firstErr
+}
+
+// expandTemplate returns the supplied parsed document with the template variables in its strings and object keys
+// replaced by their values. Values are substituted into the parsed document, so they cannot change its structure. A
+// string that is a single variable is replaced by the value of the variable, such that params keep their types.
+func expandTemplate(doc interface{}, values templateValue) (interface{}, error) {
+	switch d := doc.(type) {
+	case string:
+		if m := reTemplateVar.FindStringSubmatch(d); m != nil && m[0] == d && m[1] == "" {
+			return values(m[2])
+		}
+		return expandString(d, values)
+	case []interface{}:
+		for i, v := range d {
+			ev, err := expandTemplate(v, values)
+			if err != nil {
+				return nil, err
+			}
+			d[i] = ev
+		}
+		return d, nil
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(d))
+		for k, v := range d {
+			ek, err := expandString(k, values)
+			if err != nil {
+				return nil, err
+			}
+			ev, err := expandTemplate(v, values)
+			if err != nil {
+				return nil, err
+			}
+			ret[ek] = ev
+		}
+		return ret, nil
+	default:
+		return doc, nil
+	}
+}
+
+// decodeDocuments returns the documents of the supplied YAML or JSON stream. A JSON stream with a single value is
+// returned as that value, as are YAML streams, which are always returned as an array of documents.
+func decodeDocuments(file string, contents string) (interface{}, error) {
+	if strings.HasSuffix(file, ".json") {
+		var docs []interface{}
+		d := json.NewDecoder(strings.NewReader(contents))
+		for {
+			var doc interface{}
+			if err := d.Decode(&doc); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, err
+			}
+			docs = append(docs, doc)
+		}
+		if len(docs) == 1 {
+			return docs[0], nil
+		}
+		return docs, nil
+	}
+	docs := []interface{}{}
+	d := yaml.NewYAMLToJSONDecoder(bytes.NewReader([]byte(contents)))
+	for {
+		var doc interface{}
+		if err := d.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// includeDocument returns true if the supplied document is not restricted to environments other than the supplied one,
+// removing the annotation that restricts it.
+func includeDocument(doc interface{}, env string) bool {
+	obj, _ := doc.(map[string]interface{})
+	meta, _ := obj["metadata"].(map[string]interface{})
+	anns, _ := meta["annotations"].(map[string]interface{})
+	v, ok := anns[environmentsAnnotation]
+	if !ok {
+		return true
+	}
+	delete(anns, environmentsAnnotation)
+	if len(anns) == 0 {
+		delete(meta, "annotations")
+	}
+	s, _ := v.(string)
+	for _, e := range strings.Split(s, ",") {
+		if strings.TrimSpace(e) == env {
+			return true
+		}
+	}
+	return false
+}
+
+// dataObjects returns the documents of the supplied YAML or JSON component after expanding template variables and
+// dropping documents that are restricted to other environments.
+func dataObjects(c model.Component, ctx Context, params func() (map[string]interface{}, error)) (interface{}, error) {
+	b, err := ioutil.ReadFile(c.File)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeDocuments(c.File, string(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s: parse %s", c.Name, c.File)
+	}
+	data, err = expandTemplate(data, templateValues(c, ctx, params))
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s", c.Name)
+	}
+	docs, ok := data.([]interface{})
+	if !ok {
+		if !includeDocument(data, ctx.Env) {
+			return []interface{}{}, nil
+		}
+		return data, nil
+	}
+	ret := []interface{}{}
+	for _, doc := range docs {
+		if includeDocument(doc, ctx.Env) {
+			ret = append(ret, doc)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,93 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func templateContext(env string) Context {
+	return Context{
+		App:              "app1",
+		Env:              env,
+		ParamsFile:       "testdata/params.templates.libsonnet",
+		Properties:       map[string]string{"domain": env + ".example.com"},
+		DefaultNamespace: "web-" + env,
+	}
+}
+
+func TestEvalTemplates(t *testing.T) {
+	comps := []model.Component{
+		{Name: "web", File: "testdata/templates/web.yaml"},
+		{Name: "json", File: "testdata/templates/web.json"},
+	}
+	objs, err := Components(comps, templateContext("dev"))
+	require.Nil(t, err)
+	a := assert.New(t)
+	names := func(objs []model.K8sLocalObject) []string {
+		var ret []string
+		for _, o := range objs {
+			ret = append(ret, o.GetName())
+		}
+		return ret
+	}
+	a.Equal([]string{"web-dev", "debug", "web"}, names(objs))
+
+	debug := objs[1].ToUnstructured()
+	a.Equal("dev", debug.Object["data"].(map[string]interface{})["env"])
+	a.NotContains(debug.GetAnnotations(), "qbec.io/environments")
+
+	web := objs[2].ToUnstructured()
+	a.Equal("web-dev", web.GetNamespace())
+	a.Equal("frontend", web.GetLabels()["tier"])
+	// values are substituted into parsed documents and cannot change their structure
+	a.Equal("replicas: 10\n\"quoted\" }", web.GetAnnotations()["note"])
+	spec := web.Object["spec"].(map[string]interface{})
+	a.EqualValues(1, spec["replicas"])
+	container := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	a.Equal("nginx:stable", container["image"])
+	a.Equal([]interface{}{"--domain=dev.example.com", "--literal=${qbec.env}"}, container["args"])
+
+	objs, err = Components(comps, templateContext("prod"))
+	require.Nil(t, err)
+	a.Equal([]string{"prod-only", "web-prod", "web"}, names(objs))
+	a.Equal(map[string]string{"foo": "bar", model.QbecNames.ComponentAnnotation: "json"}, objs[0].ToUnstructured().GetAnnotations())
+	spec = objs[2].ToUnstructured().Object["spec"].(map[string]interface{})
+	a.EqualValues(3, spec["replicas"])
+}
+
+func TestEvalTemplatesNegative(t *testing.T) {
+	tests := []struct {
+		file     string
+		errorMsg string
+	}{
+		{"bad-var", "component bad-var: unknown template variable qbec.foo"},
+		{"bad-prop", "component bad-prop: environment dev has no property missing"},
+		{"bad-param", "component bad-param: param missing is not set"},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			_, err := Components([]model.Component{{Name: test.file, File: "testdata/templates/" + test.file + ".yaml"}}, templateContext("dev"))
+			require.NotNil(t, err)
+			assert.Equal(t, test.errorMsg, err.Error())
+		})
+	}
+}
@@ -0,0 +1,4 @@
+{{- define "nginx.labels" -}}
+app: {{ .Chart.Name }}
+release: {{ .Release.Name }}
+{{- end -}}
@@ -0,0 +1,20 @@
+params: {
+	replicas: int & >0
+	image:    string | *"nginx:stable"
+}
+
+qbec: {
+	env:       string
+	namespace: string
+	...
+}
+
+objects: [{
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: {
+		name:      "web"
+		namespace: qbec.namespace
+	}
+	spec: replicas: params.replicas
+}]
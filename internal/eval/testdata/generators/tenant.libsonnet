@@ -0,0 +1,11 @@
+function(name, data) {
+  apiVersion: 'v1',
+  kind: 'ConfigMap',
+  metadata: {
+    name: 'tenant-' + name,
+    namespace: std.extVar('qbec.io/env'),
+  },
+  data: {
+    plan: if data == null then 'free' else data.plan,
+  },
+}
@@ -0,0 +1 @@
+{ c: 'c' }
@@ -0,0 +1,10 @@
+local cluster = std.extVar('qbec.io/cluster');
+{
+    components: {
+        base: {
+            env: std.extVar('qbec.io/env'),
+            cluster: if cluster == null then 'default' else cluster.name,
+            host: if cluster == null then 'prod.example.com' else cluster.properties.domain,
+        }
+    }
+}
@@ -0,0 +1,7 @@
+{
+  components: {
+    web: {
+      replicas: std.length(std.extVar('qbec.io/env')),
+    },
+  },
+}
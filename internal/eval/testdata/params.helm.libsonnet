@@ -0,0 +1,8 @@
+{
+  components: {
+    nginx: {
+      replicas: std.length(std.extVar('qbec.io/env')),
+    },
+    bad: 'not an object',
+  },
+}
@@ -0,0 +1,19 @@
+{
+  components: {
+    web: {
+      'Deployment/web': {
+        spec: {
+          replicas: std.length(std.extVar('qbec.io/env')),
+        },
+      },
+    },
+    notObject: 'not an object',
+    badPatch: {
+      'Deployment/web': 'not an object',
+    },
+    unmatched: {
+      'Service/web': {},
+      'Deployment/api': {},
+    },
+  },
+}
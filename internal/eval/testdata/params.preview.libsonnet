@@ -0,0 +1,9 @@
+local preview = std.extVar('qbec.io/preview');
+{
+    components: {
+        base: {
+            env: std.extVar('qbec.io/env'),
+            host: if preview == null then 'dev.example.com' else preview.props.host,
+        }
+    }
+}
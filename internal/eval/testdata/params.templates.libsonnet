@@ -0,0 +1,13 @@
+{
+  components: {
+    web: {
+      replicas: if std.extVar('qbec.io/env') == 'prod' then 3 else 1,
+      image: {
+        name: 'nginx',
+        tag: 'stable',
+      },
+      labels: { tier: 'frontend' },
+      note: 'replicas: 10\n"quoted" }',
+    },
+  },
+}
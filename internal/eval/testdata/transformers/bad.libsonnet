@@ -0,0 +1 @@
+function(object) object.metadata.name
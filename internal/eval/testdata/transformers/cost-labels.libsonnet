@@ -0,0 +1,7 @@
+function(object) object {
+  metadata+: {
+    labels+: {
+      cost: std.extVar('qbec.io/env') + '-' + object.metadata.annotations['qbec.io/component'],
+    },
+  },
+}
@@ -0,0 +1 @@
+function(object) if object.kind == 'ConfigMap' then object { metadata+: { labels+: { cost: 'shared' } } } else object
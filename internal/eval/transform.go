@@ -0,0 +1,85 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"github.com/splunk/qbec/internal/vm"
+)
+
+// transformObjectsVarName is the code variable that has the objects passed to a transformer.
+const transformObjectsVarName = "qbec.io/transformObjects"
+
+// Transform applies the supplied transformers in order to the supplied objects and returns the transformed objects.
+// Every transformer is a jsonnet file that evaluates to a function that is called with each object and returns the
+// transformed object. Transformed objects keep the component of the object that they were produced from.
+func Transform(objects []model.K8sLocalObject, transformers []model.Transformer, ctx Context) ([]model.K8sLocalObject, error) {
+	if len(transformers) == 0 || len(objects) == 0 {
+		return objects, nil
+	}
+	if ctx.VM == nil {
+		ctx.VM = vm.New(vm.Config{})
+	}
+	cfg, err := envConfig(ctx.VM.Config(), ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]interface{}, 0, len(objects))
+	for _, o := range objects {
+		data = append(data, o.ToUnstructured().Object)
+	}
+	for _, t := range transformers {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		// start from a fresh map of code variables so that the objects of a transformer do not leak into the config
+		tcfg := cfg
+		tcfg.CodeVars = nil
+		jvm := vm.New(tcfg.WithCodeVars(cfg.CodeVars).WithCodeVars(map[string]string{transformObjectsVarName: string(b)}))
+		code := fmt.Sprintf("local transform = %s;\nstd.map(transform, std.extVar('%s'))", vm.Import(t.File), transformObjectsVarName)
+		if ctx.Verbose {
+			sio.Debugln("Eval transformer " + t.Name + ":\n" + code)
+		}
+		output, err := jvm.EvaluateSnippet("transformer-loader.jsonnet", code)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transformer %s", t.Name)
+		}
+		var transformed []interface{}
+		if err := json.Unmarshal([]byte(output), &transformed); err != nil {
+			return nil, errors.Wrapf(err, "transformer %s: unmarshal output", t.Name)
+		}
+		for i, obj := range transformed {
+			m, ok := obj.(map[string]interface{})
+			if !ok || m["apiVersion"] == nil || m["kind"] == nil {
+				o := objects[i]
+				return nil, fmt.Errorf("transformer %s: component %s: did not return an object for %s/%s", t.Name, o.Component(), o.GetKind(), o.GetName())
+			}
+		}
+		data = transformed
+	}
+	ret := make([]model.K8sLocalObject, 0, len(objects))
+	for i, o := range objects {
+		ret = append(ret, model.NewK8sLocalObject(data[i].(map[string]interface{}), ctx.App, o.Component(), ctx.Env))
+	}
+	return ret, nil
+}
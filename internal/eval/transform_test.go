@@ -0,0 +1,70 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eval
+
+import (
+	"testing"
+
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransform(t *testing.T) {
+	ctx := Context{App: "app1", Env: "dev"}
+	objs, err := Components([]model.Component{
+		{Name: "a", File: "testdata/components/a.json"},
+		{Name: "c", File: "testdata/components/c.jsonnet"},
+	}, ctx)
+	require.Nil(t, err)
+	transformers := []model.Transformer{
+		{Name: "cost", File: "testdata/transformers/cost-labels.libsonnet"},
+		{Name: "shared", File: "testdata/transformers/shared-config.libsonnet"},
+	}
+	ret, err := Transform(objs, transformers, ctx)
+	require.Nil(t, err)
+	require.Equal(t, len(objs), len(ret))
+	a := assert.New(t)
+	for i, o := range ret {
+		a.Equal(objs[i].Component(), o.Component())
+		a.Equal("dev", o.Environment())
+		a.Equal("app1", o.ToUnstructured().GetLabels()[model.QbecNames.ApplicationLabel])
+		want := "dev-" + o.Component()
+		if o.GetKind() == "ConfigMap" {
+			want = "shared"
+		}
+		a.Equal(want, o.ToUnstructured().GetLabels()["cost"])
+	}
+
+	ret, err = Transform(objs, nil, ctx)
+	require.Nil(t, err)
+	a.Equal(objs, ret)
+}
+
+func TestTransformNegative(t *testing.T) {
+	ctx := Context{App: "app1", Env: "dev"}
+	objs, err := Components([]model.Component{{Name: "a", File: "testdata/components/a.json"}}, ctx)
+	require.Nil(t, err)
+	_, err = Transform(objs, []model.Transformer{{Name: "bad", File: "testdata/transformers/bad.libsonnet"}}, ctx)
+	require.NotNil(t, err)
+	o := objs[0]
+	assert.Equal(t, "transformer bad: component a: did not return an object for "+o.GetKind()+"/"+o.GetName(), err.Error())
+
+	_, err = Transform(objs, []model.Transformer{{Name: "missing", File: "testdata/transformers/missing.libsonnet"}}, ctx)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "transformer missing: ")
+}
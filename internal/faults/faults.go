@@ -0,0 +1,146 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package faults provides fault injection for testing the behavior of tools and processes that wrap qbec
+// under partial failure.
+package faults
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-jsonnet"
+)
+
+// DefaultDelay is the default delay for slow responses.
+const DefaultDelay = 2 * time.Second
+
+// Config is the configuration for fault injection. Rates are probabilities between 0 and 1.
+type Config struct {
+	APIErrors  float64       // rate at which remote API calls fail
+	Slow       float64       // rate at which remote API calls are slowed down
+	Delay      time.Duration // delay for slow API calls, defaults to DefaultDelay
+	EvalErrors float64       // rate at which jsonnet imports fail, causing evaluation failures
+	Seed       int64         // seed for the random number generator, time based when not set
+}
+
+// Parse parses a fault specification of the form "api-errors=0.1,slow=0.2,delay=1s,eval-errors=0.05,seed=42".
+func Parse(spec string) (Config, error) {
+	var c Config
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return c, fmt.Errorf("invalid fault %q, must be of the form <name>=<value>", part)
+		}
+		name, value := kv[0], kv[1]
+		var err error
+		switch name {
+		case "api-errors":
+			c.APIErrors, err = parseRate(value)
+		case "slow":
+			c.Slow, err = parseRate(value)
+		case "eval-errors":
+			c.EvalErrors, err = parseRate(value)
+		case "delay":
+			c.Delay, err = time.ParseDuration(value)
+		case "seed":
+			c.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return c, fmt.Errorf("unknown fault %q, must be one of api-errors, slow, delay, eval-errors or seed", name)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid value for fault %s: %v", name, err)
+		}
+	}
+	return c, nil
+}
+
+func parseRate(s string) (float64, error) {
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if r < 0 || r > 1 {
+		return 0, fmt.Errorf("rate %v not between 0 and 1", r)
+	}
+	return r, nil
+}
+
+// Injector injects faults based on its configuration. It is safe for concurrent use.
+type Injector struct {
+	config Config
+	l      sync.Mutex
+	rnd    *rand.Rand
+	sleep  func(time.Duration)
+}
+
+// New returns an injector for the supplied configuration.
+func New(config Config) *Injector {
+	if config.Delay == 0 {
+		config.Delay = DefaultDelay
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{config: config, rnd: rand.New(rand.NewSource(seed)), sleep: time.Sleep}
+}
+
+func (i *Injector) hit(rate float64) bool {
+	if rate == 0 {
+		return false
+	}
+	i.l.Lock()
+	defer i.l.Unlock()
+	return i.rnd.Float64() < rate
+}
+
+// APIFault is called before a remote operation. It may delay the caller and returns an error if the
+// operation should fail.
+func (i *Injector) APIFault(op string) error {
+	if i.hit(i.config.Slow) {
+		i.sleep(i.config.Delay)
+	}
+	if i.hit(i.config.APIErrors) {
+		return fmt.Errorf("injected fault: %s failed", op)
+	}
+	return nil
+}
+
+// Importer returns an importer that delegates to the supplied one but fails imports at the configured rate.
+func (i *Injector) Importer(base jsonnet.Importer) jsonnet.Importer {
+	return &importer{base: base, injector: i}
+}
+
+type importer struct {
+	base     jsonnet.Importer
+	injector *Injector
+}
+
+func (im *importer) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	if im.injector.hit(im.injector.config.EvalErrors) {
+		return jsonnet.Contents{}, "", fmt.Errorf("injected fault: import %s failed", importedPath)
+	}
+	return im.base.Import(importedFrom, importedPath)
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package faults
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse("api-errors=0.1, slow=0.2,delay=1s,eval-errors=0.05,seed=42")
+	require.Nil(t, err)
+	assert.Equal(t, Config{APIErrors: 0.1, Slow: 0.2, Delay: time.Second, EvalErrors: 0.05, Seed: 42}, c)
+}
+
+func TestParseNegative(t *testing.T) {
+	tests := []struct {
+		spec string
+		msg  string
+	}{
+		{"api-errors", `invalid fault "api-errors", must be of the form <name>=<value>`},
+		{"foo=1", `unknown fault "foo"`},
+		{"slow=2", "invalid value for fault slow: rate 2 not between 0 and 1"},
+		{"eval-errors=x", "invalid value for fault eval-errors"},
+		{"delay=10", "invalid value for fault delay"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			_, err := Parse(test.spec)
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.msg)
+		})
+	}
+}
+
+func TestAPIFaults(t *testing.T) {
+	var delays []time.Duration
+	in := New(Config{APIErrors: 1, Slow: 1, Seed: 1})
+	in.sleep = func(d time.Duration) { delays = append(delays, d) }
+	err := in.APIFault("sync")
+	require.NotNil(t, err)
+	assert.Equal(t, "injected fault: sync failed", err.Error())
+	assert.Equal(t, []time.Duration{DefaultDelay}, delays)
+
+	in = New(Config{Seed: 1})
+	in.sleep = func(d time.Duration) { t.Fatal("unexpected delay") }
+	for i := 0; i < 100; i++ {
+		require.Nil(t, in.APIFault("get"))
+	}
+}
+
+func TestAPIFaultRate(t *testing.T) {
+	count := func() int {
+		in := New(Config{APIErrors: 0.3, Seed: 42})
+		n := 0
+		for i := 0; i < 1000; i++ {
+			if in.APIFault("get") != nil {
+				n++
+			}
+		}
+		return n
+	}
+	n := count()
+	assert.True(t, n > 200 && n < 400, "unexpected failure count %d", n)
+	assert.Equal(t, n, count(), "same seed must produce same faults")
+}
+
+type mapImporter map[string]string
+
+func (m mapImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	return jsonnet.MakeContents(m[importedPath]), importedPath, nil
+}
+
+func TestImporter(t *testing.T) {
+	base := mapImporter{"a.libsonnet": "{ a: 1 }"}
+	eval := func(rate float64) error {
+		jvm := jsonnet.MakeVM()
+		jvm.Importer(New(Config{EvalErrors: rate, Seed: 1}).Importer(base))
+		_, err := jvm.EvaluateSnippet("main.jsonnet", `(import 'a.libsonnet').a`)
+		return err
+	}
+	require.Nil(t, eval(0))
+	err := eval(1)
+	require.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "injected fault: import a.libsonnet failed"), err.Error())
+}
@@ -0,0 +1,214 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var builtins = map[schema.GroupKind]Checker{
+	{Group: "apps", Kind: "Deployment"}:        deploymentStatus,
+	{Group: "extensions", Kind: "Deployment"}:  deploymentStatus,
+	{Group: "apps", Kind: "StatefulSet"}:       statefulSetStatus,
+	{Group: "apps", Kind: "DaemonSet"}:         daemonSetStatus,
+	{Group: "extensions", Kind: "DaemonSet"}:   daemonSetStatus,
+	{Group: "batch", Kind: "Job"}:              jobStatus,
+	{Group: "", Kind: "Pod"}:                   podStatus,
+	{Group: "", Kind: "PersistentVolumeClaim"}: pvcStatus,
+}
+
+func healthy() (*Status, error) {
+	return &Status{Healthy: true}, nil
+}
+
+func unhealthy(format string, args ...interface{}) (*Status, error) {
+	return &Status{Message: fmt.Sprintf(format, args...)}, nil
+}
+
+// number returns the numeric value at the supplied path, tolerating objects that have been decoded
+// from JSON with float values.
+func number(obj *unstructured.Unstructured, fields ...string) (int64, bool) {
+	v, found, _ := unstructured.NestedFieldCopy(obj.Object, fields...)
+	if !found {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func nestedInt(obj *unstructured.Unstructured, fields ...string) int64 {
+	v, _ := number(obj, fields...)
+	return v
+}
+
+// generationObserved returns true if the controller for the object has seen its latest spec.
+func generationObserved(obj *unstructured.Unstructured) bool {
+	observed, found := number(obj, "status", "observedGeneration")
+	if !found {
+		return true
+	}
+	return observed >= nestedInt(obj, "metadata", "generation")
+}
+
+// condition returns the status of the condition with the supplied type and a boolean indicating
+// whether it was found.
+func condition(obj *unstructured.Unstructured, condType string) (string, string, bool) {
+	conds, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conds {
+		m, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _ := m["type"].(string); t == condType {
+			status, _ := m["status"].(string)
+			msg, _ := m["message"].(string)
+			return status, msg, true
+		}
+	}
+	return "", "", false
+}
+
+func desiredReplicas(obj *unstructured.Unstructured) int64 {
+	r, found := number(obj, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return r
+}
+
+func deploymentStatus(obj *unstructured.Unstructured) (*Status, error) {
+	if !generationObserved(obj) {
+		return unhealthy("waiting for spec update to be observed")
+	}
+	desired := desiredReplicas(obj)
+	updated := nestedInt(obj, "status", "updatedReplicas")
+	replicas := nestedInt(obj, "status", "replicas")
+	available := nestedInt(obj, "status", "availableReplicas")
+	switch {
+	case updated < desired:
+		return unhealthy("%d of %d replicas updated", updated, desired)
+	case replicas > updated:
+		return unhealthy("%d old replicas pending termination", replicas-updated)
+	case available < updated:
+		return unhealthy("%d of %d updated replicas available", available, updated)
+	}
+	return healthy()
+}
+
+func statefulSetStatus(obj *unstructured.Unstructured) (*Status, error) {
+	if !generationObserved(obj) {
+		return unhealthy("waiting for spec update to be observed")
+	}
+	desired := desiredReplicas(obj)
+	ready := nestedInt(obj, "status", "readyReplicas")
+	if ready < desired {
+		return unhealthy("%d of %d replicas ready", ready, desired)
+	}
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return healthy()
+	}
+	updated := nestedInt(obj, "status", "updatedReplicas")
+	if updated < desired {
+		return unhealthy("%d of %d replicas updated", updated, desired)
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if current != update {
+		return unhealthy("waiting for revision %s to be rolled out", update)
+	}
+	return healthy()
+}
+
+func daemonSetStatus(obj *unstructured.Unstructured) (*Status, error) {
+	if !generationObserved(obj) {
+		return unhealthy("waiting for spec update to be observed")
+	}
+	desired := nestedInt(obj, "status", "desiredNumberScheduled")
+	updated := nestedInt(obj, "status", "updatedNumberScheduled")
+	available := nestedInt(obj, "status", "numberAvailable")
+	switch {
+	case updated < desired:
+		return unhealthy("%d of %d pods updated", updated, desired)
+	case available < desired:
+		return unhealthy("%d of %d pods available", available, desired)
+	}
+	return healthy()
+}
+
+func jobStatus(obj *unstructured.Unstructured) (*Status, error) {
+	if s, msg, ok := condition(obj, "Failed"); ok && s == "True" {
+		return nil, fmt.Errorf("job failed: %s", msg)
+	}
+	if s, _, ok := condition(obj, "Complete"); ok && s == "True" {
+		return healthy()
+	}
+	return unhealthy("waiting for job to complete")
+}
+
+func podStatus(obj *unstructured.Unstructured) (*Status, error) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return healthy()
+	case "Failed":
+		return nil, fmt.Errorf("pod failed")
+	}
+	if s, _, ok := condition(obj, "Ready"); ok && s == "True" {
+		return healthy()
+	}
+	return unhealthy("pod not ready, phase %q", phase)
+}
+
+func pvcStatus(obj *unstructured.Unstructured) (*Status, error) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	if phase != "Bound" {
+		return unhealthy("volume claim not bound, phase %q", phase)
+	}
+	return healthy()
+}
+
+// genericStatus evaluates objects for which no specific checker exists. This works for custom resources
+// that follow the common conventions of setting an observed generation and a Ready condition.
+func genericStatus(obj *unstructured.Unstructured) (*Status, error) {
+	if !generationObserved(obj) {
+		return unhealthy("waiting for spec update to be observed")
+	}
+	for _, t := range []string{"Ready", "Available"} {
+		if s, msg, ok := condition(obj, t); ok {
+			if s == "True" {
+				return healthy()
+			}
+			if msg == "" {
+				msg = fmt.Sprintf("condition %s is %s", t, s)
+			}
+			return unhealthy("%s", msg)
+		}
+	}
+	return healthy()
+}
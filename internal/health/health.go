@@ -0,0 +1,123 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package health provides readiness checks for Kubernetes objects.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/vm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Status is the health status of an object.
+type Status struct {
+	Healthy bool   // true if the object is ready
+	Message string // optional message with details on why an object is not ready
+}
+
+// Checker returns the health status of the supplied server object.
+type Checker func(obj *unstructured.Unstructured) (*Status, error)
+
+// Registry provides health checks for objects based on their kinds.
+type Registry struct {
+	checks map[schema.GroupKind]Checker
+}
+
+// NewRegistry returns a registry with built-in checks for core kinds overlaid with the supplied custom checks.
+// Custom checks are evaluated using a VM created from the supplied config.
+func NewRegistry(custom []model.HealthCheck, config vm.Config) (*Registry, error) {
+	r := &Registry{checks: map[schema.GroupKind]Checker{}}
+	for gk, c := range builtins {
+		r.checks[gk] = c
+	}
+	for _, hc := range custom {
+		gk := schema.GroupKind{Group: hc.Group, Kind: hc.Kind}
+		c, err := expressionChecker(hc.Expression, config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "health check for %s", gk.String())
+		}
+		r.checks[gk] = c
+	}
+	return r, nil
+}
+
+// Register registers a checker for the supplied group and kind, replacing any existing one.
+func (r *Registry) Register(gk schema.GroupKind, c Checker) {
+	r.checks[gk] = c
+}
+
+// Status returns the health status of the supplied object. Objects without a specific checker are
+// evaluated using generic rules based on their status conditions and observed generation.
+func (r *Registry) Status(obj *unstructured.Unstructured) (*Status, error) {
+	gk := obj.GroupVersionKind().GroupKind()
+	if c, ok := r.checks[gk]; ok {
+		return c(obj)
+	}
+	return genericStatus(obj)
+}
+
+// expressionChecker returns a checker that evaluates the supplied jsonnet expression with the object bound
+// to the 'object' external variable.
+func expressionChecker(expr string, config vm.Config) (Checker, error) {
+	// catch syntax errors early
+	if _, err := jsonnet.SnippetToAST("health-check", expr); err != nil {
+		return nil, err
+	}
+	return func(obj *unstructured.Unstructured) (*Status, error) {
+		b, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		// start from a fresh map of code variables so that the base config is not modified
+		cfg := config
+		cfg.CodeVars = nil
+		jvm := vm.New(cfg.WithCodeVars(config.CodeVars).WithCodeVars(map[string]string{"object": string(b)}))
+		out, err := jvm.EvaluateSnippet("health-check", expr)
+		if err != nil {
+			return nil, errors.Wrap(err, "evaluate health check")
+		}
+		return parseExpressionResult(out)
+	}, nil
+}
+
+func parseExpressionResult(out string) (*Status, error) {
+	out = strings.TrimSpace(out)
+	var data interface{}
+	if err := json.Unmarshal([]byte(out), &data); err != nil {
+		return nil, errors.Wrap(err, "unmarshal health check result")
+	}
+	switch v := data.(type) {
+	case bool:
+		return &Status{Healthy: v}, nil
+	case map[string]interface{}:
+		h, ok := v["healthy"].(bool)
+		if !ok {
+			return nil, fmt.Errorf("health check result did not have a boolean 'healthy' attribute: %s", out)
+		}
+		msg, _ := v["message"].(string)
+		return &Status{Healthy: h, Message: msg}, nil
+	default:
+		return nil, fmt.Errorf("health check must return a boolean or an object, got %s", out)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func toObject(t *testing.T, s string) *unstructured.Unstructured {
+	var data map[string]interface{}
+	err := yaml.Unmarshal([]byte(s), &data)
+	require.Nil(t, err)
+	return &unstructured.Unstructured{Object: data}
+}
+
+func TestBuiltinStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     string
+		healthy bool
+		message string
+	}{
+		{
+			name: "deployment-ready",
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: { name: d, generation: 2 }
+spec: { replicas: 2 }
+status: { observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2 }
+`,
+			healthy: true,
+		},
+		{
+			name: "deployment-unobserved",
+			obj: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: { name: d, generation: 3 }
+spec: { replicas: 2 }
+status: { observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2 }
+`,
+			message: "waiting for spec update to be observed",
+		},
+		{
+			name: "deployment-rolling",
+			obj: `
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata: { name: d, generation: 2 }
+spec: { replicas: 3 }
+status: { observedGeneration: 2, replicas: 3, updatedReplicas: 1, availableReplicas: 3 }
+`,
+			message: "1 of 3 replicas updated",
+		},
+		{
+			name: "statefulset-revision",
+			obj: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata: { name: s, generation: 1 }
+spec: { replicas: 1 }
+status: { observedGeneration: 1, readyReplicas: 1, updatedReplicas: 1, currentRevision: a, updateRevision: b }
+`,
+			message: "waiting for revision b to be rolled out",
+		},
+		{
+			name: "daemonset-ready",
+			obj: `
+apiVersion: apps/v1
+kind: DaemonSet
+metadata: { name: ds, generation: 1 }
+status: { observedGeneration: 1, desiredNumberScheduled: 3, updatedNumberScheduled: 3, numberAvailable: 3 }
+`,
+			healthy: true,
+		},
+		{
+			name: "pvc-pending",
+			obj: `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata: { name: p }
+status: { phase: Pending }
+`,
+			message: `volume claim not bound, phase "Pending"`,
+		},
+		{
+			name: "cr-ready",
+			obj: `
+apiVersion: cert-manager.io/v1alpha2
+kind: Certificate
+metadata: { name: c, generation: 1 }
+status: { conditions: [ { type: Ready, status: "True" } ] }
+`,
+			healthy: true,
+		},
+		{
+			name: "cr-not-ready",
+			obj: `
+apiVersion: cert-manager.io/v1alpha2
+kind: Certificate
+metadata: { name: c, generation: 1 }
+status: { conditions: [ { type: Ready, status: "False", message: "issuing" } ] }
+`,
+			message: "issuing",
+		},
+		{
+			name: "no-status",
+			obj: `
+apiVersion: v1
+kind: ConfigMap
+metadata: { name: cm }
+`,
+			healthy: true,
+		},
+	}
+	r, err := NewRegistry(nil, vm.Config{})
+	require.Nil(t, err)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := r.Status(toObject(t, test.obj))
+			require.Nil(t, err)
+			a := assert.New(t)
+			a.Equal(test.healthy, s.Healthy)
+			a.Equal(test.message, s.Message)
+		})
+	}
+}
+
+func TestJobFailure(t *testing.T) {
+	r, err := NewRegistry(nil, vm.Config{})
+	require.Nil(t, err)
+	_, err = r.Status(toObject(t, `
+apiVersion: batch/v1
+kind: Job
+metadata: { name: j }
+status: { conditions: [ { type: Failed, status: "True", message: "backoff limit exceeded" } ] }
+`))
+	require.NotNil(t, err)
+	assert.Equal(t, "job failed: backoff limit exceeded", err.Error())
+}
+
+func TestCustomChecks(t *testing.T) {
+	checks := []model.HealthCheck{
+		{
+			Group:      "kafka.strimzi.io",
+			Kind:       "KafkaTopic",
+			Expression: `std.objectHas(std.extVar('object'), 'status')`,
+		},
+		{
+			Group: "argoproj.io",
+			Kind:  "Rollout",
+			Expression: `local o = std.extVar('object');
+{ healthy: o.status.phase == 'Healthy', message: 'phase is ' + o.status.phase }`,
+		},
+	}
+	r, err := NewRegistry(checks, vm.Config{})
+	require.Nil(t, err)
+	a := assert.New(t)
+
+	s, err := r.Status(toObject(t, `{ apiVersion: kafka.strimzi.io/v1beta1, kind: KafkaTopic, metadata: { name: t } }`))
+	require.Nil(t, err)
+	a.False(s.Healthy)
+
+	s, err = r.Status(toObject(t, `{ apiVersion: kafka.strimzi.io/v1beta1, kind: KafkaTopic, metadata: { name: t }, status: {} }`))
+	require.Nil(t, err)
+	a.True(s.Healthy)
+
+	s, err = r.Status(toObject(t, `{ apiVersion: argoproj.io/v1alpha1, kind: Rollout, metadata: { name: r }, status: { phase: Progressing } }`))
+	require.Nil(t, err)
+	a.False(s.Healthy)
+	a.Equal("phase is Progressing", s.Message)
+}
+
+func TestCustomChecksNegative(t *testing.T) {
+	_, err := NewRegistry([]model.HealthCheck{{Kind: "Foo", Expression: "{ healthy: "}}, vm.Config{})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "health check for Foo")
+
+	r, err := NewRegistry([]model.HealthCheck{{Kind: "Foo", Expression: "'ready'"}}, vm.Config{})
+	require.Nil(t, err)
+	_, err = r.Status(toObject(t, `{ apiVersion: v1, kind: Foo, metadata: { name: f } }`))
+	require.NotNil(t, err)
+	assert.Equal(t, `health check must return a boolean or an object, got "ready"`, err.Error())
+
+	r, err = NewRegistry([]model.HealthCheck{{Kind: "Foo", Expression: "{ message: 'x' }"}}, vm.Config{})
+	require.Nil(t, err)
+	_, err = r.Status(toObject(t, `{ apiVersion: v1, kind: Foo, metadata: { name: f } }`))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "did not have a boolean 'healthy' attribute")
+}
+
+func TestWait(t *testing.T) {
+	obj := toObject(t, `{ apiVersion: example.com/v1, kind: Widget, metadata: { name: w }, status: { conditions: [ { type: Ready, status: "False" } ] } }`)
+	local := model.NewK8sLocalObject(obj.Object, "app", "c1", "dev")
+	r, err := NewRegistry(nil, vm.Config{})
+	require.Nil(t, err)
+	calls := 0
+	get := func(o model.K8sMeta) (*unstructured.Unstructured, error) {
+		calls++
+		if calls == 3 {
+			return toObject(t, `{ apiVersion: example.com/v1, kind: Widget, metadata: { name: w }, status: { conditions: [ { type: Ready, status: "True" } ] } }`), nil
+		}
+		return obj, nil
+	}
+	opts := WaitOptions{
+		Timeout:     time.Second,
+		Interval:    time.Millisecond,
+		DisplayName: func(o model.K8sMeta) string { return fmt.Sprintf("%s:%s", o.GetKind(), o.GetName()) },
+	}
+	err = r.Wait([]model.K8sMeta{local}, get, opts)
+	require.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	opts.Timeout = 10 * time.Millisecond
+	err = r.Wait([]model.K8sMeta{local}, func(o model.K8sMeta) (*unstructured.Unstructured, error) { return obj, nil }, opts)
+	require.NotNil(t, err)
+	assert.Equal(t, "timed out waiting for 1 object(s)\nWidget:w: condition Ready is False", err.Error())
+}
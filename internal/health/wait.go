@@ -0,0 +1,95 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultInterval is the default interval between successive status checks.
+const DefaultInterval = 2 * time.Second
+
+// Getter returns the server object for the supplied object.
+type Getter func(obj model.K8sMeta) (*unstructured.Unstructured, error)
+
+// WaitOptions controls how objects are waited on.
+type WaitOptions struct {
+	Timeout     time.Duration                // max time to wait for all objects
+	Interval    time.Duration                // interval between checks, defaults to DefaultInterval
+	DisplayName func(o model.K8sMeta) string // function to display object names, required
+}
+
+// Wait waits for all supplied objects to be healthy. It returns an error if the objects are not healthy
+// within the timeout or if a check reports a terminal failure.
+func (r *Registry) Wait(objects []model.K8sMeta, get Getter, opts WaitOptions) error {
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	pending := map[string]model.K8sMeta{}
+	messages := map[string]string{}
+	for _, o := range objects {
+		pending[opts.DisplayName(o)] = o
+	}
+	deadline := time.Now().Add(opts.Timeout)
+	for {
+		var names []string
+		for name := range pending {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			obj, err := get(pending[name])
+			if err != nil {
+				return errors.Wrapf(err, "get %s", name)
+			}
+			status, err := r.Status(obj)
+			if err != nil {
+				return errors.Wrap(err, name)
+			}
+			if status.Healthy {
+				sio.Noticeln("ready", name)
+				delete(pending, name)
+				continue
+			}
+			if status.Message != messages[name] {
+				sio.Printf("waiting for %s: %s\n", name, status.Message)
+				messages[name] = status.Message
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().Add(opts.Interval).After(deadline) {
+			break
+		}
+		time.Sleep(opts.Interval)
+	}
+	var msgs []string
+	for name := range pending {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, messages[name]))
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("timed out waiting for %d object(s)\n%s", len(pending), strings.Join(msgs, "\n"))
+}
@@ -21,14 +21,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
 	"github.com/splunk/qbec/internal/sio"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // Baseline is a special environment name that represents the baseline environment with no customizations.
@@ -40,16 +44,36 @@ const (
 	DefaultParamsFile    = "params.libsonnet" // the default params files
 )
 
+// Timeout policies for components that exceed their timeouts.
+const (
+	TimeoutPolicyFail     = "fail"     // stop processing immediately
+	TimeoutPolicyContinue = "continue" // continue with other components and report the failure at the end
+)
+
+// Policy levels that determine what happens when an object violates a policy.
+const (
+	PolicyLevelDeny     = "deny"     // validation fails
+	PolicyLevelWarn     = "warn"     // the violation is reported but validation does not fail
+	PolicyLevelDisabled = "disabled" // the policy is not checked
+)
+
 var supportedExtensions = map[string]bool{
 	".jsonnet": true,
 	".yaml":    true,
 	".json":    true,
+	".cue":     true,
 }
 
 // Component is a file that contains objects to be applied to a cluster.
 type Component struct {
-	Name string // component name
-	File string // path to component file
+	Name           string                   // component name
+	File           string                   // path to component file, or a description of the chart or kustomization
+	Chart          *HelmChart               `json:"Chart,omitempty"`          // the chart rendered by the component, nil for components defined by files
+	Kustomization  *Kustomization           `json:"Kustomization,omitempty"`  // the kustomization built by the component, nil for components defined by files
+	Generator      *Generator               `json:"Generator,omitempty"`      // the generator that yields the component, nil for components that are not generated
+	GeneratorData  interface{}              `json:"GeneratorData,omitempty"`  // the data of the component in the source of its generator
+	Descriptor     *ComponentDescriptorSpec `json:"Descriptor,omitempty"`     // the metadata of the component, nil when it does not have a descriptor
+	DescriptorFile string                   `json:"DescriptorFile,omitempty"` // path to the descriptor file, empty when the component does not have one
 }
 
 // App is a qbec application wrapped with some runtime attributes.
@@ -58,6 +82,9 @@ type App struct {
 	root              string               // derived root directory of the app
 	allComponents     map[string]Component // all components whether or not included anywhere
 	defaultComponents map[string]Component // all components enabled by default
+	previews          map[string]*Preview  // preview environments added at runtime keyed by name
+	clusters          map[string]*Cluster  // cluster environments of multi-cluster environments keyed by name
+	decrypted         *decryptedValues     // cache of decrypted property values
 }
 
 // NewApp returns an app loading its details from the supplied file.
@@ -85,7 +112,7 @@ func NewApp(file string) (*App, error) {
 		return nil, fmt.Errorf("%d schema validation error(s): %s", len(errs), strings.Join(msgs, "\n"))
 	}
 
-	app := App{QbecApp: qApp}
+	app := App{QbecApp: qApp, decrypted: &decryptedValues{values: map[string]string{}}}
 	dir := filepath.Dir(file)
 	if !filepath.IsAbs(dir) {
 		var err error
@@ -96,6 +123,15 @@ func NewApp(file string) (*App, error) {
 	}
 	app.root = dir
 	app.setupDefaults()
+	if err := app.loadEnvironmentFiles(); err != nil {
+		return nil, err
+	}
+	if err := app.resolveParents(); err != nil {
+		return nil, err
+	}
+	if err := app.expandClusters(); err != nil {
+		return nil, err
+	}
 	app.allComponents, err = app.loadComponents()
 	if err != nil {
 		return nil, errors.Wrap(err, "load components")
@@ -103,11 +139,19 @@ func NewApp(file string) (*App, error) {
 	if err := app.verifyEnvAndComponentReferences(); err != nil {
 		return nil, err
 	}
+	if err := app.verifyTransformers(); err != nil {
+		return nil, err
+	}
+	if app.Spec.PropertySchema != nil {
+		if _, err := newPropertySchema(app.Spec.PropertySchema); err != nil {
+			return nil, errors.Wrap(err, "property schema")
+		}
+	}
 	app.defaultComponents = make(map[string]Component, len(app.allComponents))
 	for k, v := range app.allComponents {
 		app.defaultComponents[k] = v
 	}
-	for _, k := range app.Spec.Excludes {
+	for _, k := range app.ExpandComponentNames(app.Spec.Excludes) {
 		delete(app.defaultComponents, k)
 	}
 	return &app, nil
@@ -122,11 +166,306 @@ func (a *App) setupDefaults() {
 	}
 }
 
+// inheritEnvironment returns the supplied environment with attributes that it does not set inherited from its parent.
+func inheritEnvironment(parent, env Environment) Environment {
+	if env.DefaultNamespace == "" {
+		env.DefaultNamespace = parent.DefaultNamespace
+	}
+	if env.Server == "" && env.Context == "" && env.ContextPattern == "" && env.Clusters == nil {
+		env.Server, env.Context, env.ContextPattern = parent.Server, parent.Context, parent.ContextPattern
+		env.Clusters = parent.Clusters
+	}
+	if env.Includes == nil {
+		env.Includes = parent.Includes
+	}
+	if env.Excludes == nil {
+		env.Excludes = parent.Excludes
+	}
+	if env.ImagePolicy == nil {
+		env.ImagePolicy = parent.ImagePolicy
+	}
+	if env.Interlock == nil {
+		env.Interlock = parent.Interlock
+	}
+	if env.Transformers == nil {
+		env.Transformers = parent.Transformers
+	}
+	merge := func(parent, child map[string]string) map[string]string {
+		if len(parent) == 0 {
+			return child
+		}
+		ret := map[string]string{}
+		for k, v := range parent {
+			ret[k] = v
+		}
+		for k, v := range child {
+			ret[k] = v
+		}
+		return ret
+	}
+	env.ComponentRefs = merge(parent.ComponentRefs, env.ComponentRefs)
+	env.Properties = merge(parent.Properties, env.Properties)
+	env.Policies = merge(parent.Policies, env.Policies)
+	if len(parent.Defaults) > 0 {
+		defaults := map[string]map[string]interface{}{}
+		for cmd, flags := range parent.Defaults {
+			defaults[cmd] = flags
+		}
+		for cmd, flags := range env.Defaults {
+			if p := parent.Defaults[cmd]; len(p) > 0 {
+				m := map[string]interface{}{}
+				for k, v := range p {
+					m[k] = v
+				}
+				for k, v := range flags {
+					m[k] = v
+				}
+				flags = m
+			}
+			defaults[cmd] = flags
+		}
+		env.Defaults = defaults
+	}
+	env.RequireConfirmation = env.RequireConfirmation || parent.RequireConfirmation
+	return env
+}
+
+// resolveParents replaces environments that declare a parent with the result of inheriting from their parents,
+// which are resolved first.
+func (a *App) resolveParents() error {
+	resolved := map[string]bool{}
+	var resolve func(name string, chain []string) error
+	resolve = func(name string, chain []string) error {
+		if resolved[name] {
+			return nil
+		}
+		for _, c := range chain {
+			if c == name {
+				return fmt.Errorf("environment %s: cycle in parents %s", name, strings.Join(append(chain, name), " -> "))
+			}
+		}
+		env := a.Spec.Environments[name]
+		if env.Parent != "" {
+			if _, ok := a.Spec.Environments[env.Parent]; !ok {
+				return fmt.Errorf("environment %s: parent %q is not an environment", name, env.Parent)
+			}
+			if err := resolve(env.Parent, append(chain, name)); err != nil {
+				return err
+			}
+			a.Spec.Environments[name] = inheritEnvironment(a.Spec.Environments[env.Parent], env)
+		}
+		resolved[name] = true
+		return nil
+	}
+	var names []string
+	for name := range a.Spec.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateProperties returns an error if the supplied properties of an environment do not conform to the property
+// schema of the app.
+func (a *App) ValidateProperties(env string, props map[string]string) error {
+	if a.Spec.PropertySchema == nil {
+		return nil
+	}
+	s, err := newPropertySchema(a.Spec.PropertySchema)
+	if err != nil {
+		return errors.Wrap(err, "property schema")
+	}
+	errs := validateProperties(s, props)
+	if len(errs) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("environment %s: %d property validation error(s): %s", env, len(errs), strings.Join(msgs, "\n"))
+}
+
 // Name returns the name of the application.
 func (a *App) Name() string {
 	return a.Metadata.Name
 }
 
+// ComponentTimeouts returns the apply and wait timeouts configured for the supplied component. A zero value
+// is returned for timeouts that have not been set.
+func (a *App) ComponentTimeouts(component string) (apply time.Duration, wait time.Duration) {
+	spec := a.Spec.Components[component]
+	apply, _ = time.ParseDuration(spec.ApplyTimeout)
+	wait, _ = time.ParseDuration(spec.WaitTimeout)
+	return apply, wait
+}
+
+// ComponentEvalLimits returns the max evaluation time and memory in bytes of the supplied component, from its spec
+// or those of the app for limits that the component does not set. A zero value is returned for limits that have not
+// been set.
+func (a *App) ComponentEvalLimits(component string) (timeout time.Duration, maxMemory int64) {
+	for _, l := range []*EvalLimits{a.Spec.Components[component].EvalLimits, a.Spec.EvalLimits} {
+		if l == nil {
+			continue
+		}
+		if timeout == 0 && l.Timeout != "" {
+			timeout, _ = time.ParseDuration(l.Timeout)
+		}
+		if maxMemory == 0 && l.MaxMemory != "" {
+			if q, err := resource.ParseQuantity(l.MaxMemory); err == nil {
+				maxMemory = q.Value()
+			}
+		}
+	}
+	return timeout, maxMemory
+}
+
+// verifyEvalLimits returns the errors of the supplied evaluation limits.
+func verifyEvalLimits(src string, l *EvalLimits) []string {
+	if l == nil {
+		return nil
+	}
+	var errs []string
+	if l.Timeout != "" {
+		if d, err := time.ParseDuration(l.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Sprintf("%s: invalid evaluation timeout %q", src, l.Timeout))
+		}
+	}
+	if l.MaxMemory != "" {
+		if q, err := resource.ParseQuantity(l.MaxMemory); err != nil || q.Value() <= 0 {
+			errs = append(errs, fmt.Sprintf("%s: invalid evaluation memory limit %q", src, l.MaxMemory))
+		}
+	}
+	return errs
+}
+
+// ComponentImpersonation returns the identity to impersonate for objects of the supplied component or nil
+// if the component should be applied using the current identity.
+func (a *App) ComponentImpersonation(component string) *Impersonation {
+	return a.Spec.Components[component].Impersonate
+}
+
+// ComponentDependencies returns the components that each component depends on as declared in qbec.yaml and
+// component descriptors, keyed by component name.
+func (a *App) ComponentDependencies() map[string][]string {
+	ret := map[string][]string{}
+	add := func(name string, deps []string) {
+		for _, d := range deps {
+			if !contains(ret[name], d) {
+				ret[name] = append(ret[name], d)
+			}
+		}
+	}
+	for name, spec := range a.Spec.Components {
+		add(name, spec.DependsOn)
+	}
+	for name, c := range a.allComponents {
+		if c.Descriptor != nil {
+			add(name, c.Descriptor.DependsOn)
+		}
+	}
+	return ret
+}
+
+// CheckComponentDependencies returns an error if the supplied dependencies of components, keyed by component name,
+// have a cycle.
+func CheckComponentDependencies(deps map[string][]string) error {
+	var names []string
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	done := map[string]bool{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		for i, p := range path {
+			if p == name {
+				return fmt.Errorf("component dependency cycle: %s", strings.Join(append(path[i:], name), " -> "))
+			}
+		}
+		if done[name] {
+			return nil
+		}
+		path = append(path, name)
+		for _, d := range deps[name] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		done[name] = true
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnvironmentsForGroup returns the environments that are part of the supplied environment group.
+func (a *App) EnvironmentsForGroup(group string) ([]string, error) {
+	envs, ok := a.Spec.EnvGroups[group]
+	if !ok {
+		return nil, fmt.Errorf("invalid environment group %q", group)
+	}
+	return envs, nil
+}
+
+// TimeoutPolicy returns the policy to use when a component exceeds its timeouts.
+func (a *App) TimeoutPolicy() string {
+	if a.Spec.TimeoutPolicy == "" {
+		return TimeoutPolicyFail
+	}
+	return a.Spec.TimeoutPolicy
+}
+
+// PolicyLevel returns the level of the supplied policy for an environment, taking environment overrides into account.
+func (a *App) PolicyLevel(env string, p Policy) string {
+	if level, ok := a.Spec.Environments[env].Policies[p.Name]; ok {
+		return level
+	}
+	if p.Level == "" {
+		return PolicyLevelDeny
+	}
+	return p.Level
+}
+
+// ImagePolicy returns the image policy for an environment, taking environment changes into account, along with the
+// patterns of images exempt from it. It returns a nil policy if images are not restricted for the environment.
+func (a *App) ImagePolicy(env string) (*ImagePolicy, []string) {
+	envPolicy := a.Spec.Environments[env].ImagePolicy
+	if a.Spec.ImagePolicy == nil && envPolicy == nil {
+		return nil, nil
+	}
+	var p ImagePolicy
+	if a.Spec.ImagePolicy != nil {
+		p = *a.Spec.ImagePolicy
+	}
+	if envPolicy == nil {
+		return &p, nil
+	}
+	p.RequireDigest = p.RequireDigest || envPolicy.RequireDigest
+	return &p, envPolicy.Exceptions
+}
+
+// ApplyOrders returns the apply orders configured for kinds of objects.
+func (a *App) ApplyOrders() map[schema.GroupKind]int {
+	ret := map[schema.GroupKind]int{}
+	for _, o := range a.Spec.ApplyOrder {
+		ret[schema.GroupKind{Group: o.Group, Kind: o.Kind}] = o.Order
+	}
+	return ret
+}
+
 // ComponentsForEnvironment returns a slice of components for the specified
 // environment, taking intrinsic as well as specified inclusions and exclusions into account.
 // All names in the supplied subsets must be valid component names. If a specified component is valid but has been excluded
@@ -144,6 +483,7 @@ func (a *App) ComponentsForEnvironment(env string, includes, excludes []string)
 		return ret
 	}
 
+	includes, excludes = a.ExpandComponentNames(includes), a.ExpandComponentNames(excludes)
 	cf, err := NewComponentFilter(includes, excludes)
 	if err != nil {
 		return nil, err
@@ -167,13 +507,13 @@ func (a *App) ComponentsForEnvironment(env string, includes, excludes []string)
 		for k, v := range a.defaultComponents {
 			ret[k] = v
 		}
-		for _, k := range e.Excludes {
+		for _, k := range a.ExpandComponentNames(e.Excludes) {
 			if _, ok := ret[k]; !ok {
 				sio.Warnf("component %s excluded from %s is already excluded by default\n", k, env)
 			}
 			delete(ret, k)
 		}
-		for _, k := range e.Includes {
+		for _, k := range a.ExpandComponentNames(e.Includes) {
 			if _, ok := ret[k]; ok {
 				sio.Warnf("component %s included from %s is already included by default\n", k, env)
 			}
@@ -199,11 +539,43 @@ func (a *App) ComponentsForEnvironment(env string, includes, excludes []string)
 	return toList(subret), nil
 }
 
-// loadComponents loads metadata for all components for the app.
-// The data is returned as a map keyed by component name. It does _not_ recurse
-// into subdirectories.
+// Component returns the component with the supplied name, with false if the app has no such component.
+func (a *App) Component(name string) (Component, bool) {
+	c, ok := a.allComponents[name]
+	return c, ok
+}
+
+// ExpandComponentNames returns the supplied component names with every name that is not a component, but a directory
+// of nested components, replaced by the sorted names of the components under it. Other names are returned as is.
+func (a *App) ExpandComponentNames(names []string) []string {
+	var ret []string
+	for _, name := range names {
+		if _, ok := a.allComponents[name]; ok {
+			ret = append(ret, name)
+			continue
+		}
+		prefix := strings.TrimSuffix(name, "/") + "/"
+		var nested []string
+		for _, c := range sortedComponentNames(a.allComponents) {
+			if strings.HasPrefix(c, prefix) {
+				nested = append(nested, c)
+			}
+		}
+		if len(nested) == 0 {
+			nested = []string{name}
+		}
+		ret = append(ret, nested...)
+	}
+	return ret
+}
+
+// loadComponents loads metadata for all components for the app, including remote components, helm charts and
+// generated components. The data is returned as a map keyed by component name. It does _not_ recurse into
+// subdirectories unless the app has nested components, in which case components are named by their paths relative
+// to the components directory.
 func (a *App) loadComponents() (map[string]Component, error) {
 	var list []Component
+	var descriptors []string
 	dir := strings.TrimSuffix(filepath.Clean(a.Spec.ComponentsDir), "/")
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -213,12 +585,23 @@ func (a *App) loadComponents() (map[string]Component, error) {
 			return nil
 		}
 		if info.IsDir() {
-			return filepath.SkipDir
+			if !a.Spec.NestedComponents || strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isComponentDescriptor(path) {
+			descriptors = append(descriptors, path)
+			return nil
 		}
 		extension := filepath.Ext(path)
 		if supportedExtensions[extension] {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
 			list = append(list, Component{
-				Name: strings.TrimSuffix(filepath.Base(path), extension),
+				Name: filepath.ToSlash(strings.TrimSuffix(rel, extension)),
 				File: path,
 			})
 		}
@@ -227,6 +610,26 @@ func (a *App) loadComponents() (map[string]Component, error) {
 	if err != nil {
 		return nil, err
 	}
+	remote, err := a.loadRemoteComponents()
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, remote...)
+	charts, err := a.loadHelmCharts()
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, charts...)
+	kustomizations, err := a.loadKustomizations()
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, kustomizations...)
+	generated, err := a.loadGeneratedComponents()
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, generated...)
 	m := make(map[string]Component, len(list))
 	for _, c := range list {
 		if old, ok := m[c.Name]; ok {
@@ -234,6 +637,9 @@ func (a *App) loadComponents() (map[string]Component, error) {
 		}
 		m[c.Name] = c
 	}
+	if err := a.loadComponentDescriptors(m, dir, descriptors); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
@@ -250,6 +656,33 @@ func (a *App) verifyComponentList(src string, comps []string) error {
 	return nil
 }
 
+func sortedComponentNames(components map[string]Component) []string {
+	var ret []string
+	for name := range components {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedPolicyNames(levels map[string]string) []string {
+	var ret []string
+	for name := range levels {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 var reEnvName = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])$`) // XXX: duplicated in swagger
 
 func (a *App) verifyEnvAndComponentReferences() error {
@@ -259,7 +692,48 @@ func (a *App) verifyEnvAndComponentReferences() error {
 			errs = append(errs, err.Error())
 		}
 	}
-	localVerify("default exclusions", a.Spec.Excludes)
+	localVerify("default exclusions", a.ExpandComponentNames(a.Spec.Excludes))
+	var names []string
+	for name := range a.Spec.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	localVerify("component specs", names)
+	errs = append(errs, verifyEvalLimits("app", a.Spec.EvalLimits)...)
+	for _, name := range names {
+		spec := a.Spec.Components[name]
+		errs = append(errs, verifyEvalLimits("component "+name, spec.EvalLimits)...)
+		timeouts := []struct{ attr, value string }{
+			{"applyTimeout", spec.ApplyTimeout},
+			{"waitTimeout", spec.WaitTimeout},
+		}
+		for _, t := range timeouts {
+			if t.value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(t.value); err != nil {
+				errs = append(errs, fmt.Sprintf("component %s: invalid %s %q", name, t.attr, t.value))
+			}
+		}
+		if spec.Impersonate != nil && spec.Impersonate.User == "" {
+			errs = append(errs, fmt.Sprintf("component %s: impersonation requires a user", name))
+		}
+	}
+	for _, name := range sortedComponentNames(a.allComponents) {
+		deps := a.Spec.Components[name].DependsOn
+		if d := a.allComponents[name].Descriptor; d != nil {
+			deps = append(append([]string{}, deps...), d.DependsOn...)
+		}
+		localVerify(fmt.Sprintf("component %s dependencies", name), deps)
+		if contains(deps, name) {
+			errs = append(errs, fmt.Sprintf("component %s: cannot depend on itself", name))
+		}
+	}
+	if len(errs) == 0 {
+		if err := CheckComponentDependencies(a.ComponentDependencies()); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
 	for e, env := range a.Spec.Environments {
 		if e == Baseline {
 			return fmt.Errorf("cannot use _ as an environment name since it has a special meaning")
@@ -267,18 +741,116 @@ func (a *App) verifyEnvAndComponentReferences() error {
 		if !reEnvName.MatchString(e) {
 			return fmt.Errorf("invalid environment %s, must match %s", e, reEnvName)
 		}
-		localVerify(e+" inclusions", env.Includes)
-		localVerify(e+" exclusions", env.Excludes)
+		bindings := 0
+		for _, b := range []string{env.Server, env.Context, env.ContextPattern} {
+			if b != "" {
+				bindings++
+			}
+		}
+		if bindings > 1 {
+			errs = append(errs, fmt.Sprintf("env %s: only one of server, context and contextPattern may be set", e))
+		}
+		if env.ContextPattern != "" {
+			if _, err := regexp.Compile(env.ContextPattern); err != nil {
+				errs = append(errs, fmt.Sprintf("env %s: invalid context pattern %q: %v", e, env.ContextPattern, err))
+			}
+		}
+		var pinned []string
+		for c := range env.ComponentRefs {
+			pinned = append(pinned, c)
+		}
+		sort.Strings(pinned)
+		localVerify(e+" component refs", pinned)
+		includes, excludes := a.ExpandComponentNames(env.Includes), a.ExpandComponentNames(env.Excludes)
+		localVerify(e+" inclusions", includes)
+		localVerify(e+" exclusions", excludes)
 		includeMap := map[string]bool{}
-		for _, inc := range env.Includes {
+		for _, inc := range includes {
 			includeMap[inc] = true
 		}
-		for _, exc := range env.Excludes {
+		for _, exc := range excludes {
 			if includeMap[exc] {
 				errs = append(errs, fmt.Sprintf("env %s: component %s present in both include and exclude sections", e, exc))
 			}
 		}
 	}
+	for _, p := range a.Spec.RedactPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid redaction pattern %q: %v", p, err))
+		}
+	}
+	seenOrders := map[schema.GroupKind]bool{}
+	for _, o := range a.Spec.ApplyOrder {
+		gk := schema.GroupKind{Group: o.Group, Kind: o.Kind}
+		if seenOrders[gk] {
+			errs = append(errs, fmt.Sprintf("apply order: duplicate entries for kind %s", gk.String()))
+		}
+		seenOrders[gk] = true
+	}
+	if vars := a.Spec.Vars; vars != nil {
+		for _, decls := range []struct {
+			kind string
+			vars []Var
+		}{{"external", vars.External}, {"top-level", vars.TopLevel}} {
+			seen := map[string]bool{}
+			for _, v := range decls.vars {
+				if seen[v.Name] {
+					errs = append(errs, fmt.Sprintf("%s variable %s: duplicate declaration", decls.kind, v.Name))
+				}
+				seen[v.Name] = true
+				if v.Required && v.Default != "" {
+					errs = append(errs, fmt.Sprintf("%s variable %s: required variables cannot have a default", decls.kind, v.Name))
+				}
+			}
+		}
+	}
+	policies := map[string]bool{}
+	for _, p := range a.Spec.Policies {
+		if policies[p.Name] {
+			errs = append(errs, fmt.Sprintf("policy %s: duplicate definition", p.Name))
+		}
+		policies[p.Name] = true
+	}
+	var envNames []string
+	for e := range a.Spec.Environments {
+		envNames = append(envNames, e)
+	}
+	sort.Strings(envNames)
+	for _, e := range envNames {
+		for _, name := range sortedPolicyNames(a.Spec.Environments[e].Policies) {
+			if !policies[name] {
+				errs = append(errs, fmt.Sprintf("env %s: level set for undefined policy %s", e, name))
+			}
+		}
+		if p := a.Spec.Environments[e].ImagePolicy; p != nil {
+			for _, pattern := range p.Exceptions {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, fmt.Sprintf("env %s: invalid image exception %q", e, pattern))
+				}
+			}
+		}
+		if il := a.Spec.Environments[e].Interlock; il != nil {
+			for _, p := range []struct{ name, pattern string }{{"current context", il.CurrentContext}, {"current namespace", il.CurrentNamespace}} {
+				if _, err := regexp.Compile(p.pattern); err != nil {
+					errs = append(errs, fmt.Sprintf("env %s: invalid interlock %s pattern %q: %v", e, p.name, p.pattern, err))
+				}
+			}
+		}
+	}
+	errs = append(errs, a.verifyEncryptedProperties()...)
+	for g, members := range a.Spec.EnvGroups {
+		if !reEnvName.MatchString(g) {
+			return fmt.Errorf("invalid environment group %s, must match %s", g, reEnvName)
+		}
+		if _, ok := a.Spec.Environments[g]; ok {
+			return fmt.Errorf("environment group %s has the same name as an environment", g)
+		}
+		for _, e := range members {
+			if _, ok := a.Spec.Environments[e]; !ok {
+				return fmt.Errorf("environment group %s: invalid environment %q", g, e)
+			}
+		}
+	}
 	if len(errs) > 0 {
 		return fmt.Errorf("invalid component references\n:\t%s", strings.Join(errs, "\n\t"))
 	}
@@ -18,9 +18,11 @@ package model
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/splunk/qbec/internal/sio"
 	"github.com/stretchr/testify/assert"
@@ -115,6 +117,121 @@ func TestAppWarnings(t *testing.T) {
 	a.Contains(buf.String(), "[warn] component a excluded from prod is already excluded by default")
 }
 
+func TestAppEnvironmentParents(t *testing.T) {
+	reset := setPwd(t, "./testdata/bad-app")
+	defer reset()
+	app, err := NewApp("app-inherit.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	eu := app.Spec.Environments["prod-eu"]
+	a.Equal("prod", eu.Parent)
+	a.Equal("https://prod-server", eu.Server)
+	a.Equal("prod", eu.DefaultNamespace)
+	a.Equal([]string{"a"}, eu.Includes)
+	a.Equal(map[string]string{"domain": "eu.prod.example.com", "tier": "gold"}, eu.Properties)
+	a.Equal(map[string]string{"no-latest": "warn"}, eu.Policies)
+	a.True(eu.RequireConfirmation)
+	a.Equal(&EnvironmentInterlock{CurrentContext: "^prod-", Servers: []string{"https://prod-server"}}, eu.Interlock)
+	a.Equal(map[string]map[string]interface{}{
+		"apply": {"wait": true, "wait-timeout": "20m", "gc": false},
+		"diff":  {"ignore-all-annotations": true},
+	}, eu.Defaults)
+	a.Equal(map[string]interface{}{"wait": true, "wait-timeout": "10m"}, app.Spec.Environments["prod"].Defaults["apply"])
+
+	eu2 := app.Spec.Environments["prod-eu-2"]
+	a.Equal("https://prod-eu-2-server", eu2.Server)
+	a.Equal("prod", eu2.DefaultNamespace)
+	a.Equal([]string{}, eu2.Includes)
+	a.Equal("eu.prod.example.com", eu2.Properties["domain"])
+	a.Equal(map[string]string{"domain": "prod.example.com", "tier": "gold"}, app.Spec.Environments["prod"].Properties)
+
+	comps, err := app.ComponentsForEnvironment("prod-eu", nil, nil)
+	require.Nil(t, err)
+	a.Equal(3, len(comps))
+	comps, err = app.ComponentsForEnvironment("prod-eu-2", nil, nil)
+	require.Nil(t, err)
+	a.Equal(2, len(comps))
+}
+
+func TestAppDecryptProperties(t *testing.T) {
+	reset := setPwd(t, "./testdata/bad-app")
+	defer reset()
+	app, err := NewApp("app-encrypted.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	props := app.Spec.Environments["dev"].Properties
+	decrypted, err := app.DecryptProperties("dev", props)
+	require.Nil(t, err)
+	a.Equal(map[string]string{"domain": "example.com", "token": "token"}, decrypted)
+	a.NotEqual("token", props["token"])
+
+	// decrypted values are cached
+	app.Spec.KeyProviders[0].Command = []string{"false"}
+	decrypted, err = app.DecryptProperties("dev", props)
+	require.Nil(t, err)
+	a.Equal("token", decrypted["token"])
+
+	_, err = app.DecryptProperties("dev", map[string]string{"dsn": "ENC[rot13:cXVy]"})
+	require.NotNil(t, err)
+	a.Contains(err.Error(), "env dev: decrypt property dsn: key provider rot13: exit status 1")
+}
+
+func TestAppClusters(t *testing.T) {
+	reset := setPwd(t, "./testdata/bad-app")
+	defer reset()
+	app, err := NewApp("app-clusters.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal([]string{"prod.us-east", "prod.eu-west"}, app.ClusterEnvironments("prod"))
+	a.Nil(app.ClusterEnvironments("dev"))
+	a.Nil(app.Cluster("prod"))
+
+	east := app.Spec.Environments["prod.us-east"]
+	a.Equal("https://us-east-server", east.Server)
+	a.Equal("prod", east.DefaultNamespace)
+	a.Nil(east.Clusters)
+	a.Equal(map[string]string{"domain": "us-east.prod.example.com", "tier": "gold"}, east.Properties)
+	a.Equal(&Cluster{Env: "prod.us-east", Base: "prod", Name: "us-east", Properties: east.Properties}, app.Cluster("prod.us-east"))
+
+	west := app.Spec.Environments["prod.eu-west"]
+	a.Equal("", west.Server)
+	a.Equal("eu-west-admin", west.Context)
+	a.Equal(map[string]string{"domain": "prod.example.com", "tier": "gold"}, west.Properties)
+
+	a.Equal([]string{"prod-canary.us-east", "prod-canary.eu-west"}, app.ClusterEnvironments("prod-canary"))
+	canary := app.Spec.Environments["prod-canary.eu-west"]
+	a.Equal([]string{"a"}, canary.Includes)
+	a.Equal("", canary.Parent)
+	a.Equal("prod-canary", app.Cluster("prod-canary.eu-west").Base)
+}
+
+func TestAppValidateProperties(t *testing.T) {
+	app := &App{}
+	a := assert.New(t)
+	a.Nil(app.ValidateProperties("dev", map[string]string{"foo": "bar"}))
+	app.Spec.PropertySchema = map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"domain", "tier"},
+		"properties": map[string]interface{}{
+			"domain": map[string]interface{}{"type": "string", "pattern": "^[a-z.]+$"},
+			"tier":   map[string]interface{}{"type": "string", "enum": []interface{}{"gold", "silver"}},
+		},
+		"additionalProperties": false,
+	}
+	a.Nil(app.ValidateProperties("dev", map[string]string{"domain": "dev.example.com", "tier": "gold"}))
+	err := app.ValidateProperties("dev", map[string]string{"domian": "dev.example.com", "tier": "bronze"})
+	require.NotNil(t, err)
+	a.Contains(err.Error(), "environment dev: 3 property validation error(s): ")
+	a.Contains(err.Error(), "property.domain in body is required")
+	a.Contains(err.Error(), "property.domian in body is a forbidden property")
+	a.Contains(err.Error(), "property.tier in body should be one of [gold silver]")
+
+	app.Spec.PropertySchema = map[string]interface{}{"type": "string"}
+	err = app.ValidateProperties("dev", nil)
+	require.NotNil(t, err)
+	a.Equal("property schema: must be the schema of an object, found type string", err.Error())
+}
+
 func TestAppComponentLoadNegative(t *testing.T) {
 	reset := setPwd(t, "../../examples/test-app")
 	defer reset()
@@ -202,6 +319,159 @@ func TestAppNegative(t *testing.T) {
 				assert.Contains(t, err.Error(), "metadata.name in body should match")
 			},
 		},
+		{
+			file: "bad-component-spec.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "component specs: bad component reference(s): d")
+			},
+		},
+		{
+			file: "bad-component-timeout.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `component a: invalid applyTimeout "10 minutes"`)
+			},
+		},
+		{
+			file: "bad-eval-limits.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `app: invalid evaluation timeout "forever"`)
+				assert.Contains(t, err.Error(), `component a: invalid evaluation memory limit "lots"`)
+			},
+		},
+		{
+			file: "bad-component-impersonation.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "component a: impersonation requires a user")
+			},
+		},
+		{
+			file: "bad-component-deps.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "component a dependencies: bad component reference(s): d")
+				assert.Contains(t, err.Error(), "component a: cannot depend on itself")
+			},
+		},
+		{
+			file: "bad-component-deps-cycle.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "component dependency cycle: a -> b -> c -> a")
+			},
+		},
+		{
+			file: "bad-apply-order.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "apply order: duplicate entries for kind Widget.example.com")
+			},
+		},
+		{
+			file: "bad-redact-pattern.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `invalid redaction pattern "token=(.*"`)
+			},
+		},
+		{
+			file: "bad-vars.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `external variable image_tag: required variables cannot have a default`)
+				assert.Contains(t, err.Error(), `top-level variable replicas: duplicate declaration`)
+			},
+		},
+		{
+			file: "bad-env-group.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `environment group all: invalid environment "prod"`)
+			},
+		},
+		{
+			file: "bad-env-group-name.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `environment group dev has the same name as an environment`)
+			},
+		},
+		{
+			file: "bad-property-schema.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Equal(t, `property schema: property domain: invalid pattern "^[a-z"`, err.Error())
+			},
+		},
+		{
+			file: "bad-env-component-refs.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "dev component refs: bad component reference(s): d")
+			},
+		},
+		{
+			file: "bad-env-context.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "env dev: only one of server, context and contextPattern may be set")
+				assert.Contains(t, err.Error(), `env prod: invalid context pattern "^prod-("`)
+			},
+		},
+		{
+			file: "bad-env-parent.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `environment dev: parent "base" is not an environment`)
+			},
+		},
+		{
+			file: "bad-env-clusters.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `env prod: cannot set server, context or contextPattern as well as clusters`)
+			},
+		},
+		{
+			file: "bad-env-cluster-binding.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `env prod: cluster eu-west must set exactly one of server, context and contextPattern`)
+			},
+		},
+		{
+			file: "bad-env-cluster-name.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `env prod: environment prod.us-east of cluster us-east has the same name as an existing environment`)
+			},
+		},
+		{
+			file: "bad-env-parent-cycle.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `environment a: cycle in parents a -> c -> b -> a`)
+			},
+		},
+		{
+			file: "bad-env-defaults.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "defaults.upgrade")
+			},
+		},
+		{
+			file: "bad-env-encrypted.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "key provider age: duplicate definition")
+				assert.Contains(t, err.Error(), "env dev: property dsn uses undefined key provider kms")
+				assert.Contains(t, err.Error(), "env dev: property password: encrypted value must have the form ENC[<provider>:<base64 ciphertext>]")
+				assert.Contains(t, err.Error(), "env dev: property token: invalid ciphertext")
+			},
+		},
+		{
+			file: "bad-env-interlock.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "env dev: invalid interlock current context pattern \"(dev\"")
+				assert.Contains(t, err.Error(), "env dev: invalid interlock current namespace pattern \"[\"")
+			},
+		},
+		{
+			file: "bad-policies.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), "policy no-latest: duplicate definition")
+				assert.Contains(t, err.Error(), "env dev: level set for undefined policy limits")
+			},
+		},
+		{
+			file: "bad-image-policy.yaml",
+			asserter: func(t *testing.T, err error) {
+				assert.Contains(t, err.Error(), `env dev: invalid image exception "quay.io/vendor/["`)
+			},
+		},
 		{
 			file: "bad-env-name.yaml",
 			asserter: func(t *testing.T, err error) {
@@ -218,3 +488,131 @@ func TestAppNegative(t *testing.T) {
 		})
 	}
 }
+
+func TestAppImagePolicy(t *testing.T) {
+	app := &App{QbecApp: QbecApp{Spec: AppSpec{
+		ImagePolicy: &ImagePolicy{AllowedRegistries: []string{"gcr.io"}},
+		Environments: map[string]Environment{
+			"dev":  {},
+			"prod": {ImagePolicy: &EnvironmentImagePolicy{RequireDigest: true, Exceptions: []string{"quay.io/vendor/*"}}},
+		},
+	}}}
+	a := assert.New(t)
+	p, exceptions := app.ImagePolicy("dev")
+	require.NotNil(t, p)
+	a.Equal(ImagePolicy{AllowedRegistries: []string{"gcr.io"}}, *p)
+	a.Nil(exceptions)
+	p, exceptions = app.ImagePolicy("prod")
+	require.NotNil(t, p)
+	a.Equal(ImagePolicy{AllowedRegistries: []string{"gcr.io"}, RequireDigest: true}, *p)
+	a.Equal([]string{"quay.io/vendor/*"}, exceptions)
+	a.False(app.Spec.ImagePolicy.RequireDigest)
+
+	app.Spec.ImagePolicy = nil
+	p, _ = app.ImagePolicy("dev")
+	a.Nil(p)
+	p, _ = app.ImagePolicy("prod")
+	require.NotNil(t, p)
+	a.True(p.RequireDigest)
+}
+
+func TestAppNestedComponents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nested")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"components/top.yaml":                        "{}",
+		"components/team-a/service-b.jsonnet":        "{}",
+		"components/team-a/service-c.yaml":           "{}",
+		"components/team-a/service-c.component.yaml": "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  tags: [a]\n",
+		"components/team-a/workers/queue.json":       "{}",
+		"components/team-b/service-d.jsonnet":        "{}",
+		"components/.cache/ignored.yaml":             "{}",
+		"components/team-b/README.md":                "",
+	}
+	for file, contents := range files {
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644))
+	}
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: nested
+spec:
+  nestedComponents: true
+  excludes:
+  - team-b
+  environments:
+    dev:
+      server: https://dev-server
+      includes:
+      - team-b/
+      excludes:
+      - team-a/workers
+    prod:
+      server: https://prod-server
+`
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	defer reset()
+
+	a := assert.New(t)
+	names := func(comps []Component) []string {
+		var ret []string
+		for _, c := range comps {
+			ret = append(ret, c.Name)
+		}
+		return ret
+	}
+	qApp, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	comps, err := qApp.ComponentsForEnvironment(Baseline, nil, nil)
+	require.Nil(t, err)
+	a.Equal([]string{"team-a/service-b", "team-a/service-c", "team-a/workers/queue", "top"}, names(comps))
+	c, _ := qApp.Component("team-a/service-c")
+	a.Equal("components/team-a/service-c.yaml", c.File)
+	require.NotNil(t, c.Descriptor)
+	a.Equal([]string{"a"}, c.Descriptor.Tags)
+
+	comps, err = qApp.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	a.Equal([]string{"team-a/service-b", "team-a/service-c", "team-b/service-d", "top"}, names(comps))
+	comps, err = qApp.ComponentsForEnvironment("prod", []string{"team-a"}, nil)
+	require.Nil(t, err)
+	a.Equal([]string{"team-a/service-b", "team-a/service-c", "team-a/workers/queue"}, names(comps))
+	comps, err = qApp.ComponentsForEnvironment("prod", nil, []string{"team-a/"})
+	require.Nil(t, err)
+	a.Equal([]string{"top"}, names(comps))
+	_, err = qApp.ComponentsForEnvironment("prod", []string{"team-c"}, nil)
+	require.NotNil(t, err)
+	a.Contains(err.Error(), "team-c")
+
+	a.Equal([]string{"top", "team-a/workers/queue", "team-c"}, qApp.ExpandComponentNames([]string{"top", "team-a/workers", "team-c"}))
+
+	qApp.Spec.NestedComponents = false
+	m, err := qApp.loadComponents()
+	require.Nil(t, err)
+	a.Equal([]string{"top"}, sortedComponentNames(m))
+}
+
+func TestAppComponentEvalLimits(t *testing.T) {
+	app := &App{QbecApp: QbecApp{Spec: AppSpec{
+		EvalLimits: &EvalLimits{Timeout: "30s", MaxMemory: "512Mi"},
+		Components: map[string]ComponentSpec{
+			"a": {EvalLimits: &EvalLimits{Timeout: "2m"}},
+			"b": {ApplyTimeout: "1m"},
+		},
+	}}}
+	a := assert.New(t)
+	timeout, maxMemory := app.ComponentEvalLimits("a")
+	a.Equal(2*time.Minute, timeout)
+	a.EqualValues(512*1024*1024, maxMemory)
+	timeout, maxMemory = app.ComponentEvalLimits("b")
+	a.Equal(30*time.Second, timeout)
+	a.EqualValues(512*1024*1024, maxMemory)
+
+	app.Spec.EvalLimits = nil
+	timeout, maxMemory = app.ComponentEvalLimits("b")
+	a.Equal(time.Duration(0), timeout)
+	a.EqualValues(0, maxMemory)
+}
@@ -0,0 +1,111 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Cluster is one of the clusters of an environment that is deployed to multiple clusters. Each cluster is a separate
+// environment with the components and parameters of the environment it belongs to, bound to the server or context of
+// the cluster.
+type Cluster struct {
+	Env        string            `json:"env"`        // the name of the cluster environment
+	Base       string            `json:"base"`       // the environment that the cluster belongs to
+	Name       string            `json:"name"`       // the name of the cluster
+	Properties map[string]string `json:"properties"` // properties of the environment merged with those of the cluster
+}
+
+// ClusterEnvName returns the name of the environment for the supplied cluster of an environment.
+func ClusterEnvName(env, cluster string) string {
+	return env + "." + cluster
+}
+
+// expandClusters adds an environment for every cluster of multi-cluster environments. It must be called after parents
+// are resolved so that children of multi-cluster environments are expanded as well.
+func (a *App) expandClusters() error {
+	var names []string
+	for name, env := range a.Spec.Environments {
+		if len(env.Clusters) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env := a.Spec.Environments[name]
+		if env.Server != "" || env.Context != "" || env.ContextPattern != "" {
+			return fmt.Errorf("env %s: cannot set server, context or contextPattern as well as clusters", name)
+		}
+		seen := map[string]bool{}
+		for _, c := range env.Clusters {
+			if !reEnvName.MatchString(c.Name) {
+				return fmt.Errorf("env %s: invalid cluster %s, must match %s", name, c.Name, reEnvName)
+			}
+			if seen[c.Name] {
+				return fmt.Errorf("env %s: duplicate cluster %s", name, c.Name)
+			}
+			seen[c.Name] = true
+			bindings := 0
+			for _, b := range []string{c.Server, c.Context, c.ContextPattern} {
+				if b != "" {
+					bindings++
+				}
+			}
+			if bindings != 1 {
+				return fmt.Errorf("env %s: cluster %s must set exactly one of server, context and contextPattern", name, c.Name)
+			}
+			member := ClusterEnvName(name, c.Name)
+			if _, ok := a.Spec.Environments[member]; ok {
+				return fmt.Errorf("env %s: environment %s of cluster %s has the same name as an existing environment", name, member, c.Name)
+			}
+			props := map[string]string{}
+			for k, v := range env.Properties {
+				props[k] = v
+			}
+			for k, v := range c.Properties {
+				props[k] = v
+			}
+			e := env
+			e.Parent = ""
+			e.Server, e.Context, e.ContextPattern = c.Server, c.Context, c.ContextPattern
+			e.Properties = props
+			e.Clusters = nil
+			a.Spec.Environments[member] = e
+			if a.clusters == nil {
+				a.clusters = map[string]*Cluster{}
+			}
+			a.clusters[member] = &Cluster{Env: member, Base: name, Name: c.Name, Properties: props}
+		}
+	}
+	return nil
+}
+
+// Cluster returns the cluster for the supplied environment or nil if it is not the environment of a cluster.
+func (a *App) Cluster(env string) *Cluster {
+	return a.clusters[env]
+}
+
+// ClusterEnvironments returns the environments of the clusters of the supplied environment, in the order in which
+// the clusters are listed, or nil if the environment is not deployed to multiple clusters.
+func (a *App) ClusterEnvironments(env string) []string {
+	var ret []string
+	for _, c := range a.Spec.Environments[env].Clusters {
+		ret = append(ret, ClusterEnvName(env, c.Name))
+	}
+	return ret
+}
@@ -0,0 +1,186 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+	"github.com/pkg/errors"
+)
+
+// componentDescriptorSuffix is the suffix of descriptor files in the components directory, which are named after
+// the component that they describe.
+const componentDescriptorSuffix = ".component.yaml"
+
+// SunsetLayout is the layout of the sunset dates of deprecated components.
+const SunsetLayout = "2006-01-02"
+
+// isComponentDescriptor returns true if the supplied file is a component descriptor rather than a component.
+func isComponentDescriptor(file string) bool {
+	return strings.HasSuffix(file, componentDescriptorSuffix)
+}
+
+// loadComponentDescriptors sets the descriptors of the supplied components, keyed by name, from the supplied descriptor
+// files in the components directory.
+func (a *App) loadComponentDescriptors(components map[string]Component, dir string, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	v, err := newValidator()
+	if err != nil {
+		return errors.Wrap(err, "create schema validator")
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, componentDescriptorSuffix))
+		c, ok := components[name]
+		if !ok {
+			return fmt.Errorf("component descriptor %s: no component named %s", file, name)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if errs := v.validateYAMLOfKind(b, "ComponentDescriptor"); len(errs) > 0 {
+			var msgs []string
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+			}
+			return fmt.Errorf("component descriptor %s: %d schema validation error(s): %s", file, len(errs), strings.Join(msgs, "\n"))
+		}
+		var d QbecComponentDescriptor
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return errors.Wrapf(err, "component descriptor %s: unmarshal YAML", file)
+		}
+		if dep := d.Spec.Deprecated; dep != nil && dep.Sunset != "" {
+			if _, err := time.Parse(SunsetLayout, dep.Sunset); err != nil {
+				return fmt.Errorf("component descriptor %s: invalid sunset date %s", file, dep.Sunset)
+			}
+		}
+		if d.Spec.ParamSchema != nil {
+			if _, err := newPropertySchema(d.Spec.ParamSchema); err != nil {
+				return fmt.Errorf("component descriptor %s: param schema: %v", file, err)
+			}
+		}
+		c.Descriptor = &d.Spec
+		c.DescriptorFile = file
+		components[name] = c
+	}
+	return nil
+}
+
+// ComponentsWithTags returns the sorted names of components whose descriptors have any of the supplied tags.
+func (a *App) ComponentsWithTags(tags []string) []string {
+	want := map[string]bool{}
+	for _, t := range tags {
+		want[t] = true
+	}
+	var ret []string
+	for name, c := range a.allComponents {
+		if c.Descriptor == nil {
+			continue
+		}
+		for _, t := range c.Descriptor.Tags {
+			if want[t] {
+				ret = append(ret, name)
+				break
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// editDistance returns the number of single character edits needed to turn one string into the other.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = cur[j-1] + 1
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// ValidateComponentParams returns the problems of the supplied params of a component with respect to the param schema
+// of its descriptor, sorted. Params that the schema does not declare are unknown unless it sets additionalProperties,
+// and are reported with the closest declared name when it looks like a typo.
+func (a *App) ValidateComponentParams(component string, params interface{}) ([]string, error) {
+	c, ok := a.Component(component)
+	if !ok || c.Descriptor == nil || c.Descriptor.ParamSchema == nil {
+		return nil, nil
+	}
+	s, err := newPropertySchema(c.Descriptor.ParamSchema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "component %s: param schema", component)
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	var msgs []string
+	if values, ok := params.(map[string]interface{}); ok && s.AdditionalProperties == nil && len(s.Properties) > 0 {
+		for name := range values {
+			if _, ok := s.Properties[name]; ok {
+				continue
+			}
+			msg := fmt.Sprintf("component %s: unknown param %s", component, name)
+			best, bestDistance := "", 3
+			for declared := range s.Properties {
+				if d := editDistance(name, declared); d < bestDistance || (d == bestDistance && declared < best) {
+					best, bestDistance = declared, d
+				}
+			}
+			if best != "" {
+				msg += ", did you mean " + best + "?"
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	res := validate.NewSchemaValidator(s, nil, "params", strfmt.Default).Validate(params)
+	for _, err := range res.Errors {
+		msgs = append(msgs, fmt.Sprintf("component %s: %v", component, err))
+	}
+	sort.Strings(msgs)
+	return msgs, nil
+}
@@ -0,0 +1,215 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDescriptorsApp returns a new app with components a, b and c and the supplied component descriptors keyed by
+// file name, changing to its directory, along with a function to change back and remove it.
+func newDescriptorsApp(t *testing.T, descriptors map[string]string) func() {
+	dir, err := ioutil.TempDir("", "descriptors")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	for _, name := range []string{"a", "b", "c"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", name+".yaml"), []byte("{}"), 0644))
+	}
+	for file, contents := range descriptors {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", file), []byte(contents), 0644))
+	}
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+  components:
+    b:
+      dependsOn: [c]
+`
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestComponentDescriptors(t *testing.T) {
+	reset := newDescriptorsApp(t, map[string]string{
+		"a.component.yaml": `apiVersion: qbec.io/v1alpha1
+kind: ComponentDescriptor
+spec:
+  description: the a component
+  owners: [team-a]
+  dependsOn: [b, c]
+  namespace: web
+  requiredParams: [replicas]
+  tags: [frontend, web]
+`,
+		"b.component.yaml": `apiVersion: qbec.io/v1alpha1
+kind: ComponentDescriptor
+spec:
+  dependsOn: [c]
+  tags: [web]
+`,
+	})
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	comps, err := app.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	a.Equal(3, len(comps))
+
+	c, _ := app.Component("a")
+	require.NotNil(t, c.Descriptor)
+	a.Equal(ComponentDescriptorSpec{
+		Description:    "the a component",
+		Owners:         []string{"team-a"},
+		DependsOn:      []string{"b", "c"},
+		Namespace:      "web",
+		RequiredParams: []string{"replicas"},
+		Tags:           []string{"frontend", "web"},
+	}, *c.Descriptor)
+	c, _ = app.Component("c")
+	a.Nil(c.Descriptor)
+
+	a.Equal(map[string][]string{"a": {"b", "c"}, "b": {"c"}}, app.ComponentDependencies())
+	a.Equal([]string{"a", "b"}, app.ComponentsWithTags([]string{"web"}))
+	a.Equal([]string{"a"}, app.ComponentsWithTags([]string{"frontend", "backend"}))
+	a.Nil(app.ComponentsWithTags([]string{"backend"}))
+}
+
+func TestComponentParamSchema(t *testing.T) {
+	reset := newDescriptorsApp(t, map[string]string{
+		"a.component.yaml": `apiVersion: qbec.io/v1alpha1
+kind: ComponentDescriptor
+spec:
+  paramSchema:
+    properties:
+      image: {type: string}
+      replicas: {type: integer}
+      tier: {enum: [web, batch]}
+    required: [image]
+`,
+		"b.component.yaml": `apiVersion: qbec.io/v1alpha1
+kind: ComponentDescriptor
+spec:
+  paramSchema:
+    properties:
+      image: {type: string}
+    additionalProperties: true
+`,
+	})
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+
+	msgs, err := app.ValidateComponentParams("a", map[string]interface{}{"image": "nginx", "replicas": float64(2), "tier": "web"})
+	require.Nil(t, err)
+	a.Nil(msgs)
+	msgs, err = app.ValidateComponentParams("a", map[string]interface{}{"imag": "nginx", "replicas": "2", "tier": "db", "zone": "us"})
+	require.Nil(t, err)
+	a.Equal([]string{
+		"component a: params.image in body is required",
+		"component a: params.replicas in body must be of type integer: \"string\"",
+		"component a: params.tier in body should be one of [web batch]",
+		"component a: unknown param imag, did you mean image?",
+		"component a: unknown param zone",
+	}, msgs)
+	msgs, err = app.ValidateComponentParams("a", nil)
+	require.Nil(t, err)
+	a.Equal([]string{"component a: params.image in body is required"}, msgs)
+	msgs, err = app.ValidateComponentParams("b", map[string]interface{}{"zone": "us"})
+	require.Nil(t, err)
+	a.Nil(msgs)
+	msgs, err = app.ValidateComponentParams("c", map[string]interface{}{"zone": "us"})
+	require.Nil(t, err)
+	a.Nil(msgs)
+}
+
+func TestComponentDescriptorsNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		errorMsg string
+	}{
+		{
+			name:     "no component",
+			file:     "d.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec: {}\n",
+			errorMsg: "component descriptor components/d.component.yaml: no component named d",
+		},
+		{
+			name:     "bad schema",
+			file:     "a.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  owners: team-a\n",
+			errorMsg: "component descriptor components/a.component.yaml: 1 schema validation error(s)",
+		},
+		{
+			name:     "bad dependency",
+			file:     "a.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  dependsOn: [d]\n",
+			errorMsg: "component a dependencies",
+		},
+		{
+			name:     "cycle",
+			file:     "c.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  dependsOn: [b]\n",
+			errorMsg: "component dependency cycle: b -> c -> b",
+		},
+		{
+			name:     "bad sunset",
+			file:     "a.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  deprecated:\n    message: use b\n    sunset: 2024-02-30\n",
+			errorMsg: "component descriptor components/a.component.yaml: invalid sunset date 2024-02-30",
+		},
+		{
+			name:     "bad param schema",
+			file:     "a.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  paramSchema:\n    type: string\n",
+			errorMsg: "component descriptor components/a.component.yaml: param schema: must be the schema of an object, found type string",
+		},
+		{
+			name:     "no message",
+			file:     "a.component.yaml",
+			contents: "apiVersion: qbec.io/v1alpha1\nkind: ComponentDescriptor\nspec:\n  deprecated:\n    sunset: 2024-02-01\n",
+			errorMsg: "spec.deprecated.message in body is required",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reset := newDescriptorsApp(t, map[string]string{test.file: test.contents})
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
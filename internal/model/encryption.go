@@ -0,0 +1,164 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// encrypted values of properties have the form ENC[<provider>:<base64 ciphertext>]
+const (
+	encryptedPrefix = "ENC["
+	encryptedSuffix = "]"
+)
+
+// decryptedValues caches decrypted property values keyed by their encrypted form, such that every value is decrypted
+// at most once even when environments are evaluated in parallel.
+type decryptedValues struct {
+	l      sync.Mutex
+	values map[string]string
+}
+
+// get returns the decrypted form of the supplied value, decrypting it using the supplied function when it is not cached.
+// Values are not cached when the receiver is nil.
+func (d *decryptedValues) get(value string, decrypt func() (string, error)) (string, error) {
+	if d == nil {
+		return decrypt()
+	}
+	d.l.Lock()
+	defer d.l.Unlock()
+	if plain, ok := d.values[value]; ok {
+		return plain, nil
+	}
+	plain, err := decrypt()
+	if err != nil {
+		return "", err
+	}
+	d.values[value] = plain
+	return plain, nil
+}
+
+// parseEncrypted returns the key provider and ciphertext of the supplied property value. The third return value is
+// false if the value is not encrypted.
+func parseEncrypted(value string) (string, []byte, bool, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) || !strings.HasSuffix(value, encryptedSuffix) {
+		return "", nil, false, nil
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix)
+	pos := strings.Index(inner, ":")
+	if pos <= 0 {
+		return "", nil, true, fmt.Errorf("encrypted value must have the form ENC[<provider>:<base64 ciphertext>]")
+	}
+	b, err := base64.StdEncoding.DecodeString(inner[pos+1:])
+	if err != nil {
+		return "", nil, true, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	return inner[:pos], b, true, nil
+}
+
+// verifyEncryptedProperties returns errors for key providers that are defined more than once and for encrypted
+// property values that are malformed or use undefined key providers.
+func (a *App) verifyEncryptedProperties() []string {
+	var errs []string
+	providers := map[string]bool{}
+	for _, p := range a.Spec.KeyProviders {
+		if providers[p.Name] {
+			errs = append(errs, fmt.Sprintf("key provider %s: duplicate definition", p.Name))
+		}
+		providers[p.Name] = true
+	}
+	var envs []string
+	for name := range a.Spec.Environments {
+		envs = append(envs, name)
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		props := a.Spec.Environments[env].Properties
+		var names []string
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			provider, _, ok, err := parseEncrypted(props[name])
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Sprintf("env %s: property %s: %v", env, name, err))
+			case ok && !providers[provider]:
+				errs = append(errs, fmt.Sprintf("env %s: property %s uses undefined key provider %s", env, name, provider))
+			}
+		}
+	}
+	return errs
+}
+
+// decrypt decrypts the supplied ciphertext by running the command of the named key provider.
+func (a *App) decrypt(provider string, ciphertext []byte) (string, error) {
+	var kp *KeyProvider
+	for i := range a.Spec.KeyProviders {
+		if a.Spec.KeyProviders[i].Name == provider {
+			kp = &a.Spec.KeyProviders[i]
+		}
+	}
+	if kp == nil {
+		return "", fmt.Errorf("undefined key provider %s", provider)
+	}
+	var args []string
+	for _, arg := range kp.Command {
+		args = append(args, os.ExpandEnv(arg))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = a.root
+	cmd.Stdin = bytes.NewReader(ciphertext)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("key provider %s: %v\n%s", provider, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// DecryptProperties returns a copy of the supplied properties of an environment with encrypted values replaced by
+// their decrypted values. Values are decrypted by the key providers of the app and any trailing newline written by
+// the provider is removed.
+func (a *App) DecryptProperties(env string, props map[string]string) (map[string]string, error) {
+	ret := map[string]string{}
+	for name, value := range props {
+		ret[name] = value
+		provider, ciphertext, ok, err := parseEncrypted(value)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: property %s: %v", env, name, err)
+		}
+		if !ok {
+			continue
+		}
+		plain, err := a.decrypted.get(value, func() (string, error) { return a.decrypt(provider, ciphertext) })
+		if err != nil {
+			return nil, fmt.Errorf("env %s: decrypt property %s: %v", env, name, err)
+		}
+		ret[name] = plain
+	}
+	return ret, nil
+}
@@ -0,0 +1,374 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/sio"
+)
+
+// envFileCacheDir is the directory, relative to the app root, where downloaded environment files and fetched git
+// repositories are cached.
+const envFileCacheDir = ".qbec/environments"
+
+// envFileClient is the HTTP client used to download environment files.
+var envFileClient = &http.Client{Timeout: 30 * time.Second}
+
+// envFileSource is the content of an environment file with a description of where it came from.
+type envFileSource struct {
+	name    string
+	content []byte
+}
+
+// String returns a description of the supplied environment file for messages.
+func (f EnvironmentFile) String() string {
+	switch {
+	case f.URL != "":
+		return f.URL
+	case f.Git != "":
+		ref := f.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		return fmt.Sprintf("%s//%s@%s", f.Git, f.Path, ref)
+	default:
+		return f.Path
+	}
+}
+
+// verify returns an error if the supplied environment file does not have a valid combination of attributes.
+func (f EnvironmentFile) verify() error {
+	switch {
+	case f.URL != "":
+		if f.Path != "" || f.Git != "" || f.Ref != "" {
+			return fmt.Errorf("environment file %s: url cannot be used with path, git or ref", f)
+		}
+		if !strings.HasPrefix(f.URL, "https://") {
+			return fmt.Errorf("environment file %s: url must use https", f)
+		}
+	case f.Git != "":
+		if f.Path == "" {
+			return fmt.Errorf("environment file %s: git requires a path", f)
+		}
+		if f.SHA256 != "" && strings.ContainsAny(f.Path, "*?[") {
+			return fmt.Errorf("environment file %s: sha256 cannot be used with a path pattern", f)
+		}
+	case f.Path != "":
+		if f.Ref != "" || f.TokenEnv != "" || f.SHA256 != "" {
+			return fmt.Errorf("environment file %s: ref, tokenEnv and sha256 can only be used with a url or git", f)
+		}
+	default:
+		return fmt.Errorf("environment file must have one of path, url or git")
+	}
+	return nil
+}
+
+// token returns the bearer token for the supplied environment file, if any.
+func (f EnvironmentFile) token() (string, error) {
+	if f.TokenEnv == "" {
+		return "", nil
+	}
+	t := os.Getenv(f.TokenEnv)
+	if t == "" {
+		return "", fmt.Errorf("environment file %s: environment variable %s for the token is not set", f, f.TokenEnv)
+	}
+	return t, nil
+}
+
+// checkSum returns an error if the supplied file has a checksum that the supplied content does not match.
+func (f EnvironmentFile) checkSum(content []byte) error {
+	if f.SHA256 == "" {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	if actual := hex.EncodeToString(sum[:]); actual != f.SHA256 {
+		return fmt.Errorf("environment file %s: checksum mismatch, want sha256 %s, got %s", f, f.SHA256, actual)
+	}
+	return nil
+}
+
+// cacheKey returns a file name for the supplied source string in the cache.
+func cacheKey(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// localEnvFiles returns the local files that match the path pattern of the supplied file, in sorted order.
+func (a *App) localEnvFiles(f EnvironmentFile) ([]envFileSource, error) {
+	matches, err := filepath.Glob(filepath.Join(a.root, f.Path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "environment file %s", f)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("environment file %s: no files match the path", f)
+	}
+	sort.Strings(matches)
+	var ret []envFileSource
+	for _, m := range matches {
+		b, err := ioutil.ReadFile(m)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(a.root, m)
+		if err != nil {
+			rel = m
+		}
+		ret = append(ret, envFileSource{name: rel, content: b})
+	}
+	return ret, nil
+}
+
+// downloadEnvFile returns the contents of the URL of the supplied file. A cached copy that matches the checksum of
+// the file is used without downloading it again. A cached copy of a file without a checksum is only used, with a
+// warning, when the download fails.
+func (a *App) downloadEnvFile(f EnvironmentFile) ([]envFileSource, error) {
+	cacheFile := filepath.Join(a.root, envFileCacheDir, "url", cacheKey(f.URL)+".yaml")
+	cached, cacheErr := ioutil.ReadFile(cacheFile)
+	if cacheErr == nil && f.SHA256 != "" && f.checkSum(cached) == nil {
+		return []envFileSource{{name: f.URL, content: cached}}, nil
+	}
+	token, err := f.token()
+	if err != nil {
+		return nil, err
+	}
+	b, err := func() ([]byte, error) {
+		req, err := http.NewRequest(http.MethodGet, f.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := envFileClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s", res.Status)
+		}
+		return ioutil.ReadAll(res.Body)
+	}()
+	if err != nil {
+		if cacheErr == nil && f.SHA256 == "" {
+			sio.Warnf("environment file %s: download failed, using cached copy: %v\n", f, err)
+			return []envFileSource{{name: f.URL, content: cached}}, nil
+		}
+		return nil, errors.Wrapf(err, "environment file %s: download", f)
+	}
+	if err := f.checkSum(b); err != nil {
+		return nil, err
+	}
+	if err := writeCacheFile(cacheFile, b); err != nil {
+		return nil, errors.Wrapf(err, "environment file %s: cache", f)
+	}
+	return []envFileSource{{name: f.URL, content: b}}, nil
+}
+
+// writeCacheFile writes the supplied content to the supplied file through a temporary file, such that concurrent
+// runs never see partial contents.
+func writeCacheFile(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// runGitCommand runs git with the supplied arguments and returns its standard output.
+func runGitCommand(args ...string) (string, error) {
+	return runGit(nil, args...)
+}
+
+// runGit runs git with the supplied arguments and additional environment variables and returns its standard output.
+// Errors only name the git subcommand, since the arguments may contain secrets.
+func runGit(env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v\n%s", gitSubcommand(args), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// gitSubcommand returns the subcommand in the supplied git arguments, skipping the global options before it.
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-C" || args[i] == "-c":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		}
+	}
+	return "command"
+}
+
+// gitTokenEnv returns the environment variables that make git send the supplied bearer token with its HTTP
+// requests. The token is passed through the environment rather than the command line such that it does not show
+// up in process listings.
+func gitTokenEnv(token string) []string {
+	if token == "" {
+		return nil
+	}
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Bearer " + token,
+	}
+}
+
+// reCommit matches full git commit hashes.
+var reCommit = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// gitHasCommit returns true if the supplied git repository has the supplied commit.
+func gitHasCommit(dir, commit string) bool {
+	_, err := runGitCommand("-C", dir, "cat-file", "-e", commit+"^{commit}")
+	return err == nil
+}
+
+// gitEnvFiles returns the files that match the path pattern of the supplied file in its git repository. The
+// repository is fetched into a bare repository in the cache, and a ref that is a commit already in the cache is
+// used without fetching.
+func (a *App) gitEnvFiles(f EnvironmentFile) ([]envFileSource, error) {
+	dir := filepath.Join(a.root, envFileCacheDir, "git", cacheKey(f.Git))
+	if _, err := os.Stat(dir); err != nil {
+		if _, err := runGitCommand("init", "--quiet", "--bare", dir); err != nil {
+			return nil, errors.Wrapf(err, "environment file %s", f)
+		}
+	}
+	ref := f.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	rev := ref
+	if !reCommit.MatchString(ref) || !gitHasCommit(dir, ref) {
+		token, err := f.token()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := runGit(gitTokenEnv(token), "-C", dir, "fetch", "--quiet", "--depth", "1", f.Git, ref); err != nil {
+			return nil, errors.Wrapf(err, "environment file %s: fetch", f)
+		}
+		rev = "FETCH_HEAD"
+	}
+	out, err := runGitCommand("-C", dir, "ls-tree", "-r", "--name-only", rev)
+	if err != nil {
+		return nil, errors.Wrapf(err, "environment file %s", f)
+	}
+	var ret []envFileSource
+	for _, name := range strings.Split(strings.TrimSpace(out), "\n") {
+		if ok, _ := path.Match(f.Path, name); !ok {
+			continue
+		}
+		content, err := runGitCommand("-C", dir, "show", rev+":"+name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "environment file %s", f)
+		}
+		if err := f.checkSum([]byte(content)); err != nil {
+			return nil, err
+		}
+		ret = append(ret, envFileSource{name: fmt.Sprintf("%s//%s@%s", f.Git, name, ref), content: []byte(content)})
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("environment file %s: no files match the path", f)
+	}
+	return ret, nil
+}
+
+// loadEnvironmentFiles adds the environments defined by the environment files of the app to its environments. An
+// environment may only be defined once across qbec.yaml and all environment files.
+func (a *App) loadEnvironmentFiles() error {
+	if len(a.Spec.EnvironmentFiles) == 0 {
+		return nil
+	}
+	v, err := newValidator()
+	if err != nil {
+		return errors.Wrap(err, "create schema validator")
+	}
+	definedBy := map[string]string{}
+	for name := range a.Spec.Environments {
+		definedBy[name] = "qbec.yaml"
+	}
+	for _, f := range a.Spec.EnvironmentFiles {
+		if err := f.verify(); err != nil {
+			return err
+		}
+		var sources []envFileSource
+		switch {
+		case f.URL != "":
+			sources, err = a.downloadEnvFile(f)
+		case f.Git != "":
+			sources, err = a.gitEnvFiles(f)
+		default:
+			sources, err = a.localEnvFiles(f)
+		}
+		if err != nil {
+			return err
+		}
+		for _, src := range sources {
+			if errs := v.validateYAMLOfKind(src.content, "EnvironmentMap"); len(errs) > 0 {
+				var msgs []string
+				for _, err := range errs {
+					msgs = append(msgs, err.Error())
+				}
+				return fmt.Errorf("environment file %s: %d schema validation error(s): %s", src.name, len(errs), strings.Join(msgs, "\n"))
+			}
+			var m QbecEnvironmentMap
+			if err := yaml.Unmarshal(src.content, &m); err != nil {
+				return errors.Wrapf(err, "environment file %s: unmarshal YAML", src.name)
+			}
+			var names []string
+			for name := range m.Spec.Environments {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if prev, ok := definedBy[name]; ok {
+					return fmt.Errorf("environment %s from %s is already defined in %s", name, src.name, prev)
+				}
+				definedBy[name] = src.name
+				a.Spec.Environments[name] = m.Spec.Environments[name]
+			}
+		}
+	}
+	return nil
+}
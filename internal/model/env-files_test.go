@@ -0,0 +1,276 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/splunk/qbec/internal/sio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testEnvMap = `apiVersion: qbec.io/v1alpha1
+kind: EnvironmentMap
+spec:
+  environments:
+    %s:
+      server: https://%s-server
+`
+
+// newEnvFilesApp returns the directory of a new app with one component, a dev environment and the supplied
+// environment files section, changing to its directory, along with a function to change back and remove it.
+func newEnvFilesApp(t *testing.T, envFiles string) (string, func()) {
+	dir, err := ioutil.TempDir("", "env-files")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", "a.yaml"), []byte("{}"), 0644))
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+  environmentFiles:
+` + envFiles
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return dir, func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func sha256Of(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestEnvFilesLocal(t *testing.T) {
+	dir, reset := newEnvFilesApp(t, "  - path: envs/*.yaml\n")
+	defer reset()
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "envs"), 0755))
+	for _, e := range []string{"prod", "stage"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "envs", e+".yaml"), []byte(fmt.Sprintf(testEnvMap, e, e)), 0644))
+	}
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(3, len(app.Spec.Environments))
+	a.Equal("https://prod-server", app.Spec.Environments["prod"].Server)
+	a.Equal("https://stage-server", app.Spec.Environments["stage"].Server)
+}
+
+func TestEnvFilesURL(t *testing.T) {
+	content := fmt.Sprintf(testEnvMap, "prod", "prod")
+	var auth string
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, content)
+	}))
+	defer ts.Close()
+	c := envFileClient
+	defer func() { envFileClient = c }()
+	envFileClient = ts.Client()
+	require.Nil(t, os.Setenv("QBEC_TEST_ENV_TOKEN", "s3cr3t"))
+	defer os.Unsetenv("QBEC_TEST_ENV_TOKEN")
+
+	_, reset := newEnvFilesApp(t, fmt.Sprintf("  - url: %s/envs.yaml\n    tokenEnv: QBEC_TEST_ENV_TOKEN\n    sha256: %s\n", ts.URL, sha256Of(content)))
+	defer reset()
+	a := assert.New(t)
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal("https://prod-server", app.Spec.Environments["prod"].Server)
+	a.Equal("Bearer s3cr3t", auth)
+	a.Equal(1, requests)
+
+	// the pinned file is used from the cache
+	_, err = NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(1, requests)
+}
+
+func TestEnvFilesURLCacheFallback(t *testing.T) {
+	o := sio.Output
+	defer func() { sio.Output = o }()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, testEnvMap, "prod", "prod")
+	}))
+	c := envFileClient
+	defer func() { envFileClient = c }()
+	envFileClient = ts.Client()
+	_, reset := newEnvFilesApp(t, fmt.Sprintf("  - url: %s/envs.yaml\n", ts.URL))
+	defer reset()
+	_, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	ts.Close()
+
+	buf := bytes.NewBuffer(nil)
+	sio.Output = buf
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, "https://prod-server", app.Spec.Environments["prod"].Server)
+	assert.Contains(t, buf.String(), "download failed, using cached copy")
+}
+
+func TestEnvFilesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo, err := ioutil.TempDir("", "env-repo")
+	require.Nil(t, err)
+	defer os.RemoveAll(repo)
+	git := func(args ...string) string {
+		out, err := runGitCommand(append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.Nil(t, err)
+		return strings.TrimSpace(out)
+	}
+	git("init", "--quiet")
+	require.Nil(t, os.MkdirAll(filepath.Join(repo, "fleet"), 0755))
+	for _, e := range []string{"prod", "stage"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(repo, "fleet", e+".yaml"), []byte(fmt.Sprintf(testEnvMap, e, e)), 0644))
+	}
+	git("add", ".")
+	git("commit", "--quiet", "-m", "fleet")
+	commit := git("rev-parse", "HEAD")
+
+	_, reset := newEnvFilesApp(t, fmt.Sprintf("  - git: file://%s\n    ref: %s\n    path: fleet/*.yaml\n", repo, commit))
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(3, len(app.Spec.Environments))
+	a.Equal("https://stage-server", app.Spec.Environments["stage"].Server)
+
+	// the pinned commit is used from the cache
+	require.Nil(t, os.RemoveAll(repo))
+	_, err = NewApp("qbec.yaml")
+	require.Nil(t, err)
+}
+
+func TestGitTokenNotOnCommandLine(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	out, err := runGit(gitTokenEnv("s3cret"), "config", "--get", "http.extraHeader")
+	require.Nil(t, err)
+	assert.Equal(t, "Authorization: Bearer s3cret", strings.TrimSpace(out))
+
+	_, err = runGitCommand("-C", "/does/not/exist", "-c", "http.extraHeader=s3cret", "fetch", "https://example.com/s3cret.git")
+	require.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "git fetch: "))
+	assert.NotContains(t, err.Error(), "s3cret")
+}
+
+func TestEnvFilesNegative(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, testEnvMap, "dev", "dev")
+	}))
+	defer ts.Close()
+	c := envFileClient
+	defer func() { envFileClient = c }()
+	envFileClient = ts.Client()
+
+	tests := []struct {
+		name     string
+		envFiles string
+		errorMsg string
+	}{
+		{
+			name:     "no source",
+			envFiles: "  - ref: v1\n",
+			errorMsg: "environment file must have one of path, url or git",
+		},
+		{
+			name:     "http",
+			envFiles: "  - url: http://example.com/envs.yaml\n",
+			errorMsg: "environment file http://example.com/envs.yaml: url must use https",
+		},
+		{
+			name:     "git without path",
+			envFiles: "  - git: https://example.com/fleet.git\n",
+			errorMsg: "environment file https://example.com/fleet.git//@HEAD: git requires a path",
+		},
+		{
+			name:     "local checksum",
+			envFiles: "  - path: envs/*.yaml\n    sha256: " + sha256Of("foo") + "\n",
+			errorMsg: "environment file envs/*.yaml: ref, tokenEnv and sha256 can only be used with a url or git",
+		},
+		{
+			name:     "no local files",
+			envFiles: "  - path: envs/*.yaml\n",
+			errorMsg: "environment file envs/*.yaml: no files match the path",
+		},
+		{
+			name:     "token not set",
+			envFiles: fmt.Sprintf("  - url: %s/envs.yaml\n    tokenEnv: QBEC_TEST_NO_TOKEN\n", ts.URL),
+			errorMsg: "environment variable QBEC_TEST_NO_TOKEN for the token is not set",
+		},
+		{
+			name:     "not found",
+			envFiles: fmt.Sprintf("  - url: %s/missing.yaml\n", ts.URL),
+			errorMsg: "download: 404 Not Found",
+		},
+		{
+			name:     "checksum",
+			envFiles: fmt.Sprintf("  - url: %s/envs.yaml\n    sha256: %s\n", ts.URL, sha256Of("foo")),
+			errorMsg: "checksum mismatch, want sha256 " + sha256Of("foo"),
+		},
+		{
+			name:     "duplicate",
+			envFiles: fmt.Sprintf("  - url: %s/envs.yaml\n", ts.URL),
+			errorMsg: fmt.Sprintf("environment dev from %s/envs.yaml is already defined in qbec.yaml", ts.URL),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, reset := newEnvFilesApp(t, test.envFiles)
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
+
+func TestEnvFilesBadSchema(t *testing.T) {
+	dir, reset := newEnvFilesApp(t, "  - path: envs.yaml\n")
+	defer reset()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "envs.yaml"), []byte("apiVersion: qbec.io/v1alpha1\nkind: App\nspec: {}\n"), 0644))
+	_, err := NewApp("qbec.yaml")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "environment file envs.yaml: 1 schema validation error(s): bad kind property, expected EnvironmentMap")
+}
@@ -20,17 +20,43 @@ const qbecLeading = "qbec.io"
 
 // QbecNames is the set of names used by Qbec.
 var QbecNames = struct {
-	ApplicationLabel    string // the label to use for tagging an object with an application name
-	ComponentAnnotation string // the label to use for tagging an object with a component
-	EnvironmentLabel    string // the label to use for tagging an object with an annotation
-	PristineAnnotation  string // the annotation to use for storing the pristine object
-	ParamsCodeVarName   string // the name of the code variable that stores env params
-	EnvVarName          string // the name of the external variable that has the environment name
+	ApplicationLabel             string // the label to use for tagging an object with an application name
+	ComponentAnnotation          string // the label to use for tagging an object with a component
+	EnvironmentLabel             string // the label to use for tagging an object with an annotation
+	PristineAnnotation           string // the annotation to use for storing the pristine object
+	RenderHashAnnotation         string // the annotation to use for storing a hash of the rendered object
+	ProtectedAnnotation          string // the annotation that protects an object from deletion when set to "true"
+	CreateOnlyAnnotation         string // the annotation that prevents updates to an existing object when set to "true"
+	SourceFileAnnotation         string // the annotation that records the component file from which an object was generated
+	GitCommitAnnotation          string // the annotation that records the git commit from which an object was generated
+	DependsOnAnnotation          string // the annotation that lists other objects that an object depends on
+	ComponentDependsOnAnnotation string // the annotation that lists other components that the component of an object depends on
+	RunURLAnnotation             string // the annotation that records the URL of the CI run that last changed an object
+	PipelineIDAnnotation         string // the annotation that records the id of the pipeline that last changed an object
+	PlanHashAnnotation           string // the annotation that records the hash of the plan that last changed an object
+	AllowedSecretKeysAnnotation  string // the annotation that lists keys of a secret that are not linted, or "*" for all
+	ParamsCodeVarName            string // the name of the code variable that stores env params
+	EnvVarName                   string // the name of the external variable that has the environment name
+	PreviewVarName               string // the name of the code variable that has preview environment details, null otherwise
+	ClusterVarName               string // the name of the code variable that has details of the cluster of a multi-cluster environment, null otherwise
 }{
-	ApplicationLabel:    qbecLeading + "/application",
-	ComponentAnnotation: qbecLeading + "/component",
-	EnvironmentLabel:    qbecLeading + "/environment",
-	PristineAnnotation:  qbecLeading + "/last-applied",
-	ParamsCodeVarName:   qbecLeading + "/params",
-	EnvVarName:          qbecLeading + "/env",
+	ApplicationLabel:             qbecLeading + "/application",
+	ComponentAnnotation:          qbecLeading + "/component",
+	EnvironmentLabel:             qbecLeading + "/environment",
+	PristineAnnotation:           qbecLeading + "/last-applied",
+	RenderHashAnnotation:         qbecLeading + "/render-hash",
+	ProtectedAnnotation:          qbecLeading + "/protected",
+	CreateOnlyAnnotation:         qbecLeading + "/create-only",
+	SourceFileAnnotation:         qbecLeading + "/source-file",
+	GitCommitAnnotation:          qbecLeading + "/git-commit",
+	DependsOnAnnotation:          qbecLeading + "/depends-on",
+	ComponentDependsOnAnnotation: qbecLeading + "/component-depends-on",
+	RunURLAnnotation:             qbecLeading + "/run-url",
+	PipelineIDAnnotation:         qbecLeading + "/pipeline-id",
+	PlanHashAnnotation:           qbecLeading + "/plan-hash",
+	AllowedSecretKeysAnnotation:  qbecLeading + "/allowed-secret-keys",
+	ParamsCodeVarName:            qbecLeading + "/params",
+	EnvVarName:                   qbecLeading + "/env",
+	PreviewVarName:               qbecLeading + "/preview",
+	ClusterVarName:               qbecLeading + "/cluster",
 }
@@ -107,3 +107,37 @@ func NewKindFilter(includes, excludes []string) (Filter, error) {
 	}
 	return bf, nil
 }
+
+type andFilter struct {
+	filters []Filter
+}
+
+func (a *andFilter) HasFilters() bool {
+	for _, f := range a.filters {
+		if f.HasFilters() {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *andFilter) ShouldInclude(s string) bool {
+	for _, f := range a.filters {
+		if !f.ShouldInclude(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewAndFilter returns a filter that includes an input only if all the supplied filters include it.
+// Nil filters are ignored.
+func NewAndFilter(filters ...Filter) Filter {
+	var list []Filter
+	for _, f := range filters {
+		if f != nil {
+			list = append(list, f)
+		}
+	}
+	return &andFilter{filters: list}
+}
@@ -119,3 +119,22 @@ func TestKindFilterBad(t *testing.T) {
 	require.NotNil(t, err)
 	require.Equal(t, "cannot include as well as exclude kinds, specify one or the other", err.Error())
 }
+
+func TestAndFilter(t *testing.T) {
+	kinds, err := NewKindFilter(nil, []string{"secret"})
+	require.Nil(t, err)
+	gcKinds, err := NewKindFilter([]string{"configmap", "secret"}, nil)
+	require.Nil(t, err)
+	filter := NewAndFilter(kinds, nil, gcKinds)
+	a := assert.New(t)
+	a.True(filter.HasFilters())
+	a.True(filter.ShouldInclude("ConfigMap"))
+	a.False(filter.ShouldInclude("Secret"))
+	a.False(filter.ShouldInclude("Deployment"))
+
+	open, err := NewKindFilter(nil, nil)
+	require.Nil(t, err)
+	filter = NewAndFilter(open, nil)
+	a.False(filter.HasFilters())
+	a.True(filter.ShouldInclude("Deployment"))
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// reGeneratedName is the pattern that the names in the source of a generator must match.
+var reGeneratedName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// generatedNames returns the sorted names listed in the supplied source of a generator with the data of each name,
+// which is nil when the source is a list.
+func generatedNames(g Generator, source interface{}) ([]string, map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	switch v := source.(type) {
+	case []interface{}:
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("generator %s: source %s must be a list of names or an object keyed by name", g.Name, g.Source)
+			}
+			if _, ok := data[name]; ok {
+				return nil, nil, fmt.Errorf("generator %s: duplicate name %s in %s", g.Name, name, g.Source)
+			}
+			data[name] = nil
+		}
+	case map[string]interface{}:
+		data = v
+	default:
+		return nil, nil, fmt.Errorf("generator %s: source %s must be a list of names or an object keyed by name", g.Name, g.Source)
+	}
+	var names []string
+	for name := range data {
+		if !reGeneratedName.MatchString(name) {
+			return nil, nil, fmt.Errorf("generator %s: invalid component name %q in %s", g.Name, name, g.Source)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, data, nil
+}
+
+// loadGeneratedComponents returns a component for every name in the sources of the generators of the app, named
+// after the generator and the name, such as tenants/acme.
+func (a *App) loadGeneratedComponents() ([]Component, error) {
+	var ret []Component
+	seen := map[string]bool{}
+	for i := range a.Spec.Generators {
+		g := a.Spec.Generators[i]
+		if seen[g.Name] {
+			return nil, fmt.Errorf("duplicate generator %s", g.Name)
+		}
+		seen[g.Name] = true
+		if _, err := os.Stat(filepath.Join(a.root, g.File)); err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("generator %s: file %s does not exist", g.Name, g.File)
+			}
+			return nil, err
+		}
+		b, err := ioutil.ReadFile(filepath.Join(a.root, g.Source))
+		if err != nil {
+			return nil, errors.Wrapf(err, "generator %s", g.Name)
+		}
+		var source interface{}
+		if err := yaml.Unmarshal(b, &source); err != nil {
+			return nil, errors.Wrapf(err, "generator %s: unmarshal %s", g.Name, g.Source)
+		}
+		names, data, err := generatedNames(g, source)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			ret = append(ret, Component{
+				Name:          g.Name + "/" + name,
+				File:          g.File,
+				Generator:     &g,
+				GeneratorData: data[name],
+			})
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,157 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGeneratorsApp returns a new app with one component, a tenant generator with the supplied source and the
+// supplied spec attributes, changing to its directory, along with a function to change back and remove it.
+func newGeneratorsApp(t *testing.T, source string, spec string) func() {
+	dir, err := ioutil.TempDir("", "generators")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", "c.yaml"), []byte("{}"), 0644))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "generators"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "generators", "tenant.libsonnet"), []byte("function(name, data) {}"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "generators", "tenants.yaml"), []byte(source), 0644))
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+` + spec
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+const tenantsGenerator = `  generators:
+  - name: tenants
+    file: generators/tenant.libsonnet
+    source: generators/tenants.yaml
+`
+
+func TestGeneratedComponents(t *testing.T) {
+	reset := newGeneratorsApp(t, "acme:\n  replicas: 2\nglobex: {}\n", tenantsGenerator+"  excludes:\n  - tenants/globex\n")
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+
+	comps, err := app.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(comps))
+	a.Equal("c", comps[0].Name)
+	acme := comps[1]
+	a.Equal("tenants/acme", acme.Name)
+	a.Equal("generators/tenant.libsonnet", acme.File)
+	require.NotNil(t, acme.Generator)
+	a.Equal("tenants", acme.Generator.Name)
+	a.Equal(map[string]interface{}{"replicas": float64(2)}, acme.GeneratorData)
+
+	comps, err = app.ComponentsForEnvironment("dev", []string{"tenants"}, nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(comps))
+	a.Equal("tenants/acme", comps[0].Name)
+}
+
+func TestGeneratedComponentsList(t *testing.T) {
+	reset := newGeneratorsApp(t, "- acme\n- globex\n", tenantsGenerator)
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	comps, err := app.ComponentsForEnvironment(Baseline, []string{"tenants/globex"}, nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(comps))
+	assert.Equal(t, "tenants/globex", comps[0].Name)
+	assert.Nil(t, comps[0].GeneratorData)
+}
+
+func TestGeneratedComponentsNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		spec     string
+		errorMsg string
+	}{
+		{
+			name:     "bad source",
+			source:   "acme",
+			spec:     tenantsGenerator,
+			errorMsg: "generator tenants: source generators/tenants.yaml must be a list of names or an object keyed by name",
+		},
+		{
+			name:     "bad list",
+			source:   "- acme\n- 10\n",
+			spec:     tenantsGenerator,
+			errorMsg: "generator tenants: source generators/tenants.yaml must be a list of names or an object keyed by name",
+		},
+		{
+			name:     "duplicate name",
+			source:   "- acme\n- acme\n",
+			spec:     tenantsGenerator,
+			errorMsg: "generator tenants: duplicate name acme in generators/tenants.yaml",
+		},
+		{
+			name:     "invalid name",
+			source:   "- acme/corp\n",
+			spec:     tenantsGenerator,
+			errorMsg: `generator tenants: invalid component name "acme/corp" in generators/tenants.yaml`,
+		},
+		{
+			name:     "missing file",
+			source:   "- acme\n",
+			spec:     "  generators:\n  - name: tenants\n    file: generators/missing.libsonnet\n    source: generators/tenants.yaml\n",
+			errorMsg: "generator tenants: file generators/missing.libsonnet does not exist",
+		},
+		{
+			name:     "duplicate generator",
+			source:   "- acme\n",
+			spec:     tenantsGenerator + "  - name: tenants\n    file: generators/tenant.libsonnet\n    source: generators/tenants.yaml\n",
+			errorMsg: "duplicate generator tenants",
+		},
+		{
+			name:     "no source",
+			source:   "- acme\n",
+			spec:     "  generators:\n  - name: tenants\n    file: generators/tenant.libsonnet\n",
+			errorMsg: "spec.generators.source in body is required",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reset := newGeneratorsApp(t, test.source, test.spec)
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsLocal returns true if the supplied chart is a directory in the app.
+func (h HelmChart) IsLocal() bool {
+	return h.Repo == "" && !h.IsOCI()
+}
+
+// IsOCI returns true if the supplied chart is in an OCI registry.
+func (h HelmChart) IsOCI() bool {
+	return strings.HasPrefix(h.Chart, "oci://")
+}
+
+// String returns a description of the supplied chart for messages and listings.
+func (h HelmChart) String() string {
+	switch {
+	case h.IsLocal():
+		return h.Chart
+	case h.IsOCI():
+		return fmt.Sprintf("%s@%s", h.Chart, h.Version)
+	default:
+		return fmt.Sprintf("%s/%s@%s", strings.TrimSuffix(h.Repo, "/"), h.Chart, h.Version)
+	}
+}
+
+// verifyHelmChart returns an error if the supplied chart does not have a valid combination of attributes or is a local chart
+// that does not exist.
+func (a *App) verifyHelmChart(h HelmChart) error {
+	if h.IsLocal() {
+		if h.Version != "" {
+			return fmt.Errorf("helm chart %s: version can only be used with charts from repositories or OCI registries", h.Name)
+		}
+		if _, err := os.Stat(filepath.Join(a.root, h.Chart, "Chart.yaml")); err != nil {
+			return fmt.Errorf("helm chart %s: %s is not a chart directory", h.Name, h.Chart)
+		}
+		return nil
+	}
+	if h.Repo != "" && h.IsOCI() {
+		return fmt.Errorf("helm chart %s: repo cannot be used with an oci:// chart", h.Name)
+	}
+	if h.Version == "" {
+		return fmt.Errorf("helm chart %s: version is required for charts from repositories or OCI registries", h.Name)
+	}
+	return nil
+}
+
+// loadHelmCharts returns the helm charts of the app as components.
+func (a *App) loadHelmCharts() ([]Component, error) {
+	var ret []Component
+	for i := range a.Spec.HelmCharts {
+		h := a.Spec.HelmCharts[i]
+		if err := a.verifyHelmChart(h); err != nil {
+			return nil, err
+		}
+		if h.ReleaseName == "" {
+			h.ReleaseName = h.Name
+		}
+		ret = append(ret, Component{Name: h.Name, File: h.String(), Chart: &h})
+	}
+	return ret, nil
+}
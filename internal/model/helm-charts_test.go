@@ -0,0 +1,133 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHelmChartsApp returns a new app with one local component, a local chart, a dev environment and the supplied
+// helm charts section, changing to its directory, along with a function to change back and remove it.
+func newHelmChartsApp(t *testing.T, charts string) func() {
+	dir, err := ioutil.TempDir("", "helm-charts")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", "a.yaml"), []byte("{}"), 0644))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "charts", "nginx"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "charts", "nginx", "Chart.yaml"), []byte("name: nginx\n"), 0644))
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+  helmCharts:
+` + charts
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHelmCharts(t *testing.T) {
+	reset := newHelmChartsApp(t, `  - name: nginx
+    chart: charts/nginx
+  - name: redis
+    chart: redis
+    repo: https://charts.example.com/
+    version: 17.0.0
+    releaseName: cache
+  - name: agent
+    chart: oci://ghcr.io/example/charts/agent
+    version: 1.2.0
+`)
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	comps, err := app.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	a.Equal(4, len(comps))
+
+	c, ok := app.Component("nginx")
+	require.True(t, ok)
+	a.Equal("charts/nginx", c.File)
+	require.NotNil(t, c.Chart)
+	a.Equal("nginx", c.Chart.ReleaseName)
+	a.True(c.Chart.IsLocal())
+
+	c, _ = app.Component("redis")
+	a.Equal("https://charts.example.com/redis@17.0.0", c.File)
+	a.Equal("cache", c.Chart.ReleaseName)
+
+	c, _ = app.Component("agent")
+	a.Equal("oci://ghcr.io/example/charts/agent@1.2.0", c.File)
+	a.True(c.Chart.IsOCI())
+}
+
+func TestHelmChartsNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		charts   string
+		errorMsg string
+	}{
+		{
+			name:     "not a chart",
+			charts:   "  - name: nginx\n    chart: charts\n",
+			errorMsg: "helm chart nginx: charts is not a chart directory",
+		},
+		{
+			name:     "local version",
+			charts:   "  - name: nginx\n    chart: charts/nginx\n    version: 1.0.0\n",
+			errorMsg: "helm chart nginx: version can only be used with charts from repositories or OCI registries",
+		},
+		{
+			name:     "no version",
+			charts:   "  - name: redis\n    chart: redis\n    repo: https://charts.example.com\n",
+			errorMsg: "helm chart redis: version is required for charts from repositories or OCI registries",
+		},
+		{
+			name:     "oci repo",
+			charts:   "  - name: agent\n    chart: oci://ghcr.io/example/agent\n    repo: https://charts.example.com\n    version: 1.0.0\n",
+			errorMsg: "helm chart agent: repo cannot be used with an oci:// chart",
+		},
+		{
+			name:     "duplicate",
+			charts:   "  - name: a\n    chart: charts/nginx\n",
+			errorMsg: "duplicate component a, found components/a.yaml and charts/nginx",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reset := newHelmChartsApp(t, test.charts)
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
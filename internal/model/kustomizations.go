@@ -0,0 +1,67 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kustomizationFiles are the names of the files that make a directory a kustomization.
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// IsRemote returns true if the path of the supplied kustomization is a remote base.
+func (k Kustomization) IsRemote() bool {
+	return strings.Contains(k.Path, "://") || strings.HasPrefix(k.Path, "git@") || strings.HasPrefix(k.Path, "github.com/")
+}
+
+// verifyKustomization returns an error if the supplied kustomization is a local directory without a kustomization
+// file or a remote base that is not pinned to a ref.
+func (a *App) verifyKustomization(k Kustomization) error {
+	if k.IsRemote() {
+		var query url.Values
+		if i := strings.Index(k.Path, "?"); i >= 0 {
+			query, _ = url.ParseQuery(k.Path[i+1:])
+		}
+		if query.Get("ref") == "" {
+			return fmt.Errorf("kustomization %s: remote base %s must be pinned with a ref query parameter", k.Name, k.Path)
+		}
+		return nil
+	}
+	for _, f := range kustomizationFiles {
+		if _, err := os.Stat(filepath.Join(a.root, k.Path, f)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("kustomization %s: %s is not a kustomize directory", k.Name, k.Path)
+}
+
+// loadKustomizations returns the kustomizations of the app as components.
+func (a *App) loadKustomizations() ([]Component, error) {
+	var ret []Component
+	for i := range a.Spec.Kustomizations {
+		k := a.Spec.Kustomizations[i]
+		if err := a.verifyKustomization(k); err != nil {
+			return nil, err
+		}
+		ret = append(ret, Component{Name: k.Name, File: k.Path, Kustomization: &k})
+	}
+	return ret, nil
+}
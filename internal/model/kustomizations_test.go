@@ -0,0 +1,116 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newKustomizationsApp returns a new app with one local component, a kustomize directory, a dev environment and the
+// supplied kustomizations section, changing to its directory, along with a function to change back and remove it.
+func newKustomizationsApp(t *testing.T, kustomizations string) func() {
+	dir, err := ioutil.TempDir("", "kustomizations")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", "a.yaml"), []byte("{}"), 0644))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "kustomize", "base"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "kustomize", "base", "kustomization.yml"), []byte("resources: []\n"), 0644))
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+  kustomizations:
+` + kustomizations
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestKustomizations(t *testing.T) {
+	reset := newKustomizationsApp(t, `  - name: web
+    path: kustomize/base
+  - name: ingress
+    path: https://github.com/example/manifests//ingress?ref=v1.0.0
+  - name: agent
+    path: git@github.com:example/agent.git/deploy?ref=abc123
+`)
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	comps, err := app.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	a.Equal(4, len(comps))
+
+	c, ok := app.Component("web")
+	require.True(t, ok)
+	a.Equal("kustomize/base", c.File)
+	require.NotNil(t, c.Kustomization)
+	a.False(c.Kustomization.IsRemote())
+	a.Nil(c.Chart)
+
+	c, _ = app.Component("ingress")
+	a.True(c.Kustomization.IsRemote())
+	c, _ = app.Component("agent")
+	a.True(c.Kustomization.IsRemote())
+}
+
+func TestKustomizationsNegative(t *testing.T) {
+	tests := []struct {
+		name           string
+		kustomizations string
+		errorMsg       string
+	}{
+		{
+			name:           "not a kustomization",
+			kustomizations: "  - name: web\n    path: kustomize\n",
+			errorMsg:       "kustomization web: kustomize is not a kustomize directory",
+		},
+		{
+			name:           "unpinned",
+			kustomizations: "  - name: ingress\n    path: https://github.com/example/manifests//ingress\n",
+			errorMsg:       "kustomization ingress: remote base https://github.com/example/manifests//ingress must be pinned with a ref query parameter",
+		},
+		{
+			name:           "duplicate",
+			kustomizations: "  - name: a\n    path: kustomize/base\n",
+			errorMsg:       "duplicate component a, found components/a.yaml and kustomize/base",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reset := newKustomizationsApp(t, test.kustomizations)
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
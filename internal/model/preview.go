@@ -0,0 +1,84 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Preview is a temporary environment derived from a base environment. It has the same components and parameters as
+// the base environment and all its namespaces have the preview suffix appended to them.
+type Preview struct {
+	Env       string            `json:"env"`       // the name of the preview environment
+	Base      string            `json:"base"`      // the base environment
+	Suffix    string            `json:"suffix"`    // the suffix that identifies the preview
+	Namespace string            `json:"namespace"` // the default namespace of the preview environment
+	Props     map[string]string `json:"props"`     // user-supplied properties with placeholders expanded
+}
+
+// NamespaceFor returns the preview namespace for the supplied namespace of the base environment.
+func (p *Preview) NamespaceFor(ns string) string {
+	return ns + "-" + p.Suffix
+}
+
+var rePreviewSuffix = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// AddPreview adds a preview environment for the supplied base environment and suffix and returns it. The preview
+// environment is named <base>-<suffix> and only exists for the lifetime of the app object. The placeholders
+// {env}, {base}, {suffix} and {namespace} in values of the supplied properties are replaced with the attributes of
+// the preview.
+func (a *App) AddPreview(base, suffix string, props map[string]string) (*Preview, error) {
+	if base == Baseline {
+		return nil, fmt.Errorf("cannot preview baseline environment, use a real environment")
+	}
+	baseEnv, ok := a.Spec.Environments[base]
+	if !ok {
+		return nil, fmt.Errorf("invalid environment %q", base)
+	}
+	if !rePreviewSuffix.MatchString(suffix) {
+		return nil, fmt.Errorf("invalid preview suffix %q, must consist of lower case alphanumeric characters or '-'", suffix)
+	}
+	name := base + "-" + suffix
+	if _, ok := a.Spec.Environments[name]; ok {
+		return nil, fmt.Errorf("preview environment %s has the same name as an existing environment", name)
+	}
+	p := &Preview{Env: name, Base: base, Suffix: suffix, Props: map[string]string{}}
+	ns := baseEnv.DefaultNamespace
+	if ns == "" {
+		ns = "default"
+	}
+	p.Namespace = p.NamespaceFor(ns)
+	r := strings.NewReplacer("{env}", p.Env, "{base}", p.Base, "{suffix}", p.Suffix, "{namespace}", p.Namespace)
+	for k, v := range props {
+		p.Props[k] = r.Replace(v)
+	}
+	env := baseEnv
+	env.DefaultNamespace = p.Namespace
+	a.Spec.Environments[name] = env
+	if a.previews == nil {
+		a.previews = map[string]*Preview{}
+	}
+	a.previews[name] = p
+	return p, nil
+}
+
+// Preview returns the preview for the supplied environment or nil if it is not a preview environment.
+func (a *App) Preview(env string) *Preview {
+	return a.previews[env]
+}
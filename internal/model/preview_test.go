@@ -0,0 +1,80 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddPreview(t *testing.T) {
+	reset := setPwd(t, "../../examples/test-app")
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Nil(app.Preview("dev"))
+
+	p, err := app.AddPreview("dev", "pr-123", map[string]string{"host": "{suffix}.example.com", "ns": "{namespace}", "env": "{base}/{env}"})
+	require.Nil(t, err)
+	a.Equal("dev-pr-123", p.Env)
+	a.Equal("default-pr-123", p.Namespace)
+	a.Equal("bar-system-pr-123", p.NamespaceFor("bar-system"))
+	a.EqualValues(map[string]string{"host": "pr-123.example.com", "ns": "default-pr-123", "env": "dev/dev-pr-123"}, p.Props)
+	a.Equal(p, app.Preview("dev-pr-123"))
+
+	env, ok := app.Spec.Environments["dev-pr-123"]
+	require.True(t, ok)
+	a.Equal("default-pr-123", env.DefaultNamespace)
+	a.Equal(app.Spec.Environments["dev"].Server, env.Server)
+	comps, err := app.ComponentsForEnvironment("dev-pr-123", nil, nil)
+	require.Nil(t, err)
+	a.Equal(2, len(comps))
+	a.Equal("cluster-objects", comps[0].Name)
+	a.Equal("service2", comps[1].Name)
+}
+
+func TestAddPreviewNegative(t *testing.T) {
+	reset := setPwd(t, "../../examples/test-app")
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	tests := []struct {
+		name   string
+		base   string
+		suffix string
+		msg    string
+	}{
+		{"baseline", Baseline, "pr-1", "cannot preview baseline environment, use a real environment"},
+		{"bad env", "stage", "pr-1", `invalid environment "stage"`},
+		{"bad suffix", "dev", "PR_1", `invalid preview suffix "PR_1", must consist of lower case alphanumeric characters or '-'`},
+		{"duplicate", "dev", "pr-1", "preview environment dev-pr-1 has the same name as an existing environment"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name == "duplicate" {
+				_, err := app.AddPreview("dev", "pr-1", nil)
+				require.Nil(t, err)
+			}
+			_, err := app.AddPreview(test.base, test.suffix, nil)
+			require.NotNil(t, err)
+			assert.Equal(t, test.msg, err.Error())
+		})
+	}
+}
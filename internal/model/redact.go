@@ -0,0 +1,88 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Redactor hides sensitive information in objects such that they can be shared. In addition to the secret values
+// hidden by HideSensitiveInfo, it hides the string data of secrets and all parts of string values that match any
+// of its patterns. Redacted values are replaced with stable strings that can still be compared.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a redactor for the supplied regular expressions.
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("redaction pattern %q", p))
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// redactValue returns the supplied value with all matches of the patterns of the redactor replaced.
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			ret[k] = r.redactValue(item)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			ret = append(ret, r.redactValue(item))
+		}
+		return ret
+	case string:
+		for _, re := range r.patterns {
+			value = re.ReplaceAllStringFunc(value, obfuscate)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// Redact returns a copy of the supplied object with sensitive information hidden.
+func (r *Redactor) Redact(in K8sLocalObject) K8sLocalObject {
+	obj, _ := HideSensitiveInfo(in.ToUnstructured())
+	ret := map[string]interface{}{}
+	for k, v := range obj.Object {
+		if k == "apiVersion" || k == "kind" {
+			ret[k] = v
+			continue
+		}
+		ret[k] = r.redactValue(v)
+	}
+	if stringData, ok := ret["stringData"].(map[string]interface{}); ok && HasSensitiveInfo(obj) {
+		for k, v := range stringData {
+			stringData[k] = obfuscate(fmt.Sprintf("%s:%s", k, v))
+		}
+	}
+	return NewK8sLocalObject(ret, in.Application(), in.Component(), in.Environment())
+}
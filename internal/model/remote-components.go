@@ -0,0 +1,456 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// remoteComponentCacheDir is the directory, relative to the app root, where fetched git repositories and the files of
+// remote components are cached.
+const remoteComponentCacheDir = ".qbec/components"
+
+// remoteComponentClient is the HTTP client used to fetch OCI artifacts.
+var remoteComponentClient = &http.Client{Timeout: 30 * time.Second}
+
+// remoteRefTTL is how long the commit or digest that a git branch or tag, or an OCI tag, resolved to is used from the
+// cache before the ref is resolved again.
+const remoteRefTTL = 15 * time.Minute
+
+// ociManifestMediaType is the media type of the OCI image manifests that are requested from registries.
+const ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+// ociTitleAnnotation is the layer annotation with the file name of the layer, as set by tools like oras.
+const ociTitleAnnotation = "org.opencontainers.image.title"
+
+// String returns a description of the supplied remote component for messages.
+func (r RemoteComponent) String() string {
+	if r.OCI != "" {
+		return fmt.Sprintf("%s//%s", r.OCI, r.Path)
+	}
+	ref := r.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return fmt.Sprintf("%s//%s@%s", r.Git, r.Path, ref)
+}
+
+// componentName returns the name of the supplied remote component.
+func (r RemoteComponent) componentName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	base := path.Base(r.Path)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// verify returns an error if the supplied remote component does not have a valid combination of attributes.
+func (r RemoteComponent) verify() error {
+	switch {
+	case r.Git != "" && r.OCI != "":
+		return fmt.Errorf("remote component %s: only one of git and oci may be set", r)
+	case r.Git == "" && r.OCI == "":
+		return fmt.Errorf("remote component %s: one of git or oci is required", r.Path)
+	case r.OCI != "" && r.Ref != "":
+		return fmt.Errorf("remote component %s: ref can only be used with git, specify the tag or digest in the oci reference", r)
+	}
+	if p := path.Clean(r.Path); path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("remote component %s: path must be relative and cannot refer to a parent directory", r)
+	}
+	if !supportedExtensions[path.Ext(r.Path)] {
+		return fmt.Errorf("remote component %s: path must be a .jsonnet, .yaml or .json file", r)
+	}
+	return nil
+}
+
+// token returns the bearer token for the supplied remote component, if any.
+func (r RemoteComponent) token() (string, error) {
+	if r.TokenEnv == "" {
+		return "", nil
+	}
+	t := os.Getenv(r.TokenEnv)
+	if t == "" {
+		return "", fmt.Errorf("remote component %s: environment variable %s for the token is not set", r, r.TokenEnv)
+	}
+	return t, nil
+}
+
+// checkSum returns an error if the supplied remote component has a checksum that the supplied file does not match.
+func (r RemoteComponent) checkSum(file string) error {
+	if r.SHA256 == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	if actual := hex.EncodeToString(sum[:]); actual != r.SHA256 {
+		return fmt.Errorf("remote component %s: checksum mismatch, want sha256 %s, got %s", r, r.SHA256, actual)
+	}
+	return nil
+}
+
+// cacheSourceDir populates the supplied directory of the cache using the supplied function, unless it is already
+// there. The function writes to a temporary directory that is renamed when it succeeds, such that concurrent runs
+// never see partial contents.
+func cacheSourceDir(dir string, populate func(tmp string) error) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := populate(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// safeJoin returns the supplied slash-separated relative name under the supplied directory, with an error if the name
+// refers to a location outside it.
+func safeJoin(dir, name string) (string, error) {
+	p := path.Clean(name)
+	if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(p)), nil
+}
+
+// extractTar extracts the regular files of the supplied tar archive into the supplied directory.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		file, err := safeJoin(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, b, 0644); err != nil {
+			return err
+		}
+	}
+}
+
+// refCacheFile returns the file in the cache that has the commit or digest that the supplied source resolved to.
+func (a *App) refCacheFile(source string) string {
+	return filepath.Join(a.root, remoteComponentCacheDir, "refs", cacheKey(source))
+}
+
+// cachedRef returns the commit or digest that the supplied source resolved to, if it was resolved less than
+// remoteRefTTL ago.
+func (a *App) cachedRef(source string) (string, bool) {
+	file := a.refCacheFile(source)
+	st, err := os.Stat(file)
+	if err != nil || time.Since(st.ModTime()) > remoteRefTTL {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
+
+// cacheRef records the commit or digest that the supplied source resolved to.
+func (a *App) cacheRef(source, resolved string) error {
+	return writeCacheFile(a.refCacheFile(source), []byte(resolved+"\n"))
+}
+
+// fetchGitComponent returns the local copy of the file of the supplied remote component in its git repository. The
+// repository is fetched into a bare repository in the cache, and the directory of the file is extracted once for
+// every commit. A ref that is a commit already in the cache is used without fetching, as is the commit that a branch
+// or tag resolved to less than remoteRefTTL ago.
+func (a *App) fetchGitComponent(r RemoteComponent) (string, error) {
+	repo := filepath.Join(a.root, remoteComponentCacheDir, "git", cacheKey(r.Git))
+	if _, err := os.Stat(repo); err != nil {
+		if _, err := runGitCommand("init", "--quiet", "--bare", repo); err != nil {
+			return "", errors.Wrapf(err, "remote component %s", r)
+		}
+	}
+	ref := r.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	source := r.Git + "@" + ref
+	var commit string
+	if reCommit.MatchString(ref) {
+		if gitHasCommit(repo, ref) {
+			commit = ref
+		}
+	} else if c, ok := a.cachedRef(source); ok && gitHasCommit(repo, c) {
+		commit = c
+	}
+	if commit == "" {
+		token, err := r.token()
+		if err != nil {
+			return "", err
+		}
+		if _, err := runGit(gitTokenEnv(token), "-C", repo, "fetch", "--quiet", "--depth", "1", r.Git, ref); err != nil {
+			return "", errors.Wrapf(err, "remote component %s: fetch", r)
+		}
+		out, err := runGitCommand("-C", repo, "rev-parse", "FETCH_HEAD^{commit}")
+		if err != nil {
+			return "", errors.Wrapf(err, "remote component %s", r)
+		}
+		commit = strings.TrimSpace(out)
+		if !reCommit.MatchString(ref) {
+			if err := a.cacheRef(source, commit); err != nil {
+				return "", errors.Wrapf(err, "remote component %s: cache", r)
+			}
+		}
+	}
+	dir := filepath.Join(a.root, remoteComponentCacheDir, "src", cacheKey(r.Git+"@"+commit))
+	err := cacheSourceDir(dir, func(tmp string) error {
+		args := []string{"-C", repo, "archive", "--format=tar", commit}
+		if d := path.Dir(path.Clean(r.Path)); d != "." {
+			args = append(args, d)
+		}
+		out, err := runGitCommand(args...)
+		if err != nil {
+			return err
+		}
+		return extractTar(strings.NewReader(out), tmp)
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "remote component %s", r)
+	}
+	return safeJoin(dir, r.Path)
+}
+
+// ociReference is a parsed reference to an OCI artifact.
+type ociReference struct {
+	registry   string
+	repository string
+	reference  string // tag or digest
+}
+
+// parseOCIReference parses a reference of the form <registry>/<repository>:<tag> or <registry>/<repository>@<digest>.
+// The tag defaults to latest.
+func parseOCIReference(s string) (ociReference, error) {
+	pos := strings.Index(s, "/")
+	if pos <= 0 || pos == len(s)-1 {
+		return ociReference{}, fmt.Errorf("invalid oci reference %q, must be <registry>/<repository>:<tag> or <registry>/<repository>@<digest>", s)
+	}
+	ret := ociReference{registry: s[:pos], repository: s[pos+1:], reference: "latest"}
+	if at := strings.Index(ret.repository, "@"); at >= 0 {
+		ret.repository, ret.reference = ret.repository[:at], ret.repository[at+1:]
+		if !strings.HasPrefix(ret.reference, "sha256:") {
+			return ociReference{}, fmt.Errorf("invalid oci reference %q, only sha256 digests are supported", s)
+		}
+	} else if colon := strings.LastIndex(ret.repository, ":"); colon > strings.LastIndex(ret.repository, "/") {
+		ret.repository, ret.reference = ret.repository[:colon], ret.repository[colon+1:]
+	}
+	if ret.repository == "" || ret.reference == "" {
+		return ociReference{}, fmt.Errorf("invalid oci reference %q, must be <registry>/<repository>:<tag> or <registry>/<repository>@<digest>", s)
+	}
+	return ret, nil
+}
+
+// checkDigest returns an error if the supplied content does not have the supplied sha256 digest.
+func checkDigest(content []byte, digest string) error {
+	sum := sha256.Sum256(content)
+	if actual := "sha256:" + hex.EncodeToString(sum[:]); actual != digest {
+		return fmt.Errorf("digest mismatch, want %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// ociGet returns the content of the supplied path of the registry of the supplied reference.
+func ociGet(ref ociReference, p, token, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v2/%s/%s", ref.registry, ref.repository, p), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	res, err := remoteComponentClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %s", p, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// fetchOCIComponent returns the local copy of the file of the supplied remote component in its OCI artifact. The
+// layers of the artifact that have titles are downloaded once for every manifest digest and verified against their
+// digests. A reference that is a digest already in the cache is used without contacting the registry, as is the
+// digest that a tag resolved to less than remoteRefTTL ago.
+func (a *App) fetchOCIComponent(r RemoteComponent) (string, error) {
+	ref, err := parseOCIReference(r.OCI)
+	if err != nil {
+		return "", fmt.Errorf("remote component %s: %v", r, err)
+	}
+	dirFor := func(digest string) string {
+		return filepath.Join(a.root, remoteComponentCacheDir, "src", cacheKey(ref.registry+"/"+ref.repository+"@"+digest))
+	}
+	pinned := strings.HasPrefix(ref.reference, "sha256:")
+	cached := ref.reference
+	if !pinned {
+		cached, _ = a.cachedRef(r.OCI)
+	}
+	if cached != "" {
+		dir := dirFor(cached)
+		if _, err := os.Stat(dir); err == nil {
+			return safeJoin(dir, r.Path)
+		}
+	}
+	token, err := r.token()
+	if err != nil {
+		return "", err
+	}
+	b, err := ociGet(ref, "manifests/"+ref.reference, token, ociManifestMediaType)
+	if err != nil {
+		return "", errors.Wrapf(err, "remote component %s: fetch", r)
+	}
+	sum := sha256.Sum256(b)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if pinned && digest != ref.reference {
+		return "", fmt.Errorf("remote component %s: manifest digest mismatch, want %s, got %s", r, ref.reference, digest)
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return "", errors.Wrapf(err, "remote component %s: unmarshal manifest", r)
+	}
+	dir := dirFor(digest)
+	err = cacheSourceDir(dir, func(tmp string) error {
+		found := false
+		for _, l := range manifest.Layers {
+			title := l.Annotations[ociTitleAnnotation]
+			if title == "" {
+				continue
+			}
+			file, err := safeJoin(tmp, title)
+			if err != nil {
+				return err
+			}
+			content, err := ociGet(ref, "blobs/"+l.Digest, token, "")
+			if err != nil {
+				return errors.Wrap(err, "fetch")
+			}
+			if err := checkDigest(content, l.Digest); err != nil {
+				return errors.Wrapf(err, "layer %s", title)
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(file, content, 0644); err != nil {
+				return err
+			}
+			found = found || path.Clean(title) == path.Clean(r.Path)
+		}
+		if !found {
+			return fmt.Errorf("artifact has no layer with title %s", r.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "remote component %s", r)
+	}
+	if !pinned {
+		if err := a.cacheRef(r.OCI, digest); err != nil {
+			return "", errors.Wrapf(err, "remote component %s: cache", r)
+		}
+	}
+	return safeJoin(dir, r.Path)
+}
+
+// loadRemoteComponents fetches the remote components of the app and returns them as components whose files are in
+// the cache.
+func (a *App) loadRemoteComponents() ([]Component, error) {
+	var ret []Component
+	for _, r := range a.Spec.RemoteComponents {
+		if err := r.verify(); err != nil {
+			return nil, err
+		}
+		var file string
+		var err error
+		if r.OCI != "" {
+			file, err = a.fetchOCIComponent(r)
+		} else {
+			file, err = a.fetchGitComponent(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("remote component %s: file not found", r)
+		}
+		if err := r.checkSum(file); err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(a.root, file)
+		if err != nil {
+			rel = file
+		}
+		ret = append(ret, Component{Name: r.componentName(), File: rel})
+	}
+	return ret, nil
+}
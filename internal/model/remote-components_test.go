@@ -0,0 +1,321 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRemoteComponentsApp returns the directory of a new app with one local component, a dev environment and the
+// supplied remote components section, changing to its directory, along with a function to change back and remove it.
+func newRemoteComponentsApp(t *testing.T, remote string) (string, func()) {
+	dir, err := ioutil.TempDir("", "remote-components")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", "a.yaml"), []byte("{}"), 0644))
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+  environments:
+    dev:
+      server: https://dev-server
+  remoteComponents:
+` + remote
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return dir, func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+const remoteIngress = "local lib = import './lib.libsonnet';\n{ ingress: lib.ingress }\n"
+
+func TestRemoteComponentsGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo, err := ioutil.TempDir("", "component-repo")
+	require.Nil(t, err)
+	defer os.RemoveAll(repo)
+	git := func(args ...string) string {
+		out, err := runGitCommand(append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.Nil(t, err)
+		return strings.TrimSpace(out)
+	}
+	git("init", "--quiet")
+	require.Nil(t, os.MkdirAll(filepath.Join(repo, "shared"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(repo, "shared", "ingress.jsonnet"), []byte(remoteIngress), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(repo, "shared", "lib.libsonnet"), []byte("{ ingress: {} }\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("components\n"), 0644))
+	git("add", ".")
+	git("commit", "--quiet", "-m", "components")
+	commit := git("rev-parse", "HEAD")
+
+	_, reset := newRemoteComponentsApp(t, fmt.Sprintf("  - git: file://%s\n    ref: %s\n    path: shared/ingress.jsonnet\n    sha256: %s\n", repo, commit, sha256Of(remoteIngress)))
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	c, ok := app.Component("ingress")
+	require.True(t, ok)
+	a.True(strings.HasPrefix(c.File, filepath.Join(".qbec", "components", "src")))
+	a.True(strings.HasSuffix(c.File, filepath.Join("shared", "ingress.jsonnet")))
+	_, err = os.Stat(filepath.Join(filepath.Dir(c.File), "lib.libsonnet"))
+	a.Nil(err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(c.File), "..", "README.md"))
+	a.True(os.IsNotExist(err))
+	comps, err := app.ComponentsForEnvironment("dev", nil, nil)
+	require.Nil(t, err)
+	a.Equal(2, len(comps))
+
+	// the pinned commit is used from the cache
+	require.Nil(t, os.RemoveAll(repo))
+	app, err = NewApp("qbec.yaml")
+	require.Nil(t, err)
+	c2, _ := app.Component("ingress")
+	a.Equal(c.File, c2.File)
+}
+
+// ociRegistry is a test registry that serves a single artifact.
+type ociRegistry struct {
+	manifest []byte
+	blobs    map[string][]byte
+	requests int
+	auth     string
+}
+
+func newOCIRegistry(t *testing.T, files map[string]string, extra ...string) *ociRegistry {
+	r := &ociRegistry{blobs: map[string][]byte{}}
+	type layer struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int               `json:"size"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	var layers []layer
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	names = append(names, extra...)
+	for _, name := range names {
+		content, ok := files[name]
+		l := layer{MediaType: "application/octet-stream", Digest: "sha256:" + sha256Of(content), Size: len(content)}
+		if ok {
+			l.Annotations = map[string]string{ociTitleAnnotation: name}
+		}
+		r.blobs[l.Digest] = []byte(content)
+		layers = append(layers, l)
+	}
+	b, err := json.Marshal(map[string]interface{}{"schemaVersion": 2, "mediaType": ociManifestMediaType, "layers": layers})
+	require.Nil(t, err)
+	r.manifest = b
+	return r
+}
+
+func (r *ociRegistry) digest() string {
+	return "sha256:" + sha256Of(string(r.manifest))
+}
+
+func (r *ociRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests++
+	r.auth = req.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v2/team/components/manifests/"):
+		w.Write(r.manifest)
+	case strings.HasPrefix(req.URL.Path, "/v2/team/components/blobs/"):
+		b, ok := r.blobs[strings.TrimPrefix(req.URL.Path, "/v2/team/components/blobs/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(b)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestRemoteComponentsOCI(t *testing.T) {
+	reg := newOCIRegistry(t, map[string]string{"ingress.jsonnet": remoteIngress, "lib.libsonnet": "{ ingress: {} }\n"}, "untitled")
+	ts := httptest.NewTLSServer(reg)
+	defer ts.Close()
+	c := remoteComponentClient
+	defer func() { remoteComponentClient = c }()
+	remoteComponentClient = ts.Client()
+	require.Nil(t, os.Setenv("QBEC_TEST_OCI_TOKEN", "s3cr3t"))
+	defer os.Unsetenv("QBEC_TEST_OCI_TOKEN")
+	host := strings.TrimPrefix(ts.URL, "https://")
+
+	_, reset := newRemoteComponentsApp(t, fmt.Sprintf("  - oci: %s/team/components:v1.2.0\n    name: edge\n    path: ingress.jsonnet\n    tokenEnv: QBEC_TEST_OCI_TOKEN\n", host))
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	comp, ok := app.Component("edge")
+	require.True(t, ok)
+	b, err := ioutil.ReadFile(comp.File)
+	require.Nil(t, err)
+	a.Equal(remoteIngress, string(b))
+	_, err = os.Stat(filepath.Join(filepath.Dir(comp.File), "lib.libsonnet"))
+	a.Nil(err)
+	a.Equal("Bearer s3cr3t", reg.auth)
+	a.Equal(3, reg.requests)
+
+	// the digest of a tag is used from the cache until it expires, and the layers are only downloaded once
+	_, err = NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(3, reg.requests)
+	old := time.Now().Add(-2 * remoteRefTTL)
+	require.Nil(t, os.Chtimes(app.refCacheFile(fmt.Sprintf("%s/team/components:v1.2.0", host)), old, old))
+	_, err = NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a.Equal(4, reg.requests)
+
+	// a digest in the cache is used without contacting the registry
+	qb := fmt.Sprintf("apiVersion: qbec.io/v1alpha1\nkind: App\nmetadata:\n  name: test-app\nspec:\n  environments:\n    dev:\n      server: https://dev-server\n  remoteComponents:\n  - oci: %s/team/components@%s\n    path: ingress.jsonnet\n", host, reg.digest())
+	require.Nil(t, ioutil.WriteFile("qbec.yaml", []byte(qb), 0644))
+	app, err = NewApp("qbec.yaml")
+	require.Nil(t, err)
+	_, ok = app.Component("ingress")
+	a.True(ok)
+	a.Equal(4, reg.requests)
+}
+
+func TestRemoteComponentsNegative(t *testing.T) {
+	reg := newOCIRegistry(t, map[string]string{"ingress.jsonnet": remoteIngress})
+	ts := httptest.NewTLSServer(reg)
+	defer ts.Close()
+	c := remoteComponentClient
+	defer func() { remoteComponentClient = c }()
+	remoteComponentClient = ts.Client()
+	host := strings.TrimPrefix(ts.URL, "https://")
+
+	tests := []struct {
+		name     string
+		remote   string
+		tamper   bool
+		errorMsg string
+	}{
+		{
+			name:     "no source",
+			remote:   "  - path: ingress.jsonnet\n",
+			errorMsg: "remote component ingress.jsonnet: one of git or oci is required",
+		},
+		{
+			name:     "both sources",
+			remote:   "  - git: https://example.com/repo.git\n    oci: example.com/repo:v1\n    path: ingress.jsonnet\n",
+			errorMsg: "remote component example.com/repo:v1//ingress.jsonnet: only one of git and oci may be set",
+		},
+		{
+			name:     "oci ref",
+			remote:   "  - oci: example.com/repo:v1\n    ref: v1\n    path: ingress.jsonnet\n",
+			errorMsg: "remote component example.com/repo:v1//ingress.jsonnet: ref can only be used with git, specify the tag or digest in the oci reference",
+		},
+		{
+			name:     "parent path",
+			remote:   "  - git: https://example.com/repo.git\n    path: ../ingress.jsonnet\n",
+			errorMsg: "remote component https://example.com/repo.git//../ingress.jsonnet@HEAD: path must be relative and cannot refer to a parent directory",
+		},
+		{
+			name:     "bad extension",
+			remote:   "  - git: https://example.com/repo.git\n    path: ingress.libsonnet\n",
+			errorMsg: "remote component https://example.com/repo.git//ingress.libsonnet@HEAD: path must be a .jsonnet, .yaml or .json file",
+		},
+		{
+			name:     "bad oci reference",
+			remote:   "  - oci: repo\n    path: ingress.jsonnet\n",
+			errorMsg: `remote component repo//ingress.jsonnet: invalid oci reference "repo", must be <registry>/<repository>:<tag> or <registry>/<repository>@<digest>`,
+		},
+		{
+			name:     "token not set",
+			remote:   fmt.Sprintf("  - oci: %s/team/components:v1\n    path: ingress.jsonnet\n    tokenEnv: QBEC_TEST_NO_SUCH_TOKEN\n", host),
+			errorMsg: fmt.Sprintf("remote component %s/team/components:v1//ingress.jsonnet: environment variable QBEC_TEST_NO_SUCH_TOKEN for the token is not set", host),
+		},
+		{
+			name:     "missing layer",
+			remote:   fmt.Sprintf("  - oci: %s/team/components:v1\n    path: missing.jsonnet\n", host),
+			errorMsg: "artifact has no layer with title missing.jsonnet",
+		},
+		{
+			name:     "checksum",
+			remote:   fmt.Sprintf("  - oci: %s/team/components:v1\n    path: ingress.jsonnet\n    sha256: %s\n", host, sha256Of("foo")),
+			errorMsg: fmt.Sprintf("remote component %s/team/components:v1//ingress.jsonnet: checksum mismatch, want sha256 %s, got %s", host, sha256Of("foo"), sha256Of(remoteIngress)),
+		},
+		{
+			name:     "tampered layer",
+			remote:   fmt.Sprintf("  - oci: %s/team/components:v1\n    path: ingress.jsonnet\n", host),
+			tamper:   true,
+			errorMsg: "layer ingress.jsonnet: digest mismatch",
+		},
+		{
+			name:     "duplicate",
+			remote:   fmt.Sprintf("  - oci: %s/team/components:v1\n    name: a\n    path: ingress.jsonnet\n", host),
+			errorMsg: "duplicate component a, found components/a.yaml and .qbec",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			digest := "sha256:" + sha256Of(remoteIngress)
+			if test.tamper {
+				reg.blobs[digest] = []byte("{}")
+				defer func() { reg.blobs[digest] = []byte(remoteIngress) }()
+			}
+			_, reset := newRemoteComponentsApp(t, test.remote)
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected ociReference
+	}{
+		{"ghcr.io/team/components:v1.2.0", ociReference{"ghcr.io", "team/components", "v1.2.0"}},
+		{"localhost:5000/components", ociReference{"localhost:5000", "components", "latest"}},
+		{"ghcr.io/components@sha256:abc", ociReference{"ghcr.io", "components", "sha256:abc"}},
+	}
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			ref, err := parseOCIReference(test.ref)
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, ref)
+		})
+	}
+	_, err := parseOCIReference("ghcr.io/components@md5:abc")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "only sha256 digests are supported")
+}
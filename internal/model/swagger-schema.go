@@ -1,6 +1,6 @@
 package model
 
-// generated by gen-qbec-swagger from internal/model/swagger.yaml at 2019-02-23 05:19:18.686016829 +0000 UTC
+// generated by gen-qbec-swagger from swagger.yaml at 2026-10-14 19:04:43.262418000 +0000 UTC
 // Do NOT edit this file by hand
 
 var swaggerJSON = `
@@ -52,10 +52,51 @@ var swaggerJSON = `
         "qbec.io.v1alpha1.AppSpec": {
             "additionalProperties": false,
             "properties": {
+                "applyOrder": {
+                    "description": "apply order for kinds of objects, overriding the built-in order of known kinds or placing other kinds at a\nspecific position",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.KindOrder"
+                    },
+                    "type": "array"
+                },
+                "changeLimits": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.ChangeLimits"
+                },
+                "components": {
+                    "additionalProperties": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.ComponentSpec"
+                    },
+                    "description": "per-component configuration keyed by component name",
+                    "type": "object"
+                },
                 "componentsDir": {
                     "description": "directory containing component files, default to components/",
                     "type": "string"
                 },
+                "crdDirs": {
+                    "description": "directories with YAML or JSON files of custom resource definitions, relative to the app root, used by validate\nfor custom resources whose definitions are not installed on the cluster",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "envGroups": {
+                    "additionalProperties": {
+                        "items": {
+                            "type": "string"
+                        },
+                        "type": "array"
+                    },
+                    "description": "named groups of environments that can be operated on together, keyed by group name",
+                    "type": "object"
+                },
+                "environmentFiles": {
+                    "description": "files outside qbec.yaml with additional environments",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.EnvironmentFile"
+                    },
+                    "type": "array"
+                },
                 "environments": {
                     "additionalProperties": {
                         "$ref": "#/definitions/qbec.io.v1alpha1.Environment"
@@ -64,6 +105,10 @@ var swaggerJSON = `
                     "minProperties": 1,
                     "type": "object"
                 },
+                "evalLimits": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.EvalLimits",
+                    "description": "limits on the evaluation of every jsonnet component, to abort runaway evaluations"
+                },
                 "excludes": {
                     "description": "list of components to exclude by default for every environment",
                     "items": {
@@ -71,6 +116,44 @@ var swaggerJSON = `
                     },
                     "type": "array"
                 },
+                "generators": {
+                    "description": "jsonnet functions that generate a component for every name in a data source",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Generator"
+                    },
+                    "type": "array"
+                },
+                "healthChecks": {
+                    "description": "custom health checks used to determine readiness of objects when waiting, these override built-in checks",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.HealthCheck"
+                    },
+                    "type": "array"
+                },
+                "helmCharts": {
+                    "description": "components that render Helm charts",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.HelmChart"
+                    },
+                    "type": "array"
+                },
+                "imagePolicy": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.ImagePolicy"
+                },
+                "keyProviders": {
+                    "description": "programs that decrypt encrypted values of environment properties when environments are evaluated",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.KeyProvider"
+                    },
+                    "type": "array"
+                },
+                "kustomizations": {
+                    "description": "components that build kustomize directories",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Kustomization"
+                    },
+                    "type": "array"
+                },
                 "libPaths": {
                     "description": "list of library paths to add to the jsonnet VM at evaluation",
                     "items": {
@@ -78,9 +161,73 @@ var swaggerJSON = `
                     },
                     "type": "array"
                 },
+                "nestedComponents": {
+                    "description": "load components from subdirectories of the components directory as well, naming them by their path relative to\nit without the extension, such as team-a/service-b",
+                    "type": "boolean"
+                },
                 "paramsFile": {
                     "description": "standard file containing parameters for all environments returning correct values based on qbec.io/env external\nvariable, defaults to params.libsonnet",
                     "type": "string"
+                },
+                "policies": {
+                    "description": "policies that validate checks every rendered object against",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Policy"
+                    },
+                    "type": "array"
+                },
+                "propertySchema": {
+                    "description": "JSON schema of an object that the properties of every environment must conform to when it is evaluated",
+                    "type": "object"
+                },
+                "protectedKinds": {
+                    "description": "kinds of objects that are never deleted by garbage collection or the delete command unless protection is\nexplicitly overridden",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "redactPatterns": {
+                    "description": "regular expressions for sensitive parts of string values that are hidden by show --redact, in addition to\nsecret values",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "remoteComponents": {
+                    "description": "components fetched from git repositories or OCI registries in addition to those in the components directory",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.RemoteComponent"
+                    },
+                    "type": "array"
+                },
+                "replaceKinds": {
+                    "description": "kinds of objects that are replaced instead of patched when they change, for very large objects where computing\nand applying a three-way merge patch is slow",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "sizeBudgets": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.SizeBudgets"
+                },
+                "timeoutPolicy": {
+                    "description": "what to do when a component exceeds its timeouts, one of \"fail\" (stop immediately, the default) or \"continue\"\n(proceed with other components and report the stalled component at the end)",
+                    "pattern": "^(fail|continue)$",
+                    "type": "string"
+                },
+                "tombstones": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.Tombstones"
+                },
+                "transformers": {
+                    "description": "jsonnet functions applied in order to every object of every environment after components are evaluated",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Transformer"
+                    },
+                    "type": "array"
+                },
+                "vars": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.Vars"
                 }
             },
             "required": [
@@ -89,30 +236,792 @@ var swaggerJSON = `
             "title": "AppSpec is the user-supplied configuration of the qbec app.",
             "type": "object"
         },
+        "qbec.io.v1alpha1.ChangeLimits": {
+            "additionalProperties": false,
+            "properties": {
+                "confirm": {
+                    "description": "prompt for confirmation instead of failing when a limit is exceeded, the prompt is answered by --yes like any other",
+                    "type": "boolean"
+                },
+                "maxChangePercent": {
+                    "description": "max percentage of objects that an apply may create, update or delete, no limit when not set",
+                    "maximum": 100,
+                    "minimum": 1,
+                    "type": "integer"
+                },
+                "maxDeletions": {
+                    "description": "max number of objects that an apply may delete, no limit when not set",
+                    "minimum": 1,
+                    "type": "integer"
+                }
+            },
+            "title": "ChangeLimits are limits on the magnitude of changes made by a single apply, beyond which the apply must be\nexplicitly allowed.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.ComponentDeprecation": {
+            "additionalProperties": false,
+            "properties": {
+                "message": {
+                    "description": "why the component is deprecated and what to use instead",
+                    "type": "string"
+                },
+                "sunset": {
+                    "description": "date in YYYY-MM-DD format by which the component is to be removed, validate with --check-sunset fails for the\ncomponent after it",
+                    "pattern": "^[0-9]{4}-[0-9]{2}-[0-9]{2}$",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "message"
+            ],
+            "title": "ComponentDeprecation is the deprecation notice of a component.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.ComponentDescriptor": {
+            "additionalProperties": false,
+            "properties": {
+                "apiVersion": {
+                    "description": "requested API version",
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "object kind",
+                    "pattern": "^ComponentDescriptor$",
+                    "type": "string"
+                },
+                "spec": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.ComponentDescriptorSpec"
+                }
+            },
+            "required": [
+                "kind",
+                "apiVersion",
+                "spec"
+            ],
+            "title": "QbecComponentDescriptor is the metadata of a component, in a \u003ccomponent\u003e.component.yaml file of the components directory.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.ComponentDescriptorSpec": {
+            "additionalProperties": false,
+            "properties": {
+                "dependsOn": {
+                    "description": "components whose objects must be applied before the objects of this component, regardless of their kinds",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "deprecated": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.ComponentDeprecation"
+                },
+                "description": {
+                    "description": "description of the component",
+                    "type": "string"
+                },
+                "namespace": {
+                    "description": "namespace of namespaced objects of the component that do not set one, instead of the default namespace of the\nenvironment",
+                    "type": "string"
+                },
+                "owners": {
+                    "description": "owners of the component, like team names or email addresses",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "paramSchema": {
+                    "description": "JSON schema of the params of the component that the params of every environment are checked against by validate\nand param list. Params that the schema does not declare are reported as unknown unless it sets\nadditionalProperties",
+                    "type": "object"
+                },
+                "requiredParams": {
+                    "description": "params that must be set for the component in every environment that it is included in, as dotted paths under\nthe params of the component",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "tags": {
+                    "description": "tags that select the component with the --component-tag filter",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                }
+            },
+            "title": "ComponentDescriptorSpec is the specification of a component descriptor.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.ComponentSpec": {
+            "additionalProperties": false,
+            "properties": {
+                "applyTimeout": {
+                    "description": "max time to create/ update all objects of the component as a duration string (e.g. 2m), no limit when not set",
+                    "type": "string"
+                },
+                "dependsOn": {
+                    "description": "components whose objects must be applied before the objects of this component, regardless of their kinds",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "evalLimits": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.EvalLimits",
+                    "description": "limits on the evaluation of the component, overriding those of the app"
+                },
+                "impersonate": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.Impersonation",
+                    "description": "identity to impersonate when apply creates, updates or garbage collects objects of the component"
+                },
+                "waitTimeout": {
+                    "description": "max time to wait for objects of the component to be ready as a duration string, overrides the wait timeout\nspecified on the command line",
+                    "type": "string"
+                }
+            },
+            "title": "ComponentSpec is the optional configuration for a specific component.",
+            "type": "object"
+        },
         "qbec.io.v1alpha1.Environment": {
             "additionalProperties": false,
             "properties": {
+                "clusters": {
+                    "description": "clusters that the environment is deployed to, instead of a single server or context. Each cluster is applied as\nits own environment named \u003cenv\u003e.\u003ccluster\u003e",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.EnvironmentCluster"
+                    },
+                    "type": "array"
+                },
+                "componentRefs": {
+                    "additionalProperties": {
+                        "minLength": 1,
+                        "type": "string"
+                    },
+                    "description": "git refs, like tags or commits, at which components are evaluated for this environment, keyed by component name.\nOther components are evaluated from the working tree",
+                    "type": "object"
+                },
+                "context": {
+                    "description": "name of the kubeconfig context to use for the environment instead of the one for the server URL",
+                    "type": "string"
+                },
+                "contextPattern": {
+                    "description": "regular expression matching the name of exactly one kubeconfig context to use for the environment instead of\nthe one for the server URL",
+                    "type": "string"
+                },
                 "defaultNamespace": {
                     "type": "string"
                 },
+                "defaults": {
+                    "additionalProperties": false,
+                    "description": "default values of flags of commands run for the environment, keyed by command and flag name, like\napply: {wait: true}. Flags specified on the command line take precedence",
+                    "properties": {
+                        "apply": {
+                            "$ref": "#/definitions/qbec.io.v1alpha1.FlagDefaults"
+                        },
+                        "delete": {
+                            "$ref": "#/definitions/qbec.io.v1alpha1.FlagDefaults"
+                        },
+                        "diff": {
+                            "$ref": "#/definitions/qbec.io.v1alpha1.FlagDefaults"
+                        },
+                        "show": {
+                            "$ref": "#/definitions/qbec.io.v1alpha1.FlagDefaults"
+                        },
+                        "validate": {
+                            "$ref": "#/definitions/qbec.io.v1alpha1.FlagDefaults"
+                        }
+                    },
+                    "type": "object"
+                },
                 "excludes": {
                     "items": {
                         "type": "string"
                     },
                     "type": "array"
                 },
+                "imagePolicy": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.EnvironmentImagePolicy"
+                },
                 "includes": {
                     "items": {
                         "type": "string"
                     },
                     "type": "array"
                 },
+                "interlock": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.EnvironmentInterlock"
+                },
+                "parent": {
+                    "description": "environment from which the default namespace, server or context, component lists and refs, properties, policy\nlevels, image policy and transformers are inherited when not set by this environment. Component refs,\nproperties and policy levels are merged with those of the parent",
+                    "type": "string"
+                },
+                "policies": {
+                    "additionalProperties": {
+                        "pattern": "^(deny|warn|disabled)$",
+                        "type": "string"
+                    },
+                    "description": "levels of policies for this environment keyed by policy name, overriding the level set by the policy. Levels are\n\"deny\", \"warn\" or \"disabled\" to not check the policy at all",
+                    "type": "object"
+                },
+                "properties": {
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "description": "properties of the environment that can be used as placeholders in hostnames of ingress and route objects",
+                    "type": "object"
+                },
+                "requireConfirmation": {
+                    "description": "true to ask for confirmation before changing the environment even when --yes is specified",
+                    "type": "boolean"
+                },
                 "server": {
                     "type": "string"
+                },
+                "transformers": {
+                    "description": "jsonnet functions applied in order to every object of the environment after those of the app",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Transformer"
+                    },
+                    "type": "array"
                 }
             },
             "title": "Environment points to a specific destination and has its own set of runtime parameters.",
             "type": "object"
+        },
+        "qbec.io.v1alpha1.EnvironmentCluster": {
+            "additionalProperties": false,
+            "properties": {
+                "context": {
+                    "description": "name of the kubeconfig context to use for the cluster",
+                    "type": "string"
+                },
+                "contextPattern": {
+                    "description": "regular expression matching the name of exactly one kubeconfig context to use for the cluster",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the cluster, unique within the environment",
+                    "minLength": 1,
+                    "type": "string"
+                },
+                "properties": {
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "description": "properties of the cluster, merged with and overriding the properties of the environment",
+                    "type": "object"
+                },
+                "server": {
+                    "description": "server URL of the cluster",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name"
+            ],
+            "title": "EnvironmentCluster is one of multiple clusters that an environment is deployed to.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.EnvironmentFile": {
+            "additionalProperties": false,
+            "properties": {
+                "git": {
+                    "description": "URL of the git repository that has the files",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "glob pattern of local files relative to the app root, or of files in the git repository when git is set",
+                    "type": "string"
+                },
+                "ref": {
+                    "description": "branch, tag or commit of the git repository, defaults to the default branch",
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "hex-encoded SHA-256 checksum that the downloaded file must have",
+                    "pattern": "^[0-9a-f]{64}$",
+                    "type": "string"
+                },
+                "tokenEnv": {
+                    "description": "name of the environment variable with the bearer token used to download the file or fetch the git repository",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "https URL of the file",
+                    "type": "string"
+                }
+            },
+            "title": "EnvironmentFile is a source of environment definitions outside qbec.yaml, one of local files, a file downloaded from an https URL or files in a git repository.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.EnvironmentImagePolicy": {
+            "additionalProperties": false,
+            "properties": {
+                "exceptions": {
+                    "description": "glob patterns of images that are exempt from the image policy in this environment, like quay.io/vendor/*. A *\ndoes not match a slash",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "requireDigest": {
+                    "description": "true if images must be pinned by digest in this environment",
+                    "type": "boolean"
+                }
+            },
+            "title": "EnvironmentImagePolicy changes the image policy of the app for a specific environment.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.EnvironmentInterlock": {
+            "additionalProperties": false,
+            "properties": {
+                "currentContext": {
+                    "description": "regular expression that the current context of the kubeconfig must match",
+                    "type": "string"
+                },
+                "currentNamespace": {
+                    "description": "regular expression that the namespace of the current context of the kubeconfig must match, \"default\" when the\ncontext does not set one",
+                    "type": "string"
+                },
+                "servers": {
+                    "description": "server URLs that the context of the environment must resolve to, one of them",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                }
+            },
+            "title": "EnvironmentInterlock has expectations of the kubeconfig in use. When they are not met, commands refuse to change\nobjects of the environment unless --force-context is specified.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.EnvironmentMap": {
+            "additionalProperties": false,
+            "properties": {
+                "apiVersion": {
+                    "description": "requested API version",
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "object kind",
+                    "pattern": "^EnvironmentMap$",
+                    "type": "string"
+                },
+                "spec": {
+                    "$ref": "#/definitions/qbec.io.v1alpha1.EnvironmentMapSpec"
+                }
+            },
+            "required": [
+                "kind",
+                "apiVersion",
+                "spec"
+            ],
+            "title": "QbecEnvironmentMap is a file with environments of an app, referenced by the environmentFiles of qbec.yaml.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.EnvironmentMapSpec": {
+            "additionalProperties": false,
+            "properties": {
+                "environments": {
+                    "additionalProperties": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Environment"
+                    },
+                    "description": "set of environments defined by the file",
+                    "type": "object"
+                }
+            },
+            "required": [
+                "environments"
+            ],
+            "title": "EnvironmentMapSpec is the specification of an environment file.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.EvalLimits": {
+            "additionalProperties": false,
+            "properties": {
+                "maxMemory": {
+                    "description": "max memory that the evaluation of the component may allocate as a quantity (e.g. 512Mi), no limit when not set",
+                    "type": "string"
+                },
+                "timeout": {
+                    "description": "max time to evaluate the component as a duration string (e.g. 30s), no limit when not set",
+                    "type": "string"
+                }
+            },
+            "title": "EvalLimits are limits on the evaluation of a jsonnet component, beyond which the evaluation is aborted with an\nerror for the component.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.FlagDefaults": {
+            "additionalProperties": {
+                "description": "the value of the flag, or a list of values for flags that may be repeated"
+            },
+            "description": "default values of flags of a command keyed by flag name",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Generator": {
+            "additionalProperties": false,
+            "properties": {
+                "file": {
+                    "description": "jsonnet file relative to the app root that evaluates to a function that accepts the name and data of a\ngenerated component and returns its objects",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the generator, which is the directory of the components that it generates",
+                    "type": "string"
+                },
+                "source": {
+                    "description": "YAML or JSON file relative to the app root with a list of names, or an object whose keys are the names and\nwhose values are the data of the generated components",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name",
+                "file",
+                "source"
+            ],
+            "title": "Generator is a jsonnet function that yields a component for every name listed in a data source.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.HealthCheck": {
+            "additionalProperties": false,
+            "properties": {
+                "expression": {
+                    "description": "jsonnet expression evaluated with the server object available as std.extVar('object'). It must return a boolean\nor an object with a boolean 'healthy' attribute and an optional 'message' string.",
+                    "type": "string"
+                },
+                "group": {
+                    "description": "API group of the object kind, blank for the core group",
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "object kind for which the check is defined",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "kind",
+                "expression"
+            ],
+            "title": "HealthCheck is a user-supplied readiness check for objects of a specific kind.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.HelmChart": {
+            "additionalProperties": false,
+            "properties": {
+                "chart": {
+                    "description": "directory of a local chart relative to the app root, name of the chart in the repository when repo is set, or an oci:// reference of the chart",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the component",
+                    "type": "string"
+                },
+                "namespace": {
+                    "description": "namespace used to render the chart, defaults to the default namespace of the environment",
+                    "type": "string"
+                },
+                "releaseName": {
+                    "description": "release name used to render the chart, defaults to the component name",
+                    "type": "string"
+                },
+                "repo": {
+                    "description": "URL of the chart repository",
+                    "type": "string"
+                },
+                "version": {
+                    "description": "version of the chart, required for charts from repositories and OCI registries",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name",
+                "chart"
+            ],
+            "title": "HelmChart is a component that renders a Helm chart, with the values of the chart taken from the params of the component.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.ImagePolicy": {
+            "additionalProperties": false,
+            "properties": {
+                "allowedRegistries": {
+                    "description": "registries, or registry paths like gcr.io/my-project, that images must be pulled from. Images without a registry\nare pulled from docker.io. Images may be pulled from any registry when not set",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "forbidLatest": {
+                    "description": "true if images must not use the latest tag, which includes images without a tag or digest",
+                    "type": "boolean"
+                },
+                "requireDigest": {
+                    "description": "true if images must be pinned by digest in all environments",
+                    "type": "boolean"
+                }
+            },
+            "title": "ImagePolicy restricts the container images used by objects, checked by validate.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Impersonation": {
+            "additionalProperties": false,
+            "properties": {
+                "groups": {
+                    "description": "groups to impersonate in addition to the user",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "user": {
+                    "description": "user to impersonate, use system:serviceaccount:\u003cnamespace\u003e:\u003cname\u003e for a service account",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "user"
+            ],
+            "title": "Impersonation is the identity under which objects of a component are applied.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.KeyProvider": {
+            "additionalProperties": false,
+            "properties": {
+                "command": {
+                    "description": "the program to run and its arguments, which may refer to environment variables as $VAR or ${VAR}. The program\nreads the ciphertext from its standard input and writes the decrypted value to its standard output",
+                    "items": {
+                        "type": "string"
+                    },
+                    "minItems": 1,
+                    "type": "array"
+                },
+                "name": {
+                    "description": "name of the key provider, used in encrypted values",
+                    "pattern": "^[a-zA-Z0-9][a-zA-Z0-9_-]*$",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name",
+                "command"
+            ],
+            "title": "KeyProvider is a program that decrypts encrypted property values of the form ENC[\u003cprovider\u003e:\u003cbase64 ciphertext\u003e].",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.KindOrder": {
+            "additionalProperties": false,
+            "properties": {
+                "group": {
+                    "description": "API group of the object kind, blank for the core group",
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "object kind whose order is set",
+                    "type": "string"
+                },
+                "order": {
+                    "description": "the order of the kind, objects with lower orders are applied before, and deleted after, ones with higher orders.\nBuilt-in orders are 10 for pod security policies, 20 for custom resource definitions, 50 for namespaces, 60 for\nservice accounts and limit ranges, 70 for config maps and secrets, 100 for workloads, 110 for services and 120\nfor webhook configurations. Other cluster-scoped kinds have order 30 and other namespaced kinds have order 80.",
+                    "minimum": 1,
+                    "type": "integer"
+                }
+            },
+            "required": [
+                "kind",
+                "order"
+            ],
+            "title": "KindOrder is the position of objects of a specific kind in the apply order.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Kustomization": {
+            "additionalProperties": false,
+            "properties": {
+                "name": {
+                    "description": "name of the component",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "directory with a kustomization file relative to the app root, or a remote base URL pinned with a ref query parameter",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name",
+                "path"
+            ],
+            "title": "Kustomization is a component that builds a kustomize directory, with the params of the component applied as patches to the objects that the build produces.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Policy": {
+            "additionalProperties": false,
+            "properties": {
+                "file": {
+                    "description": "Rego file (ending in .rego) or jsonnet file relative to the app root. A Rego policy reports violations in the deny and\nwarn sets of its package, a jsonnet policy evaluates to a function which accepts an object and returns an array of\nviolation messages or findings with a message and level, empty when the object complies with the policy",
+                    "type": "string"
+                },
+                "kinds": {
+                    "description": "kinds of objects the policy applies to, all objects when not set",
+                    "items": {
+                        "type": "string"
+                    },
+                    "type": "array"
+                },
+                "level": {
+                    "description": "what happens when an object violates the policy, one of \"deny\" (validate fails, the default) or \"warn\" (the\nviolation is reported but validate does not fail)",
+                    "pattern": "^(deny|warn)$",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the policy, used in reports and to set its level for specific environments",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name",
+                "file"
+            ],
+            "title": "Policy is a rule that validate checks every rendered object against.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.RemoteComponent": {
+            "additionalProperties": false,
+            "properties": {
+                "git": {
+                    "description": "URL of the git repository that has the component",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the component, defaults to the file name of the path without its extension",
+                    "type": "string"
+                },
+                "oci": {
+                    "description": "reference of the OCI artifact that has the component, as \u003cregistry\u003e/\u003crepository\u003e:\u003ctag\u003e or \u003cregistry\u003e/\u003crepository\u003e@\u003cdigest\u003e",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "path of the component file in the git repository, or title of the layer of the OCI artifact that has it. Other files in the same directory, or layers of the same artifact, are fetched along with it for relative imports.",
+                    "type": "string"
+                },
+                "ref": {
+                    "description": "branch, tag or commit of the git repository, defaults to the default branch",
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "hex-encoded SHA-256 checksum that the component file must have. Signatures are not verified, pin a commit or digest along with the checksum instead.",
+                    "pattern": "^[0-9a-f]{64}$",
+                    "type": "string"
+                },
+                "tokenEnv": {
+                    "description": "name of the environment variable with the bearer token used to fetch the git repository or OCI artifact",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "path"
+            ],
+            "title": "RemoteComponent is a component fetched from a git repository or an OCI registry, which is cached and evaluated as if it were in the components directory.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.SizeBudgets": {
+            "additionalProperties": false,
+            "properties": {
+                "maxComponentSize": {
+                    "description": "max size in bytes of all objects of a component, no limit when not set",
+                    "minimum": 1,
+                    "type": "integer"
+                },
+                "maxObjectSize": {
+                    "description": "max size in bytes of a single object, no limit other than those of the cluster when not set",
+                    "minimum": 1,
+                    "type": "integer"
+                }
+            },
+            "title": "SizeBudgets are limits on the serialized size of rendered objects, reported by show --report.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Tombstones": {
+            "additionalProperties": false,
+            "properties": {
+                "maxEntries": {
+                    "description": "max number of deleted objects that are kept, older ones are dropped first, defaults to 500",
+                    "minimum": 1,
+                    "type": "integer"
+                },
+                "namespace": {
+                    "description": "namespace of the config map, defaults to the default namespace of the environment",
+                    "type": "string"
+                }
+            },
+            "title": "Tombstones configures the recording of objects deleted by garbage collection and the delete command in a config map\non the cluster, listed by the deleted command.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Transformer": {
+            "additionalProperties": false,
+            "properties": {
+                "file": {
+                    "description": "jsonnet file relative to the app root that evaluates to a function that accepts an object and returns the transformed object",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the transformer",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name",
+                "file"
+            ],
+            "title": "Transformer is a jsonnet function that is applied to every object after components are evaluated.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Var": {
+            "additionalProperties": false,
+            "properties": {
+                "default": {
+                    "description": "value used when the variable is not supplied, jsonnet code for code variables. Optional variables without a\ndefault are set to an empty string or null",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "description of the variable, for documentation",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "name of the variable",
+                    "minLength": 1,
+                    "type": "string"
+                },
+                "required": {
+                    "description": "true if the variable must be supplied, rendering fails early when it is missing",
+                    "type": "boolean"
+                },
+                "type": {
+                    "description": "type of the variable, one of \"string\" (the default) or \"code\"",
+                    "pattern": "^(string|code)$",
+                    "type": "string"
+                }
+            },
+            "required": [
+                "name"
+            ],
+            "title": "Var is the declaration of a variable that is passed to the jsonnet VM.",
+            "type": "object"
+        },
+        "qbec.io.v1alpha1.Vars": {
+            "additionalProperties": false,
+            "properties": {
+                "external": {
+                    "description": "external variables, supplied using --vm:ext-str and --vm:ext-code",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Var"
+                    },
+                    "type": "array"
+                },
+                "topLevel": {
+                    "description": "top-level variables, supplied using --vm:tla-str and --vm:tla-code",
+                    "items": {
+                        "$ref": "#/definitions/qbec.io.v1alpha1.Var"
+                    },
+                    "type": "array"
+                }
+            },
+            "title": "Vars are the declarations of external and top-level variables of the app.",
+            "type": "object"
         }
     },
     "paths": {},
@@ -0,0 +1,65 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Transformers returns the transformers for the supplied environment in the order in which they are applied, those of
+// the app followed by those of the environment. The baseline environment only has the transformers of the app.
+func (a *App) Transformers(env string) []Transformer {
+	ret := append([]Transformer{}, a.Spec.Transformers...)
+	if env == Baseline {
+		return ret
+	}
+	return append(ret, a.Spec.Environments[env].Transformers...)
+}
+
+// verifyTransformers returns an error if transformers have duplicate names across the app and an environment, or
+// files that do not exist.
+func (a *App) verifyTransformers() error {
+	var envs []string
+	for name := range a.Spec.Environments {
+		envs = append(envs, name)
+	}
+	sort.Strings(envs)
+	verified := map[string]bool{}
+	for _, env := range append([]string{Baseline}, envs...) {
+		seen := map[string]bool{}
+		for _, t := range a.Transformers(env) {
+			if seen[t.Name] {
+				return fmt.Errorf("env %s: duplicate transformer %s", env, t.Name)
+			}
+			seen[t.Name] = true
+			if verified[t.File] {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(a.root, t.File)); err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("transformer %s: file %s does not exist", t.Name, t.File)
+				}
+				return err
+			}
+			verified[t.File] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTransformersApp returns a new app with one component, transformer files a and b, and the supplied spec
+// attributes, changing to its directory, along with a function to change back and remove it.
+func newTransformersApp(t *testing.T, spec string) func() {
+	dir, err := ioutil.TempDir("", "transformers")
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "components"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "components", "c.yaml"), []byte("{}"), 0644))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "transformers"), 0755))
+	for _, name := range []string{"a", "b"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "transformers", name+".libsonnet"), []byte("function(o) o"), 0644))
+	}
+	app := `apiVersion: qbec.io/v1alpha1
+kind: App
+metadata:
+  name: test-app
+spec:
+` + spec
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "qbec.yaml"), []byte(app), 0644))
+	reset := setPwd(t, dir)
+	return func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTransformers(t *testing.T) {
+	reset := newTransformersApp(t, `  transformers:
+  - name: a
+    file: transformers/a.libsonnet
+  environments:
+    dev:
+      server: https://dev-server
+      transformers:
+      - name: b
+        file: transformers/b.libsonnet
+    dev2:
+      parent: dev
+    prod:
+      server: https://prod-server
+`)
+	defer reset()
+	app, err := NewApp("qbec.yaml")
+	require.Nil(t, err)
+	a := assert.New(t)
+	ta := Transformer{Name: "a", File: "transformers/a.libsonnet"}
+	tb := Transformer{Name: "b", File: "transformers/b.libsonnet"}
+	a.Equal([]Transformer{ta}, app.Transformers(Baseline))
+	a.Equal([]Transformer{ta, tb}, app.Transformers("dev"))
+	a.Equal([]Transformer{ta, tb}, app.Transformers("dev2"))
+	a.Equal([]Transformer{ta}, app.Transformers("prod"))
+}
+
+func TestTransformersNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		errorMsg string
+	}{
+		{
+			name:     "missing file",
+			spec:     "  transformers:\n  - name: c\n    file: transformers/c.libsonnet\n  environments:\n    dev:\n      server: https://dev-server\n",
+			errorMsg: "transformer c: file transformers/c.libsonnet does not exist",
+		},
+		{
+			name:     "duplicate",
+			spec:     "  transformers:\n  - name: a\n    file: transformers/a.libsonnet\n  environments:\n    dev:\n      server: https://dev-server\n      transformers:\n      - name: a\n        file: transformers/b.libsonnet\n",
+			errorMsg: "env dev: duplicate transformer a",
+		},
+		{
+			name:     "no file",
+			spec:     "  transformers:\n  - name: a\n  environments:\n    dev:\n      server: https://dev-server\n",
+			errorMsg: "spec.transformers.file in body is required",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reset := newTransformersApp(t, test.spec)
+			defer reset()
+			_, err := NewApp("qbec.yaml")
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
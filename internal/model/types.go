@@ -20,10 +20,405 @@ package model
 
 // Environment points to a specific destination and has its own set of runtime parameters.
 type Environment struct {
+	// environment from which the default namespace, server or context, component lists and refs, properties, policy
+	// levels, image policy and transformers are inherited when not set by this environment. Component refs,
+	// properties and policy levels are merged with those of the parent
+	Parent           string   `json:"parent,omitempty"`
 	DefaultNamespace string   `json:"defaultNamespace"`   // default namespace to set for k8s context
 	Server           string   `json:"server"`             // server URL of server
 	Includes         []string `json:"includes,omitempty"` // components to be included in this env even if excluded at the app level
 	Excludes         []string `json:"excludes,omitempty"` // additional components to exclude for this env
+	// name of the kubeconfig context to use for the environment instead of the one for the server URL
+	Context string `json:"context,omitempty"`
+	// regular expression matching the name of exactly one kubeconfig context to use for the environment instead of
+	// the one for the server URL
+	ContextPattern string `json:"contextPattern,omitempty"`
+	// git refs, like tags or commits, at which components are evaluated for this environment, keyed by component name.
+	// Other components are evaluated from the working tree
+	ComponentRefs map[string]string `json:"componentRefs,omitempty"`
+	// properties of the environment that can be used as placeholders in hostnames of ingress and route objects
+	Properties map[string]string `json:"properties,omitempty"`
+	// levels of policies for this environment keyed by policy name, overriding the level set by the policy. Levels are
+	// "deny", "warn" or "disabled" to not check the policy at all
+	Policies map[string]string `json:"policies,omitempty"`
+	// changes to the image policy of the app for this environment
+	ImagePolicy *EnvironmentImagePolicy `json:"imagePolicy,omitempty"`
+	// clusters that the environment is deployed to, instead of a single server or context. Each cluster is applied as
+	// its own environment named <env>.<cluster>
+	Clusters []EnvironmentCluster `json:"clusters,omitempty"`
+	// default values of flags of commands run for the environment, keyed by command and flag name, like
+	// apply: {wait: true}. Flags specified on the command line take precedence
+	Defaults map[string]map[string]interface{} `json:"defaults,omitempty"`
+	// true to ask for confirmation before changing the environment even when --yes is specified
+	RequireConfirmation bool `json:"requireConfirmation,omitempty"`
+	// expectations of the kubeconfig that must be met for the environment to be changed
+	Interlock *EnvironmentInterlock `json:"interlock,omitempty"`
+	// jsonnet functions applied in order to every object of the environment after those of the app
+	Transformers []Transformer `json:"transformers,omitempty"`
+}
+
+// EnvironmentInterlock has expectations of the kubeconfig in use. When they are not met, commands refuse to change
+// objects of the environment unless --force-context is specified.
+type EnvironmentInterlock struct {
+	// regular expression that the current context of the kubeconfig must match
+	CurrentContext string `json:"currentContext,omitempty"`
+	// regular expression that the namespace of the current context of the kubeconfig must match, "default" when the
+	// context does not set one
+	CurrentNamespace string `json:"currentNamespace,omitempty"`
+	// server URLs that the context of the environment must resolve to, one of them
+	Servers []string `json:"servers,omitempty"`
+}
+
+// EnvironmentCluster is one of multiple clusters that an environment is deployed to.
+type EnvironmentCluster struct {
+	Name           string `json:"name"`                     // name of the cluster, unique within the environment
+	Server         string `json:"server,omitempty"`         // server URL of the cluster
+	Context        string `json:"context,omitempty"`        // name of the kubeconfig context to use for the cluster
+	ContextPattern string `json:"contextPattern,omitempty"` // regular expression matching the name of exactly one kubeconfig context to use for the cluster
+	// properties of the cluster, merged with and overriding the properties of the environment
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// EnvironmentFile is a source of environment definitions outside qbec.yaml, one of local files, a file downloaded
+// from an https URL or files in a git repository.
+type EnvironmentFile struct {
+	// glob pattern of local files relative to the app root, or of files in the git repository when git is set
+	Path string `json:"path,omitempty"`
+	// https URL of the file
+	URL string `json:"url,omitempty"`
+	// URL of the git repository that has the files
+	Git string `json:"git,omitempty"`
+	// branch, tag or commit of the git repository, defaults to the default branch
+	Ref string `json:"ref,omitempty"`
+	// name of the environment variable with the bearer token used to download the file or fetch the git repository
+	TokenEnv string `json:"tokenEnv,omitempty"`
+	// hex-encoded SHA-256 checksum that the downloaded file must have
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// RemoteComponent is a component fetched from a git repository or an OCI registry, which is cached and evaluated as
+// if it were in the components directory.
+type RemoteComponent struct {
+	// name of the component, defaults to the file name of the path without its extension
+	Name string `json:"name,omitempty"`
+	// URL of the git repository that has the component
+	Git string `json:"git,omitempty"`
+	// reference of the OCI artifact that has the component, as <registry>/<repository>:<tag> or
+	// <registry>/<repository>@<digest>
+	OCI string `json:"oci,omitempty"`
+	// path of the component file in the git repository, or title of the layer of the OCI artifact that has it. Other
+	// files in the same directory, or layers of the same artifact, are fetched along with it for relative imports.
+	// required: true
+	Path string `json:"path"`
+	// branch, tag or commit of the git repository, defaults to the default branch
+	Ref string `json:"ref,omitempty"`
+	// name of the environment variable with the bearer token used to fetch the git repository or OCI artifact
+	TokenEnv string `json:"tokenEnv,omitempty"`
+	// hex-encoded SHA-256 checksum that the component file must have. Signatures are not verified, pin a commit or
+	// digest along with the checksum instead.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// HelmChart is a component that renders a Helm chart, with the values of the chart taken from the params of the
+// component.
+type HelmChart struct {
+	// name of the component
+	// required: true
+	Name string `json:"name"`
+	// directory of a local chart relative to the app root, name of the chart in the repository when repo is set, or
+	// an oci:// reference of the chart
+	// required: true
+	Chart string `json:"chart"`
+	// URL of the chart repository
+	Repo string `json:"repo,omitempty"`
+	// version of the chart, required for charts from repositories and OCI registries
+	Version string `json:"version,omitempty"`
+	// release name used to render the chart, defaults to the component name
+	ReleaseName string `json:"releaseName,omitempty"`
+	// namespace used to render the chart, defaults to the default namespace of the environment
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Transformer is a jsonnet function that is applied to every object after components are evaluated.
+type Transformer struct {
+	// name of the transformer
+	// required: true
+	Name string `json:"name"`
+	// jsonnet file relative to the app root that evaluates to a function that accepts an object and returns
+	// the transformed object
+	// required: true
+	File string `json:"file"`
+}
+
+// Generator is a jsonnet function that yields a component for every name listed in a data source.
+type Generator struct {
+	// name of the generator, which is the directory of the components that it generates
+	// required: true
+	Name string `json:"name"`
+	// jsonnet file relative to the app root that evaluates to a function that accepts the name and data of a
+	// generated component and returns its objects
+	// required: true
+	File string `json:"file"`
+	// YAML or JSON file relative to the app root with a list of names, or an object whose keys are the names and
+	// whose values are the data of the generated components
+	// required: true
+	Source string `json:"source"`
+}
+
+// Kustomization is a component that builds a kustomize directory, with the params of the component applied as
+// patches to the objects that the build produces.
+type Kustomization struct {
+	// name of the component
+	// required: true
+	Name string `json:"name"`
+	// directory with a kustomization file relative to the app root, or a remote base URL pinned with a ref query
+	// parameter
+	// required: true
+	Path string `json:"path"`
+}
+
+// EnvironmentMapSpec is the specification of an environment file.
+type EnvironmentMapSpec struct {
+	// set of environments defined by the file
+	// required: true
+	Environments map[string]Environment `json:"environments"`
+}
+
+// QbecEnvironmentMap is a file with environments of an app, referenced by the environmentFiles of qbec.yaml.
+// swagger:model EnvironmentMap
+type QbecEnvironmentMap struct {
+	// object kind
+	// required: true
+	// pattern: ^EnvironmentMap$
+	Kind string `json:"kind"`
+	// requested API version
+	// required: true
+	APIVersion string `json:"apiVersion"`
+	// environment map specification
+	// required: true
+	Spec EnvironmentMapSpec `json:"spec"`
+}
+
+// ComponentDescriptorSpec is the specification of a component descriptor.
+type ComponentDescriptorSpec struct {
+	// description of the component
+	Description string `json:"description,omitempty"`
+	// owners of the component, like team names or email addresses
+	Owners []string `json:"owners,omitempty"`
+	// components whose objects must be applied before the objects of this component, regardless of their kinds
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// namespace of namespaced objects of the component that do not set one, instead of the default namespace of the
+	// environment
+	Namespace string `json:"namespace,omitempty"`
+	// params that must be set for the component in every environment that it is included in, as dotted paths under
+	// the params of the component
+	RequiredParams []string `json:"requiredParams,omitempty"`
+	// JSON schema of the params of the component that the params of every environment are checked against by validate
+	// and param list. Params that the schema does not declare are reported as unknown unless it sets
+	// additionalProperties
+	ParamSchema map[string]interface{} `json:"paramSchema,omitempty"`
+	// tags that select the component with the --component-tag filter
+	Tags []string `json:"tags,omitempty"`
+	// marks the component as deprecated, with a warning whenever it is rendered
+	Deprecated *ComponentDeprecation `json:"deprecated,omitempty"`
+}
+
+// ComponentDeprecation is the deprecation notice of a component.
+type ComponentDeprecation struct {
+	// why the component is deprecated and what to use instead
+	// required: true
+	Message string `json:"message"`
+	// date in YYYY-MM-DD format by which the component is to be removed, validate with --check-sunset fails for the
+	// component after it
+	// pattern: ^[0-9]{4}-[0-9]{2}-[0-9]{2}$
+	Sunset string `json:"sunset,omitempty"`
+}
+
+// QbecComponentDescriptor is the metadata of a component, in a <component>.component.yaml file of the components
+// directory.
+// swagger:model ComponentDescriptor
+type QbecComponentDescriptor struct {
+	// object kind
+	// required: true
+	// pattern: ^ComponentDescriptor$
+	Kind string `json:"kind"`
+	// requested API version
+	// required: true
+	APIVersion string `json:"apiVersion"`
+	// component descriptor specification
+	// required: true
+	Spec ComponentDescriptorSpec `json:"spec"`
+}
+
+// HealthCheck is a user-supplied readiness check for objects of a specific kind.
+type HealthCheck struct {
+	// API group of the object kind, blank for the core group
+	Group string `json:"group,omitempty"`
+	// object kind for which the check is defined
+	// required: true
+	Kind string `json:"kind"`
+	// jsonnet expression evaluated with the server object available as std.extVar('object'). It must return a boolean
+	// or an object with a boolean 'healthy' attribute and an optional 'message' string.
+	// required: true
+	Expression string `json:"expression"`
+}
+
+// Impersonation is the identity under which objects of a component are applied.
+type Impersonation struct {
+	// user to impersonate, use system:serviceaccount:<namespace>:<name> for a service account
+	// required: true
+	User string `json:"user"`
+	// groups to impersonate in addition to the user
+	Groups []string `json:"groups,omitempty"`
+}
+
+// ComponentSpec is the optional configuration for a specific component.
+type ComponentSpec struct {
+	// max time to create/ update all objects of the component as a duration string (e.g. 2m), no limit when not set
+	ApplyTimeout string `json:"applyTimeout,omitempty"`
+	// max time to wait for objects of the component to be ready as a duration string, overrides the wait timeout
+	// specified on the command line
+	WaitTimeout string `json:"waitTimeout,omitempty"`
+	// identity to impersonate when apply creates, updates or garbage collects objects of the component
+	Impersonate *Impersonation `json:"impersonate,omitempty"`
+	// components whose objects must be applied before the objects of this component, regardless of their kinds
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// limits on the evaluation of the component, overriding those of the app
+	EvalLimits *EvalLimits `json:"evalLimits,omitempty"`
+}
+
+// EvalLimits are limits on the evaluation of a jsonnet component, beyond which the evaluation is aborted with an
+// error for the component.
+type EvalLimits struct {
+	// max time to evaluate the component as a duration string (e.g. 30s), no limit when not set
+	Timeout string `json:"timeout,omitempty"`
+	// max memory that the evaluation of the component may allocate as a quantity (e.g. 512Mi), no limit when not set
+	MaxMemory string `json:"maxMemory,omitempty"`
+}
+
+// ChangeLimits are limits on the magnitude of changes made by a single apply, beyond which the apply must be
+// explicitly allowed.
+type ChangeLimits struct {
+	// max number of objects that an apply may delete, no limit when not set
+	// minimum: 1
+	MaxDeletions int `json:"maxDeletions,omitempty"`
+	// max percentage of objects that an apply may create, update or delete, no limit when not set
+	// minimum: 1
+	// maximum: 100
+	MaxChangePercent int `json:"maxChangePercent,omitempty"`
+	// prompt for confirmation instead of failing when a limit is exceeded, the prompt is answered by --yes like any other
+	Confirm bool `json:"confirm,omitempty"`
+}
+
+// Var is the declaration of a variable that is passed to the jsonnet VM.
+type Var struct {
+	// name of the variable
+	Name string `json:"name"`
+	// description of the variable, for documentation
+	Description string `json:"description,omitempty"`
+	// type of the variable, one of "string" (the default) or "code"
+	// pattern: ^(string|code)$
+	Type string `json:"type,omitempty"`
+	// value used when the variable is not supplied, jsonnet code for code variables. Optional variables without a
+	// default are set to an empty string or null
+	Default string `json:"default,omitempty"`
+	// true if the variable must be supplied, rendering fails early when it is missing
+	Required bool `json:"required,omitempty"`
+}
+
+// Vars are the declarations of external and top-level variables of the app.
+type Vars struct {
+	// external variables, supplied using --vm:ext-str and --vm:ext-code
+	External []Var `json:"external,omitempty"`
+	// top-level variables, supplied using --vm:tla-str and --vm:tla-code
+	TopLevel []Var `json:"topLevel,omitempty"`
+}
+
+// SizeBudgets are limits on the serialized size of rendered objects, reported by show --report.
+type SizeBudgets struct {
+	// max size in bytes of a single object, no limit other than those of the cluster when not set
+	// minimum: 1
+	MaxObjectSize int `json:"maxObjectSize,omitempty"`
+	// max size in bytes of all objects of a component, no limit when not set
+	// minimum: 1
+	MaxComponentSize int `json:"maxComponentSize,omitempty"`
+}
+
+// Tombstones configures the recording of objects deleted by garbage collection and the delete command in a config map
+// on the cluster, listed by the deleted command.
+type Tombstones struct {
+	// namespace of the config map, defaults to the default namespace of the environment
+	Namespace string `json:"namespace,omitempty"`
+	// max number of deleted objects that are kept, older ones are dropped first, defaults to 500
+	// minimum: 1
+	MaxEntries int `json:"maxEntries,omitempty"`
+}
+
+// Policy is a rule that validate checks every rendered object against.
+type Policy struct {
+	// name of the policy, used in reports and to set its level for specific environments
+	// required: true
+	Name string `json:"name"`
+	// Rego file (ending in .rego) or jsonnet file relative to the app root. A Rego policy reports violations in the deny and
+	// warn sets of its package, a jsonnet policy evaluates to a function which accepts an object and returns an array of
+	// violation messages or findings with a message and level, empty when the object complies with the policy
+	// required: true
+	File string `json:"file"`
+	// what happens when an object violates the policy, one of "deny" (validate fails, the default) or "warn" (the
+	// violation is reported but validate does not fail)
+	// pattern: ^(deny|warn)$
+	Level string `json:"level,omitempty"`
+	// kinds of objects the policy applies to, all objects when not set
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// KeyProvider is a program that decrypts encrypted property values of the form ENC[<provider>:<base64 ciphertext>].
+type KeyProvider struct {
+	// name of the key provider, used in encrypted values
+	// required: true
+	// pattern: ^[a-zA-Z0-9][a-zA-Z0-9_-]*$
+	Name string `json:"name"`
+	// the program to run and its arguments, which may refer to environment variables as $VAR or ${VAR}. The program
+	// reads the ciphertext from its standard input and writes the decrypted value to its standard output
+	// required: true
+	// min items: 1
+	Command []string `json:"command"`
+}
+
+// ImagePolicy restricts the container images used by objects, checked by validate.
+type ImagePolicy struct {
+	// registries, or registry paths like gcr.io/my-project, that images must be pulled from. Images without a registry
+	// are pulled from docker.io. Images may be pulled from any registry when not set
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// true if images must not use the latest tag, which includes images without a tag or digest
+	ForbidLatest bool `json:"forbidLatest,omitempty"`
+	// true if images must be pinned by digest in all environments
+	RequireDigest bool `json:"requireDigest,omitempty"`
+}
+
+// EnvironmentImagePolicy changes the image policy of the app for a specific environment.
+type EnvironmentImagePolicy struct {
+	// true if images must be pinned by digest in this environment
+	RequireDigest bool `json:"requireDigest,omitempty"`
+	// glob patterns of images that are exempt from the image policy in this environment, like quay.io/vendor/*. A *
+	// does not match a slash
+	Exceptions []string `json:"exceptions,omitempty"`
+}
+
+// KindOrder is the position of objects of a specific kind in the apply order.
+type KindOrder struct {
+	// API group of the object kind, blank for the core group
+	Group string `json:"group,omitempty"`
+	// object kind whose order is set
+	// required: true
+	Kind string `json:"kind"`
+	// the order of the kind, objects with lower orders are applied before, and deleted after, ones with higher orders.
+	// Built-in orders are 10 for pod security policies, 20 for custom resource definitions, 50 for namespaces, 60 for
+	// service accounts and limit ranges, 70 for config maps and secrets, 100 for workloads, 110 for services and 120
+	// for webhook configurations. Other cluster-scoped kinds have order 30 and other namespaced kinds have order 80.
+	// required: true
+	// minimum: 1
+	Order int `json:"order"`
 }
 
 // AppMeta is the simplified metadata object for a qbec app.
@@ -36,16 +431,74 @@ type AppMeta struct {
 type AppSpec struct {
 	// directory containing component files, default to components/
 	ComponentsDir string `json:"componentsDir,omitempty"`
+	// load components from subdirectories of the components directory as well, naming them by their path relative to
+	// it without the extension, such as team-a/service-b
+	NestedComponents bool `json:"nestedComponents,omitempty"`
 	// standard file containing parameters for all environments returning correct values based on qbec.io/env external
 	// variable, defaults to params.libsonnet
 	ParamsFile string `json:"paramsFile,omitempty"`
 	// set of environments for the app
 	// required: true
 	Environments map[string]Environment `json:"environments"`
+	// named groups of environments that can be operated on together, keyed by group name
+	EnvGroups map[string][]string `json:"envGroups,omitempty"`
+	// components fetched from git repositories or OCI registries in addition to those in the components directory
+	RemoteComponents []RemoteComponent `json:"remoteComponents,omitempty"`
+	// components that render Helm charts
+	HelmCharts []HelmChart `json:"helmCharts,omitempty"`
+	// components that build kustomize directories
+	Kustomizations []Kustomization `json:"kustomizations,omitempty"`
+	// jsonnet functions that generate a component for every name in a data source
+	Generators []Generator `json:"generators,omitempty"`
+	// files outside qbec.yaml with additional environments
+	EnvironmentFiles []EnvironmentFile `json:"environmentFiles,omitempty"`
+	// JSON schema of an object that the properties of every environment must conform to when it is evaluated
+	PropertySchema map[string]interface{} `json:"propertySchema,omitempty"`
 	// list of components to exclude by default for every environment
 	Excludes []string `json:"excludes,omitempty"`
 	// list of library paths to add to the jsonnet VM at evaluation
 	LibPaths []string `json:"libPaths,omitempty"`
+	// custom health checks used to determine readiness of objects when waiting, these override built-in checks
+	HealthChecks []HealthCheck `json:"healthChecks,omitempty"`
+	// kinds of objects that are never deleted by garbage collection or the delete command unless protection is
+	// explicitly overridden
+	ProtectedKinds []string `json:"protectedKinds,omitempty"`
+	// kinds of objects that are replaced instead of patched when they change, for very large objects where computing
+	// and applying a three-way merge patch is slow
+	ReplaceKinds []string `json:"replaceKinds,omitempty"`
+	// per-component configuration keyed by component name
+	Components map[string]ComponentSpec `json:"components,omitempty"`
+	// what to do when a component exceeds its timeouts, one of "fail" (stop immediately, the default) or "continue"
+	// (proceed with other components and report the stalled component at the end)
+	// pattern: ^(fail|continue)$
+	TimeoutPolicy string `json:"timeoutPolicy,omitempty"`
+	// limits on the number of objects changed by an apply, to catch catastrophic renders before they reach a cluster
+	ChangeLimits *ChangeLimits `json:"changeLimits,omitempty"`
+	// apply order for kinds of objects, overriding the built-in order of known kinds or placing other kinds at a
+	// specific position
+	ApplyOrder []KindOrder `json:"applyOrder,omitempty"`
+	// regular expressions for sensitive parts of string values that are hidden by show --redact, in addition to
+	// secret values
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+	// declarations of the external and top-level variables of the app
+	Vars *Vars `json:"vars,omitempty"`
+	// jsonnet functions applied in order to every object of every environment after components are evaluated
+	Transformers []Transformer `json:"transformers,omitempty"`
+	// size budgets for objects and components, to catch objects that are too large before they are applied
+	SizeBudgets *SizeBudgets `json:"sizeBudgets,omitempty"`
+	// limits on the evaluation of every jsonnet component, to abort runaway evaluations
+	EvalLimits *EvalLimits `json:"evalLimits,omitempty"`
+	// recording of deleted objects on the cluster, not recorded when not set
+	Tombstones *Tombstones `json:"tombstones,omitempty"`
+	// directories with YAML or JSON files of custom resource definitions, relative to the app root, used by validate
+	// for custom resources whose definitions are not installed on the cluster
+	CRDDirs []string `json:"crdDirs,omitempty"`
+	// policies that validate checks every rendered object against
+	Policies []Policy `json:"policies,omitempty"`
+	// restrictions on the container images used by objects, checked by validate
+	ImagePolicy *ImagePolicy `json:"imagePolicy,omitempty"`
+	// programs that decrypt encrypted values of environment properties when environments are evaluated
+	KeyProviders []KeyProvider `json:"keyProviders,omitempty"`
 }
 
 // QbecApp is a set of components that can be applied to multiple environments with tweaked runtime configurations.
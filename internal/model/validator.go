@@ -19,6 +19,8 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/ghodss/yaml"
@@ -48,6 +50,49 @@ func newValidator() (*validator, error) {
 }
 
 func (v *validator) validateYAML(content []byte) []error {
+	return v.validateYAMLOfKind(content, "App")
+}
+
+// newPropertySchema returns the schema of environment properties declared by the supplied object.
+func newPropertySchema(decl map[string]interface{}) (*spec.Schema, error) {
+	b, err := json.Marshal(decl)
+	if err != nil {
+		return nil, err
+	}
+	var s spec.Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Type) > 0 && !s.Type.Contains("object") {
+		return nil, fmt.Errorf("must be the schema of an object, found type %s", strings.Join(s.Type, ", "))
+	}
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p := s.Properties[name].Pattern; p != "" {
+			if _, err := regexp.Compile(p); err != nil {
+				return nil, fmt.Errorf("property %s: invalid pattern %q", name, p)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// validateProperties validates the supplied environment properties against the supplied schema.
+func validateProperties(s *spec.Schema, props map[string]string) []error {
+	data := map[string]interface{}{}
+	for k, v := range props {
+		data[k] = v
+	}
+	res := validate.NewSchemaValidator(s, nil, "property", strfmt.Default).Validate(data)
+	return res.Errors
+}
+
+// validateYAMLOfKind validates the supplied content as an object of the supplied kind.
+func (v *validator) validateYAMLOfKind(content []byte, expectedKind string) []error {
 	wrap := func(err error) []error {
 		return []error{err}
 	}
@@ -63,8 +108,8 @@ func (v *validator) validateYAML(content []byte) []error {
 	if !ok {
 		return wrap(fmt.Errorf("missing or invalid kind property"))
 	}
-	if kind != "App" {
-		return wrap(fmt.Errorf("bad kind property, expected App"))
+	if kind != expectedKind {
+		return wrap(fmt.Errorf("bad kind property, expected %s", expectedKind))
 	}
 
 	dataType := strings.Replace(apiVersion, "/", ".", -1) + "." + kind
@@ -19,6 +19,7 @@ package objsort
 
 import (
 	"sort"
+	"strings"
 
 	"github.com/splunk/qbec/internal/model"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -34,8 +35,9 @@ type Namespaced func(gvk schema.GroupVersionKind) (namespaced bool, err error)
 // Config is the sort configuration. The ordering provider may be nil if no custom
 // ordering is required.
 type Config struct {
-	OrderingProvider    OrderingProvider // custom ordering provider
-	NamespacedIndicator Namespaced       // indicator to determine if resource sis namespaced
+	OrderingProvider      OrderingProvider    // custom ordering provider
+	NamespacedIndicator   Namespaced          // indicator to determine if resource sis namespaced
+	ComponentDependencies map[string][]string // components that each component depends on, keyed by component name
 }
 
 // ordering for specific classes of objects
@@ -71,6 +73,13 @@ var SpecifiedOrdering = map[schema.GroupKind]int{
 	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:   GenericPodOrder + 20,
 }
 
+// KindOrdering returns an ordering provider that assigns the supplied orders to objects of specific kinds.
+func KindOrdering(orders map[schema.GroupKind]int) OrderingProvider {
+	return func(item model.K8sQbecMeta) int {
+		return orders[item.GetObjectKind().GroupVersionKind().GroupKind()]
+	}
+}
+
 func getOrder(ob model.K8sQbecMeta, config Config) int {
 	order := config.OrderingProvider(ob)
 	if order > 0 {
@@ -91,18 +100,88 @@ func getOrder(ob model.K8sQbecMeta, config Config) int {
 	return GenericClusterObjectOrder
 }
 
+// ComponentDependencies returns the supplied dependencies of components merged with those listed by the component
+// dependency annotation of the supplied objects.
+func ComponentDependencies(objects []model.K8sLocalObject, declared map[string][]string) map[string][]string {
+	ret := map[string][]string{}
+	seen := map[string]map[string]bool{}
+	add := func(component, dep string) {
+		if seen[component] == nil {
+			seen[component] = map[string]bool{}
+		}
+		if !seen[component][dep] {
+			seen[component][dep] = true
+			ret[component] = append(ret[component], dep)
+		}
+	}
+	for component, deps := range declared {
+		for _, d := range deps {
+			add(component, d)
+		}
+	}
+	for _, o := range objects {
+		for _, d := range AnnotatedDependencies(o) {
+			add(o.Component(), d)
+		}
+	}
+	return ret
+}
+
+// AnnotatedDependencies returns the components listed by the component dependency annotation of the supplied object.
+func AnnotatedDependencies(o model.K8sObject) []string {
+	var ret []string
+	for _, d := range strings.Split(o.ToUnstructured().GetAnnotations()[model.QbecNames.ComponentDependsOnAnnotation], ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// ComponentLevels returns the level of every component in the supplied dependencies. Components without
+// dependencies are at level 0 and other components are one level after the highest level of their dependencies,
+// such that objects of a level only depend on components of earlier levels. Dependencies must not have cycles.
+func ComponentLevels(deps map[string][]string) map[string]int {
+	levels := map[string]int{}
+	visiting := map[string]bool{}
+	var level func(c string) int
+	level = func(c string) int {
+		if l, ok := levels[c]; ok {
+			return l
+		}
+		if visiting[c] {
+			return 0
+		}
+		visiting[c] = true
+		l := 0
+		for _, d := range deps[c] {
+			if dl := level(d) + 1; dl > l {
+				l = dl
+			}
+		}
+		levels[c] = l
+		return l
+	}
+	for c := range deps {
+		level(c)
+	}
+	return levels
+}
+
 type sortInput struct {
 	item      interface{}
 	kind      string
 	component string
 	ns        string
 	name      string
+	level     int
 	order     int
 }
 
 type sorter struct {
 	inputs []sortInput
 	config Config
+	levels map[string]int
 }
 
 func newSorter(config Config) *sorter {
@@ -111,6 +190,7 @@ func newSorter(config Config) *sorter {
 	}
 	return &sorter{
 		config: config,
+		levels: ComponentLevels(config.ComponentDependencies),
 	}
 }
 
@@ -121,15 +201,19 @@ func (s *sorter) add(o model.K8sQbecMeta, item interface{}) {
 		component: o.Component(),
 		ns:        o.GetNamespace(),
 		name:      o.GetName(),
+		level:     s.levels[o.Component()],
 		order:     getOrder(o, s.config),
 	})
 }
 
 func (s *sorter) sort() {
 	items := s.inputs
-	sort.Slice(items, func(i, j int) bool {
+	sort.SliceStable(items, func(i, j int) bool {
 		left := items[i]
 		right := items[j]
+		if left.level != right.level {
+			return left.level < right.level
+		}
 		if left.order != right.order {
 			return left.order < right.order
 		}
@@ -160,8 +244,28 @@ func SortMeta(inputs []model.K8sQbecMeta, config Config) []model.K8sQbecMeta {
 	return ret
 }
 
-// Sort sorts the supplied local objects based on the supplied configuration.
+// GroupMeta sorts the supplied meta objects based on the config and returns them in groups of objects that have the
+// same component level and order, such that objects of a group only depend on objects of earlier groups.
+func GroupMeta(inputs []model.K8sQbecMeta, config Config) [][]model.K8sQbecMeta {
+	sorter := newSorter(config)
+	for _, obj := range inputs {
+		sorter.add(obj, obj)
+	}
+	sorter.sort()
+	var ret [][]model.K8sQbecMeta
+	for i, o := range sorter.inputs {
+		if i == 0 || o.level != sorter.inputs[i-1].level || o.order != sorter.inputs[i-1].order {
+			ret = append(ret, nil)
+		}
+		ret[len(ret)-1] = append(ret[len(ret)-1], o.item.(model.K8sQbecMeta))
+	}
+	return ret
+}
+
+// Sort sorts the supplied local objects based on the supplied configuration, taking component dependencies
+// declared by annotations of the objects into account.
 func Sort(inputs []model.K8sLocalObject, config Config) []model.K8sLocalObject {
+	config.ComponentDependencies = ComponentDependencies(inputs, config.ComponentDependencies)
 	sorter := newSorter(config)
 	for _, obj := range inputs {
 		sorter.add(obj, obj)
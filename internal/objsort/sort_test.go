@@ -138,3 +138,118 @@ func TestBasicSortMeta(t *testing.T) {
 	}
 	assert.EqualValues(t, expected, results)
 }
+
+func TestKindOrdering(t *testing.T) {
+	inputs := []model.K8sLocalObject{
+		object(data{"c1", "apps/v1", "Deployment", "operator", "ns1"}),
+		object(data{"c1", "example.com/v1", "Widget", "w1", "ns1"}),
+		object(data{"c1", "v1", "ConfigMap", "cm", "ns1"}),
+		object(data{"c1", "v1", "Namespace", "ns1", ""}),
+	}
+	sorted := Sort(inputs, Config{
+		OrderingProvider: KindOrdering(map[schema.GroupKind]int{
+			{Group: "example.com", Kind: "Widget"}: GenericPodOrder + 5,
+			{Group: "", Kind: "ConfigMap"}:         GenericPodOrder + 10,
+		}),
+		NamespacedIndicator: func(gvk schema.GroupVersionKind) (bool, error) {
+			return gvk.Kind != "Namespace", nil
+		},
+	})
+	var results []string
+	for _, s := range sorted {
+		results = append(results, fmt.Sprintf("%s:%s", s.GetKind(), s.GetName()))
+	}
+	assert.Equal(t, []string{"Namespace:ns1", "Deployment:operator", "Widget:w1", "ConfigMap:cm"}, results)
+}
+
+func TestGroupMeta(t *testing.T) {
+	inputs := []model.K8sQbecMeta{
+		object(data{"c1", "apps/v1", "Deployment", "d2", "c1-ns"}),
+		object(data{"c1", "v1", "ConfigMap", "cm", "c1-ns"}),
+		object(data{"c1", "v1", "Namespace", "c1-ns", ""}),
+		object(data{"c1", "apps/v1", "Deployment", "d1", "c1-ns"}),
+		object(data{"c1", "v1", "Secret", "s", "c1-ns"}),
+	}
+	groups := GroupMeta(inputs, Config{
+		NamespacedIndicator: func(gvk schema.GroupVersionKind) (bool, error) {
+			return gvk.Kind != "Namespace", nil
+		},
+	})
+	var results [][]string
+	for _, g := range groups {
+		var names []string
+		for _, o := range g {
+			names = append(names, fmt.Sprintf("%s:%s", o.GetKind(), o.GetName()))
+		}
+		results = append(results, names)
+	}
+	expected := [][]string{
+		{"Namespace:c1-ns"},
+		{"ConfigMap:cm", "Secret:s"},
+		{"Deployment:d1", "Deployment:d2"},
+	}
+	assert.EqualValues(t, expected, results)
+	assert.Nil(t, GroupMeta(nil, Config{}))
+}
+
+func TestComponentDependencies(t *testing.T) {
+	cr := object(data{"widgets", "example.com/v1", "Widget", "w1", "ns1"})
+	u := cr.ToUnstructured()
+	u.SetAnnotations(map[string]string{model.QbecNames.ComponentDependsOnAnnotation: "operator, crds"})
+	inputs := []model.K8sLocalObject{
+		cr,
+		object(data{"widgets", "v1", "Namespace", "ns1", ""}),
+		object(data{"operator", "apps/v1", "Deployment", "operator", "system"}),
+		object(data{"operator", "v1", "Namespace", "system", ""}),
+		object(data{"crds", "apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com", ""}),
+		object(data{"monitoring", "v1", "ConfigMap", "dashboards", "system"}),
+	}
+	declared := map[string][]string{"operator": {"crds"}, "monitoring": {"widgets"}}
+	deps := ComponentDependencies(inputs, declared)
+	assert.Equal(t, map[string][]string{"operator": {"crds"}, "monitoring": {"widgets"}, "widgets": {"operator", "crds"}}, deps)
+	assert.Equal(t, map[string]int{"crds": 0, "operator": 1, "widgets": 2, "monitoring": 3}, ComponentLevels(deps))
+
+	sorted := Sort(inputs, Config{
+		NamespacedIndicator: func(gvk schema.GroupVersionKind) (bool, error) {
+			return gvk.Kind != "Namespace" && gvk.Kind != "CustomResourceDefinition", nil
+		},
+		ComponentDependencies: declared,
+	})
+	var results []string
+	for _, s := range sorted {
+		results = append(results, fmt.Sprintf("%s:%s", s.GetKind(), s.GetName()))
+	}
+	assert.Equal(t, []string{
+		"CustomResourceDefinition:widgets.example.com",
+		"Namespace:system",
+		"Deployment:operator",
+		"Namespace:ns1",
+		"Widget:w1",
+		"ConfigMap:dashboards",
+	}, results)
+
+	// deletions are grouped by component level using only the dependencies declared in the config, since server
+	// objects do not have annotations
+	var metas []model.K8sQbecMeta
+	for _, o := range inputs {
+		metas = append(metas, o)
+	}
+	groups := GroupMeta(metas, Config{
+		NamespacedIndicator: func(gvk schema.GroupVersionKind) (bool, error) {
+			return gvk.Kind != "Namespace" && gvk.Kind != "CustomResourceDefinition", nil
+		},
+		ComponentDependencies: declared,
+	})
+	var names [][]string
+	for _, g := range groups {
+		var list []string
+		for _, o := range g {
+			list = append(list, o.GetName())
+		}
+		names = append(names, list)
+	}
+	assert.Equal(t, [][]string{
+		{"widgets.example.com"}, {"ns1"}, {"w1"},
+		{"system"}, {"dashboards"}, {"operator"},
+	}, names)
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// this file contains access checks of the identity of the client, made using self subject access reviews.
+
+// CanI returns whether the identity of the client may perform the supplied verb on objects of the supplied kind in
+// the supplied namespace, which is ignored for cluster-scoped kinds. The second return value is the reason the
+// authorizer gave for its decision, if any.
+func (c *Client) CanI(verb string, gvk schema.GroupVersionKind, namespace string) (bool, string, error) {
+	res, err := c.apiResourceFor(gvk)
+	if err != nil {
+		return false, "", err
+	}
+	if !res.Namespaced {
+		namespace = ""
+	}
+	gv := authorizationv1.SchemeGroupVersion
+	rc, err := c.restClientFor(gv)
+	if err != nil {
+		return false, "", err
+	}
+	review := authorizationv1.SelfSubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: gv.String(), Kind: "SelfSubjectAccessReview"},
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     gvk.Group,
+				Version:   gvk.Version,
+				Resource:  res.Name,
+			},
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		return false, "", err
+	}
+	b, err := rc.Post().Resource("selfsubjectaccessreviews").Body(body).Do().Raw()
+	if err != nil {
+		return false, "", errors.Wrap(err, "access review")
+	}
+	var result authorizationv1.SelfSubjectAccessReview
+	if err := json.Unmarshal(b, &result); err != nil {
+		return false, "", errors.Wrap(err, "unmarshal access review")
+	}
+	if result.Status.EvaluationError != "" && !result.Status.Allowed {
+		return false, result.Status.EvaluationError, nil
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
@@ -17,9 +17,13 @@
 package remote
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/jonboulle/clockwork"
@@ -27,18 +31,21 @@ import (
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/sio"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 )
 
 const (
 	identicalObjects = "objects are identical"
 	opUpdate         = "update object"
 	opCreate         = "create object"
+	opReplace        = "replace object"
 )
 
 // structured errors
@@ -46,6 +53,7 @@ var (
 	ErrForbidden        = errors.New("forbidden")             // returned due to an authn/ authz error
 	ErrNotFound         = errors.New("not found")             // returned when a remote object does not exist
 	ErrSchemaNotFound   = errors.New("schema not found")      // returned when a validation schema is not found
+	ErrSyncTimeout      = errors.New("sync timed out")        // returned when a sync does not complete before its deadline
 	errMetadataNotFound = errors.New("server type not found") // returned when metadata could not be found for a gvk
 )
 
@@ -56,8 +64,35 @@ type SyncOptions struct {
 	DryRun        bool // do not actually create or update objects, return what would happen
 	DisableCreate bool // only update objects if they exist, do not create new ones
 	ShowSecrets   bool // show secrets in patches and creations
+	ServerDryRun  bool // in dry-run mode, have the server process creates and updates without persisting them
+	Replace       bool // replace existing objects instead of patching them, failing if they changed since they were read
+	// Annotations are set on objects that are created or updated. They do not cause an update by themselves.
+	Annotations map[string]string
+	// Deadline, when set, cancels all requests of the sync that are in flight or not yet sent at that time. Note that
+	// the server may still apply a change whose request it received before the deadline.
+	Deadline time.Time
 }
 
+// cascade policies for deletions, that control how dependents of deleted objects are deleted
+const (
+	CascadeForeground = "foreground" // the object is deleted after its dependents
+	CascadeBackground = "background" // the object is deleted right away and its dependents after it
+	CascadeOrphan     = "orphan"     // dependents are not deleted
+)
+
+// DeleteOptions provides the caller with options for the delete operation.
+type DeleteOptions struct {
+	DryRun  bool   // do not actually delete objects, return what would happen
+	Cascade string // the cascade policy for dependents, foreground if not set
+}
+
+// CreateDisabled is the detail message of sync results for objects that were not created because creation was
+// disabled.
+const CreateDisabled = "creation disabled due to user request"
+
+// createOnly is the skip reason for existing objects that are never updated.
+var createOnly = fmt.Sprintf("object exists and has the %s annotation", model.QbecNames.CreateOnlyAnnotation)
+
 type internalSyncOptions struct {
 	secretDryRun       bool               // dry-run phase for objects having secrets info
 	pristiner          pristineReadWriter // pristine writer
@@ -67,14 +102,44 @@ type internalSyncOptions struct {
 // Client is a thick remote client that provides high-level operations for commands as opposed to
 // granular ones.
 type Client struct {
-	sm           *ServerMetadata                  // the server metadata loaded once and never updated
-	pool         dynamic.ClientPool               // the client pool for resource interfaces
-	disco        minimalDiscovery                 // the discovery interface
-	defaultNs    string                           // the default namespace to set for namespaced objects that do not define one
-	verbosity    int                              // log verbosity
-	dynamicTypes map[schema.GroupVersionKind]bool // crds seen by this client
+	sm           *ServerMetadata    // the server metadata loaded once and never updated
+	pool         dynamic.ClientPool // the client pool for resource interfaces
+	disco        minimalDiscovery   // the discovery interface
+	defaultNs    string             // the default namespace to set for namespaced objects that do not define one
+	verbosity    int                // log verbosity
+	dynamicTypes *customTypes       // crds seen by this client and the clients derived from it
+	restConfig   *rest.Config       // the REST config for the client, optional
+	readOnly     bool               // reject all changes to the cluster
+	interlock    error              // reject all changes to the cluster with this error when set
+	poolFor      poolProvider       // provides client pools for derived REST configs, optional
+	deadlines    *deadlineState     // the client and context used for syncs with deadlines
+}
+
+// customTypes is the set of custom types installed by CRDs that were synced. It is safe for concurrent use.
+type customTypes struct {
+	l     sync.Mutex
+	types map[schema.GroupVersionKind]bool
 }
 
+func newCustomTypes() *customTypes {
+	return &customTypes{types: map[schema.GroupVersionKind]bool{}}
+}
+
+func (t *customTypes) add(gvk schema.GroupVersionKind) {
+	t.l.Lock()
+	defer t.l.Unlock()
+	t.types[gvk] = true
+}
+
+func (t *customTypes) has(gvk schema.GroupVersionKind) bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.types[gvk]
+}
+
+// poolProvider returns a client pool for the supplied REST config.
+type poolProvider func(conf *rest.Config) dynamic.ClientPool
+
 func newClient(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, ns string, verbosity int) (*Client, error) {
 	sm, err := newServerMetadata(disco, ns, verbosity)
 	if err != nil {
@@ -86,7 +151,8 @@ func newClient(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, ns s
 		disco:        disco,
 		defaultNs:    ns,
 		verbosity:    verbosity,
-		dynamicTypes: map[schema.GroupVersionKind]bool{},
+		dynamicTypes: newCustomTypes(),
+		deadlines:    newDeadlineState(),
 	}
 	return c, nil
 }
@@ -96,6 +162,34 @@ func (c *Client) ServerMetadata() *ServerMetadata {
 	return c.sm
 }
 
+// ServerVersion returns the Kubernetes version of the cluster that this client connects to, of the form 1.27.
+func (c *Client) ServerVersion() (string, error) {
+	disco, ok := c.disco.(discovery.ServerVersionInterface)
+	if !ok {
+		return "", fmt.Errorf("server version not available")
+	}
+	info, err := disco.ServerVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "get server version")
+	}
+	// some providers report minor versions like 27+
+	return fmt.Sprintf("%s.%s", info.Major, strings.TrimSuffix(info.Minor, "+")), nil
+}
+
+// Impersonate returns a client that performs all operations as the supplied user and groups. The returned
+// client shares server metadata and the set of known dynamic types with this client.
+func (c *Client) Impersonate(user string, groups []string) (*Client, error) {
+	if c.restConfig == nil || c.poolFor == nil {
+		return nil, fmt.Errorf("impersonation not supported by this client")
+	}
+	ret := *c
+	ret.restConfig = rest.CopyConfig(c.restConfig)
+	ret.restConfig.Impersonate = rest.ImpersonationConfig{UserName: user, Groups: groups}
+	ret.pool = c.poolFor(ret.restConfig)
+	ret.deadlines = newDeadlineState()
+	return &ret, nil
+}
+
 // Get returns the remote object matching the supplied metadata as an unstructured bag of attributes.
 func (c *Client) Get(obj model.K8sMeta) (*unstructured.Unstructured, error) {
 	rc, err := c.resourceInterfaceWithDefaultNs(obj.GetObjectKind().GroupVersionKind(), obj.GetNamespace())
@@ -128,6 +222,7 @@ type ListQueryConfig struct {
 	ListQueryScope
 	ComponentFilter     model.Filter // filters for object component
 	KindFilter          model.Filter // filters for object kind
+	LabelSelector       string       // additional label selector for objects, in the format of kubectl
 	Concurrency         int          // concurrent queries to execute
 	DisableAllNsQueries bool         // do not perform list queries across namespaces when multiple namespaces in picture
 }
@@ -154,6 +249,23 @@ func (c *Client) ListExtraObjects(ignore []model.K8sQbecMeta, scope ListQueryCon
 		}
 	}
 
+	coll, err := c.listServerObjects(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	baseList := coll.subtract(ignoreCollection).toList()
+	var ret []model.K8sQbecMeta
+	for _, ob := range baseList {
+		if scope.ComponentFilter.ShouldInclude(ob.Component()) {
+			ret = append(ret, ob)
+		}
+	}
+	return ret, nil
+}
+
+// listServerObjects returns a collection of all objects on the server for the supplied scope.
+func (c *Client) listServerObjects(scope ListQueryConfig) (*collection, error) {
 	// handle special cases
 	filterEligibleTypes := func(types []schema.GroupVersionKind) []schema.GroupVersionKind {
 		var ret []schema.GroupVersionKind
@@ -184,15 +296,54 @@ func (c *Client) ListExtraObjects(ignore []model.K8sQbecMeta, scope ListQueryCon
 	if err := ol.serverObjects(coll); err != nil {
 		return nil, err
 	}
+	return coll, nil
+}
 
-	baseList := coll.subtract(ignoreCollection).toList()
-	var ret []model.K8sQbecMeta
-	for _, ob := range baseList {
-		if scope.ComponentFilter.ShouldInclude(ob.Component()) {
-			ret = append(ret, ob)
-		}
+// ObjectHashes provides the render hashes stored on server objects.
+type ObjectHashes interface {
+	// Hash returns the render hash stored on the server for the supplied object or a blank string
+	// if the object does not exist or a hash is not available.
+	Hash(obj model.K8sMeta) string
+	// Exists returns true if the supplied object exists on the server, whether or not it has a render hash.
+	Exists(obj model.K8sMeta) bool
+}
+
+type collectionHashes struct {
+	coll *collection
+}
+
+func (c *collectionHashes) Hash(obj model.K8sMeta) string {
+	key, err := c.coll.keyFor(obj)
+	if err != nil {
+		return ""
 	}
-	return ret, nil
+	ob, ok := c.coll.objects[key].(*basicObject)
+	if !ok {
+		return ""
+	}
+	return ob.hash
+}
+
+func (c *collectionHashes) Exists(obj model.K8sMeta) bool {
+	key, err := c.coll.keyFor(obj)
+	if err != nil {
+		return false
+	}
+	_, ok := c.coll.objects[key]
+	return ok
+}
+
+// RenderHashes returns the render hashes of all objects on the server for the supplied scope.
+func (c *Client) RenderHashes(scope ListQueryConfig) (ObjectHashes, error) {
+	if scope.KindFilter == nil {
+		kf, _ := model.NewKindFilter(nil, nil)
+		scope.KindFilter = kf
+	}
+	coll, err := c.listServerObjects(scope)
+	if err != nil {
+		return nil, err
+	}
+	return &collectionHashes{coll: coll}, nil
 }
 
 type updateResult struct {
@@ -202,6 +353,7 @@ type updateResult struct {
 	Kind         types.PatchType `json:"kind,omitempty"`
 	DisplayPatch string          `json:"patch,omitempty"`
 	patch        []byte
+	conflicts    []FieldConflict
 }
 
 func (u *updateResult) String() string {
@@ -229,10 +381,11 @@ func (u *updateResult) toSyncResult() *SyncResult {
 			Type:    SyncCreated,
 			Details: u.String(),
 		}
-	case u.Operation == opUpdate:
+	case u.Operation == opUpdate || u.Operation == opReplace:
 		return &SyncResult{
-			Type:    SyncUpdated,
-			Details: u.String(),
+			Type:      SyncUpdated,
+			Details:   u.String(),
+			Conflicts: u.conflicts,
 		}
 	default:
 		panic(fmt.Errorf("invalid operation:%s, %v", u.Operation, u))
@@ -257,6 +410,14 @@ const (
 type SyncResult struct {
 	Type    SyncResultType // the result type
 	Details string         // additional details that are safe to print to console (e.g. no secrets)
+	// the live object before a server-side dry-run, nil if the object does not exist. Secrets are hidden unless
+	// they were requested to be shown.
+	Live *unstructured.Unstructured
+	// the object returned by a server-side dry-run, only set when such a dry-run was performed. Secrets are
+	// hidden unless they were requested to be shown.
+	DryRunResult *unstructured.Unstructured
+	// fields changed by an update that were managed on the server by other field managers
+	Conflicts []FieldConflict
 }
 
 func extractCustomTypes(obj model.K8sObject) (schema.GroupVersionKind, error) {
@@ -283,6 +444,10 @@ func extractCustomTypes(obj model.K8sObject) (schema.GroupVersionKind, error) {
 // Sync syncs the local object by either creating a new one or patching an existing one.
 // It does not do anything in dry-run mode. It also does not create new objects if the caller has disabled the feature.
 func (c *Client) Sync(original model.K8sLocalObject, opts SyncOptions) (_ *SyncResult, finalError error) {
+	if !opts.Deadline.IsZero() {
+		return c.syncWithDeadline(original, opts)
+	}
+
 	// set up the pristine strategy.
 	var prw pristineReadWriter = qbecPristine{}
 	sensitive := model.HasSensitiveInfo(original.ToUnstructured())
@@ -309,7 +474,7 @@ func (c *Client) Sync(original model.K8sLocalObject, opts SyncOptions) (_ *SyncR
 		if err != nil {
 			sio.Warnf("error extracting types for custom resource %s, %v\n", original.GetName(), err)
 		} else {
-			c.dynamicTypes[t] = true
+			c.dynamicTypes.add(t)
 		}
 	}
 
@@ -317,6 +482,9 @@ func (c *Client) Sync(original model.K8sLocalObject, opts SyncOptions) (_ *SyncR
 	if err != nil {
 		return nil, err
 	}
+	if opts.DryRun && opts.ServerDryRun {
+		return c.syncWithServerDryRun(original, opts, internal, result)
+	}
 	// exit if we are done
 	if !internal.secretDryRun || opts.DryRun {
 		return result.toSyncResult(), nil
@@ -329,6 +497,42 @@ func (c *Client) Sync(original model.K8sLocalObject, opts SyncOptions) (_ *SyncR
 	return result.toSyncResult(), err
 }
 
+// syncWithServerDryRun returns the supplied result of a client-side dry-run augmented with the live object
+// and the object returned by a server-side dry-run for creates and updates.
+func (c *Client) syncWithServerDryRun(original model.K8sLocalObject, opts SyncOptions, internal internalSyncOptions, result *updateResult) (*SyncResult, error) {
+	ret := result.toSyncResult()
+	if ret.Type != SyncCreated && ret.Type != SyncUpdated {
+		return ret, nil
+	}
+	// the result of a secret dry-run has hidden secrets and cannot be sent to the server
+	actual := result
+	if internal.secretDryRun {
+		internal.secretDryRun = false
+		r, err := c.doSync(original, opts, internal)
+		if err != nil {
+			return nil, err
+		}
+		actual = r
+	}
+	live, err := c.Get(original)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	out, err := c.serverDryRun(original, actual)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.ShowSecrets {
+		if live != nil {
+			live, _ = model.HideSensitiveInfo(live)
+		}
+		out, _ = model.HideSensitiveInfo(out)
+	}
+	ret.Live = live
+	ret.DryRunResult = out
+	return ret, nil
+}
+
 func (c *Client) doSync(original model.K8sLocalObject, opts SyncOptions, internal internalSyncOptions) (*updateResult, error) {
 	gvk := original.GetObjectKind().GroupVersionKind()
 	remObj, objErr := c.Get(original)
@@ -339,7 +543,7 @@ func (c *Client) doSync(original model.K8sLocalObject, opts SyncOptions, interna
 	// treat metadata errors (server type not found) as a "not found" error under the following conditions:
 	// - dry-run mode is active
 	// - a prior custom resource with that GVK has been applied
-	case objErr == errMetadataNotFound && opts.DryRun && c.dynamicTypes[gvk]:
+	case objErr == errMetadataNotFound && opts.DryRun && c.dynamicTypes.has(gvk):
 		break
 	// error but with better message
 	case objErr == errMetadataNotFound && opts.DryRun:
@@ -364,9 +568,14 @@ func (c *Client) doSync(original model.K8sLocalObject, opts SyncOptions, interna
 	// create or update as needed, each of these routines is responsible for correct dry-run handling.
 	var result *updateResult
 	var err error
-	if remObj == nil {
+	switch {
+	case remObj == nil:
 		result, err = c.maybeCreate(obj, opts)
-	} else {
+	case original.ToUnstructured().GetAnnotations()[model.QbecNames.CreateOnlyAnnotation] == "true":
+		return &updateResult{SkipReason: createOnly}, nil
+	case opts.Replace:
+		result, err = c.maybeReplace(original, obj, remObj, opts)
+	default:
 		if internal.secretDryRun {
 			ann := remObj.GetAnnotations()
 			if ann == nil {
@@ -398,11 +607,11 @@ func (c *Client) doSync(original model.K8sLocalObject, opts SyncOptions, interna
 }
 
 // Delete delete the supplied object if it exists. It does not do anything in dry-run mode.
-func (c *Client) Delete(obj model.K8sMeta, dryRun bool) (_ *SyncResult, finalError error) {
+func (c *Client) Delete(obj model.K8sMeta, opts DeleteOptions) (_ *SyncResult, finalError error) {
 	ret := &SyncResult{
 		Type: SyncDeleted,
 	}
-	if dryRun {
+	if opts.DryRun {
 		return ret, nil
 	}
 	defer func() {
@@ -410,6 +619,9 @@ func (c *Client) Delete(obj model.K8sMeta, dryRun bool) (_ *SyncResult, finalErr
 			finalError = errors.Wrap(finalError, "delete "+c.sm.DisplayName(obj))
 		}
 	}()
+	if err := c.checkWritable(); err != nil {
+		return nil, err
+	}
 
 	ri, err := c.resourceInterfaceWithDefaultNs(obj.GetObjectKind().GroupVersionKind(), obj.GetNamespace())
 	if err != nil {
@@ -417,6 +629,12 @@ func (c *Client) Delete(obj model.K8sMeta, dryRun bool) (_ *SyncResult, finalErr
 	}
 
 	pp := metav1.DeletePropagationForeground
+	switch opts.Cascade {
+	case CascadeBackground:
+		pp = metav1.DeletePropagationBackground
+	case CascadeOrphan:
+		pp = metav1.DeletePropagationOrphan
+	}
 	err = ri.Delete(obj.GetName(), &metav1.DeleteOptions{PropagationPolicy: &pp})
 	if err != nil {
 		if apiErrors.IsNotFound(err) {
@@ -434,6 +652,76 @@ func (c *Client) Delete(obj model.K8sMeta, dryRun bool) (_ *SyncResult, finalErr
 	return ret, nil
 }
 
+// UpdateMetadata sets the supplied labels and annotations on the server object using a merge patch, leaving
+// all other fields untouched. It does not do anything in dry-run mode.
+func (c *Client) UpdateMetadata(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (_ *SyncResult, finalError error) {
+	ret := &SyncResult{
+		Type: SyncUpdated,
+	}
+	if dryRun {
+		return ret, nil
+	}
+	defer func() {
+		if finalError != nil {
+			finalError = errors.Wrap(finalError, "update metadata "+c.sm.DisplayName(obj))
+		}
+	}()
+	if err := c.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	meta := map[string]interface{}{}
+	if len(labels) > 0 {
+		meta["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		meta["annotations"] = annotations
+	}
+	b, err := json.Marshal(map[string]interface{}{"metadata": meta})
+	if err != nil {
+		return nil, errors.Wrap(err, "json marshal")
+	}
+	ri, err := c.resourceInterfaceWithDefaultNs(obj.GetObjectKind().GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return nil, errors.Wrap(err, "get resource interface")
+	}
+	if _, err := ri.Patch(obj.GetName(), types.MergePatchType, b); err != nil {
+		if apiErrors.IsNotFound(err) {
+			ret.Type = SyncSkip
+			ret.Details = "object not found on the server"
+			return ret, nil
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListObjects returns all objects of the supplied type in the supplied namespace, regardless of whether they were
+// created by qbec. An empty namespace lists objects across all namespaces.
+func (c *Client) ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	ri, err := c.resourceInterface(gvk, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("get resource interface for %s", gvk))
+	}
+	list, err := ri.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("list %s", gvk))
+	}
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("extract items for %s", gvk))
+	}
+	var ret []*unstructured.Unstructured
+	for _, obj := range objs {
+		un, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("dunno how to process object of type %v", reflect.TypeOf(obj))
+		}
+		ret = append(ret, un)
+	}
+	return ret, nil
+}
+
 func (c *Client) jitResource(gvk schema.GroupVersionKind) (*metav1.APIResource, error) {
 	rl, err := c.disco.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
 	if err != nil {
@@ -478,10 +766,12 @@ func (c *Client) resourceInterfaceWithDefaultNs(gvk schema.GroupVersionKind, nam
 func (c *Client) maybeCreate(obj model.K8sLocalObject, opts SyncOptions) (*updateResult, error) {
 	if opts.DisableCreate {
 		return &updateResult{
-			SkipReason: "creation disabled due to user request",
+			SkipReason: CreateDisabled,
 		}, nil
 	}
-	b, err := json.Marshal(obj)
+	u := obj.ToUnstructured().DeepCopy()
+	addAnnotations(u, opts.Annotations)
+	b, err := json.Marshal(u)
 	if err != nil {
 		return nil, errors.Wrap(err, "json marshal")
 	}
@@ -493,17 +783,83 @@ func (c *Client) maybeCreate(obj model.K8sLocalObject, opts SyncOptions) (*updat
 	if opts.DryRun {
 		return result, nil
 	}
+	if err := c.checkWritable(); err != nil {
+		return nil, err
+	}
 	ri, err := c.resourceInterfaceWithDefaultNs(obj.GetObjectKind().GroupVersionKind(), obj.GetNamespace())
 	if err != nil {
 		return nil, errors.Wrap(err, "get resource interface")
 	}
-	_, err = ri.Create(obj.ToUnstructured())
+	_, err = ri.Create(u)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
+// addAnnotations adds the supplied annotations to the object.
+func addAnnotations(u *unstructured.Unstructured, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	anns := u.GetAnnotations()
+	if anns == nil {
+		anns = map[string]string{}
+	}
+	for k, v := range annotations {
+		anns[k] = v
+	}
+	u.SetAnnotations(anns)
+}
+
+// maybeReplace replaces the remote object with the supplied object, unless the pristine version of the remote
+// object is identical to the original local object. The replacement carries the resource version of the remote
+// object such that it fails if the object was changed on the server after it was read.
+func (c *Client) maybeReplace(original, obj model.K8sLocalObject, remObj *unstructured.Unstructured, opts SyncOptions) (*updateResult, error) {
+	if pristine, _ := getPristineVersion(remObj, false); pristine != nil {
+		lb, err := json.Marshal(original.ToUnstructured())
+		if err != nil {
+			return nil, errors.Wrap(err, "json marshal")
+		}
+		rb, err := json.Marshal(pristine)
+		if err != nil {
+			return nil, errors.Wrap(err, "json marshal")
+		}
+		if bytes.Equal(lb, rb) {
+			return &updateResult{SkipReason: identicalObjects}, nil
+		}
+	}
+	u := obj.ToUnstructured().DeepCopy()
+	addAnnotations(u, opts.Annotations)
+	u.SetResourceVersion(remObj.GetResourceVersion())
+	b, err := json.Marshal(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "json marshal")
+	}
+	result := &updateResult{
+		Operation: opReplace,
+		Source:    "local",
+		patch:     b,
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+	if err := c.checkWritable(); err != nil {
+		return nil, err
+	}
+	ri, err := c.resourceInterfaceWithDefaultNs(obj.GetObjectKind().GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return nil, errors.Wrap(err, "get resource interface")
+	}
+	if _, err := ri.Update(u); err != nil {
+		if apiErrors.IsConflict(err) {
+			return nil, errors.Wrap(err, "object was changed on the server while it was being replaced, retry the apply")
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
 func (c *Client) maybeUpdate(obj model.K8sLocalObject, remObj *unstructured.Unstructured, opts SyncOptions) (*updateResult, error) {
 	res, _, err := c.sm.openAPIResources()
 	if err != nil {
@@ -535,13 +891,36 @@ func (c *Client) maybeUpdate(obj model.K8sLocalObject, remObj *unstructured.Unst
 		overwrite:     true,
 		backOff:       clockwork.NewRealClock(),
 		openAPILookup: lookup,
+		annotations:   opts.Annotations,
 	}
 
-	var result *updateResult
-	if opts.DryRun {
-		result, err = p.getPatchContents(remObj, obj)
-	} else {
-		result, err = p.patch(remObj, obj)
+	// the patch is computed once, and used both to preview the update and to apply it
+	preview, err := p.getPatchContents(remObj, obj)
+	if err != nil {
+		return nil, err
+	}
+	// compute fields changed by the patch that are managed by others before patching, since the patch
+	// updates the managers of these fields.
+	conflicts := fieldConflicts(preview.patch, remObj)
+	if !opts.ShowSecrets && model.HasSensitiveInfo(obj.ToUnstructured()) {
+		for i := range conflicts {
+			conflicts[i].Local, conflicts[i].Live = hiddenValue, hiddenValue
+		}
+	}
+	result := preview
+	if !opts.DryRun {
+		if preview.SkipReason == "" {
+			if err := c.checkWritable(); err != nil {
+				return nil, err
+			}
+		}
+		result, err = p.patch(remObj, obj, preview)
+		if err != nil && len(conflicts) > 0 {
+			return nil, &ConflictError{Err: err, Conflicts: conflicts}
+		}
+	}
+	if result != nil {
+		result.conflicts = conflicts
 	}
 	return result, err
 }
@@ -0,0 +1,447 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+func TestMaybeReplace(t *testing.T) {
+	obj := func(value string) model.K8sLocalObject {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "big", "namespace": "ns1"},
+			"data":       map[string]interface{}{"foo": value, "count": 10},
+		}, "app", "c1", "dev")
+	}
+	live := func(o model.K8sLocalObject) *unstructured.Unstructured {
+		annotated, err := qbecPristine{}.createFromPristine(o)
+		require.Nil(t, err)
+		u := annotated.ToUnstructured()
+		u.SetResourceVersion("42")
+		return u
+	}
+	c := &Client{}
+	a := assert.New(t)
+
+	original := obj("bar")
+	local, err := qbecPristine{}.createFromPristine(original)
+	require.Nil(t, err)
+	res, err := c.maybeReplace(original, local, live(obj("bar")), SyncOptions{DryRun: true, Replace: true})
+	require.Nil(t, err)
+	a.Equal(SyncObjectsIdentical, res.toSyncResult().Type)
+
+	res, err = c.maybeReplace(original, local, live(obj("baz")), SyncOptions{DryRun: true, Replace: true})
+	require.Nil(t, err)
+	a.Equal(opReplace, res.Operation)
+	a.Equal(SyncUpdated, res.toSyncResult().Type)
+	a.Contains(string(res.patch), `"resourceVersion":"42"`)
+	a.Contains(string(res.patch), `"foo":"bar"`)
+
+	unmanaged := obj("baz").ToUnstructured()
+	res, err = c.maybeReplace(original, local, unmanaged, SyncOptions{DryRun: true, Replace: true})
+	require.Nil(t, err)
+	a.Equal(opReplace, res.Operation)
+}
+
+func TestRenderHash(t *testing.T) {
+	obj := func(value interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "cm", "namespace": "ns1"},
+			"data":       map[string]interface{}{"foo": value},
+		}, "app", "c1", "dev")
+	}
+	a := assert.New(t)
+	h1, err := RenderHash(obj("bar"))
+	require.Nil(t, err)
+	h2, err := RenderHash(obj("bar"))
+	require.Nil(t, err)
+	h3, err := RenderHash(obj("baz"))
+	require.Nil(t, err)
+	a.Equal(h1, h2)
+	a.NotEqual(h1, h3)
+
+	_, err = RenderHash(obj(math.NaN()))
+	require.NotNil(t, err)
+	a.Contains(err.Error(), "render hash JSON marshal")
+}
+
+// patchedConfigMap returns a config map with the supplied data value annotated with its pristine version.
+func patchedConfigMap(t *testing.T, value string) model.K8sLocalObject {
+	o := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "cm", "namespace": "ns1"},
+		"data":       map[string]interface{}{"foo": value},
+	}, "app", "c1", "dev")
+	annotated, err := qbecPristine{}.createFromPristine(o)
+	require.Nil(t, err)
+	return annotated
+}
+
+func pristineConfig(obj *unstructured.Unstructured) ([]byte, error) {
+	pristine, _ := getPristineVersion(obj, false)
+	return json.Marshal(pristine)
+}
+
+func TestPatchAnnotations(t *testing.T) {
+	obj := func(value string) model.K8sLocalObject { return patchedConfigMap(t, value) }
+	p := patcher{
+		cfgProvider: pristineConfig,
+		overwrite:   true,
+		annotations: map[string]string{"qbec.io/run-url": "https://ci/run/1"},
+	}
+	a := assert.New(t)
+	live := obj("bar").ToUnstructured()
+
+	res, err := p.getPatchContents(live, obj("bar"))
+	require.Nil(t, err)
+	a.Equal(identicalObjects, res.SkipReason)
+
+	res, err = p.getPatchContents(live, obj("baz"))
+	require.Nil(t, err)
+	var patch map[string]interface{}
+	require.Nil(t, json.Unmarshal(res.patch, &patch))
+	a.Equal(map[string]interface{}{"foo": "baz"}, patch["data"])
+	anns := patch["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	a.Equal("https://ci/run/1", anns["qbec.io/run-url"])
+}
+
+func TestPatchWithContents(t *testing.T) {
+	live := patchedConfigMap(t, "bar").ToUnstructured()
+	res := &fakeResources{objects: map[string]*unstructured.Unstructured{"cm": live}}
+	computed := 0
+	p := patcher{
+		provider: func(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+			return res, nil
+		},
+		cfgProvider: func(obj *unstructured.Unstructured) ([]byte, error) {
+			computed++
+			return pristineConfig(obj)
+		},
+		overwrite: true,
+	}
+	desired := patchedConfigMap(t, "baz")
+	contents, err := p.getPatchContents(live, desired)
+	require.Nil(t, err)
+	result, err := p.patch(live, desired, contents)
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(1, computed)
+	a.Equal(contents, result)
+	a.Equal([]string{"cm"}, res.patched)
+}
+
+type recordingTransport struct {
+	requests int
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests++
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+func TestReadOnlyTransport(t *testing.T) {
+	var rec recordingTransport
+	rt := wrapReadOnly(nil, nil)(&rec)
+	tests := []struct {
+		method string
+		url    string
+		safe   bool
+	}{
+		{http.MethodGet, "https://k8s/api/v1/namespaces/ns1/configmaps", true},
+		{http.MethodHead, "https://k8s/api/v1", true},
+		{http.MethodPost, "https://k8s/api/v1/namespaces/ns1/configmaps?dryRun=All", true},
+		{http.MethodPatch, "https://k8s/api/v1/namespaces/ns1/configmaps/cm1?dryRun=All", true},
+		{http.MethodPost, "https://k8s/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", true},
+		{http.MethodPost, "https://k8s/apis/authorization.k8s.io/v1/selfsubjectrulesreviews", true},
+		{http.MethodPost, "https://k8s/apis/authentication.k8s.io/v1/tokenreviews", true},
+		{http.MethodPost, "https://rancher/k8s/clusters/c-abc12/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", true},
+		{http.MethodPost, "https://rancher/k8s/clusters/c-abc12/apis/authorization.k8s.io/v1/subjectaccessreviews", false},
+		{http.MethodPut, "https://k8s/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", false},
+		{http.MethodPost, "https://k8s/apis/authorization.k8s.io/v1/subjectaccessreviews", false},
+		{http.MethodPost, "https://k8s/api/v1/namespaces/ns1/services/s1/proxy/apis/authentication.k8s.io/v1/tokenreviews", false},
+		{http.MethodPost, "https://k8s/api/v1/namespaces/ns1/configmaps", false},
+		{http.MethodPut, "https://k8s/api/v1/namespaces/ns1/configmaps/cm1", false},
+		{http.MethodPatch, "https://k8s/api/v1/namespaces/ns1/configmaps/cm1", false},
+		{http.MethodDelete, "https://k8s/api/v1/namespaces/ns1/configmaps/cm1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.url, func(t *testing.T) {
+			rec.requests = 0
+			req, err := http.NewRequest(test.method, test.url, nil)
+			require.Nil(t, err)
+			_, err = rt.RoundTrip(req)
+			if test.safe {
+				require.Nil(t, err)
+				assert.Equal(t, 1, rec.requests)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Equal(t, ErrReadOnly, errors.Cause(err))
+			assert.Equal(t, 0, rec.requests)
+		})
+	}
+}
+
+func TestReadOnlyAccessReview(t *testing.T) {
+	var reviews int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reviews++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"SelfSubjectAccessReview","apiVersion":"authorization.k8s.io/v1","status":{"allowed":true}}`))
+	}))
+	defer srv.Close()
+
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	ie := &InterlockError{Env: "prod", Reasons: []string{"context mismatch"}}
+	for _, reason := range []error{nil, ie} {
+		reviews = 0
+		c := &Client{
+			sm: &ServerMetadata{
+				registry: map[schema.GroupVersionKind]*gvkInfo{
+					gvk: {canonical: gvk, resource: metav1.APIResource{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"}},
+				},
+			},
+			restConfig: &rest.Config{Host: srv.URL, WrapTransport: wrapReadOnly(nil, reason)},
+			readOnly:   reason == nil,
+			interlock:  reason,
+		}
+		allowed, _, err := c.CanI("update", gvk, "ns1")
+		require.Nil(t, err)
+		assert.True(t, allowed)
+		assert.Equal(t, 1, reviews)
+	}
+}
+
+func TestReadOnlyClient(t *testing.T) {
+	c := &Client{readOnly: true}
+	_, err := c.maybeCreate(model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "cm1"},
+	}, "app", "c1", "dev"), SyncOptions{})
+	require.NotNil(t, err)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Nil(t, (&Client{}).checkWritable())
+}
+
+type fakeResources struct {
+	dynamic.ResourceInterface
+	objects map[string]*unstructured.Unstructured
+	created []string
+	patched []string
+}
+
+func (f *fakeResources) Get(name string, opts metav1.GetOptions) (*unstructured.Unstructured, error) {
+	u, ok := f.objects[name]
+	if !ok {
+		return nil, apiErrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return u, nil
+}
+
+func (f *fakeResources) Create(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	f.created = append(f.created, obj.GetName())
+	return obj, nil
+}
+
+func (f *fakeResources) Patch(name string, pt types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	f.patched = append(f.patched, name)
+	return f.objects[name], nil
+}
+
+type fakePool struct {
+	dynamic.Interface
+	res *fakeResources
+}
+
+func (p *fakePool) ClientForGroupVersionResource(resource schema.GroupVersionResource) (dynamic.Interface, error) {
+	return p, nil
+}
+
+func (p *fakePool) ClientForGroupVersionKind(kind schema.GroupVersionKind) (dynamic.Interface, error) {
+	return p, nil
+}
+
+func (p *fakePool) Resource(resource *metav1.APIResource, namespace string) dynamic.ResourceInterface {
+	return p.res
+}
+
+func TestSyncCreateOnly(t *testing.T) {
+	obj := func(name string, value string, annotations map[string]interface{}) model.K8sLocalObject {
+		return model.NewK8sLocalObject(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "ns1", "annotations": annotations},
+			"data":       map[string]interface{}{"foo": value},
+		}, "app", "c1", "dev")
+	}
+	createOnlyAnnotation := func(value string) map[string]interface{} {
+		return map[string]interface{}{model.QbecNames.CreateOnlyAnnotation: value}
+	}
+	newClient := func(existing ...string) (*Client, *fakeResources) {
+		res := &fakeResources{objects: map[string]*unstructured.Unstructured{}}
+		for _, name := range existing {
+			annotated, err := qbecPristine{}.createFromPristine(obj(name, "old", nil))
+			require.Nil(t, err)
+			res.objects[name] = annotated.ToUnstructured()
+		}
+		gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+		sm := &ServerMetadata{
+			registry: map[schema.GroupVersionKind]*gvkInfo{
+				gvk: {canonical: gvk, resource: metav1.APIResource{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"}},
+			},
+			defaultNs: "ns1",
+			oResult:   &openapiResourceResult{},
+		}
+		return &Client{
+			sm:           sm,
+			pool:         &fakePool{res: res},
+			defaultNs:    "ns1",
+			dynamicTypes: newCustomTypes(),
+		}, res
+	}
+
+	t.Run("existing", func(t *testing.T) {
+		c, res := newClient("cm1")
+		result, err := c.Sync(obj("cm1", "new", createOnlyAnnotation("true")), SyncOptions{})
+		require.Nil(t, err)
+		assert.Equal(t, SyncSkip, result.Type)
+		assert.Equal(t, createOnly, result.Details)
+		assert.Empty(t, res.created)
+		assert.Empty(t, res.patched)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		c, res := newClient()
+		result, err := c.Sync(obj("cm1", "new", createOnlyAnnotation("true")), SyncOptions{})
+		require.Nil(t, err)
+		assert.Equal(t, SyncCreated, result.Type)
+		assert.Equal(t, []string{"cm1"}, res.created)
+		assert.Empty(t, res.patched)
+	})
+
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+	}{
+		{"false", createOnlyAnnotation("false")},
+		{"not-annotated", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, res := newClient("cm1")
+			result, err := c.Sync(obj("cm1", "new", test.annotations), SyncOptions{})
+			require.Nil(t, err)
+			assert.Equal(t, SyncUpdated, result.Type)
+			assert.Empty(t, res.created)
+			assert.Equal(t, []string{"cm1"}, res.patched)
+		})
+	}
+}
+
+func TestSyncDeadline(t *testing.T) {
+	var slow, created int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&slow) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+		atomic.AddInt32(&created, 1)
+		b, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	var pools int
+	c := &Client{
+		sm: &ServerMetadata{
+			registry: map[schema.GroupVersionKind]*gvkInfo{
+				gvk: {canonical: gvk, resource: metav1.APIResource{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"}},
+			},
+			defaultNs: "ns1",
+			oResult:   &openapiResourceResult{},
+		},
+		pool:         dynamic.NewDynamicClientPool(&rest.Config{Host: srv.URL}),
+		defaultNs:    "ns1",
+		dynamicTypes: newCustomTypes(),
+		restConfig:   &rest.Config{Host: srv.URL},
+		poolFor: func(conf *rest.Config) dynamic.ClientPool {
+			pools++
+			return dynamic.NewDynamicClientPool(conf)
+		},
+		deadlines: newDeadlineState(),
+	}
+	obj := model.NewK8sLocalObject(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "cm1", "namespace": "ns1"},
+	}, "app", "c1", "dev")
+
+	res, err := c.Sync(obj, SyncOptions{Deadline: time.Now().Add(5 * time.Second)})
+	require.Nil(t, err)
+	assert.Equal(t, SyncCreated, res.Type)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&created))
+
+	atomic.StoreInt32(&slow, 1)
+	start := time.Now()
+	_, err = c.Sync(obj, SyncOptions{Deadline: time.Now().Add(50 * time.Millisecond)})
+	require.NotNil(t, err)
+	assert.Equal(t, ErrSyncTimeout, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&created))
+	assert.Equal(t, 1, pools)
+
+	_, err = (&Client{}).Sync(obj, SyncOptions{Deadline: time.Now().Add(time.Second)})
+	require.NotNil(t, err)
+	assert.Equal(t, "deadlines not supported by this client", err.Error())
+}
@@ -34,6 +34,8 @@ type basicObject struct {
 	app       string
 	component string
 	env       string
+	hash      string
+	anns      map[string]string // annotations of the live object that commands need, see retainedAnnotations
 }
 
 func (b *basicObject) GetObjectKind() schema.ObjectKind                { return b }
@@ -47,6 +49,10 @@ func (b *basicObject) Application() string                             { return
 func (b *basicObject) Component() string                               { return b.component }
 func (b *basicObject) Environment() string                             { return b.env }
 
+// GetAnnotations returns the deploy details and deletion protection annotations of the object. Other annotations
+// are not retained.
+func (b *basicObject) GetAnnotations() map[string]string { return b.anns }
+
 type collectMetadata interface {
 	IsNamespaced(gvk schema.GroupVersionKind) (bool, error)
 	canonicalGroupVersionKind(in schema.GroupVersionKind) (schema.GroupVersionKind, error)
@@ -108,16 +114,17 @@ func (c *collection) stats() collectionStats {
 	return ret
 }
 
-// add adds the supplied object potentially transforming its gvk to its canonical form.
-func (c *collection) add(object model.K8sQbecMeta) error {
+// keyFor returns the key for the supplied object, transforming its gvk to its canonical form and setting the
+// namespace as needed.
+func (c *collection) keyFor(object model.K8sMeta) (objectKey, error) {
 	gvk := object.GetObjectKind().GroupVersionKind()
 	canonicalGVK, err := c.meta.canonicalGroupVersionKind(gvk)
 	if err != nil {
-		return err
+		return objectKey{}, err
 	}
 	namespaced, err := c.meta.IsNamespaced(canonicalGVK)
 	if err != nil {
-		return err
+		return objectKey{}, err
 	}
 	ns := object.GetNamespace()
 	if namespaced {
@@ -127,10 +134,18 @@ func (c *collection) add(object model.K8sQbecMeta) error {
 	} else {
 		ns = ""
 	}
-	key := objectKey{
+	return objectKey{
 		gvk:       canonicalGVK,
 		namespace: ns,
 		name:      object.GetName(),
+	}, nil
+}
+
+// add adds the supplied object potentially transforming its gvk to its canonical form.
+func (c *collection) add(object model.K8sQbecMeta) error {
+	key, err := c.keyFor(object)
+	if err != nil {
+		return err
 	}
 	resultObject := &basicObject{
 		objectKey: key,
@@ -19,25 +19,44 @@ package remote
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/sio"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // inspired by the config code in ksonnet but implemented differently.
 
 // ConnectOpts are the connection options required for the config.
 type ConnectOpts struct {
-	EnvName   string // environment name, display purposes only
-	ServerURL string // the server URL to connect to, must be configured in the kubeconfig
-	Namespace string // the default namespace to set for the context
-	Verbosity int    // verbosity of client interactions
+	EnvName        string // environment name, display purposes only
+	ServerURL      string // the server URL to connect to, must be configured in the kubeconfig
+	Context        string // the kubeconfig context to use instead of the one for the server URL
+	ContextPattern string // regular expression matching the single kubeconfig context to use instead of the server URL
+	Namespace      string // the default namespace to set for the context
+	Verbosity      int    // verbosity of client interactions
+	ReadOnly       bool   // reject all requests that can change objects on the server
+	// expectations of the kubeconfig, all requests that can change objects on the server are rejected when they are not
+	// met
+	Interlock    *model.EnvironmentInterlock
+	ForceContext bool // allow changes even when the interlock expectations are not met
+}
+
+// ResolvedContext is the kubeconfig context and cluster that connection options resolve to.
+type ResolvedContext struct {
+	Context   string `json:"context"`   // the context name, blank when no context uses the cluster
+	Cluster   string `json:"cluster"`   // the cluster name
+	ServerURL string `json:"serverURL"` // the server URL of the cluster
 }
 
 // Config provides clients for specific contexts out of a kubeconfig file, with overrides for auth.
@@ -67,52 +86,151 @@ func NewConfig(cmd *cobra.Command, prefix string) *Config {
 	}
 }
 
-func (c *Config) getRESTConfig(opts ConnectOpts) (*rest.Config, error) {
-	if c.kubeconfig == nil {
-		c.kubeconfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c.loadingRules, c.overrides)
-	}
-	if err := c.overrideCluster(c.kubeconfig, opts); err != nil {
-		return nil, err
+// getRESTConfig returns the REST config for the supplied options and the interlock error for them, if any.
+func (c *Config) getRESTConfig(opts ConnectOpts) (*rest.Config, *InterlockError, error) {
+	interlock, err := c.overrideCluster(opts)
+	if err != nil {
+		return nil, nil, err
 	}
 	restConfig, err := c.kubeconfig.ClientConfig()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return restConfig, nil
+	return restConfig, interlock, nil
 }
 
-func (c *Config) overrideCluster(kc clientcmd.ClientConfig, opts ConnectOpts) error {
-	rc, err := kc.RawConfig()
-	if err != nil {
-		return errors.Wrap(err, "raw Config from kubeconfig")
+// resolveContext returns the context and cluster of the supplied kubeconfig that the supplied options resolve to.
+func resolveContext(rc clientcmdapi.Config, opts ConnectOpts) (*ResolvedContext, error) {
+	var contextNames []string
+	for name := range rc.Contexts {
+		contextNames = append(contextNames, name)
+	}
+	sort.Strings(contextNames)
+	fromContext := func(name string) (*ResolvedContext, error) {
+		cluster := rc.Contexts[name].Cluster
+		info, ok := rc.Clusters[cluster]
+		if !ok {
+			return nil, fmt.Errorf("no cluster %q found for context %s (for env %s) in the kube config", cluster, name, opts.EnvName)
+		}
+		return &ResolvedContext{Context: name, Cluster: cluster, ServerURL: info.Server}, nil
+	}
+	switch {
+	case opts.Context != "":
+		if _, ok := rc.Contexts[opts.Context]; !ok {
+			return nil, fmt.Errorf("unable to find context %q (for env %s) in the kube config", opts.Context, opts.EnvName)
+		}
+		return fromContext(opts.Context)
+	case opts.ContextPattern != "":
+		re, err := regexp.Compile(opts.ContextPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "context pattern for env %s", opts.EnvName)
+		}
+		var matched []string
+		for _, name := range contextNames {
+			if re.MatchString(name) {
+				matched = append(matched, name)
+			}
+		}
+		switch len(matched) {
+		case 0:
+			return nil, fmt.Errorf("unable to find any context matching %q (for env %s) in the kube config", opts.ContextPattern, opts.EnvName)
+		case 1:
+			return fromContext(matched[0])
+		default:
+			return nil, fmt.Errorf("context pattern %q (for env %s) matches multiple contexts: %s", opts.ContextPattern, opts.EnvName, strings.Join(matched, ", "))
+		}
 	}
 	for name, cluster := range rc.Clusters {
 		if cluster.Server == opts.ServerURL {
-			sio.Noticeln("setting cluster to", name)
-			c.overrides.Context.Cluster = name
-			c.overrides.Context.Namespace = opts.Namespace
-			for contextName, ctx := range rc.Contexts {
-				if ctx.Cluster == name {
-					sio.Noticeln("setting context to", contextName)
-					c.overrides.CurrentContext = contextName
+			ret := &ResolvedContext{Cluster: name, ServerURL: cluster.Server}
+			for _, contextName := range contextNames {
+				if rc.Contexts[contextName].Cluster == name {
+					ret.Context = contextName
+					break
 				}
 			}
-			return nil
+			return ret, nil
 		}
 	}
-	return fmt.Errorf("unable to find any cluster with URL %q  (for env %s) in the kube config", opts.ServerURL, opts.EnvName)
+	return nil, fmt.Errorf("unable to find any cluster with URL %q  (for env %s) in the kube config", opts.ServerURL, opts.EnvName)
+}
+
+func (c *Config) loadKubeconfig() (clientcmdapi.Config, error) {
+	if c.kubeconfig == nil {
+		c.kubeconfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c.loadingRules, c.overrides)
+	}
+	rc, err := c.kubeconfig.RawConfig()
+	if err != nil {
+		return rc, errors.Wrap(err, "raw Config from kubeconfig")
+	}
+	return rc, nil
+}
+
+// overrideCluster points the kubeconfig to the context that the supplied options resolve to and returns the interlock
+// error for the options, if any. With the force context option, interlock failures are only reported as warnings.
+func (c *Config) overrideCluster(opts ConnectOpts) (*InterlockError, error) {
+	rc, err := c.loadKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := resolveContext(rc, opts)
+	if err != nil {
+		return nil, err
+	}
+	interlock, err := checkInterlock(rc, resolved, opts.EnvName, opts.Interlock)
+	if err != nil {
+		return nil, err
+	}
+	if interlock != nil {
+		if opts.ForceContext {
+			sio.Warnf("context interlock for environment %s: %s, allowing changes since --force-context is set\n",
+				opts.EnvName, strings.Join(interlock.Reasons, "; "))
+			interlock = nil
+		} else {
+			sio.Warnln(interlock.Error())
+		}
+	}
+	sio.Noticeln("setting cluster to", resolved.Cluster)
+	c.overrides.Context.Cluster = resolved.Cluster
+	c.overrides.Context.Namespace = opts.Namespace
+	if resolved.Context != "" {
+		sio.Noticeln("setting context to", resolved.Context)
+	}
+	c.overrides.CurrentContext = resolved.Context
+	return interlock, nil
+}
+
+// ResolveContext returns the kubeconfig context and cluster that the supplied connection options resolve to, without
+// connecting to the server.
+func (c *Config) ResolveContext(opts ConnectOpts) (*ResolvedContext, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	rc, err := c.loadKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	return resolveContext(rc, opts)
 }
 
 // Client returns a client that correctly points to the server as specified in the connection options.
 // For this to work correctly, the kubernetes config that is used *must* have a cluster that has the supplied
-// server URL as an endpoint, so that correct TLS certs are used for authenticating the server.
+// server URL as an endpoint, or the context named or matched by the options, so that correct TLS certs are used for
+// authenticating the server.
 func (c *Config) Client(opts ConnectOpts) (*Client, error) {
 	c.l.Lock()
 	defer c.l.Unlock()
-	conf, err := c.getRESTConfig(opts)
+	conf, interlock, err := c.getRESTConfig(opts)
 	if err != nil {
 		return nil, err
 	}
+	// use a stable user agent such that the server tracks fields changed by qbec under a known field manager
+	conf.UserAgent = FieldManager
+	switch {
+	case opts.ReadOnly:
+		conf.WrapTransport = wrapReadOnly(conf.WrapTransport, nil)
+	case interlock != nil:
+		conf.WrapTransport = wrapReadOnly(conf.WrapTransport, interlock)
+	}
 
 	disco, err := discovery.NewDiscoveryClientForConfig(conf)
 	if err != nil {
@@ -123,7 +241,19 @@ func (c *Config) Client(opts ConnectOpts) (*Client, error) {
 	mapper := discovery.NewDeferredDiscoveryRESTMapper(discoCache, dynamic.VersionInterfaces)
 	pathResolver := dynamic.LegacyAPIPathResolverFunc
 	pool := dynamic.NewClientPool(conf, mapper, pathResolver)
-	return newClient(pool, disco, opts.Namespace, opts.Verbosity)
+	client, err := newClient(pool, disco, opts.Namespace, opts.Verbosity)
+	if err != nil {
+		return nil, err
+	}
+	client.restConfig = conf
+	client.readOnly = opts.ReadOnly
+	if interlock != nil {
+		client.interlock = interlock
+	}
+	client.poolFor = func(conf *rest.Config) dynamic.ClientPool {
+		return dynamic.NewClientPool(conf, mapper, pathResolver)
+	}
+	return client, nil
 }
 
 // ContextInfo has information we care about a K8s context
@@ -0,0 +1,118 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func testKubeconfig() clientcmdapi.Config {
+	return clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"dev-cluster":     {Server: "https://dev-server"},
+			"prod-us-cluster": {Server: "https://prod-us-server"},
+			"prod-eu-cluster": {Server: "https://prod-eu-server"},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"dev":      {Cluster: "dev-cluster"},
+			"prod-us":  {Cluster: "prod-us-cluster"},
+			"prod-eu":  {Cluster: "prod-eu-cluster"},
+			"orphaned": {Cluster: "gone"},
+		},
+	}
+}
+
+func TestResolveContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ConnectOpts
+		expected ResolvedContext
+	}{
+		{
+			name:     "server",
+			opts:     ConnectOpts{ServerURL: "https://prod-eu-server"},
+			expected: ResolvedContext{Context: "prod-eu", Cluster: "prod-eu-cluster", ServerURL: "https://prod-eu-server"},
+		},
+		{
+			name:     "context",
+			opts:     ConnectOpts{Context: "dev"},
+			expected: ResolvedContext{Context: "dev", Cluster: "dev-cluster", ServerURL: "https://dev-server"},
+		},
+		{
+			name:     "pattern",
+			opts:     ConnectOpts{ContextPattern: "^prod-u"},
+			expected: ResolvedContext{Context: "prod-us", Cluster: "prod-us-cluster", ServerURL: "https://prod-us-server"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc, err := resolveContext(testKubeconfig(), test.opts)
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, *rc)
+		})
+	}
+}
+
+func TestResolveContextNegative(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ConnectOpts
+		errorMsg string
+	}{
+		{
+			name:     "no server",
+			opts:     ConnectOpts{EnvName: "e", ServerURL: "https://other"},
+			errorMsg: `unable to find any cluster with URL "https://other"  (for env e) in the kube config`,
+		},
+		{
+			name:     "no context",
+			opts:     ConnectOpts{EnvName: "e", Context: "stage"},
+			errorMsg: `unable to find context "stage" (for env e) in the kube config`,
+		},
+		{
+			name:     "no cluster",
+			opts:     ConnectOpts{EnvName: "e", Context: "orphaned"},
+			errorMsg: `no cluster "gone" found for context orphaned (for env e) in the kube config`,
+		},
+		{
+			name:     "no match",
+			opts:     ConnectOpts{EnvName: "e", ContextPattern: "^stage"},
+			errorMsg: `unable to find any context matching "^stage" (for env e) in the kube config`,
+		},
+		{
+			name:     "multiple matches",
+			opts:     ConnectOpts{EnvName: "e", ContextPattern: "^prod-"},
+			errorMsg: `context pattern "^prod-" (for env e) matches multiple contexts: prod-eu, prod-us`,
+		},
+		{
+			name:     "bad pattern",
+			opts:     ConnectOpts{EnvName: "e", ContextPattern: "("},
+			errorMsg: `context pattern for env e`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolveContext(testKubeconfig(), test.opts)
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), test.errorMsg)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// number of times a config map that qbec records data in is updated when it is changed concurrently
+const configMapAttempts = 3
+
+var configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+// updateConfigMapData sets the value of the supplied key in the config map with the supplied namespace and name to
+// the value returned by the update function for its current value, creating the config map if needed. Updates that
+// conflict with concurrent changes are retried with the new value.
+func (c *Client) updateConfigMapData(namespace, name, key string, update func(existing string) (string, error)) error {
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+	ri, err := c.resourceInterface(configMapGVK, namespace)
+	if err != nil {
+		return errors.Wrap(err, "get resource interface")
+	}
+	var lastErr error
+	for i := 0; i < configMapAttempts; i++ {
+		u, err := ri.Get(name, metav1.GetOptions{})
+		if err != nil && !apiErrors.IsNotFound(err) {
+			return err
+		}
+		if err != nil {
+			data, err := update("")
+			if err != nil {
+				return err
+			}
+			u = &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"namespace": namespace, "name": name},
+				"data":       map[string]interface{}{key: data},
+			}}
+			_, lastErr = ri.Create(u)
+			if lastErr == nil || !apiErrors.IsAlreadyExists(lastErr) {
+				return lastErr
+			}
+			continue
+		}
+		existing, _, _ := unstructured.NestedString(u.Object, "data", key)
+		data, err := update(existing)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(u.Object, data, "data", key); err != nil {
+			return err
+		}
+		_, lastErr = ri.Update(u)
+		if lastErr == nil || !apiErrors.IsConflict(lastErr) {
+			return lastErr
+		}
+	}
+	return errors.Wrap(lastErr, fmt.Sprintf("update %s in %s/%s", key, namespace, name))
+}
+
+// configMapData returns the value of the supplied key in the config map with the supplied namespace and name, or an
+// empty string if the config map does not exist.
+func (c *Client) configMapData(namespace, name, key string) (string, error) {
+	ri, err := c.resourceInterface(configMapGVK, namespace)
+	if err != nil {
+		return "", errors.Wrap(err, "get resource interface")
+	}
+	u, err := ri.Get(name, metav1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	data, _, _ := unstructured.NestedString(u.Object, "data", key)
+	return data, nil
+}
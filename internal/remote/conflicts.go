@@ -0,0 +1,259 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/splunk/qbec/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FieldManager is the name of the field manager that qbec uses for its changes.
+const FieldManager = "qbec"
+
+// hiddenValue is displayed in place of values of objects with sensitive information.
+const hiddenValue = "<hidden>"
+
+// FieldConflict is a field changed by qbec that is managed on the server by a different field manager.
+type FieldConflict struct {
+	Path    string      `json:"path"`            // the path to the field
+	Manager string      `json:"manager"`         // the field manager that owns the field
+	Local   interface{} `json:"local,omitempty"` // the local value, absent when the field is removed
+	Live    interface{} `json:"live,omitempty"`  // the value on the server
+}
+
+func (f FieldConflict) String() string {
+	return fmt.Sprintf("%s (managed by %s): local %s, live %s", f.Path, f.Manager, displayValue(f.Local), displayValue(f.Live))
+}
+
+func displayValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// ConflictError is returned when an update that changes fields managed by other field managers fails.
+type ConflictError struct {
+	Err       error           // the error returned by the server
+	Conflicts []FieldConflict // the fields managed by others
+}
+
+func (c *ConflictError) Error() string {
+	lines := []string{fmt.Sprintf("update changes %d field(s) managed by others:", len(c.Conflicts))}
+	for _, f := range c.Conflicts {
+		lines = append(lines, "  "+f.String())
+	}
+	lines = append(lines, fmt.Sprintf("server error: %v", c.Err))
+	return strings.Join(lines, "\n")
+}
+
+// fieldOwner is a field manager along with the node of its field set that corresponds to the current path.
+type fieldOwner struct {
+	manager string
+	node    map[string]interface{}
+}
+
+// managedFields returns the field sets of all managers of the supplied server object other than qbec.
+func managedFields(obj *unstructured.Unstructured) []fieldOwner {
+	list, _, _ := unstructured.NestedSlice(obj.Object, "metadata", "managedFields")
+	var ret []fieldOwner
+	for _, e := range list {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		manager, _ := m["manager"].(string)
+		if manager == FieldManager {
+			continue
+		}
+		fields, ok := m["fieldsV1"].(map[string]interface{})
+		if !ok {
+			fields, ok = m["fields"].(map[string]interface{}) // servers before 1.18
+		}
+		if ok {
+			ret = append(ret, fieldOwner{manager: manager, node: fields})
+		}
+	}
+	return ret
+}
+
+// fieldConflicts returns the fields in the supplied patch that are managed by other field managers of the
+// server object, sorted by path. Fields that qbec maintains for itself are ignored.
+func fieldConflicts(patch []byte, serverObj *unstructured.Unstructured) []FieldConflict {
+	owners := managedFields(serverObj)
+	if len(owners) == 0 || len(patch) == 0 {
+		return nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(patch, &data); err != nil {
+		return nil
+	}
+	if meta, ok := data["metadata"].(map[string]interface{}); ok {
+		if ann, ok := meta["annotations"].(map[string]interface{}); ok {
+			delete(ann, model.QbecNames.PristineAnnotation)
+			delete(ann, model.QbecNames.RenderHashAnnotation)
+		}
+	}
+	var ret []FieldConflict
+	walkConflicts(data, serverObj.Object, owners, "", &ret)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Path != ret[j].Path {
+			return ret[i].Path < ret[j].Path
+		}
+		return ret[i].Manager < ret[j].Manager
+	})
+	return ret
+}
+
+func walkConflicts(patch interface{}, live interface{}, owners []fieldOwner, path string, out *[]FieldConflict) {
+	if len(owners) == 0 {
+		return
+	}
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		liveMap, _ := live.(map[string]interface{})
+		for k, v := range p {
+			if strings.HasPrefix(k, "$") { // patch directives
+				continue
+			}
+			var next []fieldOwner
+			for _, o := range owners {
+				if child, ok := o.node["f:"+k].(map[string]interface{}); ok {
+					next = append(next, fieldOwner{manager: o.manager, node: child})
+				}
+			}
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			walkConflicts(v, liveMap[k], next, childPath, out)
+		}
+	case []interface{}:
+		liveList, _ := live.([]interface{})
+		// lists that are managed as a whole have no field sets for their items
+		var atomic []fieldOwner
+		for _, o := range owners {
+			if !hasItemFields(o.node) {
+				atomic = append(atomic, o)
+			}
+		}
+		addConflicts(p, live, atomic, path, out)
+		for _, item := range p {
+			im, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var next []fieldOwner
+			var itemKey map[string]interface{}
+			for _, o := range owners {
+				for k, child := range o.node {
+					key := listItemKey(k, im)
+					if key == nil {
+						continue
+					}
+					if cm, ok := child.(map[string]interface{}); ok {
+						next = append(next, fieldOwner{manager: o.manager, node: cm})
+						itemKey = key
+					}
+				}
+			}
+			if itemKey == nil {
+				continue
+			}
+			// key fields identify the item and are not changed by the patch
+			fields := map[string]interface{}{}
+			for k, v := range im {
+				if _, isKey := itemKey[k]; !isKey {
+					fields[k] = v
+				}
+			}
+			walkConflicts(fields, matchingItem(liveList, itemKey), next, path+"["+keyString(itemKey)+"]", out)
+		}
+	default:
+		addConflicts(p, live, owners, path, out)
+	}
+}
+
+func hasItemFields(node map[string]interface{}) bool {
+	for k := range node {
+		if strings.HasPrefix(k, "k:") || strings.HasPrefix(k, "v:") || strings.HasPrefix(k, "i:") {
+			return true
+		}
+	}
+	return false
+}
+
+func addConflicts(local, live interface{}, owners []fieldOwner, path string, out *[]FieldConflict) {
+	for _, o := range owners {
+		*out = append(*out, FieldConflict{Path: path, Manager: o.manager, Local: local, Live: live})
+	}
+}
+
+// listItemKey returns the key fields of a list item key in a field set when it identifies the supplied item.
+func listItemKey(fieldKey string, item map[string]interface{}) map[string]interface{} {
+	if !strings.HasPrefix(fieldKey, "k:") {
+		return nil
+	}
+	var key map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(fieldKey, "k:")), &key); err != nil {
+		return nil
+	}
+	for k, v := range key {
+		if fmt.Sprint(item[k]) != fmt.Sprint(v) {
+			return nil
+		}
+	}
+	return key
+}
+
+func matchingItem(list []interface{}, key map[string]interface{}) interface{} {
+	for _, item := range list {
+		im, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		match := true
+		for k, v := range key {
+			if fmt.Sprint(im[k]) != fmt.Sprint(v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return im
+		}
+	}
+	return nil
+}
+
+func keyString(key map[string]interface{}) string {
+	var parts []string
+	for k, v := range key {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
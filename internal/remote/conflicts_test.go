@@ -0,0 +1,92 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func loadManagedObject(t *testing.T) *unstructured.Unstructured {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "managed-deployment.json"))
+	require.Nil(t, err)
+	var data map[string]interface{}
+	require.Nil(t, json.Unmarshal(b, &data))
+	return &unstructured.Unstructured{Object: data}
+}
+
+func TestFieldConflicts(t *testing.T) {
+	obj := loadManagedObject(t)
+	patch := `{
+		"metadata": {
+			"labels": {"app": "web2", "team": null},
+			"annotations": {"qbec.io/last-applied": "{}"}
+		},
+		"spec": {
+			"replicas": 3,
+			"strategy": {"type": "RollingUpdate"},
+			"template": {"spec": {
+				"$setElementOrder/containers": [{"name": "main"}, {"name": "sidecar"}],
+				"containers": [{"name": "main", "image": "nginx:1.1"}, {"name": "sidecar", "image": "envoy:1.1"}],
+				"tolerations": []
+			}}
+		}
+	}`
+	conflicts := fieldConflicts([]byte(patch), obj)
+	assert.Equal(t, []FieldConflict{
+		{Path: "metadata.labels.team", Manager: "kubectl-edit", Live: "infra"},
+		{Path: "spec.replicas", Manager: "kube-controller-manager", Local: 3.0, Live: 5.0},
+		{Path: "spec.strategy.type", Manager: "kubectl-edit", Local: "RollingUpdate", Live: "Recreate"},
+		{Path: "spec.template.spec.containers[name=sidecar].image", Manager: "kubectl-edit", Local: "envoy:1.1", Live: "envoy:1.0"},
+		{
+			Path:    "spec.template.spec.tolerations",
+			Manager: "policy-controller",
+			Local:   []interface{}{},
+			Live:    []interface{}{map[string]interface{}{"key": "dedicated", "operator": "Exists"}},
+		},
+	}, conflicts)
+}
+
+func TestFieldConflictsNone(t *testing.T) {
+	obj := loadManagedObject(t)
+	assert.Nil(t, fieldConflicts([]byte(`{"spec":{"template":{"spec":{"containers":[{"name":"main","image":"nginx:2"}]}}}}`), obj))
+	assert.Nil(t, fieldConflicts([]byte(`{}`), obj))
+	assert.Nil(t, fieldConflicts(nil, obj))
+	delete(obj.Object["metadata"].(map[string]interface{}), "managedFields")
+	assert.Nil(t, fieldConflicts([]byte(`{"spec":{"replicas":3}}`), obj))
+}
+
+func TestConflictError(t *testing.T) {
+	err := &ConflictError{
+		Err: errors.New("the server rejected the update"),
+		Conflicts: []FieldConflict{
+			{Path: "spec.replicas", Manager: "kube-controller-manager", Local: 3, Live: 5},
+			{Path: "metadata.labels.team", Manager: "kubectl-edit", Live: "infra"},
+		},
+	}
+	assert.Equal(t, `update changes 2 field(s) managed by others:
+  spec.replicas (managed by kube-controller-manager): local 3, live 5
+  metadata.labels.team (managed by kubectl-edit): local <none>, live "infra"
+server error: the server rejected the update`, err.Error())
+}
@@ -0,0 +1,127 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/splunk/qbec/internal/model"
+	"k8s.io/client-go/rest"
+)
+
+// this file contains the enforcement of sync deadlines. Every request made for a sync with a deadline carries a
+// context that expires at the deadline, such that the sync is actually canceled instead of being abandoned while
+// it continues to make changes.
+
+// deadlineTransport sends all requests with the current context of its deadline state and fails them once it is
+// done.
+type deadlineTransport struct {
+	delegate http.RoundTripper
+	state    *deadlineState
+}
+
+func (d *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := d.state.context()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.delegate.RoundTrip(req.WithContext(ctx))
+}
+
+// wrapDeadline returns a transport wrapper that applies the deadline transport after the supplied wrapper, if any.
+func wrapDeadline(wrap func(rt http.RoundTripper) http.RoundTripper, state *deadlineState) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &deadlineTransport{delegate: rt, state: state}
+	}
+}
+
+// deadlineState holds the client, derived once from a client, that is used for all syncs with deadlines along with
+// the context of the sync in progress. Syncs with deadlines are made one at a time, the way apply makes them.
+type deadlineState struct {
+	busy   sync.Mutex // held for the duration of a sync
+	once   sync.Once
+	client *Client
+	l      sync.Mutex
+	ctx    context.Context
+}
+
+func newDeadlineState() *deadlineState {
+	return &deadlineState{}
+}
+
+// context returns the context of the sync in progress.
+func (d *deadlineState) context() context.Context {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+func (d *deadlineState) setContext(ctx context.Context) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.ctx = ctx
+}
+
+// deadlineClient returns the client that makes all requests with the context of the deadline state of this client,
+// creating it on first use. The returned client shares server metadata and the set of known dynamic types with this
+// client.
+func (c *Client) deadlineClient() (*Client, error) {
+	if c.restConfig == nil || c.poolFor == nil || c.deadlines == nil {
+		return nil, fmt.Errorf("deadlines not supported by this client")
+	}
+	d := c.deadlines
+	d.once.Do(func() {
+		ret := *c
+		ret.restConfig = rest.CopyConfig(c.restConfig)
+		ret.restConfig.WrapTransport = wrapDeadline(c.restConfig.WrapTransport, d)
+		ret.pool = c.poolFor(ret.restConfig)
+		ret.deadlines = nil
+		d.client = &ret
+	})
+	return d.client, nil
+}
+
+// syncWithDeadline syncs the supplied object canceling all its requests at the deadline of the supplied options.
+// It returns ErrSyncTimeout if the sync could not complete in time.
+func (c *Client) syncWithDeadline(original model.K8sLocalObject, opts SyncOptions) (*SyncResult, error) {
+	dc, err := c.deadlineClient()
+	if err != nil {
+		return nil, err
+	}
+	c.deadlines.busy.Lock()
+	defer c.deadlines.busy.Unlock()
+	ctx, cancel := context.WithDeadline(context.Background(), opts.Deadline)
+	defer cancel()
+	c.deadlines.setContext(ctx)
+	defer c.deadlines.setContext(nil)
+	opts.Deadline = time.Time{}
+	res, err := dc.Sync(original, opts)
+	if err != nil && ctx.Err() != nil {
+		return nil, ErrSyncTimeout
+	}
+	return res, err
+}
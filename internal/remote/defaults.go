@@ -0,0 +1,146 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// FieldDefault is a field that is not set in an object and for which the Open API schema of the server declares
+// a default value.
+type FieldDefault struct {
+	Path  string // the path of the field, for example spec.replicas or spec.ports[0].protocol
+	Value string // the default value as JSON
+}
+
+const (
+	definitionPrefix = "#/definitions/"
+	gvkExtension     = "x-kubernetes-group-version-kind"
+	maxRefDepth      = 10
+)
+
+// schemaDefaults finds the defaults of fields declared in an Open API document. Unlike the validation schemas,
+// which do not retain defaults, these are computed from the raw document.
+type schemaDefaults struct {
+	definitions map[string]*openapi_v2.Schema
+	kinds       map[schema.GroupVersionKind]*openapi_v2.Schema
+}
+
+func newSchemaDefaults(doc *openapi_v2.Document) *schemaDefaults {
+	ret := &schemaDefaults{
+		definitions: map[string]*openapi_v2.Schema{},
+		kinds:       map[schema.GroupVersionKind]*openapi_v2.Schema{},
+	}
+	if doc == nil || doc.Definitions == nil {
+		return ret
+	}
+	for _, def := range doc.Definitions.AdditionalProperties {
+		ret.definitions[def.Name] = def.Value
+		for _, ext := range def.Value.GetVendorExtension() {
+			if ext.Name != gvkExtension || ext.Value == nil {
+				continue
+			}
+			var gvks []schema.GroupVersionKind
+			if err := yaml.Unmarshal([]byte(ext.Value.Yaml), &gvks); err != nil {
+				continue
+			}
+			for _, gvk := range gvks {
+				ret.kinds[gvk] = def.Value
+			}
+		}
+	}
+	return ret
+}
+
+// resolve returns the schema that the supplied schema refers to, if it is a reference.
+func (s *schemaDefaults) resolve(sc *openapi_v2.Schema) *openapi_v2.Schema {
+	for i := 0; i < maxRefDepth && sc != nil && strings.HasPrefix(sc.XRef, definitionPrefix); i++ {
+		sc = s.definitions[strings.TrimPrefix(sc.XRef, definitionPrefix)]
+	}
+	return sc
+}
+
+// walk records the defaults of properties of the supplied schema that are not set in the supplied value,
+// descending into the properties and array items that are set.
+func (s *schemaDefaults) walk(sc *openapi_v2.Schema, value interface{}, path string, out *[]FieldDefault) {
+	sc = s.resolve(sc)
+	if sc == nil {
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if sc.Properties == nil {
+			return
+		}
+		for _, p := range sc.Properties.AdditionalProperties {
+			child := p.Name
+			if path != "" {
+				child = path + "." + p.Name
+			}
+			if val, ok := v[p.Name]; ok {
+				s.walk(p.Value, val, child, out)
+				continue
+			}
+			if d := s.resolve(p.Value).GetDefault(); d != nil {
+				value := strings.TrimSpace(d.Yaml)
+				if b, err := yaml.YAMLToJSON([]byte(d.Yaml)); err == nil {
+					value = string(b)
+				}
+				*out = append(*out, FieldDefault{Path: child, Value: value})
+			}
+		}
+	case []interface{}:
+		items := sc.GetItems().GetSchema()
+		if len(items) == 0 {
+			return
+		}
+		for i, item := range v {
+			s.walk(items[0], item, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	}
+}
+
+// fieldDefaults returns the defaults for fields that are not set in the supplied object, sorted by path.
+func (s *schemaDefaults) fieldDefaults(obj *unstructured.Unstructured) ([]FieldDefault, error) {
+	sc := s.kinds[obj.GroupVersionKind()]
+	if sc == nil {
+		return nil, ErrSchemaNotFound
+	}
+	var ret []FieldDefault
+	s.walk(sc, obj.Object, "", &ret)
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
+
+// FieldDefaults returns the fields that are not set in the supplied object and are defaulted by the server, as far as
+// the Open API schema of the server declares them. Defaults that are applied by server code are not returned.
+func (sm *ServerMetadata) FieldDefaults(obj *unstructured.Unstructured) ([]FieldDefault, error) {
+	if _, _, err := sm.openAPIResources(); err != nil {
+		return nil, err
+	}
+	sm.ol.Lock()
+	defaults := sm.oResult.defaults
+	sm.ol.Unlock()
+	return defaults.fieldDefaults(obj)
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func namedSchema(name string, s *openapi_v2.Schema) *openapi_v2.NamedSchema {
+	return &openapi_v2.NamedSchema{Name: name, Value: s}
+}
+
+func properties(props ...*openapi_v2.NamedSchema) *openapi_v2.Properties {
+	return &openapi_v2.Properties{AdditionalProperties: props}
+}
+
+func ref(name string) *openapi_v2.Schema {
+	return &openapi_v2.Schema{XRef: "#/definitions/" + name}
+}
+
+func withDefault(yaml string) *openapi_v2.Schema {
+	return &openapi_v2.Schema{Default: &openapi_v2.Any{Yaml: yaml}}
+}
+
+func defaultsDoc() *openapi_v2.Document {
+	return &openapi_v2.Document{
+		Definitions: &openapi_v2.Definitions{
+			AdditionalProperties: []*openapi_v2.NamedSchema{
+				namedSchema("example.v1.Widget", &openapi_v2.Schema{
+					VendorExtension: []*openapi_v2.NamedAny{
+						{Name: gvkExtension, Value: &openapi_v2.Any{Yaml: "- group: example.com\n  kind: Widget\n  version: v1\n"}},
+					},
+					Properties: properties(
+						namedSchema("spec", ref("example.v1.WidgetSpec")),
+					),
+				}),
+				namedSchema("example.v1.WidgetSpec", &openapi_v2.Schema{
+					Properties: properties(
+						namedSchema("replicas", withDefault("1")),
+						namedSchema("mode", withDefault("fast")),
+						namedSchema("labels", withDefault("a: b")),
+						namedSchema("ports", &openapi_v2.Schema{
+							Items: &openapi_v2.ItemsItem{Schema: []*openapi_v2.Schema{ref("example.v1.Port")}},
+						}),
+					),
+				}),
+				namedSchema("example.v1.Port", &openapi_v2.Schema{
+					Properties: properties(
+						namedSchema("port", &openapi_v2.Schema{}),
+						namedSchema("protocol", withDefault("TCP")),
+					),
+				}),
+			},
+		},
+	}
+}
+
+func TestFieldDefaults(t *testing.T) {
+	sd := newSchemaDefaults(defaultsDoc())
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"spec": map[string]interface{}{
+			"mode": "slow",
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+				map[string]interface{}{"port": int64(443), "protocol": "UDP"},
+			},
+		},
+	}}
+	defaults, err := sd.fieldDefaults(obj)
+	require.Nil(t, err)
+	assert.Equal(t, []FieldDefault{
+		{Path: "spec.labels", Value: `{"a":"b"}`},
+		{Path: "spec.ports[0].protocol", Value: `"TCP"`},
+		{Path: "spec.replicas", Value: "1"},
+	}, defaults)
+}
+
+func TestFieldDefaultsUnsetParent(t *testing.T) {
+	sd := newSchemaDefaults(defaultsDoc())
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+	}}
+	defaults, err := sd.fieldDefaults(obj)
+	require.Nil(t, err)
+	assert.Nil(t, defaults)
+}
+
+func TestFieldDefaultsUnknownKind(t *testing.T) {
+	sd := newSchemaDefaults(defaultsDoc())
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Gadget",
+	}}
+	_, err := sd.fieldDefaults(obj)
+	assert.Equal(t, ErrSchemaNotFound, err)
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// this file contains the implementation of server-side dry-runs. The dynamic client in use does not support
+// dry-run options and so requests are made using a REST client for the group version of the object.
+
+// restClientFor returns a REST client for the supplied group version.
+func (c *Client) restClientFor(gv schema.GroupVersion) (*rest.RESTClient, error) {
+	if c.restConfig == nil {
+		return nil, fmt.Errorf("server dry-run not supported by this client")
+	}
+	conf := rest.CopyConfig(c.restConfig)
+	conf.GroupVersion = &gv
+	conf.APIPath = "/apis"
+	if gv.Group == "" {
+		conf.APIPath = "/api"
+	}
+	conf.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+	return rest.RESTClientFor(conf)
+}
+
+// apiResourceFor returns the API resource for the supplied group version kind.
+func (c *Client) apiResourceFor(gvk schema.GroupVersionKind) (*metav1.APIResource, error) {
+	info, err := c.sm.infoFor(gvk)
+	if err != nil {
+		return c.jitResource(gvk)
+	}
+	return &info.resource, nil
+}
+
+// serverDryRun performs a server-side dry-run for the supplied update result and returns the object that
+// the server would have persisted.
+func (c *Client) serverDryRun(obj model.K8sMeta, result *updateResult) (*unstructured.Unstructured, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	res, err := c.apiResourceFor(gvk)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := c.restClientFor(gvk.GroupVersion())
+	if err != nil {
+		return nil, err
+	}
+	ns := obj.GetNamespace()
+	if ns == "" {
+		ns = c.defaultNs
+	}
+	req := rc.Post()
+	switch result.Operation {
+	case opUpdate:
+		req = rc.Patch(result.Kind).Name(obj.GetName())
+	case opReplace:
+		req = rc.Put().Name(obj.GetName())
+	}
+	b, err := req.NamespaceIfScoped(ns, res.Namespaced).
+		Resource(res.Name).
+		Param("dryRun", "All").
+		Body(result.patch).
+		Do().
+		Raw()
+	if err != nil {
+		return nil, errors.Wrap(err, "server dry-run")
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, errors.Wrap(err, "unmarshal server dry-run result")
+	}
+	return &unstructured.Unstructured{Object: data}, nil
+}
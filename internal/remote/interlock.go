@@ -0,0 +1,98 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// this file contains the context interlock. When the kubeconfig does not meet the expectations of an environment,
+// like a current context that belongs to another cluster, the client rejects all changes in the same way as in
+// read-only mode, such that fat-fingering a production environment with a development kubeconfig cannot change it.
+
+// InterlockError is returned for operations that would change objects on the server when the kubeconfig does not
+// meet the interlock expectations of the environment.
+type InterlockError struct {
+	Env     string   // the environment
+	Reasons []string // the expectations that were not met
+}
+
+func (e *InterlockError) Error() string {
+	return fmt.Sprintf("context interlock for environment %s: %s, changes to the cluster are not allowed (use --force-context to override)",
+		e.Env, strings.Join(e.Reasons, "; "))
+}
+
+// IsInterlockError returns true if the cause of the supplied error is an interlock error.
+func IsInterlockError(err error) bool {
+	_, ok := errors.Cause(err).(*InterlockError)
+	return ok
+}
+
+// checkInterlock returns an interlock error if the supplied kubeconfig and the context resolved for an environment do
+// not meet the supplied interlock expectations, or nil if they do. The current context of the kubeconfig is the one it
+// was loaded with, not the one the environment resolved to.
+func checkInterlock(rc clientcmdapi.Config, resolved *ResolvedContext, env string, il *model.EnvironmentInterlock) (*InterlockError, error) {
+	if il == nil {
+		return nil, nil
+	}
+	var reasons []string
+	current := rc.CurrentContext
+	if il.CurrentContext != "" {
+		re, err := regexp.Compile(il.CurrentContext)
+		if err != nil {
+			return nil, errors.Wrapf(err, "interlock for env %s", env)
+		}
+		if !re.MatchString(current) {
+			reasons = append(reasons, fmt.Sprintf("current context %q does not match %q", current, il.CurrentContext))
+		}
+	}
+	if il.CurrentNamespace != "" {
+		re, err := regexp.Compile(il.CurrentNamespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "interlock for env %s", env)
+		}
+		ns := "default"
+		if ctx, ok := rc.Contexts[current]; ok && ctx.Namespace != "" {
+			ns = ctx.Namespace
+		}
+		if !re.MatchString(ns) {
+			reasons = append(reasons, fmt.Sprintf("namespace %q of the current context does not match %q", ns, il.CurrentNamespace))
+		}
+	}
+	if len(il.Servers) > 0 {
+		found := false
+		for _, s := range il.Servers {
+			if s == resolved.ServerURL {
+				found = true
+				break
+			}
+		}
+		if !found {
+			reasons = append(reasons, fmt.Sprintf("server %s is not one of %s", resolved.ServerURL, strings.Join(il.Servers, ", ")))
+		}
+	}
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+	return &InterlockError{Env: env, Reasons: reasons}, nil
+}
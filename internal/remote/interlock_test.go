@@ -0,0 +1,103 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckInterlock(t *testing.T) {
+	rc := testKubeconfig()
+	rc.CurrentContext = "dev"
+	rc.Contexts["prod-us"].Namespace = "web"
+	prodUS := &ResolvedContext{Context: "prod-us", Cluster: "prod-us-cluster", ServerURL: "https://prod-us-server"}
+	tests := []struct {
+		name      string
+		current   string
+		interlock *model.EnvironmentInterlock
+		reasons   []string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:      "matching",
+			current:   "prod-us",
+			interlock: &model.EnvironmentInterlock{CurrentContext: "^prod-", CurrentNamespace: "^web$", Servers: []string{"https://prod-eu-server", "https://prod-us-server"}},
+		},
+		{
+			name:      "current context",
+			current:   "dev",
+			interlock: &model.EnvironmentInterlock{CurrentContext: "^prod-"},
+			reasons:   []string{`current context "dev" does not match "^prod-"`},
+		},
+		{
+			name:      "all",
+			current:   "dev",
+			interlock: &model.EnvironmentInterlock{CurrentContext: "^prod-", CurrentNamespace: "^web$", Servers: []string{"https://prod-eu-server"}},
+			reasons: []string{
+				`current context "dev" does not match "^prod-"`,
+				`namespace "default" of the current context does not match "^web$"`,
+				"server https://prod-us-server is not one of https://prod-eu-server",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc.CurrentContext = test.current
+			ie, err := checkInterlock(rc, prodUS, "prod", test.interlock)
+			require.Nil(t, err)
+			if test.reasons == nil {
+				assert.Nil(t, ie)
+				return
+			}
+			require.NotNil(t, ie)
+			assert.Equal(t, test.reasons, ie.Reasons)
+		})
+	}
+
+	_, err := checkInterlock(rc, prodUS, "prod", &model.EnvironmentInterlock{CurrentContext: "("})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "interlock for env prod")
+}
+
+func TestInterlockClient(t *testing.T) {
+	ie := &InterlockError{Env: "prod", Reasons: []string{`current context "dev" does not match "^prod-"`}}
+	a := assert.New(t)
+	a.Equal(`context interlock for environment prod: current context "dev" does not match "^prod-", changes to the cluster are not allowed (use --force-context to override)`, ie.Error())
+
+	c := &Client{interlock: ie}
+	err := c.checkWritable()
+	a.True(IsInterlockError(err))
+	a.False(IsInterlockError(ErrReadOnly))
+
+	var rec recordingTransport
+	rt := wrapReadOnly(nil, ie)(&rec)
+	req, err := http.NewRequest(http.MethodDelete, "https://k8s/api/v1/namespaces/ns1/configmaps/cm1", nil)
+	require.Nil(t, err)
+	_, err = rt.RoundTrip(req)
+	require.NotNil(t, err)
+	a.True(IsInterlockError(err))
+	a.Equal(ie, errors.Cause(err))
+	a.Equal(0, rec.requests)
+}
@@ -0,0 +1,59 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// inventoryKey is the key of the config map data that has the inventory of components.
+const inventoryKey = "components.json"
+
+// RecordInventory records the supplied names of the components applied to an environment in the config map with the
+// supplied namespace and name, creating it if needed. The recorded inventory replaces the previous one.
+func (c *Client) RecordInventory(namespace, name string, components []string) error {
+	list := append([]string{}, components...)
+	sort.Strings(list)
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.updateConfigMapData(namespace, name, inventoryKey, func(string) (string, error) {
+		return string(b), nil
+	})
+}
+
+// Inventory returns the names of the components recorded in the config map with the supplied namespace and name. It
+// returns nil if no inventory was recorded.
+func (c *Client) Inventory(namespace, name string) ([]string, error) {
+	data, err := c.configMapData(namespace, name, inventoryKey)
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+	var ret []string
+	if err := json.Unmarshal([]byte(data), &ret); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unmarshal inventory in %s/%s", namespace, name))
+	}
+	return ret, nil
+}
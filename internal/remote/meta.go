@@ -86,6 +86,7 @@ func (v *validators) validatorFor(gvk schema.GroupVersionKind) (Validator, error
 type openapiResourceResult struct {
 	res        openapi.Resources
 	validators *validators
+	defaults   *schemaDefaults
 	err        error
 }
 
@@ -134,6 +135,9 @@ func (sm *ServerMetadata) infoFor(gvk schema.GroupVersionKind) (*gvkInfo, error)
 
 // ValidatorFor returns a validator for the supplied GroupVersionKind.
 func (sm *ServerMetadata) ValidatorFor(gvk schema.GroupVersionKind) (Validator, error) {
+	if err := sm.UnservedError(gvk); err != nil {
+		return &unservedValidator{err: err}, nil
+	}
 	_, v, err := sm.openAPIResources()
 	if err != nil {
 		return nil, err
@@ -444,23 +448,24 @@ func (sm *ServerMetadata) openAPIResources() (openapi.Resources, *validators, er
 	if ret != nil {
 		return ret.res, ret.validators, ret.err
 	}
-	handle := func(r openapi.Resources, err error) (openapi.Resources, *validators, error) {
+	handle := func(doc *openapi_v2.Document, r openapi.Resources, err error) (openapi.Resources, *validators, error) {
 		sm.oResult = &openapiResourceResult{res: r, err: err}
 		if err == nil {
 			sm.oResult.validators = &validators{
 				res:   r,
 				cache: map[schema.GroupVersionKind]*schemaResult{},
 			}
+			sm.oResult.defaults = newSchemaDefaults(doc)
 		}
 		return sm.oResult.res, sm.oResult.validators, sm.oResult.err
 	}
 	doc, err := sm.disco.OpenAPISchema()
 	if err != nil {
-		return handle(nil, errors.Wrap(err, "Open API doc from server"))
+		return handle(nil, nil, errors.Wrap(err, "Open API doc from server"))
 	}
 	res, err := openapi.NewOpenAPIData(doc)
 	if err != nil {
-		return handle(nil, errors.Wrap(err, "get resources from validator"))
+		return handle(nil, nil, errors.Wrap(err, "get resources from validator"))
 	}
-	return handle(res, nil)
+	return handle(doc, res, nil)
 }
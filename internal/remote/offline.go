@@ -0,0 +1,482 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	"github.com/pkg/errors"
+	"github.com/splunk/qbec/internal/sio"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// range of minor versions of Kubernetes 1.x for which capabilities are bundled
+const (
+	MinOfflineMinor = 16
+	MaxOfflineMinor = 30
+)
+
+// builtinVersion is a version of a built-in resource type that is served for a range of minor versions of Kubernetes.
+type builtinVersion struct {
+	version string
+	since   int // first minor version that serves the type
+	removed int // first minor version that no longer serves the type, 0 if still served
+}
+
+// builtinType is a built-in resource type with its versions in order of preference.
+type builtinType struct {
+	kind       string
+	resource   string
+	namespaced bool
+	versions   []builtinVersion
+}
+
+// builtinGroup is an API group with its types, the order of groups is the order in which servers list them.
+type builtinGroup struct {
+	name     string
+	versions []string // in order of preference
+	types    []builtinType
+}
+
+func bv(version string, since, removed int) builtinVersion {
+	return builtinVersion{version: version, since: since, removed: removed}
+}
+
+// builtinGroups are the capabilities of Kubernetes servers from 1.16 onwards, limited to types that can be created,
+// listed and deleted. Types removed before 1.16 are listed such that objects using them are reported.
+var builtinGroups = []builtinGroup{
+	{name: "", versions: []string{"v1"}, types: []builtinType{
+		{"ConfigMap", "configmaps", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"Endpoints", "endpoints", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"Event", "events", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"LimitRange", "limitranges", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"Namespace", "namespaces", false, []builtinVersion{bv("v1", 0, 0)}},
+		{"Node", "nodes", false, []builtinVersion{bv("v1", 0, 0)}},
+		{"PersistentVolume", "persistentvolumes", false, []builtinVersion{bv("v1", 0, 0)}},
+		{"PersistentVolumeClaim", "persistentvolumeclaims", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"Pod", "pods", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"PodTemplate", "podtemplates", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"ReplicationController", "replicationcontrollers", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"ResourceQuota", "resourcequotas", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"Secret", "secrets", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"Service", "services", true, []builtinVersion{bv("v1", 0, 0)}},
+		{"ServiceAccount", "serviceaccounts", true, []builtinVersion{bv("v1", 0, 0)}},
+	}},
+	{name: "apiregistration.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"APIService", "apiservices", false, []builtinVersion{bv("v1", 10, 0), bv("v1beta1", 7, 22)}},
+	}},
+	{name: "extensions", versions: []string{"v1beta1"}, types: []builtinType{
+		{"DaemonSet", "daemonsets", true, []builtinVersion{bv("v1beta1", 0, 16)}},
+		{"Deployment", "deployments", true, []builtinVersion{bv("v1beta1", 0, 16)}},
+		{"Ingress", "ingresses", true, []builtinVersion{bv("v1beta1", 0, 22)}},
+		{"NetworkPolicy", "networkpolicies", true, []builtinVersion{bv("v1beta1", 0, 16)}},
+		{"PodSecurityPolicy", "podsecuritypolicies", false, []builtinVersion{bv("v1beta1", 0, 16)}},
+		{"ReplicaSet", "replicasets", true, []builtinVersion{bv("v1beta1", 0, 16)}},
+	}},
+	{name: "apps", versions: []string{"v1", "v1beta2", "v1beta1"}, types: []builtinType{
+		{"ControllerRevision", "controllerrevisions", true, []builtinVersion{bv("v1", 9, 0), bv("v1beta2", 8, 16), bv("v1beta1", 7, 16)}},
+		{"DaemonSet", "daemonsets", true, []builtinVersion{bv("v1", 9, 0), bv("v1beta2", 8, 16)}},
+		{"Deployment", "deployments", true, []builtinVersion{bv("v1", 9, 0), bv("v1beta2", 8, 16), bv("v1beta1", 6, 16)}},
+		{"ReplicaSet", "replicasets", true, []builtinVersion{bv("v1", 9, 0), bv("v1beta2", 8, 16)}},
+		{"StatefulSet", "statefulsets", true, []builtinVersion{bv("v1", 9, 0), bv("v1beta2", 8, 16), bv("v1beta1", 5, 16)}},
+	}},
+	{name: "events.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"Event", "events", true, []builtinVersion{bv("v1", 19, 0), bv("v1beta1", 8, 25)}},
+	}},
+	{name: "autoscaling", versions: []string{"v2", "v1", "v2beta2", "v2beta1"}, types: []builtinType{
+		{"HorizontalPodAutoscaler", "horizontalpodautoscalers", true, []builtinVersion{
+			bv("v2", 23, 0), bv("v1", 2, 0), bv("v2beta2", 12, 26), bv("v2beta1", 8, 25),
+		}},
+	}},
+	{name: "batch", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"CronJob", "cronjobs", true, []builtinVersion{bv("v1", 21, 0), bv("v1beta1", 8, 25)}},
+		{"Job", "jobs", true, []builtinVersion{bv("v1", 0, 0)}},
+	}},
+	{name: "certificates.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"CertificateSigningRequest", "certificatesigningrequests", false, []builtinVersion{bv("v1", 19, 0), bv("v1beta1", 4, 22)}},
+	}},
+	{name: "networking.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"Ingress", "ingresses", true, []builtinVersion{bv("v1", 19, 0), bv("v1beta1", 14, 22)}},
+		{"IngressClass", "ingressclasses", false, []builtinVersion{bv("v1", 19, 0), bv("v1beta1", 18, 22)}},
+		{"NetworkPolicy", "networkpolicies", true, []builtinVersion{bv("v1", 7, 0)}},
+	}},
+	{name: "policy", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"PodDisruptionBudget", "poddisruptionbudgets", true, []builtinVersion{bv("v1", 21, 0), bv("v1beta1", 5, 25)}},
+		{"PodSecurityPolicy", "podsecuritypolicies", false, []builtinVersion{bv("v1beta1", 10, 25)}},
+	}},
+	{name: "rbac.authorization.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"ClusterRole", "clusterroles", false, []builtinVersion{bv("v1", 8, 0), bv("v1beta1", 6, 22)}},
+		{"ClusterRoleBinding", "clusterrolebindings", false, []builtinVersion{bv("v1", 8, 0), bv("v1beta1", 6, 22)}},
+		{"Role", "roles", true, []builtinVersion{bv("v1", 8, 0), bv("v1beta1", 6, 22)}},
+		{"RoleBinding", "rolebindings", true, []builtinVersion{bv("v1", 8, 0), bv("v1beta1", 6, 22)}},
+	}},
+	{name: "storage.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"CSIDriver", "csidrivers", false, []builtinVersion{bv("v1", 18, 0), bv("v1beta1", 14, 22)}},
+		{"CSINode", "csinodes", false, []builtinVersion{bv("v1", 17, 0), bv("v1beta1", 14, 22)}},
+		{"CSIStorageCapacity", "csistoragecapacities", true, []builtinVersion{bv("v1", 24, 0), bv("v1beta1", 21, 27)}},
+		{"StorageClass", "storageclasses", false, []builtinVersion{bv("v1", 6, 0), bv("v1beta1", 4, 22)}},
+		{"VolumeAttachment", "volumeattachments", false, []builtinVersion{bv("v1", 13, 0), bv("v1beta1", 10, 22)}},
+	}},
+	{name: "admissionregistration.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"MutatingWebhookConfiguration", "mutatingwebhookconfigurations", false, []builtinVersion{bv("v1", 16, 0), bv("v1beta1", 9, 22)}},
+		{"ValidatingWebhookConfiguration", "validatingwebhookconfigurations", false, []builtinVersion{bv("v1", 16, 0), bv("v1beta1", 9, 22)}},
+	}},
+	{name: "apiextensions.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"CustomResourceDefinition", "customresourcedefinitions", false, []builtinVersion{bv("v1", 16, 0), bv("v1beta1", 7, 22)}},
+	}},
+	{name: "scheduling.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"PriorityClass", "priorityclasses", false, []builtinVersion{bv("v1", 14, 0), bv("v1beta1", 11, 22)}},
+	}},
+	{name: "coordination.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"Lease", "leases", true, []builtinVersion{bv("v1", 14, 0), bv("v1beta1", 12, 22)}},
+	}},
+	{name: "node.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"RuntimeClass", "runtimeclasses", false, []builtinVersion{bv("v1", 20, 0), bv("v1beta1", 14, 25)}},
+	}},
+	{name: "discovery.k8s.io", versions: []string{"v1", "v1beta1"}, types: []builtinType{
+		{"EndpointSlice", "endpointslices", true, []builtinVersion{bv("v1", 21, 0), bv("v1beta1", 17, 25)}},
+	}},
+	{name: "flowcontrol.apiserver.k8s.io", versions: []string{"v1", "v1beta3", "v1beta2", "v1beta1"}, types: []builtinType{
+		{"FlowSchema", "flowschemas", false, []builtinVersion{
+			bv("v1", 29, 0), bv("v1beta3", 26, 32), bv("v1beta2", 23, 29), bv("v1beta1", 20, 26),
+		}},
+		{"PriorityLevelConfiguration", "prioritylevelconfigurations", false, []builtinVersion{
+			bv("v1", 29, 0), bv("v1beta3", 26, 32), bv("v1beta2", 23, 29), bv("v1beta1", 20, 26),
+		}},
+	}},
+}
+
+var kubeVersionPattern = regexp.MustCompile(`^v?1\.(\d+)(?:\.\d+)?$`)
+
+// ParseKubernetesVersion returns the minor version of the supplied Kubernetes version, of the form 1.27, v1.27 or
+// 1.27.3, provided that capabilities are bundled for it.
+func ParseKubernetesVersion(s string) (int, error) {
+	m := kubeVersionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid Kubernetes version %q, must be of the form 1.<minor>", s)
+	}
+	minor, _ := strconv.Atoi(m[1])
+	if minor < MinOfflineMinor || minor > MaxOfflineMinor {
+		return 0, fmt.Errorf("unsupported Kubernetes version %s, must be between 1.%d and 1.%d", s, MinOfflineMinor, MaxOfflineMinor)
+	}
+	return minor, nil
+}
+
+// offlineDiscovery implements discovery for a Kubernetes version from bundled capabilities and an optional Open API
+// document that is loaded from a file or URL.
+type offlineDiscovery struct {
+	minor  int
+	schema string // file or URL of the Open API document, blank if none
+}
+
+func (b builtinVersion) servedBy(minor int) bool {
+	return minor >= b.since && (b.removed == 0 || minor < b.removed)
+}
+
+func (d *offlineDiscovery) groupVersions(g builtinGroup) []string {
+	var ret []string
+	for _, ver := range g.versions {
+		for _, t := range g.types {
+			if t.servedVersion(ver, d.minor) {
+				ret = append(ret, ver)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func (t builtinType) servedVersion(version string, minor int) bool {
+	for _, b := range t.versions {
+		if b.version == version && b.servedBy(minor) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *offlineDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	list := &metav1.APIGroupList{}
+	for _, g := range builtinGroups {
+		versions := d.groupVersions(g)
+		if len(versions) == 0 {
+			continue
+		}
+		group := metav1.APIGroup{Name: g.name}
+		for _, ver := range versions {
+			group.Versions = append(group.Versions, metav1.GroupVersionForDiscovery{
+				GroupVersion: schema.GroupVersion{Group: g.name, Version: ver}.String(),
+				Version:      ver,
+			})
+		}
+		group.PreferredVersion = group.Versions[0]
+		list.Groups = append(list.Groups, group)
+	}
+	return list, nil
+}
+
+func (d *offlineDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+	list := &metav1.APIResourceList{GroupVersion: groupVersion}
+	for _, g := range builtinGroups {
+		if g.name != gv.Group {
+			continue
+		}
+		for _, t := range g.types {
+			if !t.servedVersion(gv.Version, d.minor) {
+				continue
+			}
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       t.resource,
+				Namespaced: t.namespaced,
+				Kind:       t.kind,
+				Verbs:      metav1.Verbs{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"},
+			})
+		}
+	}
+	return list, nil
+}
+
+// OpenAPISchema returns the Open API document from the schema file or URL, in JSON or protobuf form. Without a
+// schema, it returns an empty document such that no objects have schemas.
+func (d *offlineDiscovery) OpenAPISchema() (*openapi_v2.Document, error) {
+	if d.schema == "" {
+		return &openapi_v2.Document{}, nil
+	}
+	b, err := readSchema(d.schema)
+	if err != nil {
+		return nil, err
+	}
+	return parseOpenAPIDocument(b)
+}
+
+// schemaClient is the HTTP client for downloading schemas, which can be several megabytes in size.
+var schemaClient = &http.Client{Timeout: 2 * time.Minute}
+
+func readSchema(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+	res, err := schemaClient.Get(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "download schema")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download schema %s: %s", source, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func parseOpenAPIDocument(b []byte) (*openapi_v2.Document, error) {
+	trimmed := bytes.TrimSpace(b)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc openapi_v2.Document
+		if err := proto.Unmarshal(b, &doc); err != nil {
+			return nil, errors.Wrap(err, "parse schema")
+		}
+		return &doc, nil
+	}
+	var info yaml.MapSlice
+	if err := yaml.Unmarshal(trimmed, &info); err != nil {
+		return nil, errors.Wrap(err, "parse schema")
+	}
+	doc, err := openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse schema")
+	}
+	return doc, nil
+}
+
+// builtinTypeOf returns the built-in type with the supplied group and kind.
+func builtinTypeOf(gk schema.GroupKind) (builtinType, bool) {
+	for _, g := range builtinGroups {
+		if g.name != gk.Group {
+			continue
+		}
+		for _, t := range g.types {
+			if t.kind == gk.Kind {
+				return t, true
+			}
+		}
+	}
+	return builtinType{}, false
+}
+
+// servedAlternative returns the preferred version of the kind of the supplied type, other than its own version, that
+// is served by the supplied minor version, using the same group if possible.
+func servedAlternative(gvk schema.GroupVersionKind, minor int) (schema.GroupVersion, bool) {
+	var alternatives []schema.GroupVersion
+	for _, g := range builtinGroups {
+		for _, t := range g.types {
+			if t.kind != gvk.Kind {
+				continue
+			}
+			for _, b := range t.versions {
+				if !b.servedBy(minor) || (g.name == gvk.Group && b.version == gvk.Version) {
+					continue
+				}
+				gv := schema.GroupVersion{Group: g.name, Version: b.version}
+				if g.name == gvk.Group {
+					alternatives = append([]schema.GroupVersion{gv}, alternatives...)
+				} else {
+					alternatives = append(alternatives, gv)
+				}
+				break
+			}
+		}
+	}
+	if len(alternatives) == 0 {
+		return schema.GroupVersion{}, false
+	}
+	return alternatives[0], true
+}
+
+// unservedError returns an error when the supplied type is a built-in type whose version is not served by the
+// Kubernetes version of the discovery, nil otherwise. The error suggests a served version of the kind, from the same
+// group if possible.
+func (d *offlineDiscovery) unservedError(gvk schema.GroupVersionKind) error {
+	t, ok := builtinTypeOf(gvk.GroupKind())
+	if !ok || t.servedVersion(gvk.Version, d.minor) {
+		return nil
+	}
+	alt, ok := servedAlternative(gvk, d.minor)
+	if !ok {
+		return fmt.Errorf("%s is not served by Kubernetes 1.%d", gvk.Kind, d.minor)
+	}
+	return fmt.Errorf("apiVersion %s is not served for %s by Kubernetes 1.%d, use %s", gvk.GroupVersion(), gvk.Kind, d.minor, alt)
+}
+
+// unservedValidator fails validation for built-in types whose version is not served.
+type unservedValidator struct {
+	err error
+}
+
+func (u *unservedValidator) Validate(obj *unstructured.Unstructured) []error {
+	return []error{u.err}
+}
+
+// NewOfflineMetadata returns metadata for a Kubernetes version, of the form 1.27, from bundled capabilities without
+// contacting a cluster. Schemas for validation are loaded from the supplied file or URL of the Open API document of
+// that version, typically the api/openapi-spec/swagger.json file of the Kubernetes source tree. Without a schema,
+// objects of served types cannot be validated.
+func NewOfflineMetadata(version string, schema string, defaultNs string, verbosity int) (*ServerMetadata, error) {
+	minor, err := ParseKubernetesVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return newServerMetadata(&offlineDiscovery{minor: minor, schema: schema}, defaultNs, verbosity)
+}
+
+// upstreamSchemaURL is the format of the URL of the Open API document of a minor version of Kubernetes 1.x in the
+// upstream source tree.
+var upstreamSchemaURL = "https://raw.githubusercontent.com/kubernetes/kubernetes/release-1.%d/api/openapi-spec/swagger.json"
+
+// CachedSchema returns the file of the Open API document of the supplied Kubernetes version, of the form 1.27, in the
+// supplied cache directory. The document is downloaded from the upstream source tree when it is not cached, such that
+// later runs need no network access.
+func CachedSchema(dir string, version string) (string, error) {
+	minor, err := ParseKubernetesVersion(version)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("swagger-1.%d.json", minor))
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	url := fmt.Sprintf(upstreamSchemaURL, minor)
+	sio.Noticef("downloading schema of Kubernetes 1.%d from %s\n", minor, url)
+	b, err := readSchema(url)
+	if err != nil {
+		return "", err
+	}
+	if _, err := parseOpenAPIDocument(b); err != nil {
+		return "", errors.Wrapf(err, "schema from %s", url)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	// write to a temporary file first so that concurrent runs never see partial documents
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// UnservedError returns an error for built-in types whose version is not served by the Kubernetes version of
+// offline metadata. It always returns nil for metadata of a cluster.
+func (sm *ServerMetadata) UnservedError(gvk schema.GroupVersionKind) error {
+	if d, ok := sm.disco.(*offlineDiscovery); ok {
+		return d.unservedError(gvk)
+	}
+	return nil
+}
+
+// APIStatus is the status of a version of a built-in type for a Kubernetes version.
+type APIStatus struct {
+	Removed     bool                // the version is no longer served
+	RemovedIn   int                 // the first minor version that does not serve the version, 0 if not scheduled
+	Replacement schema.GroupVersion // a served version of the kind to use instead, empty if none
+}
+
+// APIVersionStatus returns the status of the version of the supplied built-in type for Kubernetes 1.<minor>. It
+// returns nil when the version is served and not deprecated, and for types and versions that are not built-in. A
+// served version is deprecated when its removal is scheduled and a replacement is served by the same Kubernetes
+// version.
+func APIVersionStatus(gvk schema.GroupVersionKind, minor int) *APIStatus {
+	t, ok := builtinTypeOf(gvk.GroupKind())
+	if !ok {
+		return nil
+	}
+	for _, b := range t.versions {
+		if b.version != gvk.Version {
+			continue
+		}
+		alt, hasAlt := servedAlternative(gvk, minor)
+		switch {
+		case b.removed != 0 && minor >= b.removed:
+			return &APIStatus{Removed: true, RemovedIn: b.removed, Replacement: alt}
+		case b.servedBy(minor) && b.removed != 0 && hasAlt:
+			return &APIStatus{RemovedIn: b.removed, Replacement: alt}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
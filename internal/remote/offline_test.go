@@ -0,0 +1,249 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseKubernetesVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		minor    int
+		errorMsg string
+	}{
+		{version: "1.27", minor: 27},
+		{version: "v1.16", minor: 16},
+		{version: "1.30.2", minor: 30},
+		{version: "1.15", errorMsg: "unsupported Kubernetes version 1.15, must be between 1.16 and 1.30"},
+		{version: "2.1", errorMsg: `invalid Kubernetes version "2.1", must be of the form 1.<minor>`},
+		{version: "latest", errorMsg: `invalid Kubernetes version "latest", must be of the form 1.<minor>`},
+	}
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			minor, err := ParseKubernetesVersion(test.version)
+			if test.errorMsg != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, test.errorMsg, err.Error())
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, test.minor, minor)
+		})
+	}
+}
+
+func TestOfflineMetadata(t *testing.T) {
+	a := assert.New(t)
+	sm, err := NewOfflineMetadata("1.21", "", "foobar", 0)
+	require.Nil(t, err)
+	n, err := sm.IsNamespaced(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	require.Nil(t, err)
+	a.True(n)
+	n, err = sm.IsNamespaced(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "ClusterRole"})
+	require.Nil(t, err)
+	a.False(n)
+	_, err = sm.IsNamespaced(schema.GroupVersionKind{Group: "apps", Version: "v1beta1", Kind: "Deployment"})
+	require.NotNil(t, err)
+
+	canon, err := sm.canonicalGroupVersionKind(schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"})
+	require.Nil(t, err)
+	a.Equal(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}, canon)
+
+	name := sm.DisplayName(loadObject(t, "ns-good.json"))
+	a.Equal("namespaces foobar", name)
+
+	_, err = NewOfflineMetadata("1.12", "", "foobar", 0)
+	require.NotNil(t, err)
+}
+
+func TestOfflineUnserved(t *testing.T) {
+	sm, err := NewOfflineMetadata("1.25", "", "default", 0)
+	require.Nil(t, err)
+	tests := []struct {
+		gvk      schema.GroupVersionKind
+		errorMsg string
+	}{
+		{gvk: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+		{gvk: schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}},
+		{
+			gvk:      schema.GroupVersionKind{Group: "extensions", Version: "v1beta1", Kind: "Ingress"},
+			errorMsg: "apiVersion extensions/v1beta1 is not served for Ingress by Kubernetes 1.25, use networking.k8s.io/v1",
+		},
+		{
+			gvk:      schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"},
+			errorMsg: "apiVersion batch/v1beta1 is not served for CronJob by Kubernetes 1.25, use batch/v1",
+		},
+		{
+			gvk:      schema.GroupVersionKind{Group: "events.k8s.io", Version: "v1beta1", Kind: "Event"},
+			errorMsg: "apiVersion events.k8s.io/v1beta1 is not served for Event by Kubernetes 1.25, use events.k8s.io/v1",
+		},
+		{
+			gvk:      schema.GroupVersionKind{Group: "policy", Version: "v1beta1", Kind: "PodSecurityPolicy"},
+			errorMsg: "PodSecurityPolicy is not served by Kubernetes 1.25",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.gvk.String(), func(t *testing.T) {
+			err := sm.UnservedError(test.gvk)
+			if test.errorMsg == "" {
+				assert.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Equal(t, test.errorMsg, err.Error())
+			v, err := sm.ValidatorFor(test.gvk)
+			require.Nil(t, err)
+			errs := v.Validate(nil)
+			require.Equal(t, 1, len(errs))
+			assert.Equal(t, test.errorMsg, errs[0].Error())
+		})
+	}
+	assert.Nil(t, getServerMetadata(t, 0).UnservedError(schema.GroupVersionKind{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}))
+}
+
+func TestOfflineValidator(t *testing.T) {
+	nsGVK := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}
+	for _, file := range []string{"swagger-namespace.json", "swagger-2.0.0.pb-v1"} {
+		t.Run(file, func(t *testing.T) {
+			sm, err := NewOfflineMetadata("1.27", filepath.Join("testdata", file), "default", 0)
+			require.Nil(t, err)
+			v, err := sm.ValidatorFor(nsGVK)
+			require.Nil(t, err)
+			errs := v.Validate(loadObject(t, "ns-good.json").ToUnstructured())
+			require.Nil(t, errs)
+			errs = v.Validate(loadObject(t, "ns-bad.json").ToUnstructured())
+			require.Equal(t, 1, len(errs))
+			assert.Contains(t, errs[0].Error(), `unknown field "foo"`)
+		})
+	}
+}
+
+func TestOfflineNoSchema(t *testing.T) {
+	sm, err := NewOfflineMetadata("1.27", "", "default", 0)
+	require.Nil(t, err)
+	_, err = sm.ValidatorFor(schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"})
+	assert.Equal(t, ErrSchemaNotFound, err)
+
+	sm, err = NewOfflineMetadata("1.27", filepath.Join("testdata", "missing.json"), "default", 0)
+	require.Nil(t, err)
+	_, err = sm.ValidatorFor(schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing.json")
+}
+
+func TestAPIVersionStatus(t *testing.T) {
+	ingress := schema.GroupVersionKind{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}
+	cronJob := schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"}
+	tests := []struct {
+		gvk      schema.GroupVersionKind
+		minor    int
+		expected *APIStatus
+	}{
+		{gvk: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, minor: 25},
+		{gvk: schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, minor: 25},
+		{gvk: schema.GroupVersionKind{Group: "autoscaling", Version: "v1", Kind: "HorizontalPodAutoscaler"}, minor: 25},
+		{gvk: ingress, minor: 18, expected: &APIStatus{RemovedIn: 22, Replacement: schema.GroupVersion{Group: "networking.k8s.io", Version: "v1beta1"}}},
+		{gvk: ingress, minor: 21, expected: &APIStatus{RemovedIn: 22, Replacement: schema.GroupVersion{Group: "networking.k8s.io", Version: "v1"}}},
+		{gvk: ingress, minor: 22, expected: &APIStatus{Removed: true, RemovedIn: 22, Replacement: schema.GroupVersion{Group: "networking.k8s.io", Version: "v1"}}},
+		{gvk: cronJob, minor: 20},
+		{gvk: cronJob, minor: 21, expected: &APIStatus{RemovedIn: 25, Replacement: schema.GroupVersion{Group: "batch", Version: "v1"}}},
+		{gvk: cronJob, minor: 25, expected: &APIStatus{Removed: true, RemovedIn: 25, Replacement: schema.GroupVersion{Group: "batch", Version: "v1"}}},
+		{gvk: schema.GroupVersionKind{Group: "policy", Version: "v1beta1", Kind: "PodSecurityPolicy"}, minor: 24},
+		{gvk: schema.GroupVersionKind{Group: "policy", Version: "v1beta1", Kind: "PodSecurityPolicy"}, minor: 25, expected: &APIStatus{Removed: true, RemovedIn: 25}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s-1.%d", test.gvk, test.minor), func(t *testing.T) {
+			assert.Equal(t, test.expected, APIVersionStatus(test.gvk, test.minor))
+		})
+	}
+}
+
+func TestReadSchemaTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer server.Close()
+	defer close(stalled)
+	defer func(c *http.Client) { schemaClient = c }(schemaClient)
+	schemaClient = &http.Client{Timeout: 10 * time.Millisecond}
+	_, err := readSchema(server.URL + "/swagger.json")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "download schema")
+}
+
+func TestCachedSchema(t *testing.T) {
+	doc, err := ioutil.ReadFile(filepath.Join("testdata", "swagger-namespace.json"))
+	require.Nil(t, err)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/release-1.27.json":
+			_, _ = w.Write(doc)
+		case "/release-1.26.json":
+			_, _ = w.Write([]byte("{ not json"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(u string) { upstreamSchemaURL = u }(upstreamSchemaURL)
+	upstreamSchemaURL = server.URL + "/release-1.%d.json"
+
+	dir, err := ioutil.TempDir("", "schemas")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "cache")
+
+	file, err := CachedSchema(cache, "v1.27.3")
+	require.Nil(t, err)
+	a := assert.New(t)
+	a.Equal(filepath.Join(cache, "swagger-1.27.json"), file)
+	b, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+	a.Equal(doc, b)
+	_, err = CachedSchema(cache, "1.27")
+	require.Nil(t, err)
+	a.Equal(1, requests)
+
+	_, err = CachedSchema(cache, "1.26")
+	require.NotNil(t, err)
+	a.Contains(err.Error(), "/release-1.26.json")
+	_, err = os.Stat(filepath.Join(cache, "swagger-1.26.json"))
+	a.True(os.IsNotExist(err))
+
+	_, err = CachedSchema(cache, "1.25")
+	require.NotNil(t, err)
+	a.Contains(err.Error(), "404 Not Found")
+
+	_, err = CachedSchema(cache, "1.5")
+	require.NotNil(t, err)
+	a.Equal("unsupported Kubernetes version 1.5, must be between 1.16 and 1.30", err.Error())
+}
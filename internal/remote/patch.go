@@ -63,6 +63,7 @@ type patcher struct {
 	overwrite     bool
 	backOff       clockwork.Clock
 	openAPILookup openAPILookup
+	annotations   map[string]string // annotations added to patches that change the object, if any
 }
 
 type serialized struct {
@@ -147,8 +148,40 @@ func newPatchResult(src string, kind types.PatchType, patch []byte) *updateResul
 
 // getPatchContents returns the contents of the patch to take the supplied object to its modified version considering
 // any previous configuration applied. The result has a SkipReason set when nothing needs to be done. This is the only
-// way to correctly determine if a patch needs to be applied.
+// way to correctly determine if a patch needs to be applied. The annotations of the patcher are added to patches that
+// change the object such that they never cause an update by themselves.
 func (p *patcher) getPatchContents(serverObj *unstructured.Unstructured, desired model.K8sObject) (*updateResult, error) {
+	result, err := p.threeWayPatch(serverObj, desired)
+	if err != nil || result.SkipReason != "" || len(p.annotations) == 0 {
+		return result, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(result.patch, &data); err != nil {
+		return nil, errors.Wrap(err, "unmarshal patch")
+	}
+	meta, _ := data["metadata"].(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+		data["metadata"] = meta
+	}
+	anns, _ := meta["annotations"].(map[string]interface{})
+	if anns == nil {
+		anns = map[string]interface{}{}
+		meta["annotations"] = anns
+	}
+	for k, v := range p.annotations {
+		anns[k] = v
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal patch")
+	}
+	result.patch = b
+	return result, nil
+}
+
+// threeWayPatch returns the patch between the pristine, desired and server versions of the object.
+func (p *patcher) threeWayPatch(serverObj *unstructured.Unstructured, desired model.K8sObject) (*updateResult, error) {
 	// get the serialized versions of server, desired and pristine
 	ser, err := p.getSerialized(serverObj, desired)
 	if err != nil {
@@ -204,13 +237,16 @@ func (p *patcher) getPatchContents(serverObj *unstructured.Unstructured, desired
 	return newPatchResult("struct definition", types.StrategicMergePatchType, patch), nil
 }
 
-func (p *patcher) patchSimple(serverObj *unstructured.Unstructured, desired model.K8sObject) (result *updateResult, err error) {
-	result, err = p.getPatchContents(serverObj, desired)
-	if err != nil {
-		return
+// patchSimple patches the server object with the supplied patch contents for it, computing them when not supplied.
+func (p *patcher) patchSimple(serverObj *unstructured.Unstructured, desired model.K8sObject, result *updateResult) (_ *updateResult, err error) {
+	if result == nil {
+		result, err = p.getPatchContents(serverObj, desired)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if result.SkipReason != "" {
-		return
+		return result, nil
 	}
 	gvk := serverObj.GetObjectKind().GroupVersionKind()
 	ri, err := p.provider(gvk, serverObj.GetNamespace())
@@ -221,12 +257,15 @@ func (p *patcher) patchSimple(serverObj *unstructured.Unstructured, desired mode
 	return result, err
 }
 
-func (p *patcher) patch(serverObj *unstructured.Unstructured, desired model.K8sObject) (*updateResult, error) {
+// patch patches the server object to the desired state, retrying on conflicts. The supplied contents, if any, are
+// those returned by getPatchContents for the server object and are used for the first attempt. Retries compute the
+// patch again against the object read from the server.
+func (p *patcher) patch(serverObj *unstructured.Unstructured, desired model.K8sObject, contents *updateResult) (*updateResult, error) {
 	gvk := serverObj.GetObjectKind().GroupVersionKind()
 	namespace := serverObj.GetNamespace()
 	name := serverObj.GetName()
 	var getErr error
-	result, err := p.patchSimple(serverObj, desired)
+	result, err := p.patchSimple(serverObj, desired, contents)
 	for i := 1; i <= maxPatchRetry && apiErrors.IsConflict(err); i++ {
 		if i > triesBeforeBackOff {
 			p.backOff.Sleep(backOffPeriod)
@@ -239,7 +278,7 @@ func (p *patcher) patch(serverObj *unstructured.Unstructured, desired model.K8sO
 		if getErr != nil {
 			return nil, getErr
 		}
-		result, err = p.patchSimple(serverObj, desired)
+		result, err = p.patchSimple(serverObj, desired, nil)
 	}
 	return result, err
 }
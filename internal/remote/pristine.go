@@ -19,7 +19,9 @@ package remote
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 
 	"github.com/pkg/errors"
@@ -72,6 +74,18 @@ func unzipData(s string) (map[string]interface{}, error) {
 	return data, nil
 }
 
+// RenderHash returns a hash of the supplied object as rendered from source. This hash is stored on the
+// server object when it is applied such that subsequent runs can detect that the local configuration has
+// not changed without fetching the remote object.
+func RenderHash(obj model.K8sLocalObject) (string, error) {
+	b, err := json.Marshal(obj.ToUnstructured().Object)
+	if err != nil {
+		return "", errors.Wrap(err, "render hash JSON marshal")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 type pristineReader interface {
 	getPristine(annotations map[string]string, obj *unstructured.Unstructured) (pristine *unstructured.Unstructured, source string)
 }
@@ -109,11 +123,16 @@ func (k qbecPristine) createFromPristine(pristine model.K8sLocalObject) (model.K
 	if err != nil {
 		return nil, errors.Wrap(err, "zip data")
 	}
+	hash, err := RenderHash(pristine)
+	if err != nil {
+		return nil, err
+	}
 	annotations := annotated.GetAnnotations()
 	if annotations == nil {
 		annotations = map[string]string{}
 	}
 	annotations[model.QbecNames.PristineAnnotation] = zipped
+	annotations[model.QbecNames.RenderHashAnnotation] = hash
 	annotated.SetAnnotations(annotations)
 	return model.NewK8sLocalObject(annotated.Object, pristine.Application(), pristine.Component(), pristine.Environment()), nil
 }
@@ -135,9 +154,6 @@ func (f fallbackPristine) getPristine(annotations map[string]string, orig *unstr
 
 func getPristineVersion(obj *unstructured.Unstructured, includeFallback bool) (*unstructured.Unstructured, string) {
 	pristineReaders := []pristineReader{qbecPristine{}, fallbackPristine{}}
-	if includeFallback {
-		pristineReaders = append(pristineReaders)
-	}
 	annotations := obj.GetAnnotations()
 	if annotations == nil {
 		annotations = map[string]string{}
@@ -57,8 +57,12 @@ func (o *objectLister) listObjectsOfType(gvk schema.GroupVersionKind, namespace
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("get resource interface for %s", gvk))
 	}
+	selector := fmt.Sprintf("%s=%s,%s=%s", model.QbecNames.ApplicationLabel, o.scope.Application, model.QbecNames.EnvironmentLabel, o.scope.Environment)
+	if o.scope.LabelSelector != "" {
+		selector += "," + o.scope.LabelSelector
+	}
 	list, err := xface.List(metav1.ListOptions{
-		LabelSelector:        fmt.Sprintf("%s=%s,%s=%s", model.QbecNames.ApplicationLabel, o.scope.Application, model.QbecNames.EnvironmentLabel, o.scope.Environment),
+		LabelSelector:        selector,
 		IncludeUninitialized: true,
 	})
 	if err != nil {
@@ -109,12 +113,34 @@ outer:
 			app:       labels[model.QbecNames.ApplicationLabel],
 			component: anns[model.QbecNames.ComponentAnnotation],
 			env:       labels[model.QbecNames.EnvironmentLabel],
+			hash:      anns[model.QbecNames.RenderHashAnnotation],
+			anns:      retainedAnnotations(anns),
 		}
 		ret = append(ret, mm)
 	}
 	return ret, nil
 }
 
+// retainedAnnotations returns the annotations from the supplied ones that are kept for listed objects, nil if there
+// are none. These are the deploy details shown by status and the protection checked before deletes.
+func retainedAnnotations(anns map[string]string) map[string]string {
+	var ret map[string]string
+	for _, k := range []string{
+		model.QbecNames.RunURLAnnotation,
+		model.QbecNames.PipelineIDAnnotation,
+		model.QbecNames.PlanHashAnnotation,
+		model.QbecNames.ProtectedAnnotation,
+	} {
+		if v, ok := anns[k]; ok {
+			if ret == nil {
+				ret = map[string]string{}
+			}
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
 type errorContext struct {
 	gvk       schema.GroupVersionKind
 	namespace string
@@ -0,0 +1,104 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// this file contains the enforcement of read-only mode. Mutating operations of the client fail early with a
+// clear error and, independently of that, every HTTP request that could change server state is rejected
+// before it is sent. This ensures that no code path can make changes using the client when read-only mode
+// is in effect, even if it bypasses the high-level operations.
+
+// ErrReadOnly is returned for operations that would change objects on the server in read-only mode.
+var ErrReadOnly = errors.New("read-only mode, changes to the cluster are not allowed")
+
+// readOnlyTransport rejects all requests that can change server state.
+type readOnlyTransport struct {
+	delegate http.RoundTripper
+	reason   error // the error for rejected requests, ErrReadOnly when not set
+}
+
+// reviewPath matches the path suffixes of the access and token reviews that the client may create. The server
+// evaluates these reviews and returns the result without persisting anything. The part of the path before the
+// suffix is the prefix under which the API server is served, if any, such as the cluster path of a Rancher proxy.
+var reviewPath = regexp.MustCompile(`/apis/(authorization\.k8s\.io/[^/]+/(selfsubjectaccessreviews|selfsubjectrulesreviews)|authentication\.k8s\.io/[^/]+/tokenreviews)$`)
+
+// isReviewPath returns true if the supplied path is that of a review. A prefix that itself has API paths, such as
+// that of a service proxy, is not a server prefix and the request is forwarded elsewhere.
+func isReviewPath(path string) bool {
+	loc := reviewPath.FindStringIndex(path)
+	if loc == nil {
+		return false
+	}
+	prefix := path[:loc[0]] + "/"
+	return !strings.Contains(prefix, "/api/") && !strings.Contains(prefix, "/apis/")
+}
+
+// isSafeRequest returns true if the supplied request cannot change server state. Server-side dry-runs and reviews
+// are safe since the server does not persist the results.
+func isSafeRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		if isReviewPath(req.URL.Path) {
+			return true
+		}
+	}
+	return req.URL.Query().Get("dryRun") == "All"
+}
+
+func (r *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isSafeRequest(req) {
+		reason := r.reason
+		if reason == nil {
+			reason = ErrReadOnly
+		}
+		return nil, errors.Wrap(reason, fmt.Sprintf("%s %s", req.Method, req.URL.Path))
+	}
+	return r.delegate.RoundTrip(req)
+}
+
+// wrapReadOnly returns a transport wrapper that applies the read-only transport after the supplied wrapper, if any.
+// Rejected requests fail with the supplied reason, or ErrReadOnly when it is nil.
+func wrapReadOnly(wrap func(rt http.RoundTripper) http.RoundTripper, reason error) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &readOnlyTransport{delegate: rt, reason: reason}
+	}
+}
+
+// checkWritable returns ErrReadOnly if the client is in read-only mode, or the interlock error if the kubeconfig did
+// not meet the expectations of the environment.
+func (c *Client) checkWritable() error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if c.interlock != nil {
+		return c.interlock
+	}
+	return nil
+}
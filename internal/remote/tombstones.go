@@ -0,0 +1,88 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tombstonesKey is the key of the config map data that has the tombstones.
+const tombstonesKey = "tombstones.json"
+
+// Tombstone records an object that was deleted by qbec.
+type Tombstone struct {
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	Component  string    `json:"component,omitempty"`
+	DeletedAt  time.Time `json:"deletedAt"`
+	Command    string    `json:"command"` // the qbec command that deleted the object
+	RunURL     string    `json:"runUrl,omitempty"`
+	PipelineID string    `json:"pipelineId,omitempty"`
+}
+
+// appendTombstones returns the serialized form of the tombstones in the supplied data with the supplied tombstones
+// added, keeping at most max of the latest tombstones.
+func appendTombstones(data string, add []Tombstone, max int) (string, error) {
+	var list []Tombstone
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return "", errors.Wrap(err, "unmarshal tombstones")
+		}
+	}
+	list = append(list, add...)
+	if len(list) > max {
+		list = list[len(list)-max:]
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// RecordTombstones adds the supplied tombstones to the config map with the supplied namespace and name, creating it
+// if needed. At most max tombstones are kept, older ones are dropped first.
+func (c *Client) RecordTombstones(namespace, name string, tombstones []Tombstone, max int) error {
+	if len(tombstones) == 0 {
+		return nil
+	}
+	return c.updateConfigMapData(namespace, name, tombstonesKey, func(existing string) (string, error) {
+		return appendTombstones(existing, tombstones, max)
+	})
+}
+
+// Tombstones returns the tombstones recorded in the config map with the supplied namespace and name, oldest first.
+// It returns no tombstones if the config map does not exist.
+func (c *Client) Tombstones(namespace, name string) ([]Tombstone, error) {
+	data, err := c.configMapData(namespace, name, tombstonesKey)
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+	var ret []Tombstone
+	if err := json.Unmarshal([]byte(data), &ret); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unmarshal tombstones in %s/%s", namespace, name))
+	}
+	return ret, nil
+}
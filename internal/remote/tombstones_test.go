@@ -0,0 +1,48 @@
+/*
+   Copyright 2019 Splunk Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendTombstones(t *testing.T) {
+	var first []Tombstone
+	for i := 0; i < 3; i++ {
+		first = append(first, Tombstone{Kind: "ConfigMap", Name: fmt.Sprintf("cm%d", i), Command: "delete"})
+	}
+	data, err := appendTombstones("", first, 4)
+	require.Nil(t, err)
+	data, err = appendTombstones(data, []Tombstone{{Kind: "Secret", Name: "s1", Command: "apply"}, {Kind: "Secret", Name: "s2", Command: "apply"}}, 4)
+	require.Nil(t, err)
+	var list []Tombstone
+	require.Nil(t, json.Unmarshal([]byte(data), &list))
+	var names []string
+	for _, ts := range list {
+		names = append(names, ts.Name)
+	}
+	assert.Equal(t, []string{"cm1", "cm2", "s1", "s2"}, names)
+
+	_, err = appendTombstones("{", first, 4)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unmarshal tombstones")
+}
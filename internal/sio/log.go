@@ -38,15 +38,15 @@ const (
 // EnableColors enables colorized output when set. True by default.
 var EnableColors = true
 
-func startColors(codes ...string) {
+func startColors(w io.Writer, codes ...string) {
 	if EnableColors {
-		fmt.Fprint(Output, strings.Join(codes, ""))
+		fmt.Fprint(w, strings.Join(codes, ""))
 	}
 }
 
-func reset() {
+func reset(w io.Writer) {
 	if EnableColors {
-		fmt.Fprint(Output, codeReset)
+		fmt.Fprint(w, codeReset)
 	}
 }
 
@@ -67,65 +67,75 @@ func Printf(format string, args ...interface{}) {
 // Noticeln prints the supplied arguments in a way that they will be noticed.
 // Use sparingly.
 func Noticeln(args ...interface{}) {
-	startColors(attrBold)
-	fmt.Fprintln(Output, args...)
-	reset()
+	Fnoticeln(Output, args...)
 }
 
 // Noticef prints the supplied arguments in a way that they will be noticed.
 // Use sparingly.
 func Noticef(format string, args ...interface{}) {
-	startColors(attrBold)
-	fmt.Fprintf(Output, format, args...)
-	reset()
+	Fnoticef(Output, format, args...)
+}
+
+// Fnoticeln is like Noticeln but prints to the supplied writer.
+func Fnoticeln(w io.Writer, args ...interface{}) {
+	startColors(w, attrBold)
+	fmt.Fprintln(w, args...)
+	reset(w)
+}
+
+// Fnoticef is like Noticef but prints to the supplied writer.
+func Fnoticef(w io.Writer, format string, args ...interface{}) {
+	startColors(w, attrBold)
+	fmt.Fprintf(w, format, args...)
+	reset(w)
 }
 
 // Debugln prints the supplied arguments to the standard writer, de-emphasized
 func Debugln(args ...interface{}) {
-	startColors(attrDim)
+	startColors(Output, attrDim)
 	fmt.Fprintln(Output, args...)
-	reset()
+	reset(Output)
 }
 
 // Debugf prints the supplied arguments to the standard writer, de-emphasized.
 func Debugf(format string, args ...interface{}) {
-	startColors(attrDim)
+	startColors(Output, attrDim)
 	fmt.Fprintf(Output, format, args...)
-	reset()
+	reset(Output)
 }
 
 // Warnln prints the supplied arguments to the standard writer
 // with some indication for a warning.
 func Warnln(args ...interface{}) {
-	startColors(colorMagenta, attrBold)
+	startColors(Output, colorMagenta, attrBold)
 	fmt.Fprint(Output, "[warn] ")
 	fmt.Fprintln(Output, args...)
-	reset()
+	reset(Output)
 }
 
 // Warnf prints the supplied arguments to the standard writer
 // with some indication for a warning.
 func Warnf(format string, args ...interface{}) {
-	startColors(colorMagenta, attrBold)
+	startColors(Output, colorMagenta, attrBold)
 	fmt.Fprint(Output, "[warn] ")
 	fmt.Fprintf(Output, format, args...)
-	reset()
+	reset(Output)
 }
 
 // Errorln prints the supplied arguments to the standard writer
 // with some indication that an error has occurred.
 func Errorln(args ...interface{}) {
-	startColors(colorRed, attrBold)
+	startColors(Output, colorRed, attrBold)
 	fmt.Fprint(Output, unicodeX+" ")
 	fmt.Fprintln(Output, args...)
-	reset()
+	reset(Output)
 }
 
 // Errorf prints the supplied arguments to the standard writer
 // with some indication that an error has occurred.
 func Errorf(format string, args ...interface{}) {
-	startColors(colorRed, attrBold)
+	startColors(Output, colorRed, attrBold)
 	fmt.Fprint(Output, unicodeX+" ")
 	fmt.Fprintf(Output, format, args...)
-	reset()
+	reset(Output)
 }
@@ -91,3 +91,19 @@ func TestOutputWithColors(t *testing.T) {
 	a.Contains(s, colorMagenta+attrBold+"[warn] This is a warning\n"+codeReset)
 	a.Contains(s, colorRed+attrBold+unicodeX+" This is an error\n"+codeReset)
 }
+
+func TestNoticeToWriter(t *testing.T) {
+	var buf, w bytes.Buffer
+	orig := Output
+	origC := EnableColors
+	defer func() { Output = orig; EnableColors = origC }()
+	EnableColors = true
+	Output = &buf
+
+	Fnoticeln(&w, "this", "is", "a", "notice")
+	Fnoticef(&w, "This is %s %s\n", "a", "notice")
+
+	a := assert.New(t)
+	a.Equal("", buf.String())
+	a.Equal(attrBold+"this is a notice\n"+codeReset+attrBold+"This is a notice\n"+codeReset, w.String())
+}
@@ -18,6 +18,7 @@
 package vm
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -191,3 +192,10 @@ func New(config Config) *VM {
 func (v *VM) Config() Config {
 	return v.config
 }
+
+// Import returns a jsonnet expression that imports the supplied file. The file name is quoted such that it cannot
+// terminate the string literal early, whatever characters it contains.
+func Import(file string) string {
+	b, _ := json.Marshal(file) // cannot fail for a string, and JSON strings are valid jsonnet strings
+	return "import " + string(b)
+}
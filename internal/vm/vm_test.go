@@ -18,7 +18,9 @@ package vm
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/cobra"
@@ -204,3 +206,15 @@ func TestVMFromScratch(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, `"bartrue"`+"\n", out)
 }
+
+func TestImportQuotesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vm-import")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, `it's a "test".jsonnet`)
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{ foo: 'bar' }`), 0644))
+	jvm := New(Config{})
+	out, err := jvm.EvaluateSnippet("test.jsonnet", "("+Import(file)+").foo")
+	require.Nil(t, err)
+	assert.Equal(t, `"bar"`+"\n", out)
+}
@@ -21,27 +21,35 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/chzyer/readline"
+	"github.com/google/go-jsonnet"
 	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/splunk/qbec/internal/commands"
+	"github.com/splunk/qbec/internal/faults"
 	"github.com/splunk/qbec/internal/model"
 	"github.com/splunk/qbec/internal/objsort"
 	"github.com/splunk/qbec/internal/remote"
 	"github.com/splunk/qbec/internal/sio"
 	"github.com/splunk/qbec/internal/vm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type gOpts struct {
-	verbose   int            // verbosity level
-	app       *model.App     // app loaded from file
-	config    vm.Config      // jsonnet VM config
-	k8sConfig *remote.Config // remote config for k8s, when needed
-	colors    bool           // colorize output
-	yes       bool           // auto-confirm
+	verbose      int              // verbosity level
+	app          *model.App       // app loaded from file
+	config       vm.Config        // jsonnet VM config
+	k8sConfig    *remote.Config   // remote config for k8s, when needed
+	colors       bool             // colorize output
+	yes          bool             // auto-confirm
+	faults       *faults.Injector // fault injector, when faults are injected
+	readOnly     bool             // reject all changes to clusters
+	forceContext bool             // allow changes to clusters when the kubeconfig does not meet the interlock of the environment
 }
 
 func (g gOpts) App() *model.App {
@@ -50,6 +58,9 @@ func (g gOpts) App() *model.App {
 
 func (g gOpts) VM() *vm.VM {
 	cfg := g.config.WithLibPaths(g.app.Spec.LibPaths)
+	if g.faults != nil && cfg.Importer == nil {
+		cfg.Importer = g.faults.Importer(&jsonnet.FileImporter{JPaths: cfg.LibPaths})
+	}
 	return vm.New(cfg)
 }
 
@@ -69,6 +80,10 @@ func (c *client) ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, er
 	return c.ServerMetadata().ValidatorFor(gvk)
 }
 
+func (c *client) FieldDefaults(obj *unstructured.Unstructured) ([]remote.FieldDefault, error) {
+	return c.ServerMetadata().FieldDefaults(obj)
+}
+
 func (c *client) DisplayName(o model.K8sMeta) string {
 	return c.ServerMetadata().DisplayName(o)
 }
@@ -77,6 +92,133 @@ func (c *client) IsNamespaced(kind schema.GroupVersionKind) (bool, error) {
 	return c.ServerMetadata().IsNamespaced(kind)
 }
 
+func (c *client) Impersonate(user string, groups []string) (commands.Client, error) {
+	rem, err := c.Client.Impersonate(user, groups)
+	if err != nil {
+		return nil, err
+	}
+	return &client{Client: rem}, nil
+}
+
+// faultyClient injects faults into remote operations of the client that it wraps.
+type faultyClient struct {
+	commands.Client
+	injector *faults.Injector
+}
+
+func (f *faultyClient) Get(obj model.K8sMeta) (*unstructured.Unstructured, error) {
+	if err := f.injector.APIFault("get"); err != nil {
+		return nil, err
+	}
+	return f.Client.Get(obj)
+}
+
+func (f *faultyClient) Sync(obj model.K8sLocalObject, opts remote.SyncOptions) (*remote.SyncResult, error) {
+	if err := f.injector.APIFault("sync"); err != nil {
+		return nil, err
+	}
+	return f.Client.Sync(obj, opts)
+}
+
+func (f *faultyClient) ListExtraObjects(ignore []model.K8sQbecMeta, scope remote.ListQueryConfig) ([]model.K8sQbecMeta, error) {
+	if err := f.injector.APIFault("list"); err != nil {
+		return nil, err
+	}
+	return f.Client.ListExtraObjects(ignore, scope)
+}
+
+func (f *faultyClient) Delete(obj model.K8sMeta, opts remote.DeleteOptions) (*remote.SyncResult, error) {
+	if err := f.injector.APIFault("delete"); err != nil {
+		return nil, err
+	}
+	return f.Client.Delete(obj, opts)
+}
+
+func (f *faultyClient) UpdateMetadata(obj model.K8sMeta, labels, annotations map[string]string, dryRun bool) (*remote.SyncResult, error) {
+	if err := f.injector.APIFault("update metadata"); err != nil {
+		return nil, err
+	}
+	return f.Client.UpdateMetadata(obj, labels, annotations, dryRun)
+}
+
+func (f *faultyClient) RenderHashes(scope remote.ListQueryConfig) (remote.ObjectHashes, error) {
+	if err := f.injector.APIFault("list"); err != nil {
+		return nil, err
+	}
+	return f.Client.RenderHashes(scope)
+}
+
+func (f *faultyClient) ListObjects(gvk schema.GroupVersionKind, namespace string) ([]*unstructured.Unstructured, error) {
+	if err := f.injector.APIFault("list"); err != nil {
+		return nil, err
+	}
+	return f.Client.ListObjects(gvk, namespace)
+}
+
+func (f *faultyClient) ValidatorFor(gvk schema.GroupVersionKind) (remote.Validator, error) {
+	if err := f.injector.APIFault("get schema"); err != nil {
+		return nil, err
+	}
+	return f.Client.ValidatorFor(gvk)
+}
+
+func (f *faultyClient) FieldDefaults(obj *unstructured.Unstructured) ([]remote.FieldDefault, error) {
+	if err := f.injector.APIFault("get schema"); err != nil {
+		return nil, err
+	}
+	return f.Client.FieldDefaults(obj)
+}
+
+func (f *faultyClient) RecordTombstones(namespace, name string, tombstones []remote.Tombstone, max int) error {
+	if err := f.injector.APIFault("record tombstones"); err != nil {
+		return err
+	}
+	return f.Client.RecordTombstones(namespace, name, tombstones, max)
+}
+
+func (f *faultyClient) Tombstones(namespace, name string) ([]remote.Tombstone, error) {
+	if err := f.injector.APIFault("get"); err != nil {
+		return nil, err
+	}
+	return f.Client.Tombstones(namespace, name)
+}
+
+func (f *faultyClient) Inventory(namespace, name string) ([]string, error) {
+	if err := f.injector.APIFault("get"); err != nil {
+		return nil, err
+	}
+	return f.Client.Inventory(namespace, name)
+}
+
+func (f *faultyClient) RecordInventory(namespace, name string, components []string) error {
+	if err := f.injector.APIFault("record inventory"); err != nil {
+		return err
+	}
+	return f.Client.RecordInventory(namespace, name, components)
+}
+
+func (f *faultyClient) ServerVersion() (string, error) {
+	if err := f.injector.APIFault("server version"); err != nil {
+		return "", err
+	}
+	return f.Client.ServerVersion()
+}
+
+func (f *faultyClient) CanI(verb string, gvk schema.GroupVersionKind, namespace string) (bool, string, error) {
+	if err := f.injector.APIFault("access review"); err != nil {
+		return false, "", err
+	}
+	return f.Client.CanI(verb, gvk, namespace)
+}
+
+func (f *faultyClient) Impersonate(user string, groups []string) (commands.Client, error) {
+	c, err := f.Client.Impersonate(user, groups)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyClient{Client: c, injector: f.injector}, nil
+}
+
 func (g gOpts) DefaultNamespace(env string) string {
 	envObj := g.app.Spec.Environments[env]
 	ns := envObj.DefaultNamespace
@@ -86,29 +228,67 @@ func (g gOpts) DefaultNamespace(env string) string {
 	return ns
 }
 
+// checkSingleCluster returns an error if the supplied environment is deployed to multiple clusters, which need to be
+// connected to one at a time.
+func (g gOpts) checkSingleCluster(env string) error {
+	if clusters := g.app.ClusterEnvironments(env); clusters != nil {
+		return fmt.Errorf("environment %s is deployed to multiple clusters, use one of %s", env, strings.Join(clusters, ", "))
+	}
+	return nil
+}
+
 func (g gOpts) Client(env string) (commands.Client, error) {
 	envObj, ok := g.app.Spec.Environments[env]
 	if !ok {
 		return nil, fmt.Errorf("get client: invalid environment %q", env)
 	}
+	if err := g.checkSingleCluster(env); err != nil {
+		return nil, err
+	}
 	ns := envObj.DefaultNamespace
 	if ns == "" {
 		ns = "default"
 	}
 	rem, err := g.k8sConfig.Client(remote.ConnectOpts{
-		EnvName:   env,
-		ServerURL: envObj.Server,
-		Namespace: ns,
-		Verbosity: g.verbose,
+		EnvName:        env,
+		ServerURL:      envObj.Server,
+		Context:        envObj.Context,
+		ContextPattern: envObj.ContextPattern,
+		Namespace:      ns,
+		Verbosity:      g.verbose,
+		ReadOnly:       g.readOnly,
+		Interlock:      envObj.Interlock,
+		ForceContext:   g.forceContext,
 	})
 	if err != nil {
 		return nil, err
 	}
+	if g.faults != nil {
+		return &faultyClient{Client: &client{Client: rem}, injector: g.faults}, nil
+	}
 	return &client{Client: rem}, nil
 }
 
+func (g gOpts) ResolveContext(env string) (*remote.ResolvedContext, error) {
+	envObj, ok := g.app.Spec.Environments[env]
+	if !ok {
+		return nil, fmt.Errorf("resolve context: invalid environment %q", env)
+	}
+	if err := g.checkSingleCluster(env); err != nil {
+		return nil, err
+	}
+	return g.k8sConfig.ResolveContext(remote.ConnectOpts{
+		EnvName:        env,
+		ServerURL:      envObj.Server,
+		Context:        envObj.Context,
+		ContextPattern: envObj.ContextPattern,
+	})
+}
+
 func (g gOpts) SortConfig(provider objsort.Namespaced) objsort.Config {
 	return objsort.Config{
+		OrderingProvider:      objsort.KindOrdering(g.app.ApplyOrders()),
+		ComponentDependencies: g.app.ComponentDependencies(),
 		NamespacedIndicator: func(gvk schema.GroupVersionKind) (bool, error) {
 			ret, err := provider(gvk)
 			if err != nil {
@@ -130,7 +310,11 @@ func (g gOpts) Confirm(context string) error {
 	if g.yes {
 		return nil
 	}
-	inst, err := readline.New("Do you want to continue [y/n]: ")
+	// the prompt is written to stderr such that it does not get mixed with data written to stdout
+	inst, err := readline.NewEx(&readline.Config{
+		Prompt: "Do you want to continue [y/n]: ",
+		Stdout: os.Stderr,
+	})
 	if err != nil {
 		return err
 	}
@@ -160,6 +344,11 @@ func defaultRoot() string {
 	return envOrDefault("QBEC_ROOT", "")
 }
 
+func defaultReadOnly() bool {
+	b, _ := strconv.ParseBool(envOrDefault("QBEC_READ_ONLY", "false"))
+	return b
+}
+
 func usageTemplate(rootCmd string) string {
 	return fmt.Sprintf(`Usage:{{if .Runnable}}
   {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
@@ -242,6 +431,7 @@ func setWorkDir(specified string) error {
 func setup(root *cobra.Command) {
 	var opts gOpts
 	var rootDir string
+	var faultSpec string
 
 	vmConfigFn := vm.ConfigFromCommandParams(root, "vm:")
 	cfg := remote.NewConfig(root, "k8s:")
@@ -250,6 +440,11 @@ func setup(root *cobra.Command) {
 	root.PersistentFlags().IntVarP(&opts.verbose, "verbose", "v", 0, "verbosity level")
 	root.PersistentFlags().BoolVar(&opts.colors, "colors", false, "colorize output (set automatically if not specified)")
 	root.PersistentFlags().BoolVar(&opts.yes, "yes", false, "do not prompt for confirmation")
+	root.PersistentFlags().BoolVar(&opts.readOnly, "read-only", defaultReadOnly(), "reject all changes to clusters, regardless of command (from QBEC_READ_ONLY)")
+	root.PersistentFlags().BoolVar(&opts.forceContext, "force-context", false, "allow changes to environments whose interlock expectations of the kubeconfig are not met")
+	// fault injection is meant for testing tools and processes that wrap qbec and is not advertised
+	root.PersistentFlags().StringVar(&faultSpec, "inject-faults", "", "inject faults, e.g. api-errors=0.1,slow=0.2,delay=2s,eval-errors=0.05,seed=42")
+	root.PersistentFlags().Lookup("inject-faults").Hidden = true
 
 	root.AddCommand(newOptionsCommand(root))
 	root.AddCommand(newVersionCommand())
@@ -257,6 +452,9 @@ func setup(root *cobra.Command) {
 		if cmd.Name() == "version" || cmd.Name() == "init" { // don't make the version command dependent on work dir
 			return nil
 		}
+		if cmd.HasParent() && cmd.Parent().Name() == "convert" { // conversions create new apps
+			return nil
+		}
 		if !cmd.Flags().Changed("colors") {
 			opts.colors = isatty.IsTerminal(os.Stdout.Fd())
 		}
@@ -275,6 +473,17 @@ func setup(root *cobra.Command) {
 		}
 		opts.config = conf
 		opts.k8sConfig = cfg
+		if opts.readOnly {
+			sio.Noticeln("read-only mode, all changes to clusters will be rejected")
+		}
+		if faultSpec != "" {
+			fc, err := faults.Parse(faultSpec)
+			if err != nil {
+				return errors.Wrap(err, "--inject-faults")
+			}
+			sio.Warnf("injecting faults: %s\n", faultSpec)
+			opts.faults = faults.New(fc)
+		}
 		return nil
 	}
 	commands.Setup(root, func() commands.StdOptionsWithClient {